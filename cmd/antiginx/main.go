@@ -0,0 +1,355 @@
+// Command antiginx is a command-line client of the AntiGinx API for shell
+// scripts and CI pipelines. It submits premium scans, waits for them to
+// finish, prints a summary of the failed tests by severity and exits
+// non-zero when a test failed with at least a given severity:
+//
+//	export ANTIGINX_URL=https://api.example.com ANTIGINX_API_KEY=agx_...
+//	antiginx scan -profile full -fail-on high https://example.com
+//
+// It authenticates with an API key, which needs the scans:write scope to
+// submit scans and scans:read to read them.
+//
+// Exit codes: 0 when the gate passed, 1 when it failed (a failed test of
+// -fail-on severity or worse, or a scan that didn't complete), 2 for usage
+// errors and 3 when the API couldn't be reached or refused a request, or
+// the wait timed out.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/pkg/client"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const (
+	exitPassed = 0
+	exitFailed = 1
+	exitUsage  = 2
+	exitError  = 3
+)
+
+const defaultURL = "http://localhost:4000"
+
+// severityRanks orders severities like the API does.
+var severityRanks = map[string]int{
+	"critical": 5,
+	"high":     4,
+	"medium":   3,
+	"low":      2,
+	"info":     1,
+	"none":     0,
+}
+
+// severities are the severities summaries count, most severe first.
+var severities = []string{"critical", "high", "medium", "low", "info"}
+
+const usage = `Usage: antiginx <command> [flags]
+
+Commands:
+  scan <url>   submit a scan, wait for it to finish and print its summary
+  get <id>     print the summary of a scan
+  version      print the version
+
+The API is read from ANTIGINX_URL (default ` + defaultURL + `) and the API key
+from ANTIGINX_API_KEY. Run "antiginx <command> -h" for the flags of a command.
+
+Exit codes: 0 gate passed, 1 gate failed, 2 usage error, 3 API error or timeout.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch args[0] {
+	case "scan":
+		return runScan(ctx, args[1:], stdout, stderr)
+	case "get":
+		return runGet(ctx, args[1:], stdout, stderr)
+	case "version":
+		fmt.Fprintln(stdout, "antiginx", version)
+		return exitPassed
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitPassed
+	}
+	fmt.Fprintf(stderr, "antiginx: unknown command %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// reportFlags are the flags of the commands that print a scan.
+type reportFlags struct {
+	failOn   string
+	json     bool
+	wait     bool
+	timeout  time.Duration
+	interval time.Duration
+}
+
+func (f *reportFlags) register(fs *flag.FlagSet, wait bool) {
+	fs.StringVar(&f.failOn, "fail-on", "high", "lowest severity of a failed test that fails the gate: critical, high, medium, low, info or none")
+	fs.BoolVar(&f.json, "json", false, "print the scan as JSON instead of a summary")
+	fs.BoolVar(&f.wait, "wait", wait, "wait for the scan to finish")
+	fs.DurationVar(&f.timeout, "timeout", 30*time.Minute, "how long to wait for the scan to finish")
+	fs.DurationVar(&f.interval, "interval", 5*time.Second, "how often to check whether the scan finished")
+}
+
+func (f *reportFlags) validate() error {
+	if _, ok := severityRanks[f.failOn]; !ok {
+		return fmt.Errorf("-fail-on must be one of critical, high, medium, low, info or none, got %q", f.failOn)
+	}
+	if f.interval < time.Second {
+		return errors.New("-interval must be at least 1s")
+	}
+	return nil
+}
+
+func runScan(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: antiginx scan [flags] <url>")
+		fs.PrintDefaults()
+	}
+	var req client.ScanRequest
+	var tests, tags string
+	var report reportFlags
+	fs.StringVar(&req.Profile, "profile", "", "tests to run: quick or full (default quick, unless -tests is given)")
+	fs.StringVar(&tests, "tests", "", "comma-separated test IDs or categories to run instead of a profile")
+	fs.StringVar(&tags, "tags", "", "comma-separated tags of the scan")
+	fs.StringVar(&req.Priority, "priority", "", "queue priority: low, normal or high")
+	fs.StringVar(&req.OrganizationID, "org", "", "ID of the organization to share the scan with")
+	fs.BoolVar(&req.Screenshot, "screenshot", false, "take a screenshot of the target")
+	fs.BoolVar(&req.ReuseRecent, "reuse", false, "reuse a recent scan of the target with the same tests instead of scanning again")
+	report.register(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.validate(); err != nil {
+		fmt.Fprintln(stderr, "antiginx:", err)
+		return exitUsage
+	}
+	req.TargetURL = fs.Arg(0)
+	req.Tests = splitList(tests)
+	req.Tags = splitList(tags)
+	if req.Profile == "" && len(req.Tests) == 0 {
+		req.Profile = "quick"
+	}
+
+	api, err := newClientFromEnv()
+	if err != nil {
+		fmt.Fprintln(stderr, "antiginx:", err)
+		return exitUsage
+	}
+	created, err := api.CreateScan(ctx, req)
+	if err != nil {
+		fmt.Fprintln(stderr, "antiginx: submitting the scan:", err)
+		return exitError
+	}
+	fmt.Fprintf(stderr, "Submitted scan %s of %s (%s)\n", created.ID, req.TargetURL, created.Status)
+	if !report.wait {
+		fmt.Fprintln(stdout, created.ID)
+		return exitPassed
+	}
+	return printScan(ctx, api, created.ID, report, stdout, stderr)
+}
+
+func runGet(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: antiginx get [flags] <id>")
+		fs.PrintDefaults()
+	}
+	var report reportFlags
+	report.register(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.validate(); err != nil {
+		fmt.Fprintln(stderr, "antiginx:", err)
+		return exitUsage
+	}
+
+	api, err := newClientFromEnv()
+	if err != nil {
+		fmt.Fprintln(stderr, "antiginx:", err)
+		return exitUsage
+	}
+	return printScan(ctx, api, fs.Arg(0), report, stdout, stderr)
+}
+
+// printScan prints the scan, after waiting for it to finish if asked to,
+// and returns the exit code of its gate.
+func printScan(ctx context.Context, api *client.Client, id string, report reportFlags, stdout, stderr io.Writer) int {
+	var scan *client.Scan
+	var err error
+	if report.wait {
+		waitCtx, cancel := context.WithTimeout(ctx, report.timeout)
+		defer cancel()
+		scan, err = api.WaitForCompletion(waitCtx, id, report.interval, func(status string) {
+			fmt.Fprintf(stderr, "%s  %s\n", time.Now().Format(time.TimeOnly), status)
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(stderr, "antiginx: scan %s didn't finish within %s\n", id, report.timeout)
+			return exitError
+		}
+	} else {
+		scan, err = api.GetScan(ctx, id)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "antiginx: reading the scan:", err)
+		return exitError
+	}
+
+	g := evaluate(scan, report.failOn)
+	if report.json {
+		raw, err := json.MarshalIndent(scan, "", "  ")
+		if err != nil {
+			fmt.Fprintln(stderr, "antiginx:", err)
+			return exitError
+		}
+		fmt.Fprintln(stdout, string(raw))
+	} else {
+		printSummary(stdout, scan, g)
+	}
+	if !g.passed {
+		return exitFailed
+	}
+	return exitPassed
+}
+
+// gate is the verdict on a scan.
+type gate struct {
+	passed bool
+	reason string
+	// failed are the failed, unsuppressed results, most severe first;
+	// counts counts them by severity.
+	failed []client.ScanResult
+	counts map[string]int
+}
+
+// evaluate applies the gate to a scan: it fails when the scan didn't
+// complete, or a test failed with failOn severity or worse. Suppressed
+// findings don't count, and "none" only fails scans that didn't complete.
+func evaluate(scan *client.Scan, failOn string) gate {
+	g := gate{counts: map[string]int{}}
+	blocking := 0
+	for _, r := range scan.Results {
+		if r.Passed || r.TriageStatus == "suppressed" {
+			continue
+		}
+		severity := strings.ToLower(r.Severity)
+		g.failed = append(g.failed, r)
+		g.counts[severity]++
+		if failOn != "none" && severityRanks[severity] >= severityRanks[failOn] {
+			blocking++
+		}
+	}
+
+	switch {
+	case !client.Finished(scan.Status):
+		g.reason = "the scan is still " + scan.Status
+	case scan.Status != client.StatusCompleted:
+		g.reason = "the scan is " + scan.Status
+	case blocking > 0:
+		g.reason = fmt.Sprintf("%d failed %s of %s severity or worse", blocking, plural(blocking, "test"), failOn)
+	default:
+		g.passed = true
+	}
+	return g
+}
+
+func printSummary(w io.Writer, scan *client.Scan, g gate) {
+	fmt.Fprintf(w, "Scan %s of %s: %s\n", scan.ID, scan.TargetURL, scan.Status)
+	if scan.Grade != "" && scan.Score != nil {
+		fmt.Fprintf(w, "Grade %s (score %.1f)\n", scan.Grade, *scan.Score)
+	}
+	var counts []string
+	for _, s := range severities {
+		counts = append(counts, fmt.Sprintf("%d %s", g.counts[s], s))
+	}
+	fmt.Fprintf(w, "Failed tests: %d (%s)\n", len(g.failed), strings.Join(counts, ", "))
+
+	if len(g.failed) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, r := range g.failed {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", strings.ToUpper(r.Severity), r.TestName, oneLine(r.Message))
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+
+	if g.passed {
+		fmt.Fprintln(w, "Gate: passed")
+	} else {
+		fmt.Fprintln(w, "Gate: failed,", g.reason)
+	}
+}
+
+func newClientFromEnv() (*client.Client, error) {
+	apiKey := os.Getenv("ANTIGINX_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("ANTIGINX_API_KEY is not set")
+	}
+	baseURL := os.Getenv("ANTIGINX_URL")
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	return client.New(client.Config{BaseURL: baseURL, APIKey: apiKey, UserAgent: "antiginx-cli/" + version}), nil
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// oneLine puts text on one line of at most 120 runes.
+func oneLine(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > 120 {
+		text = string(runes[:119]) + "…"
+	}
+	return text
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
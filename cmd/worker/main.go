@@ -0,0 +1,166 @@
+// Command worker consumes the scan tasks the API publishes to scan_queue
+// and submits their results to the API or to results_queue, authorized
+// with each task's upload token.
+//
+// Tests are run by the passive checks of package scanner: security
+// headers, cookie flags, the TLS protocols, cipher suites and certificate,
+// redirects to HTTPS and mixed content. Tests without a built-in check are
+// reported as inconclusive. With WORKER_ENGINE=mock, tasks are answered
+// with the fabricated results of package mockworker instead.
+//
+// # Environment Variables
+//
+//   - RABBITMQ_URL: RabbitMQ connection string (required)
+//   - WORKER_API_URL: base URL of the API (default http://localhost:4000)
+//   - WORKER_SIGNING_SECRET: the API's WORKER_SIGNING_SECRET, if it is set
+//   - WORKER_CONCURRENCY: number of tasks run at once (default 4)
+//   - WORKER_RESULTS_VIA_QUEUE: publish results to results_queue instead
+//     of POSTing them to /api/results (default false)
+//   - WORKER_ENGINE: "checks" (default) or "mock"
+//   - WORKER_CHECK_TIMEOUT: timeout of each check's requests (default 15s)
+//   - WORKER_ALLOW_PRIVATE_NETWORKS: also scan targets resolving to
+//     private addresses, e.g. on a development machine (default false)
+//   - WORKER_RESULT_DELAY: pause before each mock result (default 500ms)
+//
+// The API declares scan_queue; until it has, the worker keeps retrying.
+//
+// # Example
+//
+//	RABBITMQ_URL="amqp://..." go run ./cmd/worker
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/prawo-i-piesc/backend/internal/handlers"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/mockworker"
+	"github.com/prawo-i-piesc/backend/internal/queue"
+	"github.com/prawo-i-piesc/backend/internal/scanner"
+)
+
+const (
+	// defaultConcurrency is how many tasks are run at once by default.
+	defaultConcurrency = 4
+	// defaultCheckTimeout bounds the requests of each check by default.
+	defaultCheckTimeout = 15 * time.Second
+)
+
+func main() {
+	envErr := godotenv.Load()
+	logging.Setup()
+	if envErr != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	rabbitURL := os.Getenv("RABBITMQ_URL")
+	if rabbitURL == "" {
+		fatal("RABBITMQ_URL is required")
+	}
+	concurrency := defaultConcurrency
+	if raw := os.Getenv("WORKER_CONCURRENCY"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			fatal("WORKER_CONCURRENCY must be a positive number", "value", raw)
+		}
+		concurrency = n
+	}
+	// The worker declares nothing: the API owns the topology, and the
+	// consumer is restarted until scan_queue exists.
+	conn, err := queue.NewPublisher(rabbitURL, nil)
+	if err != nil {
+		fatal("Failed to connect to RabbitMQ", "error", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			slog.Error("Failed to close the RabbitMQ connection", "error", err)
+		}
+	}()
+
+	workerCfg := scanner.WorkerConfig{
+		APIURL:        "http://localhost:4000",
+		SigningSecret: os.Getenv("WORKER_SIGNING_SECRET"),
+	}
+	if raw := os.Getenv("WORKER_API_URL"); raw != "" {
+		workerCfg.APIURL = strings.TrimRight(raw, "/")
+	}
+	if raw := os.Getenv("WORKER_RESULTS_VIA_QUEUE"); raw != "" {
+		viaQueue, err := strconv.ParseBool(raw)
+		if err != nil {
+			fatal("WORKER_RESULTS_VIA_QUEUE must be true or false", "value", raw)
+		}
+		if viaQueue {
+			workerCfg.Results = conn
+		}
+	}
+
+	var worker *scanner.Worker
+	switch engine := os.Getenv("WORKER_ENGINE"); engine {
+	case "", "checks":
+		timeout := defaultCheckTimeout
+		if raw := os.Getenv("WORKER_CHECK_TIMEOUT"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				fatal("WORKER_CHECK_TIMEOUT must be a positive duration such as 15s", "value", raw)
+			}
+			timeout = d
+		}
+		allowPrivate := false
+		if raw := os.Getenv("WORKER_ALLOW_PRIVATE_NETWORKS"); raw != "" {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				fatal("WORKER_ALLOW_PRIVATE_NETWORKS must be true or false", "value", raw)
+			}
+			allowPrivate = b
+		}
+		checks := scanner.NewCheckEngine(scanner.NewClient(timeout, allowPrivate))
+		workerCfg.Evidence = checks.Evidence
+		worker = scanner.NewWorker(workerCfg, checks.Run)
+		slog.Info("Running scans with the built-in checks", "checks", scanner.IDs(), "api_url", workerCfg.APIURL, "concurrency", concurrency)
+	case "mock":
+		mockCfg := mockworker.Config{
+			APIURL:        workerCfg.APIURL,
+			Delay:         500 * time.Millisecond,
+			SigningSecret: workerCfg.SigningSecret,
+			Results:       workerCfg.Results,
+		}
+		if raw := os.Getenv("WORKER_RESULT_DELAY"); raw != "" {
+			delay, err := time.ParseDuration(raw)
+			if err != nil || delay < 0 {
+				fatal("WORKER_RESULT_DELAY must be a duration such as 500ms", "value", raw)
+			}
+			mockCfg.Delay = delay
+		}
+		worker = mockworker.New(mockCfg)
+		slog.Warn("Scans are answered with fabricated results", "api_url", workerCfg.APIURL, "concurrency", concurrency)
+	default:
+		fatal("WORKER_ENGINE must be checks or mock", "value", engine)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn.Consume(ctx, queue.ConsumerConfig{
+		Queue:    handlers.ScanQueue,
+		Tag:      "worker",
+		Prefetch: concurrency,
+		Workers:  concurrency,
+		// Tasks still running after the drain timeout are requeued and
+		// run again by another worker.
+		DrainTimeout: time.Minute,
+	}, worker.Handle)
+	slog.Info("Worker stopped")
+}
+
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/middleware"
+)
+
+// corsHandler returns the middleware enforcing a CORS policy. A policy
+// without origins allows any origin, but never with credentials, so that
+// no site can make requests on behalf of a signed-in user.
+func corsHandler(policy config.CORSPolicy) gin.HandlerFunc {
+	corsConfig := cors.Config{
+		AllowOrigins:     policy.Origins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", middleware.RequestIDHeader},
+		AllowCredentials: policy.Credentials,
+		MaxAge:           12 * time.Hour,
+	}
+	if len(policy.Origins) == 0 {
+		corsConfig.AllowAllOrigins = true
+		corsConfig.AllowCredentials = false
+	}
+	return cors.New(corsConfig)
+}
+
+// allowPreflight answers preflight requests to the paths of the routes
+// registered on r since before with handler, the CORS middleware of their
+// group. Preflight requests match no route of their own and carry no
+// credentials, so they can't go through the group's middleware.
+func allowPreflight(r *gin.Engine, before gin.RoutesInfo, handler gin.HandlerFunc) {
+	seen := map[string]bool{}
+	for _, route := range before {
+		seen[route.Path] = true
+	}
+	for _, route := range r.Routes() {
+		if !seen[route.Path] {
+			seen[route.Path] = true
+			r.OPTIONS(route.Path, handler)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/handlers"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/openapi"
+	"github.com/prawo-i-piesc/backend/internal/orgstorage"
+	"github.com/prawo-i-piesc/backend/internal/validation"
+)
+
+// swaggerUI is the page served at /docs. It loads Swagger UI from a CDN
+// and points it at /api/openapi.json.
+//
+//go:embed swagger.html
+var swaggerUI []byte
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Fields is only set for request bodies that failed validation.
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+// routeDoc describes the bodies of a route. Routes without one are still
+// documented, with their path parameters and authentication only.
+type routeDoc struct {
+	// summary overrides the one derived from the handler's name.
+	summary  string
+	request  interface{}
+	response interface{}
+	// status is the status of a successful response; 200 if unset.
+	status int
+	// contentType is the type of a successful response that isn't JSON.
+	contentType string
+}
+
+// routeDocs are the documented bodies of the routes, keyed like
+// apiKeyScopes. Responses built as gin.H are documented as plain objects.
+var routeDocs = map[string]routeDoc{
+	"POST /api/freescans":                                               {summary: "Submit a free scan", request: handlers.CreateScanRequest{}, status: http.StatusAccepted},
+	"GET /api/freescans/:id":                                            {response: models.Scan{}},
+	"GET /api/openapi.json":                                             {summary: "Get this OpenAPI document"},
+	"GET /api/health":                                                   {summary: "Health check"},
+	"GET /api/remediation":                                              {response: map[string]models.RemediationContent{}},
+	"GET /api/files/*key":                                               {summary: "Download a signed file", contentType: "application/octet-stream"},
+	"POST /api/auth/register":                                           {request: handlers.RegisterRequest{}},
+	"POST /api/auth/login":                                              {request: handlers.LoginRequest{}},
+	"POST /api/auth/login/confirm":                                      {request: handlers.ConfirmLoginRequest{}},
+	"POST /api/auth/forgot-password":                                    {request: handlers.ForgotPasswordRequest{}},
+	"POST /api/auth/reset-password":                                     {request: handlers.ResetPasswordRequest{}},
+	"POST /api/results":                                                 {request: handlers.AsyncResultRequest{}, status: http.StatusAccepted},
+	"POST /api/artifacts":                                               {response: models.Artifact{}, status: http.StatusCreated},
+	"GET /api/auth/me":                                                  {summary: "Get the current user"},
+	"GET /api/me/sessions":                                              {response: []handlers.SessionResponse{}},
+	"DELETE /api/me/sessions/:id":                                       {status: http.StatusNoContent},
+	"GET /api/me/quota":                                                 {response: handlers.QuotaResponse{}},
+	"POST /api/me/slack/link-code":                                      {summary: "Create a Slack link code", response: handlers.SlackLinkCodeResponse{}, status: http.StatusCreated},
+	"POST /api/me/push-devices":                                         {summary: "Register a device for push notifications", request: handlers.RegisterPushDeviceRequest{}, response: models.PushDevice{}, status: http.StatusCreated},
+	"GET /api/me/push-devices":                                          {response: []models.PushDevice{}},
+	"PATCH /api/me/push-devices/:id":                                    {request: handlers.UpdatePushDeviceRequest{}, response: models.PushDevice{}},
+	"DELETE /api/me/push-devices/:id":                                   {summary: "Unregister a push device"},
+	"POST /slack/commands":                                              {summary: "Run a Slack slash command"},
+	"POST /slack/interactions":                                          {summary: "Handle a click on a Slack message button"},
+	"POST /api/scans":                                                   {summary: "Submit a scan", request: handlers.PremiumScanRequest{}, status: http.StatusAccepted},
+	"POST /api/scans/batch":                                             {request: handlers.BatchScanRequest{}, response: handlers.BatchScanResponse{}, status: http.StatusAccepted},
+	"GET /api/scans/batch/:id":                                          {response: handlers.BatchScanResponse{}},
+	"GET /api/scans":                                                    {response: handlers.ScanListResponse{}},
+	"POST /api/graphql":                                                 {summary: "Run a GraphQL query", request: map[string]interface{}{}, response: map[string]interface{}{}},
+	"GET /api/scans/compare":                                            {response: handlers.ScanComparisonResponse{}},
+	"GET /api/scans/search":                                             {response: handlers.ScanListResponse{}},
+	"GET /api/scans/:id":                                                {response: handlers.ScanDetailResponse{}},
+	"GET /api/scans/:id/results":                                        {response: handlers.ScanResultListResponse{}},
+	"DELETE /api/scans/:id":                                             {status: http.StatusNoContent},
+	"PATCH /api/scans/:id/tags":                                         {request: handlers.UpdateScanTagsRequest{}},
+	"GET /api/scans/:id/events":                                         {contentType: "text/event-stream"},
+	"POST /api/scans/:id/approve":                                       {request: handlers.ApprovalDecisionRequest{}},
+	"POST /api/scans/:id/reject":                                        {request: handlers.ApprovalDecisionRequest{}},
+	"GET /api/scans/:id/artifacts":                                      {response: []handlers.ArtifactResponse{}},
+	"GET /api/scans/:id/har":                                            {summary: "Get the HAR archive of a scan"},
+	"GET /api/scans/:id/har/entries":                                    {summary: "List the HAR entries of a scan"},
+	"GET /api/scans/:id/har/entries/:index":                             {summary: "Get a HAR entry of a scan"},
+	"POST /api/scans/:id/evaluations":                                   {response: models.ScanEvaluation{}, status: http.StatusCreated},
+	"GET /api/scans/:id/evaluations":                                    {response: []models.ScanEvaluation{}},
+	"GET /api/scans/:id/evaluations/:number":                            {response: models.ScanEvaluation{}},
+	"GET /api/scans/:id/report.pdf":                                     {summary: "Get the PDF report of a scan", contentType: "application/pdf"},
+	"GET /api/scans/:id/results.csv":                                    {summary: "Export the results of a scan as CSV", contentType: "text/csv"},
+	"POST /api/scans/:id/exports":                                       {request: handlers.ResultsCSVJobRequest{}, status: http.StatusAccepted},
+	"GET /api/scans/:id/timeline":                                       {response: handlers.ScanTimelineResponse{}},
+	"GET /api/scans/:id/benchmark":                                      {response: handlers.ScanBenchmarkResponse{}},
+	"GET /api/users/scans":                                              {response: []models.PremiumScan{}},
+	"GET /api/users/activity":                                           {response: handlers.ActivityResponse{}},
+	"GET /api/organizations/:id/activity":                               {response: handlers.ActivityResponse{}},
+	"GET /api/organizations/:id/metrics":                                {summary: "Get the posture metrics of an organization in the OpenMetrics format", contentType: "application/openmetrics-text"},
+	"GET /api/users/metrics":                                            {summary: "Get posture metrics in the OpenMetrics format", contentType: "application/openmetrics-text"},
+	"GET /api/utils/tests":                                              {summary: "List the available tests", response: []handlers.TestCategoryGroup{}},
+	"PATCH /api/utils/profile/name":                                     {request: handlers.UpdateNameRequest{}},
+	"PATCH /api/utils/profile/email":                                    {request: handlers.UpdateEmailRequest{}},
+	"PATCH /api/utils/profile/password":                                 {request: handlers.UpdatePasswordRequest{}},
+	"PUT /api/scoring/policy":                                           {request: handlers.ScoringPolicyRequest{}, response: models.ScoringPolicy{}},
+	"GET /api/findings":                                                 {response: handlers.FindingListResponse{}},
+	"GET /api/triggers/me":                                              {summary: "Get the account of a trigger connection", response: handlers.TriggerAccount{}},
+	"GET /api/triggers/scan-events":                                     {summary: "Poll for scan status changes", response: []handlers.TriggerScanEvent{}},
+	"GET /api/triggers/findings":                                        {summary: "Poll for findings of completed scans", response: []handlers.TriggerFinding{}},
+	"POST /api/findings/bulk":                                           {summary: "Update findings in bulk", request: handlers.BulkFindingsRequest{}},
+	"PUT /api/sla-policies":                                             {request: handlers.UpdateSLAPoliciesRequest{}},
+	"PUT /api/classifications":                                          {request: handlers.UpdateClassificationsRequest{}},
+	"PUT /api/organizations/:id/sla-policies":                           {request: handlers.UpdateSLAPoliciesRequest{}},
+	"PUT /api/organizations/:id/classifications":                        {request: handlers.UpdateClassificationsRequest{}},
+	"GET /api/reports/matrix":                                           {response: handlers.MatrixResponse{}},
+	"POST /api/reports/executive-summary":                               {request: handlers.ExecutiveSummaryRequest{}, response: models.ReportJob{}, status: http.StatusAccepted},
+	"POST /api/jobs/:id/retry":                                          {status: http.StatusAccepted},
+	"GET /api/views":                                                    {response: []models.SavedView{}},
+	"POST /api/views":                                                   {request: handlers.SavedViewRequest{}, response: models.SavedView{}, status: http.StatusCreated},
+	"PUT /api/views/:id":                                                {request: handlers.SavedViewRequest{}, response: models.SavedView{}},
+	"DELETE /api/views/:id":                                             {status: http.StatusNoContent},
+	"POST /api/views/:id/default":                                       {response: models.SavedView{}},
+	"GET /api/targets":                                                  {response: []handlers.TargetResponse{}},
+	"POST /api/targets":                                                 {request: handlers.TargetRequest{}, response: handlers.TargetResponse{}, status: http.StatusCreated},
+	"GET /api/targets/history":                                          {response: handlers.TargetHistoryResponse{}},
+	"GET /api/targets/:id":                                              {response: handlers.TargetResponse{}},
+	"POST /api/targets/:id/verify":                                      {response: handlers.TargetResponse{}},
+	"DELETE /api/targets/:id":                                           {status: http.StatusNoContent},
+	"GET /api/organizations":                                            {response: []handlers.OrganizationResponse{}},
+	"POST /api/organizations":                                           {request: handlers.CreateOrganizationRequest{}, response: handlers.OrganizationResponse{}, status: http.StatusCreated},
+	"POST /api/organizations/invitations/accept":                        {request: handlers.AcceptInvitationRequest{}, response: models.Membership{}},
+	"GET /api/organizations/:id/members":                                {response: []handlers.OrganizationMember{}},
+	"GET /api/organizations/:id/usage":                                  {summary: "Get the storage usage of an organization", response: orgstorage.Status{}},
+	"PUT /api/organizations/:id/scoring/policy":                         {summary: "Set the scoring policy of an organization", request: handlers.ScoringPolicyRequest{}, response: models.ScoringPolicy{}},
+	"POST /api/organizations/:id/invitations":                           {request: handlers.InviteMemberRequest{}, response: models.OrganizationInvitation{}, status: http.StatusCreated},
+	"GET /api/organizations/:id/integrations":                           {response: []models.VCSIntegration{}},
+	"PUT /api/organizations/:id/integrations/:provider":                 {request: handlers.VCSIntegrationRequest{}, response: models.VCSIntegration{}},
+	"DELETE /api/organizations/:id/integrations/:provider":              {status: http.StatusNoContent},
+	"GET /api/api-keys":                                                 {response: []models.APIKey{}},
+	"POST /api/api-keys":                                                {request: handlers.CreateUserAPIKeyRequest{}, status: http.StatusCreated},
+	"POST /api/webhooks":                                                {request: handlers.CreateWebhookRequest{}, status: http.StatusCreated},
+	"GET /api/webhooks":                                                 {response: []models.Webhook{}},
+	"GET /api/webhooks/:id":                                             {response: models.Webhook{}},
+	"PATCH /api/webhooks/:id":                                           {request: handlers.UpdateWebhookRequest{}, response: models.Webhook{}},
+	"POST /api/webhooks/:id/rotate-secret":                              {request: handlers.RotateWebhookSecretRequest{}},
+	"GET /api/webhooks/:id/deliveries":                                  {response: []models.WebhookDelivery{}},
+	"POST /api/webhooks/:id/deliveries/:deliveryId/redeliver":           {response: models.WebhookDelivery{}},
+	"GET /api/admin/health":                                             {summary: "Admin health check"},
+	"GET /api/admin/users":                                              {response: handlers.UserListResponse{}},
+	"PATCH /api/admin/users/:id/role":                                   {request: handlers.UpdateUserRoleRequest{}, response: models.User{}},
+	"POST /api/admin/users/:id/disable":                                 {response: models.User{}},
+	"POST /api/admin/users/:id/enable":                                  {response: models.User{}},
+	"PATCH /api/admin/organizations/:id":                                {request: handlers.SetOrganizationPlanRequest{}, response: models.Organization{}},
+	"GET /api/admin/audit-log":                                          {response: []models.AuditLogEntry{}},
+	"GET /api/admin/metrics":                                            {summary: "Get the runtime metrics"},
+	"GET /api/admin/metrics/scans":                                      {summary: "Get scan metrics by environment and team in the OpenMetrics format", contentType: "application/openmetrics-text"},
+	"GET /api/admin/scans":                                              {response: handlers.ScanListResponse{}},
+	"GET /api/admin/scans/:id":                                          {response: models.PremiumScan{}},
+	"POST /api/admin/scans/:id/status":                                  {request: handlers.SetScanStatusRequest{}},
+	"POST /api/admin/scans/:id/requeue":                                 {status: http.StatusAccepted},
+	"DELETE /api/admin/scans/:id":                                       {status: http.StatusNoContent},
+	"GET /api/admin/scans/:id/timeline":                                 {response: handlers.ScanTimelineResponse{}},
+	"GET /api/admin/dead-letters":                                       {response: []handlers.DeadLetterTask{}},
+	"POST /api/admin/dead-letters/:messageId/requeue":                   {status: http.StatusAccepted},
+	"GET /api/admin/production-targets":                                 {response: []models.ProductionTarget{}},
+	"POST /api/admin/production-targets":                                {request: handlers.ProductionTargetRequest{}, response: models.ProductionTarget{}, status: http.StatusCreated},
+	"DELETE /api/admin/production-targets/:id":                          {status: http.StatusNoContent},
+	"PUT /api/admin/scoring/policy":                                     {request: handlers.ScoringPolicyRequest{}, response: models.ScoringPolicy{}},
+	"POST /api/admin/scoring/recalculations":                            {request: handlers.RecalculationRequest{}, response: models.RecalculationJob{}, status: http.StatusAccepted},
+	"GET /api/admin/remediation":                                        {response: map[string]models.RemediationContent{}},
+	"POST /api/admin/remediation":                                       {request: handlers.RemediationContentRequest{}, response: models.RemediationContent{}, status: http.StatusCreated},
+	"GET /api/admin/remediation/:test/:lang/versions":                   {response: []models.RemediationContent{}},
+	"POST /api/admin/remediation/:test/:lang/versions/:version/restore": {response: models.RemediationContent{}, status: http.StatusCreated},
+	"POST /api/admin/api-keys":                                          {request: handlers.CreateAPIKeyRequest{}, status: http.StatusCreated},
+	"GET /api/admin/api-keys":                                           {response: []models.APIKey{}},
+	"PATCH /api/admin/api-keys/:id":                                     {request: handlers.UpdateAPIKeyRequest{}, response: models.APIKey{}},
+	"GET /api/organizations/:id/api-usage":                              {summary: "Get the API usage of an organization's members", response: handlers.APIUsageResponse{}},
+	"GET /api/admin/api-usage":                                          {response: handlers.APIUsageResponse{}},
+	"PUT /api/organizations/:id/email-templates/:name":                  {summary: "Override an email template for an organization", request: handlers.EmailTemplateRequest{}, response: models.OrganizationEmailTemplate{}},
+	"PUT /api/admin/email-templates/:name":                              {request: handlers.EmailTemplateRequest{}, response: models.EmailTemplate{}},
+	"POST /api/admin/email-templates/:name/preview":                     {request: handlers.EmailPreviewRequest{}},
+}
+
+// routeGroup is how the routes of a group authenticate.
+type routeGroup int
+
+const (
+	groupPublic routeGroup = iota
+	groupWorker
+	groupUser
+	groupAdmin
+)
+
+// apiDocs builds the OpenAPI document of the routes as the groups are
+// registered and serves it once all are.
+type apiDocs struct {
+	groups map[string]routeGroup
+	spec   []byte
+}
+
+func newAPIDocs() *apiDocs {
+	return &apiDocs{groups: map[string]routeGroup{}}
+}
+
+// group records the routes registered since before as routes of g.
+func (d *apiDocs) group(r *gin.Engine, before gin.RoutesInfo, g routeGroup) {
+	seen := map[string]bool{}
+	for _, route := range before {
+		seen[route.Method+" "+route.Path] = true
+	}
+	for _, route := range r.Routes() {
+		if key := route.Method + " " + route.Path; !seen[key] {
+			d.groups[key] = g
+		}
+	}
+}
+
+// build renders the document of the recorded routes.
+func (d *apiDocs) build(routes gin.RoutesInfo) error {
+	spec, err := json.Marshal(d.document(routes))
+	d.spec = spec
+	return err
+}
+
+func (d *apiDocs) handleSpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", d.spec)
+}
+
+func handleSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUI)
+}
+
+func (d *apiDocs) document(routes gin.RoutesInfo) *openapi.Document {
+	gen := openapi.NewGenerator()
+	gen.Define(models.ScanTag{}, &openapi.Schema{Type: "string"})
+	errorSchema := gen.Schema(ErrorResponse{})
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "AntiGinx API",
+			Description: "Security scans of websites. Errors answer with an `error` message; invalid request bodies also list the offending `fields`.",
+			Version:     "1.0",
+		},
+		Paths: map[string]*openapi.PathItem{},
+		Components: openapi.Components{SecuritySchemes: map[string]*openapi.SecurityScheme{
+			"bearerAuth":  {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Session token from POST /api/auth/login."},
+			"apiKey":      {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key (agx_...), also accepted as a bearer token. Only routes with a scope in the API key documentation accept one; worker routes need results:write."},
+			"uploadToken": {Type: "apiKey", In: "header", Name: "X-Upload-Token", Description: "Upload token of the scan a worker runs, also accepted as a bearer token."},
+		}},
+	}
+
+	operationIDs := map[string]int{}
+	tags := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		g, ok := d.groups[key]
+		if !ok || route.Method == http.MethodOptions {
+			continue
+		}
+		rd := routeDocs[key]
+		name := handlerName(route.Handler)
+
+		op := &openapi.Operation{
+			Tags:      []string{routeTag(route.Path)},
+			Summary:   rd.summary,
+			Responses: map[string]*openapi.Response{},
+			Security:  security(g, key),
+		}
+		if op.Summary == "" {
+			op.Summary = summary(name)
+		}
+		if name != "" {
+			id := strings.TrimPrefix(name, "Handle")
+			id = strings.ToLower(id[:1]) + id[1:]
+			if operationIDs[id]++; operationIDs[id] > 1 {
+				id += strconv.Itoa(operationIDs[id])
+			}
+			op.OperationID = id
+		}
+		tags[op.Tags[0]] = true
+
+		path, params := pathParameters(route.Path)
+		op.Parameters = params
+		if rd.request != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(gen.Schema(rd.request))}
+		}
+
+		status := rd.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &openapi.Response{Description: http.StatusText(status)}
+		switch {
+		case status == http.StatusNoContent:
+		case rd.contentType != "":
+			success.Content = map[string]openapi.MediaType{rd.contentType: {}}
+		case rd.response != nil:
+			success.Content = openapi.JSON(gen.Schema(rd.response))
+		default:
+			success.Content = openapi.JSON(&openapi.Schema{Type: "object"})
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		op.Responses["default"] = &openapi.Response{Description: "Error", Content: openapi.JSON(errorSchema)}
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &openapi.PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(route.Method)] = op
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	doc.Components.Schemas = gen.Schemas()
+	return doc
+}
+
+// security lists how a route of group g authenticates.
+func security(g routeGroup, route string) []openapi.SecurityRequirement {
+	switch g {
+	case groupWorker:
+		return []openapi.SecurityRequirement{{"uploadToken": {}}, {"apiKey": {}}}
+	case groupUser:
+		if _, ok := apiKeyScopes[route]; !ok {
+			return []openapi.SecurityRequirement{{"bearerAuth": {}}}
+		}
+		return []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKey": {}}}
+	case groupAdmin:
+		return []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKey": {}}}
+	}
+	return nil
+}
+
+// pathParameters converts a gin path to an OpenAPI one ("/scans/:id" ->
+// "/scans/{id}") and returns its parameters.
+func pathParameters(path string) (string, []openapi.Parameter) {
+	var params []openapi.Parameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		name := segment[1:]
+		schema := &openapi.Schema{Type: "string"}
+		if name == "index" {
+			schema.Type = "integer"
+		}
+		params = append(params, openapi.Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// routeTag groups a route by its first segment after /api, or /api/admin
+// for admin routes. Routes outside /api are grouped by their first
+// segment.
+func routeTag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "/api"), "/"), "/")
+	if segments[0] == "admin" {
+		return "admin"
+	}
+	return segments[0]
+}
+
+// handlerName returns the method name of a handler as gin reports it
+// ("github.com/.../handlers.(*ScanHandler).HandleListScans-fm" ->
+// "HandleListScans"); closures have none.
+func handlerName(handler string) string {
+	name := strings.TrimSuffix(handler[strings.LastIndex(handler, ".")+1:], "-fm")
+	if name == "" || !unicode.IsUpper(rune(name[0])) {
+		return ""
+	}
+	return name
+}
+
+// summary turns a handler name into a sentence ("HandleGetHAREntry" ->
+// "Get HAR entry").
+func summary(name string) string {
+	name = strings.TrimPrefix(name, "Handle")
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i := 1; i < len(runes); i++ {
+		upper := unicode.IsUpper(runes[i])
+		if upper && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+	for i, word := range words {
+		if i > 0 && strings.ToUpper(word) != word {
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
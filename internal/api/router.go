@@ -5,47 +5,145 @@
 package api
 
 import (
-	"time"
+	"expvar"
+	"log/slog"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/apikeys"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/graph"
 	"github.com/prawo-i-piesc/backend/internal/handlers"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/ratelimit"
+	"github.com/prawo-i-piesc/backend/internal/scanmetrics"
+	"github.com/prawo-i-piesc/backend/internal/usage"
 	"github.com/prawo-i-piesc/backend/middleware"
 )
 
+// apiKeyScopes lists the user routes that can be called with an API key and
+// the scope each requires. Other user routes only accept a session token.
+var apiKeyScopes = map[string]string{
+	"POST /api/scans":                            apikeys.ScopeScansWrite,
+	"POST /api/scans/batch":                      apikeys.ScopeScansWrite,
+	"POST /api/scans/:id/cancel":                 apikeys.ScopeScansWrite,
+	"DELETE /api/scans/:id":                      apikeys.ScopeScansWrite,
+	"PATCH /api/scans/:id/tags":                  apikeys.ScopeScansWrite,
+	"GET /api/scans":                             apikeys.ScopeScansRead,
+	"GET /api/scans/:id":                         apikeys.ScopeScansRead,
+	"GET /api/scans/compare":                     apikeys.ScopeScansRead,
+	"GET /api/scans/search":                      apikeys.ScopeScansRead,
+	"GET /api/scans/batch/:id":                   apikeys.ScopeScansRead,
+	"GET /api/scans/:id/events":                  apikeys.ScopeScansRead,
+	"GET /api/scans/:id/artifacts":               apikeys.ScopeScansRead,
+	"GET /api/scans/:id/har":                     apikeys.ScopeScansRead,
+	"GET /api/scans/:id/har/entries":             apikeys.ScopeScansRead,
+	"GET /api/scans/:id/har/entries/:index":      apikeys.ScopeScansRead,
+	"GET /api/scans/:id/raw-headers":             apikeys.ScopeScansRead,
+	"POST /api/scans/:id/evaluations":            apikeys.ScopeScansWrite,
+	"GET /api/scans/:id/evaluations":             apikeys.ScopeScansRead,
+	"GET /api/scans/:id/evaluations/:number":     apikeys.ScopeScansRead,
+	"GET /api/scans/:id/report.pdf":              apikeys.ScopeScansRead,
+	"GET /api/scans/:id/results.csv":             apikeys.ScopeScansRead,
+	"GET /api/scans/:id/timeline":                apikeys.ScopeScansRead,
+	"GET /api/scans/:id/benchmark":               apikeys.ScopeScansRead,
+	"GET /api/reports/jobs/:id":                  apikeys.ScopeScansRead,
+	"POST /api/scans/:id/exports":                apikeys.ScopeScansWrite,
+	"GET /api/jobs/:id":                          apikeys.ScopeScansRead,
+	"POST /api/jobs/:id/retry":                   apikeys.ScopeScansWrite,
+	"GET /api/users/scans":                       apikeys.ScopeScansRead,
+	"GET /api/users/activity":                    apikeys.ScopeScansRead,
+	"GET /api/users/metrics":                     apikeys.ScopeScansRead,
+	"GET /api/findings":                          apikeys.ScopeScansRead,
+	"GET /api/targets":                           apikeys.ScopeScansRead,
+	"GET /api/targets/:id":                       apikeys.ScopeScansRead,
+	"GET /api/targets/history":                   apikeys.ScopeScansRead,
+	"GET /api/organizations":                     apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/members":         apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/usage":           apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/scoring/policy":  apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/classifications": apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/api-usage":       apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/metrics":         apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/activity":        apikeys.ScopeScansRead,
+	"GET /api/organizations/:id/sla-policies":    apikeys.ScopeScansRead,
+	"GET /api/me/quota":                          apikeys.ScopeScansRead,
+	"GET /api/triggers/me":                       apikeys.ScopeTriggersRead,
+	"GET /api/triggers/scan-events":              apikeys.ScopeTriggersRead,
+	"GET /api/triggers/findings":                 apikeys.ScopeTriggersRead,
+	"GET /api/utils/tests":                       apikeys.ScopeScansRead,
+	"POST /api/graphql":                          apikeys.ScopeScansRead,
+	"POST /api/scans/:id/approve":                apikeys.ScopeAdmin,
+	"POST /api/scans/:id/reject":                 apikeys.ScopeAdmin,
+}
+
+// RouterDeps holds the handlers and services the routes are served by.
+type RouterDeps struct {
+	ScanHandler          *handlers.ScanHandler
+	AuthHandler          *handlers.AuthHandler
+	AdminHandler         *handlers.AdminHandler
+	ScoringHandler       *handlers.ScoringHandler
+	RemediationHandler   *handlers.RemediationHandler
+	EmailTemplateHandler *handlers.EmailTemplateHandler
+	WebhookHandler       *handlers.WebhookHandler
+	FileHandler          *handlers.FileHandler
+	ArtifactHandler      *handlers.ArtifactHandler
+	EvaluationHandler    *handlers.ScanEvaluationHandler
+	APIKeyHandler        *handlers.APIKeyHandler
+	SavedViewHandler     *handlers.SavedViewHandler
+	FindingHandler       *handlers.FindingHandler
+	ReportHandler        *handlers.ReportHandler
+	TargetHandler        *handlers.TargetHandler
+	OrganizationHandler  *handlers.OrganizationHandler
+	TriggerHandler       *handlers.TriggerHandler
+	PushDeviceHandler    *handlers.PushDeviceHandler
+	GraphHandler         *graph.Handler
+	// ScanMetrics serves GET /api/admin/metrics/scans.
+	ScanMetrics *scanmetrics.Collector
+	// UsageTracker records and limits the requests made with API keys.
+	UsageTracker *usage.Tracker
+}
+
 // NewRouter creates and configures a new Gin router with all API endpoints.
 //
 // The router exposes the following public endpoints under /api prefix:
 //
 //   - POST /api/scans    - Submit a new security scan request
-//   - POST /api/results  - Submit scan results from a worker
+//   - POST /api/results  - Submit scan results from a worker (upload token or API key required)
+//   - POST /api/scans/:id/start, /heartbeat - Worker start and liveness reports (same authentication)
 //   - GET  /api/scans/:id - Retrieve scan details and results by ID
 //
 // Parameters:
-//   - scanHandler: Handler instance containing business logic for scan operations
+//   - deps: Handlers and services serving the routes; every field is required
+//   - cfg: Server configuration (CORS policies of the route groups, worker and session secrets)
 //
 // Returns:
 //   - *gin.Engine: Configured Gin router ready to serve HTTP requests
 //
 // Example:
 //
-//	handler := handlers.NewScanHandler(amqpChannel, db)
-//	router := api.NewRouter(handler)
-//	router.Run(":8080")
-func NewRouter(scanHandler *handlers.ScanHandler, authHandler *handlers.AuthHandler, adminHandler *handlers.AdminHandler) *gin.Engine {
-	r := gin.Default()
-
-	// TODO : Ograniczyć domeny w produkcji
-	r.Use(cors.New(cors.Config{
-		AllowOriginFunc: func(origin string) bool {
-			return true
-		},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+//	router := api.NewRouter(api.RouterDeps{
+//		ScanHandler: scanHandler,
+//		AuthHandler: authHandler,
+//		// ... the other handlers
+//	}, cfg)
+//	router.Run(cfg.Addr())
+func NewRouter(deps RouterDeps, cfg *config.Config) *gin.Engine {
+	r := gin.New()
+	// ClientIP, which rate limits, sessions and logs rely on, only honours
+	// X-Forwarded-For from the configured proxies.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies, trusting none", "error", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+	r.Use(middleware.RequestLogger(), gin.Recovery())
+
+	// Each route group gets the CORS policy configured for it; the worker
+	// group gets none, as workers don't run in browsers.
+	publicCORS := corsHandler(cfg.CORS.Public)
+	apiCORS := corsHandler(cfg.CORS.API)
+	if len(cfg.CORS.API.Origins) == 0 {
+		slog.Warn("CORS_ORIGINS is not set, the API accepts requests from any origin without credentials")
+	}
 
 	r.Use(func(c *gin.Context) {
 		c.Header("X-Frame-Options", "DENY")
@@ -57,40 +155,238 @@ func NewRouter(scanHandler *handlers.ScanHandler, authHandler *handlers.AuthHand
 		c.Next()
 	})
 
+	ipLimiter := ratelimit.NewLimiter(cfg.RateLimits.IP)
+	userLimiter := ratelimit.NewLimiter(cfg.RateLimits.User)
+
+	b := cfg.Bulkheads
+	submissions := middleware.Bulkhead("submissions", b.Submissions.MaxConcurrent, b.Submissions.Timeout)
+	exports := middleware.Bulkhead("exports", b.Exports.MaxConcurrent, b.Exports.Timeout)
+	analytics := middleware.Bulkhead("analytics", b.Analytics.MaxConcurrent, b.Analytics.Timeout)
+
+	docs := newAPIDocs()
+	routes := r.Routes()
 	public := r.Group("/api")
+	public.Use(publicCORS, middleware.RateLimitByIP(ipLimiter))
 	{
-		public.POST("/freescans", scanHandler.HandleScanSubmission)
-		public.POST("/results", scanHandler.HandleResultSubmission)
-		public.GET("/freescans/:id", scanHandler.HandleGetScan)
-		public.GET("/health", scanHandler.HandleHealthCheck)
-		public.POST("/auth/register", authHandler.Register)
-		public.POST("/auth/login", authHandler.Login)
+		public.POST("/freescans", submissions, deps.ScanHandler.HandleScanSubmission)
+		public.GET("/freescans/:id", deps.ScanHandler.HandleGetScan)
+		public.GET("/health", deps.ScanHandler.HandleHealthCheck)
+		public.GET("/remediation", deps.RemediationHandler.HandleGetRemediation)
+		public.GET("/files/*key", deps.FileHandler.HandleDownload)
+		public.GET("/openapi.json", docs.handleSpec)
 	}
+	docs.group(r, routes, groupPublic)
+	allowPreflight(r, routes, publicCORS)
 
+	routes = r.Routes()
+	account := r.Group("/api/auth")
+	account.Use(apiCORS, middleware.RateLimitByIP(ipLimiter))
+	{
+		account.POST("/register", deps.AuthHandler.Register)
+		account.POST("/login", deps.AuthHandler.Login)
+		account.POST("/login/confirm", deps.AuthHandler.HandleConfirmLogin)
+		account.POST("/forgot-password", deps.AuthHandler.HandleForgotPassword)
+		account.POST("/reset-password", deps.AuthHandler.HandleResetPassword)
+	}
+	docs.group(r, routes, groupPublic)
+	allowPreflight(r, routes, apiCORS)
+
+	routes = r.Routes()
+	slackApp := r.Group("/slack")
+	slackApp.Use(middleware.RateLimitByIP(ipLimiter))
+	{
+		slackApp.POST("/commands", submissions, deps.ScanHandler.HandleSlackCommand)
+		slackApp.POST("/interactions", submissions, deps.ScanHandler.HandleSlackInteraction)
+	}
+	docs.group(r, routes, groupPublic)
+
+	routes = r.Routes()
+	worker := r.Group("/api")
+	worker.Use(middleware.RequireWorkerAuth(deps.AuthHandler.DB(), cfg.UploadTokens()), middleware.TrackAPIUsage(deps.UsageTracker), middleware.RequireScope(apikeys.ScopeResultsWrite))
+	if cfg.WorkerSigningSecret != "" {
+		worker.Use(middleware.RequireSignature(deps.AuthHandler.DB(), cfg.WorkerSigningSecret))
+	} else {
+		slog.Warn("WORKER_SIGNING_SECRET is not set, worker submissions are not protected against replay")
+	}
+	{
+		worker.POST("/results", deps.ScanHandler.HandleResultSubmission)
+		worker.POST("/scans/:id/start", deps.ScanHandler.HandleStartScan)
+		worker.POST("/scans/:id/heartbeat", deps.ScanHandler.HandleScanHeartbeat)
+		worker.POST("/artifacts", deps.ArtifactHandler.HandleUploadArtifact)
+	}
+	docs.group(r, routes, groupWorker)
+
+	routes = r.Routes()
 	protected := r.Group("/api")
-	protected.Use(middleware.RequireAuth())
+	protected.Use(apiCORS, middleware.RequireAuthOrAPIKey(deps.AuthHandler.DB(), cfg.JWTSecret, cfg.JWTClaimsKey), middleware.RateLimitByUser(userLimiter), middleware.TrackAPIUsage(deps.UsageTracker), middleware.RequireScopes(apiKeyScopes))
 	{
-		protected.GET("/auth/me", authHandler.Me)
-		protected.POST("/scans", scanHandler.HandlePremiumScanSubmission)
-		protected.GET("/scans/:id", scanHandler.HandlePremiumGetScan)
-		protected.GET("/users/scans", scanHandler.HandleUserScans)
-		protected.GET("/users/widgets", scanHandler.HandleUserDashboardWidgets)
+		protected.GET("/auth/me", deps.AuthHandler.Me)
+		protected.GET("/me/sessions", deps.AuthHandler.HandleListSessions)
+		protected.DELETE("/me/sessions/:id", deps.AuthHandler.HandleRevokeSession)
+		protected.GET("/me/quota", deps.ScanHandler.HandleGetQuota)
+		protected.POST("/me/slack/link-code", deps.ScanHandler.HandleCreateSlackLinkCode)
+		protected.POST("/me/push-devices", deps.PushDeviceHandler.HandleRegisterPushDevice)
+		protected.GET("/me/push-devices", deps.PushDeviceHandler.HandleListPushDevices)
+		protected.PATCH("/me/push-devices/:id", deps.PushDeviceHandler.HandleUpdatePushDevice)
+		protected.DELETE("/me/push-devices/:id", deps.PushDeviceHandler.HandleDeletePushDevice)
+		protected.POST("/scans", submissions, deps.ScanHandler.HandlePremiumScanSubmission)
+		protected.POST("/scans/batch", submissions, deps.ScanHandler.HandleBatchScanSubmission)
+		protected.GET("/scans/batch/:id", deps.ScanHandler.HandleGetScanBatch)
+		protected.GET("/scans", deps.ScanHandler.HandleListScans)
+		protected.GET("/scans/compare", deps.ScanHandler.HandleCompareScans)
+		protected.GET("/scans/search", deps.ScanHandler.HandleSearchScans)
+		protected.GET("/scans/:id", deps.ScanHandler.HandlePremiumGetScan)
+		protected.POST("/scans/:id/cancel", deps.ScanHandler.HandleCancelScan)
+		protected.DELETE("/scans/:id", deps.ScanHandler.HandleDeleteScan)
+		protected.PATCH("/scans/:id/tags", deps.ScanHandler.HandleUpdateScanTags)
+		protected.GET("/scans/:id/events", deps.ScanHandler.HandleScanEvents)
+		protected.GET("/scans/:id/results", deps.ScanHandler.HandleListScanResults)
+		protected.POST("/scans/:id/approve", middleware.LoadRole(deps.AuthHandler.DB()), middleware.RequireRole(models.UserRoleAdmin), deps.ScanHandler.HandleApproveScan)
+		protected.POST("/scans/:id/reject", middleware.LoadRole(deps.AuthHandler.DB()), middleware.RequireRole(models.UserRoleAdmin), deps.ScanHandler.HandleRejectScan)
+		protected.GET("/scans/:id/artifacts", deps.ArtifactHandler.HandleListArtifacts)
+		protected.GET("/scans/:id/har", exports, deps.ArtifactHandler.HandleGetHAR)
+		protected.GET("/scans/:id/har/entries", deps.ArtifactHandler.HandleListHAREntries)
+		protected.GET("/scans/:id/har/entries/:index", deps.ArtifactHandler.HandleGetHAREntry)
+		protected.GET("/scans/:id/raw-headers", deps.ArtifactHandler.HandleGetRawHeaders)
+		protected.POST("/scans/:id/evaluations", deps.EvaluationHandler.HandleCreateEvaluation)
+		protected.GET("/scans/:id/evaluations", deps.EvaluationHandler.HandleListEvaluations)
+		protected.GET("/scans/:id/evaluations/:number", deps.EvaluationHandler.HandleGetEvaluation)
+		protected.GET("/scans/:id/report.pdf", exports, deps.ReportHandler.HandleScanReportPDF)
+		protected.GET("/scans/:id/results.csv", exports, deps.ScanHandler.HandleExportResultsCSV)
+		protected.POST("/scans/:id/exports", deps.ReportHandler.HandleCreateResultsCSVJob)
+		protected.GET("/scans/:id/timeline", deps.ScanHandler.HandleScanTimeline)
+		protected.GET("/scans/:id/benchmark", analytics, deps.ScanHandler.HandleScanBenchmark)
+		protected.GET("/users/scans", deps.ScanHandler.HandleUserScans)
+		protected.GET("/users/widgets", analytics, deps.ScanHandler.HandleUserDashboardWidgets)
+		protected.GET("/users/activity", deps.ScanHandler.HandleUserActivity)
+		protected.GET("/users/metrics", deps.ScanHandler.HandlePostureMetrics)
+		protected.POST("/graphql", middleware.LoadRole(deps.AuthHandler.DB()), deps.GraphHandler.HandleGraphQL)
 		//Tutaj karol masz enpointa
-		protected.GET("/utils/tests", scanHandler.HandleAvailableScans)
-		protected.PATCH("/utils/profile/name", authHandler.HandleUpdateFullName)
-		protected.PATCH("/utils/profile/email", authHandler.HandleUpdateEmail)
-		protected.PATCH("/utils/profile/password", authHandler.HandleUpdatePassword)
+		protected.GET("/utils/tests", deps.ScanHandler.HandleAvailableScans)
+		protected.PATCH("/utils/profile/name", deps.AuthHandler.HandleUpdateFullName)
+		protected.PATCH("/utils/profile/email", deps.AuthHandler.HandleUpdateEmail)
+		protected.PATCH("/utils/profile/password", deps.AuthHandler.HandleUpdatePassword)
+		protected.GET("/scoring/policy", deps.ScoringHandler.HandleGetScoringPolicy)
+		protected.PUT("/scoring/policy", deps.ScoringHandler.HandleUpdateScoringPolicy)
+		protected.DELETE("/scoring/policy", deps.ScoringHandler.HandleDeleteScoringPolicy)
+		protected.GET("/findings", deps.FindingHandler.HandleListFindings)
+		protected.POST("/findings/bulk", deps.FindingHandler.HandleBulkFindings)
+		protected.GET("/sla-policies", deps.FindingHandler.HandleListSLAPolicies)
+		protected.PUT("/sla-policies", deps.FindingHandler.HandleUpdateSLAPolicies)
+		protected.GET("/classifications", deps.FindingHandler.HandleListClassifications)
+		protected.PUT("/classifications", deps.FindingHandler.HandleUpdateClassifications)
+		protected.GET("/triggers/me", deps.TriggerHandler.HandleTriggerAccount)
+		protected.GET("/triggers/scan-events", deps.TriggerHandler.HandleScanEventTrigger)
+		protected.GET("/triggers/findings", deps.TriggerHandler.HandleFindingTrigger)
+		protected.GET("/reports/matrix", exports, deps.ReportHandler.HandleMatrix)
+		protected.POST("/reports/executive-summary", exports, deps.ReportHandler.HandleCreateExecutiveSummary)
+		protected.GET("/reports/jobs/:id", deps.ReportHandler.HandleGetReportJob)
+		protected.GET("/jobs/:id", deps.ReportHandler.HandleGetReportJob)
+		protected.POST("/jobs/:id/retry", deps.ReportHandler.HandleRetryReportJob)
+		protected.GET("/views", deps.SavedViewHandler.HandleListSavedViews)
+		protected.POST("/views", deps.SavedViewHandler.HandleCreateSavedView)
+		protected.PUT("/views/:id", deps.SavedViewHandler.HandleUpdateSavedView)
+		protected.DELETE("/views/:id", deps.SavedViewHandler.HandleDeleteSavedView)
+		protected.POST("/views/:id/default", deps.SavedViewHandler.HandleSetDefaultSavedView)
+		protected.GET("/targets", deps.TargetHandler.HandleListTargets)
+		protected.POST("/targets", deps.TargetHandler.HandleCreateTarget)
+		protected.GET("/targets/history", deps.ScanHandler.HandleTargetHistory)
+		protected.GET("/targets/:id", deps.TargetHandler.HandleGetTarget)
+		protected.POST("/targets/:id/verify", deps.TargetHandler.HandleVerifyTarget)
+		protected.DELETE("/targets/:id", deps.TargetHandler.HandleDeleteTarget)
+		protected.GET("/organizations", deps.OrganizationHandler.HandleListOrganizations)
+		protected.POST("/organizations", deps.OrganizationHandler.HandleCreateOrganization)
+		protected.POST("/organizations/invitations/accept", deps.OrganizationHandler.HandleAcceptInvitation)
+		protected.GET("/organizations/:id/members", deps.OrganizationHandler.HandleListMembers)
+		protected.GET("/organizations/:id/usage", deps.OrganizationHandler.HandleGetStorageUsage)
+		protected.GET("/organizations/:id/activity", deps.ScanHandler.HandleOrganizationActivity)
+		protected.GET("/organizations/:id/metrics", deps.ScanHandler.HandleOrganizationPostureMetrics)
+		protected.GET("/organizations/:id/api-usage", analytics, deps.APIKeyHandler.HandleOrganizationAPIUsage)
+		protected.GET("/organizations/:id/email-templates", deps.EmailTemplateHandler.HandleListOrganizationEmailTemplates)
+		protected.GET("/organizations/:id/email-templates/:name", deps.EmailTemplateHandler.HandleGetOrganizationEmailTemplate)
+		protected.PUT("/organizations/:id/email-templates/:name", deps.EmailTemplateHandler.HandleUpdateOrganizationEmailTemplate)
+		protected.DELETE("/organizations/:id/email-templates/:name", deps.EmailTemplateHandler.HandleResetOrganizationEmailTemplate)
+		protected.GET("/organizations/:id/scoring/policy", deps.ScoringHandler.HandleGetOrganizationScoringPolicy)
+		protected.PUT("/organizations/:id/scoring/policy", deps.ScoringHandler.HandleUpdateOrganizationScoringPolicy)
+		protected.DELETE("/organizations/:id/scoring/policy", deps.ScoringHandler.HandleDeleteOrganizationScoringPolicy)
+		protected.GET("/organizations/:id/classifications", deps.FindingHandler.HandleListOrganizationClassifications)
+		protected.PUT("/organizations/:id/classifications", deps.FindingHandler.HandleUpdateOrganizationClassifications)
+		protected.GET("/organizations/:id/sla-policies", deps.FindingHandler.HandleListOrganizationSLAPolicies)
+		protected.PUT("/organizations/:id/sla-policies", deps.FindingHandler.HandleUpdateOrganizationSLAPolicies)
+		protected.POST("/organizations/:id/invitations", deps.OrganizationHandler.HandleInviteMember)
+		protected.GET("/organizations/:id/integrations", deps.OrganizationHandler.HandleListIntegrations)
+		protected.PUT("/organizations/:id/integrations/:provider", deps.OrganizationHandler.HandleSetIntegration)
+		protected.DELETE("/organizations/:id/integrations/:provider", deps.OrganizationHandler.HandleDeleteIntegration)
+		protected.GET("/api-keys", deps.APIKeyHandler.HandleListUserAPIKeys)
+		protected.POST("/api-keys", deps.APIKeyHandler.HandleCreateUserAPIKey)
+		protected.DELETE("/api-keys/:id", deps.APIKeyHandler.HandleRevokeUserAPIKey)
+		protected.POST("/webhooks", deps.WebhookHandler.HandleCreateWebhook)
+		protected.GET("/webhooks", deps.WebhookHandler.HandleListWebhooks)
+		protected.GET("/webhooks/:id", deps.WebhookHandler.HandleGetWebhook)
+		protected.PATCH("/webhooks/:id", deps.WebhookHandler.HandleUpdateWebhook)
+		protected.DELETE("/webhooks/:id", deps.WebhookHandler.HandleDeleteWebhook)
+		protected.POST("/webhooks/:id/rotate-secret", deps.WebhookHandler.HandleRotateWebhookSecret)
+		protected.GET("/webhooks/:id/deliveries", deps.WebhookHandler.HandleListDeliveries)
+		protected.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", deps.WebhookHandler.HandleRedeliver)
 	}
+	docs.group(r, routes, groupUser)
 
+	userRoutes := r.Routes()
 	admin := r.Group("/api/admin")
-	admin.Use(middleware.RequireAuth(), middleware.RequireAdmin(authHandler.DB()))
+	admin.Use(apiCORS, middleware.RequireAuthOrAPIKey(deps.AuthHandler.DB(), cfg.JWTSecret, cfg.JWTClaimsKey), middleware.RateLimitByUser(userLimiter), middleware.TrackAPIUsage(deps.UsageTracker), middleware.RequireScope(apikeys.ScopeAdmin), middleware.LoadRole(deps.AuthHandler.DB()), middleware.RequireRole(models.UserRoleAdmin))
 	{
 		admin.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok"})
 		})
-		admin.GET("/database", adminHandler.HandleGetDatabaseInfo)
+		admin.GET("/database", deps.AdminHandler.HandleGetDatabaseInfo)
+
+		admin.GET("/widgets", analytics, deps.AdminHandler.HandleGetDashboardWidgets)
+		admin.GET("/users", deps.AdminHandler.HandleListUsers)
+		admin.PATCH("/users/:id/role", deps.AdminHandler.HandleUpdateUserRole)
+		admin.POST("/users/:id/disable", deps.AdminHandler.HandleDisableUser)
+		admin.POST("/users/:id/enable", deps.AdminHandler.HandleEnableUser)
+		admin.PATCH("/organizations/:id", deps.OrganizationHandler.HandleSetOrganizationPlan)
+		admin.GET("/audit-log", deps.AdminHandler.HandleListAuditLog)
+		admin.GET("/audit-log/verify", deps.AdminHandler.HandleVerifyAuditLog)
+		admin.GET("/metrics", gin.WrapH(expvar.Handler()))
+		admin.GET("/metrics/scans", gin.WrapH(deps.ScanMetrics))
+		admin.GET("/scans", deps.ScanHandler.HandleAdminListScans)
+		admin.GET("/scans/:id", deps.ScanHandler.HandleAdminGetScan)
+		admin.POST("/scans/:id/cancel", deps.ScanHandler.HandleAdminCancelScan)
+		admin.POST("/scans/:id/status", deps.ScanHandler.HandleAdminSetScanStatus)
+		admin.POST("/scans/:id/requeue", deps.ScanHandler.HandleAdminRequeueScan)
+		admin.DELETE("/scans/:id", deps.ScanHandler.HandleAdminDeleteScan)
+		admin.GET("/scans/:id/timeline", deps.ScanHandler.HandleAdminScanTimeline)
+		admin.GET("/dead-letters", deps.ScanHandler.HandleListDeadLetters)
+		admin.POST("/dead-letters/:messageId/requeue", deps.ScanHandler.HandleRequeueDeadLetter)
+		admin.GET("/production-targets", deps.ScanHandler.HandleListProductionTargets)
+		admin.POST("/production-targets", deps.ScanHandler.HandleCreateProductionTarget)
+		admin.DELETE("/production-targets/:id", deps.ScanHandler.HandleDeleteProductionTarget)
+		admin.GET("/scoring/policy", deps.ScoringHandler.HandleGetDefaultScoringPolicy)
+		admin.PUT("/scoring/policy", deps.ScoringHandler.HandleUpdateDefaultScoringPolicy)
+		admin.POST("/scoring/recalculations", deps.ScoringHandler.HandleStartRecalculation)
+		admin.GET("/scoring/recalculations/:id", deps.ScoringHandler.HandleGetRecalculation)
+		admin.GET("/remediation", deps.RemediationHandler.HandleListRemediation)
+		admin.POST("/remediation", deps.RemediationHandler.HandleCreateRemediation)
+		admin.GET("/remediation/:test/:lang/versions", deps.RemediationHandler.HandleListRemediationVersions)
+		admin.POST("/remediation/:test/:lang/versions/:version/restore", deps.RemediationHandler.HandleRestoreRemediationVersion)
+		admin.POST("/api-keys", deps.APIKeyHandler.HandleCreateAPIKey)
+		admin.GET("/api-keys", deps.APIKeyHandler.HandleListAPIKeys)
+		admin.PATCH("/api-keys/:id", deps.APIKeyHandler.HandleUpdateAPIKey)
+		admin.DELETE("/api-keys/:id", deps.APIKeyHandler.HandleRevokeAPIKey)
+		admin.GET("/api-usage", analytics, deps.APIKeyHandler.HandleAPIUsage)
+		admin.GET("/email-templates", deps.EmailTemplateHandler.HandleListEmailTemplates)
+		admin.GET("/email-templates/:name", deps.EmailTemplateHandler.HandleGetEmailTemplate)
+		admin.PUT("/email-templates/:name", deps.EmailTemplateHandler.HandleUpdateEmailTemplate)
+		admin.DELETE("/email-templates/:name", deps.EmailTemplateHandler.HandleResetEmailTemplate)
+		admin.POST("/email-templates/:name/preview", deps.EmailTemplateHandler.HandlePreviewEmailTemplate)
+	}
+	docs.group(r, userRoutes, groupAdmin)
+	allowPreflight(r, routes, apiCORS)
 
-		admin.GET("/widgets", adminHandler.HandleGetDashboardWidgets)
+	r.GET("/docs", handleSwaggerUI)
+	if err := docs.build(r.Routes()); err != nil {
+		slog.Error("Failed to build the OpenAPI document", "error", err)
 	}
 
 	return r
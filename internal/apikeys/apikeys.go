@@ -0,0 +1,67 @@
+// Package apikeys generates and hashes API keys used by machine clients.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// KeyPrefix starts every key so leaked keys are easy to recognise.
+const KeyPrefix = "agx_"
+
+// displayPrefixLen is how many characters of a key are kept in Prefix.
+const displayPrefixLen = 12
+
+// Generate returns a new random key, its display prefix and its hash.
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = KeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:displayPrefixLen], Hash(key), nil
+}
+
+// Hash returns the hex-encoded SHA-256 hash under which a key is stored.
+// Keys carry 256 bits of entropy, so a fast hash is sufficient.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Scopes that can be granted to an API key.
+const (
+	ScopeScansWrite   = "scans:write"
+	ScopeScansRead    = "scans:read"
+	ScopeResultsWrite = "results:write"
+	// ScopeTriggersRead only grants the polling triggers, for connecting
+	// automation platforms such as Zapier and Make.
+	ScopeTriggersRead = "triggers:read"
+	// ScopeAdmin grants every other scope as well as the admin API, as
+	// long as the key's owner is an admin.
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []string{ScopeScansWrite, ScopeScansRead, ScopeResultsWrite, ScopeTriggersRead, ScopeAdmin}
+
+// UserScopes lists the scopes users may grant to their own keys; the
+// others can only be granted by admins.
+var UserScopes = []string{ScopeScansWrite, ScopeScansRead, ScopeTriggersRead}
+
+// LegacyScopes are given to keys created before scopes existed, which were
+// only accepted by the worker endpoints.
+var LegacyScopes = []string{ScopeResultsWrite}
+
+// HasScope reports whether granted includes scope, directly or through
+// ScopeAdmin.
+func HasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+// Package artifacts validates and sanitizes evidence files uploaded by
+// workers (screenshots, HAR captures, raw response headers, TLS snapshots)
+// before they are stored.
+//
+// Artifacts are later served back to browsers, so every upload is checked
+// against a size limit and an allow-list of content types, images are
+// decoded and re-encoded (dropping metadata and anything appended to the
+// image data), and the original bytes are optionally scanned by an
+// antivirus engine.
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Artifact kinds accepted by the sanitizer.
+const (
+	KindScreenshot = "screenshot"
+	KindHAR        = "har"
+	KindHeaders    = "headers"
+	KindTLS        = "tls"
+)
+
+// Kinds lists all supported artifact kinds.
+var Kinds = []string{KindScreenshot, KindHAR, KindHeaders, KindTLS}
+
+// Compressed reports whether artifacts of the given kind are stored
+// gzip-compressed. Text artifacts compress well; images do not.
+func Compressed(kind string) bool {
+	return kind == KindHAR || kind == KindHeaders || kind == KindTLS
+}
+
+// Default limits applied by NewSanitizer.
+const (
+	DefaultMaxImageBytes  = 10 << 20
+	DefaultMaxHARBytes    = 50 << 20
+	DefaultMaxHeaderBytes = 1 << 20
+	DefaultMaxPixels      = 40_000_000
+)
+
+// RejectedError is returned when an artifact is refused because of its
+// content. The reason is safe to return to the uploader.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "artifact rejected: " + e.Reason
+}
+
+func reject(format string, args ...interface{}) error {
+	return &RejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Scanner is implemented by antivirus engines. Scan returns a
+// RejectedError if the content is infected and any other error if the
+// content could not be scanned.
+type Scanner interface {
+	Scan(ctx context.Context, content []byte) error
+}
+
+// Sanitized is an artifact that passed validation and is ready to store.
+type Sanitized struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+// Sanitizer validates artifacts. A nil AV disables antivirus scanning.
+type Sanitizer struct {
+	MaxImageBytes  int64
+	MaxHARBytes    int64
+	MaxHeaderBytes int64
+	MaxPixels      int
+	AV             Scanner
+}
+
+// NewSanitizer returns a sanitizer with the default limits.
+func NewSanitizer(av Scanner) *Sanitizer {
+	return &Sanitizer{
+		MaxImageBytes:  DefaultMaxImageBytes,
+		MaxHARBytes:    DefaultMaxHARBytes,
+		MaxHeaderBytes: DefaultMaxHeaderBytes,
+		MaxPixels:      DefaultMaxPixels,
+		AV:             av,
+	}
+}
+
+// MaxBytes returns the size limit for the given kind, or 0 if the kind is
+// not supported.
+func (s *Sanitizer) MaxBytes(kind string) int64 {
+	switch kind {
+	case KindScreenshot:
+		return s.MaxImageBytes
+	case KindHAR:
+		return s.MaxHARBytes
+	case KindHeaders, KindTLS:
+		return s.MaxHeaderBytes
+	}
+	return 0
+}
+
+// Sanitize validates the artifact and returns the bytes that should be
+// stored in place of the upload.
+func (s *Sanitizer) Sanitize(ctx context.Context, kind string, data []byte) (*Sanitized, error) {
+	limit := s.MaxBytes(kind)
+	if limit == 0 {
+		return nil, reject("unsupported artifact kind %q", kind)
+	}
+	if len(data) == 0 {
+		return nil, reject("artifact is empty")
+	}
+	if int64(len(data)) > limit {
+		return nil, reject("artifact exceeds the %d byte limit", limit)
+	}
+
+	if s.AV != nil {
+		if err := s.AV.Scan(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	switch kind {
+	case KindScreenshot:
+		return s.sanitizeImage(data)
+	case KindHeaders:
+		return sanitizeHeaders(data)
+	case KindTLS:
+		return sanitizeTLS(data)
+	default:
+		return sanitizeHAR(data)
+	}
+}
+
+// sanitizeImage decodes the image and re-encodes it, so only pixel data
+// survives. GIFs are converted to PNG.
+func (s *Sanitizer) sanitizeImage(data []byte) (*Sanitized, error) {
+	sniffed := http.DetectContentType(data)
+	if sniffed != "image/png" && sniffed != "image/jpeg" && sniffed != "image/gif" {
+		return nil, reject("screenshots must be PNG, JPEG or GIF images, got %s", sniffed)
+	}
+
+	// Check the dimensions before decoding to avoid decompression bombs.
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, reject("invalid image: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > s.MaxPixels {
+		return nil, reject("image dimensions %dx%d are not allowed", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, reject("invalid image: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		return &Sanitized{Data: buf.Bytes(), ContentType: "image/jpeg", Extension: ".jpg"}, nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Sanitized{Data: buf.Bytes(), ContentType: "image/png", Extension: ".png"}, nil
+}
+
+// sanitizeHAR checks that the content is a HAR document and compacts it,
+// dropping anything outside the JSON value.
+func sanitizeHAR(data []byte) (*Sanitized, error) {
+	var doc struct {
+		Log *struct {
+			Entries []json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, reject("invalid HAR file: %v", err)
+	}
+	if doc.Log == nil || doc.Log.Entries == nil {
+		return nil, reject("invalid HAR file: missing log.entries")
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, reject("invalid HAR file: %v", err)
+	}
+	return &Sanitized{Data: buf.Bytes(), ContentType: "application/json", Extension: ".har"}, nil
+}
@@ -0,0 +1,88 @@
+package artifacts
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks streamed with INSTREAM. It must
+// stay below clamd's StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// ClamdScanner scans content with a clamd daemon using the INSTREAM
+// command.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner for the clamd daemon at addr, given
+// either as "unix:/path/to/clamd.sock" or as "host:port" (optionally
+// prefixed with "tcp:").
+func NewClamdScanner(addr string, timeout time.Duration) *ClamdScanner {
+	network, address := "tcp", strings.TrimPrefix(addr, "tcp:")
+	if strings.HasPrefix(addr, "unix:") {
+		network, address = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, content []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("clamd INSTREAM: %w", err)
+	}
+	size := make([]byte, 4)
+	for start := 0; start < len(content); start += clamdChunkSize {
+		end := min(start+clamdChunkSize, len(content))
+		binary.BigEndian.PutUint32(size, uint32(end-start))
+		if _, err := conn.Write(size); err != nil {
+			return fmt.Errorf("clamd INSTREAM: %w", err)
+		}
+		if _, err := conn.Write(content[start:end]); err != nil {
+			return fmt.Errorf("clamd INSTREAM: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return fmt.Errorf("clamd INSTREAM: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return fmt.Errorf("read clamd reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+
+	// Replies look like "stream: OK", "stream: <signature> FOUND" or
+	// "<message> ERROR".
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return reject("malware detected (%s)", signature)
+	default:
+		return fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,143 @@
+package artifacts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EncodingGzip marks artifacts that are stored gzip-compressed.
+const EncodingGzip = "gzip"
+
+// Compress gzips data for storage.
+func Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode wraps a stored artifact so that reading it yields the original
+// content, undoing the given storage encoding.
+func Decode(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "":
+		return r, nil
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unknown artifact encoding %q", encoding)
+	}
+}
+
+// HAREntry summarizes a single request/response pair of a HAR capture.
+type HAREntry struct {
+	Index           int     `json:"index"`
+	StartedDateTime string  `json:"started_date_time"`
+	Method          string  `json:"method"`
+	URL             string  `json:"url"`
+	Status          int     `json:"status"`
+	MimeType        string  `json:"mime_type"`
+	Time            float64 `json:"time"`
+}
+
+// HARFilter selects entries of a HAR capture. Zero values match everything.
+type HARFilter struct {
+	// Method matches the request method case-insensitively.
+	Method string
+	// URL matches entries whose request URL contains the substring.
+	URL string
+	// Status matches the exact response status code.
+	Status int
+	// MimeType matches entries whose response MIME type contains the substring.
+	MimeType string
+}
+
+// Match reports whether the entry passes the filter.
+func (f HARFilter) Match(e HAREntry) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, e.Method) {
+		return false
+	}
+	if f.URL != "" && !strings.Contains(strings.ToLower(e.URL), strings.ToLower(f.URL)) {
+		return false
+	}
+	if f.Status != 0 && f.Status != e.Status {
+		return false
+	}
+	if f.MimeType != "" && !strings.Contains(strings.ToLower(e.MimeType), strings.ToLower(f.MimeType)) {
+		return false
+	}
+	return true
+}
+
+// HAR is a parsed HAR capture. Entries are kept raw so single entries can
+// be returned exactly as captured.
+type HAR struct {
+	Entries []json.RawMessage
+}
+
+// ParseHAR reads a HAR document.
+func ParseHAR(r io.Reader) (*HAR, error) {
+	var doc struct {
+		Log struct {
+			Entries []json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &HAR{Entries: doc.Log.Entries}, nil
+}
+
+// Summary returns the summary of the entry at index i.
+func (h *HAR) Summary(i int) (HAREntry, error) {
+	var entry struct {
+		StartedDateTime string  `json:"startedDateTime"`
+		Time            float64 `json:"time"`
+		Request         struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+		} `json:"request"`
+		Response struct {
+			Status  int `json:"status"`
+			Content struct {
+				MimeType string `json:"mimeType"`
+			} `json:"content"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(h.Entries[i], &entry); err != nil {
+		return HAREntry{}, err
+	}
+	return HAREntry{
+		Index:           i,
+		StartedDateTime: entry.StartedDateTime,
+		Method:          entry.Request.Method,
+		URL:             entry.Request.URL,
+		Status:          entry.Response.Status,
+		MimeType:        entry.Response.Content.MimeType,
+		Time:            entry.Time,
+	}, nil
+}
+
+// Filter returns the summaries of all entries matching f, in capture order.
+func (h *HAR) Filter(f HARFilter) ([]HAREntry, error) {
+	out := []HAREntry{}
+	for i := range h.Entries {
+		e, err := h.Summary(i)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// HeaderField is a single response header line. Headers are kept as an
+// ordered list rather than a map so duplicates and the original order
+// survive.
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HeaderSnapshot is the raw header block of one response received while
+// scanning (the target itself, redirect hops, etc.).
+type HeaderSnapshot struct {
+	URL        string        `json:"url"`
+	StatusCode int           `json:"status_code"`
+	Protocol   string        `json:"protocol,omitempty"`
+	Headers    []HeaderField `json:"headers"`
+}
+
+// sanitizeHeaders accepts either a single HeaderSnapshot or an array of
+// them and stores them re-encoded as an array.
+func sanitizeHeaders(data []byte) (*Sanitized, error) {
+	var snapshots []HeaderSnapshot
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var single HeaderSnapshot
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return nil, reject("invalid header snapshot: %v", err)
+		}
+		snapshots = []HeaderSnapshot{single}
+	} else if err := json.Unmarshal(trimmed, &snapshots); err != nil {
+		return nil, reject("invalid header snapshot: %v", err)
+	}
+
+	if len(snapshots) == 0 {
+		return nil, reject("header snapshot is empty")
+	}
+	for i, s := range snapshots {
+		if s.URL == "" || s.Headers == nil {
+			return nil, reject("header snapshot %d must have a url and headers", i)
+		}
+	}
+
+	out, err := json.Marshal(snapshots)
+	if err != nil {
+		return nil, err
+	}
+	return &Sanitized{Data: out, ContentType: "application/json", Extension: ".json"}, nil
+}
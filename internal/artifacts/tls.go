@@ -0,0 +1,52 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TLSSnapshot is what was observed of the target's HTTPS endpoint while
+// scanning: the negotiated parameters, the legacy protocols and insecure
+// cipher suites it accepted, and the certificate chain it presented.
+type TLSSnapshot struct {
+	Address    string    `json:"address"`
+	ServerName string    `json:"server_name"`
+	CapturedAt time.Time `json:"captured_at"`
+	// Error is set when no TLS handshake succeeded; Available tells an
+	// endpoint without HTTPS from one that couldn't be reached.
+	Error     string `json:"error,omitempty"`
+	Available bool   `json:"available"`
+
+	Version         string   `json:"version,omitempty"`
+	CipherSuite     string   `json:"cipher_suite,omitempty"`
+	LegacyProtocols []string `json:"legacy_protocols"`
+	InsecureCiphers []string `json:"insecure_ciphers"`
+	// Certificates are the DER certificates presented, leaf first.
+	Certificates [][]byte `json:"certificates"`
+}
+
+// Evidence is the raw evidence of one scan that passive checks can be
+// evaluated on again without contacting the target.
+type Evidence struct {
+	// Responses are the responses received when loading the target, in
+	// order: redirect hops first, the final page last.
+	Responses []HeaderSnapshot
+	TLS       *TLSSnapshot
+}
+
+// sanitizeTLS validates a TLS snapshot and stores it re-encoded.
+func sanitizeTLS(data []byte) (*Sanitized, error) {
+	var snapshot TLSSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, reject("invalid TLS snapshot: %v", err)
+	}
+	if snapshot.Address == "" || snapshot.ServerName == "" || snapshot.CapturedAt.IsZero() {
+		return nil, reject("TLS snapshot must have an address, server_name and captured_at")
+	}
+
+	out, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &Sanitized{Data: out, ContentType: "application/json", Extension: ".json"}, nil
+}
@@ -0,0 +1,172 @@
+// Package audit keeps a tamper-evident log of security-relevant actions.
+//
+// Entries form a hash chain: every entry stores the hash of the entry before
+// it, and its own hash covers its content together with that previous hash.
+// Editing, inserting or deleting an entry after the fact therefore breaks
+// the chain from that entry onwards, which Verify detects. Truncating the
+// tail can't be detected from the log alone; auditors who need that should
+// record the LastHash reported by Verify somewhere outside the database and
+// check later that it is still part of the chain.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GenesisHash is the PrevHash of the first entry.
+var GenesisHash = strings.Repeat("0", 64)
+
+// chainLock is the key of the Postgres advisory lock that serializes
+// appends, so that two transactions can't both extend the same entry.
+const chainLock = 7_412_301
+
+// verifyBatchSize is how many entries Verify loads at a time.
+const verifyBatchSize = 1000
+
+// Entry describes an action to record.
+type Entry struct {
+	ActorID    *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    interface{}
+}
+
+// Record appends an entry to the log. It should run in the transaction of
+// the action it records, so that the two are committed together; appends
+// are serialized until that transaction ends.
+func Record(tx *gorm.DB, e Entry) error {
+	var details datatypes.JSON
+	if e.Details != nil {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return fmt.Errorf("encoding audit details: %w", err)
+		}
+		details = b
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLock).Error; err != nil {
+			return err
+		}
+
+		entry := models.AuditLogEntry{
+			Seq:        1,
+			ActorID:    e.ActorID,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			Details:    details,
+			// Postgres keeps microseconds; truncate so that the hash
+			// matches the stored value.
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+			PrevHash:  GenesisHash,
+		}
+
+		var last models.AuditLogEntry
+		err := tx.Order("seq DESC").Take(&last).Error
+		switch {
+		case err == nil:
+			entry.Seq = last.Seq + 1
+			entry.PrevHash = last.Hash
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		entry.Hash = Hash(entry)
+		return tx.Create(&entry).Error
+	})
+}
+
+// Hash computes the hash of an entry from its content and PrevHash.
+func Hash(e models.AuditLogEntry) string {
+	var actor string
+	if e.ActorID != nil {
+		actor = e.ActorID.String()
+	}
+	// The field order is fixed by the struct, so the encoding is stable.
+	b, _ := json.Marshal(struct {
+		Seq        int64  `json:"seq"`
+		PrevHash   string `json:"prev_hash"`
+		CreatedAt  string `json:"created_at"`
+		ActorID    string `json:"actor_id"`
+		Action     string `json:"action"`
+		TargetType string `json:"target_type"`
+		TargetID   string `json:"target_id"`
+		Details    string `json:"details"`
+	}{
+		Seq:        e.Seq,
+		PrevHash:   e.PrevHash,
+		CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorID:    actor,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Details:    string(e.Details),
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Result is the outcome of Verify.
+type Result struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+	// LastHash is the hash of the last entry checked; it identifies the
+	// state of the log at the time of verification.
+	LastHash string `json:"last_hash,omitempty"`
+	// FirstInvalidSeq and Problem describe the first break in the chain.
+	FirstInvalidSeq int64  `json:"first_invalid_seq,omitempty"`
+	Problem         string `json:"problem,omitempty"`
+}
+
+// Verify walks the whole log in order and checks that the sequence has no
+// gaps, that every entry links to the one before it and that every hash
+// matches the entry's content. It stops at the first problem.
+func Verify(db *gorm.DB) (Result, error) {
+	res := Result{Valid: true}
+	prevHash := GenesisHash
+	var prevSeq int64
+
+	for {
+		var batch []models.AuditLogEntry
+		if err := db.Where("seq > ?", prevSeq).Order("seq").Limit(verifyBatchSize).Find(&batch).Error; err != nil {
+			return res, err
+		}
+		for _, e := range batch {
+			var problem string
+			switch {
+			case e.Seq != prevSeq+1:
+				problem = fmt.Sprintf("entries %d to %d are missing", prevSeq+1, e.Seq-1)
+			case e.PrevHash != prevHash:
+				problem = "previous hash doesn't match the preceding entry"
+			case e.Hash != Hash(e):
+				problem = "hash doesn't match the entry's content"
+			}
+			if problem != "" {
+				res.Valid = false
+				res.FirstInvalidSeq = e.Seq
+				res.Problem = problem
+				return res, nil
+			}
+
+			res.Entries++
+			res.LastHash = e.Hash
+			prevSeq, prevHash = e.Seq, e.Hash
+		}
+		if len(batch) < verifyBatchSize {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/datatypes"
+)
+
+// auditTable answers the statements of Record and Verify like the
+// audit_log_entries table, storing entries as they are inserted.
+type auditTable struct {
+	mu      sync.Mutex
+	entries []models.AuditLogEntry
+}
+
+var auditColumns = []string{"seq", "actor_id", "action", "target_type", "target_id", "details", "created_at", "prev_hash", "hash"}
+
+func (a *auditTable) handle(query string, args []driver.NamedValue) (dbtest.Result, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_xact_lock"):
+		return dbtest.Result{}, nil
+
+	case strings.HasPrefix(query, `INSERT INTO "audit_log_entries"`):
+		// GORM writes NULL values into the statement instead of passing
+		// them as arguments.
+		columns, placeholders, _ := strings.Cut(query, " VALUES ")
+		columns = columns[strings.Index(columns, "(")+1 : strings.Index(columns, ")")]
+		placeholders = placeholders[strings.Index(placeholders, "(")+1 : strings.Index(placeholders, ")")]
+		values := map[string]driver.Value{}
+		for i, p := range strings.Split(placeholders, ",") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(p, "$")); err == nil {
+				values[strings.Trim(strings.Split(columns, ",")[i], `"`)] = args[n-1].Value
+			}
+		}
+		e := models.AuditLogEntry{
+			Seq:        values["seq"].(int64),
+			Action:     values["action"].(string),
+			TargetType: values["target_type"].(string),
+			TargetID:   values["target_id"].(string),
+			CreatedAt:  values["created_at"].(time.Time),
+			PrevHash:   values["prev_hash"].(string),
+			Hash:       values["hash"].(string),
+		}
+		if actor, ok := values["actor_id"].(string); ok {
+			id := uuid.MustParse(actor)
+			e.ActorID = &id
+		}
+		if details, ok := values["details"].(string); ok {
+			e.Details = datatypes.JSON(details)
+		}
+		a.entries = append(a.entries, e)
+		return dbtest.Result{RowsAffected: 1}, nil
+
+	case strings.HasPrefix(query, `SELECT * FROM "audit_log_entries" ORDER BY seq DESC`):
+		if len(a.entries) == 0 {
+			return dbtest.Result{Columns: auditColumns}, nil
+		}
+		return dbtest.Result{Columns: auditColumns, Rows: [][]driver.Value{auditRow(a.entries[len(a.entries)-1])}}, nil
+
+	case strings.HasPrefix(query, `SELECT * FROM "audit_log_entries" WHERE seq >`):
+		after := args[0].Value.(int64)
+		res := dbtest.Result{Columns: auditColumns}
+		for _, e := range a.entries {
+			if e.Seq > after {
+				res.Rows = append(res.Rows, auditRow(e))
+			}
+		}
+		return res, nil
+	}
+	return dbtest.Result{}, errors.New("unexpected statement: " + query)
+}
+
+// auditRow returns an entry as Postgres sends it back.
+func auditRow(e models.AuditLogEntry) []driver.Value {
+	var actor, details driver.Value
+	if e.ActorID != nil {
+		actor = e.ActorID.String()
+	}
+	if e.Details != nil {
+		details = []byte(e.Details)
+	}
+	return []driver.Value{e.Seq, actor, e.Action, e.TargetType, e.TargetID, details, e.CreatedAt, e.PrevHash, e.Hash}
+}
+
+// recordChain records entries with and without actors and details and
+// returns the table holding them.
+func recordChain(t *testing.T) *auditTable {
+	t.Helper()
+	table := &auditTable{}
+	db := dbtest.Open(t, table.handle)
+	actor := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+
+	entries := []Entry{
+		{ActorID: &actor, Action: models.AuditAPIKeyCreated, TargetType: "api_key", TargetID: "1", Details: map[string]string{"name": "ci"}},
+		{Action: models.AuditScanDeleted, TargetType: "scan", TargetID: "2"},
+		{ActorID: &actor, Action: models.AuditAPIKeyRevoked, TargetType: "api_key", TargetID: "1", Details: map[string]string{"name": "ci"}},
+		{ActorID: &actor, Action: models.AuditSessionRevoked, TargetType: "session", TargetID: "3", Details: map[string]interface{}{"reason": "logout", "count": 2}},
+	}
+	for _, e := range entries {
+		if err := Record(db, e); err != nil {
+			t.Fatalf("Record(%s) error = %v", e.Action, err)
+		}
+	}
+	return table
+}
+
+func TestRecordChainsEntries(t *testing.T) {
+	table := recordChain(t)
+
+	prev := GenesisHash
+	for i, e := range table.entries {
+		if e.Seq != int64(i+1) {
+			t.Errorf("entry %d has seq %d", i, e.Seq)
+		}
+		if e.PrevHash != prev {
+			t.Errorf("entry %d links to %s, want %s", e.Seq, e.PrevHash, prev)
+		}
+		if e.Hash != Hash(e) {
+			t.Errorf("entry %d stores hash %s, want %s", e.Seq, e.Hash, Hash(e))
+		}
+		prev = e.Hash
+	}
+
+	res, err := Verify(dbtest.Open(t, table.handle))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !res.Valid || res.Entries != int64(len(table.entries)) || res.LastHash != prev {
+		t.Errorf("Verify() = %+v, want a valid chain of %d entries ending in %s", res, len(table.entries), prev)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(entries []models.AuditLogEntry) []models.AuditLogEntry
+		wantSeq     int64
+		wantProblem string
+	}{
+		{
+			name: "edited action",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries[1].Action = models.AuditAPIKeyCreated
+				return entries
+			},
+			wantSeq:     2,
+			wantProblem: "hash doesn't match",
+		},
+		{
+			name: "edited details",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries[2].Details = datatypes.JSON(`{"name":"deploy"}`)
+				return entries
+			},
+			wantSeq:     3,
+			wantProblem: "hash doesn't match",
+		},
+		{
+			name: "actor removed",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries[0].ActorID = nil
+				return entries
+			},
+			wantSeq:     1,
+			wantProblem: "hash doesn't match",
+		},
+		{
+			name: "backdated",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries[3].CreatedAt = entries[3].CreatedAt.Add(-time.Hour)
+				return entries
+			},
+			wantSeq:     4,
+			wantProblem: "hash doesn't match",
+		},
+		{
+			name: "edited and rehashed",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries[1].TargetID = "7"
+				entries[1].Hash = Hash(entries[1])
+				return entries
+			},
+			wantSeq:     3,
+			wantProblem: "previous hash",
+		},
+		{
+			name: "deleted",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				return append(entries[:1], entries[2:]...)
+			},
+			wantSeq:     3,
+			wantProblem: "entries 2 to 2 are missing",
+		},
+		{
+			name: "deleted and renumbered",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				entries = append(entries[:1], entries[2:]...)
+				for i := range entries {
+					entries[i].Seq = int64(i + 1)
+				}
+				return entries
+			},
+			wantSeq:     2,
+			wantProblem: "previous hash",
+		},
+		{
+			name: "inserted",
+			tamper: func(entries []models.AuditLogEntry) []models.AuditLogEntry {
+				forged := entries[1]
+				forged.Seq, forged.PrevHash = 2, entries[0].Hash
+				forged.Hash = Hash(forged)
+				entries = append(entries[:1], append([]models.AuditLogEntry{forged}, entries[1:]...)...)
+				for i := 2; i < len(entries); i++ {
+					entries[i].Seq++
+				}
+				return entries
+			},
+			wantSeq:     3,
+			wantProblem: "previous hash",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := recordChain(t)
+			table.entries = tt.tamper(table.entries)
+
+			res, err := Verify(dbtest.Open(t, table.handle))
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if res.Valid {
+				t.Fatalf("Verify() accepted the tampered chain")
+			}
+			if res.FirstInvalidSeq != tt.wantSeq || !strings.Contains(res.Problem, tt.wantProblem) {
+				t.Errorf("Verify() = entry %d: %q, want entry %d: %q", res.FirstInvalidSeq, res.Problem, tt.wantSeq, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestHashCoversEveryField(t *testing.T) {
+	actor := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	base := models.AuditLogEntry{
+		Seq:        5,
+		ActorID:    &actor,
+		Action:     models.AuditAPIKeyCreated,
+		TargetType: "api_key",
+		TargetID:   "1",
+		Details:    datatypes.JSON(`{"name":"ci"}`),
+		CreatedAt:  time.Date(2025, 6, 1, 12, 0, 0, 123456000, time.UTC),
+		PrevHash:   GenesisHash,
+	}
+	otherActor := uuid.MustParse("0190a3b2-9d8e-7f6a-8b5c-4d3e2f1a0b9c")
+
+	tests := []struct {
+		name   string
+		change func(e *models.AuditLogEntry)
+	}{
+		{"seq", func(e *models.AuditLogEntry) { e.Seq++ }},
+		{"actor", func(e *models.AuditLogEntry) { e.ActorID = &otherActor }},
+		{"no actor", func(e *models.AuditLogEntry) { e.ActorID = nil }},
+		{"action", func(e *models.AuditLogEntry) { e.Action = models.AuditAPIKeyRevoked }},
+		{"target type", func(e *models.AuditLogEntry) { e.TargetType = "scan" }},
+		{"target ID", func(e *models.AuditLogEntry) { e.TargetID = "2" }},
+		{"details", func(e *models.AuditLogEntry) { e.Details = datatypes.JSON(`{"name":"cd"}`) }},
+		{"created at", func(e *models.AuditLogEntry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) }},
+		{"previous hash", func(e *models.AuditLogEntry) { e.PrevHash = strings.Repeat("f", 64) }},
+	}
+	want := Hash(base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := base
+			tt.change(&e)
+			if Hash(e) == want {
+				t.Errorf("changing the %s doesn't change the hash", tt.name)
+			}
+		})
+	}
+
+	// The stored hash doesn't take part, and time zones don't matter.
+	e := base
+	e.Hash = "anything"
+	e.CreatedAt = e.CreatedAt.In(time.FixedZone("CEST", 2*60*60))
+	if Hash(e) != want {
+		t.Errorf("Hash depends on the stored hash or the time zone")
+	}
+}
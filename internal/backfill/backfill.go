@@ -0,0 +1,240 @@
+// Package backfill recomputes derived data of historical rows, such as
+// scores and severity ranks, whenever a derived field is introduced or its
+// computation changes.
+//
+// A task walks its table in primary key order, one batch per transaction.
+// After every batch the cursor is stored as a BackfillCheckpoint, so an
+// interrupted run resumes where it stopped and a completed task isn't
+// repeated unless it is restarted. Runs can be rate limited to keep the
+// load on a production database low.
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/scoring"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBatchSize is the number of rows processed per batch.
+const DefaultBatchSize = 500
+
+// ErrUnknownTask is returned by Find for a task that doesn't exist.
+var ErrUnknownTask = errors.New("unknown backfill task")
+
+// batchFunc processes up to limit rows after cursor (empty for the first
+// batch). It returns the cursor of the last row it saw and how many rows
+// it processed and failed to process; no rows means the task is done.
+type batchFunc func(db *gorm.DB, cursor string, limit int) (next string, processed, failed int, err error)
+
+// Task is a named backfill.
+type Task struct {
+	Name        string
+	Description string
+	batch       batchFunc
+}
+
+// Options control a run of a task.
+type Options struct {
+	BatchSize int
+	// RowsPerSecond limits the processing rate; 0 means no limit.
+	RowsPerSecond float64
+	// Restart discards the task's checkpoint and starts from the first row.
+	Restart bool
+}
+
+// Tasks returns the available tasks in name order. categories maps tests
+// to their scoring category (see handlers.TestCategories).
+func Tasks(categories map[string]string) []Task {
+	tasks := []Task{
+		{
+			Name:        "severity-ranks",
+			Description: "Recompute the severity rank of every scan result",
+			batch:       severityRanks,
+		},
+		{
+			Name:        "scan-scores",
+			Description: "Rescore completed free scans with the current scoring policy",
+			batch:       scores(&models.Scan{}, false, categories),
+		},
+		{
+			Name:        "premium-scan-scores",
+			Description: "Rescore completed premium scans with their owners' current scoring policies",
+			batch:       scores(&models.PremiumScan{}, true, categories),
+		},
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+// Find returns the task with the given name.
+func Find(name string, categories map[string]string) (Task, error) {
+	for _, t := range Tasks(categories) {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Task{}, fmt.Errorf("%w: %q", ErrUnknownTask, name)
+}
+
+// Run runs task from its checkpoint until every row is processed or ctx is
+// cancelled, and returns the final checkpoint. A task that already
+// completed returns at once unless opts.Restart is set.
+func Run(ctx context.Context, db *gorm.DB, task Task, opts Options) (models.BackfillCheckpoint, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	db = db.WithContext(ctx)
+
+	cp := models.BackfillCheckpoint{Task: task.Name, StartedAt: time.Now()}
+	if opts.Restart {
+		if err := db.Save(&cp).Error; err != nil {
+			return cp, err
+		}
+	} else {
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&cp).Error
+		if err == nil {
+			err = db.First(&cp, "task = ?", task.Name).Error
+		}
+		if err != nil {
+			return cp, err
+		}
+		if cp.CompletedAt != nil {
+			slog.InfoContext(ctx, "Backfill task already completed", "task", task.Name, "completed_at", cp.CompletedAt)
+			return cp, nil
+		}
+	}
+	if cp.Cursor != "" {
+		slog.InfoContext(ctx, "Resuming backfill task", "task", task.Name, "cursor", cp.Cursor, "processed", cp.Processed)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return cp, err
+		}
+		batchStart := time.Now()
+		next, processed, failed, err := task.batch(db, cp.Cursor, opts.BatchSize)
+		if err != nil {
+			return cp, fmt.Errorf("batch after %q: %w", cp.Cursor, err)
+		}
+		if processed == 0 {
+			break
+		}
+
+		cp.Cursor = next
+		cp.Processed += int64(processed)
+		cp.Failed += int64(failed)
+		if err := db.Save(&cp).Error; err != nil {
+			return cp, err
+		}
+		slog.InfoContext(ctx, "Backfill batch done", "task", task.Name, "cursor", cp.Cursor, "processed", cp.Processed, "failed", cp.Failed)
+
+		if opts.RowsPerSecond > 0 {
+			minDuration := time.Duration(float64(processed) / opts.RowsPerSecond * float64(time.Second))
+			if wait := minDuration - time.Since(batchStart); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return cp, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	cp.CompletedAt = &now
+	if err := db.Save(&cp).Error; err != nil {
+		return cp, err
+	}
+	slog.InfoContext(ctx, "Backfill task completed", "task", task.Name, "processed", cp.Processed, "failed", cp.Failed)
+	return cp, nil
+}
+
+// severityRanks sets the severity rank of results, including deleted ones,
+// from their severity.
+func severityRanks(db *gorm.DB, cursor string, limit int) (string, int, int, error) {
+	var after uint64
+	if cursor != "" {
+		n, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid cursor: %w", err)
+		}
+		after = n
+	}
+
+	var results []models.ScanResult
+	if err := db.Unscoped().Select("id", "severity", "severity_rank").
+		Where("id > ?", after).Order("id").Limit(limit).
+		Find(&results).Error; err != nil {
+		return "", 0, 0, err
+	}
+	if len(results) == 0 {
+		return cursor, 0, 0, nil
+	}
+
+	byRank := map[int][]uint{}
+	for _, r := range results {
+		if rank := models.SeverityRank(r.Severity); rank != r.SeverityRank {
+			byRank[rank] = append(byRank[rank], r.ID)
+		}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for rank, ids := range byRank {
+			if err := tx.Unscoped().Model(&models.ScanResult{}).Where("id IN ?", ids).
+				Update("severity_rank", rank).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return strconv.FormatUint(uint64(results[len(results)-1].ID), 10), len(results), 0, nil
+}
+
+// scores rescores the completed scans of one table, each in its own
+// transaction like a recalculation job does. Scans that fail are logged
+// and counted, and don't stop the task.
+func scores(model interface{}, isPremium bool, categories map[string]string) batchFunc {
+	return func(db *gorm.DB, cursor string, limit int) (string, int, int, error) {
+		after := uuid.Nil
+		if cursor != "" {
+			id, err := uuid.Parse(cursor)
+			if err != nil {
+				return "", 0, 0, fmt.Errorf("invalid cursor: %w", err)
+			}
+			after = id
+		}
+
+		var ids []uuid.UUID
+		if err := db.Model(model).Where("status = ? AND id > ?", "COMPLETED", after).
+			Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return "", 0, 0, err
+		}
+		if len(ids) == 0 {
+			return cursor, 0, 0, nil
+		}
+
+		failed := 0
+		for _, id := range ids {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return scoring.ScoreScan(tx, id, isPremium, categories)
+			})
+			if err != nil {
+				slog.Error("Failed to rescore scan", "scan_id", id, "error", err)
+				failed++
+			}
+		}
+		return ids[len(ids)-1].String(), len(ids), failed, nil
+	}
+}
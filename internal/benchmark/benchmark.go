@@ -0,0 +1,131 @@
+// Package benchmark aggregates anonymized pass rates per test across the
+// platform, so that a scan can be compared with the sites scanned before
+// it.
+//
+// A site is a distinct target URL and counts with its latest completed
+// scan, free or premium. Only aggregates are stored, and a figure is only
+// published when it covers at least MinSites sites, so no individual site
+// can be inferred from it (k-anonymity).
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MinSites is the k-anonymity threshold: the fewest sites an aggregate
+// must cover to be published.
+const MinSites = 10
+
+// aggregateInterval is how often the benchmark is recomputed.
+const aggregateInterval = time.Hour
+
+// latestScans selects the ID and score of the latest completed scan of
+// every site. Scans anonymized by the retention purge have no site.
+const latestScans = `
+SELECT DISTINCT ON (site) id, score FROM (
+	SELECT id, score, completed_at, LOWER(RTRIM(target_url, '/')) AS site FROM scans
+	WHERE status = 'COMPLETED' AND completed_at IS NOT NULL AND target_url <> ''
+	UNION ALL
+	SELECT id, score, completed_at, LOWER(RTRIM(target_url, '/')) AS site FROM premium_scans
+	WHERE status = 'COMPLETED' AND completed_at IS NOT NULL AND target_url <> '' AND deleted_at IS NULL
+) s
+ORDER BY site, completed_at DESC`
+
+// testRates counts per test the sites that ran it and the sites that
+// passed it; a site passes a test if all of its results for it passed.
+const testRates = `
+WITH latest AS (` + latestScans + `)
+SELECT test_name, COUNT(*) AS sites, COUNT(*) FILTER (WHERE passed) AS passing FROM (
+	SELECT r.scan_id, LOWER(r.test_name) AS test_name, BOOL_AND(r.passed) AS passed
+	FROM scan_results r JOIN latest ON latest.id = r.scan_id
+	GROUP BY r.scan_id, LOWER(r.test_name)
+) t
+GROUP BY test_name
+HAVING COUNT(*) >= ?`
+
+const scoreDistribution = `
+WITH latest AS (` + latestScans + `)
+SELECT COUNT(*) AS sites,
+	COALESCE(PERCENTILE_CONT(0.25) WITHIN GROUP (ORDER BY score), 0) AS p25,
+	COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY score), 0) AS median,
+	COALESCE(PERCENTILE_CONT(0.75) WITHIN GROUP (ORDER BY score), 0) AS p75
+FROM latest WHERE score IS NOT NULL`
+
+// Aggregator periodically recomputes the benchmark.
+type Aggregator struct {
+	db *gorm.DB
+}
+
+func NewAggregator(db *gorm.DB) *Aggregator {
+	return &Aggregator{db: db}
+}
+
+// Run aggregates once immediately and then every hour until ctx is
+// cancelled.
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(aggregateInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Aggregate(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Benchmark aggregation failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Aggregate recomputes the benchmark and replaces the stored one.
+func (a *Aggregator) Aggregate(ctx context.Context) error {
+	db := a.db.WithContext(ctx)
+	now := time.Now()
+
+	var rates []models.TestBenchmark
+	if err := db.Raw(testRates, MinSites).Scan(&rates).Error; err != nil {
+		return err
+	}
+	for i := range rates {
+		rates[i].PassRate = float64(rates[i].Passing) / float64(rates[i].Sites)
+		rates[i].ComputedAt = now
+	}
+
+	score := models.ScoreBenchmark{ID: 1}
+	if err := db.Raw(scoreDistribution).Scan(&score).Error; err != nil {
+		return err
+	}
+	score.ID = 1
+	score.ComputedAt = now
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx = tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		if err := tx.Delete(&models.TestBenchmark{}).Error; err != nil {
+			return err
+		}
+		if len(rates) > 0 {
+			if err := tx.Create(&rates).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.ScoreBenchmark{}).Error; err != nil {
+			return err
+		}
+		if score.Sites < MinSites {
+			return nil
+		}
+		return tx.Create(&score).Error
+	})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Benchmark aggregated", "tests", len(rates), "scored_sites", score.Sites)
+	return nil
+}
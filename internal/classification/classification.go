@@ -0,0 +1,175 @@
+// Package classification applies the data classification labels users and
+// organizations put on the findings of individual tests.
+//
+// Confidential findings stay visible to their owner in the API, but never
+// leave it through a channel that wasn't cleared for them. Every path that
+// sends findings out of the API (reports, exports, webhooks, polling
+// triggers, push notifications, Slack summaries, pull request checks)
+// passes them through an Outbound for its Channel, so the rule is applied
+// in one place: exports and webhooks can be cleared for confidential
+// findings explicitly, the other channels never are.
+package classification
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Classification labels, from least to most restricted.
+const (
+	Public       = "public"
+	Internal     = "internal"
+	Confidential = "confidential"
+)
+
+// Labels lists the supported labels.
+var Labels = []string{Public, Internal, Confidential}
+
+// Policy maps lowercase test names to their labels.
+type Policy map[string]string
+
+// Load returns the classification policy of the user's findings: the
+// user's own labels and those of the organizations the user is a member
+// of, which the user's scans may be shared with. A test labelled more than
+// once takes its most restricted label.
+func Load(db *gorm.DB, userID uuid.UUID) (Policy, error) {
+	var labels []models.DataClassification
+	if err := db.Where("user_id = ?", userID).Find(&labels).Error; err != nil {
+		return nil, err
+	}
+	var orgLabels []models.OrganizationClassification
+	memberships := db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).
+		Select("organization_id").Where("user_id = ?", userID)
+	if err := db.Where("organization_id IN (?)", memberships).Find(&orgLabels).Error; err != nil {
+		return nil, err
+	}
+
+	p := make(Policy, len(labels)+len(orgLabels))
+	for _, l := range labels {
+		p.restrict(l.TestName, l.Label)
+	}
+	for _, l := range orgLabels {
+		p.restrict(l.TestName, l.Label)
+	}
+	return p, nil
+}
+
+// restrict labels a test, unless it already has a more restricted label.
+func (p Policy) restrict(test, label string) {
+	if slices.Index(Labels, label) > slices.Index(Labels, p.Label(test)) {
+		p[strings.ToLower(test)] = label
+	}
+}
+
+// Label returns the label of a test's findings.
+func (p Policy) Label(test string) string {
+	if label, ok := p[strings.ToLower(test)]; ok {
+		return label
+	}
+	return Public
+}
+
+// Confidential reports whether a test's findings are confidential.
+func (p Policy) Confidential(test string) bool {
+	return p.Label(test) == Confidential
+}
+
+// confidentialTests returns the lowercase names of the confidential tests,
+// sorted.
+func (p Policy) confidentialTests() []string {
+	tests := make([]string, 0)
+	for test, label := range p {
+		if label == Confidential {
+			tests = append(tests, test)
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+// Channel is a way findings leave the API.
+type Channel string
+
+// Channels of findings.
+const (
+	// ChannelReport covers rendered reports and executive summaries,
+	// which are shared through download links.
+	ChannelReport Channel = "report"
+	// ChannelExport covers CSV and PDF exports of a scan.
+	ChannelExport      Channel = "export"
+	ChannelWebhook     Channel = "webhook"
+	ChannelTrigger     Channel = "trigger"
+	ChannelPush        Channel = "push"
+	ChannelSlack       Channel = "slack"
+	ChannelPullRequest Channel = "pull_request"
+)
+
+// clearable lists the channels that can be cleared for confidential
+// findings: an export requested with include_confidential, a webhook that
+// allows confidential data.
+var clearable = map[Channel]bool{ChannelExport: true, ChannelWebhook: true}
+
+// Outbound decides which findings of one owner may be sent through one
+// channel.
+type Outbound struct {
+	policy  Policy
+	channel Channel
+	cleared bool
+}
+
+// Outbound returns the gate of the policy's findings for a channel.
+// cleared is ignored for channels that can't be cleared.
+func (p Policy) Outbound(channel Channel, cleared bool) Outbound {
+	return Outbound{policy: p, channel: channel, cleared: cleared && clearable[channel]}
+}
+
+// For loads the owner's policy and returns its gate for a channel.
+func For(db *gorm.DB, ownerID uuid.UUID, channel Channel, cleared bool) (Outbound, error) {
+	p, err := Load(db, ownerID)
+	if err != nil {
+		return Outbound{}, err
+	}
+	return p.Outbound(channel, cleared), nil
+}
+
+// Discloses reports whether a test's findings may be sent.
+func (o Outbound) Discloses(test string) bool {
+	return o.cleared || !o.policy.Confidential(test)
+}
+
+// Withheld returns the lowercase names of the tests whose findings are
+// withheld, sorted.
+func (o Outbound) Withheld() []string {
+	if o.cleared {
+		return []string{}
+	}
+	return o.policy.confidentialTests()
+}
+
+// Results returns the results that may be sent.
+func (o Outbound) Results(results []models.ScanResult) []models.ScanResult {
+	if o.cleared {
+		return results
+	}
+	kept := make([]models.ScanResult, 0, len(results))
+	for _, r := range results {
+		if o.Discloses(r.TestName) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Scope restricts a query to the findings that may be sent; testColumn is
+// the column holding the test name, e.g. "scan_results.test_name".
+func (o Outbound) Scope(query *gorm.DB, testColumn string) *gorm.DB {
+	if withheld := o.Withheld(); len(withheld) > 0 {
+		query = query.Where("LOWER("+testColumn+") NOT IN ?", withheld)
+	}
+	return query
+}
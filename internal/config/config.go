@@ -0,0 +1,810 @@
+// Package config loads the settings of the API server from the environment
+// once at startup and validates them, so that a misconfigured server fails
+// to start with a clear message instead of failing requests later.
+package config
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prawo-i-piesc/backend/internal/github"
+	"github.com/prawo-i-piesc/backend/internal/push"
+	"github.com/prawo-i-piesc/backend/internal/queue"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+	"github.com/prawo-i-piesc/backend/internal/ratelimit"
+	"github.com/prawo-i-piesc/backend/internal/sealedclaims"
+	"github.com/prawo-i-piesc/backend/internal/slack"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Defaults of optional settings.
+const (
+	DefaultPort        = 4000
+	DefaultBcryptCost  = 12
+	DefaultFrontendURL = "http://localhost:3000"
+	DefaultSMTPPort    = "587"
+	DefaultStorageDir  = "./data/files"
+
+	DefaultScanMaxAttempts      = 5
+	DefaultResultMaxAttempts    = 5
+	DefaultScanHeartbeatTimeout = 5 * time.Minute
+	DefaultScanReuseWindow      = 10 * time.Minute
+	DefaultFixVerificationDelay = time.Hour
+	DefaultScanBatchMaxTargets  = 50
+	DefaultNotificationWindow   = 30 * time.Second
+	DefaultMockWorkerDelay      = 500 * time.Millisecond
+	DefaultQueueWorkers         = 4
+
+	DefaultDBMaxOpenConns     = 25
+	DefaultDBMaxIdleConns     = 10
+	DefaultDBConnMaxLifetime  = 30 * time.Minute
+	DefaultDBStatementTimeout = time.Minute
+)
+
+// Default bulkheads; see BulkheadConfig.
+var (
+	DefaultSubmissionLimits = RouteLimits{MaxConcurrent: 100, Timeout: 15 * time.Second}
+	DefaultExportLimits     = RouteLimits{MaxConcurrent: 8, Timeout: 2 * time.Minute}
+	DefaultAnalyticsLimits  = RouteLimits{MaxConcurrent: 16, Timeout: 30 * time.Second}
+)
+
+// Queue drivers.
+const (
+	QueueRabbitMQ = "rabbitmq"
+	QueueMemory   = "memory"
+)
+
+// Storage drivers.
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Retention modes.
+const (
+	RetentionDelete    = "delete"
+	RetentionAnonymize = "anonymize"
+)
+
+// What happens on a login from a device or location none of the user's
+// earlier sessions had.
+const (
+	NewDeviceLoginConfirm = "confirm"
+	NewDeviceLoginNotify  = "notify"
+)
+
+// DefaultRetentionBatchSize is how many scans are purged per transaction.
+const DefaultRetentionBatchSize = 200
+
+// DefaultStorageGracePeriod is how long an organization may stay over its
+// storage plan before its oldest scans are purged.
+const DefaultStorageGracePeriod = 7 * 24 * time.Hour
+
+// Config holds the settings of the API server.
+type Config struct {
+	Database DatabaseConfig
+	// QueueDriver is QueueRabbitMQ, or QueueMemory to keep the queues in
+	// the API process (see queue.Memory). No external worker can reach
+	// such a queue, so the API then runs the scans itself.
+	QueueDriver string
+	// RabbitMQURL is required with QueueRabbitMQ.
+	RabbitMQURL string
+	// QueueWorkers is how many scans the API runs at once with
+	// QueueMemory.
+	QueueWorkers int
+	// Port is the port the HTTP server listens on.
+	Port int
+
+	// JWTSecret signs session tokens.
+	JWTSecret string
+	// JWTClaimsKey encrypts the sensitive claims of session tokens; nil
+	// leaves them readable.
+	JWTClaimsKey sealedclaims.Key
+	// NewDeviceLogins is NewDeviceLoginConfirm to hold logins from new
+	// devices until a code emailed to the user is entered, or
+	// NewDeviceLoginNotify to only email the user about them.
+	NewDeviceLogins string
+	// GeoCountryHeader names a request header in which one of
+	// TrustedProxies passes the client's country; without it the location
+	// of a login is its IP network.
+	GeoCountryHeader string
+	// TrustedProxies lists the addresses and networks of the reverse
+	// proxies whose X-Forwarded-For header gives the client IP. Empty
+	// trusts none: the client IP is the address the request came from.
+	TrustedProxies []string
+	// BcryptCost is the work factor of new password hashes.
+	BcryptCost int
+	// CORS holds the cross-origin policies of the route groups.
+	CORS CORSConfig
+	// FrontendURL is the base of links to the frontend sent by email.
+	FrontendURL string
+	// ScanMaxAttempts is how often workers may reject a scan task before
+	// it is dead-lettered and the scan fails.
+	ScanMaxAttempts int
+	// ResultMaxAttempts is how often a result message from results_queue
+	// is retried after failing to be saved before it is dead-lettered.
+	ResultMaxAttempts int
+	// QueuePrefetch tunes the prefetch of the consumers that write to the
+	// database (see queue.AdaptivePrefetch).
+	QueuePrefetch queue.AdaptivePrefetchConfig
+	// ScanHeartbeatTimeout is how long a running scan whose worker sends
+	// heartbeats may go without one before it is failed.
+	ScanHeartbeatTimeout time.Duration
+	// ScanReuseWindow is how recently a scan of the same target must have
+	// completed for a submission with reuse_recent to return it instead of
+	// queueing a new one. Zero disables reuse.
+	ScanReuseWindow time.Duration
+	// FixVerificationDelay is how long after a finding is marked fixed a
+	// scan is started to verify the fix.
+	FixVerificationDelay time.Duration
+	// ScanBatchMaxTargets is how many targets one batch submission may
+	// scan.
+	ScanBatchMaxTargets int
+	// ScanQuota caps the premium scans each user may submit per day and
+	// month; zero limits are unlimited.
+	ScanQuota quota.Limits
+	// RequireVerifiedTargets refuses premium scans of hosts not covered by
+	// one of the user's verified targets.
+	RequireVerifiedTargets bool
+	// RequireVerifiedIntrusiveScans refuses scans that run more than the
+	// quick profile of hosts not covered by a verified target, and limits
+	// free scans to the quick profile.
+	RequireVerifiedIntrusiveScans bool
+
+	// WorkerSigningSecret is the key of signed worker submissions; empty
+	// disables replay protection.
+	WorkerSigningSecret string
+	UploadTokenSecret   string
+	UploadTokenTTL      time.Duration
+
+	SMTP      SMTPConfig
+	Storage   StorageConfig
+	Bulkheads BulkheadConfig
+	Retention RetentionConfig
+	// OrgStorage caps the data stored for organizations.
+	OrgStorage OrgStorageConfig
+	// GitHub is the GitHub App reporting scans on pull requests.
+	GitHub GitHubConfig
+	// Slack is the Slack app serving the /antiginx slash command.
+	Slack SlackConfig
+	// Push sends push notifications to the devices of the mobile app.
+	Push PushConfig
+	// ScanMetrics bounds the labels of the scan metrics.
+	ScanMetrics ScanMetricsConfig
+	// NotificationWindow is how long notification channels collect events
+	// of one type before sending them as one notification; zero sends
+	// every event at once.
+	NotificationWindow time.Duration
+	// VCSTokenKey encrypts the access tokens of the organizations' GitLab
+	// and Bitbucket integrations; nil disables those integrations.
+	VCSTokenKey sealedclaims.Key
+	// ClamdAddress is the clamd daemon uploaded artifacts are scanned with;
+	// empty disables virus scanning.
+	ClamdAddress string
+	// RateLimits limit the requests per client IP and per user.
+	RateLimits ratelimit.Config
+	// MockWorker answers scans with fabricated results during local
+	// development.
+	MockWorker MockWorkerConfig
+}
+
+// MockWorkerConfig configures the mock worker run by the API server (see
+// package mockworker).
+type MockWorkerConfig struct {
+	Enabled bool
+	// APIURL is the base URL it submits results to; by default the API
+	// server itself.
+	APIURL string
+	// Delay is the pause before each result.
+	Delay time.Duration
+}
+
+// ScanMetricsConfig lists the values the environment and team labels of
+// the scan metrics may take, taken from env:/environment: and team: scan
+// tags. Other values are reported as "other". An empty list admits the
+// first values seen instead, up to a fixed number.
+type ScanMetricsConfig struct {
+	Environments []string
+	Teams        []string
+}
+
+// DatabaseConfig configures the PostgreSQL connection pool.
+type DatabaseConfig struct {
+	URL string
+	// MaxOpenConns bounds the connections open at once, including idle
+	// ones.
+	MaxOpenConns int
+	// MaxIdleConns is how many connections are kept open while idle; at
+	// most MaxOpenConns.
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused before it is
+	// replaced.
+	ConnMaxLifetime time.Duration
+	// StatementTimeout makes the server cancel statements running longer
+	// than this; zero disables the limit.
+	StatementTimeout time.Duration
+}
+
+// RouteLimits isolates a class of routes (see middleware.Bulkhead).
+type RouteLimits struct {
+	// MaxConcurrent caps the requests of the class served at once.
+	MaxConcurrent int
+	// Timeout bounds how long a request of the class may run.
+	Timeout time.Duration
+}
+
+// BulkheadConfig caps each class of expensive routes separately, so that
+// e.g. a flood of report exports can't starve scan submissions.
+type BulkheadConfig struct {
+	// Submissions covers free and premium scan submission.
+	Submissions RouteLimits
+	// Exports covers CSV, PDF and HAR exports and report generation.
+	Exports RouteLimits
+	// Analytics covers dashboards, benchmarks and usage statistics.
+	Analytics RouteLimits
+}
+
+// CORSConfig holds the cross-origin policies of the route groups.
+type CORSConfig struct {
+	// Public applies to the anonymous quick-scan endpoints: free scans,
+	// health, remediation content and signed file downloads.
+	Public CORSPolicy
+	// API applies to the authentication endpoints and the authenticated
+	// user and admin API.
+	API CORSPolicy
+}
+
+// CORSPolicy is the cross-origin policy of a group of routes.
+type CORSPolicy struct {
+	// Origins lists the origins allowed to call the routes. Empty allows
+	// any origin, without credentials.
+	Origins []string
+	// Credentials lets browsers send credentials, such as the
+	// Authorization header, with cross-origin requests from Origins.
+	Credentials bool
+}
+
+// RetentionConfig configures the purge of old scans (see package
+// retention).
+type RetentionConfig struct {
+	// Period is how long finished scans are kept; zero keeps them forever.
+	Period time.Duration
+	// Mode is RetentionDelete, which removes expired scans with their
+	// results, or RetentionAnonymize, which keeps scores and test outcomes
+	// but strips targets, messages and evidence.
+	Mode string
+	// BatchSize is how many scans are purged per transaction.
+	BatchSize int
+}
+
+// OrgStorageConfig configures the storage plans of organizations (see
+// package orgstorage).
+type OrgStorageConfig struct {
+	// Plans are the storage plans by name.
+	Plans map[string]StoragePlan
+	// DefaultPlan applies to organizations without a plan of their own;
+	// empty leaves them unlimited.
+	DefaultPlan string
+	// GracePeriod is how long an organization may stay over its plan
+	// before its oldest finished scans are purged.
+	GracePeriod time.Duration
+}
+
+// StoragePlan caps the data stored for an organization's scans. Zero means
+// unlimited.
+type StoragePlan struct {
+	// Results is the number of stored test results.
+	Results int64
+	// ArtifactBytes is the total size of stored artifacts.
+	ArtifactBytes int64
+}
+
+// GitHubConfig configures the GitHub App that reports scans run for pull
+// requests (see package prchecks). A zero AppID disables it.
+type GitHubConfig struct {
+	AppID      int64
+	PrivateKey *rsa.PrivateKey
+	APIURL     string
+}
+
+// SlackConfig configures the Slack app serving the /antiginx slash command
+// (see package slack). An empty SigningSecret disables it.
+type SlackConfig struct {
+	// SigningSecret verifies that command requests come from Slack.
+	SigningSecret string
+	// BotToken posts the summaries of finished scans.
+	BotToken string
+	APIURL   string
+}
+
+// PushConfig configures the push notifications of the mobile app (see
+// package push). A nil FCM disables them on Android and a nil APNs on iOS.
+type PushConfig struct {
+	FCM    *push.FCMCredentials
+	FCMURL string
+	APNs   *push.APNsCredentials
+	// APNsURL is the production or the sandbox endpoint of APNs.
+	APNsURL string
+}
+
+// SMTPConfig configures outgoing email. Emails are only logged when Host is
+// empty.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// StorageConfig configures the file store of exports and artifacts.
+type StorageConfig struct {
+	// Driver is StorageLocal or StorageS3.
+	Driver string
+
+	// Local storage.
+	Dir           string
+	PublicBaseURL string
+	SigningKey    string
+
+	// S3 storage.
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+}
+
+// Load reads the configuration from the environment. The returned error
+// lists every invalid or missing setting; the Config is returned with
+// defaults filled in even then, so the caller can still log with it.
+func Load() (*Config, error) {
+	l := loader{}
+	prefetch := queue.DefaultAdaptivePrefetchConfig()
+	limits := ratelimit.DefaultConfig()
+	apiOrigins := l.origins("CORS_ORIGINS")
+	cfg := &Config{
+		Database: DatabaseConfig{
+			URL:              l.required("DATABASE_URL"),
+			MaxOpenConns:     l.int("DB_MAX_OPEN_CONNS", DefaultDBMaxOpenConns, 1, 10000),
+			MaxIdleConns:     l.int("DB_MAX_IDLE_CONNS", DefaultDBMaxIdleConns, 0, 10000),
+			ConnMaxLifetime:  l.duration("DB_CONN_MAX_LIFETIME", DefaultDBConnMaxLifetime, time.Second),
+			StatementTimeout: l.duration("DB_STATEMENT_TIMEOUT", DefaultDBStatementTimeout, 0),
+		},
+		QueueDriver:  l.string("QUEUE_DRIVER", QueueRabbitMQ),
+		RabbitMQURL:  os.Getenv("RABBITMQ_URL"),
+		QueueWorkers: l.int("QUEUE_WORKERS", DefaultQueueWorkers, 1, 1000),
+		Port:         l.int("PORT", DefaultPort, 1, 65535),
+
+		JWTSecret:   l.required("JWT_SECRET"),
+		BcryptCost:  l.int("BCRYPT_COST", DefaultBcryptCost, bcrypt.MinCost, bcrypt.MaxCost),
+		FrontendURL: strings.TrimRight(l.url("FRONTEND_URL", DefaultFrontendURL), "/"),
+		CORS: CORSConfig{
+			Public: CORSPolicy{Origins: l.origins("CORS_PUBLIC_ORIGINS")},
+			API:    CORSPolicy{Origins: apiOrigins, Credentials: len(apiOrigins) > 0},
+		},
+
+		NewDeviceLogins:  l.string("NEW_DEVICE_LOGINS", NewDeviceLoginConfirm),
+		GeoCountryHeader: os.Getenv("GEO_COUNTRY_HEADER"),
+		TrustedProxies:   l.networks("TRUSTED_PROXIES"),
+
+		ScanMaxAttempts:   l.int("SCAN_MAX_ATTEMPTS", DefaultScanMaxAttempts, 1, 100),
+		ResultMaxAttempts: l.int("RESULT_MAX_ATTEMPTS", DefaultResultMaxAttempts, 1, 100),
+		QueuePrefetch: queue.AdaptivePrefetchConfig{
+			Min:           l.int("QUEUE_PREFETCH_MIN", prefetch.Min, 1, 10000),
+			Max:           l.int("QUEUE_PREFETCH_MAX", prefetch.Max, 1, 10000),
+			Step:          l.int("QUEUE_PREFETCH_STEP", prefetch.Step, 1, 10000),
+			TargetLatency: l.duration("QUEUE_TARGET_LATENCY", prefetch.TargetLatency, time.Millisecond),
+			DBSaturation:  l.fraction("QUEUE_DB_SATURATION", prefetch.DBSaturation),
+			Interval:      l.duration("QUEUE_PREFETCH_INTERVAL", prefetch.Interval, time.Second),
+		},
+		ScanHeartbeatTimeout:   l.duration("SCAN_HEARTBEAT_TIMEOUT", DefaultScanHeartbeatTimeout, 30*time.Second),
+		ScanReuseWindow:        l.duration("SCAN_REUSE_WINDOW", DefaultScanReuseWindow, 0),
+		FixVerificationDelay:   l.duration("FIX_VERIFICATION_DELAY", DefaultFixVerificationDelay, 0),
+		ScanBatchMaxTargets:    l.int("SCAN_BATCH_MAX_TARGETS", DefaultScanBatchMaxTargets, 1, 1000),
+		RequireVerifiedTargets: l.bool("REQUIRE_VERIFIED_TARGETS"),
+
+		RequireVerifiedIntrusiveScans: l.bool("REQUIRE_VERIFIED_TARGETS_FOR_INTRUSIVE_SCANS"),
+		ScanQuota: quota.Limits{
+			Daily:   l.int("SCAN_QUOTA_DAILY", 0, 0, 1000000),
+			Monthly: l.int("SCAN_QUOTA_MONTHLY", 0, 0, 1000000),
+		},
+
+		WorkerSigningSecret: os.Getenv("WORKER_SIGNING_SECRET"),
+		UploadTokenSecret:   os.Getenv("UPLOAD_TOKEN_SECRET"),
+		UploadTokenTTL:      l.duration("UPLOAD_TOKEN_TTL", workerauth.DefaultUploadTokenTTL, time.Minute),
+
+		SMTP: SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     l.string("SMTP_PORT", DefaultSMTPPort),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		},
+		Storage: StorageConfig{
+			Driver:            l.string("STORAGE_DRIVER", StorageLocal),
+			Dir:               l.string("STORAGE_DIR", DefaultStorageDir),
+			SigningKey:        os.Getenv("STORAGE_SIGNING_KEY"),
+			S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+			S3Region:          os.Getenv("S3_REGION"),
+			S3Bucket:          os.Getenv("S3_BUCKET"),
+			S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		},
+		Bulkheads: BulkheadConfig{
+			Submissions: l.routeLimits("BULKHEAD_SUBMISSIONS", DefaultSubmissionLimits),
+			Exports:     l.routeLimits("BULKHEAD_EXPORTS", DefaultExportLimits),
+			Analytics:   l.routeLimits("BULKHEAD_ANALYTICS", DefaultAnalyticsLimits),
+		},
+		Retention: RetentionConfig{
+			Period:    l.duration("RETENTION_PERIOD", 0, 0),
+			Mode:      l.string("RETENTION_MODE", RetentionDelete),
+			BatchSize: l.int("RETENTION_BATCH_SIZE", DefaultRetentionBatchSize, 1, 10000),
+		},
+		OrgStorage: OrgStorageConfig{
+			Plans:       l.storagePlans("STORAGE_PLANS"),
+			DefaultPlan: os.Getenv("STORAGE_DEFAULT_PLAN"),
+			GracePeriod: l.duration("STORAGE_GRACE_PERIOD", DefaultStorageGracePeriod, 0),
+		},
+		GitHub: GitHubConfig{
+			AppID:  int64(l.int("GITHUB_APP_ID", 0, 0, math.MaxInt32)),
+			APIURL: strings.TrimRight(l.url("GITHUB_API_URL", github.DefaultAPIURL), "/"),
+		},
+		Slack: SlackConfig{
+			SigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+			BotToken:      os.Getenv("SLACK_BOT_TOKEN"),
+			APIURL:        strings.TrimRight(l.url("SLACK_API_URL", slack.DefaultAPIURL), "/"),
+		},
+		Push: PushConfig{
+			FCMURL:  strings.TrimRight(l.url("FCM_API_URL", push.DefaultFCMURL), "/"),
+			APNsURL: push.APNsProductionURL,
+		},
+		ScanMetrics: ScanMetricsConfig{
+			Environments: l.labelValues("SCAN_METRIC_ENVIRONMENTS"),
+			Teams:        l.labelValues("SCAN_METRIC_TEAMS"),
+		},
+		NotificationWindow: l.duration("NOTIFICATION_COALESCE_WINDOW", DefaultNotificationWindow, 0),
+		ClamdAddress:       os.Getenv("CLAMD_ADDRESS"),
+		RateLimits: ratelimit.Config{
+			IP: ratelimit.Rate{
+				PerMinute: l.int("RATE_LIMIT_IP_PER_MINUTE", limits.IP.PerMinute, 1, 1000000),
+				Burst:     l.int("RATE_LIMIT_IP_BURST", limits.IP.Burst, 1, 1000000),
+			},
+			User: ratelimit.Rate{
+				PerMinute: l.int("RATE_LIMIT_USER_PER_MINUTE", limits.User.PerMinute, 1, 1000000),
+				Burst:     l.int("RATE_LIMIT_USER_BURST", limits.User.Burst, 1, 1000000),
+			},
+		},
+		MockWorker: MockWorkerConfig{
+			Enabled: l.bool("MOCK_WORKER"),
+			Delay:   l.duration("MOCK_WORKER_DELAY", DefaultMockWorkerDelay, 0),
+		},
+	}
+	cfg.Storage.PublicBaseURL = strings.TrimRight(l.url("PUBLIC_BASE_URL", "http://localhost:"+strconv.Itoa(cfg.Port)), "/")
+	cfg.MockWorker.APIURL = strings.TrimRight(l.url("MOCK_WORKER_API_URL", "http://localhost:"+strconv.Itoa(cfg.Port)), "/")
+
+	if cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		l.fail("DB_MAX_IDLE_CONNS", "must not exceed DB_MAX_OPEN_CONNS (%d), got %d", cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns)
+	}
+	if cfg.QueuePrefetch.Max < cfg.QueuePrefetch.Min {
+		l.fail("QUEUE_PREFETCH_MAX", "must not be below QUEUE_PREFETCH_MIN (%d), got %d", cfg.QueuePrefetch.Min, cfg.QueuePrefetch.Max)
+	}
+	if raw := os.Getenv("JWT_CLAIMS_ENCRYPTION_KEY"); raw != "" {
+		key, err := sealedclaims.ParseKey(raw)
+		if err != nil {
+			l.fail("JWT_CLAIMS_ENCRYPTION_KEY", "%v", err)
+		}
+		cfg.JWTClaimsKey = key
+	}
+	if raw := os.Getenv("VCS_TOKEN_ENCRYPTION_KEY"); raw != "" {
+		key, err := sealedclaims.ParseKey(raw)
+		if err != nil {
+			l.fail("VCS_TOKEN_ENCRYPTION_KEY", "%v", err)
+		}
+		cfg.VCSTokenKey = key
+	}
+	if cfg.NewDeviceLogins != NewDeviceLoginConfirm && cfg.NewDeviceLogins != NewDeviceLoginNotify {
+		l.fail("NEW_DEVICE_LOGINS", "must be %q or %q, got %q", NewDeviceLoginConfirm, NewDeviceLoginNotify, cfg.NewDeviceLogins)
+	}
+	if cfg.GeoCountryHeader != "" && len(cfg.TrustedProxies) == 0 {
+		l.fail("GEO_COUNTRY_HEADER", "requires TRUSTED_PROXIES: the header is only read from requests of trusted proxies")
+	}
+	if cfg.UploadTokenSecret == "" {
+		cfg.UploadTokenSecret = cfg.JWTSecret
+	}
+	if cfg.Storage.SigningKey == "" {
+		cfg.Storage.SigningKey = cfg.JWTSecret
+	}
+	switch cfg.QueueDriver {
+	case QueueRabbitMQ:
+		if cfg.RabbitMQURL == "" {
+			l.fail("RABBITMQ_URL", "is required when QUEUE_DRIVER is %q", QueueRabbitMQ)
+		}
+	case QueueMemory:
+	default:
+		l.fail("QUEUE_DRIVER", "must be %q or %q, got %q", QueueRabbitMQ, QueueMemory, cfg.QueueDriver)
+	}
+	switch cfg.Storage.Driver {
+	case StorageLocal:
+	case StorageS3:
+		if cfg.Storage.S3Bucket == "" {
+			l.fail("S3_BUCKET", "is required when STORAGE_DRIVER is %q", StorageS3)
+		}
+	default:
+		l.fail("STORAGE_DRIVER", "must be %q or %q, got %q", StorageLocal, StorageS3, cfg.Storage.Driver)
+	}
+	if cfg.Retention.Mode != RetentionDelete && cfg.Retention.Mode != RetentionAnonymize {
+		l.fail("RETENTION_MODE", "must be %q or %q, got %q", RetentionDelete, RetentionAnonymize, cfg.Retention.Mode)
+	}
+	if cfg.Retention.Period > 0 && cfg.Retention.Period < 24*time.Hour {
+		l.fail("RETENTION_PERIOD", "must be 0 or at least 24h, got %s", cfg.Retention.Period)
+	}
+	if cfg.GitHub.AppID != 0 {
+		// The PEM may be given on one line with literal \n separators.
+		raw := strings.ReplaceAll(os.Getenv("GITHUB_APP_PRIVATE_KEY"), `\n`, "\n")
+		if raw == "" {
+			l.fail("GITHUB_APP_PRIVATE_KEY", "is required when GITHUB_APP_ID is set")
+		} else if key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(raw)); err != nil {
+			l.fail("GITHUB_APP_PRIVATE_KEY", "must be the PEM encoded private key of the app: %v", err)
+		} else {
+			cfg.GitHub.PrivateKey = key
+		}
+	}
+	if cfg.Slack.SigningSecret != "" && cfg.Slack.BotToken == "" {
+		l.fail("SLACK_BOT_TOKEN", "is required when SLACK_SIGNING_SECRET is set")
+	}
+	if raw := os.Getenv("FCM_SERVICE_ACCOUNT"); raw != "" {
+		creds, err := push.ParseFCMCredentials([]byte(raw))
+		if err != nil {
+			l.fail("FCM_SERVICE_ACCOUNT", "must be the JSON key file of a Firebase service account: %v", err)
+		} else {
+			cfg.Push.FCM = &creds
+		}
+	}
+	if keyID := os.Getenv("APNS_KEY_ID"); keyID != "" {
+		creds := push.APNsCredentials{
+			KeyID:  keyID,
+			TeamID: os.Getenv("APNS_TEAM_ID"),
+			Topic:  os.Getenv("APNS_TOPIC"),
+		}
+		if creds.TeamID == "" {
+			l.fail("APNS_TEAM_ID", "is required when APNS_KEY_ID is set")
+		}
+		if creds.Topic == "" {
+			l.fail("APNS_TOPIC", "is required when APNS_KEY_ID is set")
+		}
+		raw := strings.ReplaceAll(os.Getenv("APNS_PRIVATE_KEY"), `\n`, "\n")
+		if raw == "" {
+			l.fail("APNS_PRIVATE_KEY", "is required when APNS_KEY_ID is set")
+		} else if key, err := jwt.ParseECPrivateKeyFromPEM([]byte(raw)); err != nil {
+			l.fail("APNS_PRIVATE_KEY", "must be the PEM encoded .p8 key: %v", err)
+		} else {
+			creds.PrivateKey = key
+		}
+		cfg.Push.APNs = &creds
+	}
+	if l.bool("APNS_SANDBOX") {
+		cfg.Push.APNsURL = push.APNsSandboxURL
+	}
+	if plan := cfg.OrgStorage.DefaultPlan; plan != "" {
+		if _, ok := cfg.OrgStorage.Plans[plan]; !ok {
+			l.fail("STORAGE_DEFAULT_PLAN", "must be one of the plans of STORAGE_PLANS, got %q", plan)
+		}
+	}
+
+	return cfg, errors.Join(l.errs...)
+}
+
+// Addr is the listen address of the HTTP server.
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// FrontendLink builds a link to a page of the frontend.
+func (c *Config) FrontendLink(path string) string {
+	return c.FrontendURL + path
+}
+
+// UploadTokens returns the issuer of per-scan upload tokens.
+func (c *Config) UploadTokens() workerauth.UploadTokens {
+	return workerauth.UploadTokens{Secret: c.UploadTokenSecret, TTL: c.UploadTokenTTL}
+}
+
+// IsTrustedProxy reports whether addr, the address of the peer a request
+// came from, is one of TrustedProxies.
+func (c *Config) IsTrustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range c.TrustedProxies {
+		if prefix, err := netip.ParsePrefix(p); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+		} else if proxy, err := netip.ParseAddr(p); err == nil && proxy.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// loader reads environment variables and collects what is wrong with them.
+type loader struct {
+	errs []error
+}
+
+func (l *loader) fail(name, format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf("%s %s", name, fmt.Sprintf(format, args...)))
+}
+
+func (l *loader) required(name string) string {
+	v := os.Getenv(name)
+	if v == "" {
+		l.fail(name, "is required")
+	}
+	return v
+}
+
+func (l *loader) string(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func (l *loader) int(name string, def, min, max int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < min || v > max {
+		l.fail(name, "must be an integer between %d and %d, got %q", min, max, raw)
+		return def
+	}
+	return v
+}
+
+func (l *loader) bool(name string) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.fail(name, "must be true or false, got %q", raw)
+	}
+	return v
+}
+
+func (l *loader) duration(name string, def, min time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil || v < min {
+		l.fail(name, "must be a duration such as 2h or 30s of at least %s, got %q", min, raw)
+		return def
+	}
+	return v
+}
+
+// fraction reads a number above 0 and at most 1.
+func (l *loader) fraction(name string, def float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v <= 0 || v > 1 {
+		l.fail(name, "must be a number above 0 and at most 1, got %q", raw)
+		return def
+	}
+	return v
+}
+
+// routeLimits reads <prefix>_MAX_CONCURRENT and <prefix>_TIMEOUT.
+func (l *loader) routeLimits(prefix string, def RouteLimits) RouteLimits {
+	return RouteLimits{
+		MaxConcurrent: l.int(prefix+"_MAX_CONCURRENT", def.MaxConcurrent, 1, 100000),
+		Timeout:       l.duration(prefix+"_TIMEOUT", def.Timeout, time.Second),
+	}
+}
+
+func (l *loader) url(name, def string) string {
+	raw := l.string(name, def)
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.fail(name, "must be an http or https URL, got %q", raw)
+		return def
+	}
+	return raw
+}
+
+// origins parses a comma-separated list of origins such as
+// "https://app.example.com,http://localhost:3000".
+func (l *loader) origins(name string) []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv(name), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			l.fail(name, "contains %q, which is not an origin like https://app.example.com", origin)
+			continue
+		}
+		origins = append(origins, origin)
+	}
+	return origins
+}
+
+// networks parses a comma-separated list of IP addresses and CIDR
+// networks such as "10.0.0.0/8,192.168.1.10".
+func (l *loader) networks(name string) []string {
+	var networks []string
+	for _, network := range strings.Split(os.Getenv(name), ",") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if _, err := netip.ParsePrefix(network); err != nil {
+			if _, err := netip.ParseAddr(network); err != nil {
+				l.fail(name, "contains %q, which is neither an IP address nor a CIDR network", network)
+				continue
+			}
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// labelValues parses a comma-separated list of metric label values such
+// as "production,staging". Values are lower-cased, like scan tags.
+func (l *loader) labelValues(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// storagePlans parses a comma-separated list of plans given as
+// name:results:megabytes, such as "free:100000:1024,team:0:51200"; 0 is
+// unlimited.
+func (l *loader) storagePlans(name string) map[string]StoragePlan {
+	plans := map[string]StoragePlan{}
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			l.fail(name, "contains %q, which is not a plan like free:100000:1024", entry)
+			continue
+		}
+		results, err1 := strconv.ParseInt(parts[1], 10, 64)
+		megabytes, err2 := strconv.ParseInt(parts[2], 10, 64)
+		if err1 != nil || err2 != nil || results < 0 || megabytes < 0 || megabytes > 1<<30 {
+			l.fail(name, "contains %q, whose limits must be non-negative integers", entry)
+			continue
+		}
+		plans[parts[0]] = StoragePlan{Results: results, ArtifactBytes: megabytes << 20}
+	}
+	return plans
+}
@@ -0,0 +1,124 @@
+// Package dbtest opens GORM databases backed by a scripted in-memory
+// driver, for tests of code that runs a few known statements. The test
+// answers every statement itself, so no database server is needed.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Result is the answer to a statement: the rows of a query, or the number
+// of rows an exec affected.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+}
+
+// Handler answers a statement. Arguments are numbered $1, $2, ... in the
+// query, as GORM writes them for Postgres.
+type Handler func(query string, args []driver.NamedValue) (Result, error)
+
+// Open returns a Postgres-flavoured GORM database whose statements are all
+// answered by h. It is closed when the test ends.
+func Open(t testing.TB, h Handler) *gorm.DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(connector{h: h})
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("open scripted database: %v", err)
+	}
+	return db
+}
+
+type connector struct {
+	h Handler
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn(c), nil }
+func (c connector) Driver() driver.Driver                        { return nil }
+
+type conn struct {
+	h Handler
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) { return stmt{h: c.h, query: query}, nil }
+func (c conn) Close() error                              { return nil }
+func (c conn) Begin() (driver.Tx, error)                 { return tx{}, nil }
+
+func (c conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return tx{}, nil }
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.h(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.h(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: res.Columns, rows: res.Rows}, nil
+}
+
+type stmt struct {
+	h     Handler
+	query string
+}
+
+func (s stmt) Close() error  { return nil }
+func (s stmt) NumInput() int { return -1 }
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return conn{h: s.h}.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return conn{h: s.h}.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return values
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package events is an in-process publish/subscribe hub for scan progress.
+// Handlers that change a scan publish events for it, and clients streaming
+// the scan (see handlers.HandleScanEvents) receive them as they happen.
+//
+// The broker lives in memory, so subscribers only receive events published
+// by the same server instance.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types.
+const (
+	// TypeStatus is published when the status of a scan changes.
+	TypeStatus = "status"
+	// TypeResult is published for every test result received for a scan.
+	TypeResult = "result"
+	// TypeProgress is published when a batch of results has been saved.
+	TypeProgress = "progress"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// Event is a single update about a scan.
+type Event struct {
+	Type string      `json:"type"`
+	At   time.Time   `json:"at"`
+	Data interface{} `json:"data"`
+}
+
+// Listener receives every event published, whatever the scan. It is
+// called by Publish and must not block.
+type Listener func(scanID uuid.UUID, ev Event)
+
+// Broker fans events out to the subscribers of each scan.
+type Broker struct {
+	mu        sync.RWMutex
+	subs      map[uuid.UUID]map[chan Event]struct{}
+	listeners []Listener
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[uuid.UUID]map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel receiving the events of a scan and a function
+// that ends the subscription and closes the channel.
+func (b *Broker) Subscribe(scanID uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[scanID] == nil {
+		b.subs[scanID] = map[chan Event]struct{}{}
+	}
+	b.subs[scanID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[scanID], ch)
+			if len(b.subs[scanID]) == 0 {
+				delete(b.subs, scanID)
+			}
+			close(ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// AddListener registers a listener for the events of all scans.
+func (b *Broker) AddListener(l Listener) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, l)
+	b.mu.Unlock()
+}
+
+// Publish sends an event to the scan's subscribers and the listeners
+// without blocking. Subscribers that are too far behind miss the event.
+func (b *Broker) Publish(scanID uuid.UUID, eventType string, data interface{}) {
+	ev := Event{Type: eventType, At: time.Now(), Data: data}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range b.listeners {
+		l(scanID, ev)
+	}
+	for ch := range b.subs[scanID] {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "event", eventType, "scan_id", scanID)
+		}
+	}
+}
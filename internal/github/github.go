@@ -0,0 +1,220 @@
+// Package github is a minimal client of the GitHub REST API acting as a
+// GitHub App. It authenticates as the app with a short-lived JWT signed by
+// the app's private key, exchanges that for an access token of the
+// installation on a repository, and creates check runs and pull request
+// comments with it.
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAPIURL is the API of github.com; GitHub Enterprise Server has its
+// own (https://<host>/api/v3).
+const DefaultAPIURL = "https://api.github.com"
+
+const userAgent = "AntiGinx-GitHub-App/1.0"
+
+// maxResponseBody bounds the response bodies read from the API.
+const maxResponseBody = 1 << 20
+
+// Check run conclusions.
+const (
+	ConclusionSuccess   = "success"
+	ConclusionFailure   = "failure"
+	ConclusionCancelled = "cancelled"
+	ConclusionNeutral   = "neutral"
+)
+
+// APIError is a response of the API with an unexpected status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// CheckRun is a completed check run on a commit.
+type CheckRun struct {
+	Name       string
+	HeadSHA    string
+	Conclusion string
+	DetailsURL string
+	Title      string
+	Summary    string
+	Text       string
+}
+
+// App is a GitHub App.
+type App struct {
+	id     int64
+	key    *rsa.PrivateKey
+	apiURL string
+	client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]installationToken
+}
+
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+func NewApp(id int64, key *rsa.PrivateKey, apiURL string, client *http.Client) *App {
+	return &App{
+		id:     id,
+		key:    key,
+		apiURL: strings.TrimRight(apiURL, "/"),
+		client: client,
+		tokens: map[string]installationToken{},
+	}
+}
+
+// CreateCheckRun creates a completed check run on a commit of repo
+// ("owner/name") and returns its ID.
+func (a *App) CreateCheckRun(ctx context.Context, repo string, run CheckRun) (int64, error) {
+	body := map[string]interface{}{
+		"name":         run.Name,
+		"head_sha":     run.HeadSHA,
+		"status":       "completed",
+		"conclusion":   run.Conclusion,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"output": map[string]string{
+			"title":   run.Title,
+			"summary": run.Summary,
+			"text":    run.Text,
+		},
+	}
+	if run.DetailsURL != "" {
+		body["details_url"] = run.DetailsURL
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := a.repoRequest(ctx, repo, http.MethodPost, "/repos/"+repo+"/check-runs", body, &created)
+	return created.ID, err
+}
+
+// CreateComment comments on pull request number of repo and returns the
+// comment's ID.
+func (a *App) CreateComment(ctx context.Context, repo string, number int, comment string) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	path := "/repos/" + repo + "/issues/" + strconv.Itoa(number) + "/comments"
+	err := a.repoRequest(ctx, repo, http.MethodPost, path, map[string]string{"body": comment}, &created)
+	return created.ID, err
+}
+
+// repoRequest calls the API with the installation token of repo.
+func (a *App) repoRequest(ctx context.Context, repo, method, path string, body, out interface{}) error {
+	token, err := a.installationToken(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, method, path, "token "+token, body, out)
+}
+
+// installationToken returns an access token of the app's installation on
+// repo, cached until shortly before it expires.
+func (a *App) installationToken(ctx context.Context, repo string) (string, error) {
+	a.mu.Lock()
+	cached, ok := a.tokens[repo]
+	a.mu.Unlock()
+	if ok && time.Until(cached.expiresAt) > time.Minute {
+		return cached.token, nil
+	}
+
+	appJWT, err := a.appJWT()
+	if err != nil {
+		return "", err
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.do(ctx, http.MethodGet, "/repos/"+repo+"/installation", "Bearer "+appJWT, nil, &installation); err != nil {
+		return "", fmt.Errorf("looking up the app installation on %s: %w", repo, err)
+	}
+	var created struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + strconv.FormatInt(installation.ID, 10) + "/access_tokens"
+	if err := a.do(ctx, http.MethodPost, path, "Bearer "+appJWT, nil, &created); err != nil {
+		return "", fmt.Errorf("creating an installation token: %w", err)
+	}
+
+	a.mu.Lock()
+	a.tokens[repo] = installationToken{token: created.Token, expiresAt: created.ExpiresAt}
+	a.mu.Unlock()
+	return created.Token, nil
+}
+
+// appJWT signs the JWT authenticating as the app. GitHub accepts at most
+// ten minutes of validity; iat is backdated against clock drift.
+func (a *App) appJWT() (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer:    strconv.FormatInt(a.id, 10),
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	}).SignedString(a.key)
+}
+
+func (a *App) do(ctx context.Context, method, path, authorization string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("User-Agent", userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(raw, &apiErr)
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
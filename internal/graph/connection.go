@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxPageSize bounds the first argument of every connection.
+const maxPageSize = 100
+
+// PageInfo tells where a page of a connection ends.
+type PageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+// ScanConnection is a page of scans. The query it was read with is kept
+// to count all matching scans when totalCount is selected.
+type ScanConnection struct {
+	Nodes    []*models.PremiumScan
+	PageInfo *PageInfo
+	query    *gorm.DB
+}
+
+// ScanResultConnection is a page of the results of a scan.
+type ScanResultConnection struct {
+	Nodes    []*models.ScanResult
+	PageInfo *PageInfo
+	query    *gorm.DB
+}
+
+// UserConnection is a page of users.
+type UserConnection struct {
+	Nodes    []*models.User
+	PageInfo *PageInfo
+	query    *gorm.DB
+}
+
+// page reads the first and after arguments of a connection into a limit
+// and an offset. Cursors are opaque to clients; they encode the offset of
+// the next item.
+func page(first *int, after *string, defaultSize int) (int, int, error) {
+	limit := defaultSize
+	if first != nil {
+		limit = *first
+	}
+	if limit < 1 || limit > maxPageSize {
+		return 0, 0, fmt.Errorf("first must be between 1 and %d", maxPageSize)
+	}
+	if after == nil || *after == "" {
+		return limit, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(*after)
+	if err != nil {
+		return 0, 0, fmt.Errorf("after is not a valid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("after is not a valid cursor")
+	}
+	return limit, offset, nil
+}
+
+// fetchPage reads up to limit items from offset into dest, reading one
+// more to tell whether there is a next page, and trims the extra item.
+func fetchPage[T any](query *gorm.DB, limit, offset int, dest *[]*T) (*PageInfo, error) {
+	if err := query.Limit(limit + 1).Offset(offset).Find(dest).Error; err != nil {
+		return nil, err
+	}
+	info := &PageInfo{}
+	if len(*dest) > limit {
+		*dest = (*dest)[:limit]
+		info.HasNextPage = true
+	}
+	if len(*dest) > 0 {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset + len(*dest))))
+		info.EndCursor = &cursor
+	}
+	return info, nil
+}
+
+// pageComplexity is the cost of a connection: its fields for each item of
+// the largest page it may return.
+func pageComplexity(childComplexity int, first *int, defaultSize int) int {
+	size := defaultSize
+	if first != nil && *first > 0 {
+		size = *first
+	}
+	return 1 + childComplexity*size
+}
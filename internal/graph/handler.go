@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/apikeys"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/vektah/gqlparser/v2/ast"
+	"gorm.io/gorm"
+)
+
+// maxComplexity bounds the cost of a query: roughly the number of fields
+// it may return, counting the fields of each item of a page as many times
+// as the page may have items.
+const maxComplexity = 25000
+
+// Handler serves GraphQL queries.
+type Handler struct {
+	server *handler.Server
+}
+
+// NewHandler creates the GraphQL handler.
+func NewHandler(db *gorm.DB) *Handler {
+	cfg := Config{Resolvers: &Resolver{db: db}}
+	cfg.Complexity.Query.Scans = func(childComplexity int, first *int, _ *string, _ *ScanFilter) int {
+		return pageComplexity(childComplexity, first, 20)
+	}
+	cfg.Complexity.Query.Users = func(childComplexity int, first *int, _ *string, _ *string) int {
+		return pageComplexity(childComplexity, first, 20)
+	}
+	cfg.Complexity.User.Scans = func(childComplexity int, first *int, _ *string, _ *ScanFilter) int {
+		return pageComplexity(childComplexity, first, 20)
+	}
+	cfg.Complexity.Scan.Results = func(childComplexity int, first *int, _ *string, _ *ResultFilter) int {
+		return pageComplexity(childComplexity, first, 50)
+	}
+
+	server := handler.New(NewExecutableSchema(cfg))
+	server.AddTransport(transport.POST{})
+	server.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	server.Use(extension.Introspection{})
+	server.Use(extension.FixedComplexityLimit(maxComplexity))
+	return &Handler{server: server}
+}
+
+// HandleGraphQL runs a GraphQL query on behalf of the authenticated user.
+// Only reading is supported; the schema has no mutations. Admins can read
+// all scans and users, unless they use an API key without the admin
+// scope.
+//
+// Expects the userID and userRole context values set by the auth
+// middleware and LoadRole.
+func (h *Handler) HandleGraphQL(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Access not authorized"})
+		return
+	}
+	admin := c.GetString("userRole") == models.UserRoleAdmin
+	if c.GetString("apiKeyID") != "" && !apikeys.HasScope(c.GetStringSlice("apiKeyScopes"), apikeys.ScopeAdmin) {
+		admin = false
+	}
+
+	ctx := withViewer(c.Request.Context(), viewer{UserID: userUUID, Admin: admin})
+	h.server.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
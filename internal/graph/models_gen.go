@@ -0,0 +1,22 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+type Query struct {
+}
+
+// Narrows the results of a scan; all given criteria have to match.
+type ResultFilter struct {
+	Passed       *bool    `json:"passed,omitempty"`
+	Severity     []string `json:"severity,omitempty"`
+	TriageStatus []string `json:"triageStatus,omitempty"`
+}
+
+// Narrows a list of scans; all given criteria have to match.
+type ScanFilter struct {
+	Status []string `json:"status,omitempty"`
+	// Scans that have this tag.
+	Tag *string `json:"tag,omitempty"`
+	// Case-insensitive prefix of the target URL.
+	TargetPrefix *string `json:"targetPrefix,omitempty"`
+}
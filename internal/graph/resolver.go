@@ -0,0 +1,143 @@
+// Package graph serves the GraphQL API at /api/graphql, which lets the
+// frontend read scans, their results and users with exactly the fields and
+// nested pages a view needs, in one request.
+//
+// The schema is in schema.graphqls; after changing it, regenerate the
+// executable schema with `go generate ./internal/graph`.
+package graph
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+//go:generate go run github.com/99designs/gqlgen generate
+
+var (
+	errDatabase  = errors.New("database error")
+	errAdminOnly = errors.New("only admins can read other users")
+)
+
+// Resolver resolves the queries of one request on behalf of the viewer
+// stored in its context (see withViewer).
+type Resolver struct {
+	db *gorm.DB
+}
+
+// viewer is the user a query runs as.
+type viewer struct {
+	UserID uuid.UUID
+	// Admin is set for admins, unless they authenticated with an API key
+	// without the admin scope.
+	Admin bool
+}
+
+type viewerKey struct{}
+
+func withViewer(ctx context.Context, v viewer) context.Context {
+	return context.WithValue(ctx, viewerKey{}, v)
+}
+
+func viewerFrom(ctx context.Context) viewer {
+	v, _ := ctx.Value(viewerKey{}).(viewer)
+	return v
+}
+
+// readableScans scopes a query of premium scans to those the viewer may
+// read: their own and those shared with an organization they are a member
+// of. Admins may read all scans.
+func (r *Resolver) readableScans(ctx context.Context) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&models.PremiumScan{})
+	v := viewerFrom(ctx)
+	if v.Admin {
+		return query
+	}
+	orgs := r.db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).
+		Select("organization_id").Where("user_id = ?", v.UserID)
+	return query.Where("(premium_scans.user_id = ? OR premium_scans.organization_id IN (?))", v.UserID, orgs)
+}
+
+// scanPage reads the page of the scans of query selected by first and
+// after, newest first.
+func (r *Resolver) scanPage(ctx context.Context, query *gorm.DB, first *int, after *string, filter *ScanFilter) (*ScanConnection, error) {
+	limit, offset, err := page(first, after, 20)
+	if err != nil {
+		return nil, err
+	}
+	query = applyScanFilter(query, filter).Session(&gorm.Session{})
+
+	conn := &ScanConnection{Nodes: make([]*models.PremiumScan, 0), query: query}
+	nodes := preloadScanFields(query, nodeFields(ctx)).Order("premium_scans.created_at desc, premium_scans.id")
+	if conn.PageInfo, err = fetchPage(nodes, limit, offset, &conn.Nodes); err != nil {
+		return nil, databaseError(ctx, "Failed to list scans", err)
+	}
+	return conn, nil
+}
+
+// applyScanFilter narrows a query of scans to those matching filter.
+func applyScanFilter(query *gorm.DB, filter *ScanFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+	if len(filter.Status) > 0 {
+		statuses := make([]string, len(filter.Status))
+		for i, s := range filter.Status {
+			statuses[i] = strings.ToUpper(strings.TrimSpace(s))
+		}
+		query = query.Where("premium_scans.status IN ?", statuses)
+	}
+	if filter.Tag != nil && strings.TrimSpace(*filter.Tag) != "" {
+		query = query.Where("premium_scans.id IN (?)", query.Session(&gorm.Session{NewDB: true}).Model(&models.ScanTag{}).
+			Select("scan_id").Where("tag = ?", strings.ToLower(strings.TrimSpace(*filter.Tag))))
+	}
+	if filter.TargetPrefix != nil && strings.TrimSpace(*filter.TargetPrefix) != "" {
+		query = query.Where("LOWER(premium_scans.target_url) LIKE ?", escapeLike(strings.ToLower(strings.TrimSpace(*filter.TargetPrefix)))+"%")
+	}
+	return query
+}
+
+// preloadScanFields preloads the associations of scans that the query
+// selects, so that a page of scans doesn't load each owner and tag list
+// separately. fields are the selected fields of a scan.
+func preloadScanFields(query *gorm.DB, fields []graphql.CollectedField) *gorm.DB {
+	for _, f := range fields {
+		switch f.Name {
+		case "owner":
+			query = query.Preload("User")
+		case "tags":
+			query = query.Preload("Tags", func(tx *gorm.DB) *gorm.DB {
+				return tx.Order("tag")
+			})
+		}
+	}
+	return query
+}
+
+// nodeFields returns the selected fields of the nodes of the connection
+// being resolved.
+func nodeFields(ctx context.Context) []graphql.CollectedField {
+	for _, f := range graphql.CollectFieldsCtx(ctx, nil) {
+		if f.Name == "nodes" {
+			return graphql.CollectFields(graphql.GetOperationContext(ctx), f.Selections, nil)
+		}
+	}
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// databaseError logs err and returns the error shown to the client.
+func databaseError(ctx context.Context, msg string, err error) error {
+	slog.ErrorContext(ctx, msg, "error", err)
+	return errDatabase
+}
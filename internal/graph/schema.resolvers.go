@@ -0,0 +1,227 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver
+// implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.95
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", viewerFrom(ctx).UserID).Error; err != nil {
+		return nil, databaseError(ctx, "Failed to load the current user", err)
+	}
+	return &user, nil
+}
+
+// Scan is the resolver for the scan field.
+func (r *queryResolver) Scan(ctx context.Context, id string) (*models.PremiumScan, error) {
+	scanID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("id must be a UUID")
+	}
+	var scan models.PremiumScan
+	err = preloadScanFields(r.readableScans(ctx), graphql.CollectFieldsCtx(ctx, nil)).First(&scan, "premium_scans.id = ?", scanID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, databaseError(ctx, "Failed to load scan", err)
+	}
+	return &scan, nil
+}
+
+// Scans is the resolver for the scans field.
+func (r *queryResolver) Scans(ctx context.Context, first *int, after *string, filter *ScanFilter) (*ScanConnection, error) {
+	return r.scanPage(ctx, r.readableScans(ctx), first, after, filter)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id string) (*models.User, error) {
+	if !viewerFrom(ctx).Admin {
+		return nil, errAdminOnly
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("id must be a UUID")
+	}
+	var user models.User
+	err = r.db.WithContext(ctx).First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, databaseError(ctx, "Failed to load user", err)
+	}
+	return &user, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, first *int, after *string, search *string) (*UserConnection, error) {
+	if !viewerFrom(ctx).Admin {
+		return nil, errAdminOnly
+	}
+	limit, offset, err := page(first, after, 20)
+	if err != nil {
+		return nil, err
+	}
+	query := r.db.WithContext(ctx).Model(&models.User{})
+	if search != nil && strings.TrimSpace(*search) != "" {
+		pattern := "%" + escapeLike(strings.ToLower(strings.TrimSpace(*search))) + "%"
+		query = query.Where("(LOWER(email) LIKE ? OR LOWER(full_name) LIKE ?)", pattern, pattern)
+	}
+	query = query.Session(&gorm.Session{})
+
+	conn := &UserConnection{Nodes: make([]*models.User, 0), query: query}
+	if conn.PageInfo, err = fetchPage(query.Order("created_at desc, id"), limit, offset, &conn.Nodes); err != nil {
+		return nil, databaseError(ctx, "Failed to list users", err)
+	}
+	return conn, nil
+}
+
+// Tests is the resolver for the tests field.
+func (r *scanResolver) Tests(ctx context.Context, obj *models.PremiumScan) ([]string, error) {
+	if obj.Tests == nil {
+		return []string{}, nil
+	}
+	return obj.Tests, nil
+}
+
+// Tags is the resolver for the tags field.
+func (r *scanResolver) Tags(ctx context.Context, obj *models.PremiumScan) ([]string, error) {
+	tags := obj.Tags
+	if tags == nil {
+		if err := r.db.WithContext(ctx).Where("scan_id = ?", obj.ID).Order("tag").Find(&tags).Error; err != nil {
+			return nil, databaseError(ctx, "Failed to load scan tags", err)
+		}
+	}
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Tag
+	}
+	return names, nil
+}
+
+// Owner is the resolver for the owner field.
+func (r *scanResolver) Owner(ctx context.Context, obj *models.PremiumScan) (*models.User, error) {
+	if obj.User.ID == obj.UserID {
+		return &obj.User, nil
+	}
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", obj.UserID).Error; err != nil {
+		return nil, databaseError(ctx, "Failed to load scan owner", err)
+	}
+	return &user, nil
+}
+
+// Results is the resolver for the results field.
+func (r *scanResolver) Results(ctx context.Context, obj *models.PremiumScan, first *int, after *string, filter *ResultFilter) (*ScanResultConnection, error) {
+	limit, offset, err := page(first, after, 50)
+	if err != nil {
+		return nil, err
+	}
+	query := r.db.WithContext(ctx).Model(&models.ScanResult{}).Where("scan_id = ?", obj.ID)
+	if filter != nil {
+		if filter.Passed != nil {
+			query = query.Where("passed = ?", *filter.Passed)
+		}
+		if len(filter.Severity) > 0 {
+			ranks := make([]int, 0, len(filter.Severity))
+			for _, s := range filter.Severity {
+				rank, known := models.SeverityRanks[strings.ToLower(strings.TrimSpace(s))]
+				if !known {
+					return nil, fmt.Errorf("unknown severity %q", s)
+				}
+				ranks = append(ranks, rank)
+			}
+			query = query.Where("severity_rank IN ?", ranks)
+		}
+		if len(filter.TriageStatus) > 0 {
+			statuses := make([]string, len(filter.TriageStatus))
+			for i, s := range filter.TriageStatus {
+				statuses[i] = strings.ToLower(strings.TrimSpace(s))
+			}
+			query = query.Where("triage_status IN ?", statuses)
+		}
+	}
+	query = query.Session(&gorm.Session{})
+
+	conn := &ScanResultConnection{Nodes: make([]*models.ScanResult, 0), query: query}
+	if conn.PageInfo, err = fetchPage(query.Order("severity_rank desc, id"), limit, offset, &conn.Nodes); err != nil {
+		return nil, databaseError(ctx, "Failed to list scan results", err)
+	}
+	return conn, nil
+}
+
+// TotalCount is the resolver for the totalCount field.
+func (r *scanConnectionResolver) TotalCount(ctx context.Context, obj *ScanConnection) (int, error) {
+	var total int64
+	if err := obj.query.Count(&total).Error; err != nil {
+		return 0, databaseError(ctx, "Failed to count scans", err)
+	}
+	return int(total), nil
+}
+
+// TotalCount is the resolver for the totalCount field.
+func (r *scanResultConnectionResolver) TotalCount(ctx context.Context, obj *ScanResultConnection) (int, error) {
+	var total int64
+	if err := obj.query.Count(&total).Error; err != nil {
+		return 0, databaseError(ctx, "Failed to count scan results", err)
+	}
+	return int(total), nil
+}
+
+// Scans is the resolver for the scans field.
+func (r *userResolver) Scans(ctx context.Context, obj *models.User, first *int, after *string, filter *ScanFilter) (*ScanConnection, error) {
+	return r.scanPage(ctx, r.readableScans(ctx).Where("premium_scans.user_id = ?", obj.ID), first, after, filter)
+}
+
+// TotalCount is the resolver for the totalCount field.
+func (r *userConnectionResolver) TotalCount(ctx context.Context, obj *UserConnection) (int, error) {
+	var total int64
+	if err := obj.query.Count(&total).Error; err != nil {
+		return 0, databaseError(ctx, "Failed to count users", err)
+	}
+	return int(total), nil
+}
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Scan returns ScanResolver implementation.
+func (r *Resolver) Scan() ScanResolver { return &scanResolver{r} }
+
+// ScanConnection returns ScanConnectionResolver implementation.
+func (r *Resolver) ScanConnection() ScanConnectionResolver { return &scanConnectionResolver{r} }
+
+// ScanResultConnection returns ScanResultConnectionResolver implementation.
+func (r *Resolver) ScanResultConnection() ScanResultConnectionResolver {
+	return &scanResultConnectionResolver{r}
+}
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+// UserConnection returns UserConnectionResolver implementation.
+func (r *Resolver) UserConnection() UserConnectionResolver { return &userConnectionResolver{r} }
+
+type (
+	queryResolver                struct{ *Resolver }
+	scanResolver                 struct{ *Resolver }
+	scanConnectionResolver       struct{ *Resolver }
+	scanResultConnectionResolver struct{ *Resolver }
+	userResolver                 struct{ *Resolver }
+	userConnectionResolver       struct{ *Resolver }
+)
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// activityAuditActions are the audit log actions of a user that appear in
+// their activity feed.
+var activityAuditActions = []string{
+	models.AuditAPIKeyCreated,
+	models.AuditAPIKeyUpdated,
+	models.AuditAPIKeyRevoked,
+	models.AuditProductionTargetCreated,
+	models.AuditProductionTargetDeleted,
+	models.AuditScanDeleted,
+	models.AuditSessionRevoked,
+	models.AuditOrganizationCreated,
+	models.AuditMemberInvited,
+	models.AuditMemberJoined,
+}
+
+// activityFeed merges, newest first, the submissions and outcomes of a
+// user's scans, the findings they marked fixed or that were verified, and
+// the settings changes they made. The scan events and the audit log are the
+// persisted side of the event bus, which itself only fans out to live
+// subscribers.
+const activityFeed = `
+SELECT * FROM (
+	SELECT CASE WHEN COALESCE(e.from_status, '') = '' THEN 'scan.submitted' ELSE 'scan.' || LOWER(e.status) END AS type,
+		e.created_at AS occurred_at, e.scan_id, s.target_url, NULL::bigint AS finding_id, '' AS test_name,
+		COALESCE(e.reason, '') AS reason, '' AS resource_type, '' AS resource_id
+	FROM scan_events e JOIN premium_scans s ON s.id = e.scan_id
+	WHERE s.user_id = @user AND s.deleted_at IS NULL
+		AND (COALESCE(e.from_status, '') = '' OR e.status IN ('COMPLETED', 'FAILED', 'CANCELLED', 'REJECTED'))
+	UNION ALL
+	SELECT 'finding.' || r.triage_status, r.triaged_at, r.scan_id, s.target_url, r.id, r.test_name,
+		COALESCE(r.triage_note, ''), '', ''
+	FROM scan_results r JOIN premium_scans s ON s.id = r.scan_id
+	WHERE s.user_id = @user AND s.deleted_at IS NULL AND r.deleted_at IS NULL
+		AND r.triage_status IN @findingStatuses AND r.triaged_at IS NOT NULL
+	UNION ALL
+	SELECT a.action, a.created_at, NULL, '', NULL, '', '', a.target_type, a.target_id
+	FROM audit_log_entries a
+	WHERE a.actor_id = @user AND a.action IN @auditActions
+) feed
+ORDER BY occurred_at DESC
+LIMIT @limit OFFSET @offset`
+
+// organizationActivityAuditActions are the audit log actions on an
+// organization that appear in its activity feed.
+var organizationActivityAuditActions = []string{
+	models.AuditOrganizationCreated,
+	models.AuditOrganizationPlanChanged,
+	models.AuditMemberInvited,
+	models.AuditMemberJoined,
+}
+
+// organizationActivityFeed is the activityFeed of the scans shared with an
+// organization and the changes made to it, by any member.
+const organizationActivityFeed = `
+SELECT * FROM (
+	SELECT CASE WHEN COALESCE(e.from_status, '') = '' THEN 'scan.submitted' ELSE 'scan.' || LOWER(e.status) END AS type,
+		e.created_at AS occurred_at, s.user_id AS actor_id, e.scan_id, s.target_url, NULL::bigint AS finding_id, '' AS test_name,
+		COALESCE(e.reason, '') AS reason, '' AS resource_type, '' AS resource_id
+	FROM scan_events e JOIN premium_scans s ON s.id = e.scan_id
+	WHERE s.organization_id = @organization AND s.deleted_at IS NULL
+		AND (COALESCE(e.from_status, '') = '' OR e.status IN ('COMPLETED', 'FAILED', 'CANCELLED', 'REJECTED'))
+	UNION ALL
+	SELECT 'finding.' || r.triage_status, r.triaged_at, s.user_id, r.scan_id, s.target_url, r.id, r.test_name,
+		COALESCE(r.triage_note, ''), '', ''
+	FROM scan_results r JOIN premium_scans s ON s.id = r.scan_id
+	WHERE s.organization_id = @organization AND s.deleted_at IS NULL AND r.deleted_at IS NULL
+		AND r.triage_status IN @findingStatuses AND r.triaged_at IS NOT NULL
+	UNION ALL
+	SELECT a.action, a.created_at, a.actor_id, NULL, '', NULL, '', '', a.target_type, a.target_id
+	FROM audit_log_entries a
+	WHERE a.target_type = 'organization' AND a.target_id = @organizationID AND a.action IN @auditActions
+) feed
+ORDER BY occurred_at DESC
+LIMIT @limit OFFSET @offset`
+
+// ActivityItem is one entry of the activity feed. Type is scan.submitted,
+// scan.completed, scan.failed, scan.cancelled or scan.rejected for scans,
+// finding.fixed or finding.verified for findings, and the audit action
+// (for example api_key.created) for settings changes. ActorID is only set
+// in the feed of an organization, where it is the member who submitted the
+// scan or made the change.
+type ActivityItem struct {
+	Type         string     `json:"type"`
+	OccurredAt   time.Time  `json:"occurred_at"`
+	ActorID      *uuid.UUID `json:"actor_id,omitempty"`
+	ScanID       *uuid.UUID `json:"scan_id,omitempty"`
+	TargetURL    string     `json:"target_url,omitempty"`
+	FindingID    *uint      `json:"finding_id,omitempty"`
+	TestName     string     `json:"test_name,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	ResourceType string     `json:"resource_type,omitempty"`
+	ResourceID   string     `json:"resource_id,omitempty"`
+}
+
+// ActivityResponse is a page of the activity feed.
+type ActivityResponse struct {
+	Items  []ActivityItem `json:"items"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// HandleUserActivity returns a page of the current user's activity feed
+// for the dashboard homepage, paginated with ?limit= and ?offset=. It only
+// covers the user's own activity; that of their organizations is served by
+// HandleOrganizationActivity.
+func (h *ScanHandler) HandleUserActivity(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.respondActivity(c, activityFeed, map[string]interface{}{
+		"user":         userUUID,
+		"auditActions": activityAuditActions,
+	})
+}
+
+// HandleOrganizationActivity returns a page of the activity feed of an
+// organization the current user is a member of, paginated like
+// HandleUserActivity.
+func (h *ScanHandler) HandleOrganizationActivity(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+	h.respondActivity(c, organizationActivityFeed, map[string]interface{}{
+		"organization":   orgID,
+		"organizationID": orgID.String(),
+		"auditActions":   organizationActivityAuditActions,
+	})
+}
+
+// respondActivity writes the page of an activity feed query requested by
+// ?limit= and ?offset=.
+func (h *ScanHandler) respondActivity(c *gin.Context, feed string, params map[string]interface{}) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params["findingStatuses"] = []string{models.TriageFixed, models.TriageVerified}
+	params["limit"] = limit
+	params["offset"] = offset
+
+	items := make([]ActivityItem, 0, limit)
+	if err := h.db.WithContext(c.Request.Context()).Raw(feed, params).Scan(&items).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load activity feed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ActivityResponse{Items: items, Limit: limit, Offset: offset})
+}
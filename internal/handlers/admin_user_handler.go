@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type UserListResponse struct {
+	Items  []models.User `json:"items"`
+	Total  int64         `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// HandleListUsers returns a page of users, filtered by ?role=, ?email=
+// (case-insensitive substring) and ?disabled=true|false.
+func (h *AdminHandler) HandleListUsers(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := h.db.Model(&models.User{})
+	if role := strings.ToLower(strings.TrimSpace(c.Query("role"))); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+escapeLike(strings.ToLower(email))+"%")
+	}
+	if raw := c.Query("disabled"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "disabled must be true or false"})
+			return
+		}
+		if disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count users", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	users := make([]models.User, 0)
+	if err := query.Order("created_at desc").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve users", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserListResponse{
+		Items:  users,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleUpdateUserRole changes a user's role. The last admin cannot be
+// demoted, so the platform always keeps at least one administrator.
+func (h *AdminHandler) HandleUpdateUserRole(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	var user models.User
+	errLastAdmin := errors.New("last admin")
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, "id = ?", userUUID).Error; err != nil {
+			return err
+		}
+
+		if user.Role == models.UserRoleAdmin && req.Role != models.UserRoleAdmin {
+			var admins int64
+			if err := tx.Model(&models.User{}).Where("role = ?", models.UserRoleAdmin).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errLastAdmin
+			}
+		}
+
+		previous := user.Role
+		user.Role = req.Role
+		if err := tx.Model(&user).Update("role", req.Role).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserRoleChanged, "user", user.ID.String(), gin.H{
+			"from": previous,
+			"to":   req.Role,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, errLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot demote the last admin"})
+		default:
+			slog.ErrorContext(c.Request.Context(), "Failed to update role of user", "user_id", userUUID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleDisableUser disables a user's account: the user can't log in, all
+// of their sessions are revoked and their API keys are refused until the
+// account is enabled again. Admins can't disable themselves, and the last
+// enabled admin can't be disabled.
+func (h *AdminHandler) HandleDisableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+// HandleEnableUser enables a disabled account again. Sessions revoked when
+// it was disabled stay revoked.
+func (h *AdminHandler) HandleEnableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *AdminHandler) setUserDisabled(c *gin.Context, disable bool) {
+	userUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	if disable && c.GetString("userID") == userUUID.String() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot disable your own account"})
+		return
+	}
+
+	var user models.User
+	errLastAdmin := errors.New("last admin")
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, "id = ?", userUUID).Error; err != nil {
+			return err
+		}
+		if (user.DisabledAt != nil) == disable {
+			return nil
+		}
+
+		action := models.AuditUserEnabled
+		user.DisabledAt = nil
+		if disable {
+			if user.Role == models.UserRoleAdmin {
+				var admins int64
+				if err := tx.Model(&models.User{}).Where("role = ? AND disabled_at IS NULL", models.UserRoleAdmin).Count(&admins).Error; err != nil {
+					return err
+				}
+				if admins <= 1 {
+					return errLastAdmin
+				}
+			}
+			now := time.Now()
+			user.DisabledAt = &now
+			action = models.AuditUserDisabled
+			if err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Update("disabled_at", user.DisabledAt).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, action, "user", user.ID.String(), gin.H{"email": user.Email})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, errLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot disable the last admin"})
+		default:
+			slog.ErrorContext(c.Request.Context(), "Failed to update account of user", "user_id", userUUID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
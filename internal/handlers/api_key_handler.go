@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/apikeys"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+// CreateAPIKeyRequest creates a key as an admin. Scopes default to
+// apikeys.LegacyScopes, the scope of worker keys.
+type CreateAPIKeyRequest struct {
+	Name               string   `json:"name" binding:"required,max=100"`
+	Scopes             []string `json:"scopes"`
+	RateLimitPerMinute int      `json:"rate_limit_per_minute" binding:"min=0,max=100000"`
+
+	DailyScanQuota   int `json:"daily_scan_quota" binding:"min=0,max=1000000"`
+	MonthlyScanQuota int `json:"monthly_scan_quota" binding:"min=0,max=1000000"`
+}
+
+// CreateUserAPIKeyRequest creates a key for the current user, limited to
+// apikeys.UserScopes.
+type CreateUserAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+}
+
+// UpdateAPIKeyRequest changes the given fields of an API key.
+type UpdateAPIKeyRequest struct {
+	Name               *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	Scopes             []string `json:"scopes" binding:"omitempty,min=1"`
+	RateLimitPerMinute *int     `json:"rate_limit_per_minute" binding:"omitempty,min=0,max=100000"`
+
+	DailyScanQuota   *int `json:"daily_scan_quota" binding:"omitempty,min=0,max=1000000"`
+	MonthlyScanQuota *int `json:"monthly_scan_quota" binding:"omitempty,min=0,max=1000000"`
+}
+
+// MaxUsagePeriod bounds the period of an API usage query.
+const MaxUsagePeriod = 366 * 24 * time.Hour
+
+// defaultUsagePeriod is used when an API usage query gives no start.
+const defaultUsagePeriod = 30 * 24 * time.Hour
+
+// APIUsageDay is the usage of one key and endpoint on one day.
+type APIUsageDay struct {
+	Day          string    `json:"day"`
+	APIKeyID     uuid.UUID `json:"api_key_id"`
+	Method       string    `json:"method"`
+	Route        string    `json:"route"`
+	Requests     int64     `json:"requests"`
+	Errors       int64     `json:"errors"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	MaxLatencyMs int64     `json:"max_latency_ms"`
+}
+
+// APIUsageKey is the total usage of one key over the queried period.
+type APIUsageKey struct {
+	APIKeyID     uuid.UUID `json:"api_key_id"`
+	Name         string    `json:"name"`
+	Prefix       string    `json:"prefix"`
+	Requests     int64     `json:"requests"`
+	Errors       int64     `json:"errors"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+}
+
+type APIUsageResponse struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Keys  []APIUsageKey `json:"keys"`
+	Daily []APIUsageDay `json:"daily"`
+}
+
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{
+		db: db,
+	}
+}
+
+// HandleCreateAPIKey issues a new API key with any scopes. The key itself
+// is returned only in this response; afterwards only its prefix is
+// visible.
+func (h *APIKeyHandler) HandleCreateAPIKey(c *gin.Context) {
+	adminUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = apikeys.LegacyScopes
+	}
+	if !validScopes(c, scopes, apikeys.Scopes) {
+		return
+	}
+
+	h.createKey(c, adminUUID, req.Name, scopes, req.RateLimitPerMinute, quota.Limits{Daily: req.DailyScanQuota, Monthly: req.MonthlyScanQuota})
+}
+
+// HandleCreateUserAPIKey issues an API key acting on behalf of the current
+// user, e.g. for CI pipelines submitting scans. Only apikeys.UserScopes
+// may be granted.
+func (h *APIKeyHandler) HandleCreateUserAPIKey(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateUserAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if !validScopes(c, req.Scopes, apikeys.UserScopes) {
+		return
+	}
+
+	h.createKey(c, userUUID, req.Name, req.Scopes, 0, quota.Limits{})
+}
+
+func (h *APIKeyHandler) createKey(c *gin.Context, owner uuid.UUID, name string, scopes []string, rateLimit int, scanQuota quota.Limits) {
+	keyID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	key, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate API key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		ID:        keyID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		CreatedBy: owner,
+		CreatedAt: time.Now(),
+
+		RateLimitPerMinute: rateLimit,
+		Scopes:             datatypes.NewJSONSlice(scopes),
+
+		DailyScanQuota:   scanQuota.Daily,
+		MonthlyScanQuota: scanQuota.Monthly,
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditAPIKeyCreated, "api_key", apiKey.ID.String(), gin.H{
+			"name":                  apiKey.Name,
+			"scopes":                scopes,
+			"rate_limit_per_minute": rateLimit,
+			"daily_scan_quota":      scanQuota.Daily,
+			"monthly_scan_quota":    scanQuota.Monthly,
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save API key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// validScopes checks that every scope is in allowed, writing a 400
+// response otherwise.
+func validScopes(c *gin.Context, scopes, allowed []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported scope: " + s, "supported_scopes": allowed})
+			return false
+		}
+	}
+	return true
+}
+
+// HandleListUserAPIKeys lists the current user's API keys, including
+// revoked ones.
+func (h *APIKeyHandler) HandleListUserAPIKeys(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys := make([]models.APIKey, 0)
+	if err := h.db.Where("created_by = ?", userUUID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list API keys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// HandleRevokeUserAPIKey revokes one of the current user's API keys.
+func (h *APIKeyHandler) HandleRevokeUserAPIKey(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	apiKey, ok := h.loadAPIKey(c)
+	if !ok {
+		return
+	}
+	if apiKey.CreatedBy != userUUID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	h.revoke(c, apiKey)
+}
+
+// HandleListAPIKeys lists all API keys, including revoked ones.
+func (h *APIKeyHandler) HandleListAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := h.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list API keys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// HandleUpdateAPIKey renames an API key or changes its scopes, rate limit
+// or scan quotas.
+func (h *APIKeyHandler) HandleUpdateAPIKey(c *gin.Context) {
+	apiKey, ok := h.loadAPIKey(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		apiKey.Name = *req.Name
+		updates["name"] = apiKey.Name
+	}
+	if req.Scopes != nil {
+		if !validScopes(c, req.Scopes, apikeys.Scopes) {
+			return
+		}
+		apiKey.Scopes = datatypes.NewJSONSlice(req.Scopes)
+		updates["scopes"] = apiKey.Scopes
+	}
+	if req.RateLimitPerMinute != nil {
+		apiKey.RateLimitPerMinute = *req.RateLimitPerMinute
+		updates["rate_limit_per_minute"] = apiKey.RateLimitPerMinute
+	}
+	if req.DailyScanQuota != nil {
+		apiKey.DailyScanQuota = *req.DailyScanQuota
+		updates["daily_scan_quota"] = apiKey.DailyScanQuota
+	}
+	if req.MonthlyScanQuota != nil {
+		apiKey.MonthlyScanQuota = *req.MonthlyScanQuota
+		updates["monthly_scan_quota"] = apiKey.MonthlyScanQuota
+	}
+	if len(updates) > 0 {
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&apiKey).Updates(updates).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, c, models.AuditAPIKeyUpdated, "api_key", apiKey.ID.String(), gin.H(updates))
+		})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to update API key", "api_key_id", apiKey.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// HandleRevokeAPIKey revokes an API key. Revoked keys are kept for auditing.
+func (h *APIKeyHandler) HandleRevokeAPIKey(c *gin.Context) {
+	apiKey, ok := h.loadAPIKey(c)
+	if !ok {
+		return
+	}
+	h.revoke(c, apiKey)
+}
+
+func (h *APIKeyHandler) revoke(c *gin.Context, apiKey models.APIKey) {
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, c, models.AuditAPIKeyRevoked, "api_key", apiKey.ID.String(), gin.H{"name": apiKey.Name})
+		})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to revoke API key", "api_key_id", apiKey.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// HandleAPIUsage reports the requests made with API keys between ?from=
+// and ?to= (default: the last 30 days): totals per key, and a daily
+// breakdown per key and endpoint. ?api_key_id= restricts the report to one
+// key. Usage is written to the database every usage.FlushInterval, so the
+// latest requests may not be included yet.
+func (h *APIKeyHandler) HandleAPIUsage(c *gin.Context) {
+	h.respondAPIUsage(c, h.db.Model(&models.APIUsage{}))
+}
+
+// HandleOrganizationAPIUsage reports, like HandleAPIUsage, the requests
+// made with the API keys of the members of an organization the current
+// user owns, so owners can tell which integration causes their traffic.
+func (h *APIKeyHandler) HandleOrganizationAPIUsage(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "view API usage")
+	if !ok {
+		return
+	}
+	members := h.db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).
+		Select("user_id").Where("organization_id = ?", orgID)
+	keys := h.db.Session(&gorm.Session{NewDB: true}).Model(&models.APIKey{}).
+		Select("id").Where("created_by IN (?)", members)
+	h.respondAPIUsage(c, h.db.Model(&models.APIUsage{}).Where("api_key_id IN (?)", keys))
+}
+
+// respondAPIUsage writes the usage report of the API usage rows selected
+// by query.
+func (h *APIKeyHandler) respondAPIUsage(c *gin.Context, query *gorm.DB) {
+	to := time.Now()
+	if raw := c.Query("to"); raw != "" {
+		t, err := parseTimeParam(raw, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp or YYYY-MM-DD date"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultUsagePeriod)
+	if raw := c.Query("from"); raw != "" {
+		t, err := parseTimeParam(raw, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp or YYYY-MM-DD date"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from) > MaxUsagePeriod {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The period may cover at most 366 days"})
+		return
+	}
+
+	query = query.Where("day >= ? AND day <= ?", from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly))
+	if raw := c.Query("api_key_id"); raw != "" {
+		keyID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID format"})
+			return
+		}
+		query = query.Where("api_key_id = ?", keyID)
+	}
+
+	var rows []models.APIUsage
+	if err := query.Order("day, api_key_id, route, method").Find(&rows).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load API usage", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	resp := APIUsageResponse{From: from, To: to, Keys: []APIUsageKey{}, Daily: make([]APIUsageDay, 0, len(rows))}
+	totals := map[uuid.UUID]*APIUsageKey{}
+	latency := map[uuid.UUID]int64{}
+	var keyIDs []uuid.UUID
+	for _, r := range rows {
+		resp.Daily = append(resp.Daily, APIUsageDay{
+			Day:          r.Day.Format(time.DateOnly),
+			APIKeyID:     r.APIKeyID,
+			Method:       r.Method,
+			Route:        r.Route,
+			Requests:     r.Requests,
+			Errors:       r.Errors,
+			AvgLatencyMs: averageLatency(r.TotalLatencyMs, r.Requests),
+			MaxLatencyMs: r.MaxLatencyMs,
+		})
+
+		t := totals[r.APIKeyID]
+		if t == nil {
+			t = &APIUsageKey{APIKeyID: r.APIKeyID}
+			totals[r.APIKeyID] = t
+			keyIDs = append(keyIDs, r.APIKeyID)
+		}
+		t.Requests += r.Requests
+		t.Errors += r.Errors
+		latency[r.APIKeyID] += r.TotalLatencyMs
+	}
+
+	if len(keyIDs) > 0 {
+		var keys []models.APIKey
+		if err := h.db.Select("id", "name", "prefix").Where("id IN ?", keyIDs).Find(&keys).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load API keys", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		for _, k := range keys {
+			totals[k.ID].Name = k.Name
+			totals[k.ID].Prefix = k.Prefix
+		}
+	}
+	for id, t := range totals {
+		t.AvgLatencyMs = averageLatency(latency[id], t.Requests)
+		resp.Keys = append(resp.Keys, *t)
+	}
+	sort.Slice(resp.Keys, func(i, j int) bool { return resp.Keys[i].Requests > resp.Keys[j].Requests })
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func averageLatency(totalMs, requests int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return math.Round(float64(totalMs)/float64(requests)*10) / 10
+}
+
+// loadAPIKey loads the API key from the :id path parameter.
+func (h *APIKeyHandler) loadAPIKey(c *gin.Context) (models.APIKey, bool) {
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID format"})
+		return models.APIKey{}, false
+	}
+
+	var apiKey models.APIKey
+	if err := h.db.First(&apiKey, "id = ?", keyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return models.APIKey{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.APIKey{}, false
+	}
+	return apiKey, true
+}
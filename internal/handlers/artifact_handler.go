@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/orgstorage"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+type ArtifactHandler struct {
+	db        *gorm.DB
+	store     storage.Store
+	sanitizer *artifacts.Sanitizer
+	orgs      *orgstorage.Accountant
+}
+
+// ArtifactResponse is an artifact together with a short-lived download URL.
+type ArtifactResponse struct {
+	models.Artifact
+	URL string `json:"url"`
+}
+
+func NewArtifactHandler(db *gorm.DB, store storage.Store, sanitizer *artifacts.Sanitizer, orgs *orgstorage.Accountant) *ArtifactHandler {
+	return &ArtifactHandler{
+		db:        db,
+		store:     store,
+		sanitizer: sanitizer,
+		orgs:      orgs,
+	}
+}
+
+// HandleUploadArtifact accepts an evidence file from a worker as a
+// multipart form with the fields scan_id, kind and file. The file is
+// validated and sanitized before it is stored; dangerous or malformed
+// content is rejected with 422. Artifacts of scans of an organization
+// whose storage plan is full are refused with 507.
+func (h *ArtifactHandler) HandleUploadArtifact(c *gin.Context) {
+	maxBody := max(h.sanitizer.MaxImageBytes, h.sanitizer.MaxHARBytes) + 1<<20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+
+	kind := c.PostForm("kind")
+	limit := h.sanitizer.MaxBytes(kind)
+	if limit == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported artifact kind", "supported_kinds": artifacts.Kinds})
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.PostForm("scan_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+	if !uploadAllowed(c, scanUUID) {
+		return
+	}
+	logging.SetScanID(c.Request.Context(), scanUUID.String())
+
+	premium, status, err := findScan(h.db, scanUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found in database"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status == "CANCELLED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan has been cancelled"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	if fileHeader.Size > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Artifact too large", "max_bytes": limit})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	sanitized, err := h.sanitizer.Sanitize(c.Request.Context(), kind, data)
+	if err != nil {
+		var rejected *artifacts.RejectedError
+		if errors.As(err, &rejected) {
+			slog.WarnContext(c.Request.Context(), "Rejected artifact", "kind", kind, "scan_id", scanUUID, "reason", rejected.Reason)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Artifact rejected", "reason": rejected.Reason})
+			return
+		}
+		// Fail closed: if the antivirus is configured but unavailable the
+		// artifact is not stored.
+		slog.ErrorContext(c.Request.Context(), "Failed to scan artifact for scan", "kind", kind, "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Artifact could not be scanned"})
+		return
+	}
+
+	if premium && !h.artifactFits(c, scanUUID, int64(len(sanitized.Data))) {
+		return
+	}
+
+	artifactID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate artifact ID"})
+		return
+	}
+
+	sum := sha256.Sum256(sanitized.Data)
+	artifact := models.Artifact{
+		ID:          artifactID,
+		ScanID:      scanUUID,
+		Kind:        kind,
+		StorageKey:  "artifacts/" + scanUUID.String() + "/" + artifactID.String() + sanitized.Extension,
+		ContentType: sanitized.ContentType,
+		Size:        int64(len(sanitized.Data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+
+	content := sanitized.Data
+	if artifacts.Compressed(kind) {
+		content, err = artifacts.Compress(sanitized.Data)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to compress artifact for scan", "scan_id", scanUUID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store artifact"})
+			return
+		}
+		artifact.StorageKey += ".gz"
+		artifact.Encoding = artifacts.EncodingGzip
+	}
+
+	if err := h.store.Put(c.Request.Context(), artifact.StorageKey, bytes.NewReader(content), artifact.ContentType); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to store artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store artifact"})
+		return
+	}
+
+	if err := h.db.Create(&artifact).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save artifact", "artifact_id", artifact.ID, "error", err)
+		if err := h.store.Delete(c.Request.Context(), artifact.StorageKey); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to remove orphaned artifact", "storage_key", artifact.StorageKey, "error", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save artifact"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, artifact)
+}
+
+// artifactFits checks that an artifact of size bytes fits the storage plan
+// of the organization the scan is shared with, if any. Otherwise an error
+// response is written and false is returned.
+func (h *ArtifactHandler) artifactFits(c *gin.Context, scanUUID uuid.UUID, size int64) bool {
+	var scan models.PremiumScan
+	err := h.db.Select("id", "organization_id").First(&scan, "id = ?", scanUUID).Error
+	if err == nil {
+		var fits bool
+		if fits, err = h.orgs.AllowArtifact(c.Request.Context(), scan.OrganizationID, size); err == nil && !fits {
+			slog.WarnContext(c.Request.Context(), "Refused artifact over storage plan", "scan_id", scanUUID, "organization_id", scan.OrganizationID)
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": "Organization storage plan is full"})
+			return false
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check storage plan for scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	return true
+}
+
+// HandleListArtifacts lists the artifacts of one of the current user's
+// scans with signed download URLs.
+func (h *ArtifactHandler) HandleListArtifacts(c *gin.Context) {
+	scanUUID, ok := h.ownedScanID(c)
+	if !ok {
+		return
+	}
+
+	var list []models.Artifact
+	if err := h.db.Where("scan_id = ?", scanUUID).Order("created_at ASC").Find(&list).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list artifacts of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	out := make([]ArtifactResponse, 0, len(list))
+	for _, artifact := range list {
+		url, err := h.store.SignedURL(c.Request.Context(), artifact.StorageKey, storage.DefaultURLTTL, "")
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to sign URL for artifact", "artifact_id", artifact.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download URL"})
+			return
+		}
+		out = append(out, ArtifactResponse{Artifact: artifact, URL: url})
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// HandleGetHAR returns the latest HAR capture of one of the current user's
+// scans, decompressed.
+func (h *ArtifactHandler) HandleGetHAR(c *gin.Context) {
+	h.serveLatest(c, artifacts.KindHAR)
+}
+
+// HandleGetRawHeaders returns the raw response headers captured during one
+// of the current user's scans, as a list of artifacts.HeaderSnapshot.
+func (h *ArtifactHandler) HandleGetRawHeaders(c *gin.Context) {
+	h.serveLatest(c, artifacts.KindHeaders)
+}
+
+// serveLatest streams the decoded content of the latest artifact of the
+// given kind for the scan in the :id parameter.
+func (h *ArtifactHandler) serveLatest(c *gin.Context, kind string) {
+	scanUUID, ok := h.ownedScanID(c)
+	if !ok {
+		return
+	}
+
+	artifact, ok := h.latestArtifact(c, scanUUID, kind)
+	if !ok {
+		return
+	}
+
+	file, err := h.store.Get(c.Request.Context(), artifact.StorageKey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to open artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read artifact"})
+		return
+	}
+	defer file.Close()
+
+	content, err := artifacts.Decode(file, artifact.Encoding)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to decode artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read artifact"})
+		return
+	}
+
+	c.Header("Content-Type", artifact.ContentType)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, content); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to stream artifact", "storage_key", artifact.StorageKey, "error", err)
+	}
+}
+
+// HandleListHAREntries lists the requests of the latest HAR capture,
+// filtered by ?method=, ?url= (substring), ?status= and ?mime_type=
+// (substring), and paginated with ?limit= and ?offset=.
+func (h *ArtifactHandler) HandleListHAREntries(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := artifacts.HARFilter{
+		Method:   c.Query("method"),
+		URL:      c.Query("url"),
+		MimeType: c.Query("mime_type"),
+	}
+	if v := c.Query("status"); v != "" {
+		filter.Status, err = strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be an HTTP status code"})
+			return
+		}
+	}
+
+	har, ok := h.loadHAR(c)
+	if !ok {
+		return
+	}
+
+	entries, err := har.Filter(filter)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to read HAR entries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Malformed HAR capture"})
+		return
+	}
+
+	total := len(entries)
+	start := min(offset, total)
+	end := min(offset+limit, total)
+	c.JSON(http.StatusOK, gin.H{
+		"items":  entries[start:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleGetHAREntry returns a single entry of the latest HAR capture
+// exactly as it was captured, including headers and bodies.
+func (h *ArtifactHandler) HandleGetHAREntry(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry index"})
+		return
+	}
+
+	har, ok := h.loadHAR(c)
+	if !ok {
+		return
+	}
+	if index >= len(har.Entries) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HAR entry not found"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", har.Entries[index])
+}
+
+// loadHAR reads and parses the latest HAR capture of the scan in the :id
+// parameter. On failure an error response is written and ok is false.
+func (h *ArtifactHandler) loadHAR(c *gin.Context) (*artifacts.HAR, bool) {
+	scanUUID, ok := h.ownedScanID(c)
+	if !ok {
+		return nil, false
+	}
+
+	artifact, ok := h.latestArtifact(c, scanUUID, artifacts.KindHAR)
+	if !ok {
+		return nil, false
+	}
+
+	file, err := h.store.Get(c.Request.Context(), artifact.StorageKey)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to open artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read HAR capture"})
+		return nil, false
+	}
+	defer file.Close()
+
+	content, err := artifacts.Decode(file, artifact.Encoding)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to decode artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read HAR capture"})
+		return nil, false
+	}
+
+	har, err := artifacts.ParseHAR(content)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to parse artifact", "storage_key", artifact.StorageKey, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Malformed HAR capture"})
+		return nil, false
+	}
+	return har, true
+}
+
+// ownedScanID parses the :id parameter and checks that the current user
+// can read the scan (see scanAccess). On failure an error response is written and ok is false.
+func (h *ArtifactHandler) ownedScanID(c *gin.Context) (uuid.UUID, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return uuid.Nil, false
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return uuid.Nil, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return uuid.Nil, false
+	}
+	return scanUUID, true
+}
+
+// latestArtifact returns the most recent artifact of the given kind. On
+// failure an error response is written and ok is false.
+func (h *ArtifactHandler) latestArtifact(c *gin.Context, scanUUID uuid.UUID, kind string) (*models.Artifact, bool) {
+	var artifact models.Artifact
+	err := h.db.Where("scan_id = ? AND kind = ?", scanUUID, kind).Order("created_at DESC").First(&artifact).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No " + kind + " artifact for this scan"})
+			return nil, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up artifact of scan", "kind", kind, "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &artifact, true
+}
+
+// errUnknownArtifact is returned when a result references an artifact that
+// was not uploaded for the same scan.
+var errUnknownArtifact = errors.New("artifact_id does not reference an artifact of this scan")
+
+// checkArtifactRefs verifies that every artifact referenced by the results
+// belongs to the scan.
+func checkArtifactRefs(db *gorm.DB, scanUUID uuid.UUID, results []models.ScanResult) error {
+	ids := map[uuid.UUID]bool{}
+	for _, r := range results {
+		if r.ArtifactID != nil {
+			ids[*r.ArtifactID] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	list := make([]uuid.UUID, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	var count int64
+	if err := db.Model(&models.Artifact{}).Where("scan_id = ? AND id IN ?", scanUUID, list).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(list) {
+		return errUnknownArtifact
+	}
+	return nil
+}
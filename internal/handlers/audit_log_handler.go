@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/audit"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxAuditLogListLimit bounds the entries returned by one listing.
+const maxAuditLogListLimit = 500
+
+// recordAudit appends an action of the request's user to the audit log,
+// in tx so that it is committed together with the action. Actions taken
+// with an API key name the key in the details.
+func recordAudit(tx *gorm.DB, c *gin.Context, action, targetType, targetID string, details gin.H) error {
+	entry := audit.Entry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if userUUID, err := uuid.Parse(c.GetString("userID")); err == nil {
+		entry.ActorID = &userUUID
+	}
+	if keyID := c.GetString("apiKeyID"); keyID != "" {
+		if details == nil {
+			details = gin.H{}
+		}
+		details["api_key_id"] = keyID
+	}
+	if details != nil {
+		entry.Details = details
+	}
+	return audit.Record(tx, entry)
+}
+
+// HandleListAuditLog lists audit log entries in order, starting after
+// ?after_seq= (default: from the beginning), up to ?limit= (default 100).
+// ?action= restricts the listing to one action.
+func (h *AdminHandler) HandleListAuditLog(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLogListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAuditLogListLimit)})
+			return
+		}
+		limit = n
+	}
+	var afterSeq int64
+	if v := c.Query("after_seq"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "after_seq must be a non-negative integer"})
+			return
+		}
+		afterSeq = n
+	}
+
+	q := h.db.Where("seq > ?", afterSeq)
+	if action := c.Query("action"); action != "" {
+		q = q.Where("action = ?", action)
+	}
+	entries := make([]models.AuditLogEntry, 0)
+	if err := q.Order("seq").Limit(limit).Find(&entries).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list audit log", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// HandleVerifyAuditLog checks the hash chain of the whole audit log. The
+// response is 200 either way; "valid" tells whether the log is intact.
+func (h *AdminHandler) HandleVerifyAuditLog(c *gin.Context) {
+	res, err := audit.Verify(h.db.WithContext(c.Request.Context()))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to verify audit log", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !res.Valid {
+		slog.WarnContext(c.Request.Context(), "Audit log verification failed", "seq", res.FirstInvalidSeq, "problem", res.Problem)
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -1,17 +1,18 @@
 package handlers
 
 import (
-	"errors"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/mail"
 	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/sealedclaims"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -30,7 +31,10 @@ type UpdatePasswordRequest struct {
 }
 
 type AuthHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	mailer   mail.Mailer
+	renderer *mail.Renderer
+	cfg      *config.Config
 }
 
 type RegisterRequest struct {
@@ -44,9 +48,12 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required,min=8"`
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, mailer mail.Mailer, renderer *mail.Renderer, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		db: db,
+		db:       db,
+		mailer:   mailer,
+		renderer: renderer,
+		cfg:      cfg,
 	}
 }
 
@@ -54,12 +61,11 @@ func (h *AuthHandler) DB() *gorm.DB {
 	return h.db
 }
 
-func (h *AuthHandler) GenerateToken(userID string, role string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", errors.New("JWT_SECRET is not defined in environment variables")
-	}
+// sessionTTL is the lifetime of a session and its token.
+const sessionTTL = time.Hour
 
+// GenerateToken issues the token of a session (see models.Session).
+func (h *AuthHandler) GenerateToken(userID string, role string, sessionID string) (string, error) {
 	normalizedRole := strings.ToLower(strings.TrimSpace(role))
 	if normalizedRole == "" {
 		normalizedRole = models.UserRoleUser
@@ -68,14 +74,20 @@ func (h *AuthHandler) GenerateToken(userID string, role string) (string, error)
 	claims := jwt.MapClaims{
 		"sub":  userID,
 		"role": normalizedRole,
-		"exp":  time.Now().Add(time.Hour * 1).Unix(),
+		"sid":  sessionID,
+		"exp":  time.Now().Add(sessionTTL).Unix(),
 		"iat":  time.Now().Unix(),
 		"iss":  "backend-antiginx",
 	}
+	if h.cfg.JWTClaimsKey != nil {
+		if err := sealClaims(claims, h.cfg.JWTClaimsKey); err != nil {
+			return "", err
+		}
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	signedToken, err := token.SignedString([]byte(secret))
+	signedToken, err := token.SignedString([]byte(h.cfg.JWTSecret))
 	if err != nil {
 		return "", err
 	}
@@ -83,12 +95,35 @@ func (h *AuthHandler) GenerateToken(userID string, role string) (string, error)
 	return signedToken, nil
 }
 
+// sensitiveClaims are the claims that are encrypted when
+// cfg.JWTClaimsKey is set. Claims describing the user's access belong
+// here.
+var sensitiveClaims = []string{"role"}
+
+// sealClaims moves the sensitive claims of a token into one encrypted
+// claim (see sealedclaims).
+func sealClaims(claims jwt.MapClaims, key sealedclaims.Key) error {
+	sensitive := map[string]interface{}{}
+	for _, name := range sensitiveClaims {
+		if v, ok := claims[name]; ok {
+			sensitive[name] = v
+			delete(claims, name)
+		}
+	}
+	sealed, err := key.Seal(claims["sub"].(string), sensitive)
+	if err != nil {
+		return err
+	}
+	claims[sealedclaims.Claim] = sealed
+	return nil
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	var existingUser models.User
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Binding error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.WarnContext(c.Request.Context(), "Binding error", "error", err)
+		respondBindingError(c, err)
 		return
 	}
 
@@ -106,15 +141,15 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	newUserID, err := uuid.NewV7()
 	if err != nil {
-		log.Printf("Failed to generate UUIDv7: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	passwordBytes := []byte(req.Password)
 
-	HashedPassword, err := bcrypt.GenerateFromPassword(passwordBytes, 12)
+	HashedPassword, err := bcrypt.GenerateFromPassword(passwordBytes, h.cfg.BcryptCost)
 	if err != nil {
-		log.Printf("Failed to encrypt provided password: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to encrypt provided password", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -130,7 +165,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	resultCreateNewUser := h.db.Create(&newUser)
 	if resultCreateNewUser.Error != nil {
-		log.Printf("Failed to create new user in DB: %v", resultCreateNewUser.Error)
+		slog.ErrorContext(c.Request.Context(), "Failed to create new user in DB", "error", resultCreateNewUser.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new user"})
 		return
 	}
@@ -143,8 +178,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	var existingUser models.User
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Binding error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		slog.WarnContext(c.Request.Context(), "Binding error", "error", err)
+		respondBindingError(c, err)
 		return
 	}
 
@@ -165,19 +200,52 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	if existingUser.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	session, err := h.newSession(c, existingUser.ID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	newDevice, err := h.isNewDevice(session)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check login device", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if newDevice && h.cfg.NewDeviceLogins == config.NewDeviceLoginConfirm {
+		h.startLoginChallenge(c, existingUser, session)
+		return
+	}
+	if err := h.db.Create(&session).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if newDevice {
+		h.notifyNewLogin(existingUser, session)
+	}
 
-	token, err := h.GenerateToken(existingUser.ID.String(), existingUser.Role)
+	h.respondWithToken(c, existingUser, session)
+}
+
+// respondWithToken answers a login with the token of session.
+func (h *AuthHandler) respondWithToken(c *gin.Context, user models.User, session models.Session) {
+	token, err := h.GenerateToken(user.ID.String(), user.Role, session.ID.String())
 	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to generate token", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"token":      token,
-		"expires_in": 3600,
+		"expires_in": int(sessionTTL.Seconds()),
 	})
-
 }
 
 func (h *AuthHandler) Me(c *gin.Context) {
@@ -228,7 +296,7 @@ func (h *AuthHandler) HandleUpdateFullName(c *gin.Context) {
 
 	var req UpdateNameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(c, err)
 		return
 	}
 
@@ -263,7 +331,7 @@ func (h *AuthHandler) HandleUpdateEmail(c *gin.Context) {
 
 	var req UpdateEmailRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(c, err)
 		return
 	}
 
@@ -291,6 +359,8 @@ func (h *AuthHandler) HandleUpdateEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Email updated successfully"})
 }
 
+// HandleUpdatePassword changes the current user's password and signs out
+// their other sessions.
 func (h *AuthHandler) HandleUpdatePassword(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -306,7 +376,7 @@ func (h *AuthHandler) HandleUpdatePassword(c *gin.Context) {
 
 	var req UpdatePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(c, err)
 		return
 	}
 
@@ -321,14 +391,23 @@ func (h *AuthHandler) HandleUpdatePassword(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.cfg.BcryptCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash new password"})
 		return
 	}
 	user.Password = hashedPassword
 
-	if err := h.db.Save(&user).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := revokeSessions(tx, user.ID, c.GetString("sessionID")); err != nil {
+			return err
+		}
+		return invalidateResetTokens(tx, user.ID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
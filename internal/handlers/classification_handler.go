@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ClassificationItem labels the findings of one test.
+type ClassificationItem struct {
+	TestName string `json:"test_name" binding:"required"`
+	Label    string `json:"label" binding:"required"`
+}
+
+// UpdateClassificationsRequest replaces all of the user's classification
+// labels. Tests left out are public.
+type UpdateClassificationsRequest struct {
+	Classifications []ClassificationItem `json:"classifications" binding:"dive"`
+}
+
+// includeConfidential reports whether an export request explicitly asks
+// for confidential findings with ?include_confidential=true.
+func includeConfidential(c *gin.Context) bool {
+	include, _ := strconv.ParseBool(c.Query("include_confidential"))
+	return include
+}
+
+// HandleListClassifications returns the current user's data classification
+// labels.
+func (h *FindingHandler) HandleListClassifications(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	labels := make([]models.DataClassification, 0)
+	if err := h.db.Where("user_id = ?", userUUID).Order("test_name").Find(&labels).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list data classifications", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"classifications": labels,
+		"labels":          classification.Labels,
+	})
+}
+
+// HandleUpdateClassifications replaces the current user's data
+// classification labels.
+func (h *FindingHandler) HandleUpdateClassifications(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	items, ok := bindClassifications(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	labels := make([]models.DataClassification, 0, len(items))
+	for _, item := range items {
+		labels = append(labels, models.DataClassification{
+			UserID:    userUUID,
+			TestName:  item.TestName,
+			Label:     item.Label,
+			UpdatedAt: now,
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userUUID).Delete(&models.DataClassification{}).Error; err != nil {
+			return err
+		}
+		if len(labels) == 0 {
+			return nil
+		}
+		return tx.Create(&labels).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update data classifications", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update data classifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classifications": labels,
+		"labels":          classification.Labels,
+	})
+}
+
+// HandleListOrganizationClassifications returns the data classification
+// labels of one of the current user's organizations.
+func (h *FindingHandler) HandleListOrganizationClassifications(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	labels := make([]models.OrganizationClassification, 0)
+	if err := h.db.Where("organization_id = ?", orgID).Order("test_name").Find(&labels).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list data classifications", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"classifications": labels,
+		"labels":          classification.Labels,
+	})
+}
+
+// HandleUpdateOrganizationClassifications replaces the data classification
+// labels of an organization the current user owns. They apply to the
+// findings of all its members.
+func (h *FindingHandler) HandleUpdateOrganizationClassifications(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "classify findings")
+	if !ok {
+		return
+	}
+	items, ok := bindClassifications(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	labels := make([]models.OrganizationClassification, 0, len(items))
+	for _, item := range items {
+		labels = append(labels, models.OrganizationClassification{
+			OrganizationID: orgID,
+			TestName:       item.TestName,
+			Label:          item.Label,
+			UpdatedAt:      now,
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.OrganizationClassification{}).Error; err != nil {
+			return err
+		}
+		if len(labels) == 0 {
+			return nil
+		}
+		return tx.Create(&labels).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update data classifications", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update data classifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classifications": labels,
+		"labels":          classification.Labels,
+	})
+}
+
+// bindClassifications binds an UpdateClassificationsRequest and returns its
+// labels with lowercase test names and labels, leaving out public ones.
+// If the request is invalid an error response is written and ok is false.
+func bindClassifications(c *gin.Context) ([]ClassificationItem, bool) {
+	var req UpdateClassificationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return nil, false
+	}
+
+	items := make([]ClassificationItem, 0, len(req.Classifications))
+	seen := map[string]bool{}
+	for _, item := range req.Classifications {
+		test := strings.ToLower(strings.TrimSpace(item.TestName))
+		label := strings.ToLower(item.Label)
+		if !slices.Contains(classification.Labels, label) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported label %q", item.Label), "labels": classification.Labels})
+			return nil, false
+		}
+		if seen[test] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Test %q is listed more than once", test)})
+			return nil, false
+		}
+		seen[test] = true
+		if label != classification.Public {
+			items = append(items, ClassificationItem{TestName: test, Label: label})
+		}
+	}
+	return items, true
+}
@@ -0,0 +1,255 @@
+package handlers
+
+// Contract tests for the messages exchanged with scan workers.
+//
+// testdata/contract holds one directory per schema version with a recorded
+// example of every message. Fixtures of released versions are frozen: the
+// current structs must still decode them without losing a field, so workers
+// that haven't been upgraded keep working. The latest version is a golden
+// file of what the backend produces today; after an intentional change run
+//
+//	go test ./internal/handlers -run TestContract -update
+//
+// and, if older workers can't read the new output, add a new version
+// directory instead of editing an existing one.
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden contract fixtures of the latest version")
+
+const contractDir = "testdata/contract"
+
+// contractVersions lists the schema versions, oldest first.
+var contractVersions = []string{"v1", "v2"}
+
+// contractMessage is a message type covered by the fixtures.
+type contractMessage struct {
+	File string
+	New  func() interface{}
+	// Validate runs the binding validation the API applies on receipt.
+	Validate bool
+	// Golden is the value the latest fixture must encode.
+	Golden interface{}
+}
+
+const (
+	contractScanID     = "0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b"
+	contractArtifactID = "0190a3b2-9d8e-7f6a-8b5c-4d3e2f1a0b9c"
+)
+
+var contractMessages = []contractMessage{
+	{
+		File: "scan_task.json",
+		New:  func() interface{} { return &ScanTaskPayload{} },
+		Golden: ScanTaskPayload{
+			Target:      "https://example.com",
+			Parameters:  []CommandParameter{{Name: "--tests", Arguments: []string{"https", "hsts", "csp"}}},
+			UploadToken: "agu_" + contractScanID + ".1748786400.3f1c0e5a9b7d2c4e6f8a0b1c3d5e7f9a2b4c6d8e0f1a3b5c7d9e1f2a4b6c8d0e",
+		},
+	},
+	{
+		File: "scan_task_message.json",
+		New:  func() interface{} { return &ScanTaskMessage{} },
+		Golden: ScanTaskMessage{
+			ID:        contractScanID,
+			TargetURL: "https://example.com",
+			Profile:   "custom",
+			Tests:     []string{"https", "hsts", "csp"},
+		},
+	},
+	{
+		File:     "async_result.json",
+		New:      func() interface{} { return &AsyncResultRequest{} },
+		Validate: true,
+		Golden: AsyncResultRequest{
+			Target: "https://example.com",
+			TestID: contractScanID,
+			Result: EngineTestResult{
+				Name:        "HSTS",
+				Certainty:   90,
+				ThreatLevel: "HIGH",
+				Metadata:    map[string]interface{}{"header": "max-age=300"},
+				Description: "Strict-Transport-Security max-age is shorter than one year",
+			},
+			ResultType: Success,
+			ArtifactID: contractArtifactID,
+		},
+	},
+	{
+		File:     "result_submission.json",
+		New:      func() interface{} { return &ResultSubmissionRequest{} },
+		Validate: true,
+		Golden: ResultSubmissionRequest{
+			ScanID:      contractScanID,
+			Status:      "COMPLETED",
+			StartedAt:   time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+			CompletedAt: time.Date(2025, 6, 1, 12, 3, 30, 0, time.UTC),
+			Results: []ScanResultItem{
+				{
+					TestID:      "hsts",
+					TestName:    "HSTS",
+					Category:    "Transport Security",
+					Severity:    "HIGH",
+					Message:     "Strict-Transport-Security max-age is shorter than one year",
+					Reference:   "https://developer.mozilla.org/docs/Web/HTTP/Headers/Strict-Transport-Security",
+					Remediation: "Set max-age to at least 31536000",
+					ArtifactID:  contractArtifactID,
+				},
+				{
+					TestID:   "https",
+					TestName: "HTTPS",
+					Category: "Transport Security",
+					Severity: "INFO",
+					Passed:   true,
+					Message:  "Site is served over HTTPS",
+				},
+			},
+		},
+	},
+}
+
+// TestContractFixturesDecode checks that the current structs read the
+// fixtures of every version strictly and without dropping data.
+func TestContractFixturesDecode(t *testing.T) {
+	for _, version := range contractVersions {
+		for _, msg := range contractMessages {
+			t.Run(version+"/"+msg.File, func(t *testing.T) {
+				raw, err := os.ReadFile(filepath.Join(contractDir, version, msg.File))
+				if err != nil {
+					t.Fatalf("read fixture: %v", err)
+				}
+
+				v := msg.New()
+				dec := json.NewDecoder(bytes.NewReader(raw))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(v); err != nil {
+					t.Fatalf("fixture does not decode into %T: %v", v, err)
+				}
+
+				if msg.Validate {
+					if err := binding.Validator.ValidateStruct(v); err != nil {
+						t.Fatalf("fixture fails validation: %v", err)
+					}
+				}
+
+				reencoded, err := json.Marshal(v)
+				if err != nil {
+					t.Fatalf("re-encode: %v", err)
+				}
+				var want, got interface{}
+				if err := json.Unmarshal(raw, &want); err != nil {
+					t.Fatalf("fixture is not valid JSON: %v", err)
+				}
+				if err := json.Unmarshal(reencoded, &got); err != nil {
+					t.Fatalf("re-encoded value is not valid JSON: %v", err)
+				}
+				if path, ok := containsJSON(got, want, "$"); !ok {
+					t.Errorf("%s of the fixture is lost or changed by %T", path, v)
+				}
+			})
+		}
+	}
+}
+
+// TestContractGolden checks that the backend still produces the latest
+// version of every message byte for byte.
+func TestContractGolden(t *testing.T) {
+	latest := contractVersions[len(contractVersions)-1]
+	for _, msg := range contractMessages {
+		t.Run(latest+"/"+msg.File, func(t *testing.T) {
+			got, err := json.MarshalIndent(msg.Golden, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join(contractDir, latest, msg.File)
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatalf("write golden file: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from the current encoding (run with -update after an intentional change):\n--- want\n%s\n--- got\n%s", path, want, got)
+			}
+		})
+	}
+}
+
+// TestContractResultSubmissionStream checks that the streaming decoder of
+// HandleResultSubmission accepts the scalar fields of every recorded
+// submission.
+func TestContractResultSubmissionStream(t *testing.T) {
+	for _, version := range contractVersions {
+		t.Run(version, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join(contractDir, version, "result_submission.json"))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				t.Fatalf("fixture is not a JSON object: %v", err)
+			}
+			delete(fields, "results")
+
+			var header resultSubmissionHeader
+			if err := decodeFields(fields, &header); err != nil {
+				t.Fatalf("header does not decode: %v", err)
+			}
+		})
+	}
+}
+
+// containsJSON reports whether every value in want is present and equal in
+// got; got may hold extra fields. On mismatch it returns the path of the
+// first difference.
+func containsJSON(got, want interface{}, path string) (string, bool) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		for key, wv := range w {
+			gv, ok := g[key]
+			if !ok {
+				return path + "." + key, false
+			}
+			if p, ok := containsJSON(gv, wv, path+"."+key); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return path, false
+		}
+		for i := range w {
+			if p, ok := containsJSON(g[i], w[i], path+"["+strconv.Itoa(i)+"]"); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	default:
+		return path, reflect.DeepEqual(got, want)
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+// Retries and dead-lettering of scan tasks.
+//
+// A task a worker rejects is dead-lettered by scan_queue to retry_exchange
+// and lands in ScanRetryQueue. HandleRejectedTask sends it back to
+// scan_queue through WaitQueue, which holds it for a few seconds, until
+// it has been rejected cfg.ScanMaxAttempts times. The task then moves to
+// ScanDeadLetterQueue and its scan to FAILED. Admins can inspect the
+// dead-letter queue and requeue tasks from it.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// ScanQueue is the queue workers consume scan tasks from.
+const ScanQueue = "scan_queue"
+
+// Queues of the retry subsystem.
+const (
+	ScanRetryQueue      = "scan_retry_queue"
+	ScanDeadLetterQueue = "scan_dlq"
+	WaitQueue           = "wait_queue"
+)
+
+// Headers added to retried and dead-lettered tasks.
+const (
+	attemptsHeader      = "x-antiginx-attempts"
+	failureReasonHeader = "x-antiginx-failure-reason"
+)
+
+var errScanCancelled = errors.New("scan has been cancelled")
+
+// errScanFinished is returned when a worker ends a scan that has already
+// ended.
+var errScanFinished = errors.New("scan has already finished")
+
+// maxDeadLetterListLimit bounds the tasks returned by one listing.
+const maxDeadLetterListLimit = 500
+
+// DeadLetterTask is a task in the dead-letter queue.
+type DeadLetterTask struct {
+	MessageID      string     `json:"message_id"`
+	ScanID         string     `json:"scan_id"`
+	Target         string     `json:"target"`
+	Attempts       int        `json:"attempts"`
+	Reason         string     `json:"reason"`
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
+}
+
+// taskScanID returns the scan ID of a task message.
+func taskScanID(body []byte) (uuid.UUID, ScanTaskPayload, error) {
+	var task ScanTaskPayload
+	if err := json.Unmarshal(body, &task); err != nil {
+		return uuid.Nil, task, err
+	}
+	for _, p := range task.Parameters {
+		if p.Name == "--taskId" && len(p.Arguments) == 1 {
+			id, err := uuid.Parse(p.Arguments[0])
+			return id, task, err
+		}
+	}
+	return uuid.Nil, task, errors.New("task has no --taskId")
+}
+
+// headerInt reads an integer header of any of the types AMQP tables use.
+func headerInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint8:
+		return int(n)
+	case uint16:
+		return int(n)
+	case uint32:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+// republished copies a delivery into a new message. The broker's own
+// dead-letter headers are dropped; the attempt count is tracked in
+// attemptsHeader instead.
+func republished(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		if k == "x-death" || strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-last-death-") {
+			continue
+		}
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		ContentType:  d.ContentType,
+		MessageId:    d.MessageId,
+		Timestamp:    d.Timestamp,
+		Priority:     d.Priority,
+		Body:         d.Body,
+	}
+}
+
+// HandleRejectedTask processes a task dead-lettered by scan_queue; it is a
+// queue.Handler for ScanRetryQueue.
+func (h *ScanHandler) HandleRejectedTask(ctx context.Context, d amqp.Delivery) error {
+	attempts := headerInt(d.Headers[attemptsHeader]) + 1
+	msg := republished(d)
+	msg.Headers[attemptsHeader] = int32(attempts)
+
+	if attempts < h.cfg.ScanMaxAttempts {
+		slog.InfoContext(ctx, "Retrying rejected scan task", "attempt", attempts, "max_attempts", h.cfg.ScanMaxAttempts)
+		return h.publisher.PublishWithContext(ctx, "", WaitQueue, false, false, msg)
+	}
+
+	reason := fmt.Sprintf("Task was rejected by workers %d times", attempts)
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	msg.Headers[failureReasonHeader] = reason
+	msg.Timestamp = time.Now()
+	if err := h.publisher.PublishWithContext(ctx, "", ScanDeadLetterQueue, false, false, msg); err != nil {
+		return err
+	}
+
+	scanUUID, _, err := taskScanID(d.Body)
+	if err != nil {
+		slog.WarnContext(ctx, "Dead-lettered a task without a scan ID", "message_id", msg.MessageId, "error", err)
+		return nil
+	}
+	slog.WarnContext(ctx, "Scan task dead-lettered", "scan_id", scanUUID, "message_id", msg.MessageId, "attempts", attempts)
+	// The task is already in the dead-letter queue, so a failure here must
+	// not requeue it.
+	if err := h.failScan(scanUUID, reason); err != nil {
+		slog.ErrorContext(ctx, "Failed to mark dead-lettered scan as failed", "scan_id", scanUUID, "error", err)
+	}
+	return nil
+}
+
+// failScan moves a scan that hasn't finished to FAILED.
+func (h *ScanHandler) failScan(scanUUID uuid.UUID, reason string) error {
+	isPremium, status, err := findScan(h.db, scanUUID)
+	if err != nil {
+		return err
+	}
+	if scanFinished(status) {
+		return nil
+	}
+
+	var failed bool
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(scanModel(scanUUID, isPremium)).
+			Where("status = ?", status).
+			Updates(map[string]interface{}{
+				"status":       "FAILED",
+				"completed_at": time.Now(),
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		failed = true
+		return recordScanEvent(tx, nil, scanUUID, status, "FAILED", reason)
+	})
+	if err != nil || !failed {
+		return err
+	}
+
+	h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "FAILED"})
+	if isPremium {
+		h.emitScanEvent(scanUUID, webhooks.EventScanFailed)
+	}
+	return nil
+}
+
+// browseDeadLetters takes up to limit tasks from the dead-letter queue
+// without acknowledging them and passes each to visit until it returns
+// true. Tasks visit doesn't acknowledge return to the queue.
+func (h *ScanHandler) browseDeadLetters(limit int, visit func(d amqp.Delivery) (bool, error)) error {
+	return h.publisher.Browse(ScanDeadLetterQueue, limit, visit)
+}
+
+// HandleListDeadLetters lists the tasks in the dead-letter queue, oldest
+// first, up to ?limit= (default 50).
+func (h *ScanHandler) HandleListDeadLetters(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeadLetterListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeadLetterListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	tasks := make([]DeadLetterTask, 0)
+	err := h.browseDeadLetters(limit, func(d amqp.Delivery) (bool, error) {
+		task := DeadLetterTask{
+			MessageID: d.MessageId,
+			Attempts:  headerInt(d.Headers[attemptsHeader]),
+		}
+		task.Reason, _ = d.Headers[failureReasonHeader].(string)
+		if !d.Timestamp.IsZero() {
+			ts := d.Timestamp
+			task.DeadLetteredAt = &ts
+		}
+		if scanUUID, payload, err := taskScanID(d.Body); err == nil {
+			task.ScanID = scanUUID.String()
+			task.Target = payload.Target
+		}
+		tasks = append(tasks, task)
+		return false, nil
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to read the dead-letter queue", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to read the dead-letter queue"})
+		return
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+// HandleRequeueDeadLetter sends a dead-lettered task back to the workers
+// with a fresh upload token and a reset attempt count. A failed scan is
+// moved back to PENDING.
+func (h *ScanHandler) HandleRequeueDeadLetter(c *gin.Context) {
+	messageID := c.Param("messageId")
+
+	var (
+		found    bool
+		scanUUID uuid.UUID
+	)
+	err := h.browseDeadLetters(maxDeadLetterListLimit, func(d amqp.Delivery) (bool, error) {
+		if d.MessageId != messageID {
+			return false, nil
+		}
+		found = true
+
+		var (
+			task ScanTaskPayload
+			err  error
+		)
+		scanUUID, task, err = taskScanID(d.Body)
+		if err != nil {
+			return true, fmt.Errorf("decoding task: %w", err)
+		}
+		_, status, err := findScan(h.db, scanUUID)
+		if err != nil {
+			return true, err
+		}
+		if status == "CANCELLED" {
+			return true, errScanCancelled
+		}
+
+		task.UploadToken = h.cfg.UploadTokens().Issue(scanUUID)
+		body, err := json.Marshal(task)
+		if err != nil {
+			return true, err
+		}
+		err = h.publisher.PublishWithContext(c.Request.Context(), "main_exchange", "scan_key", false, false, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			MessageId:    d.MessageId,
+			Priority:     d.Priority,
+			Body:         body,
+		})
+		if err != nil {
+			return true, err
+		}
+		return true, d.Ack(false)
+	})
+	switch {
+	case errors.Is(err, errScanCancelled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan has been cancelled"})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan of the task not found"})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to requeue dead-lettered task", "message_id", messageID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to requeue task"})
+		return
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found in the dead-letter queue"})
+		return
+	}
+
+	if err := h.resetFailedScan(c, scanUUID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reset requeued scan", "scan_id", scanUUID, "error", err)
+	}
+	// The task has left the dead-letter queue, so the requeue is recorded
+	// even if the scan couldn't be reset.
+	if err := recordAudit(h.db, c, models.AuditDeadLetterRequeued, "scan", scanUUID.String(), gin.H{"message_id": messageID}); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record requeue in the audit log", "scan_id", scanUUID, "error", err)
+	}
+	slog.InfoContext(c.Request.Context(), "Dead-lettered task requeued", "scan_id", scanUUID, "message_id", messageID)
+	c.JSON(http.StatusAccepted, gin.H{"scan_id": scanUUID, "status": "PENDING"})
+}
+
+// resetFailedScan moves a FAILED scan back to PENDING after its task was
+// requeued.
+func (h *ScanHandler) resetFailedScan(c *gin.Context, scanUUID uuid.UUID) error {
+	isPremium, _, err := findScan(h.db, scanUUID)
+	if err != nil {
+		return err
+	}
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(scanModel(scanUUID, isPremium)).
+			Where("status = ?", "FAILED").
+			Updates(map[string]interface{}{
+				"status":       "PENDING",
+				"completed_at": nil,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordScanEvent(tx, c, scanUUID, "FAILED", "PENDING", "Requeued from the dead-letter queue")
+	})
+}
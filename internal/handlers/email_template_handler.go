@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type EmailTemplateHandler struct {
+	db       *gorm.DB
+	renderer *mail.Renderer
+}
+
+type EmailTemplateRequest struct {
+	Source string `json:"source" binding:"required"`
+}
+
+type EmailPreviewRequest struct {
+	Source string                 `json:"source"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+func NewEmailTemplateHandler(db *gorm.DB, renderer *mail.Renderer) *EmailTemplateHandler {
+	return &EmailTemplateHandler{
+		db:       db,
+		renderer: renderer,
+	}
+}
+
+func (h *EmailTemplateHandler) HandleListEmailTemplates(c *gin.Context) {
+	var overrides []string
+	if err := h.db.Model(&models.EmailTemplate{}).Pluck("name", &overrides).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list email template overrides", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list email templates"})
+		return
+	}
+	overridden := map[string]bool{}
+	for _, name := range overrides {
+		overridden[name] = true
+	}
+
+	templates := make([]gin.H, 0)
+	for _, name := range mail.Names() {
+		templates = append(templates, gin.H{"name": name, "overridden": overridden[name]})
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func (h *EmailTemplateHandler) HandleGetEmailTemplate(c *gin.Context) {
+	name := c.Param("name")
+
+	source, overridden, err := h.renderer.Source(name)
+	if err != nil {
+		h.respondTemplateError(c, err)
+		return
+	}
+	defaultSource, _ := mail.DefaultSource(name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":           name,
+		"source":         source,
+		"overridden":     overridden,
+		"default_source": defaultSource,
+	})
+}
+
+func (h *EmailTemplateHandler) HandleUpdateEmailTemplate(c *gin.Context) {
+	adminUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	if _, err := mail.DefaultSource(name); err != nil {
+		h.respondTemplateError(c, err)
+		return
+	}
+
+	var req EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	// Render with sample data so templates referencing missing fields or
+	// calling functions incorrectly are rejected before they go live.
+	if _, err := mail.RenderSource(req.Source, "preview@example.com", mail.SampleData()[name]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	override := models.EmailTemplate{
+		Name:      name,
+		Source:    req.Source,
+		UpdatedBy: adminUUID,
+		UpdatedAt: time.Now(),
+	}
+	if err := h.db.Save(&override).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save email template", "template", name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// HandleResetEmailTemplate removes an override, restoring the default.
+func (h *EmailTemplateHandler) HandleResetEmailTemplate(c *gin.Context) {
+	if err := h.db.Delete(&models.EmailTemplate{}, "name = ?", c.Param("name")).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reset email template", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset email template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email template reset to default"})
+}
+
+// HandlePreviewEmailTemplate renders a template with sample data. An
+// optional source previews unsaved changes and optional data replaces the
+// sample data.
+func (h *EmailTemplateHandler) HandlePreviewEmailTemplate(c *gin.Context) {
+	name := c.Param("name")
+
+	var req EmailPreviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindingError(c, err)
+			return
+		}
+	}
+
+	source := req.Source
+	if source == "" {
+		var err error
+		source, _, err = h.renderer.Source(name)
+		if err != nil {
+			h.respondTemplateError(c, err)
+			return
+		}
+	}
+
+	var data interface{} = mail.SampleData()[name]
+	if req.Data != nil {
+		data = req.Data
+	}
+
+	msg, err := mail.RenderSource(source, "preview@example.com", data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject": msg.Subject,
+		"text":    msg.Text,
+		"html":    msg.HTML,
+	})
+}
+
+func (h *EmailTemplateHandler) respondTemplateError(c *gin.Context, err error) {
+	if errors.Is(err, mail.ErrUnknownTemplate) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email template not found"})
+		return
+	}
+	slog.ErrorContext(c.Request.Context(), "Failed to load email template", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load email template"})
+}
+
+// HandleListOrganizationEmailTemplates lists the templates an organization
+// the current user owns may override.
+func (h *EmailTemplateHandler) HandleListOrganizationEmailTemplates(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "manage email templates")
+	if !ok {
+		return
+	}
+
+	var overrides []string
+	if err := h.db.Model(&models.OrganizationEmailTemplate{}).Where("organization_id = ?", orgID).Pluck("name", &overrides).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list email template overrides", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list email templates"})
+		return
+	}
+
+	templates := make([]gin.H, 0, len(mail.OrganizationTemplates))
+	for _, name := range mail.OrganizationTemplates {
+		templates = append(templates, gin.H{"name": name, "overridden": slices.Contains(overrides, name)})
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// HandleGetOrganizationEmailTemplate returns the source of a template for
+// the emails of an organization the current user owns.
+func (h *EmailTemplateHandler) HandleGetOrganizationEmailTemplate(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "manage email templates")
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+
+	source, overridden, err := h.renderer.OrganizationSource(orgID, name)
+	if err != nil {
+		h.respondTemplateError(c, err)
+		return
+	}
+	defaultSource, _, err := h.renderer.Source(name)
+	if err != nil {
+		h.respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":           name,
+		"source":         source,
+		"overridden":     overridden,
+		"default_source": defaultSource,
+	})
+}
+
+// HandleUpdateOrganizationEmailTemplate overrides a template for the
+// emails of an organization the current user owns.
+func (h *EmailTemplateHandler) HandleUpdateOrganizationEmailTemplate(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "manage email templates")
+	if !ok {
+		return
+	}
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	if !slices.Contains(mail.OrganizationTemplates, name) {
+		h.respondTemplateError(c, mail.ErrUnknownTemplate)
+		return
+	}
+
+	var req EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if _, err := mail.RenderSource(req.Source, "preview@example.com", mail.SampleData()[name]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	override := models.OrganizationEmailTemplate{
+		OrganizationID: orgID,
+		Name:           name,
+		Source:         req.Source,
+		UpdatedBy:      userUUID,
+		UpdatedAt:      time.Now(),
+	}
+	if err := h.db.Save(&override).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save email template", "organization_id", orgID, "template", name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// HandleResetOrganizationEmailTemplate removes an organization's override,
+// restoring the template used for all organizations.
+func (h *EmailTemplateHandler) HandleResetOrganizationEmailTemplate(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "manage email templates")
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&models.OrganizationEmailTemplate{}, "organization_id = ? AND name = ?", orgID, c.Param("name")).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reset email template", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset email template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email template reset to default"})
+}
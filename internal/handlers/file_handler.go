@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+)
+
+type FileHandler struct {
+	local *storage.LocalStore
+}
+
+// NewFileHandler creates the handler serving signed downloads of the local
+// storage driver. With any other driver signed URLs point directly at the
+// object storage and this handler answers 404.
+func NewFileHandler(store storage.Store) *FileHandler {
+	local, _ := store.(*storage.LocalStore)
+	return &FileHandler{
+		local: local,
+	}
+}
+
+// HandleDownload serves a file referenced by a signed URL issued by
+// storage.LocalStore.SignedURL. No authentication is required: the
+// signature and expiry are the authorization.
+func (h *FileHandler) HandleDownload(c *gin.Context) {
+	if h.local == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	filename := c.Query("filename")
+	if !h.local.Verify(key, c.Query("expires"), filename, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download link"})
+		return
+	}
+
+	file, err := h.local.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to open file", "storage_key", key, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if filename == "" {
+		filename = path.Base(key)
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "private, no-store")
+	// Stored files may contain attacker-influenced content (e.g. scan
+	// artifacts), so never let the browser run anything from them.
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src 'self'; sandbox")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to stream file", "storage_key", key, "error", err)
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/sla"
+	"gorm.io/gorm"
+)
+
+// Bulk triage actions.
+const (
+	FindingActionAcknowledge = "acknowledge"
+	FindingActionSuppress    = "suppress"
+	FindingActionReopen      = "reopen"
+	FindingActionFix         = "fix"
+	FindingActionAssign      = "assign"
+	FindingActionUnassign    = "unassign"
+)
+
+// Per-item outcomes of a bulk request.
+const (
+	BulkOutcomeUpdated  = "updated"
+	BulkOutcomeNotFound = "not_found"
+)
+
+// Result orderings selected with ?sort=.
+const (
+	ResultSortNewest   = "newest"
+	ResultSortSeverity = "severity"
+)
+
+type FindingHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+// FindingItem is a finding with its SLA state and data classification; SLA
+// is null when no SLA applies to the finding.
+type FindingItem struct {
+	models.ScanResult
+	SLA            *sla.Finding `json:"sla"`
+	Classification string       `json:"classification"`
+}
+
+type FindingListResponse struct {
+	Items  []FindingItem `json:"items"`
+	Total  int64         `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// BulkFindingsRequest changes up to 500 findings in one request.
+type BulkFindingsRequest struct {
+	IDs        []uint `json:"ids" binding:"required,min=1,max=500"`
+	Action     string `json:"action" binding:"required,oneof=acknowledge suppress reopen fix assign unassign"`
+	AssigneeID string `json:"assignee_id" binding:"omitempty,uuid"`
+	Note       string `json:"note" binding:"max=2000"`
+}
+
+// BulkFindingOutcome reports what happened to a single finding.
+type BulkFindingOutcome struct {
+	ID      uint   `json:"id"`
+	Outcome string `json:"outcome"`
+}
+
+func NewFindingHandler(db *gorm.DB, cfg *config.Config) *FindingHandler {
+	return &FindingHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// ownedFindings scopes a query to findings of the user's scans.
+func ownedFindings(db *gorm.DB, userUUID uuid.UUID) *gorm.DB {
+	return db.Model(&models.ScanResult{}).
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id").
+		Where("premium_scans.user_id = ?", userUUID)
+}
+
+// visibleFindings scopes a query to findings of the scans the user can
+// read (see scanAccess). Only the findings of the user's own scans can be
+// triaged.
+func visibleFindings(db *gorm.DB, userUUID uuid.UUID) *gorm.DB {
+	return scanAccess(db.Model(&models.ScanResult{}).
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id"), userUUID)
+}
+
+// applyFindingFilters applies the finding list filters:
+//
+//   - severity, test_name, triage_status: comma-separated lists
+//   - passed: true or false
+//   - target: case-insensitive substring of the scan's target URL
+//   - scan_id: findings of a single scan
+//   - assignee_id: a user ID, or "none" for unassigned findings
+func applyFindingFilters(params url.Values, query *gorm.DB) (*gorm.DB, error) {
+	if values := splitList(params.Get("severity"), strings.ToLower); len(values) > 0 {
+		query = query.Where("LOWER(scan_results.severity) IN ?", values)
+	}
+	if values := splitList(params.Get("test_name"), strings.ToLower); len(values) > 0 {
+		query = query.Where("LOWER(scan_results.test_name) IN ?", values)
+	}
+	if values := splitList(params.Get("triage_status"), strings.ToLower); len(values) > 0 {
+		query = query.Where("scan_results.triage_status IN ?", values)
+	}
+
+	if raw := params.Get("passed"); raw != "" {
+		passed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("passed must be true or false")
+		}
+		query = query.Where("scan_results.passed = ?", passed)
+	}
+
+	if target := strings.TrimSpace(params.Get("target")); target != "" {
+		query = query.Where("LOWER(premium_scans.target_url) LIKE ?", "%"+escapeLike(strings.ToLower(target))+"%")
+	}
+
+	if raw := params.Get("scan_id"); raw != "" {
+		scanUUID, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("scan_id must be a UUID")
+		}
+		query = query.Where("scan_results.scan_id = ?", scanUUID)
+	}
+
+	switch raw := params.Get("assignee_id"); raw {
+	case "":
+	case "none":
+		query = query.Where("scan_results.assignee_id IS NULL")
+	default:
+		assignee, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("assignee_id must be a UUID or \"none\"")
+		}
+		query = query.Where("scan_results.assignee_id = ?", assignee)
+	}
+
+	return query, nil
+}
+
+// resultOrder returns the ORDER BY clause of a ?sort= value for results;
+// ResultSortSeverity puts critical results first. An empty value selects
+// def.
+func resultOrder(sort, def string) (string, error) {
+	switch strings.ToLower(sort) {
+	case "":
+		return def, nil
+	case ResultSortNewest:
+		return "scan_results.id DESC", nil
+	case ResultSortSeverity:
+		return "scan_results.severity_rank DESC, scan_results.id", nil
+	default:
+		return "", fmt.Errorf("sort must be %q or %q", ResultSortNewest, ResultSortSeverity)
+	}
+}
+
+// preloadResults preloads the results of scans in the order selected by
+// ?sort=. On an invalid value an error response is written and ok is false.
+func preloadResults(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	order, err := resultOrder(c.Query("sort"), "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return db.Preload("Results", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order(order)
+	}), true
+}
+
+func splitList(raw string, normalize func(string) string) []string {
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		if s = normalize(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// HandleListFindings returns a page of findings across the current user's
+// scans, each with its SLA state. They are listed newest first, or most
+// severe first with ?sort=severity. See applyFindingFilters for the
+// supported filters; ?view= applies a saved view.
+func (h *FindingHandler) HandleListFindings(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := viewParams(c, h.db, userUUID, SavedViewResourceFindings)
+	if !ok {
+		return
+	}
+
+	query, err := applyFindingFilters(params, visibleFindings(h.db, userUUID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := resultOrder(params.Get("sort"), "scan_results.id DESC")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count findings", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve findings"})
+		return
+	}
+
+	findings := make([]models.ScanResult, 0)
+	if err := query.Select("scan_results.*").Order(order).Limit(limit).Offset(offset).Find(&findings).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve findings", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve findings"})
+		return
+	}
+
+	scanIDs := make([]uuid.UUID, 0, len(findings))
+	for _, f := range findings {
+		scanIDs = append(scanIDs, f.ScanID)
+	}
+	policies, err := sla.PoliciesByScan(h.db, scanIDs)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load SLA policies", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve findings"})
+		return
+	}
+	labels, err := classification.Load(h.db, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load data classification", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve findings"})
+		return
+	}
+	now := time.Now()
+	items := make([]FindingItem, 0, len(findings))
+	for _, f := range findings {
+		items = append(items, FindingItem{
+			ScanResult:     f,
+			SLA:            sla.Evaluate(f, policies[f.ScanID], now),
+			Classification: labels.Label(f.TestName),
+		})
+	}
+
+	c.JSON(http.StatusOK, FindingListResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleBulkFindings applies one triage action to many findings at once.
+// Findings marked fixed are verified by a scan cfg.FixVerificationDelay
+// later (see RunFixVerifier); any other status change cancels a pending
+// verification. All changes are made in a single transaction. IDs that don't exist or
+// belong to another user's scans are reported as not_found without
+// affecting the others.
+func (h *FindingHandler) HandleBulkFindings(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req BulkFindingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"triaged_at":  now,
+		"triaged_by":  userUUID,
+		"triage_note": req.Note,
+	}
+
+	switch req.Action {
+	case FindingActionAcknowledge:
+		updates["triage_status"] = models.TriageAcknowledged
+	case FindingActionSuppress:
+		updates["triage_status"] = models.TriageSuppressed
+	case FindingActionReopen:
+		updates["triage_status"] = models.TriageOpen
+	case FindingActionFix:
+		updates["triage_status"] = models.TriageFixed
+		updates["verify_after"] = now.Add(h.cfg.FixVerificationDelay)
+		updates["verification_scan_id"] = nil
+	case FindingActionUnassign:
+		updates["assignee_id"] = nil
+	case FindingActionAssign:
+		if req.AssigneeID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "assignee_id is required for the assign action"})
+			return
+		}
+		assignee := uuid.MustParse(req.AssigneeID)
+		var user models.User
+		if err := h.db.Select("id").First(&user, "id = ?", assignee).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		updates["assignee_id"] = assignee
+	}
+	if _, ok := updates["triage_status"]; ok && req.Action != FindingActionFix {
+		updates["verify_after"] = nil
+		updates["verification_scan_id"] = nil
+	}
+
+	ids := make([]uint, 0, len(req.IDs))
+	seen := map[uint]bool{}
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	outcomes := make([]BulkFindingOutcome, 0, len(ids))
+	updated := 0
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var owned []uint
+		if err := ownedFindings(tx, userUUID).
+			Where("scan_results.id IN ?", ids).
+			Pluck("scan_results.id", &owned).Error; err != nil {
+			return err
+		}
+
+		ownedSet := map[uint]bool{}
+		for _, id := range owned {
+			ownedSet[id] = true
+		}
+		for _, id := range ids {
+			outcome := BulkOutcomeNotFound
+			if ownedSet[id] {
+				outcome = BulkOutcomeUpdated
+				updated++
+			}
+			outcomes = append(outcomes, BulkFindingOutcome{ID: id, Outcome: outcome})
+		}
+
+		if len(owned) == 0 {
+			return nil
+		}
+		return tx.Model(&models.ScanResult{}).Where("id IN ?", owned).Updates(updates).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Bulk of findings failed", "action", req.Action, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update findings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    req.Action,
+		"updated":   updated,
+		"not_found": len(ids) - updated,
+		"results":   outcomes,
+	})
+}
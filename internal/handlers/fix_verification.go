@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// fixVerificationInterval is how often fixed findings are checked for due
+// and finished verification scans.
+const fixVerificationInterval = time.Minute
+
+// fixedFinding is a fixed finding together with the scan it was found in.
+type fixedFinding struct {
+	ID                 uint
+	TestName           string
+	UserID             uuid.UUID
+	TargetURL          string
+	VerificationScanID *uuid.UUID
+	ScanStatus         string
+}
+
+// RunFixVerifier closes the remediation loop of findings marked fixed,
+// until ctx is cancelled. Once a fixed finding's VerifyAfter has passed, a
+// scan of its target running its test is started; fixed findings of the
+// same user and target share one scan. When the scan completes, findings
+// whose test passed become verified and the others are reopened. A failed
+// scan is retried after cfg.FixVerificationDelay; a rejected or cancelled
+// one leaves the findings fixed without verification.
+func (h *ScanHandler) RunFixVerifier(ctx context.Context) {
+	ticker := time.NewTicker(fixVerificationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := h.resolveFixVerifications(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Failed to resolve fix verifications", "error", err)
+		}
+		if err := h.startFixVerifications(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Failed to start fix verifications", "error", err)
+		}
+	}
+}
+
+// startFixVerifications starts a scan for every user and target with
+// fixed findings due for verification.
+func (h *ScanHandler) startFixVerifications(ctx context.Context) error {
+	var due []fixedFinding
+	if err := h.db.WithContext(ctx).Model(&models.ScanResult{}).
+		Select("scan_results.id, scan_results.test_name, premium_scans.user_id, premium_scans.target_url").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id").
+		Where("scan_results.triage_status = ? AND scan_results.verification_scan_id IS NULL", models.TriageFixed).
+		Where("scan_results.verify_after <= ?", time.Now()).
+		Scan(&due).Error; err != nil {
+		return err
+	}
+
+	type key struct {
+		UserID    uuid.UUID
+		TargetURL string
+	}
+	groups := map[key][]fixedFinding{}
+	for _, f := range due {
+		k := key{f.UserID, f.TargetURL}
+		groups[k] = append(groups[k], f)
+	}
+	for k, findings := range groups {
+		if err := h.startFixVerification(ctx, k.UserID, k.TargetURL, findings); err != nil {
+			slog.ErrorContext(ctx, "Failed to start fix verification scan", "user_id", k.UserID, "target_url", k.TargetURL, "error", err)
+		}
+	}
+	return nil
+}
+
+func (h *ScanHandler) startFixVerification(ctx context.Context, userUUID uuid.UUID, targetURL string, findings []fixedFinding) error {
+	ids := make([]uint, 0, len(findings))
+	var unverifiable []uint
+	seen := map[string]bool{}
+	var tests []string
+	for _, f := range findings {
+		test := strings.ToLower(f.TestName)
+		if !AllowedPremiumTests[test] {
+			unverifiable = append(unverifiable, f.ID)
+			continue
+		}
+		ids = append(ids, f.ID)
+		if !seen[test] {
+			seen[test] = true
+			tests = append(tests, test)
+		}
+	}
+	sort.Strings(tests)
+
+	db := h.db.WithContext(ctx)
+	if len(unverifiable) > 0 {
+		// Engine errors and retired tests can't be run again; the findings
+		// stay fixed without a verification.
+		if err := db.Model(&models.ScanResult{}).Where("id IN ?", unverifiable).
+			Update("verify_after", nil).Error; err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	scanID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	owningTarget, err := targets.FindOwning(db, userUUID, targetURL)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	needsApproval, err := h.needsApproval(userUUID, targetURL)
+	if err != nil {
+		return err
+	}
+
+	scan := models.PremiumScan{
+		ID:        scanID,
+		UserID:    userUUID,
+		TargetURL: targetURL,
+		Status:    "PENDING",
+		CreatedAt: time.Now(),
+		Priority:  models.ScanPriorityLow,
+		Profile:   models.ScanProfileCustom,
+		Tests:     datatypes.NewJSONSlice(tests),
+	}
+	if owningTarget != nil {
+		scan.TargetID = &owningTarget.ID
+	}
+	if needsApproval {
+		scan.Status = "PENDING_APPROVAL"
+	}
+
+	task, err := json.Marshal(ScanTaskPayload{
+		Target: targetURL,
+		Parameters: []CommandParameter{
+			{Name: "--tests", Arguments: tests},
+			{Name: "--taskId", Arguments: []string{scanID.String()}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&scan).Error; err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("Verifying %d fixed findings", len(ids))
+		if err := recordScanEvent(tx, nil, scan.ID, "", scan.Status, reason); err != nil {
+			return err
+		}
+		if needsApproval {
+			if err := tx.Create(&models.ScanApproval{
+				ScanID:      scan.ID,
+				RequestedBy: userUUID,
+				Task:        datatypes.JSON(task),
+				CreatedAt:   scan.CreatedAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.ScanResult{}).
+			Where("id IN ? AND triage_status = ?", ids, models.TriageFixed).
+			Update("verification_scan_id", scan.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Started fix verification scan", "scan_id", scan.ID, "findings", len(ids), "tests", tests)
+	if needsApproval {
+		h.notifyApprovers(scan, tests)
+	} else if err := h.enqueueTask(ctx, scan.ID, task, scan.Priority); err != nil {
+		// The failed scan is picked up by resolveFixVerifications, which
+		// schedules another attempt.
+		if failErr := h.failScan(scan.ID, "Failed to queue verification scan"); failErr != nil {
+			slog.ErrorContext(ctx, "Failed to fail verification scan", "scan_id", scan.ID, "error", failErr)
+		}
+		return err
+	}
+	h.webhooks.Emit(userUUID, webhooks.EventScanCreated, scanEventData(scan))
+	return nil
+}
+
+// resolveFixVerifications updates fixed findings whose verification scan
+// has finished.
+func (h *ScanHandler) resolveFixVerifications(ctx context.Context) error {
+	db := h.db.WithContext(ctx)
+
+	var finished []fixedFinding
+	if err := db.Model(&models.ScanResult{}).
+		Select("scan_results.id, scan_results.test_name, scan_results.verification_scan_id, premium_scans.status AS scan_status").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.verification_scan_id").
+		Where("scan_results.triage_status = ? AND scan_results.verify_after IS NOT NULL", models.TriageFixed).
+		Where("premium_scans.status IN ?", []string{"COMPLETED", "FAILED", "CANCELLED", "REJECTED"}).
+		Scan(&finished).Error; err != nil {
+		return err
+	}
+
+	byScan := map[uuid.UUID][]fixedFinding{}
+	for _, f := range finished {
+		byScan[*f.VerificationScanID] = append(byScan[*f.VerificationScanID], f)
+	}
+	for scanID, findings := range byScan {
+		if err := h.resolveFixVerification(ctx, scanID, findings); err != nil {
+			slog.ErrorContext(ctx, "Failed to resolve fix verification scan", "scan_id", scanID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (h *ScanHandler) resolveFixVerification(ctx context.Context, scanID uuid.UUID, findings []fixedFinding) error {
+	db := h.db.WithContext(ctx)
+	ids := make([]uint, len(findings))
+	for i, f := range findings {
+		ids[i] = f.ID
+	}
+	// Only findings still waiting for this scan are updated, in case they
+	// were triaged again in the meantime.
+	pending := db.Model(&models.ScanResult{}).
+		Where("id IN ? AND triage_status = ? AND verification_scan_id = ?", ids, models.TriageFixed, scanID)
+
+	switch findings[0].ScanStatus {
+	case "FAILED":
+		slog.WarnContext(ctx, "Fix verification scan failed, retrying later", "scan_id", scanID)
+		return pending.Updates(map[string]interface{}{
+			"verify_after":         time.Now().Add(h.cfg.FixVerificationDelay),
+			"verification_scan_id": nil,
+		}).Error
+	case "CANCELLED", "REJECTED":
+		return pending.Update("verify_after", nil).Error
+	}
+
+	var results []models.ScanResult
+	if err := db.Select("test_name", "passed").Where("scan_id = ?", scanID).Find(&results).Error; err != nil {
+		return err
+	}
+	// A test passes verification if it ran and none of its results failed.
+	passed := map[string]bool{}
+	for _, r := range results {
+		test := strings.ToLower(r.TestName)
+		if ok, seen := passed[test]; !seen || ok {
+			passed[test] = r.Passed
+		}
+	}
+
+	var verified, reopened []uint
+	for _, f := range findings {
+		if passed[strings.ToLower(f.TestName)] {
+			verified = append(verified, f.ID)
+		} else {
+			reopened = append(reopened, f.ID)
+		}
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		for status, ids := range map[string][]uint{models.TriageVerified: verified, models.TriageOpen: reopened} {
+			if len(ids) == 0 {
+				continue
+			}
+			note := "Verified by scan " + scanID.String()
+			if status == models.TriageOpen {
+				note = "Still reported by verification scan " + scanID.String()
+			}
+			if err := tx.Model(&models.ScanResult{}).
+				Where("id IN ? AND triage_status = ? AND verification_scan_id = ?", ids, models.TriageFixed, scanID).
+				Updates(map[string]interface{}{
+					"triage_status": status,
+					"triage_note":   note,
+					"triaged_at":    now,
+					"triaged_by":    nil,
+					"verify_after":  nil,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		slog.InfoContext(ctx, "Resolved fix verification scan", "scan_id", scanID, "verified", len(verified), "reopened", len(reopened))
+		return nil
+	})
+}
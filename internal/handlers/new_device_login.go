@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// LoginChallengeTTL is how long the code confirming a login from a new
+// device stays valid.
+const LoginChallengeTTL = 15 * time.Minute
+
+// maxLoginChallengeAttempts is how many wrong codes a login challenge
+// takes before it is void.
+const maxLoginChallengeAttempts = 5
+
+type ConfirmLoginRequest struct {
+	ChallengeID uuid.UUID `json:"challenge_id" binding:"required"`
+	Code        string    `json:"code" binding:"required"`
+}
+
+// errInvalidLoginCode is returned for unknown, used, expired or
+// exhausted challenges and wrong codes.
+var errInvalidLoginCode = errors.New("invalid or expired confirmation code")
+
+// errAccountDisabled is returned when the account was disabled after the
+// login started.
+var errAccountDisabled = errors.New("account is disabled")
+
+// deviceFingerprint hashes a user agent with its version numbers removed,
+// so a browser stays the same device across updates.
+func deviceFingerprint(userAgent string) string {
+	stripped := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(userAgent))
+	sum := sha256.Sum256([]byte(stripped))
+	return hex.EncodeToString(sum[:])
+}
+
+// loginLocation returns where a request comes from: the country passed in
+// the configured header by a trusted proxy, or else the /24 (IPv4) or /48
+// (IPv6) network of the client. The header is ignored on requests that
+// don't come through one of the trusted proxies, where a client could set
+// it to anything.
+func (h *AuthHandler) loginLocation(c *gin.Context) string {
+	if h.cfg.GeoCountryHeader != "" && h.cfg.IsTrustedProxy(c.RemoteIP()) {
+		if country := strings.ToUpper(strings.TrimSpace(c.GetHeader(h.cfg.GeoCountryHeader))); country != "" {
+			return truncateUTF8(country, 64)
+		}
+	}
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// isNewDevice reports whether a session comes from a device or location
+// none of the user's earlier confirmed sessions had. A user's first
+// fingerprinted session is not new: there is nothing to compare it with.
+func (h *AuthHandler) isNewDevice(session models.Session) (bool, error) {
+	var seen struct {
+		Sessions int64
+		Device   bool
+		Location bool
+	}
+	err := h.db.Model(&models.Session{}).
+		Select("COUNT(*) AS sessions, COALESCE(BOOL_OR(device_hash = ?), false) AS device, COALESCE(BOOL_OR(location = ?), false) AS location",
+			session.DeviceHash, session.Location).
+		Where("user_id = ? AND NOT pending AND device_hash <> ''", session.UserID).
+		Scan(&seen).Error
+	if err != nil {
+		return false, err
+	}
+	return seen.Sessions > 0 && (!seen.Device || !seen.Location), nil
+}
+
+// startLoginChallenge saves session as pending and emails the user a code
+// that confirms it; the client exchanges the code for a token with
+// HandleConfirmLogin.
+func (h *AuthHandler) startLoginChallenge(c *gin.Context, user models.User, session models.Session) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate login code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login confirmation"})
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	challengeID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login confirmation"})
+		return
+	}
+	now := time.Now()
+	challenge := models.LoginChallenge{
+		ID:        challengeID,
+		SessionID: session.ID,
+		CodeHash:  hashResetToken(code),
+		ExpiresAt: now.Add(LoginChallengeTTL),
+		CreatedAt: now,
+	}
+
+	session.Pending = true
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save login challenge", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	data := loginMailData(user, session)
+	data["Code"] = code
+	data["ExpiresAt"] = challenge.ExpiresAt.Format(time.RFC1123)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.renderer.Send(ctx, h.mailer, mail.TemplateLoginConfirmation, user.Email, data); err != nil {
+			slog.Error("Failed to send login confirmation code", "user_id", user.ID, "error", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"confirmation_required": true,
+		"challenge_id":          challenge.ID,
+		"expires_in":            int(LoginChallengeTTL.Seconds()),
+	})
+}
+
+// HandleConfirmLogin finishes a login from a new device with the code
+// emailed to the user and returns its token. A challenge can be answered
+// once, and takes at most maxLoginChallengeAttempts codes.
+func (h *AuthHandler) HandleConfirmLogin(c *gin.Context) {
+	var req ConfirmLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	// Claim an attempt before looking at the code, so concurrent requests
+	// cannot guess more codes than the challenge allows. The claim stays
+	// when the code turns out to be wrong.
+	claim := h.db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?", req.ChallengeID, time.Now(), maxLoginChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if claim.Error != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count login confirmation attempt", "challenge_id", req.ChallengeID, "error", claim.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if claim.RowsAffected != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation code"})
+		return
+	}
+
+	var session models.Session
+	var user models.User
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var challenge models.LoginChallenge
+		err := tx.Where("id = ? AND used_at IS NULL", req.ChallengeID).First(&challenge).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidLoginCode
+		}
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(hashResetToken(strings.TrimSpace(req.Code))), []byte(challenge.CodeHash)) != 1 {
+			return errInvalidLoginCode
+		}
+
+		// Consume the challenge atomically so concurrent requests cannot
+		// both use it.
+		result := tx.Model(&models.LoginChallenge{}).
+			Where("id = ? AND used_at IS NULL", challenge.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidLoginCode
+		}
+
+		if err := tx.First(&session, "id = ? AND pending AND revoked_at IS NULL", challenge.SessionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidLoginCode
+			}
+			return err
+		}
+		if err := tx.First(&user, "id = ?", session.UserID).Error; err != nil {
+			return err
+		}
+		if user.DisabledAt != nil {
+			return errAccountDisabled
+		}
+		now := time.Now()
+		session.Pending = false
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(sessionTTL)
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"pending":      false,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+		}).Error
+	})
+	if errors.Is(err, errInvalidLoginCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation code"})
+		return
+	}
+	if errors.Is(err, errAccountDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to confirm login", "challenge_id", req.ChallengeID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.notifyNewLogin(user, session)
+	h.respondWithToken(c, user, session)
+}
+
+// notifyNewLogin emails the user that a new device signed in, in the
+// background.
+func (h *AuthHandler) notifyNewLogin(user models.User, session models.Session) {
+	data := loginMailData(user, session)
+	data["Time"] = session.CreatedAt.Format(time.RFC1123)
+	data["Link"] = h.cfg.FrontendLink("/settings/sessions")
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.renderer.Send(ctx, h.mailer, mail.TemplateNewLogin, user.Email, data); err != nil {
+			slog.Error("Failed to send new login notification", "user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+func loginMailData(user models.User, session models.Session) map[string]interface{} {
+	device := session.UserAgent
+	if device == "" {
+		device = "Unknown device"
+	}
+	location := session.Location
+	if location == "" {
+		location = "Unknown"
+	}
+	return map[string]interface{}{
+		"Name":     user.FullName,
+		"Device":   device,
+		"IP":       session.IP,
+		"Location": location,
+	}
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/orgstorage"
+	"gorm.io/gorm"
+)
+
+// OrganizationInvitationTTL is how long an invitation link stays valid.
+const OrganizationInvitationTTL = 7 * 24 * time.Hour
+
+// errInvalidInvitation is returned for unknown, accepted or expired
+// invitation tokens.
+var errInvalidInvitation = errors.New("invalid or expired invitation")
+
+// errAlreadyMember is returned when accepting an invitation to an
+// organization the user already belongs to.
+var errAlreadyMember = errors.New("already a member of the organization")
+
+// OrganizationHandler manages organizations, their members and
+// invitations. Scans shared with an organization are read through the
+// scan endpoints (see scanAccess).
+type OrganizationHandler struct {
+	db       *gorm.DB
+	mailer   mail.Mailer
+	renderer *mail.Renderer
+	storage  *orgstorage.Accountant
+	cfg      *config.Config
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// InviteMemberRequest invites a user by email. Role defaults to member.
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=owner member"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// OrganizationResponse is an organization with the current user's role.
+type OrganizationResponse struct {
+	models.Organization
+	Role string `json:"role"`
+}
+
+// OrganizationMember is a member of an organization.
+type OrganizationMember struct {
+	UserID   uuid.UUID `json:"user_id"`
+	FullName string    `json:"full_name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func NewOrganizationHandler(db *gorm.DB, mailer mail.Mailer, renderer *mail.Renderer, storage *orgstorage.Accountant, cfg *config.Config) *OrganizationHandler {
+	return &OrganizationHandler{
+		db:       db,
+		mailer:   mailer,
+		renderer: renderer,
+		storage:  storage,
+		cfg:      cfg,
+	}
+}
+
+// memberOrganizations is a subquery of the IDs of the organizations the
+// user is a member of.
+func memberOrganizations(db *gorm.DB, userUUID uuid.UUID) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).
+		Select("organization_id").Where("user_id = ?", userUUID)
+}
+
+// scanAccess scopes a query of premium scans to those the user may read:
+// their own and those shared with an organization they are a member of.
+func scanAccess(db *gorm.DB, userUUID uuid.UUID) *gorm.DB {
+	return db.Where("(premium_scans.user_id = ? OR premium_scans.organization_id IN (?))",
+		userUUID, memberOrganizations(db, userUUID))
+}
+
+// membershipRole returns the user's role in the organization, or "" if
+// the user isn't a member.
+func membershipRole(db *gorm.DB, orgID, userUUID uuid.UUID) (string, error) {
+	var membership models.Membership
+	err := db.Select("role").First(&membership, "organization_id = ? AND user_id = ?", orgID, userUUID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return membership.Role, err
+}
+
+// checkScanOrganization checks that the user may submit scans for the
+// organization, if one is given. Otherwise an error response is written
+// and false is returned.
+func checkScanOrganization(c *gin.Context, db *gorm.DB, orgID *uuid.UUID, userUUID uuid.UUID) bool {
+	if orgID == nil {
+		return true
+	}
+	role, err := membershipRole(db, *orgID, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to look up membership", "organization_id", *orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of the organization"})
+		return false
+	}
+	return true
+}
+
+// HandleCreateOrganization creates an organization with the current user
+// as its owner.
+func (h *OrganizationHandler) HandleCreateOrganization(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+		return
+	}
+
+	orgID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate ID"})
+		return
+	}
+	now := time.Now()
+	org := models.Organization{ID: orgID, Name: name, CreatedBy: userUUID, CreatedAt: now}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Membership{
+			OrganizationID: org.ID,
+			UserID:         userUUID,
+			Role:           models.MembershipRoleOwner,
+			CreatedAt:      now,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditOrganizationCreated, "organization", org.ID.String(), gin.H{"name": org.Name})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create organization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, OrganizationResponse{Organization: org, Role: models.MembershipRoleOwner})
+}
+
+// HandleListOrganizations lists the organizations the current user is a
+// member of, by name.
+func (h *OrganizationHandler) HandleListOrganizations(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	orgs := make([]OrganizationResponse, 0)
+	if err := h.db.Model(&models.Organization{}).
+		Select("organizations.*, memberships.role").
+		Joins("JOIN memberships ON memberships.organization_id = organizations.id").
+		Where("memberships.user_id = ?", userUUID).
+		Order("organizations.name").Scan(&orgs).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list organizations", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// HandleListMembers lists the members of one of the current user's
+// organizations, owners first.
+func (h *OrganizationHandler) HandleListMembers(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	members := make([]OrganizationMember, 0)
+	if err := h.db.Model(&models.Membership{}).
+		Select("memberships.user_id, users.full_name, users.email, memberships.role, memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ?", orgID).
+		Order("users.full_name").Scan(&members).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list members", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Role == models.MembershipRoleOwner && members[j].Role != models.MembershipRoleOwner
+	})
+	c.JSON(http.StatusOK, members)
+}
+
+// HandleInviteMember emails an invitation to join the organization. Only
+// owners can invite. Inviting an address again sends a new link; the
+// earlier ones stay valid until they expire.
+func (h *OrganizationHandler) HandleInviteMember(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "invite members")
+	if !ok {
+		return
+	}
+	userUUID, _ := currentUserID(c)
+
+	var req InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.MembershipRoleMember
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	var members int64
+	if err := h.db.Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND LOWER(users.email) = ?", orgID, email).
+		Count(&members).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check membership", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if members > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate invitation token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	invitationID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	now := time.Now()
+	invitation := models.OrganizationInvitation{
+		ID:             invitationID,
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           req.Role,
+		TokenHash:      hashResetToken(token),
+		InvitedBy:      userUUID,
+		ExpiresAt:      now.Add(OrganizationInvitationTTL),
+		CreatedAt:      now,
+	}
+
+	var org models.Organization
+	var inviter models.User
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&org, "id = ?", orgID).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("email").First(&inviter, "id = ?", userUUID).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditMemberInvited, "organization", orgID.String(), gin.H{
+			"email": invitation.Email,
+			"role":  invitation.Role,
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create invitation", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	data := map[string]interface{}{
+		"Inviter":      inviter.Email,
+		"Organization": org.Name,
+		"Role":         invitation.Role,
+		"Link":         h.cfg.FrontendLink("/invitations/accept?token=" + url.QueryEscape(token)),
+		"ExpiresAt":    invitation.ExpiresAt.Format(time.RFC1123),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.renderer.SendForOrganization(ctx, h.mailer, orgID, mail.TemplateOrganizationInvitation, invitation.Email, data); err != nil {
+			slog.Error("Failed to send organization invitation", "invitation_id", invitation.ID, "error", err)
+		}
+	}()
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// HandleAcceptInvitation makes the current user a member of the
+// organization of an invitation. The invitation must have been sent to
+// the user's email address; it can be accepted once.
+func (h *OrganizationHandler) HandleAcceptInvitation(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	var membership models.Membership
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("email").First(&user, "id = ?", userUUID).Error; err != nil {
+			return err
+		}
+
+		var invitation models.OrganizationInvitation
+		err := tx.Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", hashResetToken(req.Token), time.Now()).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !strings.EqualFold(invitation.Email, user.Email)) {
+			return errInvalidInvitation
+		}
+		if err != nil {
+			return err
+		}
+
+		role, err := membershipRole(tx, invitation.OrganizationID, userUUID)
+		if err != nil {
+			return err
+		}
+		if role != "" {
+			return errAlreadyMember
+		}
+
+		// Accept the invitation atomically so it can't be used twice.
+		result := tx.Model(&models.OrganizationInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidInvitation
+		}
+
+		membership = models.Membership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userUUID,
+			Role:           invitation.Role,
+			CreatedAt:      time.Now(),
+		}
+		if err := tx.Create(&membership).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditMemberJoined, "organization", invitation.OrganizationID.String(), gin.H{
+			"role": membership.Role,
+		})
+	})
+	switch {
+	case errors.Is(err, errInvalidInvitation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	case errors.Is(err, errAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": "Already a member of the organization"})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to accept invitation", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+}
+
+// loadMembership parses the :id parameter and returns the organization
+// and the current user's role in it. Non-members get a 404, so the
+// existence of an organization isn't revealed. If it can't be loaded an
+// error response is written and ok is false.
+func loadMembership(c *gin.Context, db *gorm.DB) (uuid.UUID, string, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return uuid.Nil, "", false
+	}
+
+	role, err := membershipRole(db, orgID, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to look up membership", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return uuid.Nil, "", false
+	}
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return uuid.Nil, "", false
+	}
+	return orgID, role, true
+}
+
+// loadOwnedOrganization is loadMembership for actions reserved to owners;
+// members get a 403 saying that only owners can do what.
+func loadOwnedOrganization(c *gin.Context, db *gorm.DB, what string) (uuid.UUID, bool) {
+	orgID, role, ok := loadMembership(c, db)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if role != models.MembershipRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can " + what})
+		return uuid.Nil, false
+	}
+	return orgID, true
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/vcs"
+	"gorm.io/gorm"
+)
+
+// VCSIntegrationRequest sets the access token of a GitLab or Bitbucket
+// integration. BaseURL is only for self-managed GitLab.
+type VCSIntegrationRequest struct {
+	Token   string `json:"token" binding:"required,max=4096"`
+	BaseURL string `json:"base_url" binding:"omitempty,url,max=200"`
+}
+
+// HandleListIntegrations lists the GitLab and Bitbucket integrations of
+// one of the current user's organizations. Tokens are never returned.
+func (h *OrganizationHandler) HandleListIntegrations(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	integrations := make([]models.VCSIntegration, 0)
+	if err := h.db.Where("organization_id = ?", orgID).Order("provider").Find(&integrations).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list VCS integrations", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, integrations)
+}
+
+// HandleSetIntegration creates or replaces the organization's integration
+// with the provider of the path. Only owners can set integrations; the
+// token is stored encrypted and the change is audited.
+func (h *OrganizationHandler) HandleSetIntegration(c *gin.Context) {
+	orgID, provider, ok := h.loadIntegrationOwner(c)
+	if !ok {
+		return
+	}
+	userUUID, _ := currentUserID(c)
+
+	var req VCSIntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	baseURL := strings.TrimRight(req.BaseURL, "/")
+	if baseURL != "" {
+		if provider != vcs.ProviderGitLab {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_url is only supported for GitLab"})
+			return
+		}
+		if u, err := url.Parse(baseURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_url must be an https URL"})
+			return
+		}
+	}
+
+	var integration models.VCSIntegration
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&integration, "organization_id = ? AND provider = ?", orgID, provider).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return err
+			}
+			integration = models.VCSIntegration{ID: id, OrganizationID: orgID, Provider: provider, CreatedBy: userUUID}
+		} else if err != nil {
+			return err
+		}
+
+		sealed, err := vcs.SealToken(h.cfg.VCSTokenKey, integration.ID, strings.TrimSpace(req.Token))
+		if err != nil {
+			return err
+		}
+		integration.BaseURL = baseURL
+		integration.SealedToken = sealed
+		integration.UpdatedAt = time.Now()
+		if err := tx.Save(&integration).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditIntegrationSet, "organization", orgID.String(), gin.H{
+			"provider": provider,
+			"base_url": baseURL,
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to set VCS integration", "organization_id", orgID, "provider", provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save integration"})
+		return
+	}
+	c.JSON(http.StatusOK, integration)
+}
+
+// HandleDeleteIntegration removes the organization's integration with the
+// provider of the path. Scans still waiting to be reported through it are
+// not reported. Only owners can remove integrations.
+func (h *OrganizationHandler) HandleDeleteIntegration(c *gin.Context) {
+	orgID, provider, ok := h.loadIntegrationOwner(c)
+	if !ok {
+		return
+	}
+
+	var deleted int64
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("organization_id = ? AND provider = ?", orgID, provider).Delete(&models.VCSIntegration{})
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		if deleted == 0 {
+			return nil
+		}
+		return recordAudit(tx, c, models.AuditIntegrationDeleted, "organization", orgID.String(), gin.H{
+			"provider": provider,
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete VCS integration", "organization_id", orgID, "provider", provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadIntegrationOwner checks that the current user owns the organization
+// of the path and that its provider is one integrations are set up for.
+// Otherwise an error response is written and false is returned.
+func (h *OrganizationHandler) loadIntegrationOwner(c *gin.Context) (uuid.UUID, string, bool) {
+	provider := c.Param("provider")
+	if provider != vcs.ProviderGitLab && provider != vcs.ProviderBitbucket {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider; integrations are for gitlab and bitbucket"})
+		return uuid.Nil, "", false
+	}
+	if h.cfg.VCSTokenKey == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "GitLab and Bitbucket integrations are not configured"})
+		return uuid.Nil, "", false
+	}
+	orgID, ok := loadOwnedOrganization(c, h.db, "manage integrations")
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	return orgID, provider, true
+}
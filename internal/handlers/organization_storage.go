@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SetOrganizationPlanRequest assigns a storage plan; an empty plan falls
+// back to the default plan.
+type SetOrganizationPlanRequest struct {
+	Plan *string `json:"plan" binding:"required,max=32"`
+}
+
+// HandleGetStorageUsage reports the stored data of one of the current
+// user's organizations against its storage plan.
+func (h *OrganizationHandler) HandleGetStorageUsage(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := h.db.First(&org, "id = ?", orgID).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load organization", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	status, err := h.storage.Status(c.Request.Context(), org)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to measure organization storage", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// HandleSetOrganizationPlan assigns an organization one of the configured
+// storage plans. The change is audited.
+func (h *OrganizationHandler) HandleSetOrganizationPlan(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID format"})
+		return
+	}
+
+	var req SetOrganizationPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	plan := strings.TrimSpace(*req.Plan)
+	if _, ok := h.cfg.OrgStorage.Plans[plan]; plan != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown storage plan"})
+		return
+	}
+
+	var org models.Organization
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&org, "id = ?", orgID).Error; err != nil {
+			return err
+		}
+		previous := org.Plan
+		if err := tx.Model(&org).Update("plan", plan).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditOrganizationPlanChanged, "organization", org.ID.String(), gin.H{
+			"from": previous,
+			"to":   plan,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to set organization plan", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
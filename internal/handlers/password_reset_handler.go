@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid.
+const PasswordResetTTL = time.Hour
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// errInvalidResetToken is returned for unknown, used or expired tokens.
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// HandleForgotPassword issues a password reset token and emails a reset
+// link to the user. The response is the same whether or not the email
+// belongs to an account, so the endpoint cannot be used to discover users.
+func (h *AuthHandler) HandleForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	response := gin.H{"message": "If an account with this email exists, a password reset link has been sent"}
+
+	var user models.User
+	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Failed to look up user for password reset", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate reset token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	tokenID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
+	}
+
+	resetToken := models.PasswordResetToken{
+		ID:        tokenID,
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+		CreatedAt: time.Now(),
+	}
+
+	// Only the most recently requested link is valid.
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := invalidateResetTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Create(&resetToken).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save reset token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
+	}
+
+	data := map[string]interface{}{
+		"Name":      user.FullName,
+		"Link":      h.cfg.FrontendLink("/reset-password?token=" + url.QueryEscape(token)),
+		"ExpiresAt": resetToken.ExpiresAt.Format(time.RFC1123),
+	}
+
+	// Deliver in the background so the response time does not reveal
+	// whether the account exists.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.renderer.Send(ctx, h.mailer, mail.TemplatePasswordReset, user.Email, data); err != nil {
+			slog.Error("Failed to send password reset email to user", "user_id", user.ID, "error", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleResetPassword sets a new password using a reset token. The token
+// is consumed, all other outstanding tokens of the user are invalidated
+// and all their sessions are signed out.
+func (h *AuthHandler) HandleResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.cfg.BcryptCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash new password"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var resetToken models.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashResetToken(req.Token), time.Now()).
+			First(&resetToken).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		// Consume the token atomically so concurrent requests cannot both
+		// use it.
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		if err := tx.Model(&models.User{ID: resetToken.UserID}).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		if err := revokeSessions(tx, resetToken.UserID, ""); err != nil {
+			return err
+		}
+		return invalidateResetTokens(tx, resetToken.UserID)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reset password", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// invalidateResetTokens marks all outstanding reset tokens of the user as
+// used.
+func invalidateResetTokens(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
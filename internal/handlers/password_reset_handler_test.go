@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordChangeRevokesSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	sessionID := "0190a3b2-9d8e-7f6a-8b5c-4d3e2f1a0b9c"
+	oldHash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handle  func(h *AuthHandler) gin.HandlerFunc
+		body    string
+		session string
+		// wantKept is the session that stays signed in.
+		wantKept string
+	}{
+		{
+			name:     "password reset signs out every session",
+			handle:   func(h *AuthHandler) gin.HandlerFunc { return h.HandleResetPassword },
+			body:     `{"token":"reset-token","new_password":"new password"}`,
+			wantKept: "",
+		},
+		{
+			name:     "password change keeps the current session",
+			handle:   func(h *AuthHandler) gin.HandlerFunc { return h.HandleUpdatePassword },
+			body:     `{"old_password":"old password","new_password":"new password"}`,
+			session:  sessionID,
+			wantKept: sessionID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var statements []string
+			var revokeQuery string
+			var revoked []driver.NamedValue
+			db := dbtest.Open(t, func(query string, args []driver.NamedValue) (dbtest.Result, error) {
+				statements = append(statements, query)
+				switch {
+				case strings.HasPrefix(query, `SELECT * FROM "password_reset_tokens"`):
+					return dbtest.Result{Columns: []string{"id", "user_id"}, Rows: [][]driver.Value{{"0190a3b2-1111-7222-8333-444455556666", userID.String()}}}, nil
+				case strings.HasPrefix(query, `SELECT * FROM "users"`):
+					return dbtest.Result{Columns: []string{"id", "password"}, Rows: [][]driver.Value{{userID.String(), oldHash}}}, nil
+				case strings.HasPrefix(query, `UPDATE "sessions"`):
+					revokeQuery, revoked = query, args
+					return dbtest.Result{RowsAffected: 2}, nil
+				case strings.HasPrefix(query, "UPDATE"), strings.HasPrefix(query, "INSERT"):
+					return dbtest.Result{RowsAffected: 1}, nil
+				}
+				return dbtest.Result{}, errors.New("unexpected statement: " + query)
+			})
+			h := &AuthHandler{db: db, cfg: &config.Config{BcryptCost: bcrypt.MinCost}}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("userID", userID.String())
+			if tt.session != "" {
+				c.Set("sessionID", tt.session)
+			}
+			tt.handle(h)(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s), want 200", w.Code, w.Body)
+			}
+			if revoked == nil {
+				t.Fatalf("sessions weren't revoked; statements: %q", statements)
+			}
+			var revokedUser, kept bool
+			for _, a := range revoked {
+				revokedUser = revokedUser || a.Value == userID.String()
+				kept = kept || (tt.wantKept != "" && a.Value == tt.wantKept)
+			}
+			if !revokedUser {
+				t.Errorf("revocation arguments %v, want the sessions of %s", revoked, userID)
+			}
+			if keeps := strings.Contains(revokeQuery, "id <>"); keeps != (tt.wantKept != "") || kept != keeps {
+				t.Errorf("revocation %s %v, want session %q kept", revokeQuery, revoked, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// openMetricsContentType is the content type of the OpenMetrics text format,
+// which Prometheus scrapes natively.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// latestTargetScans selects the latest completed scan of every target URL
+// of a user or an organization, whose column is filled in, comparing URLs
+// like the benchmark does.
+const latestTargetScans = `
+SELECT DISTINCT ON (LOWER(RTRIM(target_url, '/'))) id, target_url, grade, score, completed_at
+FROM premium_scans
+WHERE %s = ? AND status = 'COMPLETED' AND completed_at IS NOT NULL AND target_url <> '' AND deleted_at IS NULL
+ORDER BY LOWER(RTRIM(target_url, '/')), completed_at DESC`
+
+type targetPosture struct {
+	ID          uuid.UUID
+	TargetURL   string
+	Grade       string
+	Score       *float64
+	CompletedAt time.Time
+}
+
+// HandlePostureMetrics exposes the security posture of the current user's
+// targets in the OpenMetrics text format, for Prometheus to scrape with an
+// API key. For the latest completed scan of every target URL it reports
+// the score and grade, the failed checks by severity and the days since
+// the scan completed.
+func (h *ScanHandler) HandlePostureMetrics(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.respondPostureMetrics(c, "user_id", userUUID)
+}
+
+// HandleOrganizationPostureMetrics exposes, like HandlePostureMetrics, the
+// security posture of the targets of the scans shared with an organization
+// the current user is a member of.
+func (h *ScanHandler) HandleOrganizationPostureMetrics(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+	h.respondPostureMetrics(c, "organization_id", orgID)
+}
+
+// respondPostureMetrics writes the posture metrics of the scans whose
+// owner column is id.
+func (h *ScanHandler) respondPostureMetrics(c *gin.Context, column string, id uuid.UUID) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var latest []targetPosture
+	if err := db.Raw(fmt.Sprintf(latestTargetScans, column), id).Scan(&latest).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load target posture", column, id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].TargetURL < latest[j].TargetURL })
+
+	ids := make([]uuid.UUID, len(latest))
+	for i, t := range latest {
+		ids[i] = t.ID
+	}
+	var counts []struct {
+		ScanID       uuid.UUID
+		SeverityRank int
+		Count        int64
+	}
+	if len(ids) > 0 {
+		if err := db.Model(&models.ScanResult{}).
+			Select("scan_id, severity_rank, COUNT(*) AS count").
+			Where("scan_id IN ? AND passed = ?", ids, false).
+			Group("scan_id, severity_rank").
+			Scan(&counts).Error; err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to count failed checks", column, id, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	failed := map[uuid.UUID]map[int]int64{}
+	for _, n := range counts {
+		if failed[n.ScanID] == nil {
+			failed[n.ScanID] = map[int]int64{}
+		}
+		failed[n.ScanID][n.SeverityRank] = n.Count
+	}
+
+	// Severities from most to least severe; every target reports all of
+	// them so that series don't disappear when a count drops to zero.
+	severities := make([]string, 0, len(models.SeverityRanks))
+	for s := range models.SeverityRanks {
+		severities = append(severities, s)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		return models.SeverityRanks[severities[i]] > models.SeverityRanks[severities[j]]
+	})
+
+	var b strings.Builder
+	b.WriteString("# TYPE antiginx_target_score gauge\n")
+	b.WriteString("# HELP antiginx_target_score Security score (0-100) of the latest completed scan.\n")
+	for _, t := range latest {
+		if t.Score != nil {
+			fmt.Fprintf(&b, "antiginx_target_score{target=%s} %g\n", metricLabel(t.TargetURL), *t.Score)
+		}
+	}
+	b.WriteString("# TYPE antiginx_target_grade gauge\n")
+	b.WriteString("# HELP antiginx_target_grade Letter grade of the latest completed scan, as a label of a series set to 1.\n")
+	for _, t := range latest {
+		if t.Grade != "" {
+			fmt.Fprintf(&b, "antiginx_target_grade{target=%s,grade=%s} 1\n", metricLabel(t.TargetURL), metricLabel(t.Grade))
+		}
+	}
+	b.WriteString("# TYPE antiginx_target_failed_checks gauge\n")
+	b.WriteString("# HELP antiginx_target_failed_checks Failed checks of the latest completed scan by severity.\n")
+	for _, t := range latest {
+		for _, s := range severities {
+			fmt.Fprintf(&b, "antiginx_target_failed_checks{target=%s,severity=%s} %d\n",
+				metricLabel(t.TargetURL), metricLabel(s), failed[t.ID][models.SeverityRanks[s]])
+		}
+	}
+	b.WriteString("# TYPE antiginx_target_days_since_last_scan gauge\n")
+	b.WriteString("# HELP antiginx_target_days_since_last_scan Days since the latest completed scan.\n")
+	now := time.Now()
+	for _, t := range latest {
+		fmt.Fprintf(&b, "antiginx_target_days_since_last_scan{target=%s} %.3f\n",
+			metricLabel(t.TargetURL), now.Sub(t.CompletedAt).Hours()/24)
+	}
+	b.WriteString("# EOF\n")
+
+	c.Data(http.StatusOK, openMetricsContentType, []byte(b.String()))
+}
+
+// metricLabel quotes a label value, escaping backslashes, quotes and line
+// feeds as the exposition format requires.
+func metricLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
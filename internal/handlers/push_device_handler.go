@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/push"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// PushDeviceHandler registers the devices of the mobile app for push
+// notifications and manages their notification preferences.
+type PushDeviceHandler struct {
+	db       *gorm.DB
+	notifier *push.Notifier
+}
+
+func NewPushDeviceHandler(db *gorm.DB, notifier *push.Notifier) *PushDeviceHandler {
+	return &PushDeviceHandler{db: db, notifier: notifier}
+}
+
+// RegisterPushDeviceRequest registers the push token of a device. Events
+// default to push.DefaultEvents and MinSeverity to critical; an empty
+// MinSeverity notifies of every scan and finding.
+type RegisterPushDeviceRequest struct {
+	Platform    string   `json:"platform" binding:"required,oneof=fcm apns"`
+	Token       string   `json:"token" binding:"required,max=512"`
+	Name        string   `json:"name" binding:"max=100"`
+	Events      []string `json:"events" binding:"omitempty,min=1"`
+	MinSeverity *string  `json:"min_severity"`
+}
+
+// UpdatePushDeviceRequest changes the given preferences of a device.
+type UpdatePushDeviceRequest struct {
+	Name        *string  `json:"name" binding:"omitempty,max=100"`
+	Events      []string `json:"events" binding:"omitempty,min=1"`
+	MinSeverity *string  `json:"min_severity"`
+}
+
+// HandleRegisterPushDevice registers a device of the current user. A token
+// registered before, by this or another user, is replaced, so that a
+// device only ever notifies the user signed in to the app.
+func (h *PushDeviceHandler) HandleRegisterPushDevice(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RegisterPushDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if !h.notifier.Enabled(req.Platform) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Push notifications are not configured for " + req.Platform})
+		return
+	}
+	events := push.DefaultEvents
+	if req.Events != nil {
+		events = req.Events
+	}
+	minSeverity := "critical"
+	if req.MinSeverity != nil {
+		minSeverity = strings.ToLower(*req.MinSeverity)
+	}
+	if !validPushEvents(c, events) || !validMinSeverity(c, minSeverity) {
+		return
+	}
+
+	deviceID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate device ID"})
+		return
+	}
+	device := models.PushDevice{
+		ID:          deviceID,
+		UserID:      userUUID,
+		Platform:    req.Platform,
+		Token:       req.Token,
+		Name:        req.Name,
+		Events:      datatypes.NewJSONSlice(events),
+		MinSeverity: minSeverity,
+		CreatedAt:   time.Now(),
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token = ?", req.Token).Delete(&models.PushDevice{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&device).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to register push device", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+// HandleListPushDevices lists the devices of the current user, newest first.
+func (h *PushDeviceHandler) HandleListPushDevices(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	devices := make([]models.PushDevice, 0)
+	if err := h.db.Where("user_id = ?", userUUID).Order("created_at desc").Find(&devices).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list push devices", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// HandleUpdatePushDevice changes the name, events or minimum severity of a
+// device.
+func (h *PushDeviceHandler) HandleUpdatePushDevice(c *gin.Context) {
+	device, ok := h.ownedPushDevice(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePushDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if req.Name != nil {
+		device.Name = *req.Name
+	}
+	if req.Events != nil {
+		if !validPushEvents(c, req.Events) {
+			return
+		}
+		device.Events = datatypes.NewJSONSlice(req.Events)
+	}
+	if req.MinSeverity != nil {
+		minSeverity := strings.ToLower(*req.MinSeverity)
+		if !validMinSeverity(c, minSeverity) {
+			return
+		}
+		device.MinSeverity = minSeverity
+	}
+
+	if err := h.db.Model(&device).Select("name", "events", "min_severity").Updates(&device).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update push device", "device_id", device.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// HandleDeletePushDevice unregisters a device, e.g. when the user signs out
+// of the app.
+func (h *PushDeviceHandler) HandleDeletePushDevice(c *gin.Context) {
+	device, ok := h.ownedPushDevice(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&device).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete push device", "device_id", device.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted"})
+}
+
+func validPushEvents(c *gin.Context, events []string) bool {
+	for _, event := range events {
+		if !slices.Contains(push.SupportedEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported event: " + event, "supported_events": push.SupportedEvents})
+			return false
+		}
+	}
+	return true
+}
+
+func validMinSeverity(c *gin.Context, severity string) bool {
+	if _, known := models.SeverityRanks[severity]; severity != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_severity must be critical, high, medium, low, info, none or empty"})
+		return false
+	}
+	return true
+}
+
+// ownedPushDevice loads the device from the :id path parameter, making sure
+// it belongs to the current user.
+func (h *PushDeviceHandler) ownedPushDevice(c *gin.Context) (models.PushDevice, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return models.PushDevice{}, false
+	}
+
+	deviceUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID format"})
+		return models.PushDevice{}, false
+	}
+
+	var device models.PushDevice
+	if err := h.db.First(&device, "id = ? AND user_id = ?", deviceUUID, userUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return models.PushDevice{}, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve push device", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.PushDevice{}, false
+	}
+
+	return device, true
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/remediation"
+	"gorm.io/gorm"
+)
+
+type RemediationHandler struct {
+	db *gorm.DB
+}
+
+type RemediationContentRequest struct {
+	TestName    string `json:"test_name" binding:"required,max=64"`
+	Language    string `json:"language" binding:"required,max=16"`
+	Title       string `json:"title" binding:"required"`
+	Remediation string `json:"remediation" binding:"required"`
+	Reference   string `json:"reference" binding:"omitempty,url"`
+}
+
+func NewRemediationHandler(db *gorm.DB) *RemediationHandler {
+	return &RemediationHandler{
+		db: db,
+	}
+}
+
+// requestLanguages returns the reader's preferred languages: the explicit
+// ?lang= query parameter first, then the Accept-Language header.
+func requestLanguages(c *gin.Context) []string {
+	var langs []string
+	if lang := remediation.NormalizeLanguage(c.Query("lang")); lang != "" {
+		langs = append(langs, lang)
+	}
+	return append(langs, remediation.ParseAcceptLanguage(c.GetHeader("Accept-Language"))...)
+}
+
+// HandleGetRemediation returns remediation guidance for the comma-separated
+// ?tests= list (all known tests if omitted) in the reader's language.
+func (h *RemediationHandler) HandleGetRemediation(c *gin.Context) {
+	tests := AvailableTestsList
+	if raw := strings.TrimSpace(c.Query("tests")); raw != "" {
+		tests = nil
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tests = append(tests, t)
+			}
+		}
+	}
+
+	content, err := remediation.Resolve(h.db, tests, requestLanguages(c))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to resolve remediation content", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve remediation content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+// HandleListRemediation lists the latest version of every test's content in
+// the language given by ?lang= (default language if omitted).
+func (h *RemediationHandler) HandleListRemediation(c *gin.Context) {
+	lang := remediation.NormalizeLanguage(c.DefaultQuery("lang", remediation.DefaultLanguage))
+
+	content, err := remediation.Latest(h.db, lang, nil)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list remediation content", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list remediation content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+// HandleCreateRemediation stores a new version of a test's content.
+func (h *RemediationHandler) HandleCreateRemediation(c *gin.Context) {
+	authorUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RemediationContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	content := models.RemediationContent{
+		TestName:    strings.TrimSpace(req.TestName),
+		Language:    remediation.NormalizeLanguage(req.Language),
+		Title:       req.Title,
+		Remediation: req.Remediation,
+		Reference:   req.Reference,
+	}
+	if content.Language == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language"})
+		return
+	}
+
+	if err := h.createVersion(&content, authorUUID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save remediation content", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save remediation content"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, content)
+}
+
+// HandleListRemediationVersions returns the full version history of a
+// test's content in one language, newest first.
+func (h *RemediationHandler) HandleListRemediationVersions(c *gin.Context) {
+	var versions []models.RemediationContent
+	err := h.db.Where("test_name = ? AND language = ?", c.Param("test"), remediation.NormalizeLanguage(c.Param("lang"))).
+		Order("version desc").
+		Find(&versions).Error
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list remediation versions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list remediation versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// HandleRestoreRemediationVersion republishes an old version by copying it
+// into a new version, keeping the history intact.
+func (h *RemediationHandler) HandleRestoreRemediationVersion(c *gin.Context) {
+	authorUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	var old models.RemediationContent
+	err = h.db.Where("test_name = ? AND language = ? AND version = ?", c.Param("test"), remediation.NormalizeLanguage(c.Param("lang")), version).
+		First(&old).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	content := models.RemediationContent{
+		TestName:    old.TestName,
+		Language:    old.Language,
+		Title:       old.Title,
+		Remediation: old.Remediation,
+		Reference:   old.Reference,
+	}
+	if err := h.createVersion(&content, authorUUID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to restore remediation version", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore remediation version"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, content)
+}
+
+func (h *RemediationHandler) createVersion(content *models.RemediationContent, authorID uuid.UUID) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.RemediationContent{}).
+			Where("test_name = ? AND language = ?", content.TestName, content.Language).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		content.Version = latest + 1
+		content.AuthorID = authorID
+		content.CreatedAt = time.Now()
+		return tx.Create(content).Error
+	})
+}
@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/remediation"
+	"github.com/prawo-i-piesc/backend/internal/reports"
+	"github.com/prawo-i-piesc/backend/internal/scoring"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// MaxMatrixTargets bounds how many targets one matrix may compare.
+const MaxMatrixTargets = 100
+
+// Matrix cell values.
+const (
+	MatrixPass   = "pass"
+	MatrixFail   = "fail"
+	MatrixNotRun = "not_run"
+)
+
+// MaxReportPeriod bounds the period an executive summary may cover.
+const MaxReportPeriod = 366 * 24 * time.Hour
+
+// defaultReportPeriod is summarized when no period is given.
+const defaultReportPeriod = 30 * 24 * time.Hour
+
+type ReportHandler struct {
+	db     *gorm.DB
+	store  storage.Store
+	runner *reports.Runner
+}
+
+// ExecutiveSummaryRequest selects the period and format of a summary. From
+// and To accept RFC 3339 timestamps or YYYY-MM-DD dates; by default the
+// last 30 days are summarized.
+type ExecutiveSummaryRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Format string `json:"format" binding:"omitempty,oneof=pdf html"`
+}
+
+// MatrixTarget describes the scan a matrix column was taken from.
+type MatrixTarget struct {
+	TargetURL   string     `json:"target_url"`
+	ScanID      uuid.UUID  `json:"scan_id"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Score       *float64   `json:"score"`
+	Grade       string     `json:"grade"`
+}
+
+// MatrixRow holds the outcome of one test for every target, in the order
+// of MatrixResponse.Targets.
+type MatrixRow struct {
+	Test     string   `json:"test"`
+	Category string   `json:"category"`
+	Cells    []string `json:"cells"`
+}
+
+type MatrixResponse struct {
+	Targets []MatrixTarget `json:"targets"`
+	Rows    []MatrixRow    `json:"rows"`
+	// Missing lists requested targets without a completed scan.
+	Missing []string `json:"missing"`
+}
+
+func NewReportHandler(db *gorm.DB, store storage.Store, runner *reports.Runner) *ReportHandler {
+	return &ReportHandler{
+		db:     db,
+		store:  store,
+		runner: runner,
+	}
+}
+
+// HandleMatrix builds a test-by-target pass/fail matrix from the latest
+// completed scan of each target. Targets are identified by their URL and
+// selected with ?target_ids= (comma-separated); without it all of the
+// user's targets are compared. ?format=csv returns the matrix as CSV;
+// confidential tests are left out of it unless ?include_confidential=true
+// is given.
+func (h *ReportHandler) HandleMatrix(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	requested := splitList(c.Query("target_ids"), func(s string) string { return s })
+	if len(requested) > MaxMatrixTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many targets", "max_targets": MaxMatrixTargets})
+		return
+	}
+
+	matrix, err := h.buildMatrix(c.Request.Context(), userUUID, requested)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to build matrix", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build matrix"})
+		return
+	}
+
+	if strings.EqualFold(c.Query("format"), "csv") {
+		outbound, err := classification.For(h.db, userUUID, classification.ChannelExport, includeConfidential(c))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load data classification", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build matrix"})
+			return
+		}
+		rows := matrix.Rows[:0]
+		for _, row := range matrix.Rows {
+			if outbound.Discloses(row.Test) {
+				rows = append(rows, row)
+			}
+		}
+		matrix.Rows = rows
+		writeMatrixCSV(c, matrix)
+		return
+	}
+	c.JSON(http.StatusOK, matrix)
+}
+
+func (h *ReportHandler) buildMatrix(ctx context.Context, userUUID uuid.UUID, requested []string) (*MatrixResponse, error) {
+	db := h.db.WithContext(ctx)
+	query := db.Model(&models.PremiumScan{}).
+		Where("user_id = ? AND status = ?", userUUID, "COMPLETED")
+	if len(requested) > 0 {
+		query = query.Where("target_url IN ?", requested)
+	}
+
+	var scans []models.PremiumScan
+	if err := query.Select("id", "target_url", "completed_at", "score", "grade").
+		Order("completed_at desc").Find(&scans).Error; err != nil {
+		return nil, err
+	}
+
+	// Keep the latest scan of each target.
+	latest := map[string]models.PremiumScan{}
+	for _, s := range scans {
+		if _, seen := latest[s.TargetURL]; !seen {
+			latest[s.TargetURL] = s
+		}
+	}
+
+	matrix := &MatrixResponse{Targets: []MatrixTarget{}, Rows: []MatrixRow{}, Missing: []string{}}
+	for _, target := range requested {
+		if _, ok := latest[target]; !ok {
+			matrix.Missing = append(matrix.Missing, target)
+		}
+	}
+
+	targets := make([]string, 0, len(latest))
+	for target := range latest {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	if len(targets) > MaxMatrixTargets {
+		targets = targets[:MaxMatrixTargets]
+	}
+
+	column := map[uuid.UUID]int{}
+	scanIDs := make([]uuid.UUID, 0, len(targets))
+	for i, target := range targets {
+		s := latest[target]
+		column[s.ID] = i
+		scanIDs = append(scanIDs, s.ID)
+		matrix.Targets = append(matrix.Targets, MatrixTarget{
+			TargetURL:   s.TargetURL,
+			ScanID:      s.ID,
+			CompletedAt: s.CompletedAt,
+			Score:       s.Score,
+			Grade:       s.Grade,
+		})
+	}
+	if len(scanIDs) == 0 {
+		return matrix, nil
+	}
+
+	var results []models.ScanResult
+	if err := db.Select("scan_id", "test_name", "passed").
+		Where("scan_id IN ?", scanIDs).Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	rows := map[string][]string{}
+	for _, r := range results {
+		test := strings.ToLower(r.TestName)
+		cells, ok := rows[test]
+		if !ok {
+			cells = make([]string, len(targets))
+			for i := range cells {
+				cells[i] = MatrixNotRun
+			}
+			rows[test] = cells
+		}
+		// A test fails for a target if any of its results failed.
+		i := column[r.ScanID]
+		if !r.Passed {
+			cells[i] = MatrixFail
+		} else if cells[i] == MatrixNotRun {
+			cells[i] = MatrixPass
+		}
+	}
+
+	tests := make([]string, 0, len(rows))
+	for test := range rows {
+		tests = append(tests, test)
+	}
+	sort.Strings(tests)
+	for _, test := range tests {
+		category := TestCategories[test]
+		if category == "" {
+			category = scoring.OtherCategory
+		}
+		matrix.Rows = append(matrix.Rows, MatrixRow{Test: test, Category: category, Cells: rows[test]})
+	}
+	return matrix, nil
+}
+
+// HandleCreateExecutiveSummary starts generating an executive summary of
+// the current user's posture over a period. The report is built in the
+// background; its progress can be followed with HandleGetReportJob and the
+// user is notified by email and webhooks once it is ready.
+func (h *ReportHandler) HandleCreateExecutiveSummary(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ExecutiveSummaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindingError(c, err)
+		return
+	}
+
+	to := time.Now()
+	if req.To != "" {
+		t, err := parseTimeParam(req.To, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp or YYYY-MM-DD date"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultReportPeriod)
+	if req.From != "" {
+		t, err := parseTimeParam(req.From, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp or YYYY-MM-DD date"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	if to.Sub(from) > MaxReportPeriod {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The period may cover at most 366 days"})
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = models.ReportFormatPDF
+	}
+
+	jobID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate job ID"})
+		return
+	}
+
+	job := models.ReportJob{
+		ID:         jobID,
+		UserID:     userUUID,
+		Type:       models.ReportTypeExecutiveSummary,
+		Format:     format,
+		PeriodFrom: from,
+		PeriodTo:   to,
+		Status:     models.JobStatusPending,
+	}
+	if err := h.db.Create(&job).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create report job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report job"})
+		return
+	}
+
+	if !h.enqueue(c, &job) {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// enqueue queues a newly created job for the report runner. On failure an
+// error response is written and false is returned.
+func (h *ReportHandler) enqueue(c *gin.Context, job *models.ReportJob) bool {
+	if err := h.runner.Enqueue(c.Request.Context(), job); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to queue report job", "report_id", job.ID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to queue report job", "job": job})
+		return false
+	}
+	return true
+}
+
+// jobStatusURL is where the status of a job can be polled.
+func jobStatusURL(jobID uuid.UUID) string {
+	return "/api/jobs/" + jobID.String()
+}
+
+// userJob loads one of the current user's report jobs by the :id
+// parameter. On failure an error response is written and ok is false.
+func (h *ReportHandler) userJob(c *gin.Context) (job models.ReportJob, ok bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return job, false
+	}
+
+	jobUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID format"})
+		return job, false
+	}
+
+	if err := h.db.First(&job, "id = ? AND user_id = ?", jobUUID, userUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report job not found"})
+			return job, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return job, false
+	}
+	return job, true
+}
+
+// HandleGetReportJob returns the status and progress of one of the current
+// user's report or export jobs, with a download URL once it is ready. It
+// serves both /api/jobs/:id and the older /api/reports/jobs/:id.
+func (h *ReportHandler) HandleGetReportJob(c *gin.Context) {
+	job, ok := h.userJob(c)
+	if !ok {
+		return
+	}
+
+	if job.Status != models.JobStatusCompleted {
+		c.JSON(http.StatusOK, gin.H{"job": job})
+		return
+	}
+
+	url, err := h.store.SignedURL(c.Request.Context(), job.StorageKey, storage.DefaultURLTTL, reports.Filename(&job))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to sign report", "report_id", job.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download URL"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"job":          job,
+		"download_url": url,
+		"expires_at":   time.Now().Add(storage.DefaultURLTTL),
+	})
+}
+
+// HandleRetryReportJob queues a failed job of the current user again. Jobs
+// can be run at most reports.MaxAttempts times.
+func (h *ReportHandler) HandleRetryReportJob(c *gin.Context) {
+	job, ok := h.userJob(c)
+	if !ok {
+		return
+	}
+
+	if err := h.runner.Retry(c.Request.Context(), &job); err != nil {
+		if errors.Is(err, reports.ErrNotRetryable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only failed jobs with attempts left can be retried", "status": job.Status, "attempts": job.Attempts, "max_attempts": reports.MaxAttempts})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retry report job", "report_id", job.ID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to queue report job", "job": job})
+		return
+	}
+
+	c.Header("Retry-After", scanReportRetryAfter)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":        job,
+		"status_url": jobStatusURL(job.ID),
+	})
+}
+
+// scanReportRetryAfter is the polling interval suggested to clients while a
+// scan report is being generated.
+const scanReportRetryAfter = "2"
+
+// HandleScanReportPDF serves the security report of one of the current
+// user's completed scans as a PDF. Reports are rendered in the background:
+// the first request starts a job and gets 202 Accepted with its status URL,
+// and once the job completes the same request returns the PDF. Rendered
+// reports are reused until the scan is rescored or its remediation content
+// changes. Findings classified as confidential are left out unless
+// ?include_confidential=true is given.
+func (h *ReportHandler) HandleScanReportPDF(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if scan.Status != "COMPLETED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reports are only available for completed scans"})
+		return
+	}
+
+	language := remediation.DefaultLanguage
+	if langs := requestLanguages(c); len(langs) > 0 {
+		language = langs[0]
+	}
+
+	include := includeConfidential(c)
+	cacheKey, err := reports.ScanReportCacheKey(h.db, scan, language, include)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to compute report cache key for scan", "scan_id", scan.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var job models.ReportJob
+	err = h.db.Where("user_id = ? AND type = ? AND scan_id = ? AND cache_key = ? AND status <> ?",
+		userUUID, models.ReportTypeScan, scan.ID, cacheKey, models.JobStatusFailed).
+		Order("created_at DESC").First(&job).Error
+	switch {
+	case err == nil && job.Status == models.JobStatusCompleted:
+		file, err := h.store.Get(c.Request.Context(), job.StorageKey)
+		if err == nil {
+			defer file.Close()
+			c.DataFromReader(http.StatusOK, -1, "application/pdf", file, map[string]string{
+				"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, reports.Filename(&job)),
+			})
+			return
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Failed to open report", "storage_key", job.StorageKey, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read report"})
+			return
+		}
+		// The stored report is gone; render it again.
+	case err == nil:
+		h.acceptScanReport(c, job)
+		return
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		slog.ErrorContext(c.Request.Context(), "Failed to look up report of scan", "scan_id", scan.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	jobID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate job ID"})
+		return
+	}
+
+	job = models.ReportJob{
+		ID:       jobID,
+		UserID:   userUUID,
+		Type:     models.ReportTypeScan,
+		Format:   models.ReportFormatPDF,
+		ScanID:   &scan.ID,
+		Language: language,
+		CacheKey: cacheKey,
+		Status:   models.JobStatusPending,
+
+		IncludeConfidential: include,
+	}
+	if err := h.db.Create(&job).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create report job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report job"})
+		return
+	}
+
+	if !h.enqueue(c, &job) {
+		return
+	}
+
+	h.acceptScanReport(c, job)
+}
+
+// acceptScanReport answers a report request whose job is still running.
+func (h *ReportHandler) acceptScanReport(c *gin.Context, job models.ReportJob) {
+	c.Header("Retry-After", scanReportRetryAfter)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":        job,
+		"status_url": jobStatusURL(job.ID),
+	})
+}
+
+func writeMatrixCSV(c *gin.Context, matrix *MatrixResponse) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="matrix.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"test", "category"}
+	for _, t := range matrix.Targets {
+		header = append(header, csvSafe(t.TargetURL))
+	}
+	_ = w.Write(header)
+	for _, row := range matrix.Rows {
+		_ = w.Write(append([]string{csvSafe(row.Test), row.Category}, row.Cells...))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to write matrix CSV", "error", err)
+	}
+}
+
+// csvSafe neutralizes values that spreadsheet applications would otherwise
+// evaluate as formulas (CSV injection).
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
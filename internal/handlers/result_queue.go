@@ -0,0 +1,89 @@
+package handlers
+
+// Result ingestion over RabbitMQ.
+//
+// Instead of POSTing to /api/results, workers may publish submissions to
+// ResultsQueue through the default exchange. A message has the body of a
+// POST /api/results request and carries the scan's upload token in the
+// UploadTokenHeader header. HandleResultMessage saves it like the HTTP
+// endpoint and acknowledges it afterwards. Messages that failed to be
+// saved wait a few seconds in ResultsWaitQueue and are retried until they
+// have failed cfg.ResultMaxAttempts times; they then move to
+// ResultsDeadLetterQueue, like messages that can never be saved (invalid
+// JSON or upload tokens, unknown scans).
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Queues of result ingestion.
+const (
+	ResultsQueue           = "results_queue"
+	ResultsWaitQueue       = "results_wait_queue"
+	ResultsDeadLetterQueue = "results_dlq"
+)
+
+// UploadTokenHeader is the message header carrying the upload token of a
+// result message.
+const UploadTokenHeader = "x-upload-token"
+
+// HandleResultMessage saves a results submission from ResultsQueue; it is
+// a queue.Handler. Results of cancelled scans, and submissions ending a
+// scan that has already ended, are dropped.
+func (h *ScanHandler) HandleResultMessage(ctx context.Context, d amqp.Delivery) error {
+	token, _ := d.Headers[UploadTokenHeader].(string)
+	scanUUID, err := h.cfg.UploadTokens().Verify(token, time.Now())
+	if err != nil {
+		return h.deadLetterResult(ctx, d, fmt.Sprintf("Invalid upload token: %v", err))
+	}
+	if len(d.Body) > MaxResultBodyBytes {
+		return h.deadLetterResult(ctx, d, fmt.Sprintf("Message body exceeds %d bytes", MaxResultBodyBytes))
+	}
+
+	_, err = h.ingestResults(ctx, nil, scanUUID.String(), json.NewDecoder(bytes.NewReader(d.Body)))
+	var refused *resultError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &refused) && refused.status == http.StatusConflict:
+		slog.InfoContext(ctx, "Dropping result message of a scan that has ended", "scan_id", scanUUID, "reason", refused.msg)
+		return nil
+	case errors.As(err, &refused) && refused.status < http.StatusInternalServerError:
+		return h.deadLetterResult(ctx, d, refused.msg)
+	}
+
+	attempts := headerInt(d.Headers[attemptsHeader]) + 1
+	if attempts >= h.cfg.ResultMaxAttempts {
+		return h.deadLetterResult(ctx, d, fmt.Sprintf("Failed to save the results %d times: %v", attempts, err))
+	}
+	slog.InfoContext(ctx, "Retrying result message", "scan_id", scanUUID, "attempt", attempts, "max_attempts", h.cfg.ResultMaxAttempts)
+	msg := republished(d)
+	msg.Headers[attemptsHeader] = int32(attempts)
+	return h.publisher.PublishWithContext(ctx, "", ResultsWaitQueue, false, false, msg)
+}
+
+// deadLetterResult moves a result message to ResultsDeadLetterQueue. If
+// that fails, the error requeues the message.
+func (h *ScanHandler) deadLetterResult(ctx context.Context, d amqp.Delivery, reason string) error {
+	msg := republished(d)
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	msg.Headers[failureReasonHeader] = reason
+	msg.Timestamp = time.Now()
+	if err := h.publisher.PublishWithContext(ctx, "", ResultsDeadLetterQueue, false, false, msg); err != nil {
+		return err
+	}
+	slog.WarnContext(ctx, "Result message dead-lettered", "message_id", msg.MessageId, "reason", reason)
+	return nil
+}
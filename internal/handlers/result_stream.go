@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxResultBodyBytes bounds the size of a single results submission.
+	MaxResultBodyBytes = 32 << 20
+	// ResultBatchSize is how many streamed result items are buffered before
+	// they are staged in the database.
+	ResultBatchSize = 100
+)
+
+// resultSubmissionHeader holds the scalar fields of a ResultSubmissionRequest,
+// which are validated separately from the streamed results array.
+type resultSubmissionHeader struct {
+	ScanID      string    `json:"scan_id" binding:"required,uuid"`
+	Status      string    `json:"status" binding:"required,oneof=COMPLETED FAILED"`
+	StartedAt   time.Time `json:"started_at" binding:"required"`
+	CompletedAt time.Time `json:"completed_at" binding:"required"`
+}
+
+// errResultsBeforeScanID is returned when the results array is sent before
+// the scan_id field, which would force buffering the whole array.
+var errResultsBeforeScanID = errors.New("scan_id must precede results in the request body")
+
+// resultError is a results submission that was refused. Status is the HTTP
+// status of the refusal: client errors won't succeed when retried, server
+// errors may.
+type resultError struct {
+	status int
+	msg    string
+	err    error
+}
+
+func (e *resultError) Error() string {
+	return e.msg
+}
+
+func (e *resultError) Unwrap() error {
+	return e.err
+}
+
+// rejectResult refuses a submission with the given status and message.
+func rejectResult(status int, msg string) error {
+	return &resultError{status: status, msg: msg}
+}
+
+// badResult refuses a submission that can't be decoded or is invalid.
+func badResult(err error) error {
+	return &resultError{status: http.StatusBadRequest, msg: err.Error(), err: err}
+}
+
+// checkTokenScan refuses submissions for another scan than tokenScan, the
+// scan of the upload token they were made with, if any.
+func checkTokenScan(tokenScan string, scanUUID uuid.UUID) error {
+	if tokenScan != "" && tokenScan != scanUUID.String() {
+		return rejectResult(http.StatusForbidden, "Upload token is not valid for this scan")
+	}
+	return nil
+}
+
+// HandleResultSubmission accepts results from workers. The body is decoded
+// as a stream and capped at MaxResultBodyBytes, so memory use is bounded
+// regardless of the submission size. Two shapes are accepted:
+//
+//   - AsyncResultRequest: a single engine result (the object is small and
+//     decoded as a whole).
+//   - ResultSubmissionRequest: a full scan submission whose "results" array
+//     is validated item by item and staged in batches of ResultBatchSize,
+//     each in its own transaction. Once the whole body has been read and
+//     validated, the staged results are committed and the scan finished in
+//     a last one, so a submission refused or interrupted midway saves
+//     nothing and can be retried as a whole. scan_id must appear before
+//     results.
+func (h *ScanHandler) HandleResultSubmission(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxResultBodyBytes)
+	dec := json.NewDecoder(c.Request.Body)
+
+	resp, err := h.ingestResults(c.Request.Context(), c, c.GetString("uploadScanID"), dec)
+	if err != nil {
+		var refused *resultError
+		if errors.As(err, &refused) && refused.status != http.StatusBadRequest {
+			c.JSON(refused.status, gin.H{"error": refused.msg})
+			return
+		}
+		respondDecodeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ingestResults decodes and saves one results submission in either shape
+// HandleResultSubmission accepts and returns the response body. tokenScan
+// is the scan of the upload token the submission was made with, if any. c
+// is the request it arrived with, if any; scan status changes are
+// attributed to its caller.
+func (h *ScanHandler) ingestResults(ctx context.Context, c *gin.Context, tokenScan string, dec *json.Decoder) (gin.H, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, badResult(err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return nil, badResult(err)
+		}
+
+		if key == "results" {
+			return h.ingestResultStream(ctx, c, tokenScan, dec, fields)
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, badResult(err)
+		}
+		fields[key] = raw
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, badResult(err)
+	}
+
+	var req AsyncResultRequest
+	if err := decodeFields(fields, &req); err != nil {
+		return nil, badResult(err)
+	}
+
+	return h.ingestAsyncResult(ctx, c, tokenScan, req)
+}
+
+// ingestResultStream consumes the "results" array and the remaining
+// fields of a ResultSubmissionRequest. fields holds the keys decoded before
+// the array.
+func (h *ScanHandler) ingestResultStream(ctx context.Context, c *gin.Context, tokenScan string, dec *json.Decoder, fields map[string]json.RawMessage) (gin.H, error) {
+	var scanIDStr string
+	if raw, ok := fields["scan_id"]; !ok || json.Unmarshal(raw, &scanIDStr) != nil {
+		return nil, badResult(errResultsBeforeScanID)
+	}
+	scanUUID, err := uuid.Parse(scanIDStr)
+	if err != nil {
+		return nil, rejectResult(http.StatusBadRequest, "Invalid Scan ID format")
+	}
+	if err := checkTokenScan(tokenScan, scanUUID); err != nil {
+		return nil, err
+	}
+	logging.SetScanID(ctx, scanUUID.String())
+
+	isPremium, status, err := findScan(h.db, scanUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, rejectResult(http.StatusNotFound, "Scan not found in database")
+		}
+		slog.ErrorContext(ctx, "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		return nil, rejectResult(http.StatusInternalServerError, "Database error")
+	}
+	if status == "CANCELLED" {
+		return nil, rejectResult(http.StatusConflict, "Scan has been cancelled")
+	}
+
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, badResult(err)
+	}
+
+	// The body is decoded outside of any transaction: each batch is staged
+	// in its own short transaction, so a slow upload holds no connection or
+	// scan lock while it streams in. The staged results only become results
+	// of the scan once the submission is complete.
+	submissionID := uuid.New()
+	committed := false
+	defer func() {
+		if !committed {
+			h.discardStagedResults(ctx, scanUUID, submissionID)
+		}
+	}()
+
+	var staged int
+	batch := make([]models.ScanResult, 0, ResultBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := h.stageResultBatch(scanUUID, isPremium, submissionID, staged, batch); err != nil {
+			return err
+		}
+		staged += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for index := 0; dec.More(); index++ {
+		var item ScanResultItem
+		if err := dec.Decode(&item); err != nil {
+			return nil, badResult(fmt.Errorf("results[%d]: %w", index, err))
+		}
+		if err := binding.Validator.ValidateStruct(&item); err != nil {
+			return nil, badResult(fmt.Errorf("results[%d]: %w", index, err))
+		}
+
+		batch = append(batch, item.toModel(scanUUID))
+		if len(batch) == ResultBatchSize {
+			if err := flush(); err != nil {
+				return nil, h.refuseResultSave(ctx, scanUUID, err)
+			}
+		}
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, badResult(err)
+	}
+
+	// Remaining scalar fields may follow the array.
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return nil, badResult(err)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, badResult(err)
+		}
+		fields[key] = raw
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, badResult(err)
+	}
+	var header resultSubmissionHeader
+	if err := decodeFields(fields, &header); err != nil {
+		return nil, badResult(err)
+	}
+
+	if err := flush(); err != nil {
+		return nil, h.refuseResultSave(ctx, scanUUID, err)
+	}
+
+	var saved int
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if status, err = lockScan(tx, scanUUID, isPremium); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"status":       header.Status,
+			"started_at":   header.StartedAt,
+			"completed_at": header.CompletedAt,
+		}
+		if err := finishScan(tx, c, scanUUID, isPremium, status, updates); err != nil {
+			return err
+		}
+		if saved, err = commitStagedResults(tx, scanUUID, submissionID); err != nil {
+			return err
+		}
+		if header.Status == "COMPLETED" {
+			return scoreScan(tx, scanUUID, isPremium)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, h.refuseResultSave(ctx, scanUUID, err)
+	}
+	committed = true
+
+	h.events.Publish(scanUUID, events.TypeProgress, gin.H{"saved": saved})
+	if !scanFinished(status) {
+		h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": header.Status})
+	}
+	if isPremium && !scanFinished(status) {
+		event := webhooks.EventScanCompleted
+		if header.Status == "FAILED" {
+			event = webhooks.EventScanFailed
+		}
+		h.emitScanEvent(scanUUID, event)
+	}
+
+	return gin.H{
+		"message": "Results received",
+		"saved":   saved,
+		"status":  header.Status,
+	}, nil
+}
+
+// stageResultBatch stages a batch of streamed results in its own
+// transaction. offset is the index of the first result of the batch in the
+// submission; a batch staged again is skipped.
+func (h *ScanHandler) stageResultBatch(scanUUID uuid.UUID, isPremium bool, submissionID uuid.UUID, offset int, batch []models.ScanResult) error {
+	rows := make([]models.StagedScanResult, len(batch))
+	for i, r := range batch {
+		rows[i] = models.StagedScanResult{
+			ScanID:       scanUUID,
+			SubmissionID: submissionID,
+			ItemIndex:    offset + i,
+			TestName:     r.TestName,
+			Severity:     r.Severity,
+			Passed:       r.Passed,
+			Message:      r.Message,
+			ArtifactID:   r.ArtifactID,
+			SeverityRank: r.SeverityRank,
+			Metadata:     r.Metadata,
+		}
+	}
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockScan(tx, scanUUID, isPremium); err != nil {
+			return err
+		}
+		if err := checkArtifactRefs(tx, scanUUID, batch); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+}
+
+// commitStagedResults moves the results staged by a submission to the
+// results of the scan, in their order in the submission, and returns how
+// many there were. Results left staged by abandoned submissions of the
+// scan are dropped.
+func commitStagedResults(tx *gorm.DB, scanUUID, submissionID uuid.UUID) (int, error) {
+	res := tx.Exec(`INSERT INTO scan_results (scan_id, test_name, severity, passed, message, artifact_id, severity_rank, metadata)
+		SELECT scan_id, test_name, severity, passed, message, artifact_id, severity_rank, metadata
+		FROM staged_scan_results
+		WHERE scan_id = ? AND submission_id = ?
+		ORDER BY item_index`, scanUUID, submissionID)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if err := tx.Where("scan_id = ?", scanUUID).Delete(&models.StagedScanResult{}).Error; err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected), nil
+}
+
+// discardStagedResults deletes the results staged by a submission that
+// was refused or interrupted.
+func (h *ScanHandler) discardStagedResults(ctx context.Context, scanUUID, submissionID uuid.UUID) {
+	err := h.db.Where("scan_id = ? AND submission_id = ?", scanUUID, submissionID).Delete(&models.StagedScanResult{}).Error
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to discard staged results", "scan_id", scanUUID, "submission_id", submissionID, "error", err)
+	}
+}
+
+// refuseResultSave turns an error saving a streamed submission into its
+// refusal.
+func (h *ScanHandler) refuseResultSave(ctx context.Context, scanUUID uuid.UUID, err error) error {
+	switch {
+	case errors.Is(err, errScanCancelled):
+		return rejectResult(http.StatusConflict, "Scan has been cancelled")
+	case errors.Is(err, errScanFinished):
+		return rejectResult(http.StatusConflict, "Scan has already finished")
+	case errors.Is(err, errUnknownArtifact):
+		return badResult(err)
+	}
+	slog.ErrorContext(ctx, "Failed to save result submission for scan", "scan_id", scanUUID, "error", err)
+	return rejectResult(http.StatusInternalServerError, "Failed to save results")
+}
+
+func (item ScanResultItem) toModel(scanID uuid.UUID) models.ScanResult {
+	meta, _ := json.Marshal(map[string]string{
+		"test_id":     item.TestID,
+		"category":    item.Category,
+		"reference":   item.Reference,
+		"remediation": item.Remediation,
+	})
+
+	result := models.ScanResult{
+		ScanID:   scanID,
+		TestName: item.TestName,
+		Severity: item.Severity,
+		Passed:   item.Passed,
+		Message:  item.Message,
+		Metadata: datatypes.JSON(meta),
+
+		SeverityRank: models.SeverityRank(item.Severity),
+	}
+	// ArtifactID has already been validated as a UUID by the binding.
+	if artifactUUID, err := uuid.Parse(item.ArtifactID); err == nil {
+		result.ArtifactID = &artifactUUID
+	}
+	return result
+}
+
+// decodeFields assembles the collected top-level fields into v and runs the
+// binding validation on it.
+func decodeFields(fields map[string]json.RawMessage, v interface{}) error {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+func readKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected object key, got %v", tok)
+	}
+	return key, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("unexpected end of JSON input, expected %q", want)
+		}
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+func respondDecodeError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit)})
+		return
+	}
+	slog.WarnContext(c.Request.Context(), "Binding error", "error", err)
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
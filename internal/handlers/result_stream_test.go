@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// resultStore answers the statements of a streamed results submission for
+// a single free scan, keeping its status, staged results, results and
+// status events.
+type resultStore struct {
+	mu      sync.Mutex
+	scanID  uuid.UUID
+	status  string
+	staged  []map[string]driver.Value
+	results []map[string]driver.Value
+	events  int
+}
+
+var setStatus = regexp.MustCompile(`"status"=\$(\d+)`)
+
+func (s *resultStore) handle(query string, args []driver.NamedValue) (dbtest.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT") && strings.Contains(query, `FROM "scans"`):
+		if strings.Contains(query, "FOR UPDATE") {
+			return dbtest.Result{Columns: []string{"status"}, Rows: [][]driver.Value{{s.status}}}, nil
+		}
+		return dbtest.Result{Columns: []string{"id", "status"}, Rows: [][]driver.Value{{s.scanID.String(), s.status}}}, nil
+
+	case strings.HasPrefix(query, `INSERT INTO "staged_scan_results"`):
+		var inserted int64
+		for _, row := range insertedRows(query, args) {
+			if !s.isStaged(row) {
+				s.staged = append(s.staged, row)
+				inserted++
+			}
+		}
+		return dbtest.Result{RowsAffected: inserted}, nil
+
+	case strings.HasPrefix(query, "INSERT INTO scan_results"):
+		var moved []map[string]driver.Value
+		for _, row := range s.staged {
+			if row["scan_id"] == args[0].Value && row["submission_id"] == args[1].Value {
+				moved = append(moved, row)
+			}
+		}
+		sort.Slice(moved, func(i, j int) bool { return moved[i]["item_index"].(int64) < moved[j]["item_index"].(int64) })
+		s.results = append(s.results, moved...)
+		return dbtest.Result{RowsAffected: int64(len(moved))}, nil
+
+	case strings.HasPrefix(query, `DELETE FROM "staged_scan_results"`):
+		kept := s.staged[:0]
+		for _, row := range s.staged {
+			discarded := row["scan_id"] == args[0].Value
+			if strings.Contains(query, "submission_id") {
+				discarded = discarded && row["submission_id"] == args[1].Value
+			}
+			if !discarded {
+				kept = append(kept, row)
+			}
+		}
+		s.staged = kept
+		return dbtest.Result{}, nil
+
+	case strings.HasPrefix(query, `UPDATE "scans"`):
+		m := setStatus.FindStringSubmatch(query)
+		if m == nil {
+			return dbtest.Result{}, errors.New("scan update without status: " + query)
+		}
+		n, _ := strconv.Atoi(m[1])
+		s.status = args[n-1].Value.(string)
+		return dbtest.Result{RowsAffected: 1}, nil
+
+	case strings.HasPrefix(query, `INSERT INTO "scan_events"`):
+		s.events++
+		return dbtest.Result{RowsAffected: 1}, nil
+	}
+	return dbtest.Result{}, errors.New("unexpected statement: " + query)
+}
+
+func (s *resultStore) isStaged(row map[string]driver.Value) bool {
+	for _, r := range s.staged {
+		if r["scan_id"] == row["scan_id"] && r["submission_id"] == row["submission_id"] && r["item_index"] == row["item_index"] {
+			return true
+		}
+	}
+	return false
+}
+
+// insertedRows returns the rows of an INSERT statement by column. GORM
+// writes NULL values into the statement instead of passing them as
+// arguments.
+func insertedRows(query string, args []driver.NamedValue) []map[string]driver.Value {
+	head, values, _ := strings.Cut(query, " VALUES ")
+	values, _, _ = strings.Cut(values, " ON CONFLICT")
+	columns := strings.Split(head[strings.Index(head, "(")+1:strings.LastIndex(head, ")")], ",")
+
+	var rows []map[string]driver.Value
+	for _, group := range strings.Split(strings.Trim(values, "()"), "),(") {
+		row := map[string]driver.Value{}
+		for i, p := range strings.Split(group, ",") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(p, "$")); err == nil {
+				row[strings.Trim(columns[i], `"`)] = args[n-1].Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// resultSubmission returns the body of a ResultSubmissionRequest with n
+// results and the given status; edit may change an item before it is
+// encoded.
+func resultSubmission(scanID uuid.UUID, n int, status string, edit func(i int, item map[string]interface{})) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"scan_id":%q,"results":[`, scanID)
+	for i := 0; i < n; i++ {
+		item := map[string]interface{}{
+			"test_id":   "test-" + strconv.Itoa(i),
+			"test_name": "Test " + strconv.Itoa(i),
+			"category":  "headers",
+			"severity":  "Low",
+			"passed":    i%2 == 0,
+			"message":   "Result " + strconv.Itoa(i),
+		}
+		if edit != nil {
+			edit(i, item)
+		}
+		raw, _ := json.Marshal(item)
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(raw)
+	}
+	fmt.Fprintf(&b, `],"status":%q,"started_at":"2025-06-01T12:00:00Z","completed_at":"2025-06-01T12:05:00Z"}`, status)
+	return b.String()
+}
+
+func TestResultSubmissionRetryAfterFailure(t *testing.T) {
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	const total = 2*ResultBatchSize + 50
+	valid := resultSubmission(scanID, total, "FAILED", nil)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name: "invalid item after two batches",
+			body: resultSubmission(scanID, total, "FAILED", func(i int, item map[string]interface{}) {
+				if i == 2*ResultBatchSize+10 {
+					delete(item, "test_name")
+				}
+			}),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid status after the results",
+			body:       resultSubmission(scanID, total, "DONE", nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "connection dropped midway",
+			body:       valid[:len(valid)*3/4],
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &resultStore{scanID: scanID, status: "RUNNING"}
+			h := &ScanHandler{db: dbtest.Open(t, store.handle), events: events.NewBroker()}
+			ingest := func(body string) (map[string]interface{}, error) {
+				return h.ingestResults(context.Background(), nil, "", json.NewDecoder(strings.NewReader(body)))
+			}
+
+			_, err := ingest(tt.body)
+			var refused *resultError
+			if !errors.As(err, &refused) || refused.status != tt.wantStatus {
+				t.Fatalf("ingestResults() error = %v, want a %d refusal", err, tt.wantStatus)
+			}
+			if len(store.results) != 0 || len(store.staged) != 0 || store.status != "RUNNING" || store.events != 0 {
+				t.Fatalf("refused submission left %d results, %d staged results, status %s and %d events",
+					len(store.results), len(store.staged), store.status, store.events)
+			}
+
+			resp, err := ingest(valid)
+			if err != nil {
+				t.Fatalf("retry error = %v", err)
+			}
+			if resp["saved"] != total {
+				t.Errorf("retry saved %v results, want %d", resp["saved"], total)
+			}
+			if len(store.results) != total {
+				t.Fatalf("scan has %d results after the retry, want %d", len(store.results), total)
+			}
+			for i, r := range store.results {
+				if r["test_name"] != "Test "+strconv.Itoa(i) {
+					t.Fatalf("result %d is %v, want the results in submission order", i, r["test_name"])
+				}
+			}
+			if len(store.staged) != 0 || store.status != "FAILED" || store.events != 1 {
+				t.Errorf("after the retry: %d staged results, status %s, %d events; want 0, FAILED, 1",
+					len(store.staged), store.status, store.events)
+			}
+		})
+	}
+}
+
+func TestStageResultBatchIsIdempotent(t *testing.T) {
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	store := &resultStore{scanID: scanID, status: "RUNNING"}
+	h := &ScanHandler{db: dbtest.Open(t, store.handle), events: events.NewBroker()}
+
+	item := ScanResultItem{TestID: "hsts", TestName: "HSTS", Category: "headers", Severity: "Low"}
+	batch := []models.ScanResult{item.toModel(scanID), item.toModel(scanID)}
+	submission := uuid.New()
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := h.stageResultBatch(scanID, false, submission, 0, batch); err != nil {
+			t.Fatalf("stageResultBatch() attempt %d error = %v", attempt+1, err)
+		}
+	}
+	if len(store.staged) != len(batch) {
+		t.Errorf("staging a batch twice left %d staged results, want %d", len(store.staged), len(batch))
+	}
+}
+
+func TestResultSubmissionToEndedScan(t *testing.T) {
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	body := resultSubmission(scanID, 3, "FAILED", nil)
+
+	for _, status := range []string{"COMPLETED", "FAILED", "REJECTED", "CANCELLED"} {
+		t.Run(status, func(t *testing.T) {
+			store := &resultStore{scanID: scanID, status: status}
+			h := &ScanHandler{db: dbtest.Open(t, store.handle), events: events.NewBroker()}
+
+			_, err := h.ingestResults(context.Background(), nil, "", json.NewDecoder(strings.NewReader(body)))
+			var refused *resultError
+			if !errors.As(err, &refused) || refused.status != http.StatusConflict {
+				t.Fatalf("ingestResults() error = %v, want a %d refusal", err, http.StatusConflict)
+			}
+			if len(store.results) != 0 || len(store.staged) != 0 || store.status != status || store.events != 0 {
+				t.Errorf("refused submission left %d results, %d staged results, status %s and %d events",
+					len(store.results), len(store.staged), store.status, store.events)
+			}
+		})
+	}
+}
+
+func TestResultSubmissionIsSavedOnce(t *testing.T) {
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	store := &resultStore{scanID: scanID, status: "PENDING"}
+	h := &ScanHandler{db: dbtest.Open(t, store.handle), events: events.NewBroker()}
+	body := resultSubmission(scanID, 3, "FAILED", nil)
+
+	// A worker whose response got lost sends the submission again.
+	if _, err := h.ingestResults(context.Background(), nil, "", json.NewDecoder(strings.NewReader(body))); err != nil {
+		t.Fatalf("first submission error = %v", err)
+	}
+	_, err := h.ingestResults(context.Background(), nil, "", json.NewDecoder(strings.NewReader(body)))
+	var refused *resultError
+	if !errors.As(err, &refused) || refused.status != http.StatusConflict {
+		t.Fatalf("second submission error = %v, want a %d refusal", err, http.StatusConflict)
+	}
+	if len(store.results) != 3 || len(store.staged) != 0 || store.events != 1 {
+		t.Errorf("after both submissions: %d results, %d staged results, %d events; want 3, 0, 1",
+			len(store.results), len(store.staged), store.events)
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Lists that saved views can be created for.
+const (
+	SavedViewResourceScans    = "scans"
+	SavedViewResourceFindings = "findings"
+)
+
+// savedViewFilterKeys lists the query parameters each list accepts as
+// saved filters.
+var savedViewFilterKeys = map[string][]string{
+	SavedViewResourceScans:    {"status", "target", "tag", "organization_id", "created_from", "created_to"},
+	SavedViewResourceFindings: {"severity", "passed", "test_name", "target", "scan_id", "triage_status", "assignee_id", "sort"},
+}
+
+type SavedViewHandler struct {
+	db *gorm.DB
+}
+
+type SavedViewRequest struct {
+	Name     string            `json:"name" binding:"required,max=100"`
+	Resource string            `json:"resource" binding:"required"`
+	Filters  map[string]string `json:"filters"`
+	Shared   bool              `json:"shared"`
+}
+
+func NewSavedViewHandler(db *gorm.DB) *SavedViewHandler {
+	return &SavedViewHandler{
+		db: db,
+	}
+}
+
+// HandleListSavedViews lists the views visible to the current user,
+// optionally restricted to one list with ?resource=.
+func (h *SavedViewHandler) HandleListSavedViews(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	query := visibleSavedViews(h.db, userUUID)
+	if resource := c.Query("resource"); resource != "" {
+		query = query.Where("resource = ?", resource)
+	}
+
+	views := make([]models.SavedView, 0)
+	if err := query.Order("resource, name").Find(&views).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list saved views", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func (h *SavedViewHandler) HandleCreateSavedView(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if err := validateSavedViewFilters(req.Resource, req.Filters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	viewID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate view ID"})
+		return
+	}
+
+	if taken, err := h.nameTaken(userUUID, req.Resource, req.Name, uuid.Nil); err != nil || taken {
+		respondNameTaken(c, err)
+		return
+	}
+
+	view := models.SavedView{
+		ID:       viewID,
+		UserID:   userUUID,
+		Resource: req.Resource,
+		Name:     req.Name,
+		Filters:  datatypes.NewJSONType(normalizeFilters(req.Filters)),
+		Shared:   req.Shared,
+	}
+	if err := h.db.Create(&view).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save view", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save view"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, view)
+}
+
+func (h *SavedViewHandler) HandleUpdateSavedView(c *gin.Context) {
+	view, ok := h.ownedView(c)
+	if !ok {
+		return
+	}
+
+	var req SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	if req.Resource != view.Resource {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The resource of a view cannot be changed"})
+		return
+	}
+	if err := validateSavedViewFilters(req.Resource, req.Filters); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if taken, err := h.nameTaken(view.UserID, view.Resource, req.Name, view.ID); err != nil || taken {
+		respondNameTaken(c, err)
+		return
+	}
+
+	view.Name = req.Name
+	view.Filters = datatypes.NewJSONType(normalizeFilters(req.Filters))
+	view.Shared = req.Shared
+	if err := h.db.Save(view).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update view", "view_id", view.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update view"})
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *SavedViewHandler) HandleDeleteSavedView(c *gin.Context) {
+	view, ok := h.ownedView(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(view).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete view", "view_id", view.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete view"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandleSetDefaultSavedView makes the view the user's default for its list,
+// replacing the previous default.
+func (h *SavedViewHandler) HandleSetDefaultSavedView(c *gin.Context) {
+	view, ok := h.ownedView(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SavedView{}).
+			Where("user_id = ? AND resource = ? AND is_default", view.UserID, view.Resource).
+			Update("is_default", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(view).Update("is_default", true).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to set default view", "view_id", view.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default view"})
+		return
+	}
+
+	view.IsDefault = true
+	c.JSON(http.StatusOK, view)
+}
+
+// ownedView loads the view in the :id parameter if it belongs to the current
+// user. On failure an error response is written and ok is false.
+func (h *SavedViewHandler) ownedView(c *gin.Context) (*models.SavedView, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	viewID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID format"})
+		return nil, false
+	}
+
+	var view models.SavedView
+	if err := h.db.First(&view, "id = ? AND user_id = ?", viewID, userUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+			return nil, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up view", "view_id", viewID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &view, true
+}
+
+// nameTaken reports whether the user already has another view with the
+// name for the resource.
+func (h *SavedViewHandler) nameTaken(userUUID uuid.UUID, resource, name string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := h.db.Model(&models.SavedView{}).
+		Where("user_id = ? AND resource = ? AND name = ? AND id <> ?", userUUID, resource, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func respondNameTaken(c *gin.Context, err error) {
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check view name", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "A view with this name already exists"})
+}
+
+// visibleSavedViews scopes a query to the views the user may use: their own
+// views and views shared by other members of their organization.
+func visibleSavedViews(db *gorm.DB, userUUID uuid.UUID) *gorm.DB {
+	// Users don't belong to organizations yet, so only the user's own views
+	// are visible; shared views become visible to org members once
+	// organizations exist.
+	return db.Model(&models.SavedView{}).Where("user_id = ?", userUUID)
+}
+
+// viewParams returns the list filters for a request: the filters of the
+// saved view selected with ?view= (if any), overridden by explicit query
+// parameters. On failure an error response is written and ok is false.
+func viewParams(c *gin.Context, db *gorm.DB, userUUID uuid.UUID, resource string) (url.Values, bool) {
+	params := url.Values{}
+
+	if raw := c.Query("view"); raw != "" {
+		viewID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID format"})
+			return nil, false
+		}
+
+		var view models.SavedView
+		err = visibleSavedViews(db, userUUID).Where("id = ? AND resource = ?", viewID, resource).First(&view).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+				return nil, false
+			}
+			slog.ErrorContext(c.Request.Context(), "Failed to look up view", "view_id", viewID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		for k, v := range view.Filters.Data() {
+			params.Set(k, v)
+		}
+	}
+
+	for k, v := range c.Request.URL.Query() {
+		if k != "view" {
+			params[k] = v
+		}
+	}
+	return params, true
+}
+
+func validateSavedViewFilters(resource string, filters map[string]string) error {
+	keys, ok := savedViewFilterKeys[resource]
+	if !ok {
+		return fmt.Errorf("resource must be %q or %q", SavedViewResourceScans, SavedViewResourceFindings)
+	}
+	for k := range filters {
+		if !slices.Contains(keys, k) {
+			return fmt.Errorf("unsupported filter %q for %s, supported filters: %v", k, resource, keys)
+		}
+	}
+	if v, ok := filters["sort"]; ok {
+		if _, err := resultOrder(v, ""); err != nil {
+			return err
+		}
+	}
+	if v, ok := filters["created_from"]; ok && v != "" {
+		if _, err := parseTimeParam(v, false); err != nil {
+			return fmt.Errorf("created_from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+	}
+	if v, ok := filters["created_to"]; ok && v != "" {
+		if _, err := parseTimeParam(v, true); err != nil {
+			return fmt.Errorf("created_to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+	}
+	return nil
+}
+
+func normalizeFilters(filters map[string]string) map[string]string {
+	if filters == nil {
+		return map[string]string{}
+	}
+	return filters
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetScanStatusRequest forces a scan into a final status.
+type SetScanStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=FAILED CANCELLED"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// errNotRequeueable is returned when a scan in a status that can't be
+// requeued is requeued.
+var errNotRequeueable = errors.New("scan can't be requeued")
+
+// errNoRecordedTests is returned when a scan from before tests were
+// recorded is requeued; its task can't be rebuilt.
+var errNoRecordedTests = errors.New("scan has no recorded tests")
+
+// HandleAdminSetScanStatus forces any user's unfinished scan to FAILED or
+// CANCELLED, e.g. when its worker died without a heartbeat. Cancelling
+// also tells workers to abort the scan. The reason is recorded in the
+// scan's timeline and the audit log.
+func (h *ScanHandler) HandleAdminSetScanStatus(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+	var req SetScanStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	reason := "Forced by an admin: " + req.Reason
+	if req.Status == "CANCELLED" {
+		h.cancelScan(c, scanUUID, reason, func(db *gorm.DB) *gorm.DB { return db })
+		if c.Writer.Status() != http.StatusOK {
+			return
+		}
+		// The scan is already cancelled, so a failure here only loses the
+		// audit entry.
+		if err := recordAudit(h.db, c, models.AuditScanStatusForced, "scan", scanUUID.String(), gin.H{"to": req.Status, "reason": req.Reason}); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to record forced status in the audit log", "scan_id", scanUUID, "error", err)
+		}
+		return
+	}
+
+	var scan models.PremiumScan
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").
+			First(&scan, "id = ?", scanUUID).Error; err != nil {
+			return err
+		}
+		if scanFinished(scan.Status) {
+			return errNotCancellable
+		}
+		err := tx.Model(&models.PremiumScan{ID: scanUUID}).Updates(map[string]interface{}{
+			"status":       req.Status,
+			"completed_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := recordScanEvent(tx, c, scanUUID, scan.Status, req.Status, reason); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditScanStatusForced, "scan", scanUUID.String(), gin.H{
+			"from":   scan.Status,
+			"to":     req.Status,
+			"reason": req.Reason,
+		})
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	case errors.Is(err, errNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan has already finished", "status": scan.Status})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to force scan status", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": req.Status})
+	h.emitScanEvent(scanUUID, webhooks.EventScanFailed)
+
+	c.JSON(http.StatusOK, gin.H{
+		"scanId": scanUUID.String(),
+		"status": req.Status,
+	})
+}
+
+// HandleAdminRequeueScan sends a new task for any user's PENDING, RUNNING
+// or FAILED scan to the workers, for scans whose task was lost or whose
+// worker got stuck. The scan moves back to PENDING and the results it
+// already has are deleted, since the new run submits them all again. A
+// worker still running the old task isn't stopped.
+func (h *ScanHandler) HandleAdminRequeueScan(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var scan models.PremiumScan
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&scan, "id = ?", scanUUID).Error; err != nil {
+			return err
+		}
+		switch scan.Status {
+		case "PENDING", "RUNNING", "FAILED":
+		default:
+			return errNotRequeueable
+		}
+		if len(scan.Tests) == 0 {
+			return errNoRecordedTests
+		}
+
+		err := tx.Model(&models.PremiumScan{ID: scanUUID}).Updates(map[string]interface{}{
+			"status":            "PENDING",
+			"started_at":        nil,
+			"completed_at":      nil,
+			"last_heartbeat_at": nil,
+			"score":             nil,
+			"grade":             "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("scan_id = ?", scanUUID).Delete(&models.ScanResult{}).Error; err != nil {
+			return err
+		}
+		if err := recordScanEvent(tx, c, scanUUID, scan.Status, "PENDING", "Requeued by an admin"); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditScanRequeued, "scan", scanUUID.String(), gin.H{"from": scan.Status})
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	case errors.Is(err, errNotRequeueable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending, running or failed scans can be requeued", "status": scan.Status})
+		return
+	case errors.Is(err, errNoRecordedTests):
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan predates recorded tests and can't be requeued"})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to requeue scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	task, err := json.Marshal(premiumTask(scan, scan.Tests, scan.AntiBotDetection))
+	if err == nil {
+		err = h.enqueueTask(c.Request.Context(), scan.ID, task, scan.Priority)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to publish requeued task", "scan_id", scanUUID, "error", err)
+		if failErr := h.failScan(scanUUID, "Failed to queue scan"); failErr != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to fail unqueued scan", "scan_id", scanUUID, "error", failErr)
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to queue scan"})
+		return
+	}
+
+	h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "PENDING"})
+	slog.InfoContext(c.Request.Context(), "Scan requeued", "scan_id", scanUUID, "from", scan.Status)
+	c.JSON(http.StatusAccepted, gin.H{
+		"scanId": scanUUID.String(),
+		"status": "PENDING",
+	})
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// errNotAwaitingApproval is returned when a decision is made on a scan that
+// isn't waiting for one.
+var errNotAwaitingApproval = errors.New("scan is not awaiting approval")
+
+type ApprovalDecisionRequest struct {
+	Note string `json:"note" binding:"max=2000"`
+}
+
+type ProductionTargetRequest struct {
+	Host string `json:"host" binding:"required,max=253"`
+}
+
+// enqueueTask publishes a premium scan task for the workers with the
+// scan's priority, adding a fresh upload token for the scan. Tasks are
+// stored without a token while they wait for approval, so the token's
+// lifetime starts when the task is queued.
+func (h *ScanHandler) enqueueTask(ctx context.Context, scanID uuid.UUID, task []byte, priority string) error {
+	var payload ScanTaskPayload
+	if err := json.Unmarshal(task, &payload); err != nil {
+		return err
+	}
+	payload.UploadToken = h.cfg.UploadTokens().Issue(scanID)
+	task, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return h.publisher.PublishWithContext(ctx,
+		"",
+		ScanQueue,
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Priority:     scanPriorities[priority],
+			Body:         task,
+		})
+}
+
+// isProductionTarget reports whether the target's host is marked as
+// production, either directly or through a "*." wildcard entry.
+func isProductionTarget(db *gorm.DB, target string) (bool, error) {
+	host := targets.Host(target)
+	if host == "" {
+		return false, nil
+	}
+
+	candidates := []string{host}
+	for rest := host; strings.Contains(rest, "."); {
+		rest = rest[strings.Index(rest, ".")+1:]
+		candidates = append(candidates, "*."+rest)
+	}
+
+	var count int64
+	err := db.Model(&models.ProductionTarget{}).Where("host IN ?", candidates).Count(&count).Error
+	return count > 0, err
+}
+
+// needsApproval reports whether a scan of the target submitted by the user
+// has to be approved first: production targets may only be scanned
+// directly by admins. The role is read from the database so that a
+// demotion applies before the user's token expires.
+func (h *ScanHandler) needsApproval(userUUID uuid.UUID, target string) (bool, error) {
+	var user models.User
+	if err := h.db.Select("id", "role").First(&user, "id = ?", userUUID).Error; err != nil {
+		return false, err
+	}
+	if user.Role == models.UserRoleAdmin {
+		return false, nil
+	}
+	return isProductionTarget(h.db, target)
+}
+
+// notifyApprovers tells every admin by email and webhook that a scan is
+// waiting for approval.
+func (h *ScanHandler) notifyApprovers(scan models.PremiumScan, tests []string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		var requester models.User
+		if err := h.db.Select("id", "email").First(&requester, "id = ?", scan.UserID).Error; err != nil {
+			slog.Error("Failed to load requester of scan", "scan_id", scan.ID, "error", err)
+		}
+
+		var admins []models.User
+		if err := h.db.Select("id", "full_name", "email").Where("role = ?", models.UserRoleAdmin).Find(&admins).Error; err != nil {
+			slog.Error("Failed to load approvers of scan", "scan_id", scan.ID, "error", err)
+			return
+		}
+
+		data := scanEventData(scan)
+		data["requested_by"] = scan.UserID
+		data["tests"] = tests
+		for _, admin := range admins {
+			err := h.renderer.Send(ctx, h.mailer, mail.TemplateApprovalRequest, admin.Email, map[string]interface{}{
+				"Name":      admin.FullName,
+				"Requester": requester.Email,
+				"TargetURL": scan.TargetURL,
+				"Tests":     strings.Join(tests, ", "),
+				"Link":      h.cfg.FrontendLink("/scans/" + scan.ID.String()),
+			})
+			if err != nil {
+				slog.Error("Failed to send approval request", "scan_id", scan.ID, "approver_id", admin.ID, "error", err)
+			}
+			h.webhooks.Emit(admin.ID, webhooks.EventScanApprovalRequested, data)
+		}
+	}()
+}
+
+// HandleApproveScan approves a scan in PENDING_APPROVAL and queues it.
+func (h *ScanHandler) HandleApproveScan(c *gin.Context) {
+	approval, ok := h.decideApproval(c, models.ApprovalApproved, "PENDING")
+	if !ok {
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := h.db.Select("priority").First(&scan, "id = ?", approval.ScanID).Error; err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to look up priority of approved scan", "scan_id", approval.ScanID, "error", err)
+		scan.Priority = models.ScanPriorityNormal
+	}
+	if err := h.enqueueTask(c.Request.Context(), approval.ScanID, approval.Task, scan.Priority); err != nil {
+		// The approval stands; mark the scan failed so it doesn't sit in
+		// PENDING forever.
+		slog.ErrorContext(c.Request.Context(), "Failed to queue approved scan", "scan_id", approval.ScanID, "error", err)
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.PremiumScan{ID: approval.ScanID}).Where("status = ?", "PENDING").
+				Updates(map[string]interface{}{"status": "FAILED", "completed_at": time.Now()})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return recordScanEvent(tx, nil, approval.ScanID, "PENDING", "FAILED", "Failed to queue the approved scan")
+		})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to mark approved scan as failed", "scan_id", approval.ScanID, "error", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue scan"})
+		return
+	}
+
+	h.events.Publish(approval.ScanID, events.TypeStatus, gin.H{"status": "PENDING"})
+	c.JSON(http.StatusOK, gin.H{
+		"scanId":   approval.ScanID.String(),
+		"status":   "PENDING",
+		"approval": approval,
+	})
+}
+
+// HandleRejectScan rejects a scan in PENDING_APPROVAL; it is never queued.
+func (h *ScanHandler) HandleRejectScan(c *gin.Context) {
+	approval, ok := h.decideApproval(c, models.ApprovalRejected, "REJECTED")
+	if !ok {
+		return
+	}
+
+	h.events.Publish(approval.ScanID, events.TypeStatus, gin.H{"status": "REJECTED"})
+	c.JSON(http.StatusOK, gin.H{
+		"scanId":   approval.ScanID.String(),
+		"status":   "REJECTED",
+		"approval": approval,
+	})
+}
+
+// decideApproval records the current admin's decision on the scan in the :id
+// parameter and moves the scan to status. On failure an error response is
+// written and ok is false.
+func (h *ScanHandler) decideApproval(c *gin.Context, decision, status string) (*models.ScanApproval, bool) {
+	adminUUID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return nil, false
+	}
+
+	var req ApprovalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindingError(c, err)
+		return nil, false
+	}
+
+	var approval models.ScanApproval
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&approval, "scan_id = ?", scanUUID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"status": status}
+		if status == "REJECTED" {
+			updates["completed_at"] = time.Now()
+		}
+		result := tx.Model(&models.PremiumScan{}).
+			Where("id = ? AND status = ?", scanUUID, "PENDING_APPROVAL").
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotAwaitingApproval
+		}
+
+		now := time.Now()
+		approval.Decision = decision
+		approval.DecidedBy = &adminUUID
+		approval.DecidedAt = &now
+		approval.Note = req.Note
+		if err := tx.Save(&approval).Error; err != nil {
+			return err
+		}
+
+		reason, action := "Approved", models.AuditScanApproved
+		if decision == models.ApprovalRejected {
+			reason, action = "Rejected", models.AuditScanRejected
+		}
+		if req.Note != "" {
+			reason += ": " + req.Note
+		}
+		if err := recordScanEvent(tx, c, scanUUID, "PENDING_APPROVAL", status, reason); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, action, "scan", scanUUID.String(), gin.H{"note": req.Note})
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No approval request for this scan"})
+		return nil, false
+	case errors.Is(err, errNotAwaitingApproval):
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan is not awaiting approval"})
+		return nil, false
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to record decision for scan", "decision", decision, "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &approval, true
+}
+
+func (h *ScanHandler) HandleListProductionTargets(c *gin.Context) {
+	targets := make([]models.ProductionTarget, 0)
+	if err := h.db.Order("host").Find(&targets).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list production targets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, targets)
+}
+
+// HandleCreateProductionTarget marks a host (or "*.domain" for all of its
+// subdomains) as production.
+func (h *ScanHandler) HandleCreateProductionTarget(c *gin.Context) {
+	adminUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ProductionTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	host := strings.ToLower(strings.TrimSpace(req.Host))
+	wildcard := strings.HasPrefix(host, "*.")
+	bare := strings.TrimPrefix(host, "*.")
+	if bare == "" || strings.ContainsAny(bare, "/:*@ ") || targets.Host(bare) != bare {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "host must be a host name such as shop.example.com or *.example.com"})
+		return
+	}
+	if wildcard {
+		host = "*." + bare
+	}
+
+	var count int64
+	if err := h.db.Model(&models.ProductionTarget{}).Where("host = ?", host).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Host is already marked as production"})
+		return
+	}
+
+	targetID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate ID"})
+		return
+	}
+
+	target := models.ProductionTarget{
+		ID:        targetID,
+		Host:      host,
+		CreatedBy: adminUUID,
+		CreatedAt: time.Now(),
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&target).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditProductionTargetCreated, "production_target", target.ID.String(), gin.H{"host": host})
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create production target", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create production target"})
+		return
+	}
+	c.JSON(http.StatusCreated, target)
+}
+
+func (h *ScanHandler) HandleDeleteProductionTarget(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var target models.ProductionTarget
+		if err := tx.First(&target, "id = ?", targetID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&target).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditProductionTargetDeleted, "production_target", target.ID.String(), gin.H{"host": target.Host})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Production target not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete production target", "target_id", targetID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete production target"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
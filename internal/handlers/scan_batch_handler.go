@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// BatchScanRequest submits premium scans of several targets with the same
+// tests and options. Either Tests or a Profile is required.
+type BatchScanRequest struct {
+	TargetURLs       []string `json:"target_urls" binding:"required,min=1"`
+	Tests            []string `json:"tests"`
+	AntiBotDetection bool     `json:"anti_bot_detection"`
+	Screenshot       bool     `json:"screenshot"`
+	Tags             []string `json:"tags"`
+	// Priority defaults to low, so that batches don't hold up scans
+	// submitted one by one.
+	Priority string `json:"priority"`
+	Profile  string `json:"profile"`
+	// OrganizationID shares the scans with an organization the user is a
+	// member of.
+	OrganizationID *uuid.UUID `json:"organization_id"`
+}
+
+// BatchScan is one scan of a batch.
+type BatchScan struct {
+	ScanID    uuid.UUID `json:"scan_id"`
+	TargetURL string    `json:"target_url"`
+	Status    string    `json:"status"`
+	Score     *float64  `json:"score,omitempty"`
+	Grade     string    `json:"grade,omitempty"`
+}
+
+// BatchScanResponse describes the scans of a batch. StatusCounts and
+// Finished are only filled in when the batch is polled.
+type BatchScanResponse struct {
+	BatchID      uuid.UUID      `json:"batch_id"`
+	Scans        []BatchScan    `json:"scans"`
+	StatusCounts map[string]int `json:"status_counts,omitempty"`
+	Finished     *bool          `json:"finished,omitempty"`
+}
+
+// HandleBatchScanSubmission starts premium scans of up to
+// cfg.ScanBatchMaxTargets targets. All scans are created in one
+// transaction and share a batch ID, which GET /api/scans/batch/:id polls.
+// The batch is refused as a whole if one of its targets may not be
+// scanned. Scans of production targets wait for approval like single
+// submissions; scans whose task can't be queued are failed.
+func (h *ScanHandler) HandleBatchScanSubmission(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req BatchScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	seen := map[string]bool{}
+	var targetURLs []string
+	for _, u := range req.TargetURLs {
+		if u = strings.TrimSpace(u); u != "" && !seen[u] {
+			seen[u] = true
+			targetURLs = append(targetURLs, u)
+		}
+	}
+	if len(targetURLs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No target URLs provided"})
+		return
+	}
+	if len(targetURLs) > h.cfg.ScanBatchMaxTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch can scan at most %d targets", h.cfg.ScanBatchMaxTargets)})
+		return
+	}
+	if !checkScanOrganization(c, h.db, req.OrganizationID, userUUID) {
+		return
+	}
+	quotaAccounts, apiKeyID, err := h.quotaAccounts(c, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load API key quota", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if len(req.Tests) == 0 && req.Profile == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either tests or a profile is required"})
+		return
+	}
+	profile, validTests, err := resolveScanProfile(req.Profile, req.Tests, models.ScanProfileCustom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(validTests) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid tests provided"})
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	priority, err := parseScanPriority(req.Priority, models.ScanPriorityLow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batchID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate batch ID"})
+		return
+	}
+
+	now := time.Now()
+	scans := make([]models.PremiumScan, 0, len(targetURLs))
+	tasks := make([][]byte, 0, len(targetURLs))
+	approvals := make([]bool, 0, len(targetURLs))
+	for _, targetURL := range targetURLs {
+		owningTarget, err := targets.FindOwning(h.db, userUUID, targetURL)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Failed to look up the verified target", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if owningTarget == nil {
+			if msg := h.unverifiedTargetError(validTests); msg != "" {
+				c.JSON(http.StatusForbidden, gin.H{"error": msg, "target_url": targetURL})
+				return
+			}
+		}
+		needsApproval, err := h.needsApproval(userUUID, targetURL)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to check whether scan needs approval", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		scanID, err := uuid.NewV7()
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate scan ID"})
+			return
+		}
+		scan := models.PremiumScan{
+			ID:         scanID,
+			UserID:     userUUID,
+			TargetURL:  targetURL,
+			Status:     "PENDING",
+			Screenshot: req.Screenshot,
+			CreatedAt:  now,
+			BatchID:    &batchID,
+			Priority:   priority,
+			Profile:    profile,
+			Tests:      datatypes.NewJSONSlice(validTests),
+
+			OrganizationID: req.OrganizationID,
+			APIKeyID:       apiKeyID,
+
+			AntiBotDetection: req.AntiBotDetection,
+		}
+		if owningTarget != nil {
+			scan.TargetID = &owningTarget.ID
+		}
+		if needsApproval {
+			scan.Status = "PENDING_APPROVAL"
+		}
+		if len(tags) > 0 {
+			scan.Tags = scanTags(scan.ID, tags)
+		}
+
+		task, err := json.Marshal(premiumTask(scan, validTests, req.AntiBotDetection))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to marshal task", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		scans = append(scans, scan)
+		tasks = append(tasks, task)
+		approvals = append(approvals, needsApproval)
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := quota.Reserve(tx, len(scans), quotaAccounts...); err != nil {
+			return err
+		}
+		if err := tx.Create(&scans).Error; err != nil {
+			return err
+		}
+		for i, scan := range scans {
+			reason := "Submitted in batch " + batchID.String()
+			if approvals[i] {
+				reason += "; production target requires approval"
+			}
+			if err := recordScanEvent(tx, c, scan.ID, "", scan.Status, reason); err != nil {
+				return err
+			}
+			if !approvals[i] {
+				continue
+			}
+			if err := tx.Create(&models.ScanApproval{
+				ScanID:      scan.ID,
+				RequestedBy: userUUID,
+				Task:        datatypes.JSON(tasks[i]),
+				CreatedAt:   scan.CreatedAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		respondQuotaExceeded(c, exceeded)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create batch scans in DB", "batch_id", batchID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scans"})
+		return
+	}
+
+	resp := BatchScanResponse{BatchID: batchID, Scans: make([]BatchScan, len(scans))}
+	for i, scan := range scans {
+		h.webhooks.Emit(userUUID, webhooks.EventScanCreated, scanEventData(scan))
+		if approvals[i] {
+			h.notifyApprovers(scan, validTests)
+		} else if err := h.enqueueTask(c.Request.Context(), scan.ID, tasks[i], scan.Priority); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to publish message", "scan_id", scan.ID, "error", err)
+			if failErr := h.failScan(scan.ID, "Failed to queue scan"); failErr != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to fail unqueued scan", "scan_id", scan.ID, "error", failErr)
+			} else {
+				scan.Status = "FAILED"
+			}
+		}
+		resp.Scans[i] = BatchScan{ScanID: scan.ID, TargetURL: scan.TargetURL, Status: scan.Status}
+	}
+
+	slog.InfoContext(c.Request.Context(), "Batch submitted", "batch_id", batchID, "scans", len(scans))
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// HandleGetScanBatch returns the status of every scan of one of the
+// current user's batches, with counts by status. The batch is finished
+// once none of its scans is waiting or running.
+func (h *ScanHandler) HandleGetScanBatch(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	batchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch ID format"})
+		return
+	}
+
+	var scans []models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id", "target_url", "status", "score", "grade").
+		Where("batch_id = ?", batchID).
+		Order("target_url").Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve batch scans", "batch_id", batchID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+	if len(scans) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Batch not found"})
+		return
+	}
+
+	finished := true
+	resp := BatchScanResponse{
+		BatchID:      batchID,
+		Scans:        make([]BatchScan, len(scans)),
+		StatusCounts: map[string]int{},
+		Finished:     &finished,
+	}
+	for i, scan := range scans {
+		resp.Scans[i] = BatchScan{
+			ScanID:    scan.ID,
+			TargetURL: scan.TargetURL,
+			Status:    scan.Status,
+			Score:     scan.Score,
+			Grade:     scan.Grade,
+		}
+		resp.StatusCounts[scan.Status]++
+		if !scanFinished(scan.Status) {
+			finished = false
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ScanBenchmarkResponse compares a scan with the platform benchmark (see
+// package benchmark). Score is omitted while too few sites have been
+// scored; so are the platform figures of tests run against too few sites.
+type ScanBenchmarkResponse struct {
+	ScanID     uuid.UUID           `json:"scan_id"`
+	ComputedAt *time.Time          `json:"computed_at,omitempty"`
+	Score      *ScoreComparison    `json:"score,omitempty"`
+	Tests      []TestBenchmarkItem `json:"tests"`
+}
+
+type ScoreComparison struct {
+	Yours  *float64 `json:"yours"`
+	Median float64  `json:"median"`
+	P25    float64  `json:"p25"`
+	P75    float64  `json:"p75"`
+	Sites  int      `json:"sites"`
+}
+
+type TestBenchmarkItem struct {
+	TestName string `json:"test_name"`
+	Passed   bool   `json:"passed"`
+	// PlatformPassRate is the share of scanned sites that pass the test,
+	// from 0 to 1.
+	PlatformPassRate *float64 `json:"platform_pass_rate"`
+	Sites            int      `json:"sites,omitempty"`
+	Summary          string   `json:"summary,omitempty"`
+}
+
+// HandleScanBenchmark compares one of the current user's completed scans
+// with the platform-wide pass rate of each test.
+func (h *ScanHandler) HandleScanBenchmark(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Preload("Results").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scan", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if scan.Status != "COMPLETED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan has not completed"})
+		return
+	}
+
+	var rates []models.TestBenchmark
+	if err := h.db.Find(&rates).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load test benchmarks", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	byTest := make(map[string]models.TestBenchmark, len(rates))
+	for _, rate := range rates {
+		byTest[rate.TestName] = rate
+	}
+
+	resp := ScanBenchmarkResponse{ScanID: scan.ID, Tests: make([]TestBenchmarkItem, 0)}
+
+	var score models.ScoreBenchmark
+	err = h.db.First(&score, "id = ?", 1).Error
+	switch {
+	case err == nil:
+		resp.ComputedAt = &score.ComputedAt
+		resp.Score = &ScoreComparison{
+			Yours:  scan.Score,
+			Median: score.Median,
+			P25:    score.P25,
+			P75:    score.P75,
+			Sites:  score.Sites,
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		slog.ErrorContext(c.Request.Context(), "Failed to load score benchmark", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A test passes only if all of its results passed, as in the
+	// aggregation.
+	passed := map[string]bool{}
+	for _, r := range scan.Results {
+		name := strings.ToLower(r.TestName)
+		if p, seen := passed[name]; seen {
+			passed[name] = p && r.Passed
+		} else {
+			passed[name] = r.Passed
+		}
+	}
+
+	for name, p := range passed {
+		item := TestBenchmarkItem{TestName: name, Passed: p}
+		if rate, ok := byTest[name]; ok {
+			item.PlatformPassRate = &rate.PassRate
+			item.Sites = rate.Sites
+			item.Summary = benchmarkSummary(name, rate.PassRate, p)
+			if resp.ComputedAt == nil {
+				resp.ComputedAt = &rate.ComputedAt
+			}
+		}
+		resp.Tests = append(resp.Tests, item)
+	}
+	sort.Slice(resp.Tests, func(i, j int) bool { return resp.Tests[i].TestName < resp.Tests[j].TestName })
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// benchmarkSummary phrases a comparison such as "78% of scanned sites pass
+// hsts; yours doesn't".
+func benchmarkSummary(test string, rate float64, passed bool) string {
+	yours := "yours doesn't"
+	if passed {
+		yours = "yours does too"
+		if rate < 0.5 {
+			yours = "yours does"
+		}
+	}
+	return fmt.Sprintf("%d%% of scanned sites pass %s; %s", int(math.Round(rate*100)), test, yours)
+}
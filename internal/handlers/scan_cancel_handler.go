@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScanControlExchange is the fanout exchange workers subscribe to in order
+// to receive control messages (such as cancellations) for in-flight scans.
+const ScanControlExchange = "scan_control"
+
+// ScanControlMessage is published to ScanControlExchange.
+type ScanControlMessage struct {
+	Type        string    `json:"type"`
+	TaskID      string    `json:"task_id"`
+	CancelledAt time.Time `json:"cancelled_at"`
+}
+
+// HandleCancelScan moves a PENDING_APPROVAL, PENDING or RUNNING scan owned by the current user
+// to CANCELLED and notifies workers so they can abort it. Results submitted
+// for the scan afterwards are rejected.
+func (h *ScanHandler) HandleCancelScan(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	h.cancelScan(c, scanUUID, "Cancelled by the owner", func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userUUID)
+	})
+}
+
+// HandleAdminCancelScan cancels any user's scan.
+func (h *ScanHandler) HandleAdminCancelScan(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	h.cancelScan(c, scanUUID, "Cancelled by an admin", func(db *gorm.DB) *gorm.DB { return db })
+}
+
+// errNotCancellable is returned when a finished scan is cancelled.
+var errNotCancellable = errors.New("scan can no longer be cancelled")
+
+// cancelScan cancels the premium scan if it is visible within scope.
+// reason is recorded in the scan's timeline.
+func (h *ScanHandler) cancelScan(c *gin.Context, scanUUID uuid.UUID, reason string, scope func(*gorm.DB) *gorm.DB) {
+	now := time.Now()
+	var scan models.PremiumScan
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status")).
+			First(&scan, "id = ?", scanUUID).Error
+		if err != nil {
+			return err
+		}
+		switch scan.Status {
+		case "PENDING_APPROVAL", "PENDING", "RUNNING":
+		default:
+			return errNotCancellable
+		}
+
+		err = tx.Model(&models.PremiumScan{ID: scanUUID}).Updates(map[string]interface{}{
+			"status":       "CANCELLED",
+			"completed_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordScanEvent(tx, c, scanUUID, scan.Status, "CANCELLED", reason)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	case errors.Is(err, errNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Only scans awaiting approval, pending or running can be cancelled",
+			"status": scan.Status,
+		})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to cancel scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "CANCELLED"})
+
+	body, err := json.Marshal(ScanControlMessage{
+		Type:        "cancel",
+		TaskID:      scanUUID.String(),
+		CancelledAt: now,
+	})
+	if err == nil {
+		err = h.publisher.PublishWithContext(c.Request.Context(),
+			ScanControlExchange,
+			"",
+			false,
+			false,
+			amqp.Publishing{
+				DeliveryMode: amqp.Persistent,
+				ContentType:  "application/json",
+				Body:         body,
+			})
+	}
+	if err != nil {
+		// The scan is already cancelled in the database, so any results the
+		// worker still sends will be rejected; the worker just won't stop early.
+		slog.ErrorContext(c.Request.Context(), "Failed to publish cancellation for scan", "scan_id", scanUUID, "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scanId": scanUUID.String(),
+		"status": "CANCELLED",
+	})
+}
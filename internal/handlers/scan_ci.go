@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/prchecks"
+	"github.com/prawo-i-piesc/backend/internal/vcs"
+	"gorm.io/gorm"
+)
+
+// repositoryFormats describe the repository names of each provider in
+// error messages.
+var repositoryFormats = map[string]string{
+	vcs.ProviderGitHub:    "a GitHub repository like owner/name",
+	vcs.ProviderGitLab:    "a GitLab project path like group/project",
+	vcs.ProviderBitbucket: "a Bitbucket repository like workspace/slug",
+}
+
+// CIContext ties a premium scan to a commit or pull request of a GitHub,
+// GitLab or Bitbucket repository, which the result is reported back to
+// once the scan finishes (see package prchecks). GitLab and Bitbucket are
+// reported to through the integration of the scan's organization.
+type CIContext struct {
+	// Provider is the host of the repository, vcs.ProviderGitHub if empty.
+	Provider    string `json:"provider" binding:"omitempty,oneof=github gitlab bitbucket"`
+	Repository  string `json:"repository" binding:"required,max=200"`
+	SHA         string `json:"sha" binding:"required,len=40,hexadecimal"`
+	PullRequest int    `json:"pull_request" binding:"omitempty,min=1"`
+	// FailOn is the lowest severity of a failed test that fails the gate,
+	// prchecks.DefaultFailOn if empty.
+	FailOn string `json:"fail_on" binding:"omitempty,oneof=critical high medium low info"`
+}
+
+// validCIContext returns why ci can't be reported, or "" if it can.
+func (h *ScanHandler) validCIContext(ci *CIContext) string {
+	if ci.Provider == "" {
+		ci.Provider = vcs.ProviderGitHub
+	}
+	switch {
+	case ci.Provider == vcs.ProviderGitHub && h.cfg.GitHub.AppID == 0:
+		return "GitHub integration is not configured"
+	case ci.Provider != vcs.ProviderGitHub && h.cfg.VCSTokenKey == nil:
+		return "GitLab and Bitbucket integrations are not configured"
+	}
+	if !vcs.ValidRepository(ci.Provider, ci.Repository) {
+		return "ci.repository must be " + repositoryFormats[ci.Provider]
+	}
+	return ""
+}
+
+// ciIntegration returns the integration of the scan's organization that
+// reports to the host of ci, nil for GitHub. Otherwise an error response
+// is written and false is returned.
+func (h *ScanHandler) ciIntegration(c *gin.Context, ci *CIContext, orgID *uuid.UUID) (*uuid.UUID, bool) {
+	if ci.Provider == vcs.ProviderGitHub {
+		return nil, true
+	}
+	if orgID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reporting to " + ci.Provider + " requires the organization_id of an organization with a " + ci.Provider + " integration"})
+		return nil, false
+	}
+	var integration models.VCSIntegration
+	err := h.db.Select("id").First(&integration, "organization_id = ? AND provider = ?", *orgID, ci.Provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The organization has no " + ci.Provider + " integration"})
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to look up VCS integration", "organization_id", *orgID, "provider", ci.Provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &integration.ID, true
+}
+
+// pullRequestCheck is the check reporting the scan back to ci.
+func pullRequestCheck(scanID uuid.UUID, ci *CIContext, integrationID *uuid.UUID, now time.Time) models.PullRequestCheck {
+	failOn := ci.FailOn
+	if failOn == "" {
+		failOn = prchecks.DefaultFailOn
+	}
+	return models.PullRequestCheck{
+		ScanID:        scanID,
+		Provider:      ci.Provider,
+		IntegrationID: integrationID,
+		Repository:    ci.Repository,
+		SHA:           strings.ToLower(ci.SHA),
+		PullRequest:   ci.PullRequest,
+		FailOn:        failOn,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
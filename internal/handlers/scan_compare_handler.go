@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// ComparedScan summarizes one side of a scan comparison.
+type ComparedScan struct {
+	ID          uuid.UUID  `json:"id"`
+	TargetURL   string     `json:"target_url"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Score       *float64   `json:"score"`
+	Grade       string     `json:"grade"`
+}
+
+// ScanComparisonResponse is the difference between two scans of a target,
+// by test. NewlyFailing and Unchanged hold the failed results of the head
+// scan, NewlyPassing the failed results of the base scan. NotRerun names
+// the tests that failed in the base scan but didn't run in the head scan.
+type ScanComparisonResponse struct {
+	Base         ComparedScan        `json:"base"`
+	Head         ComparedScan        `json:"head"`
+	NewlyFailing []models.ScanResult `json:"newly_failing"`
+	NewlyPassing []models.ScanResult `json:"newly_passing"`
+	Unchanged    []models.ScanResult `json:"unchanged"`
+	NotRerun     []string            `json:"not_rerun"`
+}
+
+// HandleCompareScans diffs two completed scans of the same target, given
+// as ?base= and ?head=, so that regressions between runs stand out. A test
+// fails in a scan if any of its results failed; tests that passed in both
+// scans are left out.
+func (h *ScanHandler) HandleCompareScans(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	baseUUID, err := uuid.Parse(c.Query("base"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base must be a scan ID"})
+		return
+	}
+	headUUID, err := uuid.Parse(c.Query("head"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "head must be a scan ID"})
+		return
+	}
+
+	var scans []models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Preload("Results").
+		Where("id IN ?", []uuid.UUID{baseUUID, headUUID}).
+		Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load scans to compare", "base", baseUUID, "head", headUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var base, head *models.PremiumScan
+	for i := range scans {
+		if scans[i].ID == baseUUID {
+			base = &scans[i]
+		}
+		if scans[i].ID == headUUID {
+			head = &scans[i]
+		}
+	}
+	if base == nil || head == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	}
+	for _, scan := range []*models.PremiumScan{base, head} {
+		if scan.Status != "COMPLETED" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Only completed scans can be compared",
+				"scan_id": scan.ID,
+				"status":  scan.Status,
+			})
+			return
+		}
+	}
+	if comparableURL(base.TargetURL) != comparableURL(head.TargetURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scans are of different targets"})
+		return
+	}
+
+	baseFailed, _ := failedByTest(base.Results)
+	headFailed, headRan := failedByTest(head.Results)
+
+	resp := ScanComparisonResponse{
+		Base:         comparedScan(base),
+		Head:         comparedScan(head),
+		NewlyFailing: []models.ScanResult{},
+		NewlyPassing: []models.ScanResult{},
+		Unchanged:    []models.ScanResult{},
+		NotRerun:     []string{},
+	}
+	for test, results := range headFailed {
+		if _, failed := baseFailed[test]; failed {
+			resp.Unchanged = append(resp.Unchanged, results...)
+		} else {
+			resp.NewlyFailing = append(resp.NewlyFailing, results...)
+		}
+	}
+	for test, results := range baseFailed {
+		if _, failed := headFailed[test]; failed {
+			continue
+		}
+		if headRan[test] {
+			resp.NewlyPassing = append(resp.NewlyPassing, results...)
+		} else {
+			resp.NotRerun = append(resp.NotRerun, results[0].TestName)
+		}
+	}
+
+	for _, results := range [][]models.ScanResult{resp.NewlyFailing, resp.NewlyPassing, resp.Unchanged} {
+		sortBySeverity(results)
+	}
+	sort.Strings(resp.NotRerun)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// failedByTest groups the failed results by lower-cased test name and
+// reports which tests ran at all.
+func failedByTest(results []models.ScanResult) (map[string][]models.ScanResult, map[string]bool) {
+	failed := map[string][]models.ScanResult{}
+	ran := map[string]bool{}
+	for _, r := range results {
+		test := strings.ToLower(r.TestName)
+		ran[test] = true
+		if !r.Passed {
+			failed[test] = append(failed[test], r)
+		}
+	}
+	return failed, ran
+}
+
+// sortBySeverity orders results from most to least severe, then by test.
+func sortBySeverity(results []models.ScanResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].SeverityRank != results[j].SeverityRank {
+			return results[i].SeverityRank > results[j].SeverityRank
+		}
+		return results[i].TestName < results[j].TestName
+	})
+}
+
+// comparableURL normalizes a target URL like the benchmark does, so that
+// scans of "https://Example.com/" and "https://example.com" compare.
+func comparableURL(targetURL string) string {
+	return strings.ToLower(strings.TrimRight(targetURL, "/"))
+}
+
+func comparedScan(scan *models.PremiumScan) ComparedScan {
+	return ComparedScan{
+		ID:          scan.ID,
+		TargetURL:   scan.TargetURL,
+		CompletedAt: scan.CompletedAt,
+		Score:       scan.Score,
+		Grade:       scan.Grade,
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errScanNotFinished is returned when a scan that is still in progress is
+// deleted.
+var errScanNotFinished = errors.New("scan has not finished")
+
+// HandleDeleteScan deletes one of the current user's finished scans. Scans
+// and their results are soft-deleted: they stay in the database with
+// deleted_at set, but are left out of every list and lookup.
+func (h *ScanHandler) HandleDeleteScan(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	h.deleteScan(c, scanUUID, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userUUID)
+	})
+}
+
+// HandleAdminDeleteScan deletes any user's finished scan.
+func (h *ScanHandler) HandleAdminDeleteScan(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	h.deleteScan(c, scanUUID, func(db *gorm.DB) *gorm.DB { return db })
+}
+
+// deleteScan soft-deletes the premium scan and its results if the scan is
+// visible within scope. The deletion is recorded in the audit log.
+func (h *ScanHandler) deleteScan(c *gin.Context, scanUUID uuid.UUID, scope func(*gorm.DB) *gorm.DB) {
+	var scan models.PremiumScan
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "user_id", "target_url", "status")).
+			First(&scan, "id = ?", scanUUID).Error
+		if err != nil {
+			return err
+		}
+		if !scanFinished(scan.Status) {
+			return errScanNotFinished
+		}
+
+		if err := tx.Where("scan_id = ?", scanUUID).Delete(&models.ScanResult{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.PremiumScan{ID: scanUUID}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditScanDeleted, "scan", scanUUID.String(), gin.H{
+			"owner_id":   scan.UserID,
+			"target_url": scan.TargetURL,
+		})
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+		return
+	case errors.Is(err, errScanNotFinished):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Cancel the scan before deleting it",
+			"status": scan.Status,
+		})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to delete scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Scan deleted", "scan_id", scanUUID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReevaluatedTest is the outcome of evaluating stored evidence with the
+// current version of a check.
+type ReevaluatedTest struct {
+	Version int
+	Result  EngineTestResult
+}
+
+// Reevaluator runs the current version of the checks that grade captured
+// evidence. It is implemented by scanner.Reevaluator; the handlers can't
+// depend on the scanner, which submits results through them.
+type Reevaluator interface {
+	// Versions returns the current version of every check that can be
+	// evaluated again, by test.
+	Versions() map[string]int
+	// Reevaluate runs the given tests, which must be keys of Versions, on
+	// the evidence.
+	Reevaluate(ev artifacts.Evidence, tests []string) []ReevaluatedTest
+}
+
+// ScanEvaluationHandler re-plays the evidence stored for scans through the
+// current check versions.
+type ScanEvaluationHandler struct {
+	db          *gorm.DB
+	store       storage.Store
+	artifacts   *ArtifactHandler
+	reevaluator Reevaluator
+}
+
+func NewScanEvaluationHandler(db *gorm.DB, store storage.Store, reevaluator Reevaluator) *ScanEvaluationHandler {
+	return &ScanEvaluationHandler{
+		db:          db,
+		store:       store,
+		artifacts:   &ArtifactHandler{db: db, store: store},
+		reevaluator: reevaluator,
+	}
+}
+
+// HandleCreateEvaluation evaluates the evidence of one of the current
+// user's finished scans again with the current check versions and stores
+// the outcome as the scan's next evaluation. Only tests the scan ran and
+// whose check grades captured evidence are evaluated. Scans without stored
+// evidence, or without such tests, are refused with 422.
+func (h *ScanEvaluationHandler) HandleCreateEvaluation(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	scanUUID, ok := h.artifacts.ownedScanID(c)
+	if !ok {
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := h.db.Preload("Results").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load scan to evaluate", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !scanFinished(scan.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan is not finished yet"})
+		return
+	}
+
+	versions := h.reevaluator.Versions()
+	tests := scan.Tests
+	if len(tests) == 0 {
+		for _, r := range scan.Results {
+			tests = append(tests, r.TestName)
+		}
+	}
+	var evaluated []string
+	seen := map[string]bool{}
+	for _, test := range tests {
+		if _, ok := versions[test]; ok && !seen[test] {
+			seen[test] = true
+			evaluated = append(evaluated, test)
+		}
+	}
+	if len(evaluated) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "None of the tests of this scan can be evaluated again"})
+		return
+	}
+
+	ev, found, err := h.loadEvidence(c.Request.Context(), scanUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load evidence of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read evidence"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No evidence was stored for this scan"})
+		return
+	}
+
+	original := map[string]string{}
+	for _, r := range scan.Results {
+		if _, ok := original[r.TestName]; !ok {
+			original[r.TestName] = r.Severity
+		}
+	}
+	evaluation := models.ScanEvaluation{
+		ScanID:    scanUUID,
+		CreatedBy: userUUID,
+	}
+	checkVersions := map[string]int{}
+	for _, t := range h.reevaluator.Reevaluate(ev, evaluated) {
+		checkVersions[t.Result.Name] = t.Version
+		result := models.EvaluatedResult{
+			TestName:         t.Result.Name,
+			CheckVersion:     t.Version,
+			Severity:         t.Result.ThreatLevel,
+			Passed:           t.Result.ThreatLevel == "None" || t.Result.ThreatLevel == "Info",
+			Message:          t.Result.Description,
+			Metadata:         t.Result.Metadata,
+			OriginalSeverity: original[t.Result.Name],
+		}
+		result.Changed = result.OriginalSeverity != "" && result.OriginalSeverity != result.Severity
+		if result.Changed {
+			evaluation.Changed++
+		}
+		evaluation.Results = append(evaluation.Results, result)
+	}
+	evaluation.CheckVersions = datatypes.NewJSONType(checkVersions)
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the scan so that concurrent evaluations get distinct numbers.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.PremiumScan{}, "id = ?", scanUUID).Error; err != nil {
+			return err
+		}
+		var last int
+		if err := tx.Model(&models.ScanEvaluation{}).Where("scan_id = ?", scanUUID).
+			Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		evaluation.ID = id
+		evaluation.Number = last + 1
+		return tx.Create(&evaluation).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save scan evaluation", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save evaluation"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Scan evaluated again", "scan_id", scanUUID, "number", evaluation.Number, "changed", evaluation.Changed)
+	c.JSON(http.StatusCreated, evaluation)
+}
+
+// HandleListEvaluations lists the evaluations of one of the current user's
+// scans, oldest first.
+func (h *ScanEvaluationHandler) HandleListEvaluations(c *gin.Context) {
+	scanUUID, ok := h.artifacts.ownedScanID(c)
+	if !ok {
+		return
+	}
+
+	var list []models.ScanEvaluation
+	if err := h.db.Where("scan_id = ?", scanUUID).Order("number ASC").Find(&list).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list evaluations of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// HandleGetEvaluation returns the evaluation with the given :number of one
+// of the current user's scans.
+func (h *ScanEvaluationHandler) HandleGetEvaluation(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid evaluation number"})
+		return
+	}
+	scanUUID, ok := h.artifacts.ownedScanID(c)
+	if !ok {
+		return
+	}
+
+	var evaluation models.ScanEvaluation
+	if err := h.db.First(&evaluation, "scan_id = ? AND number = ?", scanUUID, number).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Evaluation not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to load scan evaluation", "scan_id", scanUUID, "number", number, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, evaluation)
+}
+
+// loadEvidence reads the latest headers and tls artifacts of a scan.
+// found is false if the scan has neither.
+func (h *ScanEvaluationHandler) loadEvidence(ctx context.Context, scanUUID uuid.UUID) (ev artifacts.Evidence, found bool, err error) {
+	for _, kind := range []string{artifacts.KindHeaders, artifacts.KindTLS} {
+		var artifact models.Artifact
+		err := h.db.WithContext(ctx).Where("scan_id = ? AND kind = ?", scanUUID, kind).Order("created_at DESC").First(&artifact).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return ev, false, err
+		}
+
+		data, err := h.readArtifact(ctx, &artifact)
+		if err != nil {
+			return ev, false, err
+		}
+		switch kind {
+		case artifacts.KindHeaders:
+			err = json.Unmarshal(data, &ev.Responses)
+		case artifacts.KindTLS:
+			err = json.Unmarshal(data, &ev.TLS)
+		}
+		if err != nil {
+			return ev, false, fmt.Errorf("malformed %s artifact %s: %w", kind, artifact.ID, err)
+		}
+		found = true
+	}
+	return ev, found, nil
+}
+
+// readArtifact returns the decoded content of a stored artifact.
+func (h *ScanEvaluationHandler) readArtifact(ctx context.Context, artifact *models.Artifact) ([]byte, error) {
+	file, err := h.store.Get(ctx, artifact.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := artifacts.Decode(file, artifact.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(content)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// sseKeepAlive is how often a comment is sent on idle event streams so
+// proxies don't close the connection.
+const sseKeepAlive = 15 * time.Second
+
+// HandleScanEvents streams the progress of one of the current user's scans
+// as Server-Sent Events. The stream starts with a "status" event holding
+// the current status and result count, followed by "status", "result" and
+// "progress" events as they happen. It ends once the scan has finished.
+func (h *ScanHandler) HandleScanEvents(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	// Subscribe before reading the current state so no update is missed in
+	// between.
+	updates, unsubscribe := h.events.Subscribe(scanUUID)
+	defer unsubscribe()
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id", "status").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var resultCount int64
+	if err := h.db.Model(&models.ScanResult{}).Where("scan_id = ?", scanUUID).Count(&resultCount).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count results of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent(events.TypeStatus, events.Event{
+		Type: events.TypeStatus,
+		At:   time.Now(),
+		Data: gin.H{"status": scan.Status, "results": resultCount},
+	})
+	c.Writer.Flush()
+	if scanFinished(scan.Status) {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case ev, ok := <-updates:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			if ev.Type == events.TypeStatus {
+				if data, ok := ev.Data.(gin.H); ok {
+					status, _ := data["status"].(string)
+					return !scanFinished(status)
+				}
+			}
+			return true
+		}
+	})
+}
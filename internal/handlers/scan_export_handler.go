@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// resultCSVFlushEvery is how many rows are written between flushes of the
+// CSV export, so large scans reach the client as they are read.
+const resultCSVFlushEvery = 500
+
+// resultColumn is a column of the results CSV export.
+type resultColumn struct {
+	Name  string
+	Value func(r *models.ScanResult) string
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatOptionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// ResultColumns lists every column the results CSV export can contain, in
+// the order they are written when no selection is made.
+var ResultColumns = []resultColumn{
+	{"id", func(r *models.ScanResult) string { return strconv.FormatUint(uint64(r.ID), 10) }},
+	{"test_name", func(r *models.ScanResult) string { return r.TestName }},
+	{"category", func(r *models.ScanResult) string { return TestCategories[strings.ToLower(r.TestName)] }},
+	{"severity", func(r *models.ScanResult) string { return r.Severity }},
+	{"passed", func(r *models.ScanResult) string { return strconv.FormatBool(r.Passed) }},
+	{"message", func(r *models.ScanResult) string { return r.Message }},
+	{"triage_status", func(r *models.ScanResult) string { return r.TriageStatus }},
+	{"assignee_id", func(r *models.ScanResult) string { return formatOptionalUUID(r.AssigneeID) }},
+	{"triage_note", func(r *models.ScanResult) string { return r.TriageNote }},
+	{"triaged_at", func(r *models.ScanResult) string { return formatOptionalTime(r.TriagedAt) }},
+	{"first_seen_at", func(r *models.ScanResult) string { return formatOptionalTime(r.FirstSeenAt) }},
+	{"sla_breached_at", func(r *models.ScanResult) string { return formatOptionalTime(r.SLABreachedAt) }},
+	{"artifact_id", func(r *models.ScanResult) string { return formatOptionalUUID(r.ArtifactID) }},
+	{"metadata", func(r *models.ScanResult) string { return string(r.Metadata) }},
+}
+
+// selectResultColumns resolves the comma-separated ?columns= list; all
+// columns are returned when it is empty.
+func selectResultColumns(raw string) ([]resultColumn, error) {
+	names := splitList(raw, strings.ToLower)
+	if len(names) == 0 {
+		return ResultColumns, nil
+	}
+
+	columns := make([]resultColumn, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, col := range ResultColumns {
+			if col.Name == name {
+				columns = append(columns, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// HandleExportResultsCSV streams the results of one of the current user's
+// scans as CSV. ?columns= selects and orders the columns (see
+// ResultColumns). Findings classified as confidential are left out unless
+// ?include_confidential=true is given. Rows are read from the database one
+// at a time, so the export doesn't hold the whole scan in memory; see
+// HandleCreateResultsCSVJob for a queued export.
+func (h *ScanHandler) HandleExportResultsCSV(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	columns, err := selectResultColumns(c.Query("columns"))
+	if err != nil {
+		names := make([]string, len(ResultColumns))
+		for i, col := range ResultColumns {
+			names[i] = col.Name
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "supported_columns": names})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	outbound, err := classification.For(h.db, userUUID, classification.ChannelExport, includeConfidential(c))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load data classification", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve results"})
+		return
+	}
+
+	rows, err := h.db.WithContext(c.Request.Context()).Model(&models.ScanResult{}).Where("scan_id = ?", scan.ID).Order("id").Rows()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to read results of scan", "scan_id", scan.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve results"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="scan_%s_results.csv"`, scan.ID))
+	c.Status(http.StatusOK)
+
+	if err := writeResultsCSV(h.db, rows, c.Writer, columns, outbound, c.Writer.Flush); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to write results CSV of scan", "scan_id", scan.ID, "error", err)
+	}
+}
+
+// writeResultsCSV writes the results read from rows that outbound
+// discloses to out. flush, if not nil, is called every resultCSVFlushEvery
+// rows after the buffered rows were written out.
+func writeResultsCSV(db *gorm.DB, rows *sql.Rows, out io.Writer, columns []resultColumn, outbound classification.Outbound, flush func()) error {
+	w := csv.NewWriter(out)
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = col.Name
+	}
+	_ = w.Write(record)
+
+	written := 0
+	for rows.Next() {
+		var result models.ScanResult
+		if err := db.ScanRows(rows, &result); err != nil {
+			return err
+		}
+		if !outbound.Discloses(result.TestName) {
+			continue
+		}
+		for i, col := range columns {
+			record[i] = csvSafe(col.Value(&result))
+		}
+		_ = w.Write(record)
+
+		if written++; written%resultCSVFlushEvery == 0 && flush != nil {
+			w.Flush()
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// ResultsCSVJobRequest configures a queued results CSV export. Columns
+// takes the same comma-separated list as ?columns= of the streaming export.
+type ResultsCSVJobRequest struct {
+	Columns             string `json:"columns"`
+	IncludeConfidential bool   `json:"include_confidential"`
+}
+
+// HandleCreateResultsCSVJob queues the CSV export of one of the current
+// user's scans, for scans too large to stream in one request. It answers
+// 202 Accepted with the job; once the job completes its status includes a
+// download URL.
+func (h *ReportHandler) HandleCreateResultsCSVJob(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var req ResultsCSVJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindingError(c, err)
+		return
+	}
+	if _, err := selectResultColumns(req.Columns); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	jobID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate job ID"})
+		return
+	}
+
+	job := models.ReportJob{
+		ID:      jobID,
+		UserID:  userUUID,
+		Type:    models.ReportTypeResultsCSV,
+		Format:  models.ReportFormatCSV,
+		ScanID:  &scan.ID,
+		Status:  models.JobStatusPending,
+		Columns: req.Columns,
+
+		IncludeConfidential: req.IncludeConfidential,
+	}
+	if err := h.db.Create(&job).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create report job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report job"})
+		return
+	}
+	if !h.enqueue(c, &job) {
+		return
+	}
+
+	c.Header("Retry-After", scanReportRetryAfter)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":        job,
+		"status_url": jobStatusURL(job.ID),
+	})
+}
+
+// GenerateResultsCSV renders a queued results CSV export; it is the
+// reports.Generator of models.ReportTypeResultsCSV.
+func (h *ReportHandler) GenerateResultsCSV(ctx context.Context, job *models.ReportJob) ([]byte, string, error) {
+	if job.ScanID == nil {
+		return nil, "", fmt.Errorf("results export job has no scan")
+	}
+	columns, err := selectResultColumns(job.Columns)
+	if err != nil {
+		return nil, "", err
+	}
+	outbound, err := classification.For(h.db, job.UserID, classification.ChannelExport, job.IncludeConfidential)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading data classification: %w", err)
+	}
+
+	db := h.db.WithContext(ctx)
+	rows, err := db.Model(&models.ScanResult{}).Where("scan_id = ?", *job.ScanID).Order("id").Rows()
+	if err != nil {
+		return nil, "", fmt.Errorf("reading results: %w", err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	if err := writeResultsCSV(db, rows, &buf, columns, outbound, nil); err != nil {
+		return nil, "", fmt.Errorf("writing results: %w", err)
+	}
+	return buf.Bytes(), "text/csv; charset=utf-8", nil
+}
@@ -1,41 +1,93 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/mail"
 	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/queue"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+	"github.com/prawo-i-piesc/backend/internal/scoring"
+	"github.com/prawo-i-piesc/backend/internal/sla"
+	"github.com/prawo-i-piesc/backend/internal/slack"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ScanHandler struct {
-	amqpChannel *amqp.Channel
-	db          *gorm.DB
+	publisher queue.Transport
+	db        *gorm.DB
+	webhooks  *webhooks.Dispatcher
+	events    *events.Broker
+	mailer    mail.Mailer
+	renderer  *mail.Renderer
+	cfg       *config.Config
+	// slackClient replies to the interactions of the Slack app; it is nil
+	// when the app isn't configured.
+	slackClient *slack.Client
 }
 
-func NewScanHandler(ch *amqp.Channel, db *gorm.DB) *ScanHandler {
+func NewScanHandler(publisher queue.Transport, db *gorm.DB, dispatcher *webhooks.Dispatcher, broker *events.Broker, mailer mail.Mailer, renderer *mail.Renderer, slackClient *slack.Client, cfg *config.Config) *ScanHandler {
 	return &ScanHandler{
-		amqpChannel: ch,
+		publisher:   publisher,
 		db:          db,
+		webhooks:    dispatcher,
+		events:      broker,
+		mailer:      mailer,
+		renderer:    renderer,
+		cfg:         cfg,
+		slackClient: slackClient,
 	}
 }
 
+// CreateScanRequest submits a free scan. With ReuseRecent a scan of the
+// same target completed within cfg.ScanReuseWindow is returned instead of
+// starting a new one.
 type CreateScanRequest struct {
-	TargetURL string `json:"target_url" binding:"required"`
+	TargetURL   string `json:"target_url" binding:"required"`
+	ReuseRecent bool   `json:"reuse_recent"`
+	// Priority is low, normal (the default) or high.
+	Priority string `json:"priority"`
+	// Profile is quick, full (the default) or custom; custom scans run
+	// Tests, a list of test IDs and category names.
+	Profile string   `json:"profile"`
+	Tests   []string `json:"tests"`
 }
 
+// PremiumScanRequest submits a premium scan. ReuseRecent works as for
+// free scans, limited to the user's own scans that ran the requested tests.
+// Either Tests or a Profile is required.
 type PremiumScanRequest struct {
 	TargetURL        string   `json:"target_url" binding:"required"`
-	Tests            []string `json:"tests" binding:"required,min=1"`
+	Tests            []string `json:"tests"`
 	AuthorizedTester bool     `json:"authorized_tester"`
 	AntiBotDetection bool     `json:"anti_bot_detection"`
+	Screenshot       bool     `json:"screenshot"`
+	ReuseRecent      bool     `json:"reuse_recent"`
+	Tags             []string `json:"tags"`
+	Priority         string   `json:"priority"`
+	Profile          string   `json:"profile"`
+	// OrganizationID shares the scan with an organization the user is a
+	// member of.
+	OrganizationID *uuid.UUID `json:"organization_id"`
+	// CI reports the result to a commit or pull request of a GitHub,
+	// GitLab or Bitbucket repository. Scans with CI are never reused.
+	CI *CIContext `json:"ci"`
 }
 
 type CommandParameter struct {
@@ -43,9 +95,13 @@ type CommandParameter struct {
 	Arguments []string `json:"Arguments"`
 }
 
+// ScanTaskPayload is the task message sent to workers. UploadToken
+// authorizes submitting results for this scan only (see
+// workerauth.UploadTokens); it is added when the task is queued.
 type ScanTaskPayload struct {
-	Target     string             `json:"Target"`
-	Parameters []CommandParameter `json:"Parameters"`
+	Target      string             `json:"Target"`
+	Parameters  []CommandParameter `json:"Parameters"`
+	UploadToken string             `json:"UploadToken,omitempty"`
 }
 
 type EngineTestResult struct {
@@ -75,6 +131,9 @@ type AsyncResultRequest struct {
 	EndFlag     bool             `json:"endFlag"`
 	ResultType  ResultType       `json:"resultType"`
 	ProcessInfo RequestInfo      `json:"message"`
+	// ArtifactID optionally references an artifact uploaded for this
+	// scan (e.g. a screenshot) as evidence for the result.
+	ArtifactID string `json:"artifactId"`
 }
 
 type ResultSubmissionRequest struct {
@@ -94,11 +153,16 @@ type ScanResultItem struct {
 	Message     string `json:"message"`
 	Reference   string `json:"reference"`
 	Remediation string `json:"remediation"`
+	ArtifactID  string `json:"artifact_id" binding:"omitempty,uuid"`
 }
 
+// ScanTaskMessage describes a scan task. Profile and Tests tell the
+// worker which checks to run; messages without them ask for all checks.
 type ScanTaskMessage struct {
-	ID        string `json:"id"`
-	TargetURL string `json:"target_url"`
+	ID        string   `json:"id"`
+	TargetURL string   `json:"target_url"`
+	Profile   string   `json:"profile,omitempty"`
+	Tests     []string `json:"tests,omitempty"`
 }
 
 type UserDashboardScan struct {
@@ -117,7 +181,7 @@ type TestCategoryGroup struct {
 var CategorizedTests = []TestCategoryGroup{
 	{
 		CategoryName: "SSL/TLS & Encryption",
-		Tests:        []string{"https", "hsts", "ssl-cert"},
+		Tests:        []string{"https", "hsts", "ssl-cert", "mixed-content", "redirect-chain"},
 	},
 	{
 		CategoryName: "Security Headers",
@@ -145,6 +209,17 @@ var AvailableTestsList = func() []string {
 	return list
 }()
 
+// TestCategories maps lower-cased test names to their category name.
+var TestCategories = func() map[string]string {
+	m := make(map[string]string)
+	for _, group := range CategorizedTests {
+		for _, test := range group.Tests {
+			m[test] = group.CategoryName
+		}
+	}
+	return m
+}()
+
 var AllowedPremiumTests = func() map[string]bool {
 	m := make(map[string]bool)
 	for _, test := range AvailableTestsList {
@@ -161,13 +236,52 @@ func (h *ScanHandler) HandleHealthCheck(c *gin.Context) {
 func (h *ScanHandler) HandleScanSubmission(c *gin.Context) {
 	var req CreateScanRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	priority, err := parseScanPriority(req.Priority, models.ScanPriorityNormal)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Free scans can't prove ownership of their target.
+	defaultProfile := models.ScanProfileFull
+	if h.cfg.RequireVerifiedIntrusiveScans {
+		defaultProfile = models.ScanProfileQuick
+	}
+	profile, tests, err := resolveScanProfile(req.Profile, req.Tests, defaultProfile)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(tests) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid tests provided"})
+		return
+	}
+	if h.cfg.RequireVerifiedIntrusiveScans && intrusiveScan(tests) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Free scans are limited to the %q profile", models.ScanProfileQuick)})
+		return
+	}
+
+	if req.ReuseRecent {
+		// A full scan stands in for any profile; custom scans aren't
+		// compared test by test like premium scans are.
+		reusable := []string{models.ScanProfileFull, profile}
+		scanID, found, err := h.recentScan(&models.Scan{}, h.db.Where("target_url = ? AND profile IN ?", req.TargetURL, reusable))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to look up recent scan of target", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if found {
+			respondReusedScan(c, scanID)
+			return
+		}
+	}
 
 	newScanID, err := uuid.NewV7()
 	if err != nil {
-		log.Printf("Failed to generate UUIDv7: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate scan ID"})
 		return
 	}
@@ -177,21 +291,29 @@ func (h *ScanHandler) HandleScanSubmission(c *gin.Context) {
 		TargetURL: req.TargetURL,
 		Status:    "PENDING",
 		CreatedAt: time.Now(),
+		Profile:   profile,
+		Tests:     datatypes.NewJSONSlice(tests),
 	}
 
-	result := h.db.Create(&newScan)
-	if result.Error != nil {
-		log.Printf("Failed to create scan in DB: %v", result.Error)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newScan).Error; err != nil {
+			return err
+		}
+		return recordScanEvent(tx, c, newScan.ID, "", newScan.Status, "Submitted")
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create scan in DB", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan"})
 		return
 	}
 
 	task := ScanTaskPayload{
-		Target: newScan.TargetURL,
+		Target:      newScan.TargetURL,
+		UploadToken: h.cfg.UploadTokens().Issue(newScan.ID),
 		Parameters: []CommandParameter{
 			{
 				Name:      "--tests",
-				Arguments: AvailableTestsList,
+				Arguments: tests,
 			},
 			{
 				Name: "--taskId",
@@ -204,12 +326,12 @@ func (h *ScanHandler) HandleScanSubmission(c *gin.Context) {
 
 	jsonBytes, err := json.Marshal(task)
 	if err != nil {
-		log.Printf("Failed to marshal task: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to marshal task", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 		return
 	}
 
-	err = h.amqpChannel.PublishWithContext(c.Request.Context(),
+	err = h.publisher.PublishWithContext(c.Request.Context(),
 		"main_exchange",
 		"scan_key",
 		false,
@@ -217,11 +339,12 @@ func (h *ScanHandler) HandleScanSubmission(c *gin.Context) {
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
 			ContentType:  "application/json",
+			Priority:     scanPriorities[priority],
 			Body:         jsonBytes,
 		})
 
 	if err != nil {
-		log.Printf("Failed to publish message: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to publish message", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue scan"})
 		return
 	}
@@ -232,35 +355,166 @@ func (h *ScanHandler) HandleScanSubmission(c *gin.Context) {
 	})
 }
 
-func (h *ScanHandler) HandleResultSubmission(c *gin.Context) {
-	var req AsyncResultRequest
+// findScan looks up a scan in both tables and reports whether it is a
+// premium scan together with its current status. It returns
+// gorm.ErrRecordNotFound if neither table contains it.
+func findScan(db *gorm.DB, scanUUID uuid.UUID) (bool, string, error) {
+	var scan models.Scan
+	err := db.Select("id", "status").First(&scan, "id = ?", scanUUID).Error
+	if err == nil {
+		return false, scan.Status, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, "", err
+	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Binding error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var premiumScan models.PremiumScan
+	if err := db.Select("id", "status").First(&premiumScan, "id = ?", scanUUID).Error; err != nil {
+		return false, "", err
+	}
+	return true, premiumScan.Status, nil
+}
+
+// scanFinished reports whether a scan status is final.
+func scanFinished(status string) bool {
+	return status == "COMPLETED" || status == "FAILED" || status == "CANCELLED" || status == "REJECTED"
+}
+
+// emitScanEvent notifies the owner's webhooks about a premium scan. Free
+// scans have no owner and emit no events.
+func (h *ScanHandler) emitScanEvent(scanUUID uuid.UUID, event string) {
+	var scan models.PremiumScan
+	if err := h.db.First(&scan, "id = ?", scanUUID).Error; err != nil {
+		slog.Error("Failed to load scan for webhooks", "scan_id", scanUUID, "event", event, "error", err)
 		return
 	}
+	h.webhooks.Emit(scan.UserID, event, scanEventData(scan))
+}
+
+// publishResult streams a saved result to clients following the scan. The
+// first result moves a pending scan to RUNNING.
+func (h *ScanHandler) publishResult(scanUUID uuid.UUID, previousStatus string, r models.ScanResult) {
+	if previousStatus == "PENDING" {
+		h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "RUNNING"})
+	}
+	h.events.Publish(scanUUID, events.TypeResult, gin.H{
+		"id":        r.ID,
+		"test_name": r.TestName,
+		"severity":  r.Severity,
+		"passed":    r.Passed,
+	})
+}
+
+// scanEventData is the data of scan webhook events.
+func scanEventData(scan models.PremiumScan) gin.H {
+	return gin.H{
+		"scan_id":      scan.ID,
+		"target_url":   scan.TargetURL,
+		"status":       scan.Status,
+		"score":        scan.Score,
+		"grade":        scan.Grade,
+		"created_at":   scan.CreatedAt,
+		"started_at":   scan.StartedAt,
+		"completed_at": scan.CompletedAt,
+	}
+}
+
+// scanModel returns the model of a free or premium scan for updates.
+func scanModel(scanUUID uuid.UUID, isPremium bool) interface{} {
+	if isPremium {
+		return &models.PremiumScan{ID: scanUUID}
+	}
+	return &models.Scan{ID: scanUUID}
+}
+
+// markScanRunning moves a PENDING scan to RUNNING when its first result
+// arrives.
+func markScanRunning(tx *gorm.DB, c *gin.Context, scanUUID uuid.UUID, isPremium bool) error {
+	now := time.Now()
+	result := tx.Model(scanModel(scanUUID, isPremium)).
+		Where("status = ?", "PENDING").
+		Updates(map[string]interface{}{
+			"status":     "RUNNING",
+			"started_at": &now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return recordScanEvent(tx, c, scanUUID, "PENDING", "RUNNING", "First result received")
+}
+
+// lockScan locks a scan until the end of tx and returns its current
+// status, or errScanCancelled. Results and the end of a scan are saved
+// under this lock, so the messages of one scan are serialized however many
+// consumers save them.
+func lockScan(tx *gorm.DB, scanUUID uuid.UUID, isPremium bool) (string, error) {
+	var status string
+	err := tx.Model(scanModel(scanUUID, isPremium)).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("status").Where("id = ?", scanUUID).Scan(&status).Error
+	if err == nil && status == "CANCELLED" {
+		err = errScanCancelled
+	}
+	return status, err
+}
+
+// scoreScan tracks the findings and computes the score of a completed
+// scan. It runs again when a result arrives after the end of the scan.
+func scoreScan(tx *gorm.DB, scanUUID uuid.UUID, isPremium bool) error {
+	if isPremium {
+		if err := sla.TrackFindings(tx, scanUUID); err != nil {
+			return err
+		}
+	}
+	return scoring.ScoreScan(tx, scanUUID, isPremium, TestCategories)
+}
 
-	log.Printf("Raw request data received: %+v", req)
+// finishScan applies updates, which set the final status, to a scan that
+// is still pending or running. from is the status the scan had before; a
+// scan that has already ended, e.g. failed after going stale or been
+// rejected, can't be ended again and errScanFinished is returned.
+func finishScan(tx *gorm.DB, c *gin.Context, scanUUID uuid.UUID, isPremium bool, from string, updates map[string]interface{}) error {
+	if scanFinished(from) {
+		return errScanFinished
+	}
+	result := tx.Model(scanModel(scanUUID, isPremium)).
+		Where("status IN ?", []string{"PENDING", "RUNNING"}).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errScanFinished
+	}
+	to, _ := updates["status"].(string)
+	return recordScanEvent(tx, c, scanUUID, from, to, "Worker finished the scan")
+}
+
+// ingestAsyncResult saves a single engine result (AsyncResultRequest) and
+// returns the response body of the submission. See ingestResults for
+// tokenScan and c.
+func (h *ScanHandler) ingestAsyncResult(ctx context.Context, c *gin.Context, tokenScan string, req AsyncResultRequest) (gin.H, error) {
+	slog.DebugContext(ctx, "Result received", "request", req)
 
 	scanUUID, err := uuid.Parse(req.TestID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format (from testId field)"})
-		return
+		return nil, rejectResult(http.StatusBadRequest, "Invalid Scan ID format (from testId field)")
 	}
+	if err := checkTokenScan(tokenScan, scanUUID); err != nil {
+		return nil, err
+	}
+	logging.SetScanID(ctx, scanUUID.String())
 
-	var isPremium bool
-	var exists int64
-
-	h.db.Model(&models.Scan{}).Where("id = ?", scanUUID).Count(&exists)
-	if exists == 0 {
-		h.db.Model(&models.PremiumScan{}).Where("id = ?", scanUUID).Count(&exists)
-		if exists > 0 {
-			isPremium = true
-		} else {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found in database"})
-			return
+	isPremium, status, err := findScan(h.db, scanUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, rejectResult(http.StatusNotFound, "Scan not found in database")
 		}
+		slog.ErrorContext(ctx, "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		return nil, rejectResult(http.StatusInternalServerError, "Database error")
+	}
+	if status == "CANCELLED" {
+		return nil, rejectResult(http.StatusConflict, "Scan has been cancelled")
 	}
 
 	if !req.EndFlag && req.ResultType == Message {
@@ -276,74 +530,71 @@ func (h *ScanHandler) HandleResultSubmission(c *gin.Context) {
 			Passed:   true,
 			Message:  fmt.Sprintf("%s (Code: %d) - %s", req.ProcessInfo.Message, req.ProcessInfo.Code, "Perhaps you can use antibot detection to prevent this from happening."),
 			Metadata: datatypes.JSON([]byte(`{}`)),
+
+			SeverityRank: models.SeverityRank("Info"),
 		}
 
 		err = h.db.Transaction(func(tx *gorm.DB) error {
+			if status, err = lockScan(tx, scanUUID, isPremium); err != nil {
+				return err
+			}
 			if err := tx.Create(&newResult).Error; err != nil {
 				return err
 			}
-
-			now := time.Now()
-			if isPremium {
-				if err := tx.Model(&models.PremiumScan{ID: scanUUID}).
-					Where("status = ?", "PENDING").
-					Updates(map[string]interface{}{
-						"status":     "RUNNING",
-						"started_at": &now,
-					}).Error; err != nil {
-					return err
-				}
-			} else {
-				if err := tx.Model(&models.Scan{ID: scanUUID}).
-					Where("status = ?", "PENDING").
-					Updates(map[string]interface{}{
-						"status":     "RUNNING",
-						"started_at": &now,
-					}).Error; err != nil {
-					return err
-				}
+			if status == "COMPLETED" {
+				return scoreScan(tx, scanUUID, isPremium)
 			}
-			return nil
+			return markScanRunning(tx, c, scanUUID, isPremium)
 		})
 
+		if errors.Is(err, errScanCancelled) {
+			return nil, rejectResult(http.StatusConflict, "Scan has been cancelled")
+		}
 		if err != nil {
-			log.Printf("Transaction failed for crash result: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save crash result"})
-			return
+			slog.ErrorContext(ctx, "Transaction failed for crash result", "error", err)
+			return nil, rejectResult(http.StatusInternalServerError, "Failed to save crash result")
 		}
 
-		log.Printf("Test crashed/blocked for scan %s: %s", scanUUID, req.ProcessInfo.Message)
-		c.JSON(http.StatusOK, gin.H{"message": "Crash result logged successfully"})
-		return
+		slog.WarnContext(ctx, "Test crashed or was blocked", "scan_id", scanUUID, "message", req.ProcessInfo.Message)
+		h.publishResult(scanUUID, status, newResult)
+		return gin.H{"message": "Crash result logged successfully"}, nil
 	}
 
 	if req.Result.Name == "" {
 		now := time.Now()
-		var updateErr error
-
-		if isPremium {
-			updateErr = h.db.Model(&models.PremiumScan{ID: scanUUID}).
-				Updates(map[string]interface{}{
-					"status":       "COMPLETED",
-					"completed_at": &now,
-				}).Error
-		} else {
-			updateErr = h.db.Model(&models.Scan{ID: scanUUID}).
-				Updates(map[string]interface{}{
-					"status":       "COMPLETED",
-					"completed_at": &now,
-				}).Error
-		}
 
+		updateErr := h.db.Transaction(func(tx *gorm.DB) error {
+			if status, err = lockScan(tx, scanUUID, isPremium); err != nil {
+				return err
+			}
+			if err := finishScan(tx, c, scanUUID, isPremium, status, map[string]interface{}{
+				"status":       "COMPLETED",
+				"completed_at": &now,
+			}); err != nil {
+				return err
+			}
+			return scoreScan(tx, scanUUID, isPremium)
+		})
+
+		if errors.Is(updateErr, errScanCancelled) {
+			return nil, rejectResult(http.StatusConflict, "Scan has been cancelled")
+		}
+		if errors.Is(updateErr, errScanFinished) {
+			return nil, rejectResult(http.StatusConflict, "Scan has already finished")
+		}
 		if updateErr != nil {
-			log.Printf("Failed to complete scan %s: %v", scanUUID, updateErr)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan status"})
-			return
+			slog.ErrorContext(ctx, "Failed to complete scan", "scan_id", scanUUID, "error", updateErr)
+			return nil, rejectResult(http.StatusInternalServerError, "Failed to update scan status")
 		}
 
-		log.Printf("Scan %s completed successfully (Premium: %v)", scanUUID, isPremium)
-		c.JSON(http.StatusOK, gin.H{"message": "Scan completed"})
-		return
+		slog.InfoContext(ctx, "Scan completed", "scan_id", scanUUID, "premium", isPremium)
+		if !scanFinished(status) {
+			h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "COMPLETED"})
+			if isPremium {
+				h.emitScanEvent(scanUUID, webhooks.EventScanCompleted)
+			}
+		}
+		return gin.H{"message": "Scan completed"}, nil
 	}
 
 	metaJSON, _ := json.Marshal(req.Result.Metadata)
@@ -356,44 +607,48 @@ func (h *ScanHandler) HandleResultSubmission(c *gin.Context) {
 		Passed:   passed,
 		Message:  req.Result.Description,
 		Metadata: datatypes.JSON(metaJSON),
+
+		SeverityRank: models.SeverityRank(req.Result.ThreatLevel),
+	}
+	if req.ArtifactID != "" {
+		artifactUUID, err := uuid.Parse(req.ArtifactID)
+		if err != nil {
+			return nil, rejectResult(http.StatusBadRequest, "Invalid artifactId format")
+		}
+		newResult.ArtifactID = &artifactUUID
 	}
 
 	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if status, err = lockScan(tx, scanUUID, isPremium); err != nil {
+			return err
+		}
+		if err := checkArtifactRefs(tx, scanUUID, []models.ScanResult{newResult}); err != nil {
+			return err
+		}
 		if err := tx.Create(&newResult).Error; err != nil {
 			return err
 		}
-
-		now := time.Now()
-		if isPremium {
-			if err := tx.Model(&models.PremiumScan{ID: scanUUID}).
-				Where("status = ?", "PENDING").
-				Updates(map[string]interface{}{
-					"status":     "RUNNING",
-					"started_at": &now,
-				}).Error; err != nil {
-				return err
-			}
-		} else {
-			if err := tx.Model(&models.Scan{ID: scanUUID}).
-				Where("status = ?", "PENDING").
-				Updates(map[string]interface{}{
-					"status":     "RUNNING",
-					"started_at": &now,
-				}).Error; err != nil {
-				return err
-			}
+		// A result retried past the end of its scan rescores it.
+		if status == "COMPLETED" {
+			slog.InfoContext(ctx, "Late result rescores scan", "scan_id", scanUUID, "test_name", newResult.TestName)
+			return scoreScan(tx, scanUUID, isPremium)
 		}
-
-		return nil
+		return markScanRunning(tx, c, scanUUID, isPremium)
 	})
 
+	if errors.Is(err, errScanCancelled) {
+		return nil, rejectResult(http.StatusConflict, "Scan has been cancelled")
+	}
+	if errors.Is(err, errUnknownArtifact) {
+		return nil, badResult(err)
+	}
 	if err != nil {
-		log.Printf("Transaction failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save result"})
-		return
+		slog.ErrorContext(ctx, "Transaction failed", "error", err)
+		return nil, rejectResult(http.StatusInternalServerError, "Failed to save result")
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Result received"})
+	h.publishResult(scanUUID, status, newResult)
+	return gin.H{"message": "Result received"}, nil
 }
 
 func (h *ScanHandler) HandleGetScan(c *gin.Context) {
@@ -404,13 +659,18 @@ func (h *ScanHandler) HandleGetScan(c *gin.Context) {
 		return
 	}
 
+	query, ok := preloadResults(c, h.db)
+	if !ok {
+		return
+	}
+
 	var scan models.Scan
-	result := h.db.Preload("Results").First(&scan, "id = ?", scanUUID)
+	result := query.First(&scan, "id = ?", scanUUID)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
 		} else {
-			log.Printf("Failed to retrieve scan: %v", result.Error)
+			slog.ErrorContext(c.Request.Context(), "Failed to retrieve scan", "error", result.Error)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan"})
 		}
 		return
@@ -419,27 +679,80 @@ func (h *ScanHandler) HandleGetScan(c *gin.Context) {
 	c.JSON(http.StatusOK, scan)
 }
 
+// premiumTask builds the worker task of a premium scan.
+func premiumTask(scan models.PremiumScan, tests []string, antiBotDetection bool) ScanTaskPayload {
+	task := ScanTaskPayload{
+		Target: scan.TargetURL,
+		Parameters: []CommandParameter{
+			{
+				Name:      "--tests",
+				Arguments: tests,
+			},
+			{
+				Name: "--taskId",
+				Arguments: []string{
+					scan.ID.String(),
+				},
+			},
+		},
+	}
+
+	if antiBotDetection {
+		task.Parameters = append(task.Parameters, CommandParameter{
+			Name:      "--antiBotDetection",
+			Arguments: []string{},
+		})
+	}
+
+	if scan.Screenshot {
+		task.Parameters = append(task.Parameters, CommandParameter{
+			Name:      "--screenshot",
+			Arguments: []string{},
+		})
+	}
+	return task
+}
+
 func (h *ScanHandler) HandlePremiumScanSubmission(c *gin.Context) {
 	var req PremiumScanRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(c, err)
 		return
 	}
 
-	var validTests []string
-	for _, t := range req.Tests {
-		if AllowedPremiumTests[t] {
-			validTests = append(validTests, t)
-		}
+	if len(req.Tests) == 0 && req.Profile == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either tests or a profile is required"})
+		return
+	}
+	profile, validTests, err := resolveScanProfile(req.Profile, req.Tests, models.ScanProfileCustom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	if len(validTests) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid tests provided"})
 		return
 	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	priority, err := parseScanPriority(req.Priority, models.ScanPriorityNormal)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.CI != nil {
+		if msg := h.validCIContext(req.CI); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
 
 	newScanID, err := uuid.NewV7()
 	if err != nil {
-		log.Printf("Failed to generate UUIDv7: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate scan ID"})
 		return
 	}
@@ -461,69 +774,139 @@ func (h *ScanHandler) HandlePremiumScanSubmission(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
 		return
 	}
-
-	newScan := models.PremiumScan{
-		ID:        newScanID,
-		UserID:    userUUID,
-		TargetURL: req.TargetURL,
-		Status:    "PENDING",
-		CreatedAt: time.Now(),
+	if !checkScanOrganization(c, h.db, req.OrganizationID, userUUID) {
+		return
+	}
+	var ciIntegrationID *uuid.UUID
+	if req.CI != nil {
+		if ciIntegrationID, ok = h.ciIntegration(c, req.CI, req.OrganizationID); !ok {
+			return
+		}
+	}
+	quotaAccounts, apiKeyID, err := h.quotaAccounts(c, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load API key quota", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	result := h.db.Create(&newScan)
-	if result.Error != nil {
-		log.Printf("Failed to create scan in DB: %v", result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan"})
+	owningTarget, err := targets.FindOwning(h.db, userUUID, req.TargetURL)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.ErrorContext(c.Request.Context(), "Failed to look up the verified target", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	if owningTarget == nil {
+		if msg := h.unverifiedTargetError(validTests); msg != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": msg})
+			return
+		}
+	}
 
-	task := ScanTaskPayload{
-		Target: newScan.TargetURL,
-		Parameters: []CommandParameter{
-			{
-				Name:      "--tests",
-				Arguments: validTests,
-			},
-			{
-				Name: "--taskId",
-				Arguments: []string{
-					newScan.ID.String(),
-				},
-			},
-		},
+	if req.ReuseRecent && req.CI == nil {
+		scanID, found, err := h.recentPremiumScan(userUUID, req.TargetURL, validTests, req.Screenshot)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to look up recent scan of target", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if found {
+			respondReusedScan(c, scanID)
+			return
+		}
 	}
 
-	if req.AntiBotDetection {
-		task.Parameters = append(task.Parameters, CommandParameter{
-			Name:      "--antiBotDetection",
-			Arguments: []string{},
-		})
+	needsApproval, err := h.needsApproval(userUUID, req.TargetURL)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check whether scan needs approval", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	jsonBytes, err := json.Marshal(task)
+	newScan := models.PremiumScan{
+		ID:         newScanID,
+		UserID:     userUUID,
+		TargetURL:  req.TargetURL,
+		Status:     "PENDING",
+		Screenshot: req.Screenshot,
+		CreatedAt:  time.Now(),
+		Priority:   priority,
+		Profile:    profile,
+		Tests:      datatypes.NewJSONSlice(validTests),
+
+		OrganizationID: req.OrganizationID,
+		APIKeyID:       apiKeyID,
+
+		AntiBotDetection: req.AntiBotDetection,
+	}
+	if owningTarget != nil {
+		newScan.TargetID = &owningTarget.ID
+	}
+	if needsApproval {
+		newScan.Status = "PENDING_APPROVAL"
+	}
+	if len(tags) > 0 {
+		newScan.Tags = scanTags(newScan.ID, tags)
+	}
+
+	jsonBytes, err := json.Marshal(premiumTask(newScan, validTests, req.AntiBotDetection))
 	if err != nil {
-		log.Printf("Failed to marshal task: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to marshal task", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 		return
 	}
 
-	err = h.amqpChannel.PublishWithContext(c.Request.Context(),
-		"",
-		"scan_queue",
-		false,
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/json",
-			Body:         jsonBytes,
-		})
-
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := quota.Reserve(tx, 1, quotaAccounts...); err != nil {
+			return err
+		}
+		if err := tx.Create(&newScan).Error; err != nil {
+			return err
+		}
+		reason := "Submitted"
+		if needsApproval {
+			reason = "Submitted; production target requires approval"
+		}
+		if err := recordScanEvent(tx, c, newScan.ID, "", newScan.Status, reason); err != nil {
+			return err
+		}
+		if req.CI != nil {
+			check := pullRequestCheck(newScan.ID, req.CI, ciIntegrationID, newScan.CreatedAt)
+			if err := tx.Create(&check).Error; err != nil {
+				return err
+			}
+		}
+		if !needsApproval {
+			return nil
+		}
+		return tx.Create(&models.ScanApproval{
+			ScanID:      newScan.ID,
+			RequestedBy: userUUID,
+			Task:        datatypes.JSON(jsonBytes),
+			CreatedAt:   newScan.CreatedAt,
+		}).Error
+	})
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		respondQuotaExceeded(c, exceeded)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to publish message: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to create scan in DB", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scan"})
+		return
+	}
+
+	if needsApproval {
+		h.notifyApprovers(newScan, validTests)
+	} else if err := h.enqueueTask(c.Request.Context(), newScan.ID, jsonBytes, newScan.Priority); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to publish message", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue scan"})
 		return
 	}
 
+	h.webhooks.Emit(userUUID, webhooks.EventScanCreated, scanEventData(newScan))
+
 	c.JSON(http.StatusAccepted, gin.H{
 		"scanId": newScan.ID.String(),
 		"status": newScan.Status,
@@ -556,21 +939,46 @@ func (h *ScanHandler) HandlePremiumGetScan(c *gin.Context) {
 		return
 	}
 
+	include, err := includesResults(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := h.db
+	if include {
+		if query, ok = preloadResults(c, h.db); !ok {
+			return
+		}
+	}
+
 	var scan models.PremiumScan
 
-	result := h.db.Preload("Results").First(&scan, "id = ? AND user_id = ?", scanUUID, userUUID)
+	result := preloadTags(scanAccess(query, userUUID)).First(&scan, "id = ?", scanUUID)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
 		} else {
-			log.Printf("Failed to retrieve scan: %v", result.Error)
+			slog.ErrorContext(c.Request.Context(), "Failed to retrieve scan", "error", result.Error)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, scan)
+	counts, err := countResults(h.db, scanUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count results of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan"})
+		return
+	}
+	response := ScanDetailResponse{PremiumScan: scan, ResultCounts: counts}
+	if include {
+		if scan.Results == nil {
+			scan.Results = []models.ScanResult{}
+		}
+		response.Results = &scan.Results
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *ScanHandler) HandleUserScans(c *gin.Context) {
@@ -597,7 +1005,7 @@ func (h *ScanHandler) HandleUserScans(c *gin.Context) {
 	result := h.db.Preload("Results").Where("user_id = ?", userUUID).Find(&scans)
 
 	if result.Error != nil {
-		log.Printf("Failed to retrieve user scans: %v", result.Error)
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve user scans", "error", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
 		return
 	}
@@ -657,7 +1065,7 @@ func (h *ScanHandler) HandleUserDashboardWidgets(c *gin.Context) {
 		Find(&recentScans)
 
 	if result.Error != nil {
-		log.Printf("Błąd pobierania najnowszych skanów usera: %v", result.Error)
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve latest user scans", "error", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Błąd pobierania najnowszych skanów"})
 		return
 	}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// staleScanCheckInterval is how often running scans are checked for
+// missing heartbeats.
+const staleScanCheckInterval = time.Minute
+
+// workerScan parses the :id parameter of a worker request and looks the
+// scan up. On failure an error response is written and ok is false.
+func (h *ScanHandler) workerScan(c *gin.Context) (scanUUID uuid.UUID, isPremium bool, status string, ok bool) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return uuid.Nil, false, "", false
+	}
+	if !uploadAllowed(c, scanUUID) {
+		return uuid.Nil, false, "", false
+	}
+	logging.SetScanID(c.Request.Context(), scanUUID.String())
+
+	isPremium, status, err = findScan(h.db, scanUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found in database"})
+			return uuid.Nil, false, "", false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return uuid.Nil, false, "", false
+	}
+	if status == "CANCELLED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan has been cancelled"})
+		return uuid.Nil, false, "", false
+	}
+	return scanUUID, isPremium, status, true
+}
+
+// HandleStartScan is called by a worker when it begins a scan: a PENDING
+// scan moves to RUNNING and its start time is recorded. Starting a scan
+// that is already running only counts as a heartbeat. Workers should stop
+// on 409, which is returned once the scan was cancelled or has finished.
+func (h *ScanHandler) HandleStartScan(c *gin.Context) {
+	scanUUID, isPremium, status, ok := h.workerScan(c)
+	if !ok {
+		return
+	}
+	if status != "PENDING" && status != "RUNNING" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan can't be started", "status": status})
+		return
+	}
+
+	var started bool
+	if status == "PENDING" {
+		now := time.Now()
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(scanModel(scanUUID, isPremium)).
+				Where("status = ?", "PENDING").
+				Updates(map[string]interface{}{
+					"status":            "RUNNING",
+					"started_at":        &now,
+					"last_heartbeat_at": &now,
+				})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			started = true
+			return recordScanEvent(tx, c, scanUUID, "PENDING", "RUNNING", "Worker started the scan")
+		})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to start scan", "scan_id", scanUUID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan status"})
+			return
+		}
+	}
+
+	if started {
+		slog.InfoContext(c.Request.Context(), "Scan started", "scan_id", scanUUID)
+		h.events.Publish(scanUUID, events.TypeStatus, gin.H{"status": "RUNNING"})
+	} else if !h.recordHeartbeat(c, scanUUID, isPremium) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": scanUUID, "status": "RUNNING"})
+}
+
+// HandleScanHeartbeat records that the worker running a scan is still
+// alive. Running scans whose worker has sent heartbeats are failed once
+// none arrives for cfg.ScanHeartbeatTimeout (see RunStaleScanMonitor).
+func (h *ScanHandler) HandleScanHeartbeat(c *gin.Context) {
+	scanUUID, isPremium, _, ok := h.workerScan(c)
+	if !ok {
+		return
+	}
+	if !h.recordHeartbeat(c, scanUUID, isPremium) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": scanUUID, "status": "RUNNING"})
+}
+
+// recordHeartbeat updates the heartbeat of a running scan. If the scan
+// isn't running an error response is written and false is returned.
+func (h *ScanHandler) recordHeartbeat(c *gin.Context, scanUUID uuid.UUID, isPremium bool) bool {
+	result := h.db.Model(scanModel(scanUUID, isPremium)).
+		Where("status = ?", "RUNNING").
+		Update("last_heartbeat_at", time.Now())
+	if result.Error != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record heartbeat of scan", "scan_id", scanUUID, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		// The scan finished or was cancelled since it was looked up.
+		_, status, _ := findScan(h.db, scanUUID)
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan is not running", "status": status})
+		return false
+	}
+	return true
+}
+
+// RunStaleScanMonitor fails running scans whose worker stopped sending
+// heartbeats, until ctx is cancelled. Scans of workers that never sent a
+// heartbeat are left alone.
+func (h *ScanHandler) RunStaleScanMonitor(ctx context.Context) {
+	ticker := time.NewTicker(staleScanCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := h.failStaleScans(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Failed to check scans for missing heartbeats", "error", err)
+		}
+	}
+}
+
+func (h *ScanHandler) failStaleScans(ctx context.Context) error {
+	cutoff := time.Now().Add(-h.cfg.ScanHeartbeatTimeout)
+	db := h.db.WithContext(ctx)
+
+	var stale []uuid.UUID
+	for _, model := range []interface{}{&models.Scan{}, &models.PremiumScan{}} {
+		var ids []uuid.UUID
+		if err := db.Model(model).
+			Where("status = ? AND last_heartbeat_at < ?", "RUNNING", cutoff).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		stale = append(stale, ids...)
+	}
+
+	for _, scanUUID := range stale {
+		slog.WarnContext(ctx, "Worker stopped sending heartbeats, failing scan", "scan_id", scanUUID, "timeout", h.cfg.ScanHeartbeatTimeout)
+		if err := h.failScan(scanUUID, "Worker stopped sending heartbeats"); err != nil {
+			slog.ErrorContext(ctx, "Failed to fail stale scan", "scan_id", scanUUID, "error", err)
+		}
+	}
+	return nil
+}
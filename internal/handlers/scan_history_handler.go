@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// TargetHistoryEntry is one scan in the history of a target.
+type TargetHistoryEntry struct {
+	ID          uuid.UUID  `json:"id"`
+	TargetURL   string     `json:"target_url"`
+	Status      string     `json:"status"`
+	Score       *float64   `json:"score"`
+	Grade       string     `json:"grade"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// TargetHistoryResponse lists the scans of a target, oldest first.
+type TargetHistoryResponse struct {
+	TargetURL string               `json:"target_url"`
+	Items     []TargetHistoryEntry `json:"items"`
+}
+
+// HandleTargetHistory returns every scan of the current user for the
+// target URL in ?url=, with its status and score, oldest first, for trend
+// views. URLs are compared ignoring case and trailing slashes. The status
+// and created_from/created_to filters of applyScanFilters apply.
+func (h *ScanHandler) HandleTargetHistory(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	target := comparableURL(strings.TrimSpace(c.Query("url")))
+	if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+
+	query, err := applyScanFilters(c.Request.URL.Query(), scanAccess(h.db.Model(&models.PremiumScan{}), userUUID).
+		Where("LOWER(RTRIM(target_url, '/')) = ?", target))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]TargetHistoryEntry, 0)
+	if err := query.Select("id", "target_url", "status", "score", "grade", "created_at", "completed_at").
+		Order("created_at").Find(&items).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve target history", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TargetHistoryResponse{TargetURL: target, Items: items})
+}
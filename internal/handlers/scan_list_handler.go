@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// ScanListResponse is a page of scans.
+type ScanListResponse struct {
+	Items  []models.PremiumScan `json:"items"`
+	Total  int64                `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+}
+
+// parsePagination reads ?limit= and ?offset= with defaults and bounds.
+func parsePagination(c *gin.Context) (int, int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageLimit)))
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return limit, offset, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates (YYYY-MM-DD).
+// For plain dates used as an upper bound, endOfDay moves the bound to the
+// end of that day so the whole day is included.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// applyScanFilters applies the shared list filters:
+//
+//   - status: comma-separated list of statuses
+//   - target: case-insensitive substring of the target URL
+//   - tag: comma-separated list of tags, all of which a scan must have
+//   - organization_id: the organization the scan is shared with
+//   - created_from / created_to: inclusive created_at range
+func applyScanFilters(params url.Values, query *gorm.DB) (*gorm.DB, error) {
+	if raw := strings.TrimSpace(params.Get("status")); raw != "" {
+		var statuses []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+				statuses = append(statuses, s)
+			}
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+
+	if target := strings.TrimSpace(params.Get("target")); target != "" {
+		query = query.Where("LOWER(target_url) LIKE ?", "%"+escapeLike(strings.ToLower(target))+"%")
+	}
+
+	if tags := splitList(params.Get("tag"), strings.ToLower); len(tags) > 0 {
+		query = query.Where("id IN (?)", query.Session(&gorm.Session{NewDB: true}).Model(&models.ScanTag{}).
+			Select("scan_id").Where("tag IN ?", tags).
+			Group("scan_id").Having("COUNT(*) = ?", len(tags)))
+	}
+
+	if raw := params.Get("organization_id"); raw != "" {
+		orgID, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("organization_id must be a UUID")
+		}
+		query = query.Where("organization_id = ?", orgID)
+	}
+
+	if from := params.Get("created_from"); from != "" {
+		t, err := parseTimeParam(from, false)
+		if err != nil {
+			return nil, fmt.Errorf("created_from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+
+	if to := params.Get("created_to"); to != "" {
+		t, err := parseTimeParam(to, true)
+		if err != nil {
+			return nil, fmt.Errorf("created_to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		query = query.Where("created_at <= ?", t)
+	}
+
+	return query, nil
+}
+
+// HandleListScans returns a page of the scans the current user can read
+// (see scanAccess), newest first, without their results. See
+// applyScanFilters for the supported filters.
+// With ?view=<id> the filters of a saved view are applied first; explicit
+// query parameters override them.
+func (h *ScanHandler) HandleListScans(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := viewParams(c, h.db, userUUID, SavedViewResourceScans)
+	if !ok {
+		return
+	}
+
+	query, err := applyScanFilters(params, scanAccess(h.db.Model(&models.PremiumScan{}), userUUID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	scans := make([]models.PremiumScan, 0)
+	if err := preloadTags(query).Order("created_at desc").Limit(limit).Offset(offset).Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScanListResponse{
+		Items:  scans,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleSearchScans returns a page of the scans the current user can read
+// matching all given criteria, newest first. In addition to the filters of
+// applyScanFilters it accepts:
+//
+//   - target_prefix: case-insensitive prefix of the target URL
+//   - severity: comma-separated list of severities; a scan matches if one
+//     of its failed results has one of them
+func (h *ScanHandler) HandleSearchScans(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err := applyScanFilters(c.Request.URL.Query(), scanAccess(h.db.Model(&models.PremiumScan{}), userUUID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if prefix := strings.TrimSpace(c.Query("target_prefix")); prefix != "" {
+		query = query.Where("LOWER(target_url) LIKE ?", escapeLike(strings.ToLower(prefix))+"%")
+	}
+	if severities := splitList(c.Query("severity"), strings.ToLower); len(severities) > 0 {
+		ranks := make([]int, 0, len(severities))
+		for _, s := range severities {
+			rank, known := models.SeverityRanks[s]
+			if !known {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown severity %q", s)})
+				return
+			}
+			ranks = append(ranks, rank)
+		}
+		query = query.Where("EXISTS (?)", h.db.Model(&models.ScanResult{}).Select("1").
+			Where("scan_results.scan_id = premium_scans.id AND scan_results.passed = ? AND scan_results.severity_rank IN ?", false, ranks))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	scans := make([]models.PremiumScan, 0)
+	if err := preloadTags(query).Order("created_at desc").Limit(limit).Offset(offset).Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScanListResponse{
+		Items:  scans,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleAdminListScans returns a page of all users' scans. In addition to
+// the filters of applyScanFilters it accepts ?user_id= and ?stuck_for=, a
+// duration such as 30m that lists the PENDING and RUNNING scans with no
+// start or heartbeat for at least that long.
+func (h *ScanHandler) HandleAdminListScans(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err := applyScanFilters(c.Request.URL.Query(), h.db.Model(&models.PremiumScan{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		userUUID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a UUID"})
+			return
+		}
+		query = query.Where("user_id = ?", userUUID)
+	}
+	if raw := c.Query("stuck_for"); raw != "" {
+		stuckFor, err := time.ParseDuration(raw)
+		if err != nil || stuckFor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stuck_for must be a positive duration such as 30m"})
+			return
+		}
+		query = query.Where("status IN ? AND COALESCE(last_heartbeat_at, started_at, created_at) < ?",
+			[]string{"PENDING", "RUNNING"}, time.Now().Add(-stuckFor))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	scans := make([]models.PremiumScan, 0)
+	if err := preloadTags(query).Order("created_at desc").Limit(limit).Offset(offset).Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scans", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScanListResponse{
+		Items:  scans,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// HandleAdminGetScan returns any user's scan with its results.
+func (h *ScanHandler) HandleAdminGetScan(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	query, ok := preloadResults(c, h.db)
+	if !ok {
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := preloadTags(query).First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scan", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, scan)
+}
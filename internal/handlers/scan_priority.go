@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// ScanQueueMaxPriority is the x-max-priority argument of scan_queue. It
+// can't be changed on an existing queue.
+const ScanQueueMaxPriority = 3
+
+// scanPriorities maps scan priorities to AMQP message priorities. Tasks
+// published without a priority rank below all of them.
+var scanPriorities = map[string]uint8{
+	models.ScanPriorityLow:    1,
+	models.ScanPriorityNormal: 2,
+	models.ScanPriorityHigh:   3,
+}
+
+// parseScanPriority validates the priority of a submission; an empty
+// priority is def.
+func parseScanPriority(priority, def string) (string, error) {
+	if priority == "" {
+		return def, nil
+	}
+	if _, ok := scanPriorities[priority]; !ok {
+		return "", fmt.Errorf("priority must be %q, %q or %q", models.ScanPriorityLow, models.ScanPriorityNormal, models.ScanPriorityHigh)
+	}
+	return priority, nil
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+// quickProfileTests are the tests of the quick profile: checks that only
+// need the response headers and the certificate of the target.
+var quickProfileTests = []string{"https", "hsts", "ssl-cert", "csp", "xframe", "x-content-type-options", "cookie-sec"}
+
+// resolveScanProfile returns the profile of a submission and the tests it
+// runs. An explicit tests list makes the profile custom; its entries are
+// test IDs or category names (see CategorizedTests), matched ignoring
+// case, and unknown entries are skipped like before profiles existed.
+// Without tests an empty profile is def.
+func resolveScanProfile(profile string, tests []string, def string) (string, []string, error) {
+	profile = strings.ToLower(strings.TrimSpace(profile))
+	if len(tests) == 0 {
+		if profile == "" {
+			profile = def
+		}
+		switch profile {
+		case models.ScanProfileQuick:
+			return profile, quickProfileTests, nil
+		case models.ScanProfileFull:
+			return profile, AvailableTestsList, nil
+		case models.ScanProfileCustom:
+			return "", nil, fmt.Errorf("the %q profile requires tests", models.ScanProfileCustom)
+		}
+		return "", nil, fmt.Errorf("profile must be %q, %q or %q", models.ScanProfileQuick, models.ScanProfileFull, models.ScanProfileCustom)
+	}
+	if profile != "" && profile != models.ScanProfileCustom {
+		return "", nil, fmt.Errorf("tests can't be combined with the %q profile", profile)
+	}
+
+	seen := map[string]bool{}
+	var resolved []string
+	add := func(test string) {
+		if !seen[test] {
+			seen[test] = true
+			resolved = append(resolved, test)
+		}
+	}
+	for _, entry := range tests {
+		entry = strings.TrimSpace(entry)
+		if AllowedPremiumTests[strings.ToLower(entry)] {
+			add(strings.ToLower(entry))
+			continue
+		}
+		for _, group := range CategorizedTests {
+			if strings.EqualFold(group.CategoryName, entry) {
+				for _, test := range group.Tests {
+					add(test)
+				}
+			}
+		}
+	}
+	return models.ScanProfileCustom, resolved, nil
+}
+
+// intrusiveScan reports whether tests go beyond the quick profile, whose
+// checks only read the headers and certificate of the target's front page.
+func intrusiveScan(tests []string) bool {
+	quick := map[string]bool{}
+	for _, t := range quickProfileTests {
+		quick[t] = true
+	}
+	for _, t := range tests {
+		if !quick[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// unverifiedTargetError returns why a scan running tests may not run
+// against a host no verified target of the user covers, or "" if it may.
+func (h *ScanHandler) unverifiedTargetError(tests []string) string {
+	if h.cfg.RequireVerifiedTargets {
+		return "Target is not verified; verify the host or a wildcard domain covering it first"
+	}
+	if h.cfg.RequireVerifiedIntrusiveScans && intrusiveScan(tests) {
+		return fmt.Sprintf("Target is not verified; only the %q profile can scan unverified targets", models.ScanProfileQuick)
+	}
+	return ""
+}
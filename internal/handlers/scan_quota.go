@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+)
+
+// QuotaResponse is the state of the scan quotas of the current user and,
+// for requests made with an API key, of the key.
+type QuotaResponse struct {
+	User   quota.Usage  `json:"user"`
+	APIKey *quota.Usage `json:"api_key,omitempty"`
+}
+
+// quotaAccounts returns the quota accounts a submission by the user
+// counts against, and the API key it is made with, if any.
+func (h *ScanHandler) quotaAccounts(c *gin.Context, userUUID uuid.UUID) ([]quota.Account, *uuid.UUID, error) {
+	accounts := []quota.Account{quota.User(userUUID, h.cfg.ScanQuota)}
+	keyUUID, err := uuid.Parse(c.GetString("apiKeyID"))
+	if err != nil {
+		return accounts, nil, nil
+	}
+	var key models.APIKey
+	if err := h.db.Select("id", "daily_scan_quota", "monthly_scan_quota").First(&key, "id = ?", keyUUID).Error; err != nil {
+		return nil, nil, err
+	}
+	accounts = append(accounts, quota.APIKey(key.ID, quota.Limits{Daily: key.DailyScanQuota, Monthly: key.MonthlyScanQuota}))
+	return accounts, &key.ID, nil
+}
+
+// respondQuotaExceeded refuses a submission that doesn't fit a quota.
+func respondQuotaExceeded(c *gin.Context, exceeded *quota.ExceededError) {
+	retryAfter := int(time.Until(exceeded.ResetsAt).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":     fmt.Sprintf("The %s scan quota of %d scans is used up", exceeded.Period, exceeded.Limit),
+		"period":    exceeded.Period,
+		"limit":     exceeded.Limit,
+		"resets_at": exceeded.ResetsAt,
+	})
+}
+
+// HandleGetQuota reports how many scans the current user, and the API key
+// of the request, have left today and this month, and when the allowance
+// resets.
+func (h *ScanHandler) HandleGetQuota(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	accounts, _, err := h.quotaAccounts(c, userUUID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load API key quota", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	now := time.Now()
+	usages := make([]quota.Usage, len(accounts))
+	for i, account := range accounts {
+		if usages[i], err = account.Usage(h.db, now); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to count scan quota usage", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	resp := QuotaResponse{User: usages[0]}
+	if len(usages) > 1 {
+		resp.APIKey = &usages[1]
+	}
+	c.JSON(http.StatusOK, resp)
+}
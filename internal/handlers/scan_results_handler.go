@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// IncludeResults is the ?include= value that embeds the results in the
+// scan detail.
+const IncludeResults = "results"
+
+// ScanResultCounts counts the results of a scan.
+type ScanResultCounts struct {
+	Total  int64 `json:"total"`
+	Failed int64 `json:"failed"`
+	// BySeverity counts the failed results by severity.
+	BySeverity map[string]int64 `json:"by_severity"`
+}
+
+// ScanDetailResponse is a scan with the counts of its results. Results are
+// only embedded with ?include=results; they are otherwise paged through
+// GET /api/scans/:id/results.
+type ScanDetailResponse struct {
+	models.PremiumScan
+	Results      *[]models.ScanResult `json:"results,omitempty"`
+	ResultCounts ScanResultCounts     `json:"result_counts"`
+}
+
+// ScanResultListResponse is a page of the results of a scan.
+type ScanResultListResponse struct {
+	Items  []models.ScanResult `json:"items"`
+	Total  int64               `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+// includesResults reports whether ?include= asks for the results. Unknown
+// values are an error.
+func includesResults(c *gin.Context) (bool, error) {
+	include := false
+	for _, value := range splitList(c.Query("include"), strings.ToLower) {
+		if value != IncludeResults {
+			return false, fmt.Errorf("include must be %q", IncludeResults)
+		}
+		include = true
+	}
+	return include, nil
+}
+
+// countResults counts the results of a scan, in total, failed and failed
+// by severity.
+func countResults(db *gorm.DB, scanUUID uuid.UUID) (ScanResultCounts, error) {
+	var rows []struct {
+		Severity string
+		Passed   bool
+		Count    int64
+	}
+	counts := ScanResultCounts{BySeverity: map[string]int64{}}
+	if err := db.Model(&models.ScanResult{}).Select("severity, passed, COUNT(*) AS count").
+		Where("scan_id = ?", scanUUID).Group("severity, passed").Scan(&rows).Error; err != nil {
+		return counts, err
+	}
+	for _, r := range rows {
+		counts.Total += r.Count
+		if !r.Passed {
+			counts.Failed += r.Count
+			counts.BySeverity[r.Severity] += r.Count
+		}
+	}
+	return counts, nil
+}
+
+// HandleListScanResults returns a page of the results of one of the
+// current user's scans, in the order they were saved or most severe first
+// with ?sort=severity.
+func (h *ScanHandler) HandleListScanResults(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := resultOrder(c.Query("sort"), "scan_results.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to look up scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := h.db.Model(&models.ScanResult{}).Where("scan_id = ?", scanUUID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count results of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	items := []models.ScanResult{}
+	if err := query.Order(order).Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list results of scan", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScanResultListResponse{
+		Items:  items,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
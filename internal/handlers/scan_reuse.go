@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// recentScan returns the ID of the latest scan matched by query that
+// completed within cfg.ScanReuseWindow. model selects the table.
+func (h *ScanHandler) recentScan(model interface{}, query *gorm.DB) (uuid.UUID, bool, error) {
+	if h.cfg.ScanReuseWindow <= 0 {
+		return uuid.Nil, false, nil
+	}
+
+	var scanIDs []uuid.UUID
+	err := query.Model(model).
+		Where("status = ? AND completed_at >= ?", "COMPLETED", time.Now().Add(-h.cfg.ScanReuseWindow)).
+		Order("completed_at DESC").Limit(1).
+		Pluck("id", &scanIDs).Error
+	if err != nil || len(scanIDs) == 0 {
+		return uuid.Nil, false, err
+	}
+	return scanIDs[0], true, nil
+}
+
+// recentPremiumScan looks for a recently completed scan of the user's that
+// can stand in for a new one: it must have run every requested test, and
+// have taken a screenshot if one is requested.
+func (h *ScanHandler) recentPremiumScan(userUUID uuid.UUID, targetURL string, tests []string, screenshot bool) (uuid.UUID, bool, error) {
+	query := h.db.Where("user_id = ? AND target_url = ?", userUUID, targetURL)
+	if screenshot {
+		query = query.Where("screenshot = ?", true)
+	}
+	scanID, found, err := h.recentScan(&models.PremiumScan{}, query)
+	if err != nil || !found {
+		return uuid.Nil, false, err
+	}
+
+	var ran []string
+	if err := h.db.Model(&models.ScanResult{}).
+		Where("scan_id = ?", scanID).
+		Distinct().Pluck("LOWER(test_name)", &ran).Error; err != nil {
+		return uuid.Nil, false, err
+	}
+	covered := make(map[string]bool, len(ran))
+	for _, t := range ran {
+		covered[t] = true
+	}
+	for _, t := range tests {
+		if !covered[strings.ToLower(t)] {
+			return uuid.Nil, false, nil
+		}
+	}
+	return scanID, true, nil
+}
+
+// respondReusedScan answers a submission with a recently completed scan.
+// It uses 200 OK instead of the 202 Accepted of a queued scan.
+func respondReusedScan(c *gin.Context, scanID uuid.UUID) {
+	slog.InfoContext(c.Request.Context(), "Reusing recent scan of target", "scan_id", scanID)
+	c.JSON(http.StatusOK, gin.H{
+		"scanId": scanID.String(),
+		"status": "COMPLETED",
+		"reused": true,
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxScanTags bounds the tags of one scan.
+	maxScanTags = 20
+	// maxScanTagLength bounds the length of a tag, in characters.
+	maxScanTagLength = 64
+)
+
+// UpdateScanTagsRequest replaces the tags of a scan.
+type UpdateScanTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// normalizeTags trims and lower-cases tags and removes duplicates. Tags
+// can't contain commas, which separate them in the ?tag= list filter.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxScanTagLength || strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tags must be at most %d characters long and must not contain commas, got %q", maxScanTagLength, tag)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxScanTags {
+		return nil, fmt.Errorf("a scan can have at most %d tags", maxScanTags)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// scanTags builds the tag rows of a scan.
+func scanTags(scanID uuid.UUID, tags []string) []models.ScanTag {
+	now := time.Now()
+	rows := make([]models.ScanTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = models.ScanTag{ScanID: scanID, Tag: tag, CreatedAt: now}
+	}
+	return rows
+}
+
+// preloadTags preloads the tags of premium scans in name order.
+func preloadTags(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tags", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("tag")
+	})
+}
+
+// HandleUpdateScanTags replaces the tags of one of the current user's
+// scans. An empty list removes all tags.
+func (h *ScanHandler) HandleUpdateScanTags(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var req UpdateScanTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var scan models.PremiumScan
+		if err := tx.Select("id").First(&scan, "id = ? AND user_id = ?", scanUUID, userUUID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("scan_id = ?", scanUUID).Delete(&models.ScanTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		return tx.Create(scanTags(scanUUID, tags)).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to update scan tags", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if tags == nil {
+		tags = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": scanUUID, "tags": tags})
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ScanTimelineResponse lists the status transitions of a scan, oldest
+// first. With ?at= it also holds the status the scan had at that time
+// (empty if it didn't exist yet) and only the events up to it.
+type ScanTimelineResponse struct {
+	ScanID   uuid.UUID          `json:"scan_id"`
+	At       *time.Time         `json:"at,omitempty"`
+	StatusAt *string            `json:"status_at,omitempty"`
+	Events   []models.ScanEvent `json:"events"`
+}
+
+// recordScanEvent records a status transition of a scan. The actor is the
+// caller of the request c: the authenticated user, a worker (upload token
+// or API key without a user) or an anonymous client. A nil c records a
+// system transition.
+func recordScanEvent(tx *gorm.DB, c *gin.Context, scanID uuid.UUID, from, to, reason string) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	event := models.ScanEvent{
+		ID:         id,
+		ScanID:     scanID,
+		FromStatus: from,
+		Status:     to,
+		Actor:      models.ScanActorSystem,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if c != nil {
+		if userUUID, err := uuid.Parse(c.GetString("userID")); err == nil {
+			event.Actor = models.ScanActorUser
+			event.ActorID = &userUUID
+		} else if keyUUID, err := uuid.Parse(c.GetString("apiKeyID")); err == nil {
+			event.Actor = models.ScanActorWorker
+			event.ActorID = &keyUUID
+		} else if c.GetString("uploadScanID") != "" {
+			event.Actor = models.ScanActorWorker
+		} else {
+			event.Actor = models.ScanActorAnonymous
+		}
+	}
+	return tx.Create(&event).Error
+}
+
+// HandleScanTimeline returns the status history of one of the current
+// user's scans.
+func (h *ScanHandler) HandleScanTimeline(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	var scan models.PremiumScan
+	if err := scanAccess(h.db, userUUID).Select("id").First(&scan, "id = ?", scanUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.scanTimeline(c, scanUUID)
+}
+
+// HandleAdminScanTimeline returns the status history of any free or
+// premium scan.
+func (h *ScanHandler) HandleAdminScanTimeline(c *gin.Context) {
+	scanUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Scan ID format"})
+		return
+	}
+
+	if _, _, err := findScan(h.db, scanUUID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	h.scanTimeline(c, scanUUID)
+}
+
+// scanTimeline writes the timeline of a scan whose visibility has been
+// checked.
+func (h *ScanHandler) scanTimeline(c *gin.Context, scanUUID uuid.UUID) {
+	resp := ScanTimelineResponse{ScanID: scanUUID, Events: []models.ScanEvent{}}
+
+	query := h.db.Where("scan_id = ?", scanUUID)
+	if raw := c.Query("at"); raw != "" {
+		at, err := parseTimeParam(raw, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at <= ?", at)
+		resp.At = &at
+	}
+
+	if err := query.Order("created_at, id").Find(&resp.Events).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load scan timeline", "scan_id", scanUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve timeline"})
+		return
+	}
+
+	if resp.At != nil {
+		status := ""
+		if n := len(resp.Events); n > 0 {
+			status = resp.Events[n-1].Status
+		}
+		resp.StatusAt = &status
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/scoring"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type ScoringHandler struct {
+	db *gorm.DB
+}
+
+type ScoringPolicyRequest struct {
+	CategoryWeights     map[string]float64      `json:"category_weights"`
+	SeverityMultipliers map[string]float64      `json:"severity_multipliers"`
+	GradeThresholds     []models.GradeThreshold `json:"grade_thresholds" binding:"required,min=1"`
+}
+
+func NewScoringHandler(db *gorm.DB) *ScoringHandler {
+	return &ScoringHandler{
+		db: db,
+	}
+}
+
+// HandleGetScoringPolicy returns the scoring rules applied to the current
+// user's scans and where they come from (user, default or builtin).
+func (h *ScoringHandler) HandleGetScoringPolicy(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var policy models.ScoringPolicy
+	err := scoring.PolicyOf(h.db, &userUUID, nil).First(&policy).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "user", "rules": scoring.Normalize(policy.Rules.Data())})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scoring policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scoring policy"})
+		return
+	}
+
+	h.respondDefaultPolicy(c)
+}
+
+func (h *ScoringHandler) HandleUpdateScoringPolicy(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.savePolicy(c, &userUUID, nil)
+}
+
+// HandleDeleteScoringPolicy removes the user's own policy so their scans
+// fall back to the platform default.
+func (h *ScoringHandler) HandleDeleteScoringPolicy(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := scoring.PolicyOf(h.db, &userUUID, nil).Delete(&models.ScoringPolicy{}).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete scoring policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scoring policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scoring policy reset to default"})
+}
+
+func (h *ScoringHandler) HandleGetDefaultScoringPolicy(c *gin.Context) {
+	h.respondDefaultPolicy(c)
+}
+
+func (h *ScoringHandler) HandleUpdateDefaultScoringPolicy(c *gin.Context) {
+	h.savePolicy(c, nil, nil)
+}
+
+// HandleGetOrganizationScoringPolicy returns the scoring policy of one of
+// the current user's organizations, which applies to the scans shared
+// with it. Without one, each scan is scored with its submitter's rules.
+func (h *ScoringHandler) HandleGetOrganizationScoringPolicy(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	var policy models.ScoringPolicy
+	err := scoring.PolicyOf(h.db, nil, &orgID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization has no scoring policy"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve scoring policy", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scoring policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"source": "organization", "rules": scoring.Normalize(policy.Rules.Data())})
+}
+
+// HandleUpdateOrganizationScoringPolicy creates or replaces the scoring
+// policy of an organization the current user owns.
+func (h *ScoringHandler) HandleUpdateOrganizationScoringPolicy(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "change the scoring policy")
+	if !ok {
+		return
+	}
+
+	h.savePolicy(c, nil, &orgID)
+}
+
+// HandleDeleteOrganizationScoringPolicy removes the scoring policy of an
+// organization the current user owns.
+func (h *ScoringHandler) HandleDeleteOrganizationScoringPolicy(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "change the scoring policy")
+	if !ok {
+		return
+	}
+
+	if err := scoring.PolicyOf(h.db, nil, &orgID).Delete(&models.ScoringPolicy{}).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete scoring policy", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scoring policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Organization scoring policy removed"})
+}
+
+func (h *ScoringHandler) respondDefaultPolicy(c *gin.Context) {
+	var policy models.ScoringPolicy
+	err := scoring.PolicyOf(h.db, nil, nil).First(&policy).Error
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "default", "rules": scoring.Normalize(policy.Rules.Data())})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve default scoring policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scoring policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"source": "builtin", "rules": scoring.Normalize(scoring.DefaultRules())})
+}
+
+// savePolicy creates or replaces the policy of orgID or userID (both nil
+// for the platform default).
+func (h *ScoringHandler) savePolicy(c *gin.Context, userID, orgID *uuid.UUID) {
+	var req ScoringPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	rules := models.ScoringRules{
+		CategoryWeights:     req.CategoryWeights,
+		SeverityMultipliers: req.SeverityMultipliers,
+		GradeThresholds:     req.GradeThresholds,
+	}
+	if err := scoring.Validate(rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rules = scoring.Normalize(rules)
+
+	var policy models.ScoringPolicy
+	err := scoring.PolicyOf(h.db, userID, orgID).First(&policy).Error
+	switch {
+	case err == nil:
+		policy.Rules = datatypes.NewJSONType(rules)
+		err = h.db.Save(&policy).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var policyID uuid.UUID
+		policyID, err = uuid.NewV7()
+		if err != nil {
+			break
+		}
+		now := time.Now()
+		policy = models.ScoringPolicy{
+			ID:             policyID,
+			UserID:         userID,
+			OrganizationID: orgID,
+			Rules:          datatypes.NewJSONType(rules),
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		err = h.db.Create(&policy).Error
+	}
+
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save scoring policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scoring policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+type RecalculationRequest struct {
+	UserID string `json:"user_id" binding:"omitempty,uuid"`
+}
+
+// HandleStartRecalculation starts a background job that rescores historical
+// scans with the current policies. Only one job may run at a time.
+func (h *ScoringHandler) HandleStartRecalculation(c *gin.Context) {
+	adminUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RecalculationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindingError(c, err)
+			return
+		}
+	}
+
+	var active int64
+	h.db.Model(&models.RecalculationJob{}).
+		Where("status IN ?", []string{models.JobStatusPending, models.JobStatusRunning}).
+		Count(&active)
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A recalculation job is already running"})
+		return
+	}
+
+	jobID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate job ID"})
+		return
+	}
+
+	job := models.RecalculationJob{
+		ID:          jobID,
+		RequestedBy: adminUUID,
+		Status:      models.JobStatusPending,
+		CreatedAt:   time.Now(),
+	}
+	if req.UserID != "" {
+		userUUID := uuid.MustParse(req.UserID)
+		job.UserID = &userUUID
+	}
+
+	if err := h.db.Create(&job).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create recalculation job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recalculation job"})
+		return
+	}
+
+	go scoring.RunRecalculation(h.db, job.ID, TestCategories)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *ScoringHandler) HandleGetRecalculation(c *gin.Context) {
+	jobUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID format"})
+		return
+	}
+
+	var job models.RecalculationJob
+	if err := h.db.First(&job, "id = ?", jobUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recalculation job not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve recalculation job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve recalculation job"})
+		return
+	}
+
+	progress := 100.0
+	if job.Total > 0 {
+		progress = float64(job.Processed) / float64(job.Total) * 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":      job,
+		"progress": progress,
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxUserAgentLength bounds the stored user agent of a session, in bytes.
+const maxUserAgentLength = 512
+
+// SessionResponse is a session of the current user. Current marks the
+// session of the request's token.
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// newSession describes a login from the request's device.
+func (h *AuthHandler) newSession(c *gin.Context, userID uuid.UUID) (models.Session, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return models.Session{}, err
+	}
+	userAgent := truncateUTF8(c.Request.UserAgent(), maxUserAgentLength)
+	now := time.Now()
+	return models.Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+		DeviceHash: deviceFingerprint(userAgent),
+		Location:   h.loginLocation(c),
+	}, nil
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// revokeSessions signs out every session of a user but keep, which may be
+// empty.
+func revokeSessions(tx *gorm.DB, userID uuid.UUID, keep string) error {
+	query := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keep != "" {
+		query = query.Where("id <> ?", keep)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+// HandleListSessions lists the current user's active sessions, most
+// recently seen first.
+func (h *AuthHandler) HandleListSessions(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var sessions []models.Session
+	if err := h.db.Where("user_id = ? AND NOT pending AND revoked_at IS NULL AND expires_at > ?", userUUID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list sessions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	current := c.GetString("sessionID")
+	resp := make([]SessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = SessionResponse{Session: s, Current: s.ID.String() == current}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleRevokeSession signs one of the current user's sessions out; its
+// token is refused from then on. Revoking the current session logs out.
+func (h *AuthHandler) HandleRevokeSession(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		if err := tx.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionUUID, userUUID).
+			First(&session).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditSessionRevoked, "session", session.ID.String(), gin.H{
+			"user_agent": session.UserAgent,
+			"ip":         session.IP,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to revoke session", "session_id", sessionUUID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/sla"
+	"gorm.io/gorm"
+)
+
+// MaxSLADays bounds the remediation period of an SLA policy.
+const MaxSLADays = 365
+
+// SLAPolicyItem sets the remediation period for one severity.
+type SLAPolicyItem struct {
+	Severity string `json:"severity" binding:"required"`
+	Days     int    `json:"days" binding:"required,min=1"`
+}
+
+// UpdateSLAPoliciesRequest replaces all of the user's SLA policies.
+// Severities left out have no SLA.
+type UpdateSLAPoliciesRequest struct {
+	Policies []SLAPolicyItem `json:"policies" binding:"dive"`
+}
+
+// HandleListSLAPolicies returns the current user's SLA policies.
+func (h *FindingHandler) HandleListSLAPolicies(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	policies := make([]models.SLAPolicy, 0)
+	if err := h.db.Where("user_id = ?", userUUID).Order("days").Find(&policies).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list SLA policies", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"policies":   policies,
+		"severities": sla.Severities,
+	})
+}
+
+// HandleUpdateSLAPolicies replaces the current user's SLA policies.
+func (h *FindingHandler) HandleUpdateSLAPolicies(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	items, ok := bindSLAPolicies(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	policies := make([]models.SLAPolicy, 0, len(items))
+	for _, item := range items {
+		policies = append(policies, models.SLAPolicy{
+			UserID:    userUUID,
+			Severity:  item.Severity,
+			Days:      item.Days,
+			UpdatedAt: now,
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userUUID).Delete(&models.SLAPolicy{}).Error; err != nil {
+			return err
+		}
+		if len(policies) == 0 {
+			return nil
+		}
+		return tx.Create(&policies).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update SLA policies", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update SLA policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies":   policies,
+		"severities": sla.Severities,
+	})
+}
+
+// HandleListOrganizationSLAPolicies returns the SLA policies of an
+// organization the current user is a member of.
+func (h *FindingHandler) HandleListOrganizationSLAPolicies(c *gin.Context) {
+	orgID, _, ok := loadMembership(c, h.db)
+	if !ok {
+		return
+	}
+
+	policies := make([]models.OrganizationSLAPolicy, 0)
+	if err := h.db.Where("organization_id = ?", orgID).Order("days").Find(&policies).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list SLA policies", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"policies":   policies,
+		"severities": sla.Severities,
+	})
+}
+
+// HandleUpdateOrganizationSLAPolicies replaces the SLA policies of an
+// organization the current user owns. They apply to the scans shared with
+// the organization instead of their owner's policies.
+func (h *FindingHandler) HandleUpdateOrganizationSLAPolicies(c *gin.Context) {
+	orgID, ok := loadOwnedOrganization(c, h.db, "set SLA policies")
+	if !ok {
+		return
+	}
+	items, ok := bindSLAPolicies(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	policies := make([]models.OrganizationSLAPolicy, 0, len(items))
+	for _, item := range items {
+		policies = append(policies, models.OrganizationSLAPolicy{
+			OrganizationID: orgID,
+			Severity:       item.Severity,
+			Days:           item.Days,
+			UpdatedAt:      now,
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", orgID).Delete(&models.OrganizationSLAPolicy{}).Error; err != nil {
+			return err
+		}
+		if len(policies) == 0 {
+			return nil
+		}
+		return tx.Create(&policies).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update SLA policies", "organization_id", orgID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update SLA policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies":   policies,
+		"severities": sla.Severities,
+	})
+}
+
+// bindSLAPolicies binds an UpdateSLAPoliciesRequest and validates its
+// policies, returning them with lowercase severities.
+func bindSLAPolicies(c *gin.Context) ([]SLAPolicyItem, bool) {
+	var req UpdateSLAPoliciesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return nil, false
+	}
+
+	items := make([]SLAPolicyItem, 0, len(req.Policies))
+	seen := map[string]bool{}
+	for _, item := range req.Policies {
+		severity := strings.ToLower(item.Severity)
+		if !slices.Contains(sla.Severities, severity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported severity %q", item.Severity), "severities": sla.Severities})
+			return nil, false
+		}
+		if seen[severity] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Severity %q is listed more than once", severity)})
+			return nil, false
+		}
+		if item.Days > MaxSLADays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be at most %d", MaxSLADays)})
+			return nil, false
+		}
+		seen[severity] = true
+		items = append(items, SLAPolicyItem{Severity: severity, Days: item.Days})
+	}
+	return items, true
+}
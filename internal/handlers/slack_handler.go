@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/quota"
+	"github.com/prawo-i-piesc/backend/internal/slack"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SlackLinkCodeTTL is how long a code for linking a Slack user stays
+// valid.
+const SlackLinkCodeTTL = 15 * time.Minute
+
+// maxSlackRequestBody bounds the body of a request of the Slack app. The
+// payloads of interactions include the message clicked.
+const maxSlackRequestBody = 256 << 10
+
+// slackResponseTimeout bounds posting the reply to an interaction.
+const slackResponseTimeout = 10 * time.Second
+
+const slackHelp = "Usage:\n" +
+	"• `/antiginx scan <url> [quick|full]` scans a target (quick by default) and posts the result here when it finishes\n" +
+	"• `/antiginx link <code>` links your Slack user to your AntiGinx account; get a code from your account settings\n" +
+	"• `/antiginx unlink` removes the link"
+
+// SlackLinkCodeResponse is a code for linking a Slack user to the current
+// user.
+type SlackLinkCodeResponse struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandleCreateSlackLinkCode issues a single-use code the current user runs
+// "/antiginx link <code>" with in Slack, so that their scans can be
+// started from there. Issuing a code invalidates the user's earlier codes.
+func (h *ScanHandler) HandleCreateSlackLinkCode(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if h.cfg.Slack.SigningSecret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The Slack app is not configured"})
+		return
+	}
+
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate Slack link code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate link code"})
+		return
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate link code"})
+		return
+	}
+	now := time.Now()
+	linkCode := models.SlackLinkCode{
+		ID:        id,
+		UserID:    userUUID,
+		CodeHash:  hashSlackLinkCode(code),
+		ExpiresAt: now.Add(SlackLinkCodeTTL),
+		CreatedAt: now,
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", userUUID).Delete(&models.SlackLinkCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&linkCode).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save Slack link code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate link code"})
+		return
+	}
+	c.JSON(http.StatusCreated, SlackLinkCodeResponse{
+		Code:      code,
+		Command:   "/antiginx link " + code,
+		ExpiresAt: linkCode.ExpiresAt,
+	})
+}
+
+// HandleSlackCommand serves the /antiginx slash command of the Slack app.
+// Requests must be signed with the app's signing secret (see
+// slack.Verify). Slack users have to link themselves to an account with a
+// code from HandleCreateSlackLinkCode before they can start scans, which
+// run as that account with its quota, verified targets and approvals.
+//
+// Replies are Slack messages answered with 200, as Slack shows nothing
+// else to the user; errors are only shown to the user who ran the
+// command.
+func (h *ScanHandler) HandleSlackCommand(c *gin.Context) {
+	form, ok := h.slackForm(c)
+	if !ok {
+		return
+	}
+
+	teamID, slackUserID := form.Get("team_id"), form.Get("user_id")
+	args := strings.Fields(form.Get("text"))
+	if len(args) == 0 {
+		slackReply(c, false, slackHelp)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "scan":
+		if len(args) < 2 || len(args) > 3 {
+			slackReply(c, false, "Usage: `/antiginx scan <url> [quick|full]`")
+			return
+		}
+		profile := ""
+		if len(args) == 3 {
+			profile = args[2]
+		}
+		user, msg := h.slackUser(c, teamID, slackUserID)
+		if msg != "" {
+			slackReply(c, false, msg)
+			return
+		}
+		inChannel, text := h.slackScan(c, user, teamID, slackUserID, form.Get("channel_id"), args[1], profile, nil)
+		slackReply(c, inChannel, text)
+	case "link":
+		if len(args) != 2 {
+			slackReply(c, false, "Usage: `/antiginx link <code>`")
+			return
+		}
+		h.slackLink(c, teamID, slackUserID, args[1])
+	case "unlink":
+		h.slackUnlink(c, teamID, slackUserID)
+	default:
+		slackReply(c, false, slackHelp)
+	}
+}
+
+// slackScan starts a scan of target with the profile or tests (see
+// resolveScanProfile) for the account linked to the Slack user and has its
+// summary posted to the channel once it finishes. It returns the reply and
+// whether it goes to the channel.
+func (h *ScanHandler) slackScan(c *gin.Context, user models.User, teamID, slackUserID, channelID, target, profile string, tests []string) (bool, string) {
+	ctx := c.Request.Context()
+
+	// Slack sends links as <url> or <url|label>.
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	target, _, _ = strings.Cut(target, "|")
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false, "The target must be an http or https URL, like `https://example.com`."
+	}
+	profile, tests, err := resolveScanProfile(profile, tests, models.ScanProfileQuick)
+	if err != nil {
+		return false, "The profile must be `quick` or `full`."
+	}
+
+	owningTarget, err := targets.FindOwning(h.db, user.ID, target)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.ErrorContext(ctx, "Failed to look up the verified target", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	if owningTarget == nil {
+		if msg := h.unverifiedTargetError(tests); msg != "" {
+			return false, msg + "."
+		}
+	}
+	needsApproval, err := h.needsApproval(user.ID, target)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to check whether scan needs approval", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	quotaAccounts, _, err := h.quotaAccounts(c, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load quota", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+
+	scanID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate UUIDv7", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	scan := models.PremiumScan{
+		ID:        scanID,
+		UserID:    user.ID,
+		TargetURL: target,
+		Status:    "PENDING",
+		CreatedAt: time.Now(),
+		Priority:  models.ScanPriorityNormal,
+		Profile:   profile,
+		Tests:     datatypes.NewJSONSlice(tests),
+	}
+	if owningTarget != nil {
+		scan.TargetID = &owningTarget.ID
+	}
+	if needsApproval {
+		scan.Status = "PENDING_APPROVAL"
+	}
+	task, err := json.Marshal(premiumTask(scan, tests, false))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal task", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := quota.Reserve(tx, 1, quotaAccounts...); err != nil {
+			return err
+		}
+		if err := tx.Create(&scan).Error; err != nil {
+			return err
+		}
+		reason := "Submitted from Slack"
+		if needsApproval {
+			reason = "Submitted from Slack; production target requires approval"
+		}
+		if err := recordScanEvent(tx, c, scan.ID, "", scan.Status, reason); err != nil {
+			return err
+		}
+		if err := tx.Create(&models.SlackNotification{
+			ScanID:        scan.ID,
+			TeamID:        teamID,
+			ChannelID:     channelID,
+			SlackUserID:   slackUserID,
+			NextAttemptAt: scan.CreatedAt,
+			CreatedAt:     scan.CreatedAt,
+		}).Error; err != nil {
+			return err
+		}
+		if !needsApproval {
+			return nil
+		}
+		return tx.Create(&models.ScanApproval{
+			ScanID:      scan.ID,
+			RequestedBy: user.ID,
+			Task:        datatypes.JSON(task),
+			CreatedAt:   scan.CreatedAt,
+		}).Error
+	})
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return false, fmt.Sprintf("Your %s scan quota of %d scans is used up; it resets %s.",
+			exceeded.Period, exceeded.Limit, slackDate(exceeded.ResetsAt))
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create scan in DB", "error", err)
+		return false, "Failed to create the scan; please try again."
+	}
+
+	if needsApproval {
+		h.notifyApprovers(scan, tests)
+	} else if err := h.enqueueTask(ctx, scan.ID, task, scan.Priority); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish message", "error", err)
+		return false, "Failed to queue the scan; please try again."
+	}
+	h.webhooks.Emit(user.ID, webhooks.EventScanCreated, scanEventData(scan))
+
+	text := fmt.Sprintf("<@%s> started a %s scan of %s; the result will be posted here when it finishes.", slackUserID, profile, slack.Escape(target))
+	if needsApproval {
+		text = fmt.Sprintf("<@%s> requested a %s scan of %s, which is a production target and waits for an admin's approval; the result will be posted here.", slackUserID, profile, slack.Escape(target))
+	}
+	return true, text
+}
+
+// HandleSlackInteraction serves the buttons of the scan summaries the
+// Slack app posts (see slack.SummaryBlocks), so that findings can be
+// triaged where the summary lands: acknowledging a finding, requesting a
+// ticket for it from the user's issue tracker through a
+// finding.ticket_requested webhook, or scanning the target again.
+// Requests are verified like slash commands, and the actions run as the
+// account linked to the Slack user who clicked.
+//
+// Slack ignores the response to an interaction, so it is answered with
+// an empty 200 and the reply is posted to the interaction's response URL.
+func (h *ScanHandler) HandleSlackInteraction(c *gin.Context) {
+	form, ok := h.slackForm(c)
+	if !ok {
+		return
+	}
+	interaction, err := slack.ParseInteraction(form.Get("payload"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interaction payload"})
+		return
+	}
+	c.Status(http.StatusOK)
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		return
+	}
+	action := interaction.Actions[0]
+	switch action.ActionID {
+	case slack.ActionAcknowledge, slack.ActionCreateTicket, slack.ActionRescan:
+	default:
+		// Such as the link to the full results, which needs no reply.
+		return
+	}
+
+	teamID, slackUserID := interaction.Team.ID, interaction.User.ID
+	inChannel := false
+	user, text := h.slackUser(c, teamID, slackUserID)
+	if text == "" {
+		switch action.ActionID {
+		case slack.ActionAcknowledge:
+			inChannel, text = h.slackAcknowledge(c, user, slackUserID, action.Value)
+		case slack.ActionCreateTicket:
+			inChannel, text = h.slackCreateTicket(c, user, slackUserID, action.Value)
+		case slack.ActionRescan:
+			inChannel, text = h.slackRescan(c, user, teamID, slackUserID, interaction.Channel.ID, action.Value)
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), slackResponseTimeout)
+		defer cancel()
+		if err := h.slackClient.Respond(ctx, interaction.ResponseURL, text, inChannel); err != nil {
+			slog.Warn("Failed to reply to Slack interaction", "action", action.ActionID, "error", err)
+		}
+	}()
+}
+
+// slackAcknowledge acknowledges an open finding of the user's own scans.
+func (h *ScanHandler) slackAcknowledge(c *gin.Context, user models.User, slackUserID, value string) (bool, string) {
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return false, "The finding no longer exists."
+	}
+	var finding models.ScanResult
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		err := ownedFindings(tx, user.ID).
+			Select("scan_results.id", "scan_results.test_name", "scan_results.triage_status").
+			First(&finding, "scan_results.id = ?", id).Error
+		if err != nil || finding.TriageStatus != models.TriageOpen {
+			return err
+		}
+		return tx.Model(&models.ScanResult{}).Where("id = ?", finding.ID).Updates(map[string]interface{}{
+			"triage_status":        models.TriageAcknowledged,
+			"triaged_at":           time.Now(),
+			"triaged_by":           user.ID,
+			"triage_note":          "Acknowledged in Slack",
+			"verify_after":         nil,
+			"verification_scan_id": nil,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, "The finding no longer exists, or isn't of one of your own scans; only those can be triaged."
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to acknowledge finding", "finding_id", id, "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	name, err := h.slackFindingName(user.ID, finding.TestName)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load data classification", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	if finding.TriageStatus != models.TriageOpen {
+		return false, fmt.Sprintf("%s is already %s.", name, finding.TriageStatus)
+	}
+	return true, fmt.Sprintf("<@%s> acknowledged %s.", slackUserID, name)
+}
+
+// slackCreateTicket requests a ticket for a finding of a scan the user can
+// read with a finding.ticket_requested event to the user's webhooks, which
+// open it in the user's issue tracker.
+func (h *ScanHandler) slackCreateTicket(c *gin.Context, user models.User, slackUserID, value string) (bool, string) {
+	ctx := c.Request.Context()
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return false, "The finding no longer exists."
+	}
+	var finding struct {
+		models.ScanResult
+		TargetURL string
+		OwnerID   uuid.UUID
+	}
+	err = visibleFindings(h.db, user.ID).
+		Select("scan_results.*", "premium_scans.target_url", "premium_scans.user_id AS owner_id").
+		Take(&finding, "scan_results.id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, "The finding no longer exists."
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load finding", "finding_id", id, "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	subscribed, err := webhooks.Subscribed(h.db, user.ID, webhooks.EventFindingTicketRequested)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load webhooks", "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	if !subscribed {
+		return false, fmt.Sprintf("Tickets are opened by your webhooks subscribed to `%s`, and you have none. Add one that creates issues in your tracker and try again.", webhooks.EventFindingTicketRequested)
+	}
+
+	h.webhooks.Emit(user.ID, webhooks.EventFindingTicketRequested, webhooks.Finding{TestName: finding.TestName, Data: map[string]interface{}{
+		"finding_id":    finding.ID,
+		"scan_id":       finding.ScanID,
+		"target_url":    finding.TargetURL,
+		"test_name":     finding.TestName,
+		"severity":      finding.Severity,
+		"message":       finding.Message,
+		"triage_status": finding.TriageStatus,
+		"assignee_id":   finding.AssigneeID,
+		"first_seen_at": finding.FirstSeenAt,
+		"scan_url":      h.cfg.FrontendLink("/scans/" + finding.ScanID.String()),
+		"requested_by":  user.ID,
+		"slack_user_id": slackUserID,
+	}})
+	name, err := h.slackFindingName(finding.OwnerID, finding.TestName)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load data classification", "error", err)
+		return true, fmt.Sprintf("<@%s> requested a ticket for a finding on %s.", slackUserID, slack.Escape(finding.TargetURL))
+	}
+	return true, fmt.Sprintf("<@%s> requested a ticket for %s on %s.", slackUserID, name, slack.Escape(finding.TargetURL))
+}
+
+// slackFindingName names a finding in a Slack reply, which may be posted
+// to the channel: its test, unless the owner classified it confidential.
+func (h *ScanHandler) slackFindingName(ownerID uuid.UUID, test string) (string, error) {
+	outbound, err := classification.For(h.db, ownerID, classification.ChannelSlack, false)
+	if err != nil {
+		return "", err
+	}
+	if !outbound.Discloses(test) {
+		return "a confidential finding", nil
+	}
+	return "*" + slack.Escape(test) + "*", nil
+}
+
+// slackRescan scans the target of a scan the user can read again, with
+// the same profile or tests, as slackScan.
+func (h *ScanHandler) slackRescan(c *gin.Context, user models.User, teamID, slackUserID, channelID, value string) (bool, string) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return false, "The scan no longer exists."
+	}
+	var scan models.PremiumScan
+	err = scanAccess(h.db.Model(&models.PremiumScan{}), user.ID).
+		Select("premium_scans.id", "premium_scans.target_url", "premium_scans.profile", "premium_scans.tests").
+		First(&scan, "premium_scans.id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, "The scan no longer exists."
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load scan", "scan_id", id, "error", err)
+		return false, "Something went wrong; please try again."
+	}
+	var tests []string
+	if scan.Profile != models.ScanProfileQuick && scan.Profile != models.ScanProfileFull {
+		tests = scan.Tests
+	}
+	return h.slackScan(c, user, teamID, slackUserID, channelID, scan.TargetURL, scan.Profile, tests)
+}
+
+// slackLink links the Slack user to the account that issued code.
+func (h *ScanHandler) slackLink(c *gin.Context, teamID, slackUserID, code string) {
+	var linkCode models.SlackLinkCode
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&linkCode, "code_hash = ? AND used_at IS NULL AND expires_at > ?", hashSlackLinkCode(strings.ToUpper(code)), time.Now()).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		res := tx.Model(&linkCode).Where("used_at IS NULL").Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		link := models.SlackLink{TeamID: teamID, SlackUserID: slackUserID, UserID: linkCode.UserID, CreatedAt: now}
+		if err := tx.Save(&link).Error; err != nil {
+			return err
+		}
+		c.Set("userID", linkCode.UserID.String())
+		return recordAudit(tx, c, models.AuditSlackLinked, "user", linkCode.UserID.String(), gin.H{
+			"team_id":       teamID,
+			"slack_user_id": slackUserID,
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		slackReply(c, false, "The code is invalid or has expired; get a new one from your account settings.")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to link Slack user", "error", err)
+		slackReply(c, false, "Something went wrong; please try again.")
+		return
+	}
+	slackReply(c, false, "Your Slack user is linked to your AntiGinx account. Start a scan with `/antiginx scan <url>`.")
+}
+
+// slackUnlink removes the link of the Slack user.
+func (h *ScanHandler) slackUnlink(c *gin.Context, teamID, slackUserID string) {
+	var link models.SlackLink
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&link, "team_id = ? AND slack_user_id = ?", teamID, slackUserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&link).Error; err != nil {
+			return err
+		}
+		c.Set("userID", link.UserID.String())
+		return recordAudit(tx, c, models.AuditSlackUnlinked, "user", link.UserID.String(), gin.H{
+			"team_id":       teamID,
+			"slack_user_id": slackUserID,
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		slackReply(c, false, "Your Slack user isn't linked to an AntiGinx account.")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to unlink Slack user", "error", err)
+		slackReply(c, false, "Something went wrong; please try again.")
+		return
+	}
+	slackReply(c, false, "Your Slack user is no longer linked to your AntiGinx account.")
+}
+
+// slackUser returns the enabled account linked to the Slack user and sets
+// it as the user of the request. Otherwise the reply to the user is
+// returned.
+func (h *ScanHandler) slackUser(c *gin.Context, teamID, slackUserID string) (models.User, string) {
+	var user models.User
+	err := h.db.Joins("JOIN slack_links ON slack_links.user_id = users.id").
+		Where("slack_links.team_id = ? AND slack_links.slack_user_id = ?", teamID, slackUserID).
+		Select("users.id", "users.disabled_at").
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, "Your Slack user isn't linked to an AntiGinx account yet. Get a link code from your account settings and run `/antiginx link <code>`."
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to look up Slack link", "error", err)
+		return user, "Something went wrong; please try again."
+	}
+	if user.DisabledAt != nil {
+		return user, "Your AntiGinx account is disabled."
+	}
+	c.Set("userID", user.ID.String())
+	return user, ""
+}
+
+// slackForm verifies a request of the Slack app and returns its form.
+// Otherwise an error is written and false is returned.
+func (h *ScanHandler) slackForm(c *gin.Context) (url.Values, bool) {
+	if h.cfg.Slack.SigningSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The Slack app is not configured"})
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSlackRequestBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return nil, false
+	}
+	err = slack.Verify(h.cfg.Slack.SigningSecret, c.GetHeader("X-Slack-Request-Timestamp"), c.GetHeader("X-Slack-Signature"), body, time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+		return nil, false
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form body"})
+		return nil, false
+	}
+	return form, true
+}
+
+// slackReply answers a slash command with a message, posted to the channel
+// if inChannel is set and only shown to the user otherwise.
+func slackReply(c *gin.Context, inChannel bool, text string) {
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	c.JSON(http.StatusOK, gin.H{"response_type": responseType, "text": text})
+}
+
+// slackDate formats t for Slack, which shows it in the reader's time zone.
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", t.Unix(), t.UTC().Format(time.RFC1123))
+}
+
+func hashSlackLinkCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/targets"
+	"gorm.io/gorm"
+)
+
+// TargetHandler manages the hosts and wildcard domains users have claimed
+// and their verification (see package targets).
+type TargetHandler struct {
+	db       *gorm.DB
+	verifier *targets.Verifier
+}
+
+type TargetRequest struct {
+	Host string `json:"host" binding:"required,max=253"`
+}
+
+// TargetResponse is a target with the DNS record and, for a single host,
+// the file that verify it; the file holds RecordValue. Hosts is only
+// filled in for a single target.
+type TargetResponse struct {
+	models.Target
+	RecordName  string       `json:"record_name"`
+	RecordValue string       `json:"record_value"`
+	FileURL     string       `json:"file_url,omitempty"`
+	Hosts       []TargetHost `json:"hosts,omitempty"`
+}
+
+// TargetHost is a host scanned under a target; for a wildcard target the
+// hosts form the domain group.
+type TargetHost struct {
+	Host       string    `json:"host"`
+	Scans      int       `json:"scans"`
+	LastScanAt time.Time `json:"last_scan_at"`
+}
+
+func NewTargetHandler(db *gorm.DB, verifier *targets.Verifier) *TargetHandler {
+	return &TargetHandler{
+		db:       db,
+		verifier: verifier,
+	}
+}
+
+func targetResponse(target models.Target) TargetResponse {
+	return TargetResponse{
+		Target:      target,
+		RecordName:  targets.RecordName(target.Host),
+		RecordValue: targets.RecordValue(target.Token),
+		FileURL:     targets.FileURL(target.Host),
+	}
+}
+
+func (h *TargetHandler) HandleListTargets(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	list := make([]models.Target, 0)
+	if err := h.db.Where("user_id = ?", userUUID).Order("host").Find(&list).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list targets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	resp := make([]TargetResponse, 0, len(list))
+	for _, target := range list {
+		resp = append(resp, targetResponse(target))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleCreateTarget claims a host, or "*.domain" for a domain and all of
+// its subdomains. The target has to be verified before it authorizes
+// scans.
+func (h *TargetHandler) HandleCreateTarget(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+	host, err := targets.Normalize(req.Host)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	if err := h.db.Model(&models.Target{}).Where("user_id = ? AND host = ?", userUUID, host).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Target already exists"})
+		return
+	}
+
+	targetID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate ID"})
+		return
+	}
+	token, err := targets.NewToken()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate verification token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target"})
+		return
+	}
+
+	target := models.Target{
+		ID:        targetID,
+		UserID:    userUUID,
+		Host:      host,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.Create(&target).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create target", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target"})
+		return
+	}
+	c.JSON(http.StatusCreated, targetResponse(target))
+}
+
+// HandleGetTarget returns a target with the hosts that were scanned under
+// it.
+func (h *TargetHandler) HandleGetTarget(c *gin.Context) {
+	target, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+
+	var scans []models.PremiumScan
+	if err := h.db.Select("target_url", "created_at").Where("target_id = ?", target.ID).Find(&scans).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load scans of target", "target_id", target.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	byHost := map[string]*TargetHost{}
+	for _, scan := range scans {
+		host := targets.Host(scan.TargetURL)
+		entry, ok := byHost[host]
+		if !ok {
+			entry = &TargetHost{Host: host}
+			byHost[host] = entry
+		}
+		entry.Scans++
+		if scan.CreatedAt.After(entry.LastScanAt) {
+			entry.LastScanAt = scan.CreatedAt
+		}
+	}
+
+	resp := targetResponse(target)
+	for _, entry := range byHost {
+		resp.Hosts = append(resp.Hosts, *entry)
+	}
+	sort.Slice(resp.Hosts, func(i, j int) bool { return resp.Hosts[i].Host < resp.Hosts[j].Host })
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleVerifyTarget checks the target's DNS record, or with ?method=file
+// its verification file, and marks it verified when the record or file is
+// in place.
+func (h *TargetHandler) HandleVerifyTarget(c *gin.Context) {
+	target, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+	if target.VerifiedAt != nil {
+		c.JSON(http.StatusOK, targetResponse(target))
+		return
+	}
+
+	resp := targetResponse(target)
+	method := c.DefaultQuery("method", targets.MethodDNS)
+	var err error
+	switch method {
+	case targets.MethodDNS:
+		err = h.verifier.Verify(c.Request.Context(), target)
+		if errors.Is(err, targets.ErrNotVerified) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":        "Verification record not found; publish a TXT record " + resp.RecordName + " with the value " + resp.RecordValue,
+				"record_name":  resp.RecordName,
+				"record_value": resp.RecordValue,
+			})
+			return
+		}
+	case targets.MethodFile:
+		err = h.verifier.VerifyFile(c.Request.Context(), target)
+		if errors.Is(err, targets.ErrWildcardFile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, targets.ErrNotVerified) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":        "Verification file not found; serve " + resp.FileURL + " containing " + resp.RecordValue,
+				"file_url":     resp.FileURL,
+				"record_value": resp.RecordValue,
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("method must be %q or %q", targets.MethodDNS, targets.MethodFile)})
+		return
+	}
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Target verification lookup failed", "target_id", target.ID, "host", target.Host, "method", method, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Verification lookup failed, try again later"})
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.Model(&target).Updates(map[string]interface{}{"verified_at": now, "verification_method": method}).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to mark target verified", "target_id", target.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	target.VerifiedAt = &now
+	target.VerificationMethod = method
+	slog.InfoContext(c.Request.Context(), "Target verified", "target_id", target.ID, "host", target.Host)
+	c.JSON(http.StatusOK, targetResponse(target))
+}
+
+// HandleDeleteTarget removes a target. Scans made under it are kept but no
+// longer linked to it.
+func (h *TargetHandler) HandleDeleteTarget(c *gin.Context) {
+	target, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PremiumScan{}).Where("target_id = ?", target.ID).Update("target_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&target).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete target", "target_id", target.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete target"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadTarget returns the current user's target from the :id parameter. If
+// it can't be loaded an error response is written and ok is false.
+func (h *TargetHandler) loadTarget(c *gin.Context) (models.Target, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return models.Target{}, false
+	}
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return models.Target{}, false
+	}
+
+	var target models.Target
+	err = h.db.First(&target, "id = ? AND user_id = ?", targetID, userUUID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target not found"})
+		return models.Target{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load target", "target_id", targetID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.Target{}, false
+	}
+	return target, true
+}
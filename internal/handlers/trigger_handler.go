@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Page sizes of the polling triggers.
+const (
+	defaultTriggerLimit = 50
+	MaxTriggerLimit     = 100
+)
+
+// TriggerHandler serves polling triggers for automation platforms such as
+// Zapier and Make, which poll an endpoint every few minutes and start a
+// workflow for every item they haven't seen. Triggers list items with a
+// stable shape, where every field is always present, under an "id" that
+// orders them: UUIDv7 scan event IDs, which grow with time.
+//
+// Without ?since= the newest items are listed first, as Zapier expects;
+// it deduplicates them by id. With ?since=<id> only the items after that
+// one are listed, oldest first, so that clients keeping a cursor page
+// forward through every new item without gaps.
+type TriggerHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewTriggerHandler(db *gorm.DB, cfg *config.Config) *TriggerHandler {
+	return &TriggerHandler{db: db, cfg: cfg}
+}
+
+// TriggerAccount is the account a connection of an automation platform
+// acts as; platforms test connections with it and label them by email.
+type TriggerAccount struct {
+	ID       uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	FullName string    `json:"full_name"`
+}
+
+// TriggerScanEvent is a status change of a scan.
+type TriggerScanEvent struct {
+	// ID is the ID of the scan event.
+	ID         uuid.UUID `json:"id"`
+	ScanID     uuid.UUID `json:"scan_id"`
+	TargetURL  string    `json:"target_url"`
+	Status     string    `json:"status"`
+	FromStatus string    `json:"from_status"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Profile    string    `json:"profile"`
+	// Grade and Score are "" and null until the scan completed.
+	Grade   string   `json:"grade"`
+	Score   *float64 `json:"score"`
+	ScanURL string   `json:"scan_url" gorm:"-"`
+}
+
+// TriggerFinding is a failed test of a completed scan.
+type TriggerFinding struct {
+	// ID is "<event>:<finding>", the ID of the event that completed the
+	// scan and the ID of the finding.
+	ID           string     `json:"id" gorm:"-"`
+	EventID      uuid.UUID  `json:"event_id"`
+	FindingID    uint       `json:"finding_id"`
+	ScanID       uuid.UUID  `json:"scan_id"`
+	TargetURL    string     `json:"target_url"`
+	TestName     string     `json:"test_name"`
+	Severity     string     `json:"severity"`
+	Message      string     `json:"message"`
+	TriageStatus string     `json:"triage_status"`
+	FirstSeenAt  *time.Time `json:"first_seen_at"`
+	DetectedAt   time.Time  `json:"detected_at"`
+	ScanURL      string     `json:"scan_url" gorm:"-"`
+}
+
+// HandleTriggerAccount returns the account of the request, for testing
+// the API key a platform was connected with.
+func (h *TriggerHandler) HandleTriggerAccount(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var account TriggerAccount
+	err := h.db.Model(&models.User{}).Select("id", "email", "full_name").Where("id = ?", userUUID).Take(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// HandleScanEventTrigger lists the status changes of the scans the current
+// user can read. ?status= restricts them to a comma-separated list of the
+// statuses scans changed to, e.g. COMPLETED,FAILED for finished scans.
+func (h *TriggerHandler) HandleScanEventTrigger(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	limit, ok := triggerLimit(c)
+	if !ok {
+		return
+	}
+
+	query := scanAccess(h.db.Table("scan_events").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_events.scan_id AND premium_scans.deleted_at IS NULL"), userUUID)
+	if statuses := splitList(c.Query("status"), strings.ToUpper); len(statuses) > 0 {
+		query = query.Where("scan_events.status IN ?", statuses)
+	}
+	order := "scan_events.id DESC"
+	if raw := c.Query("since"); raw != "" {
+		since, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be the id of a scan event"})
+			return
+		}
+		query = query.Where("scan_events.id > ?", since)
+		order = "scan_events.id"
+	}
+
+	items := make([]TriggerScanEvent, 0)
+	err := query.Select("scan_events.id", "scan_events.scan_id", "premium_scans.target_url", "scan_events.status",
+		"scan_events.from_status", "scan_events.reason", "scan_events.created_at AS occurred_at",
+		"premium_scans.profile", "premium_scans.grade", "premium_scans.score").
+		Order(order).Limit(limit).Scan(&items).Error
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list scan events", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for i := range items {
+		items[i].ScanURL = h.cfg.FrontendLink("/scans/" + items[i].ScanID.String())
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// HandleFindingTrigger lists the failed, unsuppressed tests of the scans
+// the current user can read, as of the last time each scan completed.
+// ?min_severity= leaves out findings less severe than it. Findings of
+// tests the user classified as confidential are never listed.
+func (h *TriggerHandler) HandleFindingTrigger(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	limit, ok := triggerLimit(c)
+	if !ok {
+		return
+	}
+
+	// Scans completed again, e.g. after being requeued, are listed with
+	// the event of their last completion.
+	query := scanAccess(h.db.Table("scan_results").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id AND premium_scans.deleted_at IS NULL").
+		Joins("JOIN scan_events ON scan_events.scan_id = scan_results.scan_id AND scan_events.status = ?", "COMPLETED"), userUUID).
+		Where("NOT EXISTS (SELECT 1 FROM scan_events later WHERE later.scan_id = scan_events.scan_id AND later.status = ? AND later.id > scan_events.id)", "COMPLETED").
+		Where("scan_results.deleted_at IS NULL AND NOT scan_results.passed AND scan_results.triage_status <> ?", models.TriageSuppressed)
+	if raw := c.Query("min_severity"); raw != "" {
+		rank, known := models.SeverityRanks[strings.ToLower(raw)]
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_severity must be critical, high, medium, low, info or none"})
+			return
+		}
+		query = query.Where("scan_results.severity_rank >= ?", rank)
+	}
+	outbound, err := classification.For(h.db, userUUID, classification.ChannelTrigger, false)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load data classification", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	query = outbound.Scope(query, "scan_results.test_name")
+	order := "scan_events.id DESC, scan_results.id DESC"
+	if raw := c.Query("since"); raw != "" {
+		// since is a finding's id, or a scan event's to start after all
+		// of its findings.
+		event, finding, found := strings.Cut(raw, ":")
+		eventID, err := uuid.Parse(event)
+		var findingID uint64
+		if err == nil && found {
+			findingID, err = strconv.ParseUint(finding, 10, 0)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be the id of a finding or scan event"})
+			return
+		}
+		if found {
+			query = query.Where("scan_events.id > ? OR (scan_events.id = ? AND scan_results.id > ?)", eventID, eventID, findingID)
+		} else {
+			query = query.Where("scan_events.id > ?", eventID)
+		}
+		order = "scan_events.id, scan_results.id"
+	}
+
+	items := make([]TriggerFinding, 0)
+	err = query.Select("scan_events.id AS event_id", "scan_results.id AS finding_id", "scan_results.scan_id",
+		"premium_scans.target_url", "scan_results.test_name", "scan_results.severity", "scan_results.message",
+		"scan_results.triage_status", "scan_results.first_seen_at", "scan_events.created_at AS detected_at").
+		Order(order).Limit(limit).Scan(&items).Error
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list findings", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for i := range items {
+		items[i].ID = items[i].EventID.String() + ":" + strconv.FormatUint(uint64(items[i].FindingID), 10)
+		items[i].ScanURL = h.cfg.FrontendLink("/scans/" + items[i].ScanID.String())
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// triggerLimit parses ?limit=, writing a 400 response if it is invalid.
+func triggerLimit(c *gin.Context) (int, bool) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultTriggerLimit, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > MaxTriggerLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(MaxTriggerLimit)})
+		return 0, false
+	}
+	return limit, true
+}
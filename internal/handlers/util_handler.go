@@ -4,8 +4,57 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/validation"
 )
 
 func (h *ScanHandler) HandleAvailableScans(c *gin.Context) {
 	c.JSON(http.StatusOK, CategorizedTests)
 }
+
+// currentUserID returns the ID of the user authenticated by
+// middleware.RequireAuth. If it is missing or malformed an error response
+// is written and ok is false.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDContext, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Access not authorized"})
+		return uuid.Nil, false
+	}
+
+	userIDStr, ok := userIDContext.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return uuid.Nil, false
+	}
+
+	userUUID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format in token"})
+		return uuid.Nil, false
+	}
+
+	return userUUID, true
+}
+
+// uploadAllowed reports whether the worker may submit for the scan. Workers
+// authenticated with an upload token may only submit for the token's scan;
+// otherwise a 403 response is written.
+func uploadAllowed(c *gin.Context, scanUUID uuid.UUID) bool {
+	if tokenScan := c.GetString("uploadScanID"); tokenScan != "" && tokenScan != scanUUID.String() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Upload token is not valid for this scan"})
+		return false
+	}
+	return true
+}
+
+// respondBindingError writes the 400 response of a request body that
+// failed to bind. Validation and type errors list the offending fields,
+// with messages in the reader's language (see requestLanguages).
+func respondBindingError(c *gin.Context, err error) {
+	if fields := validation.Fields(err, requestLanguages(c)); fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
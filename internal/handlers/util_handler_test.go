@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestUploadAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	otherScanID := uuid.MustParse("0190a3b2-9d8e-7f6a-8b5c-4d3e2f1a0b9c")
+
+	tests := []struct {
+		name        string
+		uploadScan  string
+		scan        uuid.UUID
+		wantAllowed bool
+	}{
+		{"token of the scan", scanID.String(), scanID, true},
+		{"token of another scan", otherScanID.String(), scanID, false},
+		{"API key", "", scanID, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.uploadScan != "" {
+				c.Set("uploadScanID", tt.uploadScan)
+			}
+
+			if got := uploadAllowed(c, tt.scan); got != tt.wantAllowed {
+				t.Fatalf("uploadAllowed() = %v, want %v", got, tt.wantAllowed)
+			}
+			if !tt.wantAllowed && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
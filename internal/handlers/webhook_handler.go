@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	db         *gorm.DB
+	dispatcher *webhooks.Dispatcher
+}
+
+// CreateWebhookRequest registers a webhook. AllowConfidential clears it to
+// receive findings classified as confidential.
+type CreateWebhookRequest struct {
+	URL               string   `json:"url" binding:"required,url"`
+	Events            []string `json:"events" binding:"required,min=1"`
+	AllowConfidential bool     `json:"allow_confidential"`
+}
+
+// UpdateWebhookRequest changes the given fields of a webhook.
+type UpdateWebhookRequest struct {
+	URL               *string  `json:"url" binding:"omitempty,url"`
+	Events            []string `json:"events" binding:"omitempty,min=1"`
+	Active            *bool    `json:"active"`
+	AllowConfidential *bool    `json:"allow_confidential"`
+}
+
+// RotateWebhookSecretRequest sets how long the old secret stays valid.
+type RotateWebhookSecretRequest struct {
+	GracePeriodHours *int `json:"grace_period_hours" binding:"omitempty,min=0,max=168"`
+}
+
+// DefaultSecretGracePeriod is how long deliveries are also signed with the
+// old secret after a rotation, unless the request sets another period.
+const DefaultSecretGracePeriod = 24 * time.Hour
+
+func NewWebhookHandler(db *gorm.DB, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		db:         db,
+		dispatcher: dispatcher,
+	}
+}
+
+// HandleCreateWebhook registers a webhook. The signing secret is returned
+// only in this response.
+func (h *WebhookHandler) HandleCreateWebhook(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	if !validWebhookURL(c, req.URL) || !validWebhookEvents(c, req.Events) {
+		return
+	}
+
+	webhookID, err := uuid.NewV7()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UUIDv7", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook ID"})
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate webhook secret", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+		return
+	}
+
+	hook := models.Webhook{
+		ID:        webhookID,
+		UserID:    userUUID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    datatypes.NewJSONSlice(req.Events),
+		Active:    true,
+		CreatedAt: time.Now(),
+
+		AllowConfidential: req.AllowConfidential,
+	}
+	if err := h.db.Create(&hook).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook":   hook,
+		"secret":    hook.Secret,
+		"secret_id": webhooks.KeyID(hook.Secret),
+	})
+}
+
+// HandleRotateWebhookSecret replaces the signing secret of a webhook. The
+// old secret remains valid for the grace period: until it ends deliveries
+// carry a signature for each secret. Rotating again during a grace period
+// retires the oldest secret immediately. The new secret is returned only in
+// this response.
+func (h *WebhookHandler) HandleRotateWebhookSecret(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req RotateWebhookSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindingError(c, err)
+		return
+	}
+	grace := DefaultSecretGracePeriod
+	if req.GracePeriodHours != nil {
+		grace = time.Duration(*req.GracePeriodHours) * time.Hour
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to generate webhook secret", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+		return
+	}
+
+	now := time.Now()
+	hook.PreviousSecret = ""
+	hook.PreviousSecretExpiresAt = nil
+	if grace > 0 {
+		expires := now.Add(grace)
+		hook.PreviousSecret = hook.Secret
+		hook.PreviousSecretExpiresAt = &expires
+	}
+	hook.Secret = secret
+	hook.SecretRotatedAt = &now
+
+	err = h.db.Model(&hook).Select("secret", "previous_secret", "previous_secret_expires_at", "secret_rotated_at").Updates(&hook).Error
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to rotate secret of webhook", "webhook_id", hook.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	resp := gin.H{
+		"webhook":   hook,
+		"secret":    hook.Secret,
+		"secret_id": webhooks.KeyID(hook.Secret),
+	}
+	if hook.PreviousSecret != "" {
+		resp["previous_secret_id"] = webhooks.KeyID(hook.PreviousSecret)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *WebhookHandler) HandleListWebhooks(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var hooks []models.Webhook
+	if err := h.db.Where("user_id = ?", userUUID).Order("created_at desc").Find(&hooks).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list webhooks", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+func (h *WebhookHandler) HandleGetWebhook(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// HandleUpdateWebhook changes the URL, events, active flag or
+// confidential-data clearance of a webhook.
+// Deactivated webhooks receive no events and their pending retries are
+// dropped.
+func (h *WebhookHandler) HandleUpdateWebhook(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindingError(c, err)
+		return
+	}
+
+	if req.URL != nil {
+		if !validWebhookURL(c, *req.URL) {
+			return
+		}
+		hook.URL = *req.URL
+	}
+	if req.Events != nil {
+		if !validWebhookEvents(c, req.Events) {
+			return
+		}
+		hook.Events = datatypes.NewJSONSlice(req.Events)
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if req.AllowConfidential != nil {
+		hook.AllowConfidential = *req.AllowConfidential
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&hook).Error; err != nil {
+			return err
+		}
+		if hook.Active {
+			return nil
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND next_retry_at IS NOT NULL", hook.ID).
+			Update("next_retry_at", nil).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update webhook", "webhook_id", hook.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+func (h *WebhookHandler) HandleDeleteWebhook(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&hook).Error
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// HandleListDeliveries returns the delivery log of a webhook, newest first.
+// Supports ?limit= (default 50, max 200) and ?before=<deliveryId> paging.
+func (h *WebhookHandler) HandleListDeliveries(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return
+	}
+
+	query := h.db.Where("webhook_id = ?", hook.ID)
+	if before := c.Query("before"); before != "" {
+		beforeUUID, err := uuid.Parse(before)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID format"})
+			return
+		}
+		query = query.Where("id < ?", beforeUUID)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id desc").Limit(limit).Find(&deliveries).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list webhook deliveries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// HandleRedeliver sends a logged delivery's payload again and returns the
+// new delivery record.
+func (h *WebhookHandler) HandleRedeliver(c *gin.Context) {
+	hook, ok := h.ownedWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveryUUID, err := uuid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID format"})
+		return
+	}
+
+	var previous models.WebhookDelivery
+	if err := h.db.First(&previous, "id = ? AND webhook_id = ?", deliveryUUID, hook.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	delivery, err := h.dispatcher.Redeliver(c.Request.Context(), hook, previous)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record redelivery", "delivery_id", previous.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+func validWebhookURL(c *gin.Context, raw string) bool {
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must use http or https"})
+		return false
+	}
+	return true
+}
+
+func validWebhookEvents(c *gin.Context, events []string) bool {
+	for _, event := range events {
+		if !slices.Contains(webhooks.SupportedEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported event: " + event, "supported_events": webhooks.SupportedEvents})
+			return false
+		}
+	}
+	return true
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ownedWebhook loads the webhook from the :id path parameter, making sure it
+// belongs to the current user.
+func (h *WebhookHandler) ownedWebhook(c *gin.Context) (models.Webhook, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return models.Webhook{}, false
+	}
+
+	webhookUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+		return models.Webhook{}, false
+	}
+
+	var hook models.Webhook
+	if err := h.db.First(&hook, "id = ? AND user_id = ?", webhookUUID, userUUID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return models.Webhook{}, false
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to retrieve webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return models.Webhook{}, false
+	}
+
+	return hook, true
+}
@@ -0,0 +1,108 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a connection to a disallowed address
+// is attempted.
+var ErrBlockedAddress = errors.New("connection to non-public address blocked by egress policy")
+
+// nonPublicPrefixes are the special-purpose IPv4 ranges (RFC 6890) that
+// the netip predicates don't cover.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+}
+
+// IPv6 prefixes that embed an IPv4 address, which is the address actually
+// reached through them.
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// IsPublicAddr reports whether the address is routable on the public
+// internet and therefore allowed by the egress policy. NAT64 and 6to4
+// addresses are judged by the IPv4 address they embed.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Is6() {
+		b := addr.As16()
+		switch {
+		case nat64Prefix.Contains(addr):
+			return IsPublicAddr(netip.AddrFrom4([4]byte(b[12:16])))
+		case sixToFour.Contains(addr):
+			return IsPublicAddr(netip.AddrFrom4([4]byte(b[2:6])))
+		}
+	}
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDialer returns a dialer that, unless allowPrivate is set, checks every
+// resolved address right before connecting. Checking at connect time (not
+// when the URL is parsed) also defeats DNS rebinding.
+func NewDialer(allowPrivate bool) *net.Dialer {
+	d := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if allowPrivate {
+		return d
+	}
+
+	d.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+		}
+		if !IsPublicAddr(addr) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+		}
+		return nil
+	}
+	return d
+}
+
+// NewTransport returns an HTTP transport using the egress-checking dialer.
+// Environment proxies are ignored, as a proxy would bypass the check.
+func NewTransport(allowPrivate bool) *http.Transport {
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           NewDialer(allowPrivate).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
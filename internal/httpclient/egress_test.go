@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		// Public.
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"192.0.1.1", true},
+		{"198.17.255.255", true},
+		{"198.20.0.0", true},
+		{"223.255.255.255", true},
+		{"2606:4700:4700::1111", true},
+		{"::ffff:93.184.216.34", true},
+
+		// Special-purpose IPv4.
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.0.0.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"192.0.0.1", false},
+		{"192.0.0.170", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+
+		// Special-purpose IPv6.
+		{"::", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd12:3456:789a::1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+
+		// NAT64 and 6to4 are judged by the embedded IPv4 address.
+		{"64:ff9b::5db8:d822", true},
+		{"64:ff9b::93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::169.254.169.254", false},
+		{"64:ff9b::10.0.0.1", false},
+		{"64:ff9b::c612:1", false},
+		{"2002:5db8:d822::1", true},
+		{"2002:7f00:1::", false},
+		{"2002:a9fe:a9fe::1", false},
+		{"2002:c0a8:101:1::1", false},
+		{"2002:6440:1::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+
+	if IsPublicAddr(netip.Addr{}) {
+		t.Errorf("IsPublicAddr(invalid address) = true, want false")
+	}
+}
@@ -0,0 +1,266 @@
+// Package httpclient provides the outbound HTTP client used for every
+// request the service makes to third-party or user-supplied URLs
+// (webhooks, integrations, verification flows, checks).
+//
+// The client applies timeouts, retries transient failures with exponential
+// backoff, opens a per-host circuit breaker after repeated failures and, by
+// default, refuses to connect to loopback, private and link-local addresses
+// so user-supplied URLs cannot be used to reach internal services (SSRF).
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker for the request's host
+// is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open for host")
+
+// Config controls the client's behaviour.
+type Config struct {
+	// Timeout bounds a single attempt, including reading the body; zero
+	// disables it.
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry; it doubles on every
+	// further retry up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BreakerThreshold is the number of consecutive failures to a host that
+	// opens its circuit; zero disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit rejects requests before a
+	// single trial request is let through.
+	BreakerCooldown time.Duration
+	// AllowPrivateNetworks disables the egress policy. Only meant for local
+	// development against services on the same machine.
+	AllowPrivateNetworks bool
+}
+
+// DefaultConfig returns conservative defaults for calls to external services.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          10 * time.Second,
+		MaxRetries:       3,
+		BaseBackoff:      500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	base http.RoundTripper
+	http *http.Client
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// New creates a client with the given configuration.
+func New(cfg Config) *Client {
+	c := &Client{
+		cfg:      cfg,
+		base:     NewTransport(cfg.AllowPrivateNetworks),
+		breakers: map[string]*breaker{},
+	}
+	c.http = &http.Client{Transport: c}
+	return c
+}
+
+// HTTPClient returns an *http.Client for libraries that take one. Its
+// requests go through the same timeouts, retries and circuit breaker as Do.
+func (c *Client) HTTPClient() *http.Client {
+	return c.http
+}
+
+// Do sends the request, following redirects. See RoundTrip for what is
+// retried.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.http.Do(req)
+}
+
+// RoundTrip implements http.RoundTripper. It sends a single request,
+// retrying network errors, 429 and 5xx responses. Requests with a body are
+// only retried when req.GetBody is set (which http.NewRequest does for
+// in-memory bodies), since the body can't be sent again otherwise.
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	br := c.breaker(req.URL.Host)
+	if !br.allow(c.cfg) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+
+	retries := c.cfg.MaxRetries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				br.record(c.cfg, false)
+				return nil, bodyErr
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err = c.attempt(r)
+		if !retryable(resp, err) {
+			break
+		}
+		if attempt >= retries || errors.Is(err, ErrBlockedAddress) {
+			break
+		}
+
+		delay := c.backoff(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			br.record(c.cfg, false)
+			return nil, req.Context().Err()
+		}
+	}
+
+	br.record(c.cfg, !retryable(resp, err))
+	return resp, err
+}
+
+// attempt sends the request once, bounded by the configured timeout until
+// its body is closed.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if c.cfg.Timeout <= 0 {
+		return c.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.cfg.Timeout)
+	resp, err := c.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of an attempt when its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrBlockedAddress)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns the delay before the next attempt: the server's
+// Retry-After if present, otherwise exponential backoff with jitter.
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			d := time.Duration(secs) * time.Second
+			if c.cfg.MaxBackoff > 0 && d > c.cfg.MaxBackoff {
+				d = c.cfg.MaxBackoff
+			}
+			return d
+		}
+	}
+
+	d := c.cfg.BaseBackoff << attempt
+	if c.cfg.MaxBackoff > 0 && (d > c.cfg.MaxBackoff || d <= 0) {
+		d = c.cfg.MaxBackoff
+	}
+	// Full jitter in [d/2, d) spreads out retries from concurrent callers.
+	if d > 1 {
+		d = d/2 + rand.N(d/2)
+	}
+	return d
+}
+
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{}
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// breaker is a consecutive-failure circuit breaker for a single host.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) allow(cfg Config) bool {
+	if cfg.BreakerThreshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < cfg.BreakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	// Half-open: let exactly one request through to probe the host.
+	b.trial = true
+	return true
+}
+
+func (b *breaker) record(cfg Config, success bool) {
+	if cfg.BreakerThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= cfg.BreakerThreshold {
+		b.openUntil = time.Now().Add(cfg.BreakerCooldown)
+	}
+}
@@ -0,0 +1,263 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig retries quickly and reaches the test servers on loopback.
+func testConfig() Config {
+	return Config{
+		Timeout:              time.Second,
+		MaxRetries:           3,
+		BaseBackoff:          time.Millisecond,
+		MaxBackoff:           5 * time.Millisecond,
+		AllowPrivateNetworks: true,
+	}
+}
+
+// scriptedServer answers the n-th request with statuses[n], repeating the
+// last status, and counts the requests and the bodies they carried.
+func scriptedServer(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *atomic.Int32, *[]string) {
+	t.Helper()
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statuses[min(n, len(statuses)-1)])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls, &bodies
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		headers    http.Header
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"success", []int{200}, nil, 200, 1},
+		{"server error then success", []int{500, 502, 200}, nil, 200, 3},
+		{"too many requests with Retry-After", []int{429, 200}, http.Header{"Retry-After": {"0"}}, 200, 2},
+		{"gives up after MaxRetries", []int{503}, nil, 503, 4},
+		{"client error", []int{404, 200}, nil, 404, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls, bodies := scriptedServer(t, tt.headers, tt.statuses...)
+			c := New(testConfig())
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || calls.Load() != tt.wantCalls {
+				t.Errorf("Do() = %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tt.wantStatus, tt.wantCalls)
+			}
+			for i, body := range *bodies {
+				if body != "payload" {
+					t.Errorf("attempt %d sent body %q, want the full payload", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestClientDoesNotRetryUnreplayableBody(t *testing.T) {
+	srv, calls, _ := scriptedServer(t, nil, 500, 200)
+	c := New(testConfig())
+
+	// A body without GetBody can only be read once.
+	req, err := http.NewRequest(http.MethodPost, srv.URL, io.NopCloser(bytes.NewReader([]byte("payload"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.GetBody != nil {
+		t.Fatal("test request unexpectedly has GetBody")
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 || calls.Load() != 1 {
+		t.Errorf("Do() = %d after %d calls, want the first 500 without retrying", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	srv, calls, _ := scriptedServer(t, nil, 500, 200)
+	resp, err := New(testConfig()).HTTPClient().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || calls.Load() != 2 {
+		t.Errorf("Get() = %d after %d calls, want 200 after 2", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestClientBlocksPrivateAddresses(t *testing.T) {
+	srv, calls, _ := scriptedServer(t, nil, 200)
+	cfg := testConfig()
+	cfg.AllowPrivateNetworks = false
+
+	_, err := New(cfg).HTTPClient().Get(srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Get() error = %v, want ErrBlockedAddress", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("server received %d calls", calls.Load())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := New(Config{BaseBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second})
+	retryAfter := func(v string) *http.Response {
+		return &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {v}}}
+	}
+
+	tests := []struct {
+		name     string
+		attempt  int
+		resp     *http.Response
+		min, max time.Duration
+	}{
+		{"first retry", 0, nil, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"third retry", 2, nil, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", 20, nil, 5 * time.Second, 10 * time.Second},
+		{"overflow", 62, nil, 5 * time.Second, 10 * time.Second},
+		{"Retry-After", 0, retryAfter("3"), 3 * time.Second, 3 * time.Second},
+		{"Retry-After capped", 0, retryAfter("3600"), 10 * time.Second, 10 * time.Second},
+		{"Retry-After not seconds", 0, retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"), 50 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := c.backoff(tt.attempt, tt.resp); d < tt.min || d > tt.max {
+				t.Errorf("backoff() = %s, want between %s and %s", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	srv, calls, _ := scriptedServer(t, nil, 500, 500, 200)
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = 50 * time.Millisecond
+	c := New(cfg)
+
+	get := func() (int, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if status, err := get(); err != nil || status != 500 {
+			t.Fatalf("call %d = %d, %v, want 500", i+1, status, err)
+		}
+	}
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("call after %d failures error = %v, want ErrCircuitOpen", cfg.BreakerThreshold, err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("server received %d calls while the circuit was open, want 2", calls.Load())
+	}
+
+	// After the cooldown a trial request closes the circuit again.
+	time.Sleep(cfg.BreakerCooldown + 10*time.Millisecond)
+	if status, err := get(); err != nil || status != 200 {
+		t.Fatalf("trial call = %d, %v, want 200", status, err)
+	}
+	if status, err := get(); err != nil || status != 200 {
+		t.Fatalf("call after recovery = %d, %v, want 200", status, err)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	cfg := Config{BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	b := &breaker{}
+
+	b.record(cfg, false)
+	if !b.allow(cfg) {
+		t.Fatal("breaker opened before reaching the threshold")
+	}
+	b.record(cfg, false)
+	if b.allow(cfg) {
+		t.Fatal("breaker allows requests while open")
+	}
+
+	// Once the cooldown is over only a single trial request goes through.
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow(cfg) {
+		t.Fatal("breaker rejects the trial request after the cooldown")
+	}
+	if b.allow(cfg) {
+		t.Fatal("breaker allows a second request while the trial is running")
+	}
+
+	// A failed trial opens the circuit for another cooldown.
+	b.record(cfg, false)
+	if b.allow(cfg) {
+		t.Fatal("breaker allows requests after a failed trial")
+	}
+
+	// A successful trial closes it.
+	b.openUntil = time.Now().Add(-time.Second)
+	b.allow(cfg)
+	b.record(cfg, true)
+	for i := 0; i < 3; i++ {
+		if !b.allow(cfg) {
+			t.Fatal("breaker rejects requests after a successful trial")
+		}
+	}
+}
+
+func TestBreakerIsPerHost(t *testing.T) {
+	failing, _, _ := scriptedServer(t, nil, 500)
+	healthy, _, _ := scriptedServer(t, nil, 200)
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Hour
+	c := New(cfg)
+
+	resp, err := c.HTTPClient().Get(failing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, err := c.HTTPClient().Get(failing.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("failing host error = %v, want ErrCircuitOpen", err)
+	}
+	resp, err = c.HTTPClient().Get(healthy.URL)
+	if err != nil {
+		t.Fatalf("healthy host error = %v", err)
+	}
+	resp.Body.Close()
+}
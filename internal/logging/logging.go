@@ -0,0 +1,126 @@
+// Package logging configures the process-wide slog logger and attaches
+// request fields to log lines.
+//
+// A request's context carries its request ID and, once known, the
+// authenticated user and the scan it concerns. Every line logged with that
+// context (slog.InfoContext and friends) includes them as request_id,
+// user_id and scan_id.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+type fields struct {
+	mu        sync.Mutex
+	requestID string
+	userID    string
+	scanID    string
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries the request ID and accepts
+// the user and scan IDs set later with SetUserID and SetScanID.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &fields{requestID: requestID})
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	f, _ := ctx.Value(contextKey{}).(*fields)
+	if f == nil {
+		return ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requestID
+}
+
+// SetUserID records the authenticated user of the request. It does nothing
+// if ctx wasn't created by NewContext.
+func SetUserID(ctx context.Context, userID string) {
+	if f, _ := ctx.Value(contextKey{}).(*fields); f != nil {
+		f.mu.Lock()
+		f.userID = userID
+		f.mu.Unlock()
+	}
+}
+
+// SetScanID records the scan the request concerns. It does nothing if ctx
+// wasn't created by NewContext.
+func SetScanID(ctx context.Context, scanID string) {
+	if f, _ := ctx.Value(contextKey{}).(*fields); f != nil {
+		f.mu.Lock()
+		f.scanID = scanID
+		f.mu.Unlock()
+	}
+}
+
+// contextHandler adds the request fields of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request fields to r. Fields the record already has, such
+// as an explicit scan_id, are not repeated.
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	f, _ := ctx.Value(contextKey{}).(*fields)
+	if f == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	present := map[string]bool{}
+	r.Attrs(func(a slog.Attr) bool {
+		present[a.Key] = true
+		return true
+	})
+	add := func(key, value string) {
+		if value != "" && !present[key] {
+			r.AddAttrs(slog.String(key, value))
+		}
+	}
+
+	f.mu.Lock()
+	add("request_id", f.requestID)
+	add("user_id", f.userID)
+	add("scan_id", f.scanID)
+	f.mu.Unlock()
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Setup installs the default logger. LOG_FORMAT selects "json" or "text"
+// (the default) output and LOG_LEVEL the minimum level ("debug", "info",
+// "warn" or "error"; default "info").
+func Setup() {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
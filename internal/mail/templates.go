@@ -0,0 +1,276 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Template names of all emails sent by the service.
+const (
+	TemplateVerification     = "verification"
+	TemplatePasswordReset    = "password_reset"
+	TemplateDigest           = "digest"
+	TemplateReport           = "report"
+	TemplateExecutiveSummary = "executive_summary"
+	TemplateApprovalRequest  = "approval_request"
+
+	TemplateOrganizationInvitation = "organization_invitation"
+	TemplateLoginConfirmation      = "login_confirmation"
+	TemplateNewLogin               = "new_login"
+	TemplateStorageQuotaWarning    = "storage_quota_warning"
+)
+
+// OrganizationTemplates are the templates of the emails sent on behalf of
+// an organization, which its owners may override.
+var OrganizationTemplates = []string{TemplateOrganizationInvitation, TemplateStorageQuotaWarning}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// ErrUnknownTemplate is returned for template names without a default.
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// SampleData returns example data for every template, used by previews.
+func SampleData() map[string]interface{} {
+	expires := time.Now().Add(time.Hour).Format(time.RFC1123)
+	return map[string]interface{}{
+		TemplateVerification: map[string]interface{}{
+			"Name":      "Jan Kowalski",
+			"Link":      "https://antiginx.example/verify?token=sample",
+			"ExpiresAt": expires,
+		},
+		TemplatePasswordReset: map[string]interface{}{
+			"Name":      "Jan Kowalski",
+			"Link":      "https://antiginx.example/reset-password?token=sample",
+			"ExpiresAt": expires,
+		},
+		TemplateDigest: map[string]interface{}{
+			"Name":   "Jan Kowalski",
+			"Since":  time.Now().Add(-24 * time.Hour).Format(time.RFC1123),
+			"Events": []string{"Scan of https://example.com completed with grade B", "2 new high severity findings"},
+			"Link":   "https://antiginx.example/dashboard",
+		},
+		TemplateReport: map[string]interface{}{
+			"Name":        "Jan Kowalski",
+			"TargetURL":   "https://example.com",
+			"Score":       82.5,
+			"Grade":       "B",
+			"FailedTests": 3,
+			"Link":        "https://antiginx.example/reports/sample.pdf",
+		},
+		TemplateExecutiveSummary: map[string]interface{}{
+			"Name":         "Jan Kowalski",
+			"From":         time.Now().AddDate(0, 0, -30).Format(time.DateOnly),
+			"To":           time.Now().Format(time.DateOnly),
+			"Scans":        42,
+			"AverageScore": "78.4",
+			"Fixed":        12,
+			"Link":         "https://antiginx.example/reports/summary.pdf",
+		},
+		TemplateApprovalRequest: map[string]interface{}{
+			"Name":      "Jan Kowalski",
+			"Requester": "anna@example.com",
+			"TargetURL": "https://shop.example.com",
+			"Tests":     "https, hsts, csp",
+			"Link":      "https://antiginx.example/scans/sample",
+		},
+		TemplateOrganizationInvitation: map[string]interface{}{
+			"Inviter":      "anna@example.com",
+			"Organization": "Example Security Team",
+			"Role":         "member",
+			"Link":         "https://antiginx.example/invitations/accept?token=sample",
+			"ExpiresAt":    expires,
+		},
+		TemplateLoginConfirmation: map[string]interface{}{
+			"Name":      "Jan Kowalski",
+			"Code":      "482913",
+			"Device":    "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Firefox/131.0",
+			"IP":        "203.0.113.7",
+			"Location":  "PL",
+			"ExpiresAt": expires,
+		},
+		TemplateNewLogin: map[string]interface{}{
+			"Name":     "Jan Kowalski",
+			"Device":   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Firefox/131.0",
+			"IP":       "203.0.113.7",
+			"Location": "PL",
+			"Time":     time.Now().Format(time.RFC1123),
+			"Link":     "https://antiginx.example/settings/sessions",
+		},
+		TemplateStorageQuotaWarning: map[string]interface{}{
+			"Name":            "Jan Kowalski",
+			"Organization":    "Example Security Team",
+			"Plan":            "free",
+			"Results":         "112480",
+			"ResultsLimit":    "100000",
+			"ArtifactMB":      "980",
+			"ArtifactMBLimit": "1024",
+			"PurgeAfter":      time.Now().Add(7 * 24 * time.Hour).Format(time.RFC1123),
+			"Link":            "https://antiginx.example/organizations/sample",
+		},
+	}
+}
+
+// Names returns the names of all built-in templates.
+func Names() []string {
+	entries, _ := defaultTemplates.ReadDir("templates")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".tmpl"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultSource returns the source of a built-in template.
+func DefaultSource(name string) (string, error) {
+	src, err := defaultTemplates.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", ErrUnknownTemplate
+	}
+	return string(src), nil
+}
+
+// Validate parses a template source and checks it defines the subject,
+// text and html blocks.
+func Validate(source string) error {
+	_, _, err := parse(source)
+	return err
+}
+
+func parse(source string) (*texttemplate.Template, *htmltemplate.Template, error) {
+	text, err := texttemplate.New("email").Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	html, err := htmltemplate.New("email").Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, block := range []string{"subject", "text", "html"} {
+		if text.Lookup(block) == nil {
+			return nil, nil, fmt.Errorf("template must define a %q block", block)
+		}
+	}
+	return text, html, nil
+}
+
+// RenderSource renders a template source with the given data.
+func RenderSource(source, to string, data interface{}) (Message, error) {
+	text, html, err := parse(source)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, plain, rich bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&plain, "text", data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&rich, "html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(plain.String()),
+		HTML:    strings.TrimSpace(rich.String()),
+	}, nil
+}
+
+// Renderer renders templates, preferring overrides stored in the database
+// over the built-in defaults.
+type Renderer struct {
+	db *gorm.DB
+}
+
+func NewRenderer(db *gorm.DB) *Renderer {
+	return &Renderer{db: db}
+}
+
+// Source returns the effective source of a template and whether it comes
+// from a database override.
+func (r *Renderer) Source(name string) (string, bool, error) {
+	def, err := DefaultSource(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	var override models.EmailTemplate
+	err = r.db.Where("name = ?", name).First(&override).Error
+	if err == nil {
+		return override.Source, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, err
+	}
+	return def, false, nil
+}
+
+// OrganizationSource returns the effective source of a template for the
+// emails of an organization and whether it comes from the organization's
+// override; without one it is the Source.
+func (r *Renderer) OrganizationSource(orgID uuid.UUID, name string) (string, bool, error) {
+	if !slices.Contains(OrganizationTemplates, name) {
+		return "", false, ErrUnknownTemplate
+	}
+
+	var override models.OrganizationEmailTemplate
+	err := r.db.Where("organization_id = ? AND name = ?", orgID, name).First(&override).Error
+	if err == nil {
+		return override.Source, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, err
+	}
+	source, _, err := r.Source(name)
+	return source, false, err
+}
+
+// Render renders the named template for the given recipient.
+func (r *Renderer) Render(name, to string, data interface{}) (Message, error) {
+	source, _, err := r.Source(name)
+	if err != nil {
+		return Message{}, err
+	}
+	return RenderSource(source, to, data)
+}
+
+// Send renders the named template and delivers it with the mailer.
+func (r *Renderer) Send(ctx context.Context, mailer Mailer, name, to string, data interface{}) error {
+	msg, err := r.Render(name, to, data)
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", name, err)
+	}
+	return mailer.Send(ctx, msg)
+}
+
+// SendForOrganization renders the named template with the organization's
+// override and delivers it with the mailer.
+func (r *Renderer) SendForOrganization(ctx context.Context, mailer Mailer, orgID uuid.UUID, name, to string, data interface{}) error {
+	source, _, err := r.OrganizationSource(orgID, name)
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", name, err)
+	}
+	msg, err := RenderSource(source, to, data)
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", name, err)
+	}
+	return mailer.Send(ctx, msg)
+}
@@ -0,0 +1,78 @@
+// Package mockworker is a stand-in for the scanning engine during local
+// development. It runs scan tasks on a scanner.Worker whose engine
+// fabricates plausible results after a short delay, so they are submitted
+// to the results endpoint exactly like a real worker's. Scans therefore go
+// through their whole lifecycle (RUNNING, progress events, COMPLETED,
+// scoring, webhooks) without the scanner running.
+//
+// Results are derived from the scan and test IDs, so replaying a task
+// produces the same findings.
+package mockworker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/scanner"
+)
+
+// Config configures the mock worker.
+type Config struct {
+	// APIURL is the base URL results are submitted to.
+	APIURL string
+	// Delay is the pause before each result, simulating test run time.
+	Delay time.Duration
+	// SigningSecret signs submissions when the API requires it (see
+	// middleware.RequireSignature).
+	SigningSecret string
+	// Results, when set, receives results instead of the results
+	// endpoint (see scanner.WorkerConfig).
+	Results scanner.Publisher
+}
+
+// New returns a worker answering scan tasks with fabricated results.
+func New(cfg Config) *scanner.Worker {
+	engine := func(ctx context.Context, scanID, _, test string) scanner.Result {
+		select {
+		case <-ctx.Done():
+		case <-time.After(cfg.Delay):
+		}
+		return fabricate(scanID, test)
+	}
+	return scanner.NewWorker(scanner.WorkerConfig{APIURL: cfg.APIURL, SigningSecret: cfg.SigningSecret, Results: cfg.Results}, engine)
+}
+
+// outcomes are the threat levels a fabricated result can have, each listed
+// as often as it should occur; most tests pass.
+var outcomes = []string{
+	"None", "None", "None", "None", "None", "None", "None", "None", "None", "None",
+	"Info", "Info",
+	"Low", "Low", "Low",
+	"Medium", "Medium",
+	"High",
+	"Critical",
+}
+
+// fabricate returns the mock result of a test, derived from the scan and
+// test IDs.
+func fabricate(scanID, test string) scanner.Result {
+	h := fnv.New64a()
+	h.Write([]byte(scanID + "/" + test))
+	sum := h.Sum64()
+
+	level := outcomes[sum%uint64(len(outcomes))]
+	description := fmt.Sprintf("Mock %s check passed", test)
+	if level != scanner.ThreatNone && level != scanner.ThreatInfo {
+		description = fmt.Sprintf("Mock %s check found a %s severity issue", test, strings.ToLower(level))
+	}
+	return scanner.Result{
+		Name:        test,
+		Certainty:   70 + int((sum>>8)%31),
+		ThreatLevel: level,
+		Metadata:    map[string]interface{}{"mock": true},
+		Description: description,
+	}
+}
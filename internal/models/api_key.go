@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// APIKey authenticates machine clients such as scan workers. Only the
+// SHA-256 hash of the key is stored; Prefix holds the first characters of
+// the key so it can be recognised in listings. RateLimitPerMinute caps the
+// requests made with the key; 0 means unlimited. Scopes restrict the
+// endpoints the key may call (see apikeys.Scopes); requests made with the
+// key act on behalf of CreatedBy. DailyScanQuota and MonthlyScanQuota cap
+// the scans submitted with the key (see package quota); 0 means only the
+// owner's quota applies.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16)" json:"prefix"`
+	KeyHash    string     `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	RateLimitPerMinute int                         `gorm:"not null;default:0" json:"rate_limit_per_minute"`
+	Scopes             datatypes.JSONSlice[string] `json:"scopes"`
+
+	DailyScanQuota   int `gorm:"not null;default:0" json:"daily_scan_quota"`
+	MonthlyScanQuota int `gorm:"not null;default:0" json:"monthly_scan_quota"`
+}
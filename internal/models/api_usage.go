@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIUsage aggregates the requests made with one API key to one endpoint on
+// one day (UTC). Route is the route pattern, e.g. /api/results.
+type APIUsage struct {
+	Day            time.Time `gorm:"type:date;primaryKey" json:"day"`
+	APIKeyID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"api_key_id"`
+	Method         string    `gorm:"type:varchar(8);primaryKey" json:"method"`
+	Route          string    `gorm:"type:varchar(255);primaryKey" json:"route"`
+	Requests       int64     `gorm:"not null;default:0" json:"requests"`
+	Errors         int64     `gorm:"not null;default:0" json:"errors"`
+	TotalLatencyMs int64     `gorm:"not null;default:0" json:"total_latency_ms"`
+	MaxLatencyMs   int64     `gorm:"not null;default:0" json:"max_latency_ms"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Artifact is an evidence file (screenshot, HAR capture) attached to a scan
+// by a worker. The content lives in file storage under StorageKey and has
+// already been validated and sanitized by the artifacts package. Encoding
+// is set when the stored object is compressed (e.g. "gzip" for HAR files);
+// Size and SHA256 always describe the uncompressed content.
+type Artifact struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	ScanID      uuid.UUID `gorm:"type:uuid;index" json:"scan_id"`
+	Kind        string    `gorm:"type:varchar(32)" json:"kind"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `gorm:"type:varchar(128)" json:"content_type"`
+	Encoding    string    `gorm:"type:varchar(16)" json:"encoding,omitempty"`
+	Size        int64     `json:"size"`
+	SHA256      string    `gorm:"type:varchar(64)" json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
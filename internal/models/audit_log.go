@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Audited actions.
+const (
+	AuditAPIKeyCreated           = "api_key.created"
+	AuditAPIKeyUpdated           = "api_key.updated"
+	AuditAPIKeyRevoked           = "api_key.revoked"
+	AuditUserRoleChanged         = "user.role_changed"
+	AuditScanApproved            = "scan.approved"
+	AuditScanRejected            = "scan.rejected"
+	AuditProductionTargetCreated = "production_target.created"
+	AuditProductionTargetDeleted = "production_target.deleted"
+	AuditDeadLetterRequeued      = "dead_letter.requeued"
+	AuditScanDeleted             = "scan.deleted"
+	AuditSessionRevoked          = "session.revoked"
+	AuditOrganizationCreated     = "organization.created"
+	AuditMemberInvited           = "organization.member_invited"
+	AuditMemberJoined            = "organization.member_joined"
+	AuditUserDisabled            = "user.disabled"
+	AuditUserEnabled             = "user.enabled"
+	AuditScanStatusForced        = "scan.status_forced"
+	AuditScanRequeued            = "scan.requeued"
+	AuditOrganizationPlanChanged = "organization.plan_changed"
+	AuditIntegrationSet          = "organization.integration_set"
+	AuditIntegrationDeleted      = "organization.integration_deleted"
+	AuditSlackLinked             = "user.slack_linked"
+	AuditSlackUnlinked           = "user.slack_unlinked"
+)
+
+// AuditLogEntry records a security-relevant action. Entries form a hash
+// chain (see package audit): each stores the hash of the one before it, so
+// editing or deleting an entry breaks every hash after it.
+type AuditLogEntry struct {
+	// Seq numbers the entries without gaps, starting at 1.
+	Seq        int64      `gorm:"primaryKey;autoIncrement:false" json:"seq"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	Action     string     `gorm:"index;not null" json:"action"`
+	TargetType string     `json:"target_type"`
+	TargetID   string     `json:"target_id"`
+	// Details is stored as text, not jsonb, so that the hashed bytes
+	// survive the round trip unchanged.
+	Details   datatypes.JSON `gorm:"type:text" json:"details,omitempty"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+	PrevHash  string         `gorm:"type:char(64);not null" json:"prev_hash"`
+	Hash      string         `gorm:"type:char(64);uniqueIndex;not null" json:"hash"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// BackfillCheckpoint records how far a backfill task got (see package
+// backfill), so that an interrupted run resumes after the last batch it
+// committed. CompletedAt is set once the task has processed every row.
+type BackfillCheckpoint struct {
+	Task        string     `gorm:"primaryKey" json:"task"`
+	Cursor      string     `json:"cursor"`
+	Processed   int64      `json:"processed"`
+	Failed      int64      `json:"failed"`
+	StartedAt   time.Time  `json:"started_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// TestBenchmark is the platform-wide pass rate of one test, computed over
+// the latest completed scan of every scanned site. It only holds
+// aggregates; tests run against too few sites to stay anonymous have no
+// row.
+type TestBenchmark struct {
+	// TestName is the lower-cased test name.
+	TestName   string    `gorm:"primaryKey" json:"test_name"`
+	Sites      int       `json:"sites"`
+	Passing    int       `json:"passing"`
+	PassRate   float64   `json:"pass_rate"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// ScoreBenchmark is the platform-wide distribution of security scores. It
+// has a single row with ID 1.
+type ScoreBenchmark struct {
+	ID         int       `gorm:"primaryKey" json:"-"`
+	Sites      int       `json:"sites"`
+	P25        float64   `json:"p25"`
+	Median     float64   `json:"median"`
+	P75        float64   `json:"p75"`
+	ComputedAt time.Time `json:"computed_at"`
+}
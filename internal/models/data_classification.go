@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataClassification labels the findings of one test for a user, e.g. to
+// mark them as confidential. Tests without a classification are public.
+type DataClassification struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_data_classification" json:"-"`
+	TestName  string    `gorm:"not null;uniqueIndex:idx_data_classification" json:"test_name"`
+	Label     string    `gorm:"type:varchar(16);not null" json:"label"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationClassification labels the findings of one test for all
+// members of an organization. It adds to the members' own labels; a test
+// labelled by both takes the more restricted label.
+type OrganizationClassification struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_organization_classification" json:"-"`
+	TestName       string    `gorm:"not null;uniqueIndex:idx_organization_classification" json:"test_name"`
+	Label          string    `gorm:"type:varchar(16);not null" json:"label"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailTemplate overrides the built-in source of an email template.
+type EmailTemplate struct {
+	Name      string    `gorm:"type:varchar(64);primaryKey" json:"name"`
+	Source    string    `gorm:"type:text;not null" json:"source"`
+	UpdatedBy uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationEmailTemplate overrides the source of an email template for
+// the emails sent on behalf of one organization.
+type OrganizationEmailTemplate struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Name           string    `gorm:"type:varchar(64);primaryKey" json:"name"`
+	Source         string    `gorm:"type:text;not null" json:"source"`
+	UpdatedBy      uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Membership roles. Owners manage the organization and invite members;
+// members share its scans.
+const (
+	MembershipRoleOwner  = "owner"
+	MembershipRoleMember = "member"
+)
+
+// Organization is a team of users that share scans. A premium scan
+// submitted for an organization can be read by all of its members.
+//
+// Plan names the storage plan capping the organization's stored data;
+// empty means the default plan. StorageOverQuotaSince is set while the
+// organization is over its plan and StorageWarnedAt once its owners have
+// been warned about the purge.
+type Organization struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Plan                  string     `gorm:"type:varchar(32);not null;default:''" json:"plan"`
+	StorageOverQuotaSince *time.Time `json:"storage_over_quota_since,omitempty"`
+	StorageWarnedAt       *time.Time `json:"-"`
+}
+
+// Membership makes a user a member of an organization.
+type Membership struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Role           string    `gorm:"type:varchar(16);not null" json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrganizationInvitation invites the owner of an email address to an
+// organization. Only the SHA-256 hash of the token is stored; the token
+// itself is sent to the invitee by email.
+type OrganizationInvitation struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index" json:"organization_id"`
+	Email          string     `gorm:"not null" json:"email"`
+	Role           string     `gorm:"type:varchar(16);not null" json:"role"`
+	TokenHash      string     `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	InvitedBy      uuid.UUID  `gorm:"type:uuid" json:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
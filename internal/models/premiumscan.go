@@ -4,16 +4,65 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Scan priorities. Tasks of higher-priority scans are taken from the scan
+// queue first.
+const (
+	ScanPriorityLow    = "low"
+	ScanPriorityNormal = "normal"
+	ScanPriorityHigh   = "high"
+)
+
+// Scan profiles select the tests a scan runs: quick runs a fast subset,
+// full runs every available test and custom runs an explicit list.
+const (
+	ScanProfileQuick  = "quick"
+	ScanProfileFull   = "full"
+	ScanProfileCustom = "custom"
 )
 
 type PremiumScan struct {
-	ID          uuid.UUID    `gorm:"type:uuid;primary_key;" json:"id"`
-	UserID      uuid.UUID    `gorm:"type:uuid;index" json:"user_id"`
-	User        User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	TargetURL   string       `json:"target_url"`
-	Status      string       `json:"status"`
-	CreatedAt   time.Time    `json:"created_at"`
-	StartedAt   *time.Time   `json:"started_at"`
-	CompletedAt *time.Time   `json:"completed_at"`
-	Results     []ScanResult `gorm:"foreignKey:ScanID;constraint:-" json:"results"`
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;index;index:idx_premium_scans_user_created,priority:1" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	TargetURL string    `gorm:"index:idx_premium_scans_target_prefix,expression:LOWER(target_url) text_pattern_ops" json:"target_url"`
+	// TargetID is the verified target (see Target) that authorized the
+	// scan, if any.
+	TargetID      *uuid.UUID     `gorm:"type:uuid;index" json:"target_id,omitempty"`
+	Status        string         `json:"status"`
+	Screenshot    bool           `json:"screenshot"`
+	CreatedAt     time.Time      `gorm:"index:idx_premium_scans_user_created,priority:2" json:"created_at"`
+	StartedAt     *time.Time     `json:"started_at"`
+	CompletedAt   *time.Time     `json:"completed_at"`
+	Score         *float64       `json:"score"`
+	Grade         string         `json:"grade"`
+	ScoringPolicy datatypes.JSON `json:"scoring_policy,omitempty"`
+	Results       []ScanResult   `gorm:"foreignKey:ScanID;constraint:-" json:"results"`
+
+	// LastHeartbeatAt is when the worker running the scan last reported
+	// that it is alive (nil if the worker doesn't send heartbeats).
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at,omitempty"`
+	// DeletedAt is set when the scan is deleted; GORM leaves deleted scans
+	// out of all queries.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	// Tags are only loaded where scans are listed or returned one by one.
+	Tags []ScanTag `gorm:"foreignKey:ScanID;constraint:-" json:"tags,omitempty"`
+	// BatchID groups the scans submitted together in one batch.
+	BatchID *uuid.UUID `gorm:"type:uuid;index" json:"batch_id,omitempty"`
+	// Priority is kept for queueing the task once the scan is approved.
+	Priority string `gorm:"type:varchar(8);not null;default:normal" json:"priority"`
+	// Profile and Tests record the tests the scan was asked to run. Scans
+	// from before profiles existed always listed their tests.
+	Profile string                      `gorm:"type:varchar(8);not null;default:custom" json:"profile"`
+	Tests   datatypes.JSONSlice[string] `json:"tests,omitempty"`
+	// OrganizationID shares the scan with the members of an organization.
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	// APIKeyID is the API key the scan was submitted with, if any.
+	APIKeyID *uuid.UUID `gorm:"type:uuid;index" json:"api_key_id,omitempty"`
+	// AntiBotDetection is kept for rebuilding the task when an admin
+	// requeues the scan.
+	AntiBotDetection bool `gorm:"not null;default:false" json:"anti_bot_detection"`
 }
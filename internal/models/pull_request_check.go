@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PullRequestCheck reports a premium scan run for a commit of a GitHub,
+// GitLab or Bitbucket repository back to it: a status on the commit (a
+// check run on GitHub) and, for a pull or merge request, a summary comment
+// (see package prchecks). Once posted, the status is flagged and the
+// comment's ID kept, so a retry posts only what is missing.
+type PullRequestCheck struct {
+	ScanID uuid.UUID `gorm:"type:uuid;primaryKey" json:"scan_id"`
+	// Provider is the host of the repository; IntegrationID the
+	// organization's integration reporting to it, nil on GitHub, which
+	// reports through the GitHub App.
+	Provider      string     `gorm:"type:varchar(16);not null;default:'github'" json:"provider"`
+	IntegrationID *uuid.UUID `gorm:"type:uuid;index" json:"integration_id,omitempty"`
+	Repository    string     `gorm:"type:varchar(200);not null" json:"repository"`
+	SHA           string     `gorm:"type:varchar(40);not null" json:"sha"`
+	// PullRequest is the number of the pull or merge request, 0 for a
+	// plain commit.
+	PullRequest int `gorm:"not null;default:0" json:"pull_request,omitempty"`
+	// FailOn is the lowest severity of a failed test that fails the gate.
+	FailOn string `gorm:"type:varchar(16);not null" json:"fail_on"`
+
+	Conclusion    string     `gorm:"type:varchar(16)" json:"conclusion,omitempty"`
+	StatusPosted  bool       `gorm:"not null;default:false" json:"status_posted"`
+	CheckRunID    int64      `json:"check_run_id,omitempty"`
+	CommentID     int64      `json:"comment_id,omitempty"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"-"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	ReportedAt    *time.Time `gorm:"index" json:"reported_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Platforms of push devices.
+const (
+	PushPlatformFCM  = "fcm"
+	PushPlatformAPNs = "apns"
+)
+
+// PushDevice is a device of the mobile app registered for push
+// notifications of the events in Events (see package push). Notifications
+// of scans and findings are only sent when a finding is at least as severe
+// as MinSeverity; an empty MinSeverity sends them all. A token belongs to
+// one user at a time: registering it again moves it to the new user.
+type PushDevice struct {
+	ID          uuid.UUID                   `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID      uuid.UUID                   `gorm:"type:uuid;index" json:"user_id"`
+	Platform    string                      `gorm:"type:varchar(8);not null" json:"platform"`
+	Token       string                      `gorm:"type:varchar(512);uniqueIndex;not null" json:"-"`
+	Name        string                      `gorm:"type:varchar(100)" json:"name"`
+	Events      datatypes.JSONSlice[string] `json:"events"`
+	MinSeverity string                      `gorm:"type:varchar(16)" json:"min_severity"`
+	// LastNotifiedAt is when a notification was last delivered to it.
+	LastNotifiedAt *time.Time `json:"last_notified_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// QueueMigration records a change of the RabbitMQ topology that was
+// applied by `cmd/api migrate-queues`. RabbitMQ can't change the arguments
+// of an existing queue, so such changes replace the queue once, while the
+// API and the workers are stopped, instead of on every start.
+type QueueMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
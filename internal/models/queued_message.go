@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// QueuedMessage is a message of the in-process queue (QUEUE_DRIVER=memory,
+// see queue.Memory). It is saved when the message is published and deleted
+// when a consumer acknowledges it, so that queued messages survive a
+// restart of the API.
+type QueuedMessage struct {
+	ID         uint64 `gorm:"primaryKey"`
+	Queue      string `gorm:"not null;index"`
+	Exchange   string `gorm:"not null"`
+	RoutingKey string `gorm:"not null"`
+
+	Headers      datatypes.JSON
+	ContentType  string
+	DeliveryMode uint8
+	Priority     uint8
+	MessageID    string
+	Timestamp    time.Time
+	Expiration   string
+	Body         []byte
+
+	// ExpiresAt is when the message leaves a queue with a message TTL.
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
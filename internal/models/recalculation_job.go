@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusPending   = "PENDING"
+	JobStatusRunning   = "RUNNING"
+	JobStatusCompleted = "COMPLETED"
+	JobStatusFailed    = "FAILED"
+)
+
+// RecalculationJob tracks an admin-triggered recomputation of scores for
+// historical scans after a scoring policy change.
+//
+// A nil UserID recalculates every completed scan; otherwise only that
+// user's premium scans are processed.
+type RecalculationJob struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	RequestedBy uuid.UUID  `gorm:"type:uuid" json:"requested_by"`
+	UserID      *uuid.UUID `gorm:"type:uuid" json:"user_id"`
+	Status      string     `gorm:"type:varchar(16);index" json:"status"`
+	Total       int64      `json:"total"`
+	Processed   int64      `json:"processed"`
+	Failed      int64      `json:"failed"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RemediationContent is one version of the remediation guidance for a test
+// in a given language. Edits never overwrite a row; they insert the next
+// version, and the highest version is the one served to users.
+type RemediationContent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TestName    string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_remediation_version" json:"test_name"`
+	Language    string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_remediation_version" json:"language"`
+	Version     int       `gorm:"not null;uniqueIndex:idx_remediation_version" json:"version"`
+	Title       string    `json:"title"`
+	Remediation string    `gorm:"type:text" json:"remediation"`
+	Reference   string    `json:"reference"`
+	AuthorID    uuid.UUID `gorm:"type:uuid" json:"author_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
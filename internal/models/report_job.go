@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report types that can be generated by a ReportJob.
+const (
+	ReportTypeExecutiveSummary = "executive_summary"
+	ReportTypeScan             = "scan_report"
+	ReportTypeResultsCSV       = "results_csv"
+)
+
+// Report output formats.
+const (
+	ReportFormatPDF  = "pdf"
+	ReportFormatHTML = "html"
+	ReportFormatCSV  = "csv"
+)
+
+// ReportJob tracks the asynchronous generation of a report. Progress goes
+// from 0 to 100; once the job completes the rendered report is available
+// under StorageKey.
+//
+// Scan reports set ScanID and Language instead of a period. CacheKey
+// identifies the input a report was rendered from, so a completed job can
+// be served again until the scan or its remediation content changes.
+// IncludeConfidential is set when a scan report was explicitly requested
+// with findings classified as confidential. Results CSV exports also set
+// ScanID, and Columns holds their comma-separated column selection.
+//
+// Jobs are run from a queue; Attempts counts the runs, including retries of
+// failed jobs.
+type ReportJob struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	Type        string     `gorm:"type:varchar(32);index" json:"type"`
+	Format      string     `gorm:"type:varchar(8)" json:"format"`
+	PeriodFrom  time.Time  `json:"period_from"`
+	PeriodTo    time.Time  `json:"period_to"`
+	ScanID      *uuid.UUID `gorm:"type:uuid;index" json:"scan_id,omitempty"`
+	Language    string     `gorm:"type:varchar(16)" json:"language,omitempty"`
+	CacheKey    string     `gorm:"type:varchar(64);index" json:"-"`
+	Status      string     `gorm:"type:varchar(16);index" json:"status"`
+	Progress    int        `json:"progress"`
+	StorageKey  string     `json:"-"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	IncludeConfidential bool   `gorm:"not null;default:false" json:"include_confidential,omitempty"`
+	Columns             string `gorm:"type:text" json:"columns,omitempty"`
+	Attempts            int    `gorm:"not null;default:0" json:"attempts"`
+}
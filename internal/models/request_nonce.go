@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RequestNonce records a nonce used by a signed worker request. A nonce is
+// accepted only once; rows older than the replay window are purged since
+// requests that old are rejected by their timestamp anyway.
+type RequestNonce struct {
+	Nonce     string    `gorm:"type:varchar(64);primaryKey" json:"nonce"`
+	APIKeyID  uuid.UUID `gorm:"type:uuid" json:"api_key_id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
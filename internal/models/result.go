@@ -1,10 +1,42 @@
 package models
 
 import (
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Triage states of a finding.
+const (
+	TriageOpen         = "open"
+	TriageAcknowledged = "acknowledged"
+	TriageSuppressed   = "suppressed"
+	// A fixed finding waits for a verification scan, which moves it to
+	// verified or back to open.
+	TriageFixed    = "fixed"
+	TriageVerified = "verified"
 )
 
+// SeverityRanks maps lower-cased severities to their rank, from none (0) to
+// critical (5), so that results can be ordered by severity in SQL.
+// Unknown severities rank like "none".
+var SeverityRanks = map[string]int{
+	"critical": 5,
+	"high":     4,
+	"medium":   3,
+	"low":      2,
+	"info":     1,
+	"none":     0,
+}
+
+// SeverityRank returns the rank of a severity, ignoring case.
+func SeverityRank(severity string) int {
+	return SeverityRanks[strings.ToLower(strings.TrimSpace(severity))]
+}
+
 type ScanResult struct {
 	ID       uint      `gorm:"primaryKey" json:"id"`
 	ScanID   uuid.UUID `gorm:"type:uuid;index" json:"scan_id"`
@@ -12,6 +44,37 @@ type ScanResult struct {
 	Severity string    `json:"severity"`
 	Passed   bool      `json:"passed"`
 	Message  string    `gorm:"type:text" json:"message"`
+	// ArtifactID references evidence (e.g. a screenshot) attached to the scan
+	ArtifactID *uuid.UUID `gorm:"type:uuid" json:"artifact_id,omitempty"`
+
+	// SeverityRank is SeverityRank(Severity), stored for ordering
+	SeverityRank int `gorm:"not null;default:0;index" json:"severity_rank"`
+
+	// TriageStatus is the triage state of the finding (open, acknowledged,
+	// suppressed, fixed, verified)
+	TriageStatus string `gorm:"type:varchar(16);not null;default:open;index" json:"triage_status"`
+	// AssigneeID is the user responsible for the finding
+	AssigneeID *uuid.UUID `gorm:"type:uuid;index" json:"assignee_id"`
+	// TriageNote is the reason given with the last triage action
+	TriageNote string `gorm:"type:text" json:"triage_note,omitempty"`
+	// TriagedAt and TriagedBy record the last triage action
+	TriagedAt *time.Time `json:"triaged_at,omitempty"`
+	TriagedBy *uuid.UUID `gorm:"type:uuid" json:"triaged_by,omitempty"`
+
+	// FirstSeenAt is when the finding was first reported for the target; it
+	// is carried over from earlier scans for as long as the test keeps failing
+	FirstSeenAt *time.Time `gorm:"index" json:"first_seen_at,omitempty"`
+	// SLABreachedAt is when the finding was reported as past its SLA deadline
+	SLABreachedAt *time.Time `json:"sla_breached_at,omitempty"`
+
+	// VerifyAfter is when a fixed finding is due for a verification scan;
+	// VerificationScanID is the scan started to verify it
+	VerifyAfter        *time.Time `gorm:"index" json:"verify_after,omitempty"`
+	VerificationScanID *uuid.UUID `gorm:"type:uuid;index" json:"verification_scan_id,omitempty"`
 
 	Metadata datatypes.JSON `json:"metadata"`
+
+	// DeletedAt is set together with the DeletedAt of the scan, which
+	// hides the results wherever they are queried
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
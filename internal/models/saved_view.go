@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// SavedView is a named set of list filters saved by a user.
+//
+// Resource names the list the filters apply to ("scans" or "findings") and
+// Filters holds the query parameters of that list. At most one view per
+// user and resource is marked as the default. Shared views are visible to
+// the other members of the owner's organization.
+type SavedView struct {
+	ID        uuid.UUID                             `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID                             `gorm:"type:uuid;uniqueIndex:idx_saved_view_name" json:"user_id"`
+	Resource  string                                `gorm:"type:varchar(32);uniqueIndex:idx_saved_view_name" json:"resource"`
+	Name      string                                `gorm:"type:varchar(100);uniqueIndex:idx_saved_view_name" json:"name"`
+	Filters   datatypes.JSONType[map[string]string] `json:"filters"`
+	Shared    bool                                  `gorm:"not null;default:false" json:"shared"`
+	IsDefault bool                                  `gorm:"not null;default:false" json:"is_default"`
+	CreatedAt time.Time                             `json:"created_at"`
+	UpdatedAt time.Time                             `json:"updated_at"`
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 )
 
 // Scan represents a security scan request and its current state.
@@ -30,8 +31,22 @@ type Scan struct {
 	CreatedAt time.Time `json:"created_at"`
 	// StartedAt is the timestamp when a worker began processing the scan (nil if not started)
 	StartedAt *time.Time `json:"started_at"`
+	// LastHeartbeatAt is when the worker running the scan last reported
+	// that it is alive (nil if the worker doesn't send heartbeats)
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at,omitempty"`
 	// CompletedAt is the timestamp when the scan finished (nil if not completed)
 	CompletedAt *time.Time `json:"completed_at"`
+	// Score is the security score (0-100) computed when the scan completes
+	Score *float64 `json:"score"`
+	// Grade is the letter grade derived from Score
+	Grade string `json:"grade"`
+	// ScoringPolicy is a snapshot of the scoring rules used to compute Score
+	ScoringPolicy datatypes.JSON `json:"scoring_policy,omitempty"`
 	// Results contains all individual test results for this scan
 	Results []ScanResult `gorm:"foreignKey:ScanID;constraint:-" json:"results"`
+	// Profile is the scan profile (quick, full or custom); scans from
+	// before profiles existed ran every test
+	Profile string `gorm:"type:varchar(8);not null;default:full" json:"profile"`
+	// Tests are the tests the scan was asked to run
+	Tests datatypes.JSONSlice[string] `json:"tests,omitempty"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Approval decisions.
+const (
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ProductionTarget marks a host as production. Scans of it submitted by
+// non-admins need an admin's approval before they are queued. A host of
+// the form "*.example.com" covers every subdomain of example.com.
+type ProductionTarget struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	Host      string    `gorm:"uniqueIndex;not null" json:"host"`
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ScanApproval holds a premium scan waiting in PENDING_APPROVAL together
+// with the task that is queued once it is approved.
+type ScanApproval struct {
+	ScanID      uuid.UUID      `gorm:"type:uuid;primary_key;" json:"scan_id"`
+	RequestedBy uuid.UUID      `gorm:"type:uuid;index" json:"requested_by"`
+	Task        datatypes.JSON `json:"-"`
+	Decision    string         `gorm:"type:varchar(16)" json:"decision,omitempty"`
+	DecidedBy   *uuid.UUID     `gorm:"type:uuid" json:"decided_by,omitempty"`
+	DecidedAt   *time.Time     `json:"decided_at,omitempty"`
+	Note        string         `gorm:"type:text" json:"note,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ScanEvaluation is a result set obtained by evaluating the evidence stored
+// for a scan (the headers and tls artifacts) again with the check versions
+// of the server, without contacting the target. The evaluations of a scan
+// are numbered from 1; the scan's own results are left untouched.
+type ScanEvaluation struct {
+	ID     uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	ScanID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_scan_evaluation_number" json:"scan_id"`
+	Number int       `gorm:"not null;uniqueIndex:idx_scan_evaluation_number" json:"number"`
+	// CheckVersions are the versions of the checks that were run, by test.
+	CheckVersions datatypes.JSONType[map[string]int]   `json:"check_versions"`
+	Results       datatypes.JSONSlice[EvaluatedResult] `json:"results"`
+	// Changed counts the results whose severity differs from the scan's.
+	Changed   int       `json:"changed"`
+	CreatedBy uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EvaluatedResult is the outcome of one test in a ScanEvaluation.
+// OriginalSeverity is the severity the scan reported for the test, or
+// empty if the scan has no result for it.
+type EvaluatedResult struct {
+	TestName         string      `json:"test_name"`
+	CheckVersion     int         `json:"check_version"`
+	Severity         string      `json:"severity"`
+	Passed           bool        `json:"passed"`
+	Message          string      `json:"message"`
+	Metadata         interface{} `json:"metadata"`
+	OriginalSeverity string      `json:"original_severity,omitempty"`
+	Changed          bool        `json:"changed"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actors that move scans between statuses.
+const (
+	ScanActorUser      = "user"
+	ScanActorAnonymous = "anonymous"
+	ScanActorWorker    = "worker"
+	ScanActorSystem    = "system"
+)
+
+// ScanEvent records one status transition of a free or premium scan.
+// FromStatus is empty for the event that created the scan. ActorID is the
+// user for user actions and the API key for workers that authenticated
+// with one.
+type ScanEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	ScanID     uuid.UUID  `gorm:"type:uuid;index:idx_scan_events_scan_created,priority:1" json:"scan_id"`
+	FromStatus string     `gorm:"type:varchar(32)" json:"from_status,omitempty"`
+	Status     string     `gorm:"type:varchar(32);not null" json:"status"`
+	Actor      string     `gorm:"type:varchar(16);not null" json:"actor"`
+	ActorID    *uuid.UUID `gorm:"type:uuid" json:"actor_id,omitempty"`
+	Reason     string     `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt  time.Time  `gorm:"index:idx_scan_events_scan_created,priority:2" json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScanTag attaches a free-form tag, such as "prod" or "client-x", to a
+// premium scan. Tags are stored lower-cased.
+type ScanTag struct {
+	ScanID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Tag       string    `gorm:"type:varchar(64);primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// MarshalJSON encodes a tag as its name, so that a scan's tags are listed
+// as plain strings.
+func (t ScanTag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tag)
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// GradeThreshold maps the minimum score required to a letter grade.
+type GradeThreshold struct {
+	Grade    string  `json:"grade"`
+	MinScore float64 `json:"min_score"`
+}
+
+// ScoringRules holds the parameters of the scoring model.
+//
+// CategoryWeights weigh each test category in the overall score,
+// SeverityMultipliers are the penalty points subtracted from a category
+// for every failed test of the given severity, and GradeThresholds map the
+// final score to a letter grade (highest threshold first).
+type ScoringRules struct {
+	CategoryWeights     map[string]float64 `json:"category_weights"`
+	SeverityMultipliers map[string]float64 `json:"severity_multipliers"`
+	GradeThresholds     []GradeThreshold   `json:"grade_thresholds"`
+}
+
+// ScoringPolicy stores a configurable scoring model.
+//
+// A policy with an OrganizationID applies to the scans shared with that
+// organization, a policy with a UserID to that user's other scans, and the
+// policy with neither is the platform default. Unique indexes allow one
+// policy per organization and per user; the single default is enforced
+// by scoring.MigratePolicies, since NULLs never collide in a unique index.
+type ScoringPolicy struct {
+	ID             uuid.UUID                        `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID         *uuid.UUID                       `gorm:"type:uuid;uniqueIndex" json:"user_id"`
+	OrganizationID *uuid.UUID                       `gorm:"type:uuid;uniqueIndex" json:"organization_id,omitempty"`
+	Rules          datatypes.JSONType[ScoringRules] `json:"rules"`
+	CreatedAt      time.Time                        `json:"created_at"`
+	UpdatedAt      time.Time                        `json:"updated_at"`
+}
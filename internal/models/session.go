@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login of a user. Its ID is carried in the "sid" claim of
+// the session token, so revoking the session signs the token out before it
+// expires. UserAgent and IP describe the device the user logged in from;
+// IP is updated with LastSeenAt.
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index" json:"-"`
+	UserAgent  string     `gorm:"type:varchar(512)" json:"user_agent"`
+	IP         string     `gorm:"type:varchar(45)" json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// DeviceHash fingerprints the browser the session was started from
+	// and Location is where, as a country or an IP network; logins from a
+	// device or location none of the user's earlier sessions had are new.
+	DeviceHash string `gorm:"type:varchar(64)" json:"-"`
+	Location   string `gorm:"type:varchar(64)" json:"location"`
+	// Pending sessions belong to a login from a new device that hasn't
+	// been confirmed yet; no token is issued for them.
+	Pending bool `gorm:"not null;default:false" json:"-"`
+}
+
+// LoginChallenge holds the confirmation code emailed for a login from a
+// new device. Only the SHA-256 hash of the code is stored.
+type LoginChallenge struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	SessionID uuid.UUID  `gorm:"type:uuid;index" json:"session_id"`
+	CodeHash  string     `gorm:"type:varchar(64)" json:"-"`
+	Attempts  int        `gorm:"not null;default:0" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
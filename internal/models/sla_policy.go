@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SLAPolicy is a user's remediation deadline for failed findings of one
+// severity, e.g. critical findings must be fixed within 7 days.
+type SLAPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_sla_policy" json:"-"`
+	Severity  string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_sla_policy" json:"severity"`
+	Days      int       `gorm:"not null" json:"days"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationSLAPolicy is an organization's remediation deadline for
+// failed findings of one severity. It applies to the scans shared with the
+// organization instead of their owner's SLAPolicy for that severity.
+type OrganizationSLAPolicy struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_organization_sla_policy" json:"-"`
+	Severity       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_organization_sla_policy" json:"severity"`
+	Days           int       `gorm:"not null" json:"days"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
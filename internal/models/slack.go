@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SlackLink maps a Slack user of a workspace to the platform user whose
+// scans they run with the /antiginx command.
+type SlackLink struct {
+	TeamID      string    `gorm:"type:varchar(32);primaryKey" json:"team_id"`
+	SlackUserID string    `gorm:"type:varchar(32);primaryKey" json:"slack_user_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SlackLinkCode is a single-use code a user runs "/antiginx link <code>"
+// with to link their Slack user to their account. Only the SHA-256 hash of
+// the code is stored.
+type SlackLinkCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SlackNotification posts the summary of a scan started from Slack to the
+// channel it was started in once the scan finishes (see package slack).
+type SlackNotification struct {
+	ScanID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"scan_id"`
+	TeamID      string    `gorm:"type:varchar(32);not null" json:"team_id"`
+	ChannelID   string    `gorm:"type:varchar(32);not null" json:"channel_id"`
+	SlackUserID string    `gorm:"type:varchar(32);not null" json:"slack_user_id"`
+
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"-"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	PostedAt      *time.Time `gorm:"index" json:"posted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// StagedScanResult is a result of a streamed results submission that
+// hasn't been committed yet. A submission stages its results in batches
+// while it streams in and moves them to scan_results in the transaction
+// that finishes the scan, so one that fails midway leaves no results
+// behind. SubmissionID identifies the request and ItemIndex the position
+// of the result in it, so a batch written twice is only staged once.
+type StagedScanResult struct {
+	ScanID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	SubmissionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ItemIndex    int       `gorm:"primaryKey;autoIncrement:false"`
+
+	TestName     string
+	Severity     string
+	Passed       bool
+	Message      string     `gorm:"type:text"`
+	ArtifactID   *uuid.UUID `gorm:"type:uuid"`
+	SeverityRank int        `gorm:"not null;default:0"`
+	Metadata     datatypes.JSON
+
+	CreatedAt time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Target is a host a user has claimed for scanning. A host of the form
+// "*.example.com" is a wildcard target: once verified it authorizes
+// example.com and every subdomain of it, so a whole estate is verified
+// with one DNS record.
+type Target struct {
+	ID     uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_targets_user_host;not null" json:"user_id"`
+	Host   string    `gorm:"uniqueIndex:idx_targets_user_host;not null" json:"host"`
+	// Token is the value the verification TXT record must contain.
+	Token      string     `gorm:"not null" json:"verification_token"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// VerificationMethod is how the target was verified: "dns" or "file".
+	VerificationMethod string `gorm:"type:varchar(8)" json:"verification_method,omitempty"`
+}
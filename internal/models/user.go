@@ -18,4 +18,7 @@ type User struct {
 	Role      string    `gorm:"type:varchar(32);not null;default:user;index" json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	Password  []byte    `json:"-"`
+	// DisabledAt is set while an admin has disabled the account; disabled
+	// users can't log in and their API keys are refused.
+	DisabledAt *time.Time `json:"disabled_at"`
 }
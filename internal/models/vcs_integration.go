@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VCSIntegration lets the scans of an organization report to the
+// repositories of a GitLab or Bitbucket account (see package vcs). The
+// access token is only stored encrypted, bound to the integration's ID.
+type VCSIntegration struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_vcs_integrations_org_provider" json:"organization_id"`
+	Provider       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_vcs_integrations_org_provider" json:"provider"`
+	// BaseURL is the host of a self-managed GitLab; empty for the
+	// provider's default.
+	BaseURL     string    `gorm:"type:varchar(200);not null;default:''" json:"base_url"`
+	SealedToken string    `gorm:"type:text;not null" json:"-"`
+	CreatedBy   uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
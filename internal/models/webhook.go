@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Webhook is an endpoint registered by a user to receive scan events.
+//
+// When the signing secret is rotated, the old secret is kept in
+// PreviousSecret until PreviousSecretExpiresAt and deliveries are signed
+// with both, so receivers can switch secrets without missing events.
+//
+// Findings the user classified as confidential are only delivered to
+// webhooks with AllowConfidential set.
+type Webhook struct {
+	ID                      uuid.UUID                   `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID                  uuid.UUID                   `gorm:"type:uuid;index" json:"user_id"`
+	URL                     string                      `gorm:"not null" json:"url"`
+	Secret                  string                      `json:"-"`
+	PreviousSecret          string                      `json:"-"`
+	PreviousSecretExpiresAt *time.Time                  `json:"previous_secret_expires_at,omitempty"`
+	SecretRotatedAt         *time.Time                  `json:"secret_rotated_at,omitempty"`
+	Events                  datatypes.JSONSlice[string] `json:"events"`
+	Active                  bool                        `gorm:"not null;default:true" json:"active"`
+	AllowConfidential       bool                        `gorm:"not null;default:false" json:"allow_confidential"`
+	CreatedAt               time.Time                   `json:"created_at"`
+}
+
+// WebhookDelivery records a single delivery attempt of an event to a
+// webhook, including automatic retries and manual redeliveries. Retries
+// point to the failed attempt through RedeliveryOf; NextRetryAt is set
+// while a retry of a failed attempt is scheduled.
+type WebhookDelivery struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key;" json:"id"`
+	WebhookID    uuid.UUID      `gorm:"type:uuid;index" json:"webhook_id"`
+	Event        string         `gorm:"type:varchar(64)" json:"event"`
+	Payload      datatypes.JSON `json:"payload"`
+	PayloadHash  string         `gorm:"type:varchar(64)" json:"payload_hash"`
+	StatusCode   int            `json:"status_code"`
+	LatencyMs    int64          `json:"latency_ms"`
+	Error        string         `gorm:"type:text" json:"error,omitempty"`
+	Success      bool           `json:"success"`
+	Attempt      int            `gorm:"not null;default:1" json:"attempt"`
+	NextRetryAt  *time.Time     `gorm:"index" json:"next_retry_at,omitempty"`
+	RedeliveryOf *uuid.UUID     `gorm:"type:uuid" json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time      `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Generator derives schemas from Go types. Named struct types become
+// component schemas that other schemas refer to, so recursive types are
+// fine.
+type Generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+	defined map[reflect.Type]*Schema
+}
+
+func NewGenerator() *Generator {
+	g := &Generator{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+		defined: map[reflect.Type]*Schema{},
+	}
+	g.Define(uuid.UUID{}, &Schema{Type: "string", Format: "uuid"})
+	g.Define(time.Time{}, &Schema{Type: "string", Format: "date-time"})
+	g.Define(gorm.DeletedAt{}, &Schema{Type: "string", Format: "date-time", Nullable: true})
+	g.Define(datatypes.JSON{}, &Schema{})
+	g.Define(json.RawMessage{}, &Schema{})
+	return g
+}
+
+// Define sets the schema of the type of v, for types whose JSON encoding
+// differs from what their fields suggest, such as types with a custom
+// MarshalJSON.
+func (g *Generator) Define(v interface{}, s *Schema) {
+	g.defined[reflect.TypeOf(v)] = s
+}
+
+// Schema returns the schema of the type of v; v is usually a zero value.
+func (g *Generator) Schema(v interface{}) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+// Schemas returns the component schemas derived so far.
+func (g *Generator) Schemas() map[string]*Schema {
+	return g.schemas
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if s, ok := g.defined[t]; ok {
+		copied := *s
+		return &copied
+	}
+	if t.Kind() == reflect.Pointer {
+		s := g.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+	if data, ok := jsonTypeData(t); ok {
+		return g.schema(data)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return Ref(g.component(t))
+	}
+	// Interfaces and anything else encoding/json can't describe by type.
+	return &Schema{}
+}
+
+// component returns the name of the component schema of a named struct
+// type, deriving it on first use. Names are the bare type names unless two
+// packages use the same one.
+func (g *Generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		name = t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:] + "." + name
+	}
+	g.names[t] = name
+	// Reserve the name before deriving the fields, which may refer back.
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.object(t)
+	return name
+}
+
+// object derives the schema of a struct the way encoding/json encodes it:
+// embedded structs without a json name are flattened into it.
+func (g *Generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+func (g *Generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.fields(embedded, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(f.Type)
+		if strings.Contains(","+opts+",", ",string,") {
+			prop = &Schema{Type: "string"}
+		}
+		if required := constrain(prop, f.Tag.Get("binding")); required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// constrain applies the rules of a binding tag that a schema can express
+// and reports whether the field is required. Rules after "dive" apply to
+// the elements and are left out.
+func constrain(s *Schema, binding string) bool {
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+		switch tag {
+		case "dive":
+			return required
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url", "http_url":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil || s.Ref != "" {
+				continue
+			}
+			bound(s, tag, n)
+		}
+	}
+	return required
+}
+
+// bound sets a minimum or maximum of a length, count or value, depending
+// on the type of s.
+func bound(s *Schema, tag string, n float64) {
+	lower := tag == "min" || tag == "len" || tag == "gte"
+	upper := tag == "max" || tag == "len" || tag == "lte"
+	count := int(n)
+	switch s.Type {
+	case "string":
+		if lower {
+			s.MinLength = &count
+		}
+		if upper {
+			s.MaxLength = &count
+		}
+	case "array":
+		if lower {
+			s.MinItems = &count
+		}
+		if upper {
+			s.MaxItems = &count
+		}
+	case "integer", "number":
+		if lower {
+			s.Minimum = &n
+		}
+		if upper {
+			s.Maximum = &n
+		}
+	}
+}
+
+// jsonTypeData returns T of a datatypes.JSONType[T], which is encoded as T.
+func jsonTypeData(t reflect.Type) (reflect.Type, bool) {
+	if t.PkgPath() != "gorm.io/datatypes" || !strings.HasPrefix(t.Name(), "JSONType[") {
+		return nil, false
+	}
+	data, ok := t.MethodByName("Data")
+	if !ok || data.Type.NumOut() != 1 {
+		return nil, false
+	}
+	return data.Type.Out(0), true
+}
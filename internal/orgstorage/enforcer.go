@@ -0,0 +1,204 @@
+package orgstorage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/retention"
+	"gorm.io/gorm"
+)
+
+// checkInterval is how often organizations are measured against their
+// plans.
+const checkInterval = time.Hour
+
+// Enforcer flags organizations over their plans, warns their owners and
+// purges them once the grace period has passed.
+type Enforcer struct {
+	db        *gorm.DB
+	acct      *Accountant
+	purger    *retention.Purger
+	mailer    mail.Mailer
+	renderer  *mail.Renderer
+	cfg       *config.Config
+	batchSize int
+}
+
+func NewEnforcer(db *gorm.DB, acct *Accountant, purger *retention.Purger, mailer mail.Mailer, renderer *mail.Renderer, cfg *config.Config) *Enforcer {
+	return &Enforcer{
+		db:        db,
+		acct:      acct,
+		purger:    purger,
+		mailer:    mailer,
+		renderer:  renderer,
+		cfg:       cfg,
+		batchSize: cfg.Retention.BatchSize,
+	}
+}
+
+// Run checks every organization once immediately and then every hour
+// until ctx is cancelled. It returns at once when no plan is configured.
+func (e *Enforcer) Run(ctx context.Context) {
+	if len(e.cfg.OrgStorage.Plans) == 0 {
+		return
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Check(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Storage plan check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check measures every organization with a capped plan and flags, warns
+// or purges it as needed. An organization that can't be processed is
+// logged and skipped.
+func (e *Enforcer) Check(ctx context.Context) error {
+	var orgs []models.Organization
+	if err := e.db.WithContext(ctx).Order("created_at").Find(&orgs).Error; err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		if _, plan := e.acct.Plan(org); plan == (config.StoragePlan{}) && org.StorageOverQuotaSince == nil {
+			continue
+		}
+		if err := e.check(ctx, org); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.ErrorContext(ctx, "Failed to enforce storage plan", "organization_id", org.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (e *Enforcer) check(ctx context.Context, org models.Organization) error {
+	status, err := e.acct.Status(ctx, org)
+	if err != nil {
+		return err
+	}
+	if !status.OverQuota {
+		return e.clear(ctx, org)
+	}
+
+	now := time.Now()
+	if org.StorageOverQuotaSince == nil {
+		org.StorageOverQuotaSince = &now
+		if err := e.db.WithContext(ctx).Model(&org).Update("storage_over_quota_since", now).Error; err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Organization is over its storage plan", "organization_id", org.ID, "plan", status.Plan,
+			"results", status.Results.Used, "artifact_bytes", status.ArtifactBytes.Used)
+	}
+	if org.StorageWarnedAt == nil {
+		purgeAfter := org.StorageOverQuotaSince.Add(e.cfg.OrgStorage.GracePeriod)
+		if err := e.warnOwners(ctx, org, status, purgeAfter); err != nil {
+			return err
+		}
+		if err := e.db.WithContext(ctx).Model(&org).Update("storage_warned_at", now).Error; err != nil {
+			return err
+		}
+	}
+	if now.Before(org.StorageOverQuotaSince.Add(e.cfg.OrgStorage.GracePeriod)) {
+		return nil
+	}
+	return e.purge(ctx, org)
+}
+
+// purge deletes the organization's oldest finished scans, batch by batch,
+// until it fits its plan again.
+func (e *Enforcer) purge(ctx context.Context, org models.Organization) error {
+	var total retention.Stats
+	for {
+		var ids []uuid.UUID
+		if err := scansOf(e.db.WithContext(ctx), org.ID).
+			Where("status IN ?", retention.FinishedStatuses).
+			Order("created_at").Limit(e.batchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			slog.WarnContext(ctx, "Organization is over its storage plan with no finished scans left to purge", "organization_id", org.ID)
+			return nil
+		}
+		stats, err := e.purger.DeleteScans(ctx, ids)
+		if err != nil {
+			return err
+		}
+		total.Scans += stats.Scans
+		total.Results += stats.Results
+		total.Artifacts += stats.Artifacts
+
+		status, err := e.acct.Status(ctx, org)
+		if err != nil {
+			return err
+		}
+		if !status.OverQuota {
+			slog.InfoContext(ctx, "Purged scans of organization over its storage plan", "organization_id", org.ID,
+				"scans", total.Scans, "results", total.Results, "artifacts", total.Artifacts)
+			return e.clear(ctx, org)
+		}
+	}
+}
+
+// clear removes the over-quota flags of an organization that fits its
+// plan again, so that it is warned anew the next time.
+func (e *Enforcer) clear(ctx context.Context, org models.Organization) error {
+	if org.StorageOverQuotaSince == nil && org.StorageWarnedAt == nil {
+		return nil
+	}
+	return e.db.WithContext(ctx).Model(&org).Updates(map[string]interface{}{
+		"storage_over_quota_since": nil,
+		"storage_warned_at":        nil,
+	}).Error
+}
+
+// warnOwners emails the owners of an organization that is over its plan.
+func (e *Enforcer) warnOwners(ctx context.Context, org models.Organization, status Status, purgeAfter time.Time) error {
+	var owners []models.User
+	if err := e.db.WithContext(ctx).
+		Joins("JOIN memberships ON memberships.user_id = users.id").
+		Where("memberships.organization_id = ? AND memberships.role = ?", org.ID, models.MembershipRoleOwner).
+		Find(&owners).Error; err != nil {
+		return err
+	}
+
+	for _, owner := range owners {
+		data := map[string]interface{}{
+			"Name":            owner.FullName,
+			"Organization":    org.Name,
+			"Plan":            status.Plan,
+			"Results":         strconv.FormatInt(status.Results.Used, 10),
+			"ResultsLimit":    limitString(status.Results.Limit),
+			"ArtifactMB":      strconv.FormatInt(status.ArtifactBytes.Used>>20, 10),
+			"ArtifactMBLimit": limitString(status.ArtifactBytes.Limit >> 20),
+			"PurgeAfter":      purgeAfter.Format(time.RFC1123),
+			"Link":            e.cfg.FrontendLink("/organizations/" + org.ID.String()),
+		}
+		if err := e.renderer.SendForOrganization(ctx, e.mailer, org.ID, mail.TemplateStorageQuotaWarning, owner.Email, data); err != nil {
+			slog.ErrorContext(ctx, "Failed to send storage plan warning", "organization_id", org.ID, "user_id", owner.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func limitString(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
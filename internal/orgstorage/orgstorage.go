@@ -0,0 +1,146 @@
+// Package orgstorage accounts for the data stored for the scans of
+// organizations and enforces their storage plans (see
+// config.OrgStorageConfig).
+//
+// Plans are soft caps. Results of running scans are always stored, but new
+// artifacts are refused once they would exceed the artifact cap. An
+// organization over either cap is flagged and its owners are warned by
+// email; once it has been over for the grace period, its oldest finished
+// scans are deleted through the retention purger until it fits again.
+//
+// Usage counts every scan shared with the organization, deleted ones
+// included, since their rows are kept until they are purged.
+package orgstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Meter is the use of one capped resource.
+type Meter struct {
+	// Limit is 0 when the resource is unlimited; Remaining is nil then.
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining *int64 `json:"remaining"`
+}
+
+// Over reports whether more is used than the limit allows.
+func (m Meter) Over() bool {
+	return m.Limit > 0 && m.Used > m.Limit
+}
+
+func meter(used, limit int64) Meter {
+	m := Meter{Limit: limit, Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		m.Remaining = &remaining
+	}
+	return m
+}
+
+// Status is the stored data of an organization measured against its plan.
+type Status struct {
+	// Plan is the name of the plan in effect; empty when the organization
+	// is unlimited.
+	Plan          string `json:"plan"`
+	Scans         int64  `json:"scans"`
+	Results       Meter  `json:"results"`
+	ArtifactBytes Meter  `json:"artifact_bytes"`
+	// ArtifactsBlocked is set once no more artifacts fit the plan.
+	ArtifactsBlocked bool `json:"artifacts_blocked"`
+	OverQuota        bool `json:"over_quota"`
+	// OverQuotaSince and PurgeAfter are set while the organization is over
+	// its plan; its oldest scans are purged from PurgeAfter on.
+	OverQuotaSince *time.Time `json:"over_quota_since"`
+	PurgeAfter     *time.Time `json:"purge_after"`
+}
+
+// Accountant measures the stored data of organizations.
+type Accountant struct {
+	db  *gorm.DB
+	cfg config.OrgStorageConfig
+}
+
+func NewAccountant(db *gorm.DB, cfg config.OrgStorageConfig) *Accountant {
+	return &Accountant{db: db, cfg: cfg}
+}
+
+// Plan returns the name and caps of the plan of org: its own plan or the
+// default plan. Unknown plans, such as one removed from the
+// configuration, cap nothing.
+func (a *Accountant) Plan(org models.Organization) (string, config.StoragePlan) {
+	name := org.Plan
+	if name == "" {
+		name = a.cfg.DefaultPlan
+	}
+	return name, a.cfg.Plans[name]
+}
+
+// Status measures org against its plan.
+func (a *Accountant) Status(ctx context.Context, org models.Organization) (Status, error) {
+	name, plan := a.Plan(org)
+	db := a.db.WithContext(ctx)
+
+	var scans, results, artifactBytes int64
+	if err := scansOf(db, org.ID).Count(&scans).Error; err != nil {
+		return Status{}, err
+	}
+	if err := db.Unscoped().Model(&models.ScanResult{}).
+		Where("scan_id IN (?)", scansOf(db, org.ID).Select("id")).
+		Count(&results).Error; err != nil {
+		return Status{}, err
+	}
+	if err := db.Model(&models.Artifact{}).Select("COALESCE(SUM(size), 0)").
+		Where("scan_id IN (?)", scansOf(db, org.ID).Select("id")).
+		Scan(&artifactBytes).Error; err != nil {
+		return Status{}, err
+	}
+
+	status := Status{
+		Plan:             name,
+		Scans:            scans,
+		Results:          meter(results, plan.Results),
+		ArtifactBytes:    meter(artifactBytes, plan.ArtifactBytes),
+		ArtifactsBlocked: plan.ArtifactBytes > 0 && artifactBytes >= plan.ArtifactBytes,
+	}
+	status.OverQuota = status.Results.Over() || status.ArtifactBytes.Over()
+	if status.OverQuota && org.StorageOverQuotaSince != nil {
+		purgeAfter := org.StorageOverQuotaSince.Add(a.cfg.GracePeriod)
+		status.OverQuotaSince = org.StorageOverQuotaSince
+		status.PurgeAfter = &purgeAfter
+	}
+	return status, nil
+}
+
+// AllowArtifact reports whether an artifact of size bytes for a scan of the
+// organization fits its plan. Scans of no organization are never capped.
+func (a *Accountant) AllowArtifact(ctx context.Context, orgID *uuid.UUID, size int64) (bool, error) {
+	if orgID == nil {
+		return true, nil
+	}
+	var org models.Organization
+	if err := a.db.WithContext(ctx).First(&org, "id = ?", *orgID).Error; err != nil {
+		return false, err
+	}
+	if _, plan := a.Plan(org); plan.ArtifactBytes == 0 {
+		return true, nil
+	}
+	status, err := a.Status(ctx, org)
+	if err != nil {
+		return false, err
+	}
+	return status.ArtifactBytes.Used+size <= status.ArtifactBytes.Limit, nil
+}
+
+// scansOf is a query of the premium scans shared with the organization,
+// deleted ones included.
+func scansOf(db *gorm.DB, orgID uuid.UUID) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.PremiumScan{}).
+		Where("organization_id = ?", orgID)
+}
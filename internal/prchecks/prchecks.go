@@ -0,0 +1,331 @@
+// Package prchecks reports premium scans run for a commit or pull request
+// of a GitHub, GitLab or Bitbucket repository back to it once they finish:
+// a status on the commit (a check run on GitHub) whose conclusion is the
+// scan's gate result and, for pull or merge requests, a comment
+// summarizing the grade and the most severe findings. GitHub is reported
+// to as the GitHub App, the others with the access token of the
+// organization's integration (see package vcs).
+//
+// The gate fails when the scan didn't complete or a test failed with at
+// least the check's FailOn severity; suppressed findings don't count.
+// Repositories may be public, so confidential findings count towards the
+// gate but are never listed (see package classification).
+// Reports are posted by a polling loop, so none is lost to a restart, and
+// retried with backoff while the host can't be reached.
+package prchecks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/github"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/vcs"
+	"gorm.io/gorm"
+)
+
+// CheckName is the name of the statuses.
+const CheckName = "AntiGinx security scan"
+
+// DefaultFailOn is the gate severity of checks that don't set one.
+const DefaultFailOn = "high"
+
+// MaxAttempts is how often posting a report is tried before giving up.
+const MaxAttempts = 8
+
+const (
+	pollInterval = 15 * time.Second
+	batchSize    = 20
+	// topFindings is how many findings the summary lists.
+	topFindings = 10
+	// maxMessageLength bounds a finding's message in the summary, in runes.
+	maxMessageLength = 200
+)
+
+// finishedStatuses are the statuses of scans that are reported.
+var finishedStatuses = []string{"COMPLETED", "FAILED", "CANCELLED", "REJECTED"}
+
+// Reporter posts the reports of finished scans.
+type Reporter struct {
+	db     *gorm.DB
+	github vcs.Client
+	client *http.Client
+	cfg    *config.Config
+}
+
+// NewReporter returns a reporter posting to GitHub as app, and to GitLab
+// and Bitbucket through client. A nil app disables reports to GitHub.
+func NewReporter(db *gorm.DB, app *github.App, client *http.Client, cfg *config.Config) *Reporter {
+	r := &Reporter{db: db, client: client, cfg: cfg}
+	if app != nil {
+		r.github = vcs.GitHub(app)
+	}
+	return r
+}
+
+// Run reports finished scans every few seconds until ctx is cancelled. It
+// returns at once when no provider is configured.
+func (r *Reporter) Run(ctx context.Context) {
+	if r.github == nil && r.cfg.VCSTokenKey == nil {
+		return
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.ReportDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(ctx, "Failed to report pull request checks", "error", err)
+			}
+		}
+	}
+}
+
+// ReportDue posts the reports of finished scans that are due.
+func (r *Reporter) ReportDue(ctx context.Context) error {
+	var checks []models.PullRequestCheck
+	err := r.db.WithContext(ctx).
+		Joins("JOIN premium_scans ON premium_scans.id = pull_request_checks.scan_id AND premium_scans.deleted_at IS NULL").
+		Where("pull_request_checks.reported_at IS NULL AND pull_request_checks.attempts < ? AND pull_request_checks.next_attempt_at <= ?", MaxAttempts, time.Now()).
+		Where("premium_scans.status IN ?", finishedStatuses).
+		Order("pull_request_checks.next_attempt_at").Limit(batchSize).
+		Find(&checks).Error
+	if err != nil {
+		return err
+	}
+
+	for _, check := range checks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		reportErr := r.report(ctx, &check)
+		updates := map[string]interface{}{
+			"conclusion":      check.Conclusion,
+			"status_posted":   check.StatusPosted,
+			"check_run_id":    check.CheckRunID,
+			"comment_id":      check.CommentID,
+			"attempts":        check.Attempts + 1,
+			"last_error":      "",
+			"next_attempt_at": time.Now().Add(backoff(check.Attempts + 1)),
+		}
+		if reportErr != nil {
+			updates["last_error"] = reportErr.Error()
+			slog.WarnContext(ctx, "Failed to report scan to repository", "scan_id", check.ScanID, "provider", check.Provider, "repository", check.Repository, "attempt", check.Attempts+1, "error", reportErr)
+		} else {
+			updates["reported_at"] = time.Now()
+		}
+		if err := r.db.WithContext(ctx).Model(&check).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the delay after the attempt-th failed attempt: a minute,
+// doubling up to an hour.
+func backoff(attempt int) time.Duration {
+	return min(time.Minute<<min(attempt-1, 6), time.Hour)
+}
+
+// report posts what of check is still missing, recording what was posted
+// in check.
+func (r *Reporter) report(ctx context.Context, check *models.PullRequestCheck) error {
+	host, err := r.host(ctx, check)
+	if err != nil {
+		return err
+	}
+	var scan models.PremiumScan
+	if err := r.db.WithContext(ctx).First(&scan, "id = ?", check.ScanID).Error; err != nil {
+		return err
+	}
+	var findings []models.ScanResult
+	if err := r.db.WithContext(ctx).
+		Where("scan_id = ? AND NOT passed AND triage_status <> ?", scan.ID, models.TriageSuppressed).
+		Order("severity_rank DESC, test_name").
+		Find(&findings).Error; err != nil {
+		return err
+	}
+
+	outbound, err := classification.For(r.db.WithContext(ctx), scan.UserID, classification.ChannelPullRequest, false)
+	if err != nil {
+		return err
+	}
+
+	report := evaluate(scan, findings, outbound.Results(findings), check.FailOn)
+	report.Link = r.cfg.FrontendLink("/scans/" + scan.ID.String())
+	check.Conclusion = report.Conclusion
+
+	// Checks posted before statuses were flagged only have the check run.
+	if !check.StatusPosted && check.CheckRunID == 0 {
+		id, err := host.SetStatus(ctx, check.Repository, vcs.Status{
+			Name:       CheckName,
+			SHA:        check.SHA,
+			Conclusion: report.Conclusion,
+			Title:      report.Title,
+			Summary:    report.Summary(),
+			DetailsURL: report.Link,
+		})
+		if err != nil {
+			return fmt.Errorf("posting the commit status: %w", err)
+		}
+		check.CheckRunID = id
+		check.StatusPosted = true
+	}
+	if check.PullRequest > 0 && check.CommentID == 0 {
+		comment := report.Summary() + "\n\n_" + CheckName + " of " + shortSHA(check.SHA) + "_\n"
+		id, err := host.Comment(ctx, check.Repository, check.PullRequest, comment)
+		if err != nil {
+			return fmt.Errorf("commenting on the pull request: %w", err)
+		}
+		check.CommentID = id
+	}
+	return nil
+}
+
+// host returns the client of the repository host of check.
+func (r *Reporter) host(ctx context.Context, check *models.PullRequestCheck) (vcs.Client, error) {
+	if check.Provider == vcs.ProviderGitHub {
+		if r.github == nil {
+			return nil, errors.New("the GitHub integration is not configured")
+		}
+		return r.github, nil
+	}
+	if check.IntegrationID == nil {
+		return nil, fmt.Errorf("the check has no %s integration", check.Provider)
+	}
+	var integration models.VCSIntegration
+	if err := r.db.WithContext(ctx).First(&integration, "id = ?", *check.IntegrationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("the organization's %s integration was removed", check.Provider)
+		}
+		return nil, err
+	}
+	token, err := vcs.OpenToken(r.cfg.VCSTokenKey, integration.ID, integration.SealedToken)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the %s token: %w", integration.Provider, err)
+	}
+	return vcs.New(integration.Provider, integration.BaseURL, token, r.client)
+}
+
+// Report is the gate result of a finished scan.
+type Report struct {
+	Conclusion string
+	Title      string
+	TargetURL  string
+	Grade      string
+	Score      *float64
+	FailOn     string
+	// Failed is the number of failed tests; Blocking those that fail the
+	// gate.
+	Failed   int
+	Blocking int
+	// Top are the most severe findings that may be listed; Withheld
+	// counts the confidential ones.
+	Top      []models.ScanResult
+	Withheld int
+	Link     string
+}
+
+// evaluate applies the gate to a finished scan and its failed,
+// unsuppressed results ordered by severity. disclosed are the findings
+// that may be listed.
+func evaluate(scan models.PremiumScan, findings, disclosed []models.ScanResult, failOn string) Report {
+	if failOn == "" {
+		failOn = DefaultFailOn
+	}
+	report := Report{
+		TargetURL: scan.TargetURL,
+		Grade:     scan.Grade,
+		Score:     scan.Score,
+		FailOn:    failOn,
+		Failed:    len(findings),
+		Top:       disclosed[:min(len(disclosed), topFindings)],
+		Withheld:  len(findings) - len(disclosed),
+	}
+	threshold := models.SeverityRank(failOn)
+	for _, f := range findings {
+		if f.SeverityRank >= threshold {
+			report.Blocking++
+		}
+	}
+
+	switch scan.Status {
+	case "COMPLETED":
+		if report.Blocking > 0 {
+			report.Conclusion = vcs.ConclusionFailure
+			report.Title = fmt.Sprintf("Failed: %d %s of %s severity or worse", report.Blocking, plural(report.Blocking, "finding"), failOn)
+		} else {
+			report.Conclusion = vcs.ConclusionSuccess
+			report.Title = "Passed"
+			if scan.Grade != "" {
+				report.Title += ": grade " + scan.Grade
+			}
+		}
+	case "FAILED":
+		report.Conclusion = vcs.ConclusionFailure
+		report.Title = "Scan failed to run"
+	case "REJECTED":
+		report.Conclusion = vcs.ConclusionNeutral
+		report.Title = "Scan was rejected by an approver"
+	default:
+		report.Conclusion = vcs.ConclusionCancelled
+		report.Title = "Scan was cancelled"
+	}
+	return report
+}
+
+// Summary renders the report as Markdown.
+func (rep Report) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** of %s: %s\n\n", CheckName, rep.TargetURL, rep.Title)
+	if rep.Grade != "" && rep.Score != nil {
+		fmt.Fprintf(&b, "Grade **%s** (score %.1f), ", rep.Grade, *rep.Score)
+	}
+	fmt.Fprintf(&b, "%d failed %s; the gate fails on **%s** severity or worse.\n", rep.Failed, plural(rep.Failed, "test"), rep.FailOn)
+
+	if len(rep.Top) > 0 {
+		b.WriteString("\n| Severity | Test | Finding |\n| --- | --- | --- |\n")
+		for _, f := range rep.Top {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", cell(f.Severity), cell(f.TestName), cell(f.Message))
+		}
+		if more := rep.Failed - rep.Withheld - len(rep.Top); more > 0 {
+			fmt.Fprintf(&b, "\n…and %d more.\n", more)
+		}
+	}
+	if rep.Withheld > 0 {
+		fmt.Fprintf(&b, "\n%d confidential %s not listed.\n", rep.Withheld, plural(rep.Withheld, "finding"))
+	}
+	if rep.Link != "" {
+		fmt.Fprintf(&b, "\n[Full results](%s)\n", rep.Link)
+	}
+	return b.String()
+}
+
+// cell makes text safe for a Markdown table cell.
+func cell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxMessageLength {
+		text = string(runes[:maxMessageLength]) + "…"
+	}
+	return strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func shortSHA(sha string) string {
+	return sha[:min(len(sha), 7)]
+}
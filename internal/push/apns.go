@@ -0,0 +1,133 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Endpoints of the Apple Push Notification service.
+const (
+	APNsProductionURL = "https://api.push.apple.com"
+	APNsSandboxURL    = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenTTL is how long a provider token is reused. APNs rejects tokens
+// older than an hour and refreshing them more often than every 20 minutes.
+const apnsTokenTTL = 50 * time.Minute
+
+// APNsCredentials is the token signing key of an Apple developer team.
+type APNsCredentials struct {
+	KeyID      string
+	TeamID     string
+	PrivateKey *ecdsa.PrivateKey
+	// Topic is the bundle ID of the app.
+	Topic string
+}
+
+// APNs sends notifications to iOS devices through the Apple Push
+// Notification service, over HTTP/2 with provider tokens signed with the
+// team's key. It is safe for concurrent use.
+type APNs struct {
+	creds  APNsCredentials
+	apiURL string
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func NewAPNs(creds APNsCredentials, apiURL string, client *http.Client) *APNs {
+	return &APNs{creds: creds, apiURL: strings.TrimRight(apiURL, "/"), client: client}
+}
+
+// Send sends an alert with the default sound.
+func (a *APNs) Send(ctx context.Context, token string, msg Message) error {
+	providerToken, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range msg.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.apiURL+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("apns-topic", a.creds.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errBody struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.Unmarshal(respBody, &errBody)
+	switch {
+	case resp.StatusCode == http.StatusGone, errBody.Reason == "BadDeviceToken", errBody.Reason == "Unregistered":
+		return ErrUnregistered
+	case errBody.Reason == "ExpiredProviderToken":
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	}
+	return &ServiceError{Service: "APNs", StatusCode: resp.StatusCode, Reason: errBody.Reason}
+}
+
+// providerToken returns the cached provider token, signing a new one when
+// it is due.
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.issuedAt) < apnsTokenTTL {
+		return a.token, nil
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": a.creds.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = a.creds.KeyID
+	signed, err := token.SignedString(a.creds.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	a.token = signed
+	a.issuedAt = now
+	return signed, nil
+}
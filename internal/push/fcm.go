@@ -0,0 +1,191 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultFCMURL is the HTTP v1 API of Firebase Cloud Messaging.
+const DefaultFCMURL = "https://fcm.googleapis.com"
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMCredentials is the service account of a Firebase project that sends
+// its messages.
+type FCMCredentials struct {
+	ProjectID   string
+	ClientEmail string
+	PrivateKey  *rsa.PrivateKey
+	// TokenURL issues the OAuth access tokens of the service account.
+	TokenURL string
+}
+
+// ParseFCMCredentials parses the JSON key file of a service account, as
+// downloaded from the Firebase console.
+func ParseFCMCredentials(raw []byte) (FCMCredentials, error) {
+	var file struct {
+		Type        string `json:"type"`
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return FCMCredentials{}, err
+	}
+	if file.Type != "service_account" || file.ProjectID == "" || file.ClientEmail == "" || file.TokenURI == "" {
+		return FCMCredentials{}, errors.New("not the key file of a service account")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(file.PrivateKey))
+	if err != nil {
+		return FCMCredentials{}, err
+	}
+	return FCMCredentials{ProjectID: file.ProjectID, ClientEmail: file.ClientEmail, PrivateKey: key, TokenURL: file.TokenURI}, nil
+}
+
+// FCM sends notifications to Android devices through Firebase Cloud
+// Messaging, authenticating with short-lived access tokens of a service
+// account. It is safe for concurrent use.
+type FCM struct {
+	creds  FCMCredentials
+	apiURL string
+	client *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewFCM(creds FCMCredentials, apiURL string, client *http.Client) *FCM {
+	return &FCM{creds: creds, apiURL: strings.TrimRight(apiURL, "/"), client: client}
+}
+
+// Send sends a notification with high priority, so that it is shown at once
+// rather than batched by the device.
+func (f *FCM) Send(ctx context.Context, token string, msg Message) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+			"android":      map[string]string{"priority": "high"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := f.apiURL + "/v1/projects/" + url.PathEscape(f.creds.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errBody struct {
+		Error struct {
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(respBody, &errBody)
+	reason := errBody.Error.Status
+	for _, detail := range errBody.Error.Details {
+		if detail.ErrorCode != "" {
+			reason = detail.ErrorCode
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound || reason == "UNREGISTERED" {
+		return ErrUnregistered
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+	return &ServiceError{Service: "FCM", StatusCode: resp.StatusCode, Reason: reason}
+}
+
+// token returns the cached access token, exchanging a JWT assertion of the
+// service account for a new one when it is about to expire.
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Until(f.expiresAt) > time.Minute {
+		return f.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.creds.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.creds.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(f.creds.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.creds.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding FCM access token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", &ServiceError{Service: "FCM token endpoint", StatusCode: resp.StatusCode, Reason: body.Error}
+	}
+	f.accessToken = body.AccessToken
+	f.expiresAt = now.Add(time.Duration(body.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
@@ -0,0 +1,354 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/gorm"
+)
+
+// Notifier notifies the devices of a user of the events they registered
+// for. Delivery is best effort: failures are logged and not retried, and
+// devices whose tokens were unregistered are removed.
+type Notifier struct {
+	db      *gorm.DB
+	senders map[string]Sender
+	// frontendLink builds the links opened by tapping a notification.
+	frontendLink func(path string) string
+}
+
+// NewNotifier returns a notifier sending through fcm and apns. A nil sender
+// disables its platform.
+func NewNotifier(db *gorm.DB, fcm, apns Sender, frontendLink func(path string) string) *Notifier {
+	senders := map[string]Sender{}
+	if fcm != nil {
+		senders[models.PushPlatformFCM] = fcm
+	}
+	if apns != nil {
+		senders[models.PushPlatformAPNs] = apns
+	}
+	return &Notifier{db: db, senders: senders, frontendLink: frontendLink}
+}
+
+// Enabled reports whether devices of the platform can be notified.
+func (n *Notifier) Enabled(platform string) bool {
+	return n.senders[platform] != nil
+}
+
+// eventData holds the fields of the event data that notifications show.
+type eventData struct {
+	ScanID    string `json:"scan_id"`
+	TargetURL string `json:"target_url"`
+	Grade     string `json:"grade"`
+	FindingID uint   `json:"finding_id"`
+	TestName  string `json:"test_name"`
+	Severity  string `json:"severity"`
+	SLADays   int    `json:"sla_days"`
+	ReportID  string `json:"report_id"`
+	Type      string `json:"type"`
+}
+
+// severityCount is how many open findings of a severity a scan has.
+type severityCount struct {
+	ScanID       string
+	Severity     string
+	SeverityRank int
+	Count        int
+}
+
+// pushEvent is an event as its notification shows it.
+type pushEvent struct {
+	eventData
+	// counts are the open findings of a completed scan by severity, most
+	// severe first.
+	counts []severityCount
+	// severity is the rank of a finding, or of the most severe open
+	// finding of a completed scan.
+	severity int
+}
+
+// Notify sends the notification of an event, or of a webhooks.Digest of
+// events, to the devices of the user subscribed to it. It implements
+// webhooks.Notifier.
+func (n *Notifier) Notify(ctx context.Context, userID uuid.UUID, event string, data interface{}) {
+	if len(n.senders) == 0 || !slices.Contains(SupportedEvents, event) {
+		return
+	}
+	if err := n.notify(ctx, userID, event, data); err != nil {
+		slog.ErrorContext(ctx, "Failed to send push notifications", "event", event, "user_id", userID, "error", err)
+	}
+}
+
+func (n *Notifier) notify(ctx context.Context, userID uuid.UUID, event string, data interface{}) error {
+	var devices []models.PushDevice
+	if err := n.db.WithContext(ctx).Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return err
+	}
+	devices = slices.DeleteFunc(devices, func(d models.PushDevice) bool {
+		return n.senders[d.Platform] == nil || !slices.Contains(d.Events, event)
+	})
+	if len(devices) == 0 {
+		return nil
+	}
+
+	items, total := []interface{}{data}, 1
+	if digest, ok := data.(webhooks.Digest); ok {
+		items, total = digest.Data, digest.Count
+	}
+	events, err := n.load(ctx, userID, event, items)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		matching := events
+		count := total
+		if device.MinSeverity != "" && severityFiltered(event) {
+			minRank := models.SeverityRank(device.MinSeverity)
+			matching = slices.DeleteFunc(slices.Clone(events), func(e pushEvent) bool { return e.severity < minRank })
+			count = len(matching)
+		}
+		var msg Message
+		switch {
+		case len(matching) == 0:
+			continue
+		case count == 1:
+			msg = n.message(event, matching[0])
+		default:
+			msg = n.digestMessage(event, matching, count)
+		}
+
+		err := n.senders[device.Platform].Send(ctx, device.Token, msg)
+		switch {
+		case errors.Is(err, ErrUnregistered):
+			slog.InfoContext(ctx, "Removing unregistered push device", "device_id", device.ID, "platform", device.Platform)
+			if err := n.db.WithContext(ctx).Delete(&device).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			slog.ErrorContext(ctx, "Failed to send push notification", "device_id", device.ID, "platform", device.Platform, "event", event, "error", err)
+		default:
+			if err := n.db.WithContext(ctx).Model(&device).Update("last_notified_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// load reads the fields of the events' data that notifications show, with
+// the open findings of completed scans.
+func (n *Notifier) load(ctx context.Context, userID uuid.UUID, event string, items []interface{}) ([]pushEvent, error) {
+	var outbound *classification.Outbound
+	events := make([]pushEvent, 0, len(items))
+	scanIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var e pushEvent
+		if err := json.Unmarshal(raw, &e.eventData); err != nil {
+			return nil, err
+		}
+		e.severity = models.SeverityRank(e.Severity)
+		// Notifications are shown on lock screens, so the names of
+		// confidential tests are left out.
+		if f, ok := item.(webhooks.Finding); ok {
+			if outbound == nil {
+				loaded, err := classification.For(n.db.WithContext(ctx), userID, classification.ChannelPush, false)
+				if err != nil {
+					return nil, err
+				}
+				outbound = &loaded
+			}
+			if !outbound.Discloses(f.TestName) {
+				e.TestName = ""
+			}
+		}
+		events = append(events, e)
+		scanIDs = append(scanIDs, e.ScanID)
+	}
+	if event != webhooks.EventScanCompleted {
+		return events, nil
+	}
+
+	// The severity of a scan is that of its most severe open finding.
+	var counts []severityCount
+	err := n.db.WithContext(ctx).Model(&models.ScanResult{}).
+		Select("scan_id, severity, severity_rank, COUNT(*) AS count").
+		Where("scan_id IN ? AND NOT passed AND triage_status <> ?", scanIDs, models.TriageSuppressed).
+		Group("scan_id, severity, severity_rank").Order("severity_rank DESC").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		for _, count := range counts {
+			if count.ScanID == events[i].ScanID {
+				events[i].counts = append(events[i].counts, count)
+			}
+		}
+		if len(events[i].counts) > 0 {
+			events[i].severity = events[i].counts[0].SeverityRank
+		}
+	}
+	return events, nil
+}
+
+// severityFiltered reports whether the notifications of an event are
+// subject to the MinSeverity of devices.
+func severityFiltered(event string) bool {
+	return event == webhooks.EventScanCompleted || event == webhooks.EventFindingSLABreached
+}
+
+// message builds the notification of an event.
+func (n *Notifier) message(event string, fields pushEvent) Message {
+	msg := Message{Data: map[string]string{"event": event}}
+	if fields.ScanID != "" {
+		msg.Data["scan_id"] = fields.ScanID
+		msg.Data["url"] = n.frontendLink("/scans/" + fields.ScanID)
+	}
+	target := host(fields.TargetURL)
+
+	switch event {
+	case webhooks.EventScanCompleted:
+		msg.Title = "Scan of " + target + " completed"
+		msg.Body = findingSummary(fields.counts)
+		if fields.Grade != "" {
+			msg.Body = "Grade " + fields.Grade + ": " + msg.Body
+		}
+	case webhooks.EventScanFailed:
+		msg.Title = "Scan of " + target + " failed"
+		msg.Body = fields.TargetURL
+	case webhooks.EventScanApprovalRequested:
+		msg.Title = "Scan awaiting approval"
+		msg.Body = "A scan of " + fields.TargetURL + " needs your approval."
+	case webhooks.EventFindingSLABreached:
+		msg.Data["finding_id"] = strconv.FormatUint(uint64(fields.FindingID), 10)
+		finding := "A " + strings.ToLower(fields.Severity) + " finding"
+		if fields.TestName != "" {
+			finding += " (" + fields.TestName + ")"
+		}
+		msg.Title = "SLA breached on " + target
+		msg.Body = fmt.Sprintf("%s is open past its %d-day SLA.", finding, fields.SLADays)
+	case webhooks.EventReportCompleted:
+		msg.Data["report_id"] = fields.ReportID
+		msg.Title = "Report ready"
+		msg.Body = "Your " + strings.ReplaceAll(fields.Type, "_", " ") + " report is ready to download."
+	}
+	return msg
+}
+
+// digestMessage builds the notification of count events, which summarizes
+// them and links to their scan, or to the list of scans or findings when
+// they are of several.
+func (n *Notifier) digestMessage(event string, events []pushEvent, count int) Message {
+	msg := Message{Data: map[string]string{"event": event, "count": strconv.Itoa(count)}}
+	scanID := events[0].ScanID
+	var targets []string
+	for _, e := range events {
+		if e.ScanID != scanID {
+			scanID = ""
+		}
+		if target := host(e.TargetURL); target != "" && !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	if scanID != "" {
+		msg.Data["scan_id"] = scanID
+		msg.Data["url"] = n.frontendLink("/scans/" + scanID)
+	} else if event == webhooks.EventFindingSLABreached {
+		msg.Data["url"] = n.frontendLink("/findings")
+	} else {
+		msg.Data["url"] = n.frontendLink("/scans")
+	}
+	on := targetList(targets)
+
+	switch event {
+	case webhooks.EventScanCompleted:
+		msg.Title = strconv.Itoa(count) + " scans completed"
+		msg.Body = "Scans of " + on + " completed."
+		if worst := slices.MaxFunc(events, func(a, b pushEvent) int { return a.severity - b.severity }); worst.severity > 0 {
+			msg.Body += " The most severe open finding is " + strings.ToLower(worst.counts[0].Severity) + "."
+		}
+	case webhooks.EventScanFailed:
+		msg.Title = strconv.Itoa(count) + " scans failed"
+		msg.Body = "Scans of " + on + " failed."
+	case webhooks.EventScanApprovalRequested:
+		msg.Title = strconv.Itoa(count) + " scans awaiting approval"
+		msg.Body = "Scans of " + on + " need your approval."
+	case webhooks.EventFindingSLABreached:
+		counts := make([]severityCount, 0)
+		for _, e := range events {
+			i := slices.IndexFunc(counts, func(c severityCount) bool { return c.SeverityRank == e.severity })
+			if i < 0 {
+				counts = append(counts, severityCount{Severity: e.Severity, SeverityRank: e.severity})
+				i = len(counts) - 1
+			}
+			counts[i].Count++
+		}
+		slices.SortFunc(counts, func(a, b severityCount) int { return b.SeverityRank - a.SeverityRank })
+		msg.Title = strconv.Itoa(count) + " findings breached their SLA"
+		msg.Body = findingSummary(counts) + " on " + on + " are open past their SLA."
+	case webhooks.EventReportCompleted:
+		msg.Title = strconv.Itoa(count) + " reports ready"
+		msg.Body = "Your reports are ready to download."
+	}
+	return msg
+}
+
+// targetList names up to two targets, e.g. "a.com, b.com and 3 other
+// targets".
+func targetList(targets []string) string {
+	switch len(targets) {
+	case 0:
+		return "your targets"
+	case 1:
+		return targets[0]
+	case 2:
+		return targets[0] + " and " + targets[1]
+	case 3:
+		return targets[0] + ", " + targets[1] + " and 1 other target"
+	}
+	return fmt.Sprintf("%s, %s and %d other targets", targets[0], targets[1], len(targets)-2)
+}
+
+// findingSummary counts the open findings of a scan by severity, most
+// severe first, e.g. "2 critical, 1 high findings".
+func findingSummary(counts []severityCount) string {
+	if len(counts) == 0 {
+		return "no open findings"
+	}
+	parts := make([]string, 0, len(counts))
+	total := 0
+	for _, count := range counts {
+		parts = append(parts, strconv.Itoa(count.Count)+" "+strings.ToLower(count.Severity))
+		total += count.Count
+	}
+	if total == 1 {
+		return strings.Join(parts, ", ") + " finding"
+	}
+	return strings.Join(parts, ", ") + " findings"
+}
+
+// host returns the host of a target URL, which fits a notification title
+// better than the URL.
+func host(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return target
+}
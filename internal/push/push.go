@@ -0,0 +1,53 @@
+// Package push sends push notifications of events to the devices of the
+// mobile app: through Firebase Cloud Messaging to Android devices (see
+// FCM) and through the Apple Push Notification service to iOS devices (see
+// APNs). The Notifier receives the events published by package webhooks.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+)
+
+const userAgent = "AntiGinx-Push/1.0"
+
+// maxResponseBody bounds the response bodies read from the push services.
+const maxResponseBody = 64 << 10
+
+// ErrUnregistered is returned for device tokens the push service no longer
+// accepts, e.g. because the app was uninstalled. Their devices are removed.
+var ErrUnregistered = errors.New("device token is no longer registered")
+
+// SupportedEvents lists the events devices may be notified of.
+var SupportedEvents = []string{webhooks.EventScanCompleted, webhooks.EventScanFailed, webhooks.EventScanApprovalRequested, webhooks.EventFindingSLABreached, webhooks.EventReportCompleted}
+
+// DefaultEvents are the events of devices registered without a choice.
+var DefaultEvents = []string{webhooks.EventScanCompleted, webhooks.EventFindingSLABreached}
+
+// Message is a notification shown on a device. Data is passed to the app,
+// which opens the scan or finding it refers to when the notification is
+// tapped.
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Sender delivers notifications through one push service.
+type Sender interface {
+	Send(ctx context.Context, token string, msg Message) error
+}
+
+// ServiceError is an error response of a push service.
+type ServiceError struct {
+	Service    string
+	StatusCode int
+	Reason     string
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%s responded with %d: %s", e.Service, e.StatusCode, e.Reason)
+}
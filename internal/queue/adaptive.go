@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AdaptivePrefetchConfig holds the tunables of the adaptive prefetch
+// controller.
+type AdaptivePrefetchConfig struct {
+	// Min and Max bound the prefetch count.
+	Min int
+	Max int
+	// Step is added to the prefetch after a healthy, busy interval.
+	Step int
+	// TargetLatency is the average processing time per delivery above which
+	// the prefetch is halved.
+	TargetLatency time.Duration
+	// DBSaturation is the fraction of the connection pool in use above
+	// which the prefetch is halved (only with a bounded pool).
+	DBSaturation float64
+	// Interval is how often the prefetch is re-evaluated.
+	Interval time.Duration
+}
+
+// DefaultAdaptivePrefetchConfig returns defaults suited to result ingestion
+// against a single Postgres instance.
+func DefaultAdaptivePrefetchConfig() AdaptivePrefetchConfig {
+	return AdaptivePrefetchConfig{
+		Min:           5,
+		Max:           100,
+		Step:          5,
+		TargetLatency: 500 * time.Millisecond,
+		DBSaturation:  0.8,
+		Interval:      10 * time.Second,
+	}
+}
+
+// QosSetter is implemented by *amqp.Channel.
+type QosSetter interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+}
+
+// AdaptivePrefetch tunes a consumer's prefetch with additive increase and
+// multiplicative decrease: it grows while deliveries are processed quickly
+// and the consumer keeps all its slots busy, and halves as soon as
+// processing latency exceeds the target or the database connection pool
+// saturates.
+type AdaptivePrefetch struct {
+	cfg     AdaptivePrefetchConfig
+	dbStats func() sql.DBStats
+
+	mu        sync.Mutex
+	current   int
+	processed int
+	totalTime time.Duration
+	lastWaits int64
+}
+
+// NewAdaptivePrefetch creates a controller. dbStats may be nil, in which
+// case only processing latency is considered.
+func NewAdaptivePrefetch(cfg AdaptivePrefetchConfig, dbStats func() sql.DBStats) *AdaptivePrefetch {
+	return &AdaptivePrefetch{
+		cfg:     cfg,
+		dbStats: dbStats,
+		current: cfg.Min,
+	}
+}
+
+// Current returns the prefetch count in effect.
+func (a *AdaptivePrefetch) Current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// Observe records the processing time of one delivery.
+func (a *AdaptivePrefetch) Observe(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.processed++
+	a.totalTime += d
+}
+
+// Run re-evaluates the prefetch every interval and applies changes with a
+// channel-wide basic.qos, which (unlike a per-consumer limit) takes effect
+// for consumers that are already running.
+func (a *AdaptivePrefetch) Run(ctx context.Context, ch QosSetter, name string) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			prev, next := a.adjust()
+			if next == prev {
+				continue
+			}
+			if err := ch.Qos(next, 0, true); err != nil {
+				slog.Error("Failed to change prefetch", "consumer", name, "prefetch", next, "error", err)
+				a.mu.Lock()
+				a.current = prev
+				a.mu.Unlock()
+				continue
+			}
+			slog.Info("Prefetch changed", "consumer", name, "from", prev, "to", next)
+		}
+	}
+}
+
+func (a *AdaptivePrefetch) adjust() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	prev := a.current
+	processed, total := a.processed, a.totalTime
+	a.processed, a.totalTime = 0, 0
+
+	overloaded := false
+	if processed > 0 && total/time.Duration(processed) > a.cfg.TargetLatency {
+		overloaded = true
+	}
+	if a.dbStats != nil {
+		stats := a.dbStats()
+		if stats.MaxOpenConnections > 0 &&
+			float64(stats.InUse)/float64(stats.MaxOpenConnections) >= a.cfg.DBSaturation {
+			overloaded = true
+		}
+		// Goroutines had to wait for a connection since the last check.
+		if stats.WaitCount > a.lastWaits {
+			overloaded = true
+		}
+		a.lastWaits = stats.WaitCount
+	}
+
+	switch {
+	case overloaded:
+		a.current = max(a.cfg.Min, a.current/2)
+	case processed >= a.current:
+		// Every slot was used at least once: there is backlog to absorb.
+		a.current = min(a.cfg.Max, a.current+a.cfg.Step)
+	}
+	return prev, a.current
+}
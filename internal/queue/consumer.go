@@ -0,0 +1,208 @@
+// Package queue contains the RabbitMQ plumbing shared by the API and the
+// workers: consumers with bounded prefetch and graceful draining, and a
+// publisher that recovers from broker restarts. Memory implements the same
+// Transport inside the API process for deployments without RabbitMQ.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrDiscard can be returned (or wrapped) by a Handler to reject a delivery
+// without requeueing it. With a dead-letter exchange configured on the
+// queue the message is dead-lettered, otherwise it is dropped.
+var ErrDiscard = errors.New("discard delivery")
+
+// Handler processes a single delivery. Returning nil acks the delivery,
+// an error wrapping ErrDiscard rejects it and any other error requeues it.
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+// ConsumerConfig configures a Consumer.
+type ConsumerConfig struct {
+	// Queue is the name of the queue to consume.
+	Queue string
+	// Tag identifies the consumer on the channel; required for cancelling.
+	Tag string
+	// Prefetch is the maximum number of unacknowledged deliveries the
+	// broker sends to this consumer.
+	Prefetch int
+	// Workers is the number of deliveries processed concurrently. It is
+	// capped at Prefetch, since more workers could never be busy.
+	Workers int
+	// DrainTimeout bounds how long in-flight deliveries may keep running
+	// after shutdown starts. Their context is cancelled afterwards.
+	DrainTimeout time.Duration
+	// Adaptive, when set, replaces the fixed Prefetch with one tuned at
+	// runtime; Workers then defaults to the adaptive maximum.
+	Adaptive *AdaptivePrefetch
+}
+
+// Consumer consumes a queue with manual acknowledgements.
+type Consumer struct {
+	ch      *amqp.Channel
+	cfg     ConsumerConfig
+	handler Handler
+}
+
+func NewConsumer(ch *amqp.Channel, cfg ConsumerConfig, handler Handler) *Consumer {
+	return &Consumer{
+		ch:      ch,
+		cfg:     cfg.withDefaults(),
+		handler: handler,
+	}
+}
+
+// withDefaults fills in the unset fields of cfg and caps Workers.
+func (cfg ConsumerConfig) withDefaults() ConsumerConfig {
+	if cfg.Adaptive != nil {
+		cfg.Prefetch = cfg.Adaptive.Current()
+		if cfg.Workers <= 0 || cfg.Workers > cfg.Adaptive.cfg.Max {
+			cfg.Workers = cfg.Adaptive.cfg.Max
+		}
+	} else {
+		if cfg.Prefetch <= 0 {
+			cfg.Prefetch = 10
+		}
+		if cfg.Workers <= 0 {
+			cfg.Workers = 1
+		}
+		if cfg.Workers > cfg.Prefetch {
+			cfg.Workers = cfg.Prefetch
+		}
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// Run consumes until ctx is cancelled or the channel closes. On shutdown it
+// cancels the consumer so the broker stops sending, requeues deliveries
+// that were received but not started, and waits up to DrainTimeout for
+// in-flight deliveries to finish.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.ch.Qos(c.cfg.Prefetch, 0, c.cfg.Adaptive != nil); err != nil {
+		return fmt.Errorf("setting prefetch on %s: %w", c.cfg.Queue, err)
+	}
+
+	deliveries, err := c.ch.Consume(c.cfg.Queue, c.cfg.Tag, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("consuming %s: %w", c.cfg.Queue, err)
+	}
+
+	// Handlers get their own context so shutdown doesn't abort work that
+	// can still finish within the drain timeout.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	if c.cfg.Adaptive != nil {
+		// The controller tunes this channel only; a restarted consumer
+		// starts it again on its new channel.
+		adaptiveCtx, stopAdaptive := context.WithCancel(ctx)
+		defer stopAdaptive()
+		go c.cfg.Adaptive.Run(adaptiveCtx, c.ch, c.cfg.Tag)
+	}
+
+	work := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < c.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range work {
+				c.process(handlerCtx, d)
+			}
+		}()
+	}
+
+	closed := false
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case d, ok := <-deliveries:
+			if !ok {
+				closed = true
+				break loop
+			}
+			select {
+			case work <- d:
+			case <-ctx.Done():
+				requeue(d)
+				break loop
+			}
+		}
+	}
+
+	if !closed {
+		if err := c.ch.Cancel(c.cfg.Tag, false); err != nil {
+			slog.Error("Failed to cancel consumer", "consumer", c.cfg.Tag, "error", err)
+		}
+		// After Cancel the broker stops sending; anything already buffered
+		// client-side goes back to the queue for another consumer.
+		for d := range deliveries {
+			requeue(d)
+		}
+	}
+	close(work)
+	drain(&wg, c.cfg, cancelHandlers)
+
+	if closed && ctx.Err() == nil {
+		return fmt.Errorf("delivery channel for %s closed", c.cfg.Queue)
+	}
+	return nil
+}
+
+// drain waits up to cfg.DrainTimeout for the workers in wg to finish their
+// deliveries, then cancels the handlers and waits for the rest.
+func drain(wg *sync.WaitGroup, cfg ConsumerConfig, cancelHandlers context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.DrainTimeout):
+		slog.Warn("Drain timeout reached, cancelling in-flight deliveries", "consumer", cfg.Tag)
+		cancelHandlers()
+		<-done
+	}
+}
+
+func (c *Consumer) process(ctx context.Context, d amqp.Delivery) {
+	start := time.Now()
+	err := c.handler(ctx, d)
+	if c.cfg.Adaptive != nil {
+		c.cfg.Adaptive.Observe(time.Since(start))
+	}
+
+	switch {
+	case err == nil:
+		if ackErr := d.Ack(false); ackErr != nil {
+			slog.Error("Failed to ack delivery", "consumer", c.cfg.Tag, "delivery_tag", d.DeliveryTag, "error", ackErr)
+		}
+	case errors.Is(err, ErrDiscard):
+		slog.Warn("Rejecting delivery", "consumer", c.cfg.Tag, "delivery_tag", d.DeliveryTag, "error", err)
+		if nackErr := d.Nack(false, false); nackErr != nil {
+			slog.Error("Failed to reject delivery", "consumer", c.cfg.Tag, "delivery_tag", d.DeliveryTag, "error", nackErr)
+		}
+	default:
+		slog.Warn("Requeueing delivery", "consumer", c.cfg.Tag, "delivery_tag", d.DeliveryTag, "error", err)
+		requeue(d)
+	}
+}
+
+func requeue(d amqp.Delivery) {
+	if err := d.Nack(false, true); err != nil {
+		slog.Error("Failed to requeue delivery", "delivery_tag", d.DeliveryTag, "error", err)
+	}
+}
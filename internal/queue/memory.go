@@ -0,0 +1,640 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// errUnknownDelivery is returned when a delivery is acknowledged twice.
+var errUnknownDelivery = errors.New("unknown delivery tag")
+
+// Memory is a Transport that keeps its queues in the API process, for
+// deployments that don't run RabbitMQ. It covers the part of AMQP the API
+// relies on: the default, direct and fanout exchanges, message priorities,
+// message TTLs and dead-lettering. Every message is saved as a
+// models.QueuedMessage until it is acknowledged, so queued messages
+// survive a restart and deliveries that weren't acknowledged are made
+// again. Only consumers in the same process can reach its queues.
+type Memory struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	exchanges map[string]*memoryExchange
+	queues    map[string]*memoryQueue
+	unacked   map[uint64]*memoryMessage
+	lastTag   uint64
+	closed    bool
+}
+
+type memoryExchange struct {
+	kind     string
+	bindings []memoryBinding
+}
+
+type memoryBinding struct {
+	queue, key string
+}
+
+type memoryQueue struct {
+	name string
+	// Rejected and expired messages are routed to deadLetterExchange
+	// with deadLetterKey, or their own routing key if it is nil, when
+	// deadLetter is set, and dropped otherwise.
+	deadLetter         bool
+	deadLetterExchange string
+	deadLetterKey      *string
+	ttl                time.Duration
+	maxPriority        uint8
+
+	// ready holds the messages waiting for a consumer by priority, then
+	// in publishing order.
+	ready []*memoryMessage
+	// wake is closed when a message becomes ready.
+	wake chan struct{}
+}
+
+type memoryMessage struct {
+	row         models.QueuedMessage
+	publishing  amqp.Publishing
+	queue       *memoryQueue
+	redelivered bool
+	expiry      *time.Timer
+}
+
+// NewMemory declares the topology on a new in-process transport and
+// restores the messages saved by an earlier run.
+func NewMemory(db *gorm.DB, topology Topology) (*Memory, error) {
+	m := &Memory{
+		db:        db,
+		exchanges: map[string]*memoryExchange{},
+		queues:    map[string]*memoryQueue{},
+		unacked:   map[uint64]*memoryMessage{},
+	}
+	if topology != nil {
+		if err := topology(m); err != nil {
+			return nil, fmt.Errorf("declaring the queue topology: %w", err)
+		}
+	}
+
+	var rows []models.QueuedMessage
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("loading queued messages: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, row := range rows {
+		q := m.queues[row.Queue]
+		if q == nil {
+			// The queue is no longer declared; keep its messages
+			// anyway, as a broker would.
+			q = &memoryQueue{name: row.Queue, wake: make(chan struct{})}
+			m.queues[row.Queue] = q
+		}
+		m.enqueue(&memoryMessage{row: row, publishing: restoredPublishing(row), queue: q})
+	}
+	return m, nil
+}
+
+// ExchangeDeclare declares a direct or fanout exchange.
+func (m *Memory) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	if kind != amqp.ExchangeDirect && kind != amqp.ExchangeFanout {
+		return fmt.Errorf("exchange %s: %s exchanges are not supported", name, kind)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.exchanges[name]; ok {
+		if e.kind != kind {
+			return fmt.Errorf("exchange %s is already declared as %s", name, e.kind)
+		}
+		return nil
+	}
+	m.exchanges[name] = &memoryExchange{kind: kind}
+	return nil
+}
+
+// QueueDeclare declares a queue. Of the queue arguments it supports
+// x-dead-letter-exchange, x-dead-letter-routing-key, x-message-ttl and
+// x-max-priority; declaring an existing queue again replaces them.
+func (m *Memory) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	settings := memoryQueue{name: name}
+	for k, v := range args {
+		switch k {
+		case "x-dead-letter-exchange":
+			exchange, ok := v.(string)
+			if !ok {
+				return amqp.Queue{}, fmt.Errorf("queue %s: %s must be a string", name, k)
+			}
+			settings.deadLetter, settings.deadLetterExchange = true, exchange
+		case "x-dead-letter-routing-key":
+			key, ok := v.(string)
+			if !ok {
+				return amqp.Queue{}, fmt.Errorf("queue %s: %s must be a string", name, k)
+			}
+			settings.deadLetterKey = &key
+		case "x-message-ttl":
+			ms, ok := tableInt(v)
+			if !ok || ms < 0 {
+				return amqp.Queue{}, fmt.Errorf("queue %s: %s must be a number of milliseconds", name, k)
+			}
+			settings.ttl = time.Duration(ms) * time.Millisecond
+		case "x-max-priority":
+			n, ok := tableInt(v)
+			if !ok || n < 0 || n > 255 {
+				return amqp.Queue{}, fmt.Errorf("queue %s: %s must be between 0 and 255", name, k)
+			}
+			settings.maxPriority = uint8(n)
+		default:
+			return amqp.Queue{}, fmt.Errorf("queue %s: argument %s is not supported", name, k)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.queues[name]
+	if q == nil {
+		q = &memoryQueue{name: name, wake: make(chan struct{})}
+		m.queues[name] = q
+	}
+	q.deadLetter, q.deadLetterExchange, q.deadLetterKey = settings.deadLetter, settings.deadLetterExchange, settings.deadLetterKey
+	q.ttl, q.maxPriority = settings.ttl, settings.maxPriority
+	return amqp.Queue{Name: name, Messages: len(q.ready)}, nil
+}
+
+// QueueBind routes the messages published to exchange with key to a
+// queue.
+func (m *Memory) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.exchanges[exchange]
+	if e == nil {
+		return fmt.Errorf("exchange %s is not declared", exchange)
+	}
+	if m.queues[name] == nil {
+		return fmt.Errorf("queue %s is not declared", name)
+	}
+	b := memoryBinding{queue: name, key: key}
+	for _, existing := range e.bindings {
+		if existing == b {
+			return nil
+		}
+	}
+	e.bindings = append(e.bindings, b)
+	return nil
+}
+
+// QueueUnbind removes a binding, if it exists.
+func (m *Memory) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.exchanges[exchange]
+	if e == nil {
+		return fmt.Errorf("exchange %s is not declared", exchange)
+	}
+	kept := e.bindings[:0]
+	for _, b := range e.bindings {
+		if b != (memoryBinding{queue: name, key: key}) {
+			kept = append(kept, b)
+		}
+	}
+	e.bindings = kept
+	return nil
+}
+
+// PublishWithContext saves a message and adds it to the queues it is
+// routed to. Like RabbitMQ, it drops a message that no queue is bound for.
+func (m *Memory) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	queues, err := m.route(exchange, key)
+	m.mu.Unlock()
+	if err != nil || len(queues) == 0 {
+		return err
+	}
+	return m.deliver(m.db.WithContext(ctx), exchange, key, msg, queues, 0)
+}
+
+// Consume runs handler on the messages of a queue like a Consumer, with
+// cfg.Workers deliveries at once. There is no prefetch to tune, so an
+// adaptive prefetch only sets the number of workers.
+func (m *Memory) Consume(ctx context.Context, cfg ConsumerConfig, handler Handler) {
+	m.mu.Lock()
+	q := m.queues[cfg.Queue]
+	m.mu.Unlock()
+	if q == nil {
+		slog.Error("Consuming a queue that isn't declared", "consumer", cfg.Tag, "queue", cfg.Queue)
+		return
+	}
+	cfg = cfg.withDefaults()
+	cfg.Adaptive = nil
+	c := &Consumer{cfg: cfg, handler: handler}
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				d, ok := m.next(ctx, q)
+				if !ok {
+					return
+				}
+				c.process(handlerCtx, d)
+			}
+		}()
+	}
+	<-ctx.Done()
+	drain(&wg, cfg, cancelHandlers)
+}
+
+// Browse takes messages from a queue one at a time and returns those
+// visit doesn't acknowledge to it afterwards.
+func (m *Memory) Browse(queue string, limit int, visit func(d amqp.Delivery) (bool, error)) error {
+	m.mu.Lock()
+	q := m.queues[queue]
+	m.mu.Unlock()
+	if q == nil {
+		return fmt.Errorf("queue %s is not declared", queue)
+	}
+
+	var taken []uint64
+	defer func() {
+		for _, tag := range taken {
+			if err := m.Nack(tag, false, true); err != nil && !errors.Is(err, errUnknownDelivery) {
+				slog.Error("Failed to return a browsed message", "queue", queue, "error", err)
+			}
+		}
+	}()
+	for i := 0; i < limit; i++ {
+		m.mu.Lock()
+		d, ok := m.take(q)
+		m.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		taken = append(taken, d.DeliveryTag)
+		stop, err := visit(d)
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the consumers. Messages that weren't acknowledged stay
+// saved and are delivered again by the next Memory.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	for _, q := range m.queues {
+		for _, msg := range q.ready {
+			if msg.expiry != nil {
+				msg.expiry.Stop()
+			}
+		}
+		q.signal()
+	}
+	return nil
+}
+
+// Ack deletes a delivered message. Acknowledging several deliveries at
+// once isn't supported.
+func (m *Memory) Ack(tag uint64, multiple bool) error {
+	if multiple {
+		return errors.New("acknowledging multiple deliveries is not supported")
+	}
+	m.mu.Lock()
+	msg := m.unacked[tag]
+	delete(m.unacked, tag)
+	m.mu.Unlock()
+	if msg == nil {
+		return errUnknownDelivery
+	}
+	return m.db.Delete(&models.QueuedMessage{}, msg.row.ID).Error
+}
+
+// Nack returns a delivered message to its queue, or dead-letters it.
+func (m *Memory) Nack(tag uint64, multiple, requeue bool) error {
+	if multiple {
+		return errors.New("rejecting multiple deliveries is not supported")
+	}
+	m.mu.Lock()
+	msg := m.unacked[tag]
+	delete(m.unacked, tag)
+	if msg == nil {
+		m.mu.Unlock()
+		return errUnknownDelivery
+	}
+	if requeue {
+		msg.redelivered = true
+		m.enqueue(msg)
+		m.mu.Unlock()
+		return nil
+	}
+	m.mu.Unlock()
+	return m.deadLetter(msg)
+}
+
+// Reject is Nack of a single delivery.
+func (m *Memory) Reject(tag uint64, requeue bool) error {
+	return m.Nack(tag, false, requeue)
+}
+
+// route returns the queues a message published to exchange with key goes
+// to. The caller must hold m.mu.
+func (m *Memory) route(exchange, key string) ([]*memoryQueue, error) {
+	if exchange == "" {
+		if q := m.queues[key]; q != nil {
+			return []*memoryQueue{q}, nil
+		}
+		return nil, nil
+	}
+	e := m.exchanges[exchange]
+	if e == nil {
+		return nil, fmt.Errorf("exchange %s is not declared", exchange)
+	}
+	var queues []*memoryQueue
+	seen := map[string]bool{}
+	for _, b := range e.bindings {
+		if (e.kind == amqp.ExchangeFanout || b.key == key) && !seen[b.queue] {
+			seen[b.queue] = true
+			if q := m.queues[b.queue]; q != nil {
+				queues = append(queues, q)
+			}
+		}
+	}
+	return queues, nil
+}
+
+// deliver saves a copy of p for each of queues, deleting the message
+// replaces in the same transaction unless it is 0, and adds the copies to
+// the queues.
+func (m *Memory) deliver(db *gorm.DB, exchange, key string, p amqp.Publishing, queues []*memoryQueue, replaces uint64) error {
+	headers, err := json.Marshal(p.Headers)
+	if err != nil {
+		return fmt.Errorf("encoding message headers: %w", err)
+	}
+	now := time.Now()
+	msgs := make([]*memoryMessage, len(queues))
+	for i, q := range queues {
+		msgs[i] = &memoryMessage{
+			row: models.QueuedMessage{
+				Queue:        q.name,
+				Exchange:     exchange,
+				RoutingKey:   key,
+				Headers:      headers,
+				ContentType:  p.ContentType,
+				DeliveryMode: p.DeliveryMode,
+				Priority:     p.Priority,
+				MessageID:    p.MessageId,
+				Timestamp:    p.Timestamp,
+				Expiration:   p.Expiration,
+				Body:         p.Body,
+				ExpiresAt:    q.expiresAt(p, now),
+				CreatedAt:    now,
+			},
+			publishing: p,
+			queue:      q,
+		}
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, msg := range msgs {
+			if err := tx.Create(&msg.row).Error; err != nil {
+				return err
+			}
+		}
+		if replaces != 0 {
+			return tx.Delete(&models.QueuedMessage{}, replaces).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("saving message: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range msgs {
+		m.enqueue(msg)
+	}
+	return nil
+}
+
+// deadLetter routes a rejected or expired message to the dead-letter
+// exchange of its queue, or deletes it if there is none or no queue is
+// bound for it.
+func (m *Memory) deadLetter(msg *memoryMessage) error {
+	q := msg.queue
+	if q.deadLetter {
+		key := msg.row.RoutingKey
+		if q.deadLetterKey != nil {
+			key = *q.deadLetterKey
+		}
+		m.mu.Lock()
+		queues, err := m.route(q.deadLetterExchange, key)
+		m.mu.Unlock()
+		if err == nil && len(queues) > 0 {
+			p := msg.publishing
+			p.Expiration = ""
+			return m.deliver(m.db, q.deadLetterExchange, key, p, queues, msg.row.ID)
+		}
+	}
+	return m.db.Delete(&models.QueuedMessage{}, msg.row.ID).Error
+}
+
+// enqueue makes a message ready in its queue and starts its expiry. The
+// caller must hold m.mu.
+func (m *Memory) enqueue(msg *memoryMessage) {
+	q := msg.queue
+	i := len(q.ready)
+	for i > 0 && !q.before(q.ready[i-1], msg) {
+		i--
+	}
+	q.ready = append(q.ready, nil)
+	copy(q.ready[i+1:], q.ready[i:])
+	q.ready[i] = msg
+
+	if msg.row.ExpiresAt != nil && !m.closed {
+		msg.expiry = time.AfterFunc(time.Until(*msg.row.ExpiresAt), func() { m.expire(msg) })
+	}
+	q.signal()
+}
+
+// take hands out the next ready message of a queue. The caller must hold
+// m.mu.
+func (m *Memory) take(q *memoryQueue) (amqp.Delivery, bool) {
+	if m.closed || len(q.ready) == 0 {
+		return amqp.Delivery{}, false
+	}
+	msg := q.ready[0]
+	q.ready = q.ready[1:]
+	if msg.expiry != nil {
+		msg.expiry.Stop()
+		msg.expiry = nil
+	}
+	m.lastTag++
+	m.unacked[m.lastTag] = msg
+
+	p := msg.publishing
+	return amqp.Delivery{
+		Acknowledger:  m,
+		Headers:       p.Headers,
+		ContentType:   p.ContentType,
+		DeliveryMode:  p.DeliveryMode,
+		Priority:      p.Priority,
+		CorrelationId: p.CorrelationId,
+		ReplyTo:       p.ReplyTo,
+		Expiration:    p.Expiration,
+		MessageId:     p.MessageId,
+		Timestamp:     p.Timestamp,
+		Type:          p.Type,
+		AppId:         p.AppId,
+		DeliveryTag:   m.lastTag,
+		Redelivered:   msg.redelivered,
+		Exchange:      msg.row.Exchange,
+		RoutingKey:    msg.row.RoutingKey,
+		Body:          p.Body,
+	}, true
+}
+
+// next waits for the next message of a queue until ctx is cancelled or
+// the transport is closed.
+func (m *Memory) next(ctx context.Context, q *memoryQueue) (amqp.Delivery, bool) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return amqp.Delivery{}, false
+		}
+		if d, ok := m.take(q); ok {
+			m.mu.Unlock()
+			return d, true
+		}
+		wake := q.wake
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return amqp.Delivery{}, false
+		case <-wake:
+		}
+	}
+}
+
+// expire dead-letters a message whose TTL ran out before it was
+// delivered.
+func (m *Memory) expire(msg *memoryMessage) {
+	m.mu.Lock()
+	if m.closed || !msg.queue.remove(msg) {
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+	if err := m.deadLetter(msg); err != nil {
+		slog.Error("Failed to dead-letter an expired message", "queue", msg.queue.name, "error", err)
+	}
+}
+
+// before reports whether a is delivered before b.
+func (q *memoryQueue) before(a, b *memoryMessage) bool {
+	if pa, pb := min(a.row.Priority, q.maxPriority), min(b.row.Priority, q.maxPriority); pa != pb {
+		return pa > pb
+	}
+	return a.row.ID < b.row.ID
+}
+
+// remove takes a message out of the ready ones, reporting whether it was
+// there.
+func (q *memoryQueue) remove(msg *memoryMessage) bool {
+	for i, ready := range q.ready {
+		if ready == msg {
+			q.ready = append(q.ready[:i], q.ready[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// signal wakes the consumers waiting for the queue.
+func (q *memoryQueue) signal() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// expiresAt returns when a message published now leaves the queue: after
+// the queue's TTL or the message's expiration, whichever is shorter, or
+// nil if neither is set.
+func (q *memoryQueue) expiresAt(p amqp.Publishing, now time.Time) *time.Time {
+	ttl := q.ttl
+	if ms, err := strconv.ParseInt(p.Expiration, 10, 64); err == nil && ms >= 0 {
+		if d := time.Duration(ms) * time.Millisecond; ttl == 0 || d < ttl {
+			ttl = d
+		}
+	} else if ttl == 0 {
+		return nil
+	}
+	at := now.Add(ttl)
+	return &at
+}
+
+// restoredPublishing rebuilds a saved message. JSON loses the integer
+// types of header values, which come back as int64.
+func restoredPublishing(row models.QueuedMessage) amqp.Publishing {
+	var headers amqp.Table
+	dec := json.NewDecoder(bytes.NewReader(row.Headers))
+	dec.UseNumber()
+	if err := dec.Decode(&headers); err != nil && len(row.Headers) > 0 {
+		slog.Warn("Dropping unreadable headers of a queued message", "queue", row.Queue, "id", row.ID, "error", err)
+	}
+	for k, v := range headers {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				headers[k] = i
+			} else if f, err := n.Float64(); err == nil {
+				headers[k] = f
+			}
+		}
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  row.ContentType,
+		DeliveryMode: row.DeliveryMode,
+		Priority:     row.Priority,
+		MessageId:    row.MessageID,
+		Timestamp:    row.Timestamp,
+		Expiration:   row.Expiration,
+		Body:         row.Body,
+	}
+}
+
+// tableInt reads an integer queue argument.
+func tableInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,306 @@
+package queue
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// messageTable answers the statements of a Memory, keeping the queue of
+// each saved message. saved are the rows an earlier run left behind.
+type messageTable struct {
+	mu    sync.Mutex
+	next  int64
+	rows  map[int64]string
+	saved [][]driver.Value
+}
+
+var savedColumns = []string{"id", "queue", "exchange", "routing_key", "headers", "priority", "message_id", "body"}
+
+func (t *messageTable) handle(query string, args []driver.NamedValue) (dbtest.Result, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, `SELECT * FROM "queued_messages"`):
+		return dbtest.Result{Columns: savedColumns, Rows: t.saved}, nil
+	case strings.HasPrefix(query, `INSERT INTO "queued_messages"`):
+		t.next++
+		t.rows[t.next] = args[0].Value.(string)
+		return dbtest.Result{Columns: []string{"id"}, Rows: [][]driver.Value{{t.next}}}, nil
+	case strings.HasPrefix(query, `DELETE FROM "queued_messages"`):
+		id := args[0].Value.(int64)
+		if _, ok := t.rows[id]; !ok {
+			return dbtest.Result{}, fmt.Errorf("message %d is not saved", id)
+		}
+		delete(t.rows, id)
+		return dbtest.Result{RowsAffected: 1}, nil
+	}
+	return dbtest.Result{}, errors.New("unexpected statement: " + query)
+}
+
+func (t *messageTable) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+// testTopology is the API's topology in miniature: rejected tasks go to a
+// retry queue, from which they return to the tasks queue through a wait
+// queue with a short TTL.
+func testTopology(ch Declarer) error {
+	if err := ch.ExchangeDeclare("main", amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.ExchangeDeclare("retry", amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := ch.ExchangeDeclare("control", amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return err
+	}
+	declare := func(name string, args amqp.Table) error {
+		_, err := ch.QueueDeclare(name, true, false, false, false, args)
+		return err
+	}
+	if err := declare("tasks", amqp.Table{"x-dead-letter-exchange": "retry", "x-dead-letter-routing-key": "retry_key", "x-max-priority": int32(10)}); err != nil {
+		return err
+	}
+	if err := ch.QueueBind("tasks", "task_key", "main", false, nil); err != nil {
+		return err
+	}
+	if err := declare("retries", nil); err != nil {
+		return err
+	}
+	if err := ch.QueueBind("retries", "retry_key", "retry", false, nil); err != nil {
+		return err
+	}
+	if err := declare("wait", amqp.Table{"x-message-ttl": int32(20), "x-dead-letter-exchange": "main", "x-dead-letter-routing-key": "task_key"}); err != nil {
+		return err
+	}
+	for _, name := range []string{"control-a", "control-b"} {
+		if err := declare(name, nil); err != nil {
+			return err
+		}
+		if err := ch.QueueBind(name, "", "control", false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestMemory(t *testing.T, table *messageTable) *Memory {
+	t.Helper()
+	if table.rows == nil {
+		table.rows = map[int64]string{}
+	}
+	m, err := NewMemory(dbtest.Open(t, table.handle), testTopology)
+	if err != nil {
+		t.Fatalf("NewMemory() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func publish(t *testing.T, m *Memory, exchange, key string, msg amqp.Publishing) {
+	t.Helper()
+	if err := m.PublishWithContext(context.Background(), exchange, key, false, false, msg); err != nil {
+		t.Fatalf("PublishWithContext(%q, %q) error = %v", exchange, key, err)
+	}
+}
+
+// browse returns the bodies of up to 10 messages of a queue, leaving them
+// in it.
+func browse(t *testing.T, m *Memory, queue string) []string {
+	t.Helper()
+	var bodies []string
+	err := m.Browse(queue, 10, func(d amqp.Delivery) (bool, error) {
+		bodies = append(bodies, string(d.Body))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Browse(%q) error = %v", queue, err)
+	}
+	return bodies
+}
+
+func TestMemoryRouting(t *testing.T) {
+	table := &messageTable{}
+	m := newTestMemory(t, table)
+
+	publish(t, m, "main", "task_key", amqp.Publishing{Body: []byte("task")})
+	publish(t, m, "main", "other_key", amqp.Publishing{Body: []byte("unroutable")})
+	publish(t, m, "", "retries", amqp.Publishing{Body: []byte("direct to queue")})
+	publish(t, m, "control", "anything", amqp.Publishing{Body: []byte("cancel")})
+
+	tests := []struct {
+		queue string
+		want  []string
+	}{
+		{"tasks", []string{"task"}},
+		{"retries", []string{"direct to queue"}},
+		{"control-a", []string{"cancel"}},
+		{"control-b", []string{"cancel"}},
+	}
+	for _, tt := range tests {
+		if got := browse(t, m, tt.queue); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("queue %s holds %q, want %q", tt.queue, got, tt.want)
+		}
+	}
+	if table.count() != 4 {
+		t.Errorf("%d messages are saved, want 4", table.count())
+	}
+
+	err := m.PublishWithContext(context.Background(), "missing", "key", false, false, amqp.Publishing{})
+	if err == nil {
+		t.Error("publishing to an undeclared exchange succeeded")
+	}
+}
+
+func TestMemoryPriorities(t *testing.T) {
+	m := newTestMemory(t, &messageTable{})
+	for _, msg := range []struct {
+		body     string
+		priority uint8
+	}{{"low", 1}, {"normal", 5}, {"high", 9}, {"normal 2", 5}, {"above max", 200}} {
+		publish(t, m, "main", "task_key", amqp.Publishing{Body: []byte(msg.body), Priority: msg.priority})
+	}
+
+	// Priorities above x-max-priority count as the maximum.
+	want := "[above max high normal normal 2 low]"
+	if got := browse(t, m, "tasks"); fmt.Sprint(got) != want {
+		t.Errorf("first browse = %q, want %s", got, want)
+	}
+	// Browsed messages that weren't acknowledged return to their place.
+	if got := browse(t, m, "tasks"); fmt.Sprint(got) != want {
+		t.Errorf("second browse = %q, want %s", got, want)
+	}
+}
+
+func TestMemoryConsume(t *testing.T) {
+	tests := []struct {
+		name string
+		// results are what the handler returns for each delivery.
+		results []error
+		// want are the handler's deliveries as body/redelivered.
+		want []string
+	}{
+		{"ack", []error{nil}, []string{"task/false"}},
+		{"requeue", []error{errors.New("busy"), nil}, []string{"task/false", "task/true"}},
+		{"discard goes through the retry and wait queues", []error{ErrDiscard, nil}, []string{"task/false", "retried/false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &messageTable{}
+			m := newTestMemory(t, table)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var mu sync.Mutex
+			var got []string
+			done := make(chan struct{})
+			go m.Consume(ctx, ConsumerConfig{Queue: "tasks", Tag: "test"}, func(_ context.Context, d amqp.Delivery) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, fmt.Sprintf("%s/%t", d.Body, d.Redelivered))
+				err := tt.results[len(got)-1]
+				if len(got) == len(tt.results) {
+					close(done)
+				}
+				return err
+			})
+			// The retry consumer sends rejected tasks back through the
+			// wait queue, like handlers.HandleRejectedTask.
+			go m.Consume(ctx, ConsumerConfig{Queue: "retries", Tag: "retry"}, func(ctx context.Context, d amqp.Delivery) error {
+				return m.PublishWithContext(ctx, "", "wait", false, false, amqp.Publishing{Body: []byte("retried")})
+			})
+
+			publish(t, m, "main", "task_key", amqp.Publishing{Body: []byte("task")})
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				mu.Lock()
+				defer mu.Unlock()
+				t.Fatalf("handler got %q, want %q", got, tt.want)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("handler got %q, want %q", got, tt.want)
+			}
+			deadline := time.Now().Add(time.Second)
+			for table.count() != 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if table.count() != 0 {
+				t.Errorf("%d messages are still saved after the last ack", table.count())
+			}
+		})
+	}
+}
+
+func TestMemoryRestoresSavedMessages(t *testing.T) {
+	table := &messageTable{
+		next: 2,
+		rows: map[int64]string{1: "tasks", 2: "tasks"},
+		saved: [][]driver.Value{
+			{int64(1), "tasks", "main", "task_key", []byte(`{"x-attempts":2}`), int64(0), "first", []byte("first task")},
+			{int64(2), "tasks", "main", "task_key", []byte(`null`), int64(0), "second", []byte("second task")},
+		},
+	}
+	m := newTestMemory(t, table)
+
+	var got []amqp.Delivery
+	err := m.Browse("tasks", 10, func(d amqp.Delivery) (bool, error) {
+		got = append(got, d)
+		return false, d.Ack(false)
+	})
+	if err != nil {
+		t.Fatalf("Browse() error = %v", err)
+	}
+	if len(got) != 2 || got[0].MessageId != "first" || got[1].MessageId != "second" {
+		t.Fatalf("restored messages = %+v, want first and second", got)
+	}
+	if attempts, ok := got[0].Headers["x-attempts"].(int64); !ok || attempts != 2 {
+		t.Errorf("restored header x-attempts = %#v, want int64(2)", got[0].Headers["x-attempts"])
+	}
+	if table.count() != 0 {
+		t.Errorf("%d messages are still saved after acknowledging them", table.count())
+	}
+	if err := got[0].Ack(false); !errors.Is(err, errUnknownDelivery) {
+		t.Errorf("second Ack() error = %v, want errUnknownDelivery", err)
+	}
+}
+
+func TestMemoryQueueArguments(t *testing.T) {
+	m := newTestMemory(t, &messageTable{})
+	tests := []struct {
+		name string
+		args amqp.Table
+	}{
+		{"unsupported argument", amqp.Table{"x-queue-type": "quorum"}},
+		{"TTL not a number", amqp.Table{"x-message-ttl": "5000"}},
+		{"priority out of range", amqp.Table{"x-max-priority": int32(300)}},
+		{"dead-letter exchange not a string", amqp.Table{"x-dead-letter-exchange": int32(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.QueueDeclare("invalid", true, false, false, false, tt.args); err == nil {
+				t.Errorf("QueueDeclare(%v) succeeded", tt.args)
+			}
+		})
+	}
+	if err := m.ExchangeDeclare("topic", amqp.ExchangeTopic, true, false, false, false, nil); err == nil {
+		t.Error("declaring a topic exchange succeeded")
+	}
+	if err := m.ExchangeDeclare("main", amqp.ExchangeFanout, true, false, false, false, nil); err == nil {
+		t.Error("redeclaring an exchange with another kind succeeded")
+	}
+}
@@ -0,0 +1,309 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrUnavailable is returned by Publish while the broker can't be reached.
+var ErrUnavailable = errors.New("message broker is unavailable")
+
+// Reconnection backoff bounds.
+const (
+	minReconnectBackoff = 500 * time.Millisecond
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// Topology declares the exchanges and queues a transport relies on. A
+// Publisher runs it on every new channel, so declarations must be
+// idempotent.
+type Topology func(ch Declarer) error
+
+// Publisher publishes on a connection that survives broker restarts. When
+// the connection or channel closes unexpectedly it reconnects in the
+// background with exponential backoff and declares the topology again.
+// Publishes made while the broker is away fail with ErrUnavailable instead
+// of hanging. A Publisher is safe for concurrent use.
+type Publisher struct {
+	url      string
+	topology Topology
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	closed bool
+	// reconnecting is set while the background reconnection loop runs.
+	reconnecting bool
+}
+
+// NewPublisher connects to the broker and declares the topology. It fails
+// if the broker can't be reached, so that a misconfigured server doesn't
+// start.
+func NewPublisher(url string, topology Topology) (*Publisher, error) {
+	p := &Publisher{url: url, topology: topology}
+	conn, ch, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.install(conn, ch)
+	return p, nil
+}
+
+// dial connects to the broker, opens a channel and declares the topology.
+// It runs without p.mu, so that publishes fail fast with ErrUnavailable
+// instead of queueing behind a slow dial.
+func (p *Publisher) dial() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("opening a RabbitMQ channel: %w", err)
+	}
+	if p.topology != nil {
+		if err := p.topology(ch); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("declaring the RabbitMQ topology: %w", err)
+		}
+	}
+	return conn, ch, nil
+}
+
+// install makes a dialed connection the current one, or closes it if the
+// publisher was closed in the meantime. The caller must hold p.mu.
+func (p *Publisher) install(conn *amqp.Connection, ch *amqp.Channel) bool {
+	if p.closed {
+		conn.Close()
+		return false
+	}
+	p.conn, p.ch = conn, ch
+	go p.watch(conn, ch)
+	return true
+}
+
+// watch waits for the connection or channel to close and starts
+// reconnecting unless the publisher was closed.
+func (p *Publisher) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	var err *amqp.Error
+	select {
+	case err = <-conn.NotifyClose(make(chan *amqp.Error, 1)):
+	case err = <-ch.NotifyClose(make(chan *amqp.Error, 1)):
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.ch != ch {
+		return
+	}
+	slog.Warn("RabbitMQ connection lost, reconnecting", "error", err)
+	conn.Close()
+	p.conn, p.ch = nil, nil
+	p.startReconnect()
+}
+
+// startReconnect starts the reconnection loop unless it is already
+// running. The caller must hold p.mu.
+func (p *Publisher) startReconnect() {
+	if p.reconnecting {
+		return
+	}
+	p.reconnecting = true
+	go p.reconnect()
+}
+
+func (p *Publisher) reconnect() {
+	backoff := minReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		time.Sleep(backoff)
+
+		p.mu.Lock()
+		if p.closed {
+			p.reconnecting = false
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		conn, ch, err := p.dial()
+		if err == nil {
+			p.mu.Lock()
+			installed := p.install(conn, ch)
+			p.reconnecting = false
+			p.mu.Unlock()
+			if installed {
+				slog.Info("Reconnected to RabbitMQ", "attempts", attempt)
+			}
+			return
+		}
+
+		slog.Warn("RabbitMQ reconnection failed", "attempt", attempt, "retry_in", backoff, "error", err)
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// channel returns the open channel, or ErrUnavailable while reconnecting.
+func (p *Publisher) channel() (*amqp.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, amqp.ErrClosed
+	}
+	if p.ch == nil || p.ch.IsClosed() {
+		return nil, ErrUnavailable
+	}
+	return p.ch, nil
+}
+
+// PublishWithContext publishes a message like amqp.Channel.PublishWithContext.
+// A publish that fails because the channel closed underneath it is retried
+// once after an immediate reconnection attempt.
+func (p *Publisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+	err = ch.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+
+	ch, err = p.reconnectNow(ch)
+	if err != nil {
+		return err
+	}
+	return ch.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+// reconnectNow replaces a channel found closed by a publish, without
+// waiting for the close notification. If that fails the background loop
+// takes over and ErrUnavailable is returned.
+func (p *Publisher) reconnectNow(dead *amqp.Channel) (*amqp.Channel, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+	if p.ch != nil && p.ch != dead && !p.ch.IsClosed() {
+		// Someone else reconnected in the meantime.
+		ch := p.ch
+		p.mu.Unlock()
+		return ch, nil
+	}
+	if p.reconnecting {
+		p.mu.Unlock()
+		return nil, ErrUnavailable
+	}
+	// Other publishes get ErrUnavailable while this one dials.
+	p.reconnecting = true
+	old := p.conn
+	p.conn, p.ch = nil, nil
+	p.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	conn, ch, err := p.dial()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reconnecting = false
+	if err != nil {
+		slog.Warn("RabbitMQ reconnection failed", "error", err)
+		if !p.closed {
+			p.startReconnect()
+		}
+		return nil, ErrUnavailable
+	}
+	if !p.install(conn, ch) {
+		return nil, amqp.ErrClosed
+	}
+	return ch, nil
+}
+
+// Channel opens an additional channel on the current connection. Such
+// channels are not recovered after a reconnection; see Consume for
+// consumers.
+func (p *Publisher) Channel() (*amqp.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil, ErrUnavailable
+	}
+	return p.conn.Channel()
+}
+
+// Consume runs a Consumer on its own channel of the publisher's connection
+// until ctx is cancelled. When the channel closes, e.g. because the broker
+// restarted, the consumer is started again once the publisher has
+// reconnected.
+func (p *Publisher) Consume(ctx context.Context, cfg ConsumerConfig, handler Handler) {
+	backoff := minReconnectBackoff
+	for {
+		ch, err := p.Channel()
+		if err == nil {
+			backoff = minReconnectBackoff
+			err = NewConsumer(ch, cfg, handler).Run(ctx)
+			ch.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Consumer stopped, restarting", "consumer", cfg.Tag, "retry_in", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// Browse gets up to limit messages from a queue on a channel of its own,
+// which returns those visit doesn't acknowledge to the queue when it
+// closes.
+func (p *Publisher) Browse(queue string, limit int, visit func(d amqp.Delivery) (bool, error)) error {
+	ch, err := p.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for i := 0; i < limit; i++ {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		stop, err := visit(d)
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection and stops reconnecting.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.ch = nil, nil
+	return err
+}
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transport publishes messages and consumes queues. *Publisher implements
+// it on RabbitMQ and *Memory inside the API process.
+type Transport interface {
+	// PublishWithContext routes a message like
+	// amqp.Channel.PublishWithContext.
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	// Consume runs handler on the deliveries of a queue until ctx is
+	// cancelled.
+	Consume(ctx context.Context, cfg ConsumerConfig, handler Handler)
+	// Browse takes up to limit messages from a queue without
+	// acknowledging them and passes each to visit until it returns true.
+	// Messages visit doesn't acknowledge return to the queue.
+	Browse(queue string, limit int, visit func(d amqp.Delivery) (bool, error)) error
+	// Close stops the transport.
+	Close() error
+}
+
+// Declarer declares exchanges and queues; *amqp.Channel and *Memory
+// implement it.
+type Declarer interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+}
@@ -0,0 +1,138 @@
+// Package quota limits how many premium scans a user, and each of their API
+// keys, may submit per day and per month. Days and months are UTC calendar
+// periods. Usage is counted from the scans themselves, deleted ones
+// included, so quotas hold across server instances and deleting a scan
+// doesn't give its allowance back.
+package quota
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Periods of a quota.
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Limits caps the scans of an account per period; 0 is unlimited.
+type Limits struct {
+	Daily   int `json:"daily"`
+	Monthly int `json:"monthly"`
+}
+
+// Unlimited reports whether l caps nothing.
+func (l Limits) Unlimited() bool {
+	return l.Daily == 0 && l.Monthly == 0
+}
+
+// Account is whose scans a quota counts.
+type Account struct {
+	// Column of premium_scans identifying the account's scans.
+	column string
+	ID     uuid.UUID
+	Limits Limits
+}
+
+// User is the account of a user's scans, however they were submitted.
+func User(id uuid.UUID, limits Limits) Account {
+	return Account{column: "user_id", ID: id, Limits: limits}
+}
+
+// APIKey is the account of the scans submitted with an API key.
+func APIKey(id uuid.UUID, limits Limits) Account {
+	return Account{column: "api_key_id", ID: id, Limits: limits}
+}
+
+// Period is the state of one quota period.
+type Period struct {
+	// Limit is 0 when the period is unlimited; Remaining is nil then.
+	Limit     int       `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining *int64    `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Usage is the state of an account's quotas.
+type Usage struct {
+	Daily   Period `json:"daily"`
+	Monthly Period `json:"monthly"`
+}
+
+// ExceededError is returned by Reserve when scans don't fit a quota.
+type ExceededError struct {
+	Period   string
+	Limit    int
+	ResetsAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s scan quota of %d exceeded", e.Period, e.Limit)
+}
+
+// Usage counts the scans of the account in the periods containing now.
+func (a Account) Usage(db *gorm.DB, now time.Time) (Usage, error) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var counts struct {
+		Daily   int64
+		Monthly int64
+	}
+	err := db.Unscoped().Model(&models.PremiumScan{}).
+		Select("COUNT(*) FILTER (WHERE created_at >= ?) AS daily, COUNT(*) AS monthly", day).
+		Where(a.column+" = ? AND created_at >= ?", a.ID, month).
+		Scan(&counts).Error
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Daily:   period(a.Limits.Daily, counts.Daily, day.AddDate(0, 0, 1)),
+		Monthly: period(a.Limits.Monthly, counts.Monthly, month.AddDate(0, 1, 0)),
+	}, nil
+}
+
+func period(limit int, used int64, resetsAt time.Time) Period {
+	p := Period{Limit: limit, Used: used, ResetsAt: resetsAt}
+	if limit > 0 {
+		remaining := max(int64(limit)-used, 0)
+		p.Remaining = &remaining
+	}
+	return p
+}
+
+// Reserve checks that n more scans fit the quotas of every account, and
+// returns an *ExceededError for the first that they don't. It must run in
+// the transaction creating the scans: it serializes the submissions of
+// the accounts until that transaction ends, so concurrent submissions
+// can't together overrun a quota.
+func Reserve(tx *gorm.DB, n int, accounts ...Account) error {
+	now := time.Now()
+	for _, a := range accounts {
+		if a.Limits.Unlimited() {
+			continue
+		}
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "quota:"+a.ID.String()).Error; err != nil {
+			return err
+		}
+		usage, err := a.Usage(tx, now)
+		if err != nil {
+			return err
+		}
+		for _, p := range []struct {
+			name string
+			Period
+		}{{Daily, usage.Daily}, {Monthly, usage.Monthly}} {
+			if p.Remaining != nil && *p.Remaining < int64(n) {
+				return &ExceededError{Period: p.name, Limit: p.Limit, ResetsAt: p.ResetsAt}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package ratelimit implements in-memory token bucket rate limiting.
+//
+// Every key (a client IP, a user ID, ...) gets a bucket holding up to Burst
+// tokens that refills at PerMinute tokens per minute; each request takes one
+// token. Buckets live in memory, so each server instance limits clients
+// separately.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are
+// dropped; a full bucket behaves exactly like a missing one.
+const sweepInterval = time.Minute
+
+// Rate is the refill rate and capacity of a bucket.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+// Config holds the limits applied by the API.
+type Config struct {
+	// IP limits anonymous requests per client IP.
+	IP Rate
+	// User limits authenticated requests per user.
+	User Rate
+}
+
+// DefaultConfig returns limits that a browser session never reaches but
+// that stop scripted flooding.
+func DefaultConfig() Config {
+	return Config{
+		IP:   Rate{PerMinute: 60, Burst: 20},
+		User: Rate{PerMinute: 300, Burst: 60},
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter applies one Rate to any number of keys.
+type Limiter struct {
+	rate  Rate
+	perNs float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{
+		rate:      rate,
+		perNs:     float64(rate.PerMinute) / float64(time.Minute),
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the key's bucket and reports whether one was
+// available; if not, retryAfter is the time until the next token.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(l.rate.Burst), last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(l.rate.Burst), b.tokens+float64(now.Sub(b.last))*l.perNs)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.perNs)
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.last))*l.perNs >= float64(l.rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
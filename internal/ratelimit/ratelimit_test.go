@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name string
+		rate Rate
+		// elapsed is how long ago the bucket was last used after it was
+		// emptied.
+		elapsed time.Duration
+		// want is how many requests pass after that.
+		want int
+	}{
+		{"empty bucket", Rate{PerMinute: 60, Burst: 5}, 0, 0},
+		{"one token refilled", Rate{PerMinute: 60, Burst: 5}, 1500 * time.Millisecond, 1},
+		{"several tokens refilled", Rate{PerMinute: 60, Burst: 5}, 3 * time.Second, 3},
+		{"refill stops at the burst", Rate{PerMinute: 60, Burst: 5}, time.Hour, 5},
+		{"slow rate", Rate{PerMinute: 1, Burst: 2}, 30 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rate)
+			for i := 0; i < tt.rate.Burst; i++ {
+				if ok, _ := l.Allow("client"); !ok {
+					t.Fatalf("request %d of the burst was limited", i+1)
+				}
+			}
+			l.buckets["client"].last = time.Now().Add(-tt.elapsed)
+
+			passed := 0
+			for i := 0; i <= tt.rate.Burst; i++ {
+				if ok, _ := l.Allow("client"); ok {
+					passed++
+				}
+			}
+			if passed != tt.want {
+				t.Errorf("%d requests passed, want %d", passed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	l := NewLimiter(Rate{PerMinute: 60, Burst: 1})
+	if ok, retryAfter := l.Allow("client"); !ok || retryAfter != 0 {
+		t.Fatalf("first Allow() = %t, %v; want true, 0", ok, retryAfter)
+	}
+	ok, retryAfter := l.Allow("client")
+	if ok {
+		t.Fatal("second Allow() passed an empty bucket")
+	}
+	if retryAfter <= 900*time.Millisecond || retryAfter > time.Second {
+		t.Errorf("retryAfter = %v, want just under 1s", retryAfter)
+	}
+	if ok, _ := l.Allow("other client"); !ok {
+		t.Error("another key shares the bucket")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := NewLimiter(Rate{PerMinute: 60, Burst: 10})
+	l.Allow("idle")
+	l.Allow("busy")
+	for i := 0; i < 9; i++ {
+		l.Allow("busy")
+	}
+	l.buckets["idle"].last = time.Now().Add(-2 * time.Second)
+	l.lastSweep = time.Now().Add(-sweepInterval)
+
+	l.Allow("new")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("the refilled bucket wasn't dropped")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("a bucket that hasn't refilled was dropped")
+	}
+}
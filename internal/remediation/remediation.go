@@ -0,0 +1,126 @@
+// Package remediation resolves the remediation guidance shown for test
+// results in the language preferred by the reader.
+package remediation
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultLanguage is used when none of the requested languages has content.
+const DefaultLanguage = "en"
+
+// NormalizeLanguage reduces a language tag to its lower-cased primary
+// subtag ("pl-PL" -> "pl").
+func NormalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// ParseAcceptLanguage returns the languages of an Accept-Language header
+// ordered by preference, normalized and without duplicates.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := NormalizeLanguage(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(f), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		langs = append(langs, weighted{lang, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	seen := map[string]bool{}
+	var out []string
+	for _, l := range langs {
+		if !seen[l.lang] {
+			seen[l.lang] = true
+			out = append(out, l.lang)
+		}
+	}
+	return out
+}
+
+// Latest returns the newest version of every test's content in the given
+// language, keyed by test name.
+func Latest(db *gorm.DB, language string, testNames []string) (map[string]models.RemediationContent, error) {
+	latestVersions := db.Model(&models.RemediationContent{}).
+		Select("test_name, MAX(version) AS version").
+		Where("language = ?", language).
+		Group("test_name")
+
+	q := db.Model(&models.RemediationContent{}).
+		Joins("JOIN (?) AS latest ON latest.test_name = remediation_contents.test_name AND latest.version = remediation_contents.version", latestVersions).
+		Where("remediation_contents.language = ?", language)
+	if testNames != nil {
+		q = q.Where("remediation_contents.test_name IN ?", testNames)
+	}
+
+	var rows []models.RemediationContent
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]models.RemediationContent, len(rows))
+	for _, r := range rows {
+		out[r.TestName] = r
+	}
+	return out, nil
+}
+
+// Resolve picks, for every test name, the latest content in the first of
+// the preferred languages that has any, falling back to DefaultLanguage.
+// Tests without content in any of those languages are omitted.
+func Resolve(db *gorm.DB, testNames []string, preferred []string) (map[string]models.RemediationContent, error) {
+	langs := append(append([]string{}, preferred...), DefaultLanguage)
+
+	out := make(map[string]models.RemediationContent, len(testNames))
+	seen := map[string]bool{}
+	for _, lang := range langs {
+		lang = NormalizeLanguage(lang)
+		if lang == "" || seen[lang] {
+			continue
+		}
+		seen[lang] = true
+
+		var missing []string
+		for _, name := range testNames {
+			if _, ok := out[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+
+		found, err := Latest(db, lang, missing)
+		if err != nil {
+			return nil, err
+		}
+		for name, content := range found {
+			out[name] = content
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,295 @@
+// Package reports generates long-running reports, such as the executive
+// summary, in the background.
+package reports
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// TopFailuresLimit is how many recurring failures a summary lists.
+const TopFailuresLimit = 10
+
+// weeklyTrendAfter is the period length from which the score trend is
+// bucketed by week instead of by day.
+const weeklyTrendAfter = 31 * 24 * time.Hour
+
+// ScorePoint is the average score of the scans completed in one bucket of
+// the score trend.
+type ScorePoint struct {
+	Start        time.Time `json:"start"`
+	AverageScore float64   `json:"average_score"`
+	Scans        int       `json:"scans"`
+}
+
+// RecurringFailure is a test that failed repeatedly during the period.
+type RecurringFailure struct {
+	Test        string `json:"test"`
+	Category    string `json:"category"`
+	Occurrences int64  `json:"occurrences"`
+	Targets     int64  `json:"targets"`
+}
+
+// RemediationVelocity describes how quickly failures were dealt with.
+//
+// Fixed and Introduced compare the first and last scan of every target in
+// the period: a test that failed in the first scan and passed in the last
+// one counts as fixed, and the other way round as introduced.
+type RemediationVelocity struct {
+	Fixed            int     `json:"fixed"`
+	Introduced       int     `json:"introduced"`
+	FixedPerWeek     float64 `json:"fixed_per_week"`
+	Open             int64   `json:"open"`
+	Acknowledged     int64   `json:"acknowledged"`
+	Suppressed       int64   `json:"suppressed"`
+	AvgHoursToTriage float64 `json:"avg_hours_to_triage"`
+	TriagedInPeriod  int64   `json:"triaged_in_period"`
+}
+
+// ExecutiveSummary aggregates a user's security posture over a period.
+type ExecutiveSummary struct {
+	From         time.Time           `json:"from"`
+	To           time.Time           `json:"to"`
+	GeneratedAt  time.Time           `json:"generated_at"`
+	Scans        int                 `json:"scans"`
+	Targets      int                 `json:"targets"`
+	AverageScore *float64            `json:"average_score"`
+	ScoreTrend   []ScorePoint        `json:"score_trend"`
+	TopFailures  []RecurringFailure  `json:"top_failures"`
+	Velocity     RemediationVelocity `json:"velocity"`
+}
+
+// summaryScan is the subset of a premium scan the summary needs.
+type summaryScan struct {
+	ID          uuid.UUID
+	TargetURL   string
+	CompletedAt *time.Time
+	Score       *float64
+}
+
+// BuildExecutiveSummary aggregates the user's scans completed between from
+// and to. progress is called with a percentage after every step.
+func BuildExecutiveSummary(db *gorm.DB, userID uuid.UUID, from, to time.Time, categories map[string]string, progress func(int)) (*ExecutiveSummary, error) {
+	summary := &ExecutiveSummary{
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now(),
+		ScoreTrend:  []ScorePoint{},
+		TopFailures: []RecurringFailure{},
+	}
+
+	var scans []summaryScan
+	if err := db.Model(&models.PremiumScan{}).
+		Select("id", "target_url", "completed_at", "score").
+		Where("user_id = ? AND status = ? AND completed_at BETWEEN ? AND ?", userID, "COMPLETED", from, to).
+		Order("completed_at").Find(&scans).Error; err != nil {
+		return nil, err
+	}
+	summary.Scans = len(scans)
+	summary.ScoreTrend, summary.AverageScore = scoreTrend(scans, from, to)
+	progress(25)
+
+	if len(scans) == 0 {
+		progress(75)
+		return summary, nil
+	}
+
+	scanIDs := make([]uuid.UUID, 0, len(scans))
+	byTarget := map[string][]uuid.UUID{}
+	for _, s := range scans {
+		scanIDs = append(scanIDs, s.ID)
+		byTarget[s.TargetURL] = append(byTarget[s.TargetURL], s.ID)
+	}
+	summary.Targets = len(byTarget)
+
+	// Summaries are shared through download links, so confidential
+	// findings are never included.
+	outbound, err := classification.For(db, userID, classification.ChannelReport, false)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := topFailures(db, scanIDs, outbound, categories)
+	if err != nil {
+		return nil, err
+	}
+	summary.TopFailures = failures
+	progress(50)
+
+	velocity, err := remediationVelocity(db, userID, scanIDs, byTarget, from, to)
+	if err != nil {
+		return nil, err
+	}
+	summary.Velocity = velocity
+	progress(75)
+
+	return summary, nil
+}
+
+// scoreTrend buckets the scored scans by day, or by week for long periods,
+// and returns the trend along with the overall average score.
+func scoreTrend(scans []summaryScan, from, to time.Time) ([]ScorePoint, *float64) {
+	bucket := 24 * time.Hour
+	if to.Sub(from) > weeklyTrendAfter {
+		bucket = 7 * 24 * time.Hour
+	}
+	start := from.Truncate(24 * time.Hour)
+
+	points := []ScorePoint{}
+	sums := []float64{}
+	var total float64
+	var scored int
+	for _, s := range scans {
+		if s.Score == nil || s.CompletedAt == nil {
+			continue
+		}
+		total += *s.Score
+		scored++
+
+		bucketStart := start.Add(s.CompletedAt.Sub(start) / bucket * bucket)
+		if n := len(points); n == 0 || !points[n-1].Start.Equal(bucketStart) {
+			points = append(points, ScorePoint{Start: bucketStart})
+			sums = append(sums, 0)
+		}
+		points[len(points)-1].Scans++
+		sums[len(sums)-1] += *s.Score
+	}
+	for i := range points {
+		points[i].AverageScore = sums[i] / float64(points[i].Scans)
+	}
+
+	if scored == 0 {
+		return points, nil
+	}
+	avg := total / float64(scored)
+	return points, &avg
+}
+
+func topFailures(db *gorm.DB, scanIDs []uuid.UUID, outbound classification.Outbound, categories map[string]string) ([]RecurringFailure, error) {
+	var rows []struct {
+		Test        string
+		Occurrences int64
+		Targets     int64
+	}
+	query := db.Model(&models.ScanResult{}).
+		Select("LOWER(scan_results.test_name) AS test, COUNT(*) AS occurrences, COUNT(DISTINCT premium_scans.target_url) AS targets").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id").
+		Where("scan_results.scan_id IN ? AND NOT scan_results.passed", scanIDs)
+	err := outbound.Scope(query, "scan_results.test_name").Group("LOWER(scan_results.test_name)").
+		Order("occurrences DESC, test").
+		Limit(TopFailuresLimit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]RecurringFailure, 0, len(rows))
+	for _, r := range rows {
+		failures = append(failures, RecurringFailure{
+			Test:        r.Test,
+			Category:    categories[r.Test],
+			Occurrences: r.Occurrences,
+			Targets:     r.Targets,
+		})
+	}
+	return failures, nil
+}
+
+func remediationVelocity(db *gorm.DB, userID uuid.UUID, scanIDs []uuid.UUID, byTarget map[string][]uuid.UUID, from, to time.Time) (RemediationVelocity, error) {
+	var v RemediationVelocity
+
+	var statuses []struct {
+		TriageStatus string
+		Count        int64
+	}
+	if err := db.Model(&models.ScanResult{}).
+		Select("triage_status, COUNT(*) AS count").
+		Where("scan_id IN ? AND NOT passed", scanIDs).
+		Group("triage_status").
+		Scan(&statuses).Error; err != nil {
+		return v, err
+	}
+	for _, s := range statuses {
+		switch s.TriageStatus {
+		case models.TriageAcknowledged:
+			v.Acknowledged = s.Count
+		case models.TriageSuppressed:
+			v.Suppressed = s.Count
+		default:
+			v.Open += s.Count
+		}
+	}
+
+	// Time to triage covers every finding triaged during the period, even if
+	// it was found before it.
+	var triaged []struct {
+		TriagedAt   time.Time
+		CompletedAt time.Time
+	}
+	if err := db.Model(&models.ScanResult{}).
+		Select("scan_results.triaged_at, premium_scans.completed_at").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id").
+		Where("premium_scans.user_id = ? AND NOT scan_results.passed", userID).
+		Where("scan_results.triage_status <> ? AND scan_results.triaged_at BETWEEN ? AND ?", models.TriageOpen, from, to).
+		Where("premium_scans.completed_at IS NOT NULL").
+		Scan(&triaged).Error; err != nil {
+		return v, err
+	}
+	var hours float64
+	for _, t := range triaged {
+		if d := t.TriagedAt.Sub(t.CompletedAt); d > 0 {
+			hours += d.Hours()
+		}
+	}
+	v.TriagedInPeriod = int64(len(triaged))
+	if len(triaged) > 0 {
+		v.AvgHoursToTriage = hours / float64(len(triaged))
+	}
+
+	for _, ids := range byTarget {
+		if len(ids) < 2 {
+			continue
+		}
+		first, err := failedTests(db, ids[0])
+		if err != nil {
+			return v, err
+		}
+		last, err := failedTests(db, ids[len(ids)-1])
+		if err != nil {
+			return v, err
+		}
+		for test := range first {
+			if !last[test] {
+				v.Fixed++
+			}
+		}
+		for test := range last {
+			if !first[test] {
+				v.Introduced++
+			}
+		}
+	}
+	if weeks := to.Sub(from).Hours() / (24 * 7); weeks > 0 {
+		v.FixedPerWeek = float64(v.Fixed) / weeks
+	}
+
+	return v, nil
+}
+
+func failedTests(db *gorm.DB, scanID uuid.UUID) (map[string]bool, error) {
+	var names []string
+	if err := db.Model(&models.ScanResult{}).
+		Where("scan_id = ? AND NOT passed", scanID).
+		Pluck("test_name", &names).Error; err != nil {
+		return nil, err
+	}
+	failed := make(map[string]bool, len(names))
+	for _, n := range names {
+		failed[strings.ToLower(n)] = true
+	}
+	return failed, nil
+}
@@ -0,0 +1,151 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page geometry of generated PDFs (A4, in points).
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+)
+
+// pdfDocument is a minimal PDF writer for text reports. It only uses the
+// standard Helvetica fonts, which every reader provides, so no fonts need
+// to be embedded. Text outside of Latin-1 is replaced with "?".
+type pdfDocument struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+	y       float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// Heading writes a line in bold.
+func (d *pdfDocument) Heading(text string, size float64) {
+	d.Space(size / 2)
+	d.write(text, "F2", size)
+}
+
+// Text writes a paragraph, wrapping it to the page width.
+func (d *pdfDocument) Text(text string, size float64) {
+	// Helvetica glyphs average about half the font size in width.
+	perLine := int((pdfPageWidth - 2*pdfMargin) / (size * 0.5))
+	for _, line := range wrap(text, perLine) {
+		d.write(line, "F1", size)
+	}
+}
+
+// Space adds vertical whitespace.
+func (d *pdfDocument) Space(points float64) {
+	d.y -= points
+}
+
+func (d *pdfDocument) write(text, font string, size float64) {
+	lineHeight := size * 1.4
+	if d.y-lineHeight < pdfMargin {
+		d.newPage()
+	}
+	d.y -= lineHeight
+	fmt.Fprintf(d.current, "BT /%s %.1f Tf %d %.1f Td (%s) Tj ET\n", font, size, pdfMargin, d.y, pdfEscape(text))
+}
+
+// Bytes serializes the document.
+func (d *pdfDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, the page tree and the two fonts; each page
+	// then takes two objects, the page and its content stream.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape encodes text as the body of a PDF string literal.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrap splits text into lines of at most width characters, breaking at
+// spaces where possible.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, word[:width])
+				word = word[width:]
+			}
+			switch {
+			case line == "":
+				line = word
+			case len(line)+1+len(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,77 @@
+package reports
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var htmlTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"date":  formatDate,
+	"score": formatScore,
+}).ParseFS(templates, "templates/*.html"))
+
+func formatDate(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+func formatScore(score *float64) string {
+	if score == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f", *score)
+}
+
+// RenderExecutiveSummaryHTML renders the summary as a standalone HTML page.
+func RenderExecutiveSummaryHTML(summary *ExecutiveSummary) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&buf, "executive_summary.html", summary); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderExecutiveSummaryPDF renders the summary as a PDF document.
+func RenderExecutiveSummaryPDF(summary *ExecutiveSummary) []byte {
+	doc := newPDFDocument()
+	doc.Heading("Executive summary", 20)
+	doc.Text(fmt.Sprintf("Period: %s - %s. Generated %s.",
+		formatDate(summary.From), formatDate(summary.To), summary.GeneratedAt.Format("2006-01-02 15:04 MST")), 10)
+	doc.Space(6)
+	doc.Text(fmt.Sprintf("Scans: %d    Targets: %d    Average score: %s    Fixed issues: %d",
+		summary.Scans, summary.Targets, formatScore(summary.AverageScore), summary.Velocity.Fixed), 12)
+
+	doc.Heading("Score trend", 14)
+	if len(summary.ScoreTrend) == 0 {
+		doc.Text("No scored scans in this period.", 10)
+	}
+	for _, p := range summary.ScoreTrend {
+		doc.Text(fmt.Sprintf("%s    %.1f    (%d scans)", formatDate(p.Start), p.AverageScore, p.Scans), 10)
+	}
+
+	doc.Heading("Top recurring failures", 14)
+	if len(summary.TopFailures) == 0 {
+		doc.Text("No failed tests in this period.", 10)
+	}
+	for i, f := range summary.TopFailures {
+		line := fmt.Sprintf("%d. %s - %d failures on %d target(s)", i+1, f.Test, f.Occurrences, f.Targets)
+		if f.Category != "" {
+			line += " [" + f.Category + "]"
+		}
+		doc.Text(line, 10)
+	}
+
+	v := summary.Velocity
+	doc.Heading("Remediation velocity", 14)
+	doc.Text(fmt.Sprintf("Issues fixed: %d (%.1f per week)", v.Fixed, v.FixedPerWeek), 10)
+	doc.Text(fmt.Sprintf("Issues introduced: %d", v.Introduced), 10)
+	doc.Text(fmt.Sprintf("Findings open / acknowledged / suppressed: %d / %d / %d", v.Open, v.Acknowledged, v.Suppressed), 10)
+	doc.Text(fmt.Sprintf("Average time to triage: %.1f h (%d findings)", v.AvgHoursToTriage, v.TriagedInPeriod), 10)
+
+	return doc.Bytes()
+}
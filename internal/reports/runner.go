@@ -0,0 +1,318 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/mail"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/queue"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// Queue is the RabbitMQ queue pending report jobs are published to.
+const Queue = "report_jobs"
+
+// MaxAttempts bounds how often a job may be run, including retries.
+const MaxAttempts = 5
+
+// ErrNotRetryable is returned by Retry for jobs that haven't failed or have
+// used up their attempts.
+var ErrNotRetryable = errors.New("report job can't be retried")
+
+// LinkTTL is the lifetime of the download link sent when a report is ready.
+const LinkTTL = 72 * time.Hour
+
+// notifyTimeout bounds the delivery of the ready notifications.
+const notifyTimeout = time.Minute
+
+// Generator renders the content of a job type that isn't built into the
+// runner. The content is stored with the given content type under the
+// job's format.
+type Generator func(ctx context.Context, job *models.ReportJob) (content []byte, contentType string, err error)
+
+// Runner generates reports from a queue and notifies their owner through
+// email and webhooks once they are ready. Jobs are created by the API,
+// published with Enqueue and run by Handle, so HTTP handlers only wait for
+// the publish.
+type Runner struct {
+	db         *gorm.DB
+	publisher  queue.Transport
+	store      storage.Store
+	mailer     mail.Mailer
+	renderer   *mail.Renderer
+	webhooks   *webhooks.Dispatcher
+	categories map[string]string
+	generators map[string]Generator
+}
+
+func NewRunner(db *gorm.DB, publisher queue.Transport, store storage.Store, mailer mail.Mailer, renderer *mail.Renderer, dispatcher *webhooks.Dispatcher, categories map[string]string) *Runner {
+	return &Runner{
+		db:         db,
+		publisher:  publisher,
+		store:      store,
+		mailer:     mailer,
+		renderer:   renderer,
+		webhooks:   dispatcher,
+		categories: categories,
+		generators: map[string]Generator{},
+	}
+}
+
+// Register adds a generator for a job type. It must be called before jobs
+// are consumed.
+func (r *Runner) Register(reportType string, g Generator) {
+	r.generators[reportType] = g
+}
+
+// jobMessage is the body of a queued job.
+type jobMessage struct {
+	JobID uuid.UUID `json:"job_id"`
+}
+
+// Enqueue publishes a pending job. If the publish fails the job is marked
+// as failed, so that it can be retried later, and the error is returned.
+func (r *Runner) Enqueue(ctx context.Context, job *models.ReportJob) error {
+	body, err := json.Marshal(jobMessage{JobID: job.ID})
+	if err == nil {
+		err = r.publisher.PublishWithContext(ctx, "", Queue, false, false, amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			MessageId:    job.ID.String(),
+			Timestamp:    time.Now(),
+			Body:         body,
+		})
+	}
+	if err != nil {
+		now := time.Now()
+		job.Status = models.JobStatusFailed
+		job.Error = "could not be queued"
+		job.CompletedAt = &now
+		r.db.Model(job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"error":        job.Error,
+			"completed_at": job.CompletedAt,
+		})
+		return err
+	}
+	return nil
+}
+
+// Retry resets a failed job to pending and queues it again.
+func (r *Runner) Retry(ctx context.Context, job *models.ReportJob) error {
+	result := r.db.Model(job).
+		Where("status = ? AND attempts < ?", models.JobStatusFailed, MaxAttempts).
+		Updates(map[string]interface{}{
+			"status":       models.JobStatusPending,
+			"progress":     0,
+			"error":        "",
+			"started_at":   nil,
+			"completed_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotRetryable
+	}
+	job.Status = models.JobStatusPending
+	job.Progress = 0
+	job.Error = ""
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	return r.Enqueue(ctx, job)
+}
+
+// Handle runs a job published by Enqueue; it is a queue.Handler for Queue.
+func (r *Runner) Handle(ctx context.Context, d amqp.Delivery) error {
+	var msg jobMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil || msg.JobID == uuid.Nil {
+		slog.ErrorContext(ctx, "Discarding malformed report job message", "message_id", d.MessageId, "error", err)
+		return queue.ErrDiscard
+	}
+	return r.Run(ctx, msg.JobID)
+}
+
+// Run generates the report of a pending job and records the outcome on
+// the job. A job left running by a consumer that went away is picked up
+// again when its message is redelivered; finished jobs are skipped. An
+// error is only returned when the job should be run again later, i.e. when
+// ctx was cancelled or the job couldn't be claimed.
+func (r *Runner) Run(ctx context.Context, jobID uuid.UUID) error {
+	now := time.Now()
+	claim := r.db.Model(&models.ReportJob{}).
+		Where("id = ? AND status IN ?", jobID, []string{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusRunning,
+			"started_at": &now,
+			"attempts":   gorm.Expr("attempts + 1"),
+		})
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		slog.InfoContext(ctx, "Skipping report job that isn't pending", "report_id", jobID)
+		return nil
+	}
+
+	var job models.ReportJob
+	if err := r.db.First(&job, "id = ?", jobID).Error; err != nil {
+		return err
+	}
+
+	summary, runErr := r.generate(ctx, &job)
+	if runErr != nil && ctx.Err() != nil {
+		// Shutting down; the redelivered message resumes the job.
+		return ctx.Err()
+	}
+
+	finished := time.Now()
+	job.CompletedAt = &finished
+	if runErr != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = runErr.Error()
+		slog.ErrorContext(ctx, "Report job failed", "report_id", job.ID, "attempt", job.Attempts, "error", runErr)
+		r.db.Save(&job)
+		return nil
+	}
+	job.Status = models.JobStatusCompleted
+	job.Progress = 100
+	r.db.Save(&job)
+
+	// Scan reports and exports are downloaded on request and need no
+	// notification.
+	if summary != nil {
+		r.notify(&job, summary)
+	}
+	return nil
+}
+
+func (r *Runner) generate(ctx context.Context, job *models.ReportJob) (*ExecutiveSummary, error) {
+	switch job.Type {
+	case models.ReportTypeExecutiveSummary:
+		return r.generateExecutiveSummary(ctx, job)
+	case models.ReportTypeScan:
+		return nil, r.generateScanReport(ctx, job)
+	}
+
+	generate, ok := r.generators[job.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported report type %q", job.Type)
+	}
+	content, contentType, err := generate(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	return nil, r.save(ctx, job, content, contentType)
+}
+
+func (r *Runner) generateExecutiveSummary(ctx context.Context, job *models.ReportJob) (*ExecutiveSummary, error) {
+	summary, err := BuildExecutiveSummary(r.db.WithContext(ctx), job.UserID, job.PeriodFrom, job.PeriodTo, r.categories, func(p int) {
+		job.Progress = p
+		r.db.Model(job).Update("progress", p)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aggregating scans: %w", err)
+	}
+
+	var content []byte
+	contentType := "application/pdf"
+	if job.Format == models.ReportFormatHTML {
+		contentType = "text/html; charset=utf-8"
+		if content, err = RenderExecutiveSummaryHTML(summary); err != nil {
+			return nil, fmt.Errorf("rendering report: %w", err)
+		}
+	} else {
+		content = RenderExecutiveSummaryPDF(summary)
+	}
+
+	if err := r.save(ctx, job, content, contentType); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func (r *Runner) generateScanReport(ctx context.Context, job *models.ReportJob) error {
+	if job.ScanID == nil {
+		return fmt.Errorf("scan report job has no scan")
+	}
+	report, err := BuildScanReport(r.db.WithContext(ctx), *job.ScanID, job.Language, job.IncludeConfidential)
+	if err != nil {
+		return fmt.Errorf("loading scan: %w", err)
+	}
+	job.Progress = 50
+	r.db.Model(job).Update("progress", job.Progress)
+
+	return r.save(ctx, job, RenderScanReportPDF(report), "application/pdf")
+}
+
+// save stores the rendered report and records its key on the job.
+func (r *Runner) save(ctx context.Context, job *models.ReportJob, content []byte, contentType string) error {
+	key := fmt.Sprintf("reports/%s/%s.%s", job.UserID, job.ID, job.Format)
+	if err := r.store.Put(ctx, key, bytes.NewReader(content), contentType); err != nil {
+		return fmt.Errorf("storing report: %w", err)
+	}
+	job.StorageKey = key
+	return nil
+}
+
+// notify tells the owner that the report is ready. Failures are only
+// logged: the report itself is available either way.
+func (r *Runner) notify(job *models.ReportJob, summary *ExecutiveSummary) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	link, err := r.store.SignedURL(ctx, job.StorageKey, LinkTTL, Filename(job))
+	if err != nil {
+		slog.Error("Failed to sign report", "report_id", job.ID, "error", err)
+		return
+	}
+
+	var user models.User
+	if err := r.db.Select("id", "full_name", "email").First(&user, "id = ?", job.UserID).Error; err != nil {
+		slog.Error("Failed to load owner of report", "report_id", job.ID, "error", err)
+	} else {
+		err := r.renderer.Send(ctx, r.mailer, mail.TemplateExecutiveSummary, user.Email, map[string]interface{}{
+			"Name":         user.FullName,
+			"From":         formatDate(job.PeriodFrom),
+			"To":           formatDate(job.PeriodTo),
+			"Scans":        summary.Scans,
+			"AverageScore": formatScore(summary.AverageScore),
+			"Fixed":        summary.Velocity.Fixed,
+			"Link":         link,
+		})
+		if err != nil {
+			slog.Error("Failed to email report", "report_id", job.ID, "error", err)
+		}
+	}
+
+	err = r.webhooks.Publish(ctx, job.UserID, webhooks.EventReportCompleted, map[string]interface{}{
+		"report_id":    job.ID,
+		"type":         job.Type,
+		"format":       job.Format,
+		"period_from":  job.PeriodFrom,
+		"period_to":    job.PeriodTo,
+		"download_url": link,
+		"expires_at":   time.Now().Add(LinkTTL),
+	})
+	if err != nil {
+		slog.Error("Failed to publish report to webhooks", "report_id", job.ID, "error", err)
+	}
+}
+
+// Filename is the download name of a generated report.
+func Filename(job *models.ReportJob) string {
+	if job.ScanID != nil {
+		return fmt.Sprintf("%s_%s.%s", job.Type, job.ScanID, job.Format)
+	}
+	return fmt.Sprintf("%s_%s_%s.%s", job.Type, formatDate(job.PeriodFrom), formatDate(job.PeriodTo), job.Format)
+}
@@ -0,0 +1,208 @@
+package reports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/remediation"
+	"gorm.io/gorm"
+)
+
+// severityOrder lists severities from most to least severe; report sections
+// follow this order and unknown severities come last.
+var severityOrder = []string{"critical", "high", "medium", "low", "info", "none"}
+
+// ScanReportFinding is a failed test in a scan report.
+type ScanReportFinding struct {
+	Result      models.ScanResult
+	Remediation *models.RemediationContent
+}
+
+// SeverityGroup holds the failed tests of one severity.
+type SeverityGroup struct {
+	Severity string
+	Findings []ScanReportFinding
+}
+
+// ScanReport is the content of the security report of a single scan.
+type ScanReport struct {
+	Scan        models.PremiumScan
+	GeneratedAt time.Time
+	Total       int
+	Passed      int
+	Failed      int
+	Groups      []SeverityGroup
+	PassedTests []string
+}
+
+// ScanReportCacheKey identifies the input a scan report is rendered from:
+// the scan's outcome, the report language, the remediation content and the
+// confidential findings left out. Rescoring the scan, editing remediation
+// guidance or reclassifying tests changes the key.
+func ScanReportCacheKey(db *gorm.DB, scan models.PremiumScan, language string, includeConfidential bool) (string, error) {
+	var latestContent uint
+	if err := db.Model(&models.RemediationContent{}).Select("COALESCE(MAX(id), 0)").Scan(&latestContent).Error; err != nil {
+		return "", err
+	}
+
+	outbound, err := classification.For(db, scan.UserID, classification.ChannelExport, includeConfidential)
+	if err != nil {
+		return "", err
+	}
+	excluded := strings.Join(outbound.Withheld(), ",")
+
+	score := "none"
+	if scan.Score != nil {
+		score = fmt.Sprintf("%.4f", *scan.Score)
+	}
+	completed := ""
+	if scan.CompletedAt != nil {
+		completed = scan.CompletedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		scan.ID.String(), scan.Status, completed, score, scan.Grade, language, fmt.Sprint(latestContent), excluded,
+	}, "|")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// BuildScanReport loads a scan with its results and the remediation
+// guidance for every failed test in the given language. Confidential
+// results are left out unless includeConfidential is set.
+func BuildScanReport(db *gorm.DB, scanID uuid.UUID, language string, includeConfidential bool) (*ScanReport, error) {
+	var scan models.PremiumScan
+	if err := db.Preload("Results", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&scan, "id = ?", scanID).Error; err != nil {
+		return nil, err
+	}
+
+	outbound, err := classification.For(db, scan.UserID, classification.ChannelExport, includeConfidential)
+	if err != nil {
+		return nil, err
+	}
+	scan.Results = outbound.Results(scan.Results)
+
+	report := &ScanReport{
+		Scan:        scan,
+		GeneratedAt: time.Now(),
+		Total:       len(scan.Results),
+	}
+
+	var failedTests []string
+	bySeverity := map[string][]models.ScanResult{}
+	for _, r := range scan.Results {
+		if r.Passed {
+			report.Passed++
+			report.PassedTests = append(report.PassedTests, r.TestName)
+			continue
+		}
+		report.Failed++
+		severity := strings.ToLower(r.Severity)
+		bySeverity[severity] = append(bySeverity[severity], r)
+		failedTests = append(failedTests, r.TestName)
+	}
+
+	content, err := remediation.Resolve(db, failedTests, []string{language})
+	if err != nil {
+		return nil, err
+	}
+
+	severities := make([]string, 0, len(bySeverity))
+	for severity := range bySeverity {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		return severityRank(severities[i]) < severityRank(severities[j])
+	})
+
+	for _, severity := range severities {
+		group := SeverityGroup{Severity: severity}
+		for _, r := range bySeverity[severity] {
+			finding := ScanReportFinding{Result: r}
+			if c, ok := content[r.TestName]; ok {
+				finding.Remediation = &c
+			}
+			group.Findings = append(group.Findings, finding)
+		}
+		report.Groups = append(report.Groups, group)
+	}
+	return report, nil
+}
+
+func severityRank(severity string) int {
+	for i, s := range severityOrder {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severityOrder)
+}
+
+// RenderScanReportPDF renders the security report of a scan.
+func RenderScanReportPDF(report *ScanReport) []byte {
+	scan := report.Scan
+	doc := newPDFDocument()
+	doc.Heading("Security report", 20)
+	doc.Text(scan.TargetURL, 12)
+	completed := "n/a"
+	if scan.CompletedAt != nil {
+		completed = scan.CompletedAt.Format("2006-01-02 15:04 MST")
+	}
+	doc.Text(fmt.Sprintf("Scan %s, completed %s. Generated %s.",
+		scan.ID, completed, report.GeneratedAt.Format("2006-01-02 15:04 MST")), 9)
+
+	doc.Heading("Summary", 14)
+	grade := scan.Grade
+	if grade == "" {
+		grade = "n/a"
+	}
+	doc.Text(fmt.Sprintf("Grade: %s    Score: %s", grade, formatScore(scan.Score)), 12)
+	doc.Text(fmt.Sprintf("%d tests run: %d passed, %d failed.", report.Total, report.Passed, report.Failed), 10)
+	for _, g := range report.Groups {
+		doc.Text(fmt.Sprintf("%s: %d", titleCase(g.Severity), len(g.Findings)), 10)
+	}
+
+	for _, g := range report.Groups {
+		doc.Heading(fmt.Sprintf("%s severity (%d)", titleCase(g.Severity), len(g.Findings)), 14)
+		for _, f := range g.Findings {
+			doc.Heading(f.Result.TestName, 11)
+			if f.Result.Message != "" {
+				doc.Text(f.Result.Message, 10)
+			}
+			if f.Remediation != nil {
+				doc.Space(4)
+				if f.Remediation.Title != "" {
+					doc.Text("Remediation: "+f.Remediation.Title, 10)
+				} else {
+					doc.Text("Remediation:", 10)
+				}
+				doc.Text(f.Remediation.Remediation, 10)
+				if f.Remediation.Reference != "" {
+					doc.Text("Reference: "+f.Remediation.Reference, 9)
+				}
+			}
+		}
+	}
+
+	if len(report.PassedTests) > 0 {
+		doc.Heading("Passed tests", 14)
+		doc.Text(strings.Join(report.PassedTests, ", "), 10)
+	}
+
+	return doc.Bytes()
+}
+
+func titleCase(s string) string {
+	if s == "" {
+		return "Unknown"
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,273 @@
+// Package retention purges finished scans once they are older than the
+// configured retention period.
+//
+// Expired scans are either deleted together with everything recorded for
+// them, or anonymized: scores, grades and test outcomes are kept for
+// trends and benchmarks, while target URLs, result messages and metadata,
+// triage notes, tags and evidence are removed. Anonymized scans are recognized by
+// their empty target URL. Scans are purged in batches, each in its own
+// transaction, so that no table is locked for long.
+//
+// Purge counts are published as the expvar map "retention". Scans deleted
+// to enforce organization storage plans count as quota_deleted_*.
+package retention
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// purgeInterval is how often expired scans are purged.
+const purgeInterval = time.Hour
+
+// FinishedStatuses are the statuses of scans that may be purged.
+var FinishedStatuses = []string{"COMPLETED", "FAILED", "CANCELLED", "REJECTED"}
+
+// metrics holds the purge counters since the process started.
+var metrics = expvar.NewMap("retention")
+
+// Stats counts what one purge removed or anonymized.
+type Stats struct {
+	Scans     int64
+	Results   int64
+	Artifacts int64
+	Reports   int64
+}
+
+// Purger removes or anonymizes expired scans.
+type Purger struct {
+	db    *gorm.DB
+	store storage.Store
+	cfg   config.RetentionConfig
+}
+
+func NewPurger(db *gorm.DB, store storage.Store, cfg config.RetentionConfig) *Purger {
+	return &Purger{db: db, store: store, cfg: cfg}
+}
+
+// Run purges once immediately and then every hour until ctx is cancelled.
+// It returns at once when no retention period is configured.
+func (p *Purger) Run(ctx context.Context) {
+	if p.cfg.Period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := p.Purge(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "Retention purge failed", "error", err)
+		}
+		if stats.Scans > 0 {
+			slog.InfoContext(ctx, "Retention purge finished", "mode", p.cfg.Mode, "scans", stats.Scans, "results", stats.Results, "artifacts", stats.Artifacts, "reports", stats.Reports)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge processes every scan that finished before the retention period,
+// batch by batch. The returned Stats cover the batches that succeeded.
+func (p *Purger) Purge(ctx context.Context) (Stats, error) {
+	var total Stats
+	cutoff := time.Now().Add(-p.cfg.Period)
+	metrics.Add("runs", 1)
+
+	for _, model := range []interface{}{&models.Scan{}, &models.PremiumScan{}} {
+		for {
+			var ids []uuid.UUID
+			err := p.db.WithContext(ctx).Unscoped().Model(model).
+				Where("status IN ? AND created_at < ? AND target_url <> ''", FinishedStatuses, cutoff).
+				Order("created_at").Limit(p.cfg.BatchSize).
+				Pluck("id", &ids).Error
+			if err != nil {
+				return total, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			stats, err := p.purgeBatch(ctx, model, ids, p.cfg.Mode)
+			if err != nil {
+				return total, err
+			}
+			total.Scans += stats.Scans
+			total.Results += stats.Results
+			total.Artifacts += stats.Artifacts
+			total.Reports += stats.Reports
+			p.record(stats)
+
+			if len(ids) < p.cfg.BatchSize {
+				break
+			}
+		}
+	}
+	metrics.Set("last_run", timeVar(time.Now()))
+	return total, nil
+}
+
+// DeleteScans deletes premium scans with everything recorded for them,
+// whatever the retention mode, to bring an organization back under its
+// storage plan (see package orgstorage). Scans that aren't finished are
+// left alone.
+func (p *Purger) DeleteScans(ctx context.Context, ids []uuid.UUID) (Stats, error) {
+	var finished []uuid.UUID
+	if err := p.db.WithContext(ctx).Unscoped().Model(&models.PremiumScan{}).
+		Where("id IN ? AND status IN ?", ids, FinishedStatuses).
+		Pluck("id", &finished).Error; err != nil {
+		return Stats{}, err
+	}
+	if len(finished) == 0 {
+		return Stats{}, nil
+	}
+	stats, err := p.purgeBatch(ctx, &models.PremiumScan{}, finished, config.RetentionDelete)
+	if err != nil {
+		return Stats{}, err
+	}
+	metrics.Add("quota_deleted_scans", stats.Scans)
+	metrics.Add("quota_deleted_results", stats.Results)
+	metrics.Add("deleted_artifacts", stats.Artifacts)
+	metrics.Add("deleted_reports", stats.Reports)
+	return stats, nil
+}
+
+// purgeBatch deletes or anonymizes, depending on mode, one batch of scans
+// of one table. Stored files are removed once the transaction has
+// committed.
+func (p *Purger) purgeBatch(ctx context.Context, model interface{}, ids []uuid.UUID, mode string) (Stats, error) {
+	var stats Stats
+	var keys []string
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped()
+
+		var artifacts []models.Artifact
+		if err := tx.Select("id", "storage_key").Where("scan_id IN ?", ids).Find(&artifacts).Error; err != nil {
+			return err
+		}
+		var reports []models.ReportJob
+		if err := tx.Select("id", "storage_key").Where("scan_id IN ?", ids).Find(&reports).Error; err != nil {
+			return err
+		}
+		for _, a := range artifacts {
+			keys = append(keys, a.StorageKey)
+		}
+		for _, r := range reports {
+			if r.StorageKey != "" {
+				keys = append(keys, r.StorageKey)
+			}
+		}
+
+		// Evidence and its evaluations, rendered reports, stored tasks, tags,
+		// pull request checks and the results of unfinished submissions
+		// identify the target in either mode.
+		res := tx.Where("scan_id IN ?", ids).Delete(&models.Artifact{})
+		if res.Error != nil {
+			return res.Error
+		}
+		stats.Artifacts = res.RowsAffected
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.ScanEvaluation{}).Error; err != nil {
+			return err
+		}
+		if res = tx.Where("scan_id IN ?", ids).Delete(&models.ReportJob{}); res.Error != nil {
+			return res.Error
+		}
+		stats.Reports = res.RowsAffected
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.ScanApproval{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.ScanTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.PullRequestCheck{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.StagedScanResult{}).Error; err != nil {
+			return err
+		}
+
+		if mode == config.RetentionAnonymize {
+			return anonymize(tx, model, ids, &stats)
+		}
+
+		if res = tx.Where("scan_id IN ?", ids).Delete(&models.ScanResult{}); res.Error != nil {
+			return res.Error
+		}
+		stats.Results = res.RowsAffected
+		if err := tx.Where("scan_id IN ?", ids).Delete(&models.ScanEvent{}).Error; err != nil {
+			return err
+		}
+		if res = tx.Where("id IN ?", ids).Delete(model); res.Error != nil {
+			return res.Error
+		}
+		stats.Scans = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	for _, key := range keys {
+		if err := p.store.Delete(ctx, key); err != nil {
+			slog.WarnContext(ctx, "Failed to delete stored file of purged scan", "storage_key", key, "error", err)
+		}
+	}
+	return stats, nil
+}
+
+// anonymize strips identifying data from a batch of scans and their
+// results.
+func anonymize(tx *gorm.DB, model interface{}, ids []uuid.UUID, stats *Stats) error {
+	res := tx.Model(&models.ScanResult{}).Where("scan_id IN ?", ids).Updates(map[string]interface{}{
+		"message":     "",
+		"metadata":    "{}",
+		"triage_note": "",
+		"artifact_id": nil,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	stats.Results = res.RowsAffected
+
+	updates := map[string]interface{}{"target_url": ""}
+	if _, ok := model.(*models.PremiumScan); ok {
+		updates["target_id"] = nil
+	}
+	if res = tx.Model(model).Where("id IN ?", ids).Updates(updates); res.Error != nil {
+		return res.Error
+	}
+	stats.Scans = res.RowsAffected
+	return nil
+}
+
+// record adds a batch to the published counters.
+func (p *Purger) record(stats Stats) {
+	prefix := "deleted_"
+	if p.cfg.Mode == config.RetentionAnonymize {
+		prefix = "anonymized_"
+	}
+	metrics.Add(prefix+"scans", stats.Scans)
+	metrics.Add(prefix+"results", stats.Results)
+	metrics.Add("deleted_artifacts", stats.Artifacts)
+	metrics.Add("deleted_reports", stats.Reports)
+}
+
+// timeVar publishes a time as an RFC 3339 string.
+type timeVar time.Time
+
+func (t timeVar) String() string {
+	return `"` + time.Time(t).UTC().Format(time.RFC3339) + `"`
+}
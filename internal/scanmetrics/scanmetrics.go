@@ -0,0 +1,333 @@
+// Package scanmetrics counts finished scans and measures how long they ran,
+// for Prometheus to scrape in the OpenMetrics text format.
+//
+// Series are labeled with the environment and team of the scan, taken from
+// its env:<name> (or environment:<name>) and team:<name> tags, so error
+// rates and durations can be sliced by team and environment. Both labels
+// have bounded cardinality: values missing from the configured lists are
+// reported as "other", and scans without such a tag as "none". Every
+// series carries an exemplar with the ID of the last scan it counted.
+//
+// The collector follows the scan status events of the events broker, so
+// it counts the scans finished by this server instance since it started.
+package scanmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/config"
+	"github.com/prawo-i-piesc/backend/internal/events"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Label values of scans without a tag and of values that aren't admitted.
+const (
+	LabelNone  = "none"
+	LabelOther = "other"
+)
+
+const (
+	// openMetricsContentType is the content type of the OpenMetrics text
+	// format.
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	// maxAdmittedValues bounds the values of a label without a configured
+	// list.
+	maxAdmittedValues = 20
+	// pendingEvents is how many finished scans may wait to be counted.
+	pendingEvents = 256
+)
+
+// durationBuckets are the upper bounds, in seconds, of the duration
+// histogram buckets.
+var durationBuckets = []float64{10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// finalStatuses are the statuses of finished scans.
+var finalStatuses = map[string]bool{"COMPLETED": true, "FAILED": true, "CANCELLED": true, "REJECTED": true}
+
+type labels struct {
+	environment string
+	team        string
+}
+
+type statusLabels struct {
+	labels
+	status string
+}
+
+// exemplar points from a series to the scan last counted in it.
+type exemplar struct {
+	scanID uuid.UUID
+	value  float64
+	at     time.Time
+}
+
+type counter struct {
+	value    int64
+	exemplar exemplar
+}
+
+type histogram struct {
+	// buckets counts the observations of each bucket of durationBuckets,
+	// not cumulatively; the last one counts those above all bounds.
+	buckets   []int64
+	exemplars []*exemplar
+	sum       float64
+	count     int64
+}
+
+// finishedScan is a status event of a finished scan, waiting to be
+// counted.
+type finishedScan struct {
+	scanID uuid.UUID
+	status string
+}
+
+// Collector counts the finished scans. It is an http.Handler serving the
+// metrics.
+type Collector struct {
+	db           *gorm.DB
+	environments *labelValues
+	teams        *labelValues
+	pending      chan finishedScan
+
+	mu        sync.Mutex
+	finished  map[statusLabels]*counter
+	durations map[labels]*histogram
+}
+
+func NewCollector(db *gorm.DB, cfg config.ScanMetricsConfig) *Collector {
+	return &Collector{
+		db:           db,
+		environments: newLabelValues(cfg.Environments),
+		teams:        newLabelValues(cfg.Teams),
+		pending:      make(chan finishedScan, pendingEvents),
+		finished:     map[statusLabels]*counter{},
+		durations:    map[labels]*histogram{},
+	}
+}
+
+// Listen queues scans whose status event reports a final status; it is an
+// events.Listener.
+func (c *Collector) Listen(scanID uuid.UUID, ev events.Event) {
+	if ev.Type != events.TypeStatus {
+		return
+	}
+	var data struct {
+		Status string `json:"status"`
+	}
+	raw, err := json.Marshal(ev.Data)
+	if err != nil || json.Unmarshal(raw, &data) != nil || !finalStatuses[data.Status] {
+		return
+	}
+	select {
+	case c.pending <- finishedScan{scanID: scanID, status: data.Status}:
+	default:
+		slog.Warn("Dropping finished scan from the scan metrics", "scan_id", scanID)
+	}
+}
+
+// Run counts the queued scans until ctx is cancelled.
+func (c *Collector) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-c.pending:
+			if err := c.observe(ctx, f); err != nil {
+				slog.ErrorContext(ctx, "Failed to count finished scan", "scan_id", f.scanID, "error", err)
+			}
+		}
+	}
+}
+
+// observe loads the tags and times of a finished scan and counts it.
+func (c *Collector) observe(ctx context.Context, f finishedScan) error {
+	db := c.db.WithContext(ctx)
+	var startedAt, completedAt *time.Time
+	var tags []models.ScanTag
+
+	var scan models.PremiumScan
+	err := db.Select("id", "started_at", "completed_at").First(&scan, "id = ?", f.scanID).Error
+	switch {
+	case err == nil:
+		startedAt, completedAt = scan.StartedAt, scan.CompletedAt
+		if err := db.Where("scan_id = ?", f.scanID).Find(&tags).Error; err != nil {
+			return err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Free scans have no tags.
+		var free models.Scan
+		if err := db.Select("id", "started_at", "completed_at").First(&free, "id = ?", f.scanID).Error; err != nil {
+			return err
+		}
+		startedAt, completedAt = free.StartedAt, free.CompletedAt
+	default:
+		return err
+	}
+
+	l := labels{environment: LabelNone, team: LabelNone}
+	for _, t := range tags {
+		name, value, ok := strings.Cut(t.Tag, ":")
+		if !ok || value == "" {
+			continue
+		}
+		switch name {
+		case "env", "environment":
+			l.environment = c.environments.admit(value)
+		case "team":
+			l.team = c.teams.admit(value)
+		}
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := statusLabels{labels: l, status: f.status}
+	if c.finished[key] == nil {
+		c.finished[key] = &counter{}
+	}
+	c.finished[key].value++
+	c.finished[key].exemplar = exemplar{scanID: f.scanID, value: 1, at: now}
+
+	if (f.status != "COMPLETED" && f.status != "FAILED") || startedAt == nil || completedAt == nil {
+		return nil
+	}
+	seconds := completedAt.Sub(*startedAt).Seconds()
+	if seconds < 0 {
+		return nil
+	}
+	h := c.durations[l]
+	if h == nil {
+		h = &histogram{
+			buckets:   make([]int64, len(durationBuckets)+1),
+			exemplars: make([]*exemplar, len(durationBuckets)+1),
+		}
+		c.durations[l] = h
+	}
+	i := sort.SearchFloat64s(durationBuckets, seconds)
+	h.buckets[i]++
+	h.exemplars[i] = &exemplar{scanID: f.scanID, value: seconds, at: now}
+	h.sum += seconds
+	h.count++
+	return nil
+}
+
+// ServeHTTP writes the metrics in the OpenMetrics text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	finished := make([]statusLabels, 0, len(c.finished))
+	for key := range c.finished {
+		finished = append(finished, key)
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		a, b := finished[i], finished[j]
+		if a.environment != b.environment {
+			return a.environment < b.environment
+		}
+		if a.team != b.team {
+			return a.team < b.team
+		}
+		return a.status < b.status
+	})
+	durations := make([]labels, 0, len(c.durations))
+	for key := range c.durations {
+		durations = append(durations, key)
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		if durations[i].environment != durations[j].environment {
+			return durations[i].environment < durations[j].environment
+		}
+		return durations[i].team < durations[j].team
+	})
+
+	var b strings.Builder
+	b.WriteString("# TYPE antiginx_scans_finished counter\n")
+	b.WriteString("# HELP antiginx_scans_finished Scans that reached a final status.\n")
+	for _, key := range finished {
+		n := c.finished[key]
+		fmt.Fprintf(&b, "antiginx_scans_finished_total{environment=%s,team=%s,status=%s} %d%s\n",
+			metricLabel(key.environment), metricLabel(key.team), metricLabel(key.status), n.value, n.exemplar.format())
+	}
+	b.WriteString("# TYPE antiginx_scan_duration_seconds histogram\n")
+	b.WriteString("# HELP antiginx_scan_duration_seconds Time from the start to the end of completed and failed scans.\n")
+	for _, key := range durations {
+		h := c.durations[key]
+		series := fmt.Sprintf("environment=%s,team=%s", metricLabel(key.environment), metricLabel(key.team))
+		var cumulative int64
+		for i, count := range h.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(durationBuckets) {
+				le = strconv.FormatFloat(durationBuckets[i], 'g', -1, 64)
+			}
+			var ex string
+			if h.exemplars[i] != nil {
+				ex = h.exemplars[i].format()
+			}
+			fmt.Fprintf(&b, "antiginx_scan_duration_seconds_bucket{%s,le=%s} %d%s\n", series, metricLabel(le), cumulative, ex)
+		}
+		fmt.Fprintf(&b, "antiginx_scan_duration_seconds_count{%s} %d\n", series, h.count)
+		fmt.Fprintf(&b, "antiginx_scan_duration_seconds_sum{%s} %g\n", series, h.sum)
+	}
+	c.mu.Unlock()
+	b.WriteString("# EOF\n")
+
+	w.Header().Set("Content-Type", openMetricsContentType)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// format returns the exemplar as appended to a sample.
+func (e exemplar) format() string {
+	if e.scanID == uuid.Nil {
+		return ""
+	}
+	return fmt.Sprintf(" # {scan_id=%s} %g %.3f", metricLabel(e.scanID.String()), e.value, float64(e.at.UnixMilli())/1000)
+}
+
+// metricLabel quotes a label value, escaping backslashes, quotes and line
+// feeds as the exposition format requires.
+func metricLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// labelValues are the values a label may take.
+type labelValues struct {
+	mu      sync.Mutex
+	allowed map[string]bool
+	// open admits new values until maxAdmittedValues are allowed.
+	open bool
+}
+
+func newLabelValues(configured []string) *labelValues {
+	v := &labelValues{allowed: map[string]bool{}, open: len(configured) == 0}
+	for _, value := range configured {
+		v.allowed[value] = true
+	}
+	return v
+}
+
+// admit returns the label value reported for a tag value.
+func (v *labelValues) admit(value string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.allowed[value] {
+		return value
+	}
+	if v.open && len(v.allowed) < maxAdmittedValues {
+		v.allowed[value] = true
+		return value
+	}
+	return LabelOther
+}
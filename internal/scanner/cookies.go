@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+// CookieSecurityCheck inspects the cookies set while loading the target,
+// including those set by redirects, for missing Secure, HttpOnly and
+// SameSite attributes.
+type CookieSecurityCheck struct{}
+
+func init() {
+	register(CookieSecurityCheck{})
+}
+
+func (CookieSecurityCheck) ID() string {
+	return "cookie-sec"
+}
+
+// CookieInfo describes the attributes of one cookie. Values aren't
+// recorded, since they may be session secrets.
+type CookieInfo struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"http_only"`
+	SameSite string `json:"same_site,omitempty"`
+}
+
+// CookieMetadata is stored in the result metadata.
+type CookieMetadata struct {
+	Cookies []CookieInfo `json:"cookies"`
+	Issues  []string     `json:"issues"`
+}
+
+// sessionCookieHints mark cookie names that likely carry credentials, whose
+// missing HttpOnly flag is more severe.
+var sessionCookieHints = []string{"session", "sess", "sid", "auth", "token", "jwt"}
+
+func (CookieSecurityCheck) Version() int {
+	return 1
+}
+
+func (c CookieSecurityCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	responses, err := CaptureResponses(ctx, client, target)
+	if err != nil {
+		return inconclusive(Result{Name: c.ID()}, "Could not fetch target: %v", err)
+	}
+	return c.Evaluate(artifacts.Evidence{Responses: responses})
+}
+
+func (c CookieSecurityCheck) Evaluate(ev artifacts.Evidence) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+	if len(ev.Responses) == 0 {
+		return inconclusive(res, "No response of the target was captured")
+	}
+
+	meta := CookieMetadata{Cookies: []CookieInfo{}, Issues: []string{}}
+	for _, s := range ev.Responses {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			continue
+		}
+		for _, cookie := range (&http.Response{Header: headerOf(s)}).Cookies() {
+			info := CookieInfo{
+				Name:     cookie.Name,
+				URL:      s.URL,
+				Secure:   cookie.Secure,
+				HttpOnly: cookie.HttpOnly,
+				SameSite: sameSiteName(cookie.SameSite),
+			}
+			meta.Cookies = append(meta.Cookies, info)
+
+			threat, issues := evaluateCookie(info, u.Scheme == "https")
+			res.ThreatLevel = maxThreat(res.ThreatLevel, threat)
+			meta.Issues = append(meta.Issues, issues...)
+		}
+	}
+
+	switch {
+	case len(meta.Cookies) == 0:
+		res.Description = "No cookies are set."
+	case len(meta.Issues) == 0:
+		res.Description = fmt.Sprintf("All %d cookies are set with Secure, HttpOnly and SameSite.", len(meta.Cookies))
+	default:
+		res.Description = strings.Join(meta.Issues, "; ") + "."
+	}
+	res.Metadata = meta
+	return res
+}
+
+func evaluateCookie(info CookieInfo, https bool) (string, []string) {
+	threat := ThreatNone
+	var issues []string
+	if https && !info.Secure {
+		threat = maxThreat(threat, ThreatMedium)
+		issues = append(issues, fmt.Sprintf("cookie %s lacks the Secure flag", info.Name))
+	}
+	if !info.HttpOnly {
+		level := ThreatLow
+		if sessionCookie(info.Name) {
+			level = ThreatMedium
+		}
+		threat = maxThreat(threat, level)
+		issues = append(issues, fmt.Sprintf("cookie %s lacks the HttpOnly flag", info.Name))
+	}
+	switch {
+	case info.SameSite == "":
+		threat = maxThreat(threat, ThreatLow)
+		issues = append(issues, fmt.Sprintf("cookie %s has no SameSite attribute", info.Name))
+	case info.SameSite == "None" && !info.Secure:
+		// Browsers reject SameSite=None without Secure.
+		threat = maxThreat(threat, ThreatMedium)
+		issues = append(issues, fmt.Sprintf("cookie %s is SameSite=None without Secure", info.Name))
+	}
+	return threat, issues
+}
+
+func sessionCookie(name string) bool {
+	name = strings.ToLower(name)
+	for _, hint := range sessionCookieHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+func TestCookieSecurityCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   artifacts.Evidence
+		want string
+	}{
+		{"no cookies", evidenceOf("https://example.com/"), ThreatNone},
+		{"all attributes", evidenceOf("https://example.com/", "Set-Cookie", "session=abc; Secure; HttpOnly; SameSite=Lax"), ThreatNone},
+		{"plain HTTP doesn't need Secure", evidenceOf("http://example.com/", "Set-Cookie", "prefs=dark; HttpOnly; SameSite=Strict"), ThreatNone},
+		{"missing Secure over HTTPS", evidenceOf("https://example.com/", "Set-Cookie", "prefs=dark; HttpOnly; SameSite=Strict"), ThreatMedium},
+		{"missing HttpOnly", evidenceOf("https://example.com/", "Set-Cookie", "prefs=dark; Secure; SameSite=Strict"), ThreatLow},
+		{"session cookie without HttpOnly", evidenceOf("https://example.com/", "Set-Cookie", "AuthToken=abc; Secure; SameSite=Strict"), ThreatMedium},
+		{"missing SameSite", evidenceOf("https://example.com/", "Set-Cookie", "prefs=dark; Secure; HttpOnly"), ThreatLow},
+		{"SameSite=None without Secure", evidenceOf("http://example.com/", "Set-Cookie", "prefs=dark; HttpOnly; SameSite=None"), ThreatMedium},
+		{"worst cookie counts", evidenceOf("https://example.com/",
+			"Set-Cookie", "a=1; Secure; HttpOnly; SameSite=Lax",
+			"Set-Cookie", "sid=2; SameSite=Lax"), ThreatMedium},
+		{"cookies set by redirects", artifacts.Evidence{Responses: []artifacts.HeaderSnapshot{
+			{URL: "https://example.com/login", StatusCode: 302, Headers: []artifacts.HeaderField{{Name: "Set-Cookie", Value: "prefs=dark; Secure; HttpOnly"}}},
+			{URL: "https://example.com/", StatusCode: 200},
+		}}, ThreatLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := CookieSecurityCheck{}.Evaluate(tt.ev)
+			if res.ThreatLevel != tt.want {
+				t.Errorf("threat %s (%s), want %s", res.ThreatLevel, res.Description, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+	"github.com/prawo-i-piesc/backend/internal/handlers"
+)
+
+// Evaluator is a check that grades captured evidence instead of the live
+// target, so it can be run again on the evidence of past scans. Version
+// changes whenever the grading changes.
+type Evaluator interface {
+	Check
+	Version() int
+	Evaluate(ev artifacts.Evidence) Result
+}
+
+// Evaluators returns the registered checks that are Evaluators, by ID.
+func Evaluators() map[string]Evaluator {
+	out := map[string]Evaluator{}
+	for id, c := range registry {
+		if e, ok := c.(Evaluator); ok {
+			out[id] = e
+		}
+	}
+	return out
+}
+
+// CaptureResponses GETs the target, following redirects, and returns the
+// headers of every response, redirect hops first.
+func CaptureResponses(ctx context.Context, client *http.Client, target string) ([]artifacts.HeaderSnapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	var snapshots []artifacts.HeaderSnapshot
+	for r := resp; r != nil; r = r.Request.Response {
+		snapshots = append([]artifacts.HeaderSnapshot{snapshot(r)}, snapshots...)
+	}
+	return snapshots, nil
+}
+
+func snapshot(r *http.Response) artifacts.HeaderSnapshot {
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := []artifacts.HeaderField{}
+	for _, name := range names {
+		for _, value := range r.Header[name] {
+			fields = append(fields, artifacts.HeaderField{Name: name, Value: value})
+		}
+	}
+	return artifacts.HeaderSnapshot{
+		URL:        r.Request.URL.String(),
+		StatusCode: r.StatusCode,
+		Protocol:   r.Proto,
+		Headers:    fields,
+	}
+}
+
+// finalResponse returns the URL and headers of the last captured
+// response, or false if there is none.
+func finalResponse(ev artifacts.Evidence) (*url.URL, http.Header, bool) {
+	if len(ev.Responses) == 0 {
+		return nil, nil, false
+	}
+	last := ev.Responses[len(ev.Responses)-1]
+	u, err := url.Parse(last.URL)
+	if err != nil {
+		return nil, nil, false
+	}
+	return u, headerOf(last), true
+}
+
+// headerOf rebuilds the header of a captured response.
+func headerOf(s artifacts.HeaderSnapshot) http.Header {
+	h := http.Header{}
+	for _, f := range s.Headers {
+		h.Add(f.Name, f.Value)
+	}
+	return h
+}
+
+// Reevaluator runs the current Evaluators on stored evidence; it
+// implements handlers.Reevaluator.
+type Reevaluator struct{}
+
+func (Reevaluator) Versions() map[string]int {
+	versions := map[string]int{}
+	for id, e := range Evaluators() {
+		versions[id] = e.Version()
+	}
+	return versions
+}
+
+func (Reevaluator) Reevaluate(ev artifacts.Evidence, tests []string) []handlers.ReevaluatedTest {
+	evaluators := Evaluators()
+	out := make([]handlers.ReevaluatedTest, 0, len(tests))
+	for _, test := range tests {
+		e, ok := evaluators[test]
+		if !ok {
+			continue
+		}
+		result := e.Evaluate(ev)
+		out = append(out, handlers.ReevaluatedTest{
+			Version: e.Version(),
+			Result: handlers.EngineTestResult{
+				Name:        result.Name,
+				Certainty:   result.Certainty,
+				ThreatLevel: result.ThreatLevel,
+				Metadata:    result.Metadata,
+				Description: result.Description,
+			},
+		})
+	}
+	return out
+}
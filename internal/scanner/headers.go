@@ -0,0 +1,256 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+// minHSTSMaxAge is the shortest HSTS max-age, 180 days, that isn't
+// reported as too short.
+const minHSTSMaxAge = 180 * 24 * 60 * 60
+
+// HeaderCheck inspects response headers of the target's page, after
+// redirects. Each security header has its own check ID, as in the test
+// catalog.
+type HeaderCheck struct {
+	id      string
+	version int
+	// evaluate grades the final response.
+	evaluate func(u *url.URL, h http.Header) (threat string, issues []string)
+	// passed describes a response without issues.
+	passed string
+}
+
+// HeaderMetadata is stored in the result metadata.
+type HeaderMetadata struct {
+	URL string `json:"url"`
+	// Headers are the inspected headers the response carried.
+	Headers map[string]string `json:"headers"`
+	Issues  []string          `json:"issues"`
+}
+
+func init() {
+	register(HeaderCheck{id: "hsts", version: 1, evaluate: evaluateHSTS, passed: "Strict-Transport-Security is set with a max-age of at least 180 days."})
+	register(HeaderCheck{id: "csp", version: 1, evaluate: evaluateCSP, passed: "Content-Security-Policy restricts scripts without unsafe sources."})
+	register(HeaderCheck{id: "xframe", version: 1, evaluate: evaluateFraming, passed: "Framing by other sites is prevented."})
+	register(HeaderCheck{id: "permissions-policy", version: 1, evaluate: evaluatePermissionsPolicy, passed: "Permissions-Policy is set."})
+	register(HeaderCheck{id: "x-content-type-options", version: 1, evaluate: evaluateNoSniff, passed: "X-Content-Type-Options is nosniff."})
+	register(HeaderCheck{id: "referrer-policy", version: 1, evaluate: evaluateReferrerPolicy, passed: "Referrer-Policy doesn't leak full URLs to other origins."})
+	register(HeaderCheck{id: "cross-origin-x", version: 1, evaluate: evaluateCrossOrigin, passed: "Cross-origin isolation headers are set."})
+	register(HeaderCheck{id: "serv-h-a", version: 1, evaluate: evaluateServerHeaders, passed: "Response headers don't disclose server software versions."})
+}
+
+func (c HeaderCheck) ID() string {
+	return c.id
+}
+
+// inspectedHeaders are the headers copied into the metadata.
+var inspectedHeaders = []string{
+	"Strict-Transport-Security", "Content-Security-Policy", "Content-Security-Policy-Report-Only",
+	"X-Frame-Options", "Permissions-Policy", "X-Content-Type-Options", "Referrer-Policy",
+	"Cross-Origin-Opener-Policy", "Cross-Origin-Resource-Policy", "Cross-Origin-Embedder-Policy",
+	"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version",
+}
+
+func (c HeaderCheck) Version() int {
+	return c.version
+}
+
+func (c HeaderCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	responses, err := CaptureResponses(ctx, client, target)
+	if err != nil {
+		return inconclusive(Result{Name: c.ID()}, "Could not fetch target: %v", err)
+	}
+	return c.Evaluate(artifacts.Evidence{Responses: responses})
+}
+
+func (c HeaderCheck) Evaluate(ev artifacts.Evidence) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+
+	u, header, ok := finalResponse(ev)
+	if !ok {
+		return inconclusive(res, "No response of the target was captured")
+	}
+
+	meta := HeaderMetadata{URL: u.String(), Headers: map[string]string{}, Issues: []string{}}
+	for _, name := range inspectedHeaders {
+		if value := header.Get(name); value != "" {
+			meta.Headers[name] = value
+		}
+	}
+	threat, issues := c.evaluate(u, header)
+	res.ThreatLevel = threat
+	if len(issues) == 0 {
+		res.Description = c.passed
+	} else {
+		meta.Issues = issues
+		res.Description = strings.Join(issues, "; ") + "."
+	}
+	res.Metadata = meta
+	return res
+}
+
+func evaluateHSTS(u *url.URL, h http.Header) (string, []string) {
+	if u.Scheme != "https" {
+		return ThreatHigh, []string{"the page is served over plain HTTP, so HSTS can't apply"}
+	}
+	value := h.Get("Strict-Transport-Security")
+	if value == "" {
+		return ThreatMedium, []string{"Strict-Transport-Security is missing"}
+	}
+	maxAge := -1
+	for _, directive := range strings.Split(value, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if n, err := strconv.Atoi(strings.Trim(arg, `"`)); err == nil {
+				maxAge = n
+			}
+		}
+	}
+	switch {
+	case maxAge < 0:
+		return ThreatMedium, []string{"Strict-Transport-Security has no valid max-age"}
+	case maxAge == 0:
+		return ThreatMedium, []string{"Strict-Transport-Security has max-age=0, which disables it"}
+	case maxAge < minHSTSMaxAge:
+		return ThreatLow, []string{fmt.Sprintf("Strict-Transport-Security max-age of %d seconds is shorter than 180 days", maxAge)}
+	}
+	return ThreatNone, nil
+}
+
+func evaluateCSP(u *url.URL, h http.Header) (string, []string) {
+	policy := h.Get("Content-Security-Policy")
+	if policy == "" {
+		if h.Get("Content-Security-Policy-Report-Only") != "" {
+			return ThreatLow, []string{"Content-Security-Policy is only set in report-only mode, which doesn't block anything"}
+		}
+		return ThreatMedium, []string{"Content-Security-Policy is missing"}
+	}
+
+	directives := map[string][]string{}
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 {
+			directives[strings.ToLower(fields[0])] = fields[1:]
+		}
+	}
+	sources, ok := directives["script-src"]
+	if !ok {
+		sources, ok = directives["default-src"]
+	}
+	if !ok {
+		return ThreatMedium, []string{"Content-Security-Policy restricts neither script-src nor default-src"}
+	}
+
+	threat := ThreatNone
+	var issues []string
+	nonceOrHash := false
+	for _, source := range sources {
+		source = strings.ToLower(source)
+		if strings.HasPrefix(source, "'nonce-") || strings.HasPrefix(source, "'sha") || source == "'strict-dynamic'" {
+			nonceOrHash = true
+		}
+	}
+	for _, source := range sources {
+		switch strings.ToLower(source) {
+		case "*", "http:", "https:", "data:":
+			threat = maxThreat(threat, ThreatMedium)
+			issues = append(issues, fmt.Sprintf("scripts may be loaded from %s", source))
+		case "'unsafe-inline'":
+			// Browsers ignore 'unsafe-inline' next to nonces and hashes.
+			if !nonceOrHash {
+				threat = maxThreat(threat, ThreatLow)
+				issues = append(issues, "inline scripts are allowed with 'unsafe-inline'")
+			}
+		case "'unsafe-eval'":
+			threat = maxThreat(threat, ThreatLow)
+			issues = append(issues, "eval() is allowed with 'unsafe-eval'")
+		}
+	}
+	return threat, issues
+}
+
+func evaluateFraming(u *url.URL, h http.Header) (string, []string) {
+	if strings.Contains(strings.ToLower(h.Get("Content-Security-Policy")), "frame-ancestors") {
+		return ThreatNone, nil
+	}
+	switch value := strings.ToUpper(strings.TrimSpace(h.Get("X-Frame-Options"))); {
+	case value == "DENY" || value == "SAMEORIGIN":
+		return ThreatNone, nil
+	case value == "":
+		return ThreatMedium, []string{"neither X-Frame-Options nor a frame-ancestors policy prevents clickjacking"}
+	case strings.HasPrefix(value, "ALLOW-FROM"):
+		return ThreatLow, []string{"X-Frame-Options ALLOW-FROM is ignored by modern browsers; use frame-ancestors"}
+	default:
+		return ThreatMedium, []string{fmt.Sprintf("X-Frame-Options has the invalid value %q", value)}
+	}
+}
+
+func evaluatePermissionsPolicy(u *url.URL, h http.Header) (string, []string) {
+	if h.Get("Permissions-Policy") == "" {
+		return ThreatLow, []string{"Permissions-Policy is missing, so embedded content may request powerful browser features"}
+	}
+	return ThreatNone, nil
+}
+
+func evaluateNoSniff(u *url.URL, h http.Header) (string, []string) {
+	if !strings.EqualFold(strings.TrimSpace(h.Get("X-Content-Type-Options")), "nosniff") {
+		return ThreatLow, []string{"X-Content-Type-Options isn't nosniff, so browsers may sniff content types"}
+	}
+	return ThreatNone, nil
+}
+
+func evaluateReferrerPolicy(u *url.URL, h http.Header) (string, []string) {
+	// The last valid policy of a comma-separated list applies.
+	policies := strings.Split(h.Get("Referrer-Policy"), ",")
+	policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1]))
+	switch policy {
+	case "":
+		return ThreatLow, []string{"Referrer-Policy is missing"}
+	case "unsafe-url", "no-referrer-when-downgrade":
+		return ThreatLow, []string{fmt.Sprintf("Referrer-Policy %s sends full URLs to other origins", policy)}
+	}
+	return ThreatNone, nil
+}
+
+func evaluateCrossOrigin(u *url.URL, h http.Header) (string, []string) {
+	threat := ThreatNone
+	var issues []string
+	for _, header := range []string{"Cross-Origin-Opener-Policy", "Cross-Origin-Resource-Policy"} {
+		if h.Get(header) == "" {
+			threat = maxThreat(threat, ThreatLow)
+			issues = append(issues, header+" is missing")
+		}
+	}
+	if h.Get("Cross-Origin-Embedder-Policy") == "" {
+		threat = maxThreat(threat, ThreatInfo)
+		issues = append(issues, "Cross-Origin-Embedder-Policy is missing")
+	}
+	return threat, issues
+}
+
+// versionPattern matches version numbers such as nginx/1.25.3.
+var versionPattern = regexp.MustCompile(`\d+\.\d+`)
+
+func evaluateServerHeaders(u *url.URL, h http.Header) (string, []string) {
+	threat := ThreatNone
+	var issues []string
+	if server := h.Get("Server"); versionPattern.MatchString(server) {
+		threat = ThreatLow
+		issues = append(issues, fmt.Sprintf("Server discloses the version %q", server))
+	}
+	for _, header := range []string{"X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version"} {
+		if value := h.Get(header); value != "" {
+			threat = ThreatLow
+			issues = append(issues, fmt.Sprintf("%s discloses %q", header, value))
+		}
+	}
+	return threat, issues
+}
@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+// evidenceOf is the evidence of a single response of url with the given
+// header fields, as name/value pairs.
+func evidenceOf(url string, fields ...string) artifacts.Evidence {
+	s := artifacts.HeaderSnapshot{URL: url, StatusCode: 200}
+	for i := 0; i+1 < len(fields); i += 2 {
+		s.Headers = append(s.Headers, artifacts.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	return artifacts.Evidence{Responses: []artifacts.HeaderSnapshot{s}}
+}
+
+func TestHeaderChecks(t *testing.T) {
+	const page = "https://example.com/"
+	tests := []struct {
+		check string
+		ev    artifacts.Evidence
+		want  string
+	}{
+		{"hsts", evidenceOf(page, "Strict-Transport-Security", "max-age=31536000; includeSubDomains"), ThreatNone},
+		{"hsts", evidenceOf(page, "Strict-Transport-Security", `max-age="86400"`), ThreatLow},
+		{"hsts", evidenceOf(page, "Strict-Transport-Security", "max-age=0"), ThreatMedium},
+		{"hsts", evidenceOf(page, "Strict-Transport-Security", "includeSubDomains"), ThreatMedium},
+		{"hsts", evidenceOf(page), ThreatMedium},
+		{"hsts", evidenceOf("http://example.com/", "Strict-Transport-Security", "max-age=31536000"), ThreatHigh},
+
+		{"csp", evidenceOf(page, "Content-Security-Policy", "default-src 'self'"), ThreatNone},
+		{"csp", evidenceOf(page, "Content-Security-Policy", "script-src 'self' 'unsafe-inline' 'nonce-abc'"), ThreatNone},
+		{"csp", evidenceOf(page, "Content-Security-Policy", "script-src 'self' 'unsafe-inline'"), ThreatLow},
+		{"csp", evidenceOf(page, "Content-Security-Policy", "default-src 'self'; script-src https:"), ThreatMedium},
+		{"csp", evidenceOf(page, "Content-Security-Policy", "img-src 'self'"), ThreatMedium},
+		{"csp", evidenceOf(page, "Content-Security-Policy-Report-Only", "default-src 'self'"), ThreatLow},
+		{"csp", evidenceOf(page), ThreatMedium},
+
+		{"xframe", evidenceOf(page, "X-Frame-Options", "deny"), ThreatNone},
+		{"xframe", evidenceOf(page, "Content-Security-Policy", "frame-ancestors 'none'"), ThreatNone},
+		{"xframe", evidenceOf(page, "X-Frame-Options", "ALLOW-FROM https://partner.example"), ThreatLow},
+		{"xframe", evidenceOf(page, "X-Frame-Options", "ALLOWALL"), ThreatMedium},
+		{"xframe", evidenceOf(page), ThreatMedium},
+
+		{"permissions-policy", evidenceOf(page, "Permissions-Policy", "camera=()"), ThreatNone},
+		{"permissions-policy", evidenceOf(page), ThreatLow},
+
+		{"x-content-type-options", evidenceOf(page, "X-Content-Type-Options", " NoSniff "), ThreatNone},
+		{"x-content-type-options", evidenceOf(page, "X-Content-Type-Options", "sniff"), ThreatLow},
+
+		{"referrer-policy", evidenceOf(page, "Referrer-Policy", "strict-origin-when-cross-origin"), ThreatNone},
+		{"referrer-policy", evidenceOf(page, "Referrer-Policy", "no-referrer, unsafe-url"), ThreatLow},
+		{"referrer-policy", evidenceOf(page, "Referrer-Policy", "unsafe-url, no-referrer"), ThreatNone},
+		{"referrer-policy", evidenceOf(page), ThreatLow},
+
+		{"cross-origin-x", evidenceOf(page, "Cross-Origin-Opener-Policy", "same-origin", "Cross-Origin-Resource-Policy", "same-origin", "Cross-Origin-Embedder-Policy", "require-corp"), ThreatNone},
+		{"cross-origin-x", evidenceOf(page, "Cross-Origin-Opener-Policy", "same-origin", "Cross-Origin-Resource-Policy", "same-origin"), ThreatInfo},
+		{"cross-origin-x", evidenceOf(page, "Cross-Origin-Resource-Policy", "same-origin"), ThreatLow},
+
+		{"serv-h-a", evidenceOf(page, "Server", "nginx"), ThreatNone},
+		{"serv-h-a", evidenceOf(page, "Server", "nginx/1.25.3"), ThreatLow},
+		{"serv-h-a", evidenceOf(page, "X-Powered-By", "PHP/8.2"), ThreatLow},
+	}
+	for _, tt := range tests {
+		check, ok := Lookup(tt.check)
+		if !ok {
+			t.Fatalf("check %s isn't registered", tt.check)
+		}
+		res := check.(Evaluator).Evaluate(tt.ev)
+		if res.ThreatLevel != tt.want {
+			t.Errorf("%s on %v: threat %s (%s), want %s", tt.check, tt.ev.Responses[0].Headers, res.ThreatLevel, res.Description, tt.want)
+		}
+	}
+}
+
+func TestHeaderCheckUsesFinalResponse(t *testing.T) {
+	ev := artifacts.Evidence{Responses: []artifacts.HeaderSnapshot{
+		{URL: "http://example.com/", StatusCode: 301, Headers: []artifacts.HeaderField{{Name: "Location", Value: "https://example.com/"}}},
+		{URL: "https://example.com/", StatusCode: 200, Headers: []artifacts.HeaderField{{Name: "Strict-Transport-Security", Value: "max-age=63072000"}}},
+	}}
+	check, _ := Lookup("hsts")
+	if res := check.(Evaluator).Evaluate(ev); res.ThreatLevel != ThreatNone {
+		t.Errorf("threat %s (%s), want %s", res.ThreatLevel, res.Description, ThreatNone)
+	}
+	if res := check.(Evaluator).Evaluate(artifacts.Evidence{}); res.ThreatLevel != ThreatInfo || res.Certainty != 0 {
+		t.Errorf("without responses: threat %s, certainty %d; want an inconclusive result", res.ThreatLevel, res.Certainty)
+	}
+}
@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxDocumentSize bounds how much of the target's HTML is parsed.
+const maxDocumentSize = 5 << 20
+
+// MixedContentCheck parses the target's HTML and reports subresources
+// loaded over plain HTTP from an HTTPS page, the origins of third-party
+// scripts and third-party scripts loaded without Subresource Integrity.
+type MixedContentCheck struct{}
+
+func init() {
+	register(MixedContentCheck{})
+}
+
+func (MixedContentCheck) ID() string {
+	return "mixed-content"
+}
+
+// MixedContentMetadata is stored in the result metadata so reports can list
+// the exact offending URLs.
+type MixedContentMetadata struct {
+	PageURL                   string   `json:"page_url"`
+	ActiveMixedContent        []string `json:"active_mixed_content"`
+	PassiveMixedContent       []string `json:"passive_mixed_content"`
+	InsecureSubresources      []string `json:"insecure_subresources"`
+	ThirdPartyScriptOrigins   []string `json:"third_party_script_origins"`
+	UnpinnedThirdPartyScripts []string `json:"unpinned_third_party_scripts"`
+	ThirdPartyScriptsWithSRI  int      `json:"third_party_scripts_with_sri"`
+	ThirdPartyScriptsTotal    int      `json:"third_party_scripts_total"`
+}
+
+// subresource describes a URL referenced by the document.
+type subresource struct {
+	url    *url.URL
+	active bool
+	script bool
+	sri    bool
+}
+
+func (c MixedContentCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		res.ThreatLevel = ThreatInfo
+		res.Certainty = 0
+		res.Description = fmt.Sprintf("Invalid target URL: %v", err)
+		return res
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		res.ThreatLevel = ThreatInfo
+		res.Certainty = 0
+		res.Description = fmt.Sprintf("Could not fetch target: %v", err)
+		return res
+	}
+	defer resp.Body.Close()
+
+	// The final URL after redirects determines the page origin.
+	pageURL := resp.Request.URL
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		res.ThreatLevel = ThreatInfo
+		res.Certainty = 0
+		res.Description = fmt.Sprintf("Could not parse HTML: %v", err)
+		return res
+	}
+
+	meta := MixedContentMetadata{
+		PageURL:                   pageURL.String(),
+		ActiveMixedContent:        []string{},
+		PassiveMixedContent:       []string{},
+		InsecureSubresources:      []string{},
+		ThirdPartyScriptOrigins:   []string{},
+		UnpinnedThirdPartyScripts: []string{},
+	}
+
+	origins := map[string]bool{}
+	for _, r := range collectSubresources(doc, pageURL) {
+		if r.url.Scheme == "http" {
+			meta.InsecureSubresources = append(meta.InsecureSubresources, r.url.String())
+			if pageURL.Scheme == "https" {
+				if r.active {
+					meta.ActiveMixedContent = append(meta.ActiveMixedContent, r.url.String())
+				} else {
+					meta.PassiveMixedContent = append(meta.PassiveMixedContent, r.url.String())
+				}
+			}
+		}
+
+		if r.script && !sameSite(pageURL, r.url) {
+			meta.ThirdPartyScriptsTotal++
+			origins[r.url.Scheme+"://"+r.url.Host] = true
+			if r.sri {
+				meta.ThirdPartyScriptsWithSRI++
+			} else {
+				meta.UnpinnedThirdPartyScripts = append(meta.UnpinnedThirdPartyScripts, r.url.String())
+			}
+		}
+	}
+	for origin := range origins {
+		meta.ThirdPartyScriptOrigins = append(meta.ThirdPartyScriptOrigins, origin)
+	}
+	sort.Strings(meta.ThirdPartyScriptOrigins)
+
+	var problems []string
+	if n := len(meta.ActiveMixedContent); n > 0 {
+		res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatHigh)
+		problems = append(problems, fmt.Sprintf("%d active resource(s) loaded over HTTP", n))
+	}
+	if n := len(meta.PassiveMixedContent); n > 0 {
+		res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatMedium)
+		problems = append(problems, fmt.Sprintf("%d passive resource(s) loaded over HTTP", n))
+	}
+	if n := len(meta.UnpinnedThirdPartyScripts); n > 0 {
+		res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatMedium)
+		problems = append(problems, fmt.Sprintf("%d third-party script(s) without Subresource Integrity", n))
+	}
+
+	if len(problems) == 0 {
+		res.Description = "No mixed content found and all third-party scripts are pinned with Subresource Integrity."
+	} else {
+		res.Description = strings.Join(problems, "; ") + "."
+	}
+	res.Metadata = meta
+	return res
+}
+
+// collectSubresources walks the document and returns every subresource URL
+// resolved against the page URL (honouring <base href>).
+func collectSubresources(doc *html.Node, pageURL *url.URL) []subresource {
+	base := pageURL
+	var out []subresource
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attrs := map[string]string{}
+			for _, a := range n.Attr {
+				attrs[strings.ToLower(a.Key)] = a.Val
+			}
+
+			var ref string
+			var active, script bool
+			switch n.Data {
+			case "base":
+				if u, err := pageURL.Parse(strings.TrimSpace(attrs["href"])); err == nil && attrs["href"] != "" {
+					base = u
+				}
+			case "script":
+				ref, active, script = attrs["src"], true, true
+			case "link":
+				rel := strings.ToLower(attrs["rel"])
+				if strings.Contains(rel, "stylesheet") || strings.Contains(rel, "preload") || strings.Contains(rel, "modulepreload") {
+					ref, active = attrs["href"], true
+					script = strings.Contains(rel, "modulepreload") || strings.EqualFold(attrs["as"], "script")
+				} else if strings.Contains(rel, "icon") {
+					ref = attrs["href"]
+				}
+			case "iframe", "frame", "embed":
+				ref, active = attrs["src"], true
+			case "object":
+				ref, active = attrs["data"], true
+			case "img", "audio", "video", "source", "track":
+				ref = attrs["src"]
+			case "form":
+				ref, active = attrs["action"], true
+			}
+
+			if ref = strings.TrimSpace(ref); ref != "" {
+				if u, err := base.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					_, hasSRI := attrs["integrity"]
+					out = append(out, subresource{url: u, active: active, script: script, sri: hasSRI})
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return out
+}
+
+// sameSite reports whether u is served from the page's host or one of its
+// subdomains (or the parent domain it is a subdomain of).
+func sameSite(page, u *url.URL) bool {
+	ph := strings.TrimPrefix(strings.ToLower(page.Hostname()), "www.")
+	uh := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	return ph == uh || strings.HasSuffix(uh, "."+ph) || strings.HasSuffix(ph, "."+uh)
+}
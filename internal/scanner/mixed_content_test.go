@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMixedContentCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+		// wantActive and wantPassive are the counts of mixed content.
+		wantActive, wantPassive int
+	}{
+		{"clean page", `<img src="/logo.png"><script src="/app.js"></script>`, ThreatNone, 0, 0},
+		{"HTTP image", `<img src="http://cdn.example.com/logo.png">`, ThreatMedium, 0, 1},
+		{"HTTP script", `<script src="http://cdn.example.com/app.js" integrity="sha384-x"></script>`, ThreatHigh, 1, 0},
+		{"HTTP stylesheet", `<link rel="stylesheet" href="http://cdn.example.com/site.css">`, ThreatHigh, 1, 0},
+		{"HTTP form", `<form action="http://example.org/login"></form>`, ThreatHigh, 1, 0},
+		{"base href", `<base href="http://cdn.example.com/"><img src="logo.png">`, ThreatMedium, 0, 1},
+		{"third-party script without SRI", `<script src="https://cdn.example.com/lib.js"></script>`, ThreatMedium, 0, 0},
+		{"third-party script with SRI", `<script src="https://cdn.example.com/lib.js" integrity="sha384-x" crossorigin></script>`, ThreatNone, 0, 0},
+		{"links aren't subresources", `<a href="http://example.org/">elsewhere</a>`, ThreatNone, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<!doctype html><html><head></head><body>%s</body></html>", tt.html)
+			}))
+			defer srv.Close()
+
+			res := MixedContentCheck{}.Run(context.Background(), srv.Client(), srv.URL)
+			if res.ThreatLevel != tt.want {
+				t.Errorf("threat %s (%s), want %s", res.ThreatLevel, res.Description, tt.want)
+			}
+			meta, ok := res.Metadata.(MixedContentMetadata)
+			if !ok {
+				t.Fatalf("metadata = %T, want MixedContentMetadata", res.Metadata)
+			}
+			if len(meta.ActiveMixedContent) != tt.wantActive || len(meta.PassiveMixedContent) != tt.wantPassive {
+				t.Errorf("active %q, passive %q; want %d and %d", meta.ActiveMixedContent, meta.PassiveMixedContent, tt.wantActive, tt.wantPassive)
+			}
+		})
+	}
+}
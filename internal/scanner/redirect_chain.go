@@ -0,0 +1,202 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRedirectHops bounds how many redirects are followed per chain.
+const maxRedirectHops = 10
+
+// RedirectChainCheck follows the redirect chains starting at the http://
+// and https:// variants of the target (with and without the www. prefix)
+// and reports missing permanent redirects to HTTPS, redirect loops and
+// hops that downgrade from HTTPS back to HTTP.
+type RedirectChainCheck struct{}
+
+func init() {
+	register(RedirectChainCheck{})
+}
+
+func (RedirectChainCheck) ID() string {
+	return "redirect-chain"
+}
+
+// RedirectHop is a single request in a redirect chain.
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location,omitempty"`
+}
+
+// RedirectChain is the full chain followed from one starting URL.
+type RedirectChain struct {
+	Start     string        `json:"start"`
+	Hops      []RedirectHop `json:"hops"`
+	FinalURL  string        `json:"final_url"`
+	Loop      bool          `json:"loop"`
+	Downgrade bool          `json:"downgrade"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// RedirectChainMetadata is stored in the result metadata for the report.
+type RedirectChainMetadata struct {
+	Chains []RedirectChain `json:"chains"`
+	Issues []string        `json:"issues"`
+}
+
+func (c RedirectChainCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		res.ThreatLevel = ThreatInfo
+		res.Certainty = 0
+		res.Description = "Invalid target URL"
+		return res
+	}
+
+	// Inspect every hop ourselves instead of letting the client follow them.
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	meta := RedirectChainMetadata{Chains: []RedirectChain{}, Issues: []string{}}
+	for _, start := range redirectStartURLs(u) {
+		chain := followChain(ctx, &noFollow, start)
+		meta.Chains = append(meta.Chains, chain)
+
+		if chain.Error != "" {
+			continue
+		}
+		if chain.Loop {
+			res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatMedium)
+			meta.Issues = append(meta.Issues, fmt.Sprintf("redirect loop starting at %s", start))
+		}
+		if chain.Downgrade {
+			res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatHigh)
+			meta.Issues = append(meta.Issues, fmt.Sprintf("HTTPS to HTTP downgrade in chain starting at %s", start))
+		}
+		if strings.HasPrefix(start, "http://") && !chain.Loop {
+			switch {
+			case !strings.HasPrefix(chain.FinalURL, "https://"):
+				res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatHigh)
+				meta.Issues = append(meta.Issues, fmt.Sprintf("%s does not redirect to HTTPS", start))
+			case len(chain.Hops) > 0 && !isPermanentRedirect(chain.Hops[0].StatusCode):
+				res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatLow)
+				meta.Issues = append(meta.Issues, fmt.Sprintf("%s redirects to HTTPS with a temporary %d instead of 301", start, chain.Hops[0].StatusCode))
+			}
+		}
+	}
+
+	reachable := false
+	for _, chain := range meta.Chains {
+		if chain.Error == "" {
+			reachable = true
+			break
+		}
+	}
+	if !reachable {
+		res.ThreatLevel = ThreatInfo
+		res.Certainty = 0
+		res.Description = "Target could not be reached over HTTP or HTTPS"
+		res.Metadata = meta
+		return res
+	}
+
+	if len(meta.Issues) == 0 {
+		res.Description = "All HTTP variants permanently redirect to HTTPS without loops or downgrades."
+	} else {
+		res.Description = strings.Join(meta.Issues, "; ") + "."
+	}
+	res.Metadata = meta
+	return res
+}
+
+// redirectStartURLs returns the http:// and https:// variants of the target
+// for both the bare and the www. host. An explicit port belongs to the
+// target's own scheme, so the other scheme uses its default port.
+func redirectStartURLs(u *url.URL) []string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	port := u.Port()
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var out []string
+	for _, h := range []string{host, "www." + host} {
+		for _, scheme := range []string{"http", "https"} {
+			addr := h
+			if port != "" && strings.EqualFold(scheme, u.Scheme) {
+				addr = net.JoinHostPort(h, port)
+			} else if strings.Contains(h, ":") {
+				addr = "[" + h + "]"
+			}
+			out = append(out, scheme+"://"+addr+path)
+		}
+	}
+	return out
+}
+
+func followChain(ctx context.Context, client *http.Client, start string) RedirectChain {
+	chain := RedirectChain{Start: start, Hops: []RedirectHop{}}
+	seen := map[string]bool{}
+	current := start
+
+	for i := 0; i <= maxRedirectHops; i++ {
+		if seen[current] {
+			chain.Loop = true
+			chain.FinalURL = current
+			return chain
+		}
+		seen[current] = true
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, current, nil)
+		if err != nil {
+			chain.Error = err.Error()
+			return chain
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			chain.Error = err.Error()
+			return chain
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		hop := RedirectHop{URL: current, StatusCode: resp.StatusCode}
+		location, err := resp.Location()
+		if err != nil {
+			chain.Hops = append(chain.Hops, hop)
+			chain.FinalURL = current
+			if !errors.Is(err, http.ErrNoLocation) {
+				chain.Error = err.Error()
+			}
+			return chain
+		}
+
+		hop.Location = location.String()
+		chain.Hops = append(chain.Hops, hop)
+		if strings.HasPrefix(current, "https://") && location.Scheme == "http" {
+			chain.Downgrade = true
+		}
+		current = location.String()
+	}
+
+	// Too many hops is treated the same way browsers do: as a loop.
+	chain.Loop = true
+	chain.FinalURL = current
+	return chain
+}
+
+func isPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
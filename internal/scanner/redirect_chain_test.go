@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestRedirectStartURLs(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"https://example.com", []string{
+			"http://example.com/", "https://example.com/",
+			"http://www.example.com/", "https://www.example.com/",
+		}},
+		{"http://WWW.Example.com/login?next=1", []string{
+			"http://example.com/login", "https://example.com/login",
+			"http://www.example.com/login", "https://www.example.com/login",
+		}},
+		{"https://example.com:8443/app", []string{
+			"http://example.com/app", "https://example.com:8443/app",
+			"http://www.example.com/app", "https://www.example.com:8443/app",
+		}},
+		{"http://example.com:8080", []string{
+			"http://example.com:8080/", "https://example.com/",
+			"http://www.example.com:8080/", "https://www.example.com/",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			u, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := redirectStartURLs(u); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("redirectStartURLs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
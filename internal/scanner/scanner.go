@@ -0,0 +1,102 @@
+// Package scanner provides security checks that run against a target URL.
+//
+// Every check reports its outcome as a Result, which mirrors the JSON shape
+// produced by the external scanning engine (see handlers.EngineTestResult),
+// so results from built-in checks can be ingested exactly like engine results.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/httpclient"
+)
+
+// Threat levels reported by checks. They match the values sent by the
+// scanning engine in the ThreatLevel field.
+const (
+	ThreatNone     = "None"
+	ThreatInfo     = "Info"
+	ThreatLow      = "Low"
+	ThreatMedium   = "Medium"
+	ThreatHigh     = "High"
+	ThreatCritical = "Critical"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name        string      `json:"Name"`
+	Certainty   int         `json:"Certainty"`
+	ThreatLevel string      `json:"ThreatLevel"`
+	Metadata    interface{} `json:"Metadata"`
+	Description string      `json:"Description"`
+}
+
+// Check is a single security test identified by the same ID that is used
+// in the --tests task parameter (e.g. "mixed-content").
+type Check interface {
+	ID() string
+	Run(ctx context.Context, client *http.Client, target string) Result
+}
+
+var registry = map[string]Check{}
+
+func register(c Check) {
+	registry[c.ID()] = c
+}
+
+// Lookup returns the check registered under the given test ID.
+func Lookup(id string) (Check, bool) {
+	c, ok := registry[id]
+	return c, ok
+}
+
+// IDs returns the sorted IDs of all registered checks.
+func IDs() []string {
+	ids := make([]string, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NewClient returns an HTTP client suitable for running checks. It uses the
+// egress policy of the httpclient package, so scan targets resolving to
+// internal addresses are refused unless allowPrivate is set. Redirects are
+// followed by default; checks that need to inspect individual hops override
+// CheckRedirect on a copy of the client.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: httpclient.NewTransport(allowPrivate),
+	}
+}
+
+// maxThreat returns the more severe of the two threat levels.
+func maxThreat(a, b string) string {
+	if threatRank[b] > threatRank[a] {
+		return b
+	}
+	return a
+}
+
+var threatRank = map[string]int{
+	ThreatNone:     0,
+	ThreatInfo:     1,
+	ThreatLow:      2,
+	ThreatMedium:   3,
+	ThreatHigh:     4,
+	ThreatCritical: 5,
+}
+
+// inconclusive marks a result of a check that couldn't run.
+func inconclusive(res Result, format string, args ...interface{}) Result {
+	res.ThreatLevel = ThreatInfo
+	res.Certainty = 0
+	res.Description = fmt.Sprintf(format, args...)
+	return res
+}
@@ -0,0 +1,300 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+// Certificates expiring within these windows are reported.
+const (
+	certExpiryWarning = 30 * 24 * time.Hour
+	certExpiryUrgent  = 14 * 24 * time.Hour
+)
+
+// TLSCheck inspects the TLS configuration of the target's HTTPS endpoint:
+// the negotiated protocol and cipher suite, and whether legacy protocols
+// (TLS 1.0 and 1.1) or insecure cipher suites are still accepted.
+type TLSCheck struct{}
+
+// CertificateCheck verifies the certificate chain and hostname of the
+// target's HTTPS endpoint and reports certificates close to expiry.
+type CertificateCheck struct{}
+
+func init() {
+	register(TLSCheck{})
+	register(CertificateCheck{})
+}
+
+func (TLSCheck) ID() string {
+	return "https"
+}
+
+func (CertificateCheck) ID() string {
+	return "ssl-cert"
+}
+
+// TLSMetadata is stored in the result metadata of the https check.
+type TLSMetadata struct {
+	Address         string   `json:"address"`
+	Version         string   `json:"version,omitempty"`
+	CipherSuite     string   `json:"cipher_suite,omitempty"`
+	LegacyProtocols []string `json:"legacy_protocols"`
+	InsecureCiphers []string `json:"insecure_ciphers"`
+	Issues          []string `json:"issues"`
+}
+
+// CertificateMetadata is stored in the result metadata of the ssl-cert
+// check.
+type CertificateMetadata struct {
+	Address  string    `json:"address"`
+	Subject  string    `json:"subject,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	DNSNames []string  `json:"dns_names"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (TLSCheck) Version() int {
+	return 1
+}
+
+func (CertificateCheck) Version() int {
+	return 1
+}
+
+func (c TLSCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	snapshot, err := CaptureTLS(ctx, client, target, true)
+	if err != nil {
+		return inconclusive(Result{Name: c.ID()}, "%v", err)
+	}
+	return c.Evaluate(artifacts.Evidence{TLS: snapshot})
+}
+
+func (c TLSCheck) Evaluate(ev artifacts.Evidence) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+	s := ev.TLS
+	if s == nil {
+		return inconclusive(res, "No TLS handshake with the target was captured")
+	}
+	meta := TLSMetadata{Address: s.Address, Version: s.Version, CipherSuite: s.CipherSuite, LegacyProtocols: []string{}, InsecureCiphers: []string{}, Issues: []string{}}
+	if !s.Available {
+		res.ThreatLevel = ThreatHigh
+		res.Description = fmt.Sprintf("The target doesn't serve HTTPS on %s: %s", s.Address, s.Error)
+		meta.Issues = append(meta.Issues, "HTTPS is not available")
+		res.Metadata = meta
+		return res
+	}
+
+	if len(s.LegacyProtocols) > 0 {
+		meta.LegacyProtocols = s.LegacyProtocols
+		res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatHigh)
+		meta.Issues = append(meta.Issues, fmt.Sprintf("legacy protocols are accepted: %s", strings.Join(s.LegacyProtocols, ", ")))
+	}
+	if len(s.InsecureCiphers) > 0 {
+		meta.InsecureCiphers = s.InsecureCiphers
+		res.ThreatLevel = maxThreat(res.ThreatLevel, ThreatMedium)
+		meta.Issues = append(meta.Issues, fmt.Sprintf("insecure cipher suites are accepted: %s", strings.Join(s.InsecureCiphers, ", ")))
+	}
+
+	if len(meta.Issues) == 0 {
+		res.Description = fmt.Sprintf("HTTPS uses %s with %s, and legacy protocols and insecure cipher suites are refused.", meta.Version, meta.CipherSuite)
+	} else {
+		res.Description = strings.Join(meta.Issues, "; ") + "."
+	}
+	res.Metadata = meta
+	return res
+}
+
+func (c CertificateCheck) Run(ctx context.Context, client *http.Client, target string) Result {
+	snapshot, err := CaptureTLS(ctx, client, target, false)
+	if err != nil {
+		return inconclusive(Result{Name: c.ID()}, "%v", err)
+	}
+	return c.Evaluate(artifacts.Evidence{TLS: snapshot})
+}
+
+// Evaluate grades the certificate as of the time it was captured; the
+// chain is verified against the current trusted roots.
+func (c CertificateCheck) Evaluate(ev artifacts.Evidence) Result {
+	res := Result{Name: c.ID(), Certainty: 100, ThreatLevel: ThreatNone}
+	s := ev.TLS
+	if s == nil {
+		return inconclusive(res, "No TLS handshake with the target was captured")
+	}
+	if !s.Available {
+		return inconclusive(res, "Could not complete a TLS handshake with %s: %s", s.Address, s.Error)
+	}
+	if len(s.Certificates) == 0 {
+		return inconclusive(res, "%s presented no certificate", s.Address)
+	}
+	chain := make([]*x509.Certificate, len(s.Certificates))
+	for i, der := range s.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return inconclusive(res, "Certificate %d of %s can't be parsed: %v", i, s.Address, err)
+		}
+		chain[i] = cert
+	}
+
+	leaf := chain[0]
+	meta := CertificateMetadata{Address: s.Address, DNSNames: []string{}}
+	meta.Subject = leaf.Subject.String()
+	meta.Issuer = leaf.Issuer.String()
+	meta.NotAfter = leaf.NotAfter.UTC()
+	if leaf.DNSNames != nil {
+		meta.DNSNames = leaf.DNSNames
+	}
+	res.Metadata = meta
+
+	now := s.CapturedAt
+	if now.After(leaf.NotAfter) {
+		res.ThreatLevel = ThreatCritical
+		res.Description = fmt.Sprintf("The certificate expired on %s.", leaf.NotAfter.UTC().Format(time.DateOnly))
+		return res
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: s.ServerName, Intermediates: intermediates, CurrentTime: now}); err != nil {
+		meta.Error = err.Error()
+		res.Metadata = meta
+		res.ThreatLevel = ThreatHigh
+		res.Description = fmt.Sprintf("The certificate is not trusted for %s: %v.", s.ServerName, err)
+		return res
+	}
+
+	remaining := leaf.NotAfter.Sub(now)
+	switch {
+	case remaining < certExpiryUrgent:
+		res.ThreatLevel = ThreatMedium
+	case remaining < certExpiryWarning:
+		res.ThreatLevel = ThreatLow
+	}
+	if res.ThreatLevel != ThreatNone {
+		res.Description = fmt.Sprintf("The certificate expires in %d days, on %s.", int(remaining.Hours()/24), leaf.NotAfter.UTC().Format(time.DateOnly))
+	} else {
+		res.Description = fmt.Sprintf("The certificate is valid for %s until %s.", s.ServerName, leaf.NotAfter.UTC().Format(time.DateOnly))
+	}
+	return res
+}
+
+// CaptureTLS handshakes with the target's HTTPS endpoint and records the
+// negotiated parameters and certificate chain. With probe set, it also
+// tries the legacy protocols and insecure cipher suites. An endpoint
+// without HTTPS is recorded as unavailable; an error is only returned if
+// the endpoint couldn't be reached at all.
+func CaptureTLS(ctx context.Context, client *http.Client, target string, probe bool) (*artifacts.TLSSnapshot, error) {
+	host, addr, err := tlsAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	s := &artifacts.TLSSnapshot{
+		Address:         addr,
+		ServerName:      host,
+		CapturedAt:      time.Now().UTC(),
+		LegacyProtocols: []string{},
+		InsecureCiphers: []string{},
+		Certificates:    [][]byte{},
+	}
+
+	// The chain is verified when the snapshot is evaluated, so that the
+	// certificate is recorded even when it isn't trusted.
+	state, err := handshake(ctx, client, addr, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) || isHandshakeFailure(err) {
+			s.Error = err.Error()
+			return s, nil
+		}
+		return nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+	s.Available = true
+	s.Version = tls.VersionName(state.Version)
+	s.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	for _, cert := range state.PeerCertificates {
+		s.Certificates = append(s.Certificates, cert.Raw)
+	}
+	if !probe {
+		return s, nil
+	}
+
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11} {
+		probe := &tls.Config{ServerName: host, InsecureSkipVerify: true, MinVersion: version, MaxVersion: version}
+		if _, err := handshake(ctx, client, addr, probe); err == nil {
+			s.LegacyProtocols = append(s.LegacyProtocols, tls.VersionName(version))
+		}
+	}
+	// Cipher suites can only be chosen up to TLS 1.2; TLS 1.3 suites are
+	// all considered secure.
+	for _, suite := range tls.InsecureCipherSuites() {
+		probe := &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+			CipherSuites:       []uint16{suite.ID},
+		}
+		if _, err := handshake(ctx, client, addr, probe); err == nil {
+			s.InsecureCiphers = append(s.InsecureCiphers, suite.Name)
+		}
+	}
+	return s, nil
+}
+
+// tlsAddress returns the host name and the address of the HTTPS endpoint
+// of the target. Targets given as http:// URLs are checked on port 443.
+func tlsAddress(target string) (host, addr string, err error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid target URL %q", target)
+	}
+	port := "443"
+	if u.Scheme == "https" && u.Port() != "" {
+		port = u.Port()
+	}
+	return u.Hostname(), net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// handshake dials addr with the client's transport, so that its egress
+// policy applies, and completes a TLS handshake with cfg.
+func handshake(ctx context.Context, client *http.Client, addr string, cfg *tls.Config) (tls.ConnectionState, error) {
+	dial := (&net.Dialer{}).DialContext
+	if t, ok := client.Transport.(*http.Transport); ok && t.DialContext != nil {
+		dial = t.DialContext
+	}
+	if client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+
+	raw, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	conn := tls.Client(raw, cfg)
+	defer conn.Close()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return conn.ConnectionState(), nil
+}
+
+// isHandshakeFailure reports whether err shows that the endpoint doesn't
+// speak TLS, rather than that it couldn't be reached.
+func isHandshakeFailure(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var alert tls.AlertError
+	return errors.As(err, &recordErr) || errors.As(err, &alert)
+}
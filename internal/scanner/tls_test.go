@@ -0,0 +1,84 @@
+package scanner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+)
+
+func TestTLSCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  *artifacts.TLSSnapshot
+		want string
+	}{
+		{"not captured", nil, ThreatInfo},
+		{"no HTTPS", &artifacts.TLSSnapshot{Address: "example.com:443", Error: "connection refused"}, ThreatHigh},
+		{"modern", &artifacts.TLSSnapshot{Available: true, Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256"}, ThreatNone},
+		{"insecure ciphers", &artifacts.TLSSnapshot{Available: true, InsecureCiphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, ThreatMedium},
+		{"legacy protocols", &artifacts.TLSSnapshot{Available: true, LegacyProtocols: []string{"TLS 1.0"}, InsecureCiphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, ThreatHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := TLSCheck{}.Evaluate(artifacts.Evidence{TLS: tt.tls})
+			if res.ThreatLevel != tt.want {
+				t.Errorf("threat %s (%s), want %s", res.ThreatLevel, res.Description, tt.want)
+			}
+		})
+	}
+}
+
+// selfSigned returns a DER certificate for example.com valid until
+// notAfter.
+func selfSigned(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertificateCheck(t *testing.T) {
+	now := time.Now()
+	snapshot := func(certs ...[]byte) *artifacts.TLSSnapshot {
+		return &artifacts.TLSSnapshot{Address: "example.com:443", ServerName: "example.com", CapturedAt: now, Available: true, Certificates: certs}
+	}
+	tests := []struct {
+		name string
+		tls  *artifacts.TLSSnapshot
+		want string
+	}{
+		{"handshake failed", &artifacts.TLSSnapshot{Address: "example.com:443", Error: "handshake failure"}, ThreatInfo},
+		{"no certificate", snapshot(), ThreatInfo},
+		{"unparsable certificate", snapshot([]byte("not DER")), ThreatInfo},
+		{"expired", snapshot(selfSigned(t, now.Add(-time.Hour))), ThreatCritical},
+		{"untrusted", snapshot(selfSigned(t, now.Add(90*24*time.Hour))), ThreatHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := CertificateCheck{}.Evaluate(artifacts.Evidence{TLS: tt.tls})
+			if res.ThreatLevel != tt.want {
+				t.Errorf("threat %s (%s), want %s", res.ThreatLevel, res.Description, tt.want)
+			}
+		})
+	}
+}
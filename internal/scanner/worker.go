@@ -0,0 +1,312 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/artifacts"
+	"github.com/prawo-i-piesc/backend/internal/handlers"
+	"github.com/prawo-i-piesc/backend/internal/queue"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WorkerConfig configures a Worker.
+type WorkerConfig struct {
+	// APIURL is the base URL results are submitted to.
+	APIURL string
+	// SigningSecret signs submissions when the API requires it (see
+	// middleware.RequireSignature).
+	SigningSecret string
+	// Evidence, when set, returns the evidence captured for a scan,
+	// which is uploaded as artifacts before the end of the scan is
+	// submitted.
+	Evidence func(scanID string) artifacts.Evidence
+	// Results, when set, receives results on handlers.ResultsQueue
+	// instead of the results endpoint. Starts and heartbeats still go
+	// to the API.
+	Results Publisher
+}
+
+// Publisher publishes messages to RabbitMQ; *queue.Publisher implements it.
+type Publisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Engine runs one test of a scan against the target.
+type Engine func(ctx context.Context, scanID, target, test string) Result
+
+// Worker runs scan tasks from scan_queue with an Engine and submits the
+// results exactly like the external scanner: authorized with the task's
+// upload token, announcing the start of the scan and sending a heartbeat
+// before every test.
+type Worker struct {
+	cfg    WorkerConfig
+	engine Engine
+	client *http.Client
+}
+
+func NewWorker(cfg WorkerConfig, engine Engine) *Worker {
+	return &Worker{
+		cfg:    cfg,
+		engine: engine,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// CheckEngine runs the registered checks. Evaluators of a scan share the
+// evidence captured for it, which the worker uploads as artifacts so that
+// the scan can be evaluated again by later check versions.
+type CheckEngine struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	scans map[string]*scanEvidence
+}
+
+// scanEvidence is the evidence of one scan, captured when an evaluator
+// first needs it.
+type scanEvidence struct {
+	responsesOnce sync.Once
+	responses     []artifacts.HeaderSnapshot
+	responsesErr  error
+
+	tlsOnce sync.Once
+	tls     *artifacts.TLSSnapshot
+	tlsErr  error
+}
+
+func NewCheckEngine(client *http.Client) *CheckEngine {
+	return &CheckEngine{client: client, scans: map[string]*scanEvidence{}}
+}
+
+// Run runs one test; it is an Engine. Tests without a built-in check are
+// reported as inconclusive, so the scan still completes.
+func (e *CheckEngine) Run(ctx context.Context, scanID, target, test string) Result {
+	check, ok := Lookup(test)
+	if !ok {
+		return inconclusive(Result{Name: test}, "The %s test is not run by the built-in scanner.", test)
+	}
+	evaluator, ok := check.(Evaluator)
+	if !ok {
+		return check.Run(ctx, e.client, target)
+	}
+
+	e.mu.Lock()
+	s := e.scans[scanID]
+	if s == nil {
+		s = &scanEvidence{}
+		e.scans[scanID] = s
+	}
+	e.mu.Unlock()
+
+	switch evaluator.(type) {
+	case TLSCheck, CertificateCheck:
+		s.tlsOnce.Do(func() {
+			s.tls, s.tlsErr = CaptureTLS(ctx, e.client, target, true)
+		})
+		if s.tlsErr != nil {
+			return inconclusive(Result{Name: test}, "%v", s.tlsErr)
+		}
+		return evaluator.Evaluate(artifacts.Evidence{TLS: s.tls})
+	default:
+		s.responsesOnce.Do(func() {
+			s.responses, s.responsesErr = CaptureResponses(ctx, e.client, target)
+		})
+		if s.responsesErr != nil {
+			return inconclusive(Result{Name: test}, "Could not fetch target: %v", s.responsesErr)
+		}
+		return evaluator.Evaluate(artifacts.Evidence{Responses: s.responses})
+	}
+}
+
+// Evidence returns the evidence captured for a scan and forgets it.
+func (e *CheckEngine) Evidence(scanID string) artifacts.Evidence {
+	e.mu.Lock()
+	s := e.scans[scanID]
+	delete(e.scans, scanID)
+	e.mu.Unlock()
+
+	var ev artifacts.Evidence
+	if s != nil {
+		ev.Responses = s.responses
+		ev.TLS = s.tls
+	}
+	return ev
+}
+
+// Handle processes one scan task; it is a queue.Handler. Tasks that can't
+// be processed (malformed, unknown or cancelled scans) are discarded, other
+// failures requeue the task.
+func (w *Worker) Handle(ctx context.Context, d amqp.Delivery) error {
+	var task handlers.ScanTaskPayload
+	if err := json.Unmarshal(d.Body, &task); err != nil {
+		return fmt.Errorf("%w: decoding task: %v", queue.ErrDiscard, err)
+	}
+	scanID := parameter(task, "--taskId")
+	if len(scanID) != 1 {
+		return fmt.Errorf("%w: task has no --taskId", queue.ErrDiscard)
+	}
+	tests := parameter(task, "--tests")
+	slog.InfoContext(ctx, "Worker running scan", "scan_id", scanID[0], "tests", len(tests))
+
+	scanPath := "/api/scans/" + scanID[0]
+	if err := w.post(ctx, task, scanPath+"/start", "application/json", nil); err != nil {
+		return err
+	}
+	for _, test := range tests {
+		if err := w.post(ctx, task, scanPath+"/heartbeat", "application/json", nil); err != nil {
+			return err
+		}
+		result := w.engine(ctx, scanID[0], task.Target, test)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.submit(ctx, task, handlers.AsyncResultRequest{
+			Target: task.Target,
+			TestID: scanID[0],
+			Result: handlers.EngineTestResult{
+				Name:        result.Name,
+				Certainty:   result.Certainty,
+				ThreatLevel: result.ThreatLevel,
+				Metadata:    result.Metadata,
+				Description: result.Description,
+			},
+			ResultType: handlers.Success,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if w.cfg.Evidence != nil {
+		w.uploadEvidence(ctx, task, scanID[0], w.cfg.Evidence(scanID[0]))
+	}
+
+	// A result without a test name marks the end of the scan.
+	return w.submit(ctx, task, handlers.AsyncResultRequest{
+		Target:     task.Target,
+		TestID:     scanID[0],
+		EndFlag:    true,
+		ResultType: handlers.Success,
+	})
+}
+
+func parameter(task handlers.ScanTaskPayload, name string) []string {
+	for _, p := range task.Parameters {
+		if p.Name == name {
+			return p.Arguments
+		}
+	}
+	return nil
+}
+
+// submit sends one result to the API, or to handlers.ResultsQueue if
+// cfg.Results is set.
+func (w *Worker) submit(ctx context.Context, task handlers.ScanTaskPayload, result handlers.AsyncResultRequest) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("%w: encoding result: %v", queue.ErrDiscard, err)
+	}
+	if w.cfg.Results == nil {
+		return w.post(ctx, task, "/api/results", "application/json", body)
+	}
+
+	err = w.cfg.Results.PublishWithContext(ctx, "", handlers.ResultsQueue, false, false, amqp.Publishing{
+		Headers:      amqp.Table{handlers.UploadTokenHeader: task.UploadToken},
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "application/json",
+		Timestamp:    time.Now(),
+		Body:         body,
+	})
+	if err != nil {
+		return fmt.Errorf("publishing result: %w", err)
+	}
+	return nil
+}
+
+// uploadEvidence uploads the evidence of a scan as headers and tls
+// artifacts. The evidence is optional, so failures are only logged.
+func (w *Worker) uploadEvidence(ctx context.Context, task handlers.ScanTaskPayload, scanID string, ev artifacts.Evidence) {
+	uploads := map[string]interface{}{}
+	if len(ev.Responses) > 0 {
+		uploads[artifacts.KindHeaders] = ev.Responses
+	}
+	if ev.TLS != nil {
+		uploads[artifacts.KindTLS] = ev.TLS
+	}
+	for kind, content := range uploads {
+		data, err := json.Marshal(content)
+		if err == nil {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			_ = form.WriteField("scan_id", scanID)
+			_ = form.WriteField("kind", kind)
+			var file io.Writer
+			if file, err = form.CreateFormFile("file", kind+".json"); err == nil {
+				_, _ = file.Write(data)
+				if err = form.Close(); err == nil {
+					err = w.post(ctx, task, "/api/artifacts", form.FormDataContentType(), body.Bytes())
+				}
+			}
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to upload evidence", "scan_id", scanID, "kind", kind, "error", err)
+		}
+	}
+}
+
+// post sends a worker request for the task to the API. Client errors other
+// than 429 discard the task, e.g. once the scan has been cancelled.
+func (w *Worker) post(ctx context.Context, task handlers.ScanTaskPayload, path, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.APIURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", queue.ErrDiscard, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Upload-Token", task.UploadToken)
+	if w.cfg.SigningSecret != "" {
+		nonce, err := newNonce()
+		if err != nil {
+			return err
+		}
+		ts := time.Now().Unix()
+		req.Header.Set(workerauth.TimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(workerauth.NonceHeader, nonce)
+		req.Header.Set(workerauth.SignatureHeader, workerauth.Sign(w.cfg.SigningSecret, ts, nonce, http.MethodPost, path, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("%s returned %d: %s", path, resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", queue.ErrDiscard, err)
+	}
+	return err
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
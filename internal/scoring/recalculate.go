@@ -0,0 +1,117 @@
+package scoring
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// RecalculationBatchSize is the number of scans rescored per batch. Progress
+// is persisted on the job after every batch.
+const RecalculationBatchSize = 100
+
+// RunRecalculation rescores all completed scans in the job's scope with the
+// currently stored policies. It is meant to be started in its own goroutine
+// right after the job row has been created.
+func RunRecalculation(db *gorm.DB, jobID uuid.UUID, categories map[string]string) {
+	var job models.RecalculationJob
+	if err := db.First(&job, "id = ?", jobID).Error; err != nil {
+		slog.Error("Recalculation job not found", "job_id", jobID, "error", err)
+		return
+	}
+
+	now := time.Now()
+	job.Status = models.JobStatusRunning
+	job.StartedAt = &now
+	job.Total = countScans(db, job.UserID)
+	db.Save(&job)
+
+	var runErr error
+	if job.UserID == nil {
+		runErr = rescoreBatches(db, &job, &models.Scan{}, false, categories)
+	}
+	if runErr == nil {
+		runErr = rescoreBatches(db, &job, &models.PremiumScan{}, true, categories)
+	}
+
+	finished := time.Now()
+	job.CompletedAt = &finished
+	job.Status = models.JobStatusCompleted
+	if runErr != nil {
+		job.Status = models.JobStatusFailed
+		job.Error = runErr.Error()
+		slog.Error("Recalculation job failed", "job_id", job.ID, "error", runErr)
+	} else {
+		slog.Info("Recalculation job finished", "job_id", job.ID, "processed", job.Processed, "failed", job.Failed)
+	}
+	db.Save(&job)
+}
+
+func countScans(db *gorm.DB, userID *uuid.UUID) int64 {
+	var free, premium int64
+	if userID == nil {
+		db.Model(&models.Scan{}).Where("status = ?", "COMPLETED").Count(&free)
+	}
+	q := db.Model(&models.PremiumScan{}).Where("status = ?", "COMPLETED")
+	if userID != nil {
+		q = q.Where("user_id = ?", *userID)
+	}
+	q.Count(&premium)
+	return free + premium
+}
+
+// rescoreBatches walks the completed scans of one table in ID order (IDs
+// are UUIDv7, so this is also creation order) using keyset pagination.
+func rescoreBatches(db *gorm.DB, job *models.RecalculationJob, model interface{}, isPremium bool, categories map[string]string) error {
+	cursor := uuid.Nil
+	for {
+		var ids []uuid.UUID
+		q := db.Model(model).Where("status = ? AND id > ?", "COMPLETED", cursor)
+		if isPremium && job.UserID != nil {
+			q = q.Where("user_id = ?", *job.UserID)
+		}
+		if err := q.Order("id").Limit(RecalculationBatchSize).Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("loading batch after %s: %w", cursor, err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, id := range ids {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return ScoreScan(tx, id, isPremium, categories)
+			})
+			if err != nil {
+				slog.Error("Failed to rescore scan", "scan_id", id, "error", err)
+				job.Failed++
+			}
+			job.Processed++
+		}
+		cursor = ids[len(ids)-1]
+
+		if err := db.Model(job).Updates(map[string]interface{}{
+			"total":     job.Total,
+			"processed": job.Processed,
+			"failed":    job.Failed,
+		}).Error; err != nil {
+			return err
+		}
+	}
+}
+
+// FailInterruptedRecalculations marks jobs left pending or running by a
+// previous process as failed, so they don't block new recalculations.
+func FailInterruptedRecalculations(db *gorm.DB) error {
+	now := time.Now()
+	return db.Model(&models.RecalculationJob{}).
+		Where("status IN ?", []string{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":       models.JobStatusFailed,
+			"error":        "interrupted by server restart",
+			"completed_at": &now,
+		}).Error
+}
@@ -0,0 +1,251 @@
+// Package scoring computes security scores and letter grades for scans.
+//
+// The scoring model is Lighthouse-style: every test category starts at 100
+// points, failed tests subtract penalty points according to their severity,
+// and the overall score is the weighted average of the category scores.
+// All parameters come from a models.ScoringRules value, which is resolved
+// from the stored ScoringPolicy rows and snapshotted on every scored scan so
+// that historical scores remain reproducible.
+package scoring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// OtherCategory is used for results whose test is not part of any category.
+const OtherCategory = "Other"
+
+// DefaultRules returns the built-in scoring model used when no policy has
+// been stored in the database.
+func DefaultRules() models.ScoringRules {
+	return models.ScoringRules{
+		CategoryWeights: map[string]float64{},
+		SeverityMultipliers: map[string]float64{
+			"critical": 40,
+			"high":     25,
+			"medium":   10,
+			"low":      5,
+			"info":     0,
+			"none":     0,
+		},
+		GradeThresholds: []models.GradeThreshold{
+			{Grade: "A", MinScore: 90},
+			{Grade: "B", MinScore: 80},
+			{Grade: "C", MinScore: 70},
+			{Grade: "D", MinScore: 60},
+			{Grade: "F", MinScore: 0},
+		},
+	}
+}
+
+// Normalize lower-cases severity keys, fills in missing severities from the
+// defaults and sorts grade thresholds from the highest score down.
+func Normalize(r models.ScoringRules) models.ScoringRules {
+	defaults := DefaultRules()
+
+	out := models.ScoringRules{
+		CategoryWeights:     map[string]float64{},
+		SeverityMultipliers: map[string]float64{},
+		GradeThresholds:     append([]models.GradeThreshold(nil), r.GradeThresholds...),
+	}
+	for k, v := range r.CategoryWeights {
+		out.CategoryWeights[k] = v
+	}
+	for k, v := range defaults.SeverityMultipliers {
+		out.SeverityMultipliers[k] = v
+	}
+	for k, v := range r.SeverityMultipliers {
+		out.SeverityMultipliers[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	if len(out.GradeThresholds) == 0 {
+		out.GradeThresholds = defaults.GradeThresholds
+	}
+	sort.SliceStable(out.GradeThresholds, func(i, j int) bool {
+		return out.GradeThresholds[i].MinScore > out.GradeThresholds[j].MinScore
+	})
+	return out
+}
+
+// Validate checks that the rules can be used to compute a score.
+func Validate(r models.ScoringRules) error {
+	for k, v := range r.CategoryWeights {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("category weight for %q must be a non-negative number", k)
+		}
+	}
+	for k, v := range r.SeverityMultipliers {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("severity multiplier for %q must be a non-negative number", k)
+		}
+	}
+	if len(r.GradeThresholds) == 0 {
+		return errors.New("at least one grade threshold is required")
+	}
+	hasFloor := false
+	for _, t := range r.GradeThresholds {
+		if strings.TrimSpace(t.Grade) == "" {
+			return errors.New("grade thresholds must have a grade")
+		}
+		if t.MinScore < 0 || t.MinScore > 100 {
+			return fmt.Errorf("min_score for grade %q must be between 0 and 100", t.Grade)
+		}
+		if t.MinScore == 0 {
+			hasFloor = true
+		}
+	}
+	if !hasFloor {
+		return errors.New("one grade threshold must have min_score 0")
+	}
+	return nil
+}
+
+// Compute returns the score (0-100, one decimal place) and letter grade for
+// the given results. categories maps test names to category names.
+func Compute(r models.ScoringRules, results []models.ScanResult, categories map[string]string) (float64, string) {
+	r = Normalize(r)
+
+	present := map[string]bool{}
+	penalties := map[string]float64{}
+	for _, res := range results {
+		cat := categories[strings.ToLower(res.TestName)]
+		if cat == "" {
+			cat = OtherCategory
+		}
+		present[cat] = true
+		if !res.Passed {
+			penalties[cat] += r.SeverityMultipliers[strings.ToLower(res.Severity)]
+		}
+	}
+
+	var weighted, totalWeight float64
+	for cat := range present {
+		w, ok := r.CategoryWeights[cat]
+		if !ok {
+			w = 1
+		}
+		weighted += w * math.Max(0, 100-penalties[cat])
+		totalWeight += w
+	}
+
+	score := 100.0
+	if totalWeight > 0 {
+		score = math.Round(weighted/totalWeight*10) / 10
+	}
+	return score, Grade(r, score)
+}
+
+// Grade maps a score to a letter grade using the rules' thresholds.
+func Grade(r models.ScoringRules, score float64) string {
+	r = Normalize(r)
+	for _, t := range r.GradeThresholds {
+		if score >= t.MinScore {
+			return t.Grade
+		}
+	}
+	return r.GradeThresholds[len(r.GradeThresholds)-1].Grade
+}
+
+// PolicyOf scopes a query of scoring policies to the policy of an
+// organization, of a user, or with both nil to the platform default.
+func PolicyOf(db *gorm.DB, userID, orgID *uuid.UUID) *gorm.DB {
+	switch {
+	case orgID != nil:
+		return db.Where("organization_id = ?", *orgID)
+	case userID != nil:
+		return db.Where("user_id = ?", *userID)
+	}
+	return db.Where("user_id IS NULL AND organization_id IS NULL")
+}
+
+// ResolveRules returns the rules that apply to scans owned by userID and
+// shared with orgID: the organization's policy, then the user's own
+// policy, then the platform default policy, then the built-in defaults.
+// Nil IDs skip their policy.
+func ResolveRules(db *gorm.DB, userID, orgID *uuid.UUID) (models.ScoringRules, error) {
+	var candidates [][2]*uuid.UUID
+	if orgID != nil {
+		candidates = append(candidates, [2]*uuid.UUID{nil, orgID})
+	}
+	if userID != nil {
+		candidates = append(candidates, [2]*uuid.UUID{userID, nil})
+	}
+	candidates = append(candidates, [2]*uuid.UUID{nil, nil})
+
+	for _, owner := range candidates {
+		var policy models.ScoringPolicy
+		err := PolicyOf(db, owner[0], owner[1]).First(&policy).Error
+		if err == nil {
+			return Normalize(policy.Rules.Data()), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.ScoringRules{}, err
+		}
+	}
+	return Normalize(DefaultRules()), nil
+}
+
+// MigratePolicies keeps a single platform default policy. Postgres treats
+// NULLs as distinct, so the unique indexes on user_id and organization_id
+// don't cover the default; a partial unique index on a constant does.
+// Duplicate defaults stored before it existed are deleted, keeping the
+// most recently updated one.
+func MigratePolicies(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM scoring_policies
+			WHERE user_id IS NULL AND organization_id IS NULL AND id <> (
+				SELECT id FROM scoring_policies WHERE user_id IS NULL AND organization_id IS NULL
+				ORDER BY updated_at DESC, id DESC LIMIT 1)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_scoring_policies_default
+			ON scoring_policies ((true)) WHERE user_id IS NULL AND organization_id IS NULL`).Error
+	})
+}
+
+// ScoreScan computes the score and grade of a scan from its stored results
+// and persists them together with a snapshot of the rules that were used.
+func ScoreScan(tx *gorm.DB, scanID uuid.UUID, isPremium bool, categories map[string]string) error {
+	var owner, org *uuid.UUID
+	var model interface{} = &models.Scan{ID: scanID}
+
+	if isPremium {
+		var scan models.PremiumScan
+		if err := tx.Select("id", "user_id", "organization_id").First(&scan, "id = ?", scanID).Error; err != nil {
+			return err
+		}
+		owner, org = &scan.UserID, scan.OrganizationID
+		model = &models.PremiumScan{ID: scanID}
+	}
+
+	rules, err := ResolveRules(tx, owner, org)
+	if err != nil {
+		return err
+	}
+
+	var results []models.ScanResult
+	if err := tx.Where("scan_id = ?", scanID).Find(&results).Error; err != nil {
+		return err
+	}
+
+	score, grade := Compute(rules, results, categories)
+	snapshot, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(model).Updates(map[string]interface{}{
+		"score":          score,
+		"grade":          grade,
+		"scoring_policy": datatypes.JSON(snapshot),
+	}).Error
+}
@@ -0,0 +1,134 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+)
+
+func TestCompute(t *testing.T) {
+	categories := map[string]string{
+		"hsts":    "Transport",
+		"tls":     "Transport",
+		"cookies": "Session",
+	}
+	result := func(test, severity string, passed bool) models.ScanResult {
+		return models.ScanResult{TestName: test, Severity: severity, Passed: passed}
+	}
+
+	tests := []struct {
+		name      string
+		rules     models.ScoringRules
+		results   []models.ScanResult
+		wantScore float64
+		wantGrade string
+	}{
+		{
+			name:      "no results",
+			rules:     DefaultRules(),
+			wantScore: 100,
+			wantGrade: "A",
+		},
+		{
+			name:      "all passed",
+			rules:     DefaultRules(),
+			results:   []models.ScanResult{result("HSTS", "high", true), result("cookies", "low", true)},
+			wantScore: 100,
+			wantGrade: "A",
+		},
+		{
+			name:      "penalties are averaged over categories",
+			rules:     DefaultRules(),
+			results:   []models.ScanResult{result("HSTS", "high", false), result("cookies", "low", true)},
+			wantScore: 87.5,
+			wantGrade: "B",
+		},
+		{
+			name:      "a category doesn't go below zero",
+			rules:     DefaultRules(),
+			results:   []models.ScanResult{result("hsts", "critical", false), result("tls", "critical", false), result("tls", "high", false)},
+			wantScore: 0,
+			wantGrade: "F",
+		},
+		{
+			name:      "unknown tests count as other",
+			rules:     DefaultRules(),
+			results:   []models.ScanResult{result("hsts", "info", false), result("new-check", "medium", false)},
+			wantScore: 95,
+			wantGrade: "A",
+		},
+		{
+			name: "category weights",
+			rules: models.ScoringRules{
+				CategoryWeights: map[string]float64{"Transport": 3},
+			},
+			results:   []models.ScanResult{result("hsts", "medium", false), result("cookies", "critical", false)},
+			wantScore: 82.5,
+			wantGrade: "B",
+		},
+		{
+			name: "custom multipliers and thresholds",
+			rules: models.ScoringRules{
+				SeverityMultipliers: map[string]float64{" High ": 50},
+				GradeThresholds:     []models.GradeThreshold{{Grade: "fail", MinScore: 0}, {Grade: "pass", MinScore: 50}},
+			},
+			results:   []models.ScanResult{result("hsts", "HIGH", false)},
+			wantScore: 50,
+			wantGrade: "pass",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, grade := Compute(tt.rules, tt.results, categories)
+			if score != tt.wantScore || grade != tt.wantGrade {
+				t.Errorf("Compute() = %v, %q; want %v, %q", score, grade, tt.wantScore, tt.wantGrade)
+			}
+		})
+	}
+}
+
+func TestGrade(t *testing.T) {
+	rules := DefaultRules()
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{100, "A"},
+		{90, "A"},
+		{89.9, "B"},
+		{70, "C"},
+		{60, "D"},
+		{59.9, "F"},
+		{0, "F"},
+	}
+	for _, tt := range tests {
+		if got := Grade(rules, tt.score); got != tt.want {
+			t.Errorf("Grade(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	floor := []models.GradeThreshold{{Grade: "F", MinScore: 0}}
+	tests := []struct {
+		name    string
+		rules   models.ScoringRules
+		wantErr bool
+	}{
+		{"defaults", DefaultRules(), false},
+		{"floor only", models.ScoringRules{GradeThresholds: floor}, false},
+		{"negative weight", models.ScoringRules{CategoryWeights: map[string]float64{"Transport": -1}, GradeThresholds: floor}, true},
+		{"negative multiplier", models.ScoringRules{SeverityMultipliers: map[string]float64{"high": -5}, GradeThresholds: floor}, true},
+		{"no thresholds", models.ScoringRules{}, true},
+		{"threshold without grade", models.ScoringRules{GradeThresholds: []models.GradeThreshold{{MinScore: 0}}}, true},
+		{"threshold above 100", models.ScoringRules{GradeThresholds: append([]models.GradeThreshold{{Grade: "A+", MinScore: 101}}, floor...)}, true},
+		{"no floor", models.ScoringRules{GradeThresholds: []models.GradeThreshold{{Grade: "A", MinScore: 90}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
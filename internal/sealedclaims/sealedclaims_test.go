@@ -0,0 +1,96 @@
+package sealedclaims
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestParseKey(t *testing.T) {
+	raw := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"standard padded", base64.StdEncoding.EncodeToString(raw), false},
+		{"standard unpadded", base64.RawStdEncoding.EncodeToString(raw), false},
+		{"URL alphabet", base64.RawURLEncoding.EncodeToString(append(raw[:30:30], 0xff, 0xff)), false},
+		{"surrounding space", " " + testKey + "\n", false},
+		{"not base64", "not a key!", true},
+		{"too short", base64.StdEncoding.EncodeToString(raw[:16]), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(key) != KeySize {
+				t.Errorf("len(key) = %d, want %d", len(key), KeySize)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := ParseKey(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ParseKey(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", KeySize))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := key.Seal("user-1", map[string]interface{}{"role": "admin"})
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if strings.Contains(sealed, "admin") {
+		t.Errorf("sealed claims %q reveal the role", sealed)
+	}
+	claims, err := key.Open("user-1", sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if claims["role"] != "admin" {
+		t.Errorf("opened claims = %v, want role admin", claims)
+	}
+
+	again, err := key.Seal("user-1", map[string]interface{}{"role": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("sealing the same claims twice gave the same blob")
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		key     Key
+		subject string
+		sealed  string
+	}{
+		{"tampered", key, "user-1", tampered},
+		{"other subject", key, "user-2", sealed},
+		{"other key", otherKey, "user-1", sealed},
+		{"not base64", key, "user-1", "***"},
+		{"shorter than a nonce", key, "user-1", "AAAA"},
+		{"empty", key, "user-1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.key.Open(tt.subject, tt.sealed); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Open() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
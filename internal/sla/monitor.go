@@ -0,0 +1,149 @@
+package sla
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/webhooks"
+	"gorm.io/gorm"
+)
+
+// checkInterval is how often findings are checked for SLA breaches.
+const checkInterval = 5 * time.Minute
+
+// breachBatchSize bounds the breaches reported per policy in one check.
+const breachBatchSize = 500
+
+// Monitor periodically looks for findings past their SLA deadline and
+// reports each of them once as a finding.sla_breached event.
+type Monitor struct {
+	db       *gorm.DB
+	webhooks *webhooks.Dispatcher
+}
+
+func NewMonitor(db *gorm.DB, dispatcher *webhooks.Dispatcher) *Monitor {
+	return &Monitor{
+		db:       db,
+		webhooks: dispatcher,
+	}
+}
+
+// Run checks for breaches until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(ctx, "SLA check failed", "error", err)
+			}
+		}
+	}
+}
+
+// breach is a finding that went past its SLA deadline.
+type breach struct {
+	models.ScanResult
+	TargetURL string
+	OwnerID   uuid.UUID
+}
+
+// Check reports the findings that have breached their SLA since the last
+// check. Only findings of the latest completed scan of each target are
+// considered; older scans are superseded. Scans shared with an
+// organization that has a period for a severity follow it instead of
+// their owner's.
+func (m *Monitor) Check(ctx context.Context) error {
+	var policies []models.SLAPolicy
+	if err := m.db.Find(&policies).Error; err != nil {
+		return err
+	}
+	var orgPolicies []models.OrganizationSLAPolicy
+	if err := m.db.Find(&orgPolicies).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, p := range policies {
+		scans := func(db *gorm.DB) *gorm.DB {
+			return db.Where("premium_scans.user_id = ?", p.UserID).
+				Where("NOT EXISTS (SELECT 1 FROM organization_sla_policies org WHERE org.organization_id = premium_scans.organization_id AND org.severity = ?)", p.Severity)
+		}
+		if err := m.checkPolicy(ctx, scans, p.Severity, p.Days, now); err != nil {
+			return err
+		}
+	}
+	for _, p := range orgPolicies {
+		scans := func(db *gorm.DB) *gorm.DB {
+			return db.Where("premium_scans.organization_id = ?", p.OrganizationID)
+		}
+		if err := m.checkPolicy(ctx, scans, p.Severity, p.Days, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPolicy reports the breaches of one period among the scans selected
+// by the scans scope.
+func (m *Monitor) checkPolicy(ctx context.Context, scans func(*gorm.DB) *gorm.DB, severity string, days int, now time.Time) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+	var breaches []breach
+	if err := m.db.Model(&models.ScanResult{}).
+		Select("scan_results.*, premium_scans.target_url, premium_scans.user_id AS owner_id").
+		Joins("JOIN premium_scans ON premium_scans.id = scan_results.scan_id").
+		Scopes(scans).
+		Where("premium_scans.status = ?", "COMPLETED").
+		Where("NOT EXISTS (SELECT 1 FROM premium_scans newer WHERE newer.user_id = premium_scans.user_id AND newer.target_url = premium_scans.target_url AND newer.status = ? AND newer.completed_at > premium_scans.completed_at AND newer.deleted_at IS NULL)", "COMPLETED").
+		Where("NOT scan_results.passed AND scan_results.triage_status NOT IN ?", []string{models.TriageSuppressed, models.TriageVerified}).
+		Where("LOWER(scan_results.severity) = ?", severity).
+		Where("scan_results.first_seen_at < ? AND scan_results.sla_breached_at IS NULL", cutoff).
+		Limit(breachBatchSize).
+		Scan(&breaches).Error; err != nil {
+		return err
+	}
+
+	for _, b := range breaches {
+		// Claim the breach so it is reported once, even with several
+		// server instances checking.
+		claim := m.db.Model(&models.ScanResult{}).
+			Where("id = ? AND sla_breached_at IS NULL", b.ID).
+			Update("sla_breached_at", now)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		m.report(b.OwnerID, days, b)
+	}
+	return nil
+}
+
+func (m *Monitor) report(userID uuid.UUID, days int, b breach) {
+	slog.Warn("Finding breached its SLA", "finding_id", b.ID, "test_name", b.TestName, "target_url", b.TargetURL, "sla_days", days)
+	m.webhooks.Emit(userID, webhooks.EventFindingSLABreached, webhooks.Finding{TestName: b.TestName, Data: map[string]interface{}{
+		"finding_id":    b.ID,
+		"scan_id":       b.ScanID,
+		"target_url":    b.TargetURL,
+		"test_name":     b.TestName,
+		"severity":      b.Severity,
+		"triage_status": b.TriageStatus,
+		"assignee_id":   b.AssigneeID,
+		"first_seen_at": b.FirstSeenAt,
+		"due_at":        b.FirstSeenAt.Add(time.Duration(days) * 24 * time.Hour),
+		"sla_days":      days,
+	}})
+}
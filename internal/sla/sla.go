@@ -0,0 +1,178 @@
+// Package sla tracks how long failed findings stay unresolved and reports
+// findings that exceed the remediation deadline configured for their
+// severity.
+package sla
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SLA states of a finding.
+const (
+	StatusOnTrack  = "on_track"
+	StatusAtRisk   = "at_risk"
+	StatusBreached = "breached"
+)
+
+// atRiskShare is the share of the SLA period after which a finding is
+// reported as at risk.
+const atRiskShare = 0.8
+
+// Severities lists the severities an SLA can be defined for.
+var Severities = []string{"critical", "high", "medium", "low"}
+
+// Finding is the SLA state of a single finding.
+type Finding struct {
+	Days    int       `json:"days"`
+	DueAt   time.Time `json:"due_at"`
+	AgeDays int       `json:"age_days"`
+	Status  string    `json:"status"`
+}
+
+// Policies returns the SLA periods in days by lowercase severity of the
+// findings of a scan owned by userID and shared with orgID: the
+// organization's periods, and the owner's for severities the organization
+// has none for. A nil orgID returns the owner's periods.
+func Policies(db *gorm.DB, userID uuid.UUID, orgID *uuid.UUID) (map[string]int, error) {
+	var policies []models.SLAPolicy
+	if err := db.Where("user_id = ?", userID).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	days := make(map[string]int, len(policies))
+	for _, p := range policies {
+		days[p.Severity] = p.Days
+	}
+	if orgID == nil {
+		return days, nil
+	}
+
+	var orgPolicies []models.OrganizationSLAPolicy
+	if err := db.Where("organization_id = ?", *orgID).Find(&orgPolicies).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range orgPolicies {
+		days[p.Severity] = p.Days
+	}
+	return days, nil
+}
+
+// PoliciesByScan returns the Policies of the findings of each premium
+// scan, loading those of every owner and organization once.
+func PoliciesByScan(db *gorm.DB, scanIDs []uuid.UUID) (map[uuid.UUID]map[string]int, error) {
+	var scans []models.PremiumScan
+	if err := db.Select("id", "user_id", "organization_id").Where("id IN ?", scanIDs).Find(&scans).Error; err != nil {
+		return nil, err
+	}
+
+	type owner struct {
+		user, org uuid.UUID
+	}
+	loaded := map[owner]map[string]int{}
+	byScan := make(map[uuid.UUID]map[string]int, len(scans))
+	for _, scan := range scans {
+		key := owner{user: scan.UserID}
+		if scan.OrganizationID != nil {
+			key.org = *scan.OrganizationID
+		}
+		days, ok := loaded[key]
+		if !ok {
+			var err error
+			if days, err = Policies(db, scan.UserID, scan.OrganizationID); err != nil {
+				return nil, err
+			}
+			loaded[key] = days
+		}
+		byScan[scan.ID] = days
+	}
+	return byScan, nil
+}
+
+// Evaluate returns the SLA state of a finding, or nil when no SLA applies:
+// the finding passed, was suppressed, was verified as fixed, predates SLA
+// tracking or has a severity without a policy.
+func Evaluate(r models.ScanResult, policies map[string]int, now time.Time) *Finding {
+	if r.Passed || r.TriageStatus == models.TriageSuppressed || r.TriageStatus == models.TriageVerified || r.FirstSeenAt == nil {
+		return nil
+	}
+	days, ok := policies[strings.ToLower(r.Severity)]
+	if !ok {
+		return nil
+	}
+
+	period := time.Duration(days) * 24 * time.Hour
+	age := now.Sub(*r.FirstSeenAt)
+	f := &Finding{
+		Days:    days,
+		DueAt:   r.FirstSeenAt.Add(period),
+		AgeDays: int(age.Hours() / 24),
+		Status:  StatusOnTrack,
+	}
+	switch {
+	case age > period:
+		f.Status = StatusBreached
+	case float64(age) >= atRiskShare*float64(period):
+		f.Status = StatusAtRisk
+	}
+	return f
+}
+
+// TrackFindings stamps FirstSeenAt on the failed findings of a completed
+// premium scan. A test that also failed in the previous scan of the same
+// target keeps the first-seen time (and breach report) of that finding, so
+// re-scanning doesn't reset the SLA clock.
+func TrackFindings(tx *gorm.DB, scanID uuid.UUID) error {
+	var scan models.PremiumScan
+	if err := tx.Select("id", "user_id", "target_url", "completed_at").First(&scan, "id = ?", scanID).Error; err != nil {
+		return err
+	}
+	seenAt := time.Now()
+	if scan.CompletedAt != nil {
+		seenAt = *scan.CompletedAt
+	}
+
+	carried := map[string]models.ScanResult{}
+	var previous models.PremiumScan
+	err := tx.Select("id").
+		Where("user_id = ? AND target_url = ? AND status = ? AND id <> ?", scan.UserID, scan.TargetURL, "COMPLETED", scan.ID).
+		Where("completed_at <= ?", seenAt).
+		Order("completed_at desc").First(&previous).Error
+	switch {
+	case err == nil:
+		var earlier []models.ScanResult
+		if err := tx.Select("test_name", "first_seen_at", "sla_breached_at").
+			Where("scan_id = ? AND NOT passed", previous.ID).Find(&earlier).Error; err != nil {
+			return err
+		}
+		for _, r := range earlier {
+			carried[strings.ToLower(r.TestName)] = r
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	var failed []models.ScanResult
+	if err := tx.Select("id", "test_name").Where("scan_id = ? AND NOT passed", scanID).Find(&failed).Error; err != nil {
+		return err
+	}
+	for _, r := range failed {
+		firstSeen := seenAt
+		var breachedAt *time.Time
+		if prev, ok := carried[strings.ToLower(r.TestName)]; ok && prev.FirstSeenAt != nil {
+			firstSeen = *prev.FirstSeenAt
+			breachedAt = prev.SLABreachedAt
+		}
+		if err := tx.Model(&models.ScanResult{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+			"first_seen_at":   firstSeen,
+			"sla_breached_at": breachedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
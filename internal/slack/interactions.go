@@ -0,0 +1,153 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Action IDs of the buttons of scan summaries, handled by the app's
+// interactivity endpoint.
+const (
+	// ActionAcknowledge acknowledges the finding whose ID is the value.
+	ActionAcknowledge = "acknowledge_finding"
+	// ActionCreateTicket requests a ticket for the finding whose ID is the
+	// value.
+	ActionCreateTicket = "create_ticket"
+	// ActionRescan scans the target of the scan whose ID is the value
+	// again.
+	ActionRescan = "rescan"
+)
+
+// responseURLHost is the host of the response URLs Slack sends with
+// interactions; replies are only posted there.
+const responseURLHost = "hooks.slack.com"
+
+// Block is a Block Kit layout block.
+type Block map[string]interface{}
+
+// Section is a section block of mrkdwn text.
+func Section(text string) Block {
+	return Block{"type": "section", "text": mrkdwn(text)}
+}
+
+// Context is a context block of small mrkdwn text.
+func Context(text string) Block {
+	return Block{"type": "context", "elements": []interface{}{mrkdwn(text)}}
+}
+
+// Actions is an actions block of buttons.
+func Actions(buttons ...map[string]interface{}) Block {
+	elements := make([]interface{}, len(buttons))
+	for i, b := range buttons {
+		elements[i] = b
+	}
+	return Block{"type": "actions", "elements": elements}
+}
+
+// Button is a button sending an interaction with the action ID and value.
+// style is "", "primary" or "danger".
+func Button(actionID, text, value, style string) map[string]interface{} {
+	button := map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]interface{}{"type": "plain_text", "text": text},
+		"value":     value,
+	}
+	if style != "" {
+		button["style"] = style
+	}
+	return button
+}
+
+// LinkButton is a button opening a URL.
+func LinkButton(actionID, text, link string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]interface{}{"type": "plain_text", "text": text},
+		"url":       link,
+	}
+}
+
+func mrkdwn(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": text}
+}
+
+// Interaction is the payload of a click on a button of a message, a
+// block_actions interaction.
+type Interaction struct {
+	Type string `json:"type"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	ResponseURL string   `json:"response_url"`
+	Actions     []Action `json:"actions"`
+}
+
+// Action is a clicked button.
+type Action struct {
+	ActionID string `json:"action_id"`
+	Value    string `json:"value"`
+}
+
+// ParseInteraction parses the "payload" field of an interaction request.
+func ParseInteraction(payload string) (Interaction, error) {
+	var interaction Interaction
+	if err := json.Unmarshal([]byte(payload), &interaction); err != nil {
+		return interaction, err
+	}
+	return interaction, nil
+}
+
+// ErrInvalidResponseURL is returned for response URLs not hosted by Slack.
+var ErrInvalidResponseURL = errors.New("invalid Slack response URL")
+
+// Respond posts a reply to an interaction to its response URL, to the
+// channel if inChannel is set and only to the user who clicked otherwise.
+// The message the interaction came from is left as it is.
+func (c *Client) Respond(ctx context.Context, responseURL, text string, inChannel bool) error {
+	u, err := url.Parse(responseURL)
+	if err != nil || u.Scheme != "https" || u.Host != responseURLHost {
+		return ErrInvalidResponseURL
+	}
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"response_type":    responseType,
+		"replace_original": false,
+		"text":             text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MaxAttempts is how often posting a summary is tried before giving up.
+const MaxAttempts = 8
+
+const (
+	pollInterval = 15 * time.Second
+	batchSize    = 20
+	// topFindings is how many findings a summary lists.
+	topFindings = 5
+	// maxMessageLength bounds a finding's message in a summary, in runes.
+	maxMessageLength = 150
+)
+
+// finishedStatuses are the statuses of scans whose summary is posted.
+var finishedStatuses = []string{"COMPLETED", "FAILED", "CANCELLED", "REJECTED"}
+
+// Notifier posts the summaries of finished scans started from Slack.
+// Summaries are posted by a polling loop, so none is lost to a restart,
+// and retried with backoff while Slack can't be reached.
+type Notifier struct {
+	db     *gorm.DB
+	client *Client
+	// frontendLink builds the links to the scans in the frontend.
+	frontendLink func(path string) string
+}
+
+// NewNotifier returns a notifier posting with client. A nil client
+// disables it.
+func NewNotifier(db *gorm.DB, client *Client, frontendLink func(path string) string) *Notifier {
+	return &Notifier{db: db, client: client, frontendLink: frontendLink}
+}
+
+// Run posts summaries every few seconds until ctx is cancelled. It returns
+// at once when the notifier is disabled.
+func (n *Notifier) Run(ctx context.Context) {
+	if n.client == nil {
+		return
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.NotifyDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(ctx, "Failed to post Slack scan summaries", "error", err)
+			}
+		}
+	}
+}
+
+// NotifyDue posts the summaries of finished scans that are due.
+func (n *Notifier) NotifyDue(ctx context.Context) error {
+	var notifications []models.SlackNotification
+	err := n.db.WithContext(ctx).
+		Joins("JOIN premium_scans ON premium_scans.id = slack_notifications.scan_id AND premium_scans.deleted_at IS NULL").
+		Where("slack_notifications.posted_at IS NULL AND slack_notifications.attempts < ? AND slack_notifications.next_attempt_at <= ?", MaxAttempts, time.Now()).
+		Where("premium_scans.status IN ?", finishedStatuses).
+		Order("slack_notifications.next_attempt_at").Limit(batchSize).
+		Find(&notifications).Error
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		postErr := n.post(ctx, notification)
+		updates := map[string]interface{}{
+			"attempts":        notification.Attempts + 1,
+			"last_error":      "",
+			"next_attempt_at": time.Now().Add(backoff(notification.Attempts + 1)),
+		}
+		if postErr != nil {
+			updates["last_error"] = postErr.Error()
+			slog.WarnContext(ctx, "Failed to post scan summary to Slack", "scan_id", notification.ScanID, "channel", notification.ChannelID, "attempt", notification.Attempts+1, "error", postErr)
+		} else {
+			updates["posted_at"] = time.Now()
+		}
+		if err := n.db.WithContext(ctx).Model(&notification).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the delay after the attempt-th failed attempt: a minute,
+// doubling up to an hour.
+func backoff(attempt int) time.Duration {
+	return min(time.Minute<<min(attempt-1, 6), time.Hour)
+}
+
+func (n *Notifier) post(ctx context.Context, notification models.SlackNotification) error {
+	var scan models.PremiumScan
+	if err := n.db.WithContext(ctx).First(&scan, "id = ?", notification.ScanID).Error; err != nil {
+		return err
+	}
+	var findings []models.ScanResult
+	if err := n.db.WithContext(ctx).
+		Where("scan_id = ? AND NOT passed AND triage_status <> ?", scan.ID, models.TriageSuppressed).
+		Order("severity_rank DESC, test_name").
+		Find(&findings).Error; err != nil {
+		return err
+	}
+	// Channels are shared, so confidential findings are counted but not
+	// listed.
+	outbound, err := classification.For(n.db.WithContext(ctx), scan.UserID, classification.ChannelSlack, false)
+	if err != nil {
+		return err
+	}
+	listed := outbound.Results(findings)
+	link := n.frontendLink("/scans/" + scan.ID.String())
+	text := Summary(scan, findings, listed, notification.SlackUserID, link)
+	return n.client.PostMessage(ctx, notification.ChannelID, text, SummaryBlocks(scan, findings, listed, notification.SlackUserID, link))
+}
+
+// Summary renders the result of a finished scan, requested by a Slack
+// user, as mrkdwn. findings are its failed, unsuppressed results ordered
+// by severity, and listed those of them that may be named.
+func Summary(scan models.PremiumScan, findings, listed []models.ScanResult, slackUserID, link string) string {
+	var b strings.Builder
+	b.WriteString(summaryHeader(scan, findings, slackUserID) + "\n")
+	if scan.Status == "COMPLETED" {
+		for _, f := range listed[:min(len(listed), topFindings)] {
+			b.WriteString(findingLine(f) + "\n")
+		}
+		if more := unlisted(findings, listed); more != "" {
+			b.WriteString(more + "\n")
+		}
+	}
+	fmt.Fprintf(&b, "<%s|Full results>", link)
+	return b.String()
+}
+
+// SummaryBlocks lays Summary out as blocks, with buttons acknowledging
+// each listed finding or requesting a ticket for it, and a button scanning
+// the target again.
+func SummaryBlocks(scan models.PremiumScan, findings, listed []models.ScanResult, slackUserID, link string) []Block {
+	blocks := []Block{Section(summaryHeader(scan, findings, slackUserID))}
+	if scan.Status == "COMPLETED" {
+		for _, f := range listed[:min(len(listed), topFindings)] {
+			id := strconv.FormatUint(uint64(f.ID), 10)
+			buttons := []map[string]interface{}{}
+			if f.TriageStatus == models.TriageOpen {
+				buttons = append(buttons, Button(ActionAcknowledge, "Acknowledge", id, "primary"))
+			}
+			buttons = append(buttons, Button(ActionCreateTicket, "Create ticket", id, ""))
+			blocks = append(blocks, Section(findingLine(f)), Actions(buttons...))
+		}
+		if more := unlisted(findings, listed); more != "" {
+			blocks = append(blocks, Context(more))
+		}
+	}
+	return append(blocks, Actions(
+		Button(ActionRescan, "Re-scan", scan.ID.String(), ""),
+		LinkButton("open_results", "Full results", link),
+	))
+}
+
+// summaryHeader is the status of the scan and, once it completed, its
+// grade and failed tests.
+func summaryHeader(scan models.PremiumScan, findings []models.ScanResult, slackUserID string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Scan of %s* for <@%s>: ", Escape(scan.TargetURL), slackUserID)
+	switch scan.Status {
+	case "COMPLETED":
+		b.WriteString("completed")
+	case "FAILED":
+		b.WriteString("failed to run")
+	case "REJECTED":
+		b.WriteString("rejected by an approver")
+	default:
+		b.WriteString("cancelled")
+	}
+
+	if scan.Status == "COMPLETED" {
+		b.WriteString("\n")
+		if scan.Grade != "" && scan.Score != nil {
+			fmt.Fprintf(&b, "Grade *%s* (score %.1f), ", scan.Grade, *scan.Score)
+		}
+		fmt.Fprintf(&b, "%d failed %s", len(findings), plural(len(findings), "test"))
+		if counts := severityCounts(findings); counts != "" {
+			b.WriteString(": " + counts)
+		}
+	}
+	return b.String()
+}
+
+// unlisted tells how many findings the summary leaves out: those beyond
+// the top ones, and the confidential ones.
+func unlisted(findings, listed []models.ScanResult) string {
+	var parts []string
+	if len(listed) > topFindings {
+		parts = append(parts, fmt.Sprintf("…and %d more.", len(listed)-topFindings))
+	}
+	if withheld := len(findings) - len(listed); withheld > 0 {
+		parts = append(parts, fmt.Sprintf("%d confidential %s not listed.", withheld, plural(withheld, "finding")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// findingLine is a finding as a list item.
+func findingLine(f models.ScanResult) string {
+	return fmt.Sprintf("• *%s* %s: %s", Escape(strings.ToLower(f.Severity)), Escape(f.TestName), Escape(shorten(f.Message)))
+}
+
+// severityCounts lists how many findings there are of each severity, most
+// severe first, e.g. "1 high, 2 low".
+func severityCounts(findings []models.ScanResult) string {
+	var parts []string
+	for i := 0; i < len(findings); {
+		j := i
+		for j < len(findings) && findings[j].SeverityRank == findings[i].SeverityRank {
+			j++
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", j-i, strings.ToLower(findings[i].Severity)))
+		i = j
+	}
+	return strings.Join(parts, ", ")
+}
+
+// shorten puts text on one line of at most maxMessageLength runes.
+func shorten(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxMessageLength {
+		text = string(runes[:maxMessageLength]) + "…"
+	}
+	return text
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
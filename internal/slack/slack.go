@@ -0,0 +1,138 @@
+// Package slack backs the /antiginx slash command of the Slack app: it
+// verifies that command requests were signed by Slack, and posts the
+// summaries of the scans started with the command to their channels once
+// they finish (see Notifier). The buttons of the summaries triage the
+// findings from Slack (see Interaction).
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the Web API of Slack.
+const DefaultAPIURL = "https://slack.com/api"
+
+// MaxRequestAge is how old the timestamp of a signed request may be, so
+// that captured requests can't be replayed later.
+const MaxRequestAge = 5 * time.Minute
+
+const userAgent = "AntiGinx-Slack/1.0"
+
+// maxResponseBody bounds the response bodies read from the API.
+const maxResponseBody = 1 << 20
+
+// ErrInvalidSignature is returned for requests not signed by Slack.
+var ErrInvalidSignature = errors.New("invalid Slack request signature")
+
+// Verify checks the X-Slack-Signature of a request from Slack: an
+// HMAC-SHA256 of "v0:<timestamp>:<body>" keyed with the app's signing
+// secret, whose timestamp (X-Slack-Request-Timestamp) must be recent.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > MaxRequestAge || age < -MaxRequestAge {
+		return ErrInvalidSignature
+	}
+	sig, ok := strings.CutPrefix(signature, "v0=")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// APIError is an error reported by the Web API, such as "not_in_channel".
+type APIError struct {
+	StatusCode int
+	Code       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack API responded with %d: %s", e.StatusCode, e.Code)
+}
+
+// Client calls the Web API as the app's bot user.
+type Client struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// NewClient returns a client authenticating with the bot token.
+func NewClient(apiURL, token string, client *http.Client) *Client {
+	return &Client{apiURL: strings.TrimRight(apiURL, "/"), token: token, client: client}
+}
+
+// PostMessage posts text, in Slack's mrkdwn format, to a channel. With
+// blocks, the message is laid out as blocks and text is only shown in
+// notifications.
+func (c *Client) PostMessage(ctx context.Context, channel, text string, blocks []Block) error {
+	message := map[string]interface{}{
+		"channel":      channel,
+		"text":         text,
+		"unfurl_links": false,
+	}
+	if len(blocks) > 0 {
+		message["blocks"] = blocks
+	}
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/chat.postMessage", bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	// The Web API answers most errors with 200 and "ok": false.
+	var body struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(raw, &body)
+	if resp.StatusCode != http.StatusOK || !body.OK {
+		return &APIError{StatusCode: resp.StatusCode, Code: body.Error}
+	}
+	return nil
+}
+
+// Escape escapes the characters Slack's mrkdwn treats as control
+// characters.
+func Escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,49 @@
+// Package storage stores generated files (exports, reports, artifacts) and
+// hands out time-limited signed URLs for downloading them, so large files
+// don't have to be streamed through authenticated API requests.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no object exists under the key.
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey is returned for keys that are empty or try to escape the
+// storage namespace.
+var ErrInvalidKey = errors.New("invalid object key")
+
+// Store is implemented by every storage driver.
+type Store interface {
+	// Put stores the content under key, replacing any existing object.
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	// Get opens the object for reading. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that allows downloading the object without
+	// further authentication until the given time-to-live elapses.
+	SignedURL(ctx context.Context, key string, ttl time.Duration, filename string) (string, error)
+}
+
+// DefaultURLTTL is the lifetime of signed URLs handed out by the API.
+const DefaultURLTTL = 15 * time.Minute
+
+// ValidateKey checks that a key is a relative slash-separated path without
+// empty, "." or ".." segments.
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package targets verifies that users control the hosts they scan.
+//
+// A user claims a host (shop.example.com) or a whole domain
+// (*.example.com) and proves control of it by publishing a DNS TXT record
+//
+//	_antiginx-verification.example.com  TXT  "antiginx-verification=<token>"
+//
+// on the claimed domain. A single host can instead be verified by serving
+// the same value at
+//
+//	https://shop.example.com/.well-known/antiginx-verification.txt
+//
+// A verified wildcard target covers the domain itself and every subdomain
+// at any depth, so large estates don't need per-host verification. Since a
+// web server only speaks for its own host, wildcards need the DNS record.
+package targets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// RecordPrefix is prepended to a domain to form the name of its
+// verification record.
+const RecordPrefix = "_antiginx-verification."
+
+// valuePrefix starts the value of a verification record.
+const valuePrefix = "antiginx-verification="
+
+// WellKnownPath is the path of the verification file of a host.
+const WellKnownPath = "/.well-known/antiginx-verification.txt"
+
+// Verification methods.
+const (
+	MethodDNS  = "dns"
+	MethodFile = "file"
+)
+
+// lookupTimeout bounds one DNS lookup or file download.
+const lookupTimeout = 10 * time.Second
+
+// maxFileSize bounds the part of a verification file that is read.
+const maxFileSize = 1024
+
+var (
+	ErrInvalidHost  = errors.New("host must be a host name such as shop.example.com or *.example.com")
+	ErrNotVerified  = errors.New("verification record not found")
+	ErrWildcardFile = errors.New("wildcard targets can only be verified with a DNS record")
+)
+
+// Normalize lowercases a claimed host and checks that it is a host name or
+// a wildcard of a domain with at least two labels ("*.com" is refused).
+func Normalize(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	wildcard := strings.HasPrefix(host, "*.")
+	bare := strings.TrimPrefix(host, "*.")
+	if bare == "" || strings.ContainsAny(bare, "/:*@ ") {
+		return "", ErrInvalidHost
+	}
+	if u, err := url.Parse("//" + bare); err != nil || u.Hostname() != bare {
+		return "", ErrInvalidHost
+	}
+	if wildcard && !strings.Contains(bare, ".") {
+		return "", ErrInvalidHost
+	}
+	return host, nil
+}
+
+// Host returns the lowercase host of a target URL, which may be given
+// without a scheme.
+func Host(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		u, err = url.Parse("//" + target)
+		if err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// Domain returns the domain a target is verified on: the host itself, or
+// the domain of a wildcard.
+func Domain(host string) string {
+	return strings.TrimPrefix(host, "*.")
+}
+
+// Covers reports whether a claimed host authorizes scanning host.
+func Covers(claimed, host string) bool {
+	if domain, ok := strings.CutPrefix(claimed, "*."); ok {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return claimed == host
+}
+
+// candidates lists the claims that could cover host, most specific first:
+// the host itself, its own wildcard and the wildcards of its parents.
+func candidates(host string) []string {
+	list := []string{host, "*." + host}
+	for rest := host; strings.Contains(rest, "."); {
+		rest = rest[strings.Index(rest, ".")+1:]
+		if strings.Contains(rest, ".") {
+			list = append(list, "*."+rest)
+		}
+	}
+	return list
+}
+
+// FindOwning returns the user's most specific verified target covering
+// the host of targetURL, or gorm.ErrRecordNotFound if there is none.
+func FindOwning(db *gorm.DB, userID uuid.UUID, targetURL string) (*models.Target, error) {
+	host := Host(targetURL)
+	if host == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	list := candidates(host)
+
+	var found []models.Target
+	err := db.Where("user_id = ? AND host IN ? AND verified_at IS NOT NULL", userID, list).Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, claim := range list {
+		for i := range found {
+			if found[i].Host == claim {
+				return &found[i], nil
+			}
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// NewToken returns a random verification token.
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RecordName is the name of the TXT record that verifies host.
+func RecordName(host string) string {
+	return RecordPrefix + Domain(host)
+}
+
+// RecordValue is the value of the TXT record that verifies a target.
+func RecordValue(token string) string {
+	return valuePrefix + token
+}
+
+// FileURL is the URL of the verification file of host, or "" for a
+// wildcard.
+func FileURL(host string) string {
+	if strings.HasPrefix(host, "*.") {
+		return ""
+	}
+	return "https://" + host + WellKnownPath
+}
+
+// Verifier checks verification records and files.
+type Verifier struct {
+	// LookupTXT resolves TXT records; it defaults to the system resolver.
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+	// Client downloads verification files. Redirects aren't followed, so
+	// the file has to be served by the host itself.
+	Client *http.Client
+}
+
+// NewVerifier returns a verifier that downloads files with client, which
+// should enforce the egress policy (see httpclient).
+func NewVerifier(client *http.Client) *Verifier {
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Verifier{LookupTXT: net.DefaultResolver.LookupTXT, Client: &noRedirects}
+}
+
+// Verify looks up the target's verification record. It returns
+// ErrNotVerified if the record is missing or holds another token.
+func (v *Verifier) Verify(ctx context.Context, target models.Target) error {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	records, err := v.LookupTXT(ctx, RecordName(target.Host))
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrNotVerified
+	}
+	if err != nil {
+		return err
+	}
+	want := RecordValue(target.Token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == want {
+			return nil
+		}
+	}
+	return ErrNotVerified
+}
+
+// VerifyFile downloads the target's verification file. It returns
+// ErrNotVerified if the file is missing or holds another token, and
+// ErrWildcardFile for a wildcard target.
+func (v *Verifier) VerifyFile(ctx context.Context, target models.Target) error {
+	fileURL := FileURL(target.Host)
+	if fileURL == "" {
+		return ErrWildcardFile
+	}
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrNotVerified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize))
+	if err != nil {
+		return err
+	}
+	want := RecordValue(target.Token)
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(line) == want {
+			return nil
+		}
+	}
+	return ErrNotVerified
+}
@@ -0,0 +1,186 @@
+// Package usage tracks the requests made with API keys. Counters are kept
+// in memory and periodically added to the daily models.APIUsage rows, so
+// tracking costs no database write per request. The same counters enforce
+// per-key rate limits.
+//
+// Rate limit windows live in memory, so each server instance enforces a
+// key's limit separately.
+package usage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FlushInterval is how often recorded usage is written to the database.
+const FlushInterval = 30 * time.Second
+
+// rateWindow is the length of a rate limit window.
+const rateWindow = time.Minute
+
+type usageKey struct {
+	day      time.Time
+	apiKeyID uuid.UUID
+	method   string
+	route    string
+}
+
+type counter struct {
+	requests, errors, totalLatencyMs, maxLatencyMs int64
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Tracker collects API key usage.
+type Tracker struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	pending map[usageKey]*counter
+	windows map[uuid.UUID]*window
+}
+
+func NewTracker(db *gorm.DB) *Tracker {
+	return &Tracker{
+		db:      db,
+		pending: map[usageKey]*counter{},
+		windows: map[uuid.UUID]*window{},
+	}
+}
+
+// Record counts a request made with an API key. Responses with a status of
+// 400 or more count as errors.
+func (t *Tracker) Record(apiKeyID uuid.UUID, method, route string, status int, latency time.Duration) {
+	now := time.Now().UTC()
+	k := usageKey{
+		day:      time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		apiKeyID: apiKeyID,
+		method:   method,
+		route:    route,
+	}
+	ms := latency.Milliseconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.pending[k]
+	if c == nil {
+		c = &counter{}
+		t.pending[k] = c
+	}
+	c.requests++
+	if status >= 400 {
+		c.errors++
+	}
+	c.totalLatencyMs += ms
+	c.maxLatencyMs = max(c.maxLatencyMs, ms)
+}
+
+// Allow counts a request against the key's per-minute limit and reports
+// whether it may proceed; if not, retryAfter is the time until the current
+// window ends. A limit of 0 or less allows everything.
+func (t *Tracker) Allow(apiKeyID uuid.UUID, limit int) (ok bool, retryAfter time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := t.windows[apiKeyID]
+	if w == nil || now.Sub(w.start) >= rateWindow {
+		w = &window{start: now.Truncate(rateWindow)}
+		t.windows[apiKeyID] = w
+	}
+	if w.count >= limit {
+		return false, w.start.Add(rateWindow).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// Run flushes recorded usage every FlushInterval until ctx is cancelled.
+// Callers should Flush once more after the last request has been served.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				slog.ErrorContext(ctx, "Failed to flush API usage", "error", err)
+			}
+		}
+	}
+}
+
+// Flush adds the usage recorded since the last flush to the database.
+// Counters that could not be written are kept for the next flush.
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = map[usageKey]*counter{}
+	now := time.Now()
+	for id, w := range t.windows {
+		if now.Sub(w.start) >= rateWindow {
+			delete(t.windows, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for k, c := range pending {
+		row := models.APIUsage{
+			Day:            k.day,
+			APIKeyID:       k.apiKeyID,
+			Method:         k.method,
+			Route:          k.route,
+			Requests:       c.requests,
+			Errors:         c.errors,
+			TotalLatencyMs: c.totalLatencyMs,
+			MaxLatencyMs:   c.maxLatencyMs,
+		}
+		err := t.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "day"}, {Name: "api_key_id"}, {Name: "method"}, {Name: "route"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"requests":         gorm.Expr("api_usages.requests + excluded.requests"),
+				"errors":           gorm.Expr("api_usages.errors + excluded.errors"),
+				"total_latency_ms": gorm.Expr("api_usages.total_latency_ms + excluded.total_latency_ms"),
+				"max_latency_ms":   gorm.Expr("GREATEST(api_usages.max_latency_ms, excluded.max_latency_ms)"),
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			t.restore(pending)
+			return err
+		}
+		delete(pending, k)
+	}
+	return nil
+}
+
+// restore merges counters that failed to flush back into the pending set.
+func (t *Tracker) restore(failed map[usageKey]*counter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, c := range failed {
+		p := t.pending[k]
+		if p == nil {
+			t.pending[k] = c
+			continue
+		}
+		p.requests += c.requests
+		p.errors += c.errors
+		p.totalLatencyMs += c.totalLatencyMs
+		p.maxLatencyMs = max(p.maxLatencyMs, c.maxLatencyMs)
+	}
+}
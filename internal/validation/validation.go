@@ -0,0 +1,154 @@
+// Package validation turns request binding errors into field-level errors
+// a frontend can attach to its form fields, with messages in the reader's
+// language.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/pl"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	pl_translations "github.com/go-playground/validator/v10/translations/pl"
+)
+
+// DefaultLanguage is used when none of the requested languages has
+// messages.
+const DefaultLanguage = "en"
+
+// RuleType is the rule of a field whose JSON value has the wrong type.
+const RuleType = "type"
+
+// FieldError is a rule a field of the request failed. Field is the path of
+// the field in the JSON body, such as "scans[0].url".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// typeMessages are the messages of RuleType errors by language; the verbs
+// are the field and the expected JSON type.
+var typeMessages = map[string]string{
+	"en": "%s must be of type %s",
+	"pl": "%s musi być typu %s",
+}
+
+var translators *ut.UniversalTranslator
+
+// Setup makes the binding validator report fields by their JSON names and
+// registers the messages of every language.
+func Setup() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("binding validator is not go-playground/validator")
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return f.Name
+		}
+		return name
+	})
+
+	uni := ut.New(en.New(), en.New(), pl.New())
+	register := map[string]func(*validator.Validate, ut.Translator) error{
+		"en": en_translations.RegisterDefaultTranslations,
+		"pl": pl_translations.RegisterDefaultTranslations,
+	}
+	for lang, fn := range register {
+		trans, _ := uni.GetTranslator(lang)
+		if err := fn(v, trans); err != nil {
+			return err
+		}
+	}
+	translators = uni
+	return nil
+}
+
+// Fields returns the field errors of a binding error in the first of langs
+// that has messages, or nil if err isn't about particular fields (such as
+// malformed JSON).
+func Fields(err error, langs []string) []FieldError {
+	lang, trans := translator(langs)
+
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make([]FieldError, len(verrs))
+		for i, fe := range verrs {
+			message := fe.Error()
+			if trans != nil {
+				message = fe.Translate(trans)
+			}
+			fields[i] = FieldError{Field: fieldPath(fe.Namespace()), Rule: fe.Tag(), Message: message}
+		}
+		return fields
+	}
+
+	var terr *json.UnmarshalTypeError
+	if errors.As(err, &terr) && terr.Field != "" {
+		return []FieldError{{
+			Field:   terr.Field,
+			Rule:    RuleType,
+			Message: fmt.Sprintf(typeMessages[lang], terr.Field, jsonType(terr.Type)),
+		}}
+	}
+	return nil
+}
+
+// jsonType names the JSON type a value of t is decoded from.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return t.String()
+}
+
+func translator(langs []string) (string, ut.Translator) {
+	if translators == nil {
+		return DefaultLanguage, nil
+	}
+	for _, lang := range langs {
+		if _, ok := typeMessages[lang]; !ok {
+			continue
+		}
+		if trans, found := translators.GetTranslator(lang); found {
+			return lang, trans
+		}
+	}
+	trans, _ := translators.GetTranslator(DefaultLanguage)
+	return DefaultLanguage, trans
+}
+
+// fieldPath drops the request struct's name from a validator namespace
+// ("CreateScanRequest.scans[0].url" -> "scans[0].url").
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
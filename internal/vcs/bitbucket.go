@@ -0,0 +1,49 @@
+package vcs
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// bitbucketStatusKey identifies the build status of the scans on a
+	// commit, so that a new status replaces the earlier one.
+	bitbucketStatusKey = "antiginx-security-scan"
+	// bitbucketDescriptionLength bounds the description of a build status.
+	bitbucketDescriptionLength = 255
+)
+
+// bitbucketStates are the build status states of the conclusions.
+var bitbucketStates = map[string]string{
+	ConclusionSuccess:   "SUCCESSFUL",
+	ConclusionFailure:   "FAILED",
+	ConclusionCancelled: "STOPPED",
+	ConclusionNeutral:   "STOPPED",
+}
+
+// bitbucket sets build statuses and comments on pull requests through the
+// Bitbucket Cloud REST API (2.0). Build statuses have no numeric ID.
+type bitbucket struct {
+	*api
+}
+
+func (b *bitbucket) SetStatus(ctx context.Context, repo string, st Status) (int64, error) {
+	body := map[string]string{
+		"key":         bitbucketStatusKey,
+		"state":       bitbucketStates[st.Conclusion],
+		"name":        st.Name,
+		"description": truncate(st.Title, bitbucketDescriptionLength),
+		"url":         st.DetailsURL,
+	}
+	return 0, b.do(ctx, http.MethodPost, "/2.0/repositories/"+repo+"/commit/"+st.SHA+"/statuses/build", body, nil)
+}
+
+func (b *bitbucket) Comment(ctx context.Context, repo string, number int, body string) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	path := "/2.0/repositories/" + repo + "/pullrequests/" + strconv.Itoa(number) + "/comments"
+	err := b.do(ctx, http.MethodPost, path, map[string]interface{}{"content": map[string]string{"raw": body}}, &created)
+	return created.ID, err
+}
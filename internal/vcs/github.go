@@ -0,0 +1,39 @@
+package vcs
+
+import (
+	"context"
+
+	"github.com/prawo-i-piesc/backend/internal/github"
+)
+
+// gitHubConclusions are the check run conclusions of the conclusions.
+var gitHubConclusions = map[string]string{
+	ConclusionSuccess:   github.ConclusionSuccess,
+	ConclusionFailure:   github.ConclusionFailure,
+	ConclusionCancelled: github.ConclusionCancelled,
+	ConclusionNeutral:   github.ConclusionNeutral,
+}
+
+// GitHub returns a client reporting as app with check runs.
+func GitHub(app *github.App) Client {
+	return gitHub{app}
+}
+
+type gitHub struct {
+	app *github.App
+}
+
+func (g gitHub) SetStatus(ctx context.Context, repo string, st Status) (int64, error) {
+	return g.app.CreateCheckRun(ctx, repo, github.CheckRun{
+		Name:       st.Name,
+		HeadSHA:    st.SHA,
+		Conclusion: gitHubConclusions[st.Conclusion],
+		DetailsURL: st.DetailsURL,
+		Title:      st.Title,
+		Summary:    st.Summary,
+	})
+}
+
+func (g gitHub) Comment(ctx context.Context, repo string, number int, body string) (int64, error) {
+	return g.app.CreateComment(ctx, repo, number, body)
+}
@@ -0,0 +1,56 @@
+package vcs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// gitLabDescriptionLength bounds the description of a commit status.
+const gitLabDescriptionLength = 255
+
+// gitLabStates are the commit status states of the conclusions; GitLab
+// has no neutral state.
+var gitLabStates = map[string]string{
+	ConclusionSuccess:   "success",
+	ConclusionFailure:   "failed",
+	ConclusionCancelled: "canceled",
+	ConclusionNeutral:   "canceled",
+}
+
+// gitLab sets commit statuses and comments on merge requests through the
+// REST API (v4).
+type gitLab struct {
+	*api
+}
+
+func (g *gitLab) SetStatus(ctx context.Context, repo string, st Status) (int64, error) {
+	body := map[string]string{
+		"state":       gitLabStates[st.Conclusion],
+		"name":        st.Name,
+		"description": truncate(st.Title, gitLabDescriptionLength),
+	}
+	if st.DetailsURL != "" {
+		body["target_url"] = st.DetailsURL
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := g.do(ctx, http.MethodPost, g.project(repo)+"/statuses/"+st.SHA, body, &created)
+	return created.ID, err
+}
+
+func (g *gitLab) Comment(ctx context.Context, repo string, number int, body string) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	path := g.project(repo) + "/merge_requests/" + strconv.Itoa(number) + "/notes"
+	err := g.do(ctx, http.MethodPost, path, map[string]string{"body": body}, &created)
+	return created.ID, err
+}
+
+// project is the API path of a project, addressed by its URL-encoded path.
+func (g *gitLab) project(repo string) string {
+	return "/api/v4/projects/" + url.PathEscape(repo)
+}
@@ -0,0 +1,41 @@
+package vcs
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/sealedclaims"
+)
+
+// tokenClaim holds the token in its sealed blob.
+const tokenClaim = "token"
+
+// SealToken encrypts the access token of an integration for storage. The
+// blob is bound to the integration's ID, so it can't be moved to another
+// integration.
+func SealToken(key sealedclaims.Key, integrationID uuid.UUID, token string) (string, error) {
+	if key == nil {
+		return "", errors.New("no token encryption key is configured")
+	}
+	return key.Seal(tokenSubject(integrationID), map[string]interface{}{tokenClaim: token})
+}
+
+// OpenToken decrypts the access token of an integration.
+func OpenToken(key sealedclaims.Key, integrationID uuid.UUID, sealed string) (string, error) {
+	if key == nil {
+		return "", errors.New("no token encryption key is configured")
+	}
+	claims, err := key.Open(tokenSubject(integrationID), sealed)
+	if err != nil {
+		return "", err
+	}
+	token, ok := claims[tokenClaim].(string)
+	if !ok {
+		return "", sealedclaims.ErrInvalid
+	}
+	return token, nil
+}
+
+func tokenSubject(integrationID uuid.UUID) string {
+	return "vcs-integration:" + integrationID.String()
+}
@@ -0,0 +1,174 @@
+// Package vcs reports scans to the hosts of the repositories CI pipelines
+// run for: GitHub through the GitHub App of package github, and GitLab and
+// Bitbucket Cloud through the access tokens of an organization's
+// integrations. Each host attaches a result to a commit its own way (a
+// check run, a commit status, a build status) and comments on pull or
+// merge requests; Client hides the differences.
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Providers.
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+)
+
+// Conclusions of a status.
+const (
+	ConclusionSuccess   = "success"
+	ConclusionFailure   = "failure"
+	ConclusionCancelled = "cancelled"
+	ConclusionNeutral   = "neutral"
+)
+
+// DefaultBaseURLs are the hosts of integrations that don't set one;
+// self-managed GitLab has its own.
+var DefaultBaseURLs = map[string]string{
+	ProviderGitLab:    "https://gitlab.com",
+	ProviderBitbucket: "https://api.bitbucket.org",
+}
+
+// repositories match the repository names of each provider: "owner/name"
+// on GitHub, "workspace/slug" on Bitbucket and a project path, possibly in
+// subgroups, on GitLab.
+var repositories = map[string]*regexp.Regexp{
+	ProviderGitHub:    regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})/[A-Za-z0-9._-]{1,100}$`),
+	ProviderGitLab:    regexp.MustCompile(`^[A-Za-z0-9_.-]+(?:/[A-Za-z0-9_.-]+)+$`),
+	ProviderBitbucket: regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`),
+}
+
+const userAgent = "AntiGinx-VCS/1.0"
+
+// maxResponseBody bounds the response bodies read from the APIs.
+const maxResponseBody = 1 << 20
+
+// Status is the result of a scan attached to a commit.
+type Status struct {
+	Name       string
+	SHA        string
+	Conclusion string
+	// Title is a one-line description; Summary the full report in
+	// Markdown, shown by the hosts that have room for it.
+	Title      string
+	Summary    string
+	DetailsURL string
+}
+
+// Client reports to the repositories of one host.
+type Client interface {
+	// SetStatus attaches st to its commit of repo and returns the ID the
+	// host gave it, 0 if it gives none.
+	SetStatus(ctx context.Context, repo string, st Status) (int64, error)
+	// Comment comments on pull request number of repo and returns the
+	// comment's ID.
+	Comment(ctx context.Context, repo string, number int, body string) (int64, error)
+}
+
+// ValidRepository reports whether repo names a repository of provider.
+func ValidRepository(provider, repo string) bool {
+	pattern, ok := repositories[provider]
+	return ok && len(repo) <= 200 && pattern.MatchString(repo)
+}
+
+// New returns a client of a GitLab or Bitbucket integration authenticating
+// with token; an empty baseURL is the provider's default.
+func New(provider, baseURL, token string, client *http.Client) (Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURLs[provider]
+	}
+	api := &api{baseURL: strings.TrimRight(baseURL, "/"), token: token, client: client}
+	switch provider {
+	case ProviderGitLab:
+		return &gitLab{api}, nil
+	case ProviderBitbucket:
+		return &bitbucket{api}, nil
+	}
+	return nil, fmt.Errorf("unsupported provider %q", provider)
+}
+
+// APIError is a response of a host with an unexpected status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// api calls a JSON API with a bearer token.
+type api struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func (a *api) do(ctx context.Context, method, path string, body, out interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Message: errorMessage(raw)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// errorMessage picks the message out of an error response of GitLab
+// ({"message": ...}) or Bitbucket ({"error": {"message": ...}}).
+func errorMessage(raw []byte) string {
+	var body struct {
+		Message interface{} `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(raw, &body)
+	if body.Error.Message != "" {
+		return body.Error.Message
+	}
+	if body.Message != nil {
+		return fmt.Sprint(body.Message)
+	}
+	return ""
+}
+
+// truncate shortens text to at most n runes.
+func truncate(text string, n int) string {
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
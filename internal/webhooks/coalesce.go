@@ -0,0 +1,118 @@
+package webhooks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxDigestData bounds the event data a digest keeps; Count still counts
+// every event.
+const maxDigestData = 500
+
+// Digest is the data of several events of one type, coalesced by a
+// Coalescer into a single notification.
+type Digest struct {
+	Event string
+	// Count is the number of events, which may exceed len(Data).
+	Count int
+	// Data is the data of the events, oldest first.
+	Data []interface{}
+}
+
+type coalesceKey struct {
+	userID uuid.UUID
+	event  string
+}
+
+// coalesceWindow collects the events of a user and type until its timer
+// fires.
+type coalesceWindow struct {
+	digest Digest
+	timer  *time.Timer
+}
+
+// Coalescer batches the rapid-fire events of a notifier, such as the SLA
+// breaches of hundreds of findings of one scan, into one notification per
+// user and event type and time window, so that users aren't flooded with
+// alerts. The first event of a user and type opens a window; when it
+// closes, a lone event is passed on as is and several events as a Digest.
+// Events are delayed by up to the window.
+type Coalescer struct {
+	notifier Notifier
+	window   time.Duration
+
+	mu      sync.Mutex
+	pending map[coalesceKey]*coalesceWindow
+}
+
+// NewCoalescer returns a coalescer in front of n. A zero window passes
+// every event on at once.
+func NewCoalescer(n Notifier, window time.Duration) *Coalescer {
+	return &Coalescer{notifier: n, window: window, pending: map[coalesceKey]*coalesceWindow{}}
+}
+
+// Notify adds the event to the window of its user and type. It implements
+// Notifier.
+func (c *Coalescer) Notify(ctx context.Context, userID uuid.UUID, event string, data interface{}) {
+	if c.window <= 0 {
+		c.notifier.Notify(ctx, userID, event, data)
+		return
+	}
+
+	key := coalesceKey{userID: userID, event: event}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, open := c.pending[key]
+	if !open {
+		w = &coalesceWindow{digest: Digest{Event: event}}
+		window := w
+		w.timer = time.AfterFunc(c.window, func() { c.flush(key, window) })
+		c.pending[key] = w
+	}
+	w.digest.Count++
+	if len(w.digest.Data) < maxDigestData {
+		w.digest.Data = append(w.digest.Data, data)
+	}
+}
+
+// Flush closes every open window at once, e.g. on shutdown, and notifies
+// of their events.
+func (c *Coalescer) Flush() {
+	c.mu.Lock()
+	windows := c.pending
+	c.pending = map[coalesceKey]*coalesceWindow{}
+	c.mu.Unlock()
+
+	for key, w := range windows {
+		w.timer.Stop()
+		c.notify(key, w.digest)
+	}
+}
+
+// flush closes a window of a user and type when its timer fires and
+// notifies of its events, unless Flush closed it first.
+func (c *Coalescer) flush(key coalesceKey, w *coalesceWindow) {
+	c.mu.Lock()
+	open := c.pending[key] == w
+	if open {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+
+	if open {
+		c.notify(key, w.digest)
+	}
+}
+
+func (c *Coalescer) notify(key coalesceKey, digest Digest) {
+	ctx, cancel := context.WithTimeout(context.Background(), emitTimeout)
+	defer cancel()
+	if digest.Count == 1 {
+		c.notifier.Notify(ctx, key.userID, key.event, digest.Data[0])
+		return
+	}
+	c.notifier.Notify(ctx, key.userID, key.event, digest)
+}
@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Retry policy of failed deliveries. The delay doubles with every attempt,
+// starting at retryBaseDelay and capped at retryMaxDelay; with the defaults
+// the last attempt is made about 4 hours after the first.
+const (
+	MaxAttempts    = 10
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 4 * time.Hour
+)
+
+// retryPollInterval is how often due retries are looked up.
+const retryPollInterval = 15 * time.Second
+
+// retryBatchSize bounds the retries made in one poll.
+const retryBatchSize = 100
+
+// RetryDelay returns the delay before the retry following the given
+// attempt, with up to 10% of random jitter so that deliveries that failed
+// together don't all retry at the same moment.
+func RetryDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 20 {
+		delay = min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	}
+	return delay + rand.N(delay/10+1)
+}
+
+// retryable reports whether a failed attempt may succeed when repeated.
+// Network errors (status 0), server errors, timeouts and rate limiting are
+// retried; other client errors are not.
+func retryable(statusCode int) bool {
+	switch {
+	case statusCode == 0, statusCode >= 500:
+		return true
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// RunRetries repeats failed deliveries once their retry is due, until ctx
+// is cancelled.
+func (d *Dispatcher) RunRetries(ctx context.Context) {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.retryDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(ctx, "Failed to retry webhook deliveries", "error", err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) retryDue(ctx context.Context) error {
+	var due []models.WebhookDelivery
+	if err := d.db.Where("next_retry_at <= ?", time.Now()).
+		Order("next_retry_at").Limit(retryBatchSize).Find(&due).Error; err != nil {
+		return err
+	}
+
+	for _, previous := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Claim the retry so that it is made only once, even with several
+		// server instances polling.
+		claim := d.db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND next_retry_at IS NOT NULL", previous.ID).
+			Update("next_retry_at", nil)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		var hook models.Webhook
+		if err := d.db.First(&hook, "id = ?", previous.WebhookID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		if !hook.Active {
+			continue
+		}
+
+		if _, err := d.attempt(ctx, hook, previous.Event, previous.Payload, &previous.ID, previous.Attempt+1); err != nil {
+			slog.ErrorContext(ctx, "Failed to record retry of delivery", "delivery_id", previous.ID, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package webhooks delivers scan events to user-registered webhook URLs and
+// keeps a log of every delivery attempt.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/classification"
+	"github.com/prawo-i-piesc/backend/internal/httpclient"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// maxResponseBody is how much of the receiver's response is read before the
+// connection is released.
+const maxResponseBody = 64 << 10
+
+// emitTimeout bounds the background delivery of one event to all webhooks.
+const emitTimeout = 2 * time.Minute
+
+// Headers sent with every delivery.
+const (
+	EventHeader     = "X-AntiGinx-Event"
+	DeliveryHeader  = "X-AntiGinx-Delivery"
+	SignatureHeader = "X-AntiGinx-Signature"
+	KeyIDHeader     = "X-AntiGinx-Key-Id"
+)
+
+// Event is the JSON body of every webhook request.
+type Event struct {
+	ID        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Finding is event data describing a finding of one test. Findings of
+// tests the user classified as confidential are only delivered to webhooks
+// that allow confidential data.
+type Finding struct {
+	TestName string
+	Data     interface{}
+}
+
+func (f Finding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Data)
+}
+
+// Notifier is another channel events are published to, such as push
+// notifications. It handles its own failures.
+type Notifier interface {
+	Notify(ctx context.Context, userID uuid.UUID, event string, data interface{})
+}
+
+// Dispatcher sends webhook requests and records each attempt.
+type Dispatcher struct {
+	db        *gorm.DB
+	client    *httpclient.Client
+	notifiers []Notifier
+}
+
+func NewDispatcher(db *gorm.DB, client *httpclient.Client) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		client: client,
+	}
+}
+
+// AddNotifier publishes every event to n as well. It must be called before
+// the dispatcher is used.
+func (d *Dispatcher) AddNotifier(n Notifier) {
+	d.notifiers = append(d.notifiers, n)
+}
+
+// Deliver makes a single delivery attempt of the payload to the webhook and
+// stores it in the delivery log. The returned error is only non-nil when
+// the attempt could not be recorded; a failed delivery is reported through
+// the delivery's Success field and retried later (see RunRetries).
+func (d *Dispatcher) Deliver(ctx context.Context, hook models.Webhook, event string, payload []byte, redeliveryOf *uuid.UUID) (models.WebhookDelivery, error) {
+	return d.attempt(ctx, hook, event, payload, redeliveryOf, 1)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, hook models.Webhook, event string, payload []byte, redeliveryOf *uuid.UUID, attempt int) (models.WebhookDelivery, error) {
+	deliveryID, err := uuid.NewV7()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	sum := sha256.Sum256(payload)
+	delivery := models.WebhookDelivery{
+		ID:           deliveryID,
+		WebhookID:    hook.ID,
+		Event:        event,
+		Payload:      datatypes.JSON(payload),
+		PayloadHash:  hex.EncodeToString(sum[:]),
+		Attempt:      attempt,
+		RedeliveryOf: redeliveryOf,
+		CreatedAt:    time.Now(),
+	}
+
+	start := time.Now()
+	statusCode, sendErr := d.send(ctx, hook, delivery)
+	delivery.LatencyMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+	delivery.Success = sendErr == nil && statusCode >= 200 && statusCode < 300
+
+	if !delivery.Success && hook.Active && attempt < MaxAttempts && retryable(statusCode) {
+		next := time.Now().Add(RetryDelay(attempt))
+		delivery.NextRetryAt = &next
+	}
+
+	if err := d.db.Create(&delivery).Error; err != nil {
+		return delivery, err
+	}
+	return delivery, nil
+}
+
+// Redeliver sends the payload of a previous delivery again as a new,
+// separately logged attempt.
+func (d *Dispatcher) Redeliver(ctx context.Context, hook models.Webhook, previous models.WebhookDelivery) (models.WebhookDelivery, error) {
+	return d.Deliver(ctx, hook, previous.Event, previous.Payload, &previous.ID)
+}
+
+// Publish delivers an event to every active webhook of the user that is
+// subscribed to it, and to the notifiers. Confidential findings skip
+// webhooks that don't allow confidential data.
+func (d *Dispatcher) Publish(ctx context.Context, userID uuid.UUID, event string, data interface{}) error {
+	for _, n := range d.notifiers {
+		n.Notify(ctx, userID, event, data)
+	}
+
+	var hooks []models.Webhook
+	if err := d.db.Where("user_id = ? AND active", userID).Find(&hooks).Error; err != nil {
+		return err
+	}
+
+	var policy classification.Policy
+	f, isFinding := data.(Finding)
+	if isFinding && len(hooks) > 0 {
+		var err error
+		if policy, err = classification.Load(d.db, userID); err != nil {
+			return err
+		}
+	}
+
+	var payload []byte
+	for _, hook := range hooks {
+		if !slices.Contains(hook.Events, event) ||
+			(isFinding && !policy.Outbound(classification.ChannelWebhook, hook.AllowConfidential).Discloses(f.TestName)) {
+			continue
+		}
+		if payload == nil {
+			eventID, err := uuid.NewV7()
+			if err != nil {
+				return err
+			}
+			payload, err = json.Marshal(Event{ID: eventID, Type: event, CreatedAt: time.Now(), Data: data})
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := d.Deliver(ctx, hook, event, payload, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribed reports whether the user has an active webhook subscribed to
+// the event.
+func Subscribed(db *gorm.DB, userID uuid.UUID, event string) (bool, error) {
+	var hooks []models.Webhook
+	if err := db.Select("events").Where("user_id = ? AND active", userID).Find(&hooks).Error; err != nil {
+		return false, err
+	}
+	for _, hook := range hooks {
+		if slices.Contains(hook.Events, event) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Emit publishes an event in the background so the caller isn't held up by
+// slow receivers. Failures are logged.
+func (d *Dispatcher) Emit(userID uuid.UUID, event string, data interface{}) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), emitTimeout)
+		defer cancel()
+		if err := d.Publish(ctx, userID, event, data); err != nil {
+			slog.Error("Failed to publish webhooks for user", "event", event, "user_id", userID, "error", err)
+		}
+	}()
+}
+
+func (d *Dispatcher) send(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AntiGinx-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	signature, keyIDs := SignWithKeys(hook, time.Now(), delivery.Payload)
+	req.Header.Set(SignatureHeader, signature)
+	req.Header.Set(KeyIDHeader, keyIDs)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign computes the signature header value of a payload:
+//
+//	t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<payload>">
+//
+// The HMAC key is the webhook secret. Receivers should recompute the HMAC
+// and reject deliveries with an old timestamp to prevent replays.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, payload)
+}
+
+// SignWithKeys signs a payload with the webhook's current secret and, while
+// a rotation's grace period lasts, with the previous secret as well:
+//
+//	t=<timestamp>,v1=<current signature>,v1=<previous signature>
+//
+// keyIDs lists the KeyID of each signing secret in the same order, for the
+// KeyIDHeader. A delivery is authentic if any v1 signature matches.
+func SignWithKeys(hook models.Webhook, now time.Time, payload []byte) (header, keyIDs string) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	header = "t=" + ts + ",v1=" + signature(hook.Secret, ts, payload)
+	keyIDs = KeyID(hook.Secret)
+	if hook.PreviousSecret != "" && hook.PreviousSecretExpiresAt != nil && now.Before(*hook.PreviousSecretExpiresAt) {
+		header += ",v1=" + signature(hook.PreviousSecret, ts, payload)
+		keyIDs += "," + KeyID(hook.PreviousSecret)
+	}
+	return header, keyIDs
+}
+
+// KeyID identifies a signing secret without revealing it: the first 12 hex
+// characters of its SHA-256 hash.
+func KeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func signature(secret, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Events that webhooks can subscribe to.
+const (
+	EventScanCreated   = "scan.created"
+	EventScanCompleted = "scan.completed"
+	EventScanFailed    = "scan.failed"
+
+	EventScanApprovalRequested = "scan.approval_requested"
+	EventFindingSLABreached    = "finding.sla_breached"
+	EventReportCompleted       = "report.completed"
+
+	// EventFindingTicketRequested asks the receiver to open a ticket for a
+	// finding in the user's issue tracker.
+	EventFindingTicketRequested = "finding.ticket_requested"
+)
+
+// SupportedEvents lists every event a webhook may subscribe to.
+var SupportedEvents = []string{EventScanCreated, EventScanCompleted, EventScanFailed, EventScanApprovalRequested, EventFindingSLABreached, EventReportCompleted, EventFindingTicketRequested}
@@ -0,0 +1,210 @@
+// Package workerauth signs and verifies worker submissions so that a
+// captured request cannot be replayed later, and issues the per-scan upload
+// tokens that authorize them.
+//
+// Every signed request carries a Unix timestamp and a random nonce. The
+// signature is the hex HMAC-SHA256, keyed with the worker secret, of
+//
+//	<timestamp>.<nonce>.<METHOD>.<path>.<body>
+//
+// The server accepts a request only if its timestamp is within ReplayWindow
+// of the server clock and its nonce has not been seen before.
+//
+// Upload tokens are carried by scan tasks. A worker that submits with one
+// instead of an API key can only submit results for that task's scan.
+package workerauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers of a signed request.
+const (
+	TimestampHeader = "X-AntiGinx-Timestamp"
+	NonceHeader     = "X-AntiGinx-Nonce"
+	SignatureHeader = "X-AntiGinx-Signature"
+)
+
+// ReplayWindow is how far a request's timestamp may be from the server
+// clock, in either direction.
+const ReplayWindow = 5 * time.Minute
+
+// Nonce length bounds, in characters.
+const (
+	MinNonceLength = 16
+	MaxNonceLength = 64
+)
+
+// purgeInterval is how often expired nonces are deleted.
+const purgeInterval = 10 * time.Minute
+
+var (
+	ErrStaleTimestamp = errors.New("timestamp is outside the replay window")
+	ErrInvalidNonce   = errors.New("nonce must be 16-64 characters of A-Z, a-z, 0-9, - or _")
+	ErrReplayed       = errors.New("nonce has already been used")
+)
+
+// NewMAC returns an HMAC that has consumed everything that precedes the
+// body in the signed string; the caller writes the body and compares the
+// sum with the request's signature.
+func NewMAC(secret string, timestamp int64, nonce, method, path string) hash.Hash {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + nonce + "." + method + "." + path + "."))
+	return mac
+}
+
+// Sign returns the signature header value of a request.
+func Sign(secret string, timestamp int64, nonce, method, path string, body []byte) string {
+	mac := NewMAC(secret, timestamp, nonce, method, path)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckTimestamp parses a timestamp header and checks it against the replay
+// window.
+func CheckTimestamp(raw string, now time.Time) (int64, error) {
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, ErrStaleTimestamp
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > ReplayWindow || skew < -ReplayWindow {
+		return 0, ErrStaleTimestamp
+	}
+	return ts, nil
+}
+
+// CheckNonce validates the format of a nonce.
+func CheckNonce(nonce string) error {
+	if len(nonce) < MinNonceLength || len(nonce) > MaxNonceLength {
+		return ErrInvalidNonce
+	}
+	for _, r := range nonce {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return ErrInvalidNonce
+		}
+	}
+	return nil
+}
+
+// ClaimNonce records a nonce, failing with ErrReplayed if it was already
+// used. Claiming is atomic, so concurrent replays of one request cannot
+// both succeed.
+func ClaimNonce(db *gorm.DB, nonce string, apiKeyID uuid.UUID) error {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RequestNonce{
+		Nonce:     nonce,
+		APIKeyID:  apiKeyID,
+		CreatedAt: time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// RunPurge periodically deletes nonces that are older than the replay
+// window until ctx is cancelled.
+func RunPurge(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep one extra window so that clock skew between API
+			// instances can't reopen a nonce that is still acceptable.
+			cutoff := time.Now().Add(-2 * ReplayWindow)
+			if err := db.Where("created_at < ?", cutoff).Delete(&models.RequestNonce{}).Error; err != nil {
+				slog.ErrorContext(ctx, "Failed to purge request nonces", "error", err)
+			}
+		}
+	}
+}
+
+// UploadTokenPrefix starts every upload token.
+const UploadTokenPrefix = "agu_"
+
+// DefaultUploadTokenTTL is the lifetime of an upload token unless
+// UPLOAD_TOKEN_TTL sets another one.
+const DefaultUploadTokenTTL = 2 * time.Hour
+
+var (
+	ErrInvalidUploadToken = errors.New("invalid upload token")
+	ErrExpiredUploadToken = errors.New("upload token has expired")
+)
+
+// UploadTokens issues and verifies upload tokens.
+type UploadTokens struct {
+	// Secret is the key tokens are signed with.
+	Secret string
+	// TTL is the lifetime of issued tokens.
+	TTL time.Duration
+}
+
+// Issue returns a token that authorizes submitting results and artifacts
+// for one scan until it expires:
+//
+//	agu_<scan ID>.<expiry unix timestamp>.<hex HMAC-SHA256 of "<scan ID>.<expiry>">
+func (t UploadTokens) Issue(scanID uuid.UUID) string {
+	payload := scanID.String() + "." + strconv.FormatInt(time.Now().Add(t.TTL).Unix(), 10)
+	return UploadTokenPrefix + payload + "." + t.signature(payload)
+}
+
+// Verify checks an upload token and returns the scan it was issued for.
+func (t UploadTokens) Verify(token string, now time.Time) (uuid.UUID, error) {
+	rest, ok := strings.CutPrefix(token, UploadTokenPrefix)
+	if !ok {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+	i := strings.LastIndexByte(rest, '.')
+	if i < 0 {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+	payload, sig := rest[:i], rest[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(t.signature(payload))) {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+
+	rawID, rawExpiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+	scanID, err := uuid.Parse(rawID)
+	if err != nil {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+	expiry, err := strconv.ParseInt(rawExpiry, 10, 64)
+	if err != nil {
+		return uuid.Nil, ErrInvalidUploadToken
+	}
+	if now.Unix() > expiry {
+		return uuid.Nil, ErrExpiredUploadToken
+	}
+	return scanID, nil
+}
+
+func (t UploadTokens) signature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(t.Secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
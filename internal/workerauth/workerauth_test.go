@@ -0,0 +1,228 @@
+package workerauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+)
+
+const testSecret = "worker-secret"
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"scan_id":"0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b"}`)
+	want := hmac.New(sha256.New, []byte(testSecret))
+	want.Write([]byte("1748786400.nonce-0123456789abcdef.POST./api/results." + string(body)))
+
+	got := Sign(testSecret, 1748786400, "nonce-0123456789abcdef", "POST", "/api/results", body)
+	if got != hex.EncodeToString(want.Sum(nil)) {
+		t.Fatalf("Sign() = %s, want the HMAC of <timestamp>.<nonce>.<METHOD>.<path>.<body>", got)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		nonce     string
+		method    string
+		path      string
+		body      string
+	}{
+		{"secret", "other-secret", 1748786400, "nonce-0123456789abcdef", "POST", "/api/results", string(body)},
+		{"timestamp", testSecret, 1748786401, "nonce-0123456789abcdef", "POST", "/api/results", string(body)},
+		{"nonce", testSecret, 1748786400, "nonce-0123456789abcdeF", "POST", "/api/results", string(body)},
+		{"method", testSecret, 1748786400, "nonce-0123456789abcdef", "PUT", "/api/results", string(body)},
+		{"path", testSecret, 1748786400, "nonce-0123456789abcdef", "POST", "/api/results/stream", string(body)},
+		{"body", testSecret, 1748786400, "nonce-0123456789abcdef", "POST", "/api/results", strings.Replace(string(body), "6b", "6c", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if other := Sign(tt.secret, tt.timestamp, tt.nonce, tt.method, tt.path, []byte(tt.body)); other == got {
+				t.Errorf("changing the %s doesn't change the signature", tt.name)
+			}
+		})
+	}
+}
+
+func TestNewMACStreamsBody(t *testing.T) {
+	body := []byte(strings.Repeat("result ", 1000))
+	mac := NewMAC(testSecret, 1748786400, "nonce-0123456789abcdef", "POST", "/api/results")
+	for rest := body; len(rest) > 0; {
+		n := min(333, len(rest))
+		mac.Write(rest[:n])
+		rest = rest[n:]
+	}
+	want := Sign(testSecret, 1748786400, "nonce-0123456789abcdef", "POST", "/api/results", body)
+	if got := hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("streamed MAC = %s, want %s", got, want)
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Unix(1748786400, 0)
+	unix := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"now", unix(0), false},
+		{"recent", unix(-time.Minute), false},
+		{"oldest accepted", unix(-ReplayWindow), false},
+		{"expired", unix(-ReplayWindow - time.Second), true},
+		{"slightly ahead", unix(time.Minute), false},
+		{"furthest ahead accepted", unix(ReplayWindow), false},
+		{"future", unix(ReplayWindow + time.Second), true},
+		{"empty", "", true},
+		{"not a number", "yesterday", true},
+		{"milliseconds", strconv.FormatInt(now.UnixMilli(), 10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := CheckTimestamp(tt.raw, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrStaleTimestamp) {
+					t.Fatalf("CheckTimestamp(%q) error = %v, want ErrStaleTimestamp", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CheckTimestamp(%q) error = %v", tt.raw, err)
+			}
+			if strconv.FormatInt(ts, 10) != tt.raw {
+				t.Errorf("CheckTimestamp(%q) = %d", tt.raw, ts)
+			}
+		})
+	}
+}
+
+func TestCheckNonce(t *testing.T) {
+	tests := []struct {
+		nonce   string
+		wantErr bool
+	}{
+		{"0123456789abcdef", false},
+		{"AZaz09-_AZaz09-_", false},
+		{strings.Repeat("n", MaxNonceLength), false},
+		{"0123456789abcde", true},
+		{strings.Repeat("n", MaxNonceLength+1), true},
+		{"0123456789abcde.", true},
+		{"0123456789abcde ", true},
+		{"0123456789abcdeé", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nonce, func(t *testing.T) {
+			err := CheckNonce(tt.nonce)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("CheckNonce(%q) error = %v, want error %v", tt.nonce, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidNonce) {
+				t.Errorf("CheckNonce(%q) error = %v, want ErrInvalidNonce", tt.nonce, err)
+			}
+		})
+	}
+}
+
+// nonceStore answers the inserts of ClaimNonce like the request_nonces
+// table with its primary key and ON CONFLICT DO NOTHING.
+type nonceStore struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (s *nonceStore) handle(query string, args []driver.NamedValue) (dbtest.Result, error) {
+	if !strings.HasPrefix(query, `INSERT INTO "request_nonces"`) || !strings.Contains(query, "ON CONFLICT DO NOTHING") {
+		return dbtest.Result{}, errors.New("unexpected statement: " + query)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nonce := args[0].Value.(string)
+	if s.seen[nonce] {
+		return dbtest.Result{}, nil
+	}
+	s.seen[nonce] = true
+	return dbtest.Result{RowsAffected: 1}, nil
+}
+
+func TestClaimNonce(t *testing.T) {
+	store := &nonceStore{seen: map[string]bool{}}
+	db := dbtest.Open(t, store.handle)
+	keyID := uuid.New()
+
+	steps := []struct {
+		name  string
+		nonce string
+		want  error
+	}{
+		{"first use", "nonce-0123456789abcdef", nil},
+		{"reuse", "nonce-0123456789abcdef", ErrReplayed},
+		{"reuse again", "nonce-0123456789abcdef", ErrReplayed},
+		{"other nonce", "nonce-fedcba9876543210", nil},
+	}
+	for _, step := range steps {
+		if err := ClaimNonce(db, step.nonce, keyID); !errors.Is(err, step.want) {
+			t.Errorf("%s: ClaimNonce(%q) error = %v, want %v", step.name, step.nonce, err, step.want)
+		}
+	}
+}
+
+func TestUploadTokens(t *testing.T) {
+	tokens := UploadTokens{Secret: testSecret, TTL: time.Hour}
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	otherScanID := uuid.MustParse("0190a3b2-9d8e-7f6a-8b5c-4d3e2f1a0b9c")
+	token := tokens.Issue(scanID)
+	now := time.Now()
+
+	expiry := strings.Split(token, ".")[1]
+	// A token for another scan signed with the right secret, and one for
+	// another scan with the signature of this one.
+	otherScan := tokens.Issue(otherScanID)
+	swapped := strings.Replace(token, scanID.String(), otherScanID.String(), 1)
+	lastDigit := "0"
+	if strings.HasSuffix(token, "0") {
+		lastDigit = "1"
+	}
+
+	tests := []struct {
+		name    string
+		tokens  UploadTokens
+		token   string
+		now     time.Time
+		want    uuid.UUID
+		wantErr error
+	}{
+		{"round trip", tokens, token, now, scanID, nil},
+		{"other scan", tokens, otherScan, now, otherScanID, nil},
+		{"just before expiry", tokens, token, now.Add(time.Hour - time.Second), scanID, nil},
+		{"expired", tokens, token, now.Add(time.Hour + time.Second), uuid.Nil, ErrExpiredUploadToken},
+		{"wrong secret", UploadTokens{Secret: "other-secret", TTL: time.Hour}, token, now, uuid.Nil, ErrInvalidUploadToken},
+		{"scan swapped", tokens, swapped, now, uuid.Nil, ErrInvalidUploadToken},
+		{"expiry extended", tokens, strings.Replace(token, "."+expiry+".", ".9999999999.", 1), now, uuid.Nil, ErrInvalidUploadToken},
+		{"signature changed", tokens, token[:len(token)-1] + lastDigit, now, uuid.Nil, ErrInvalidUploadToken},
+		{"no prefix", tokens, strings.TrimPrefix(token, UploadTokenPrefix), now, uuid.Nil, ErrInvalidUploadToken},
+		{"API key", tokens, "agx_0123456789abcdef", now, uuid.Nil, ErrInvalidUploadToken},
+		{"empty", tokens, "", now, uuid.Nil, ErrInvalidUploadToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tokens.Verify(tt.token, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/apikeys"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/sealedclaims"
+	"github.com/prawo-i-piesc/backend/internal/usage"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+	"gorm.io/gorm"
+)
+
+// lastUsedResolution limits how often last_used_at is written for a key,
+// so busy workers don't cause a database write per request.
+const lastUsedResolution = time.Minute
+
+// RequireAPIKey authenticates machine clients (scan workers) with an API
+// key sent in the X-API-Key header or as "Authorization: Bearer agx_...".
+// See authenticateAPIKey for the context values it sets.
+func RequireAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := apiKeyFromRequest(c)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			return
+		}
+		if !authenticateAPIKey(c, db, key) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireWorkerAuth authenticates worker submissions with either a
+// per-scan upload token (X-Upload-Token header or "Authorization: Bearer
+// agu_...") or an API key (as RequireAPIKey). For upload tokens the scan
+// the token was issued for is stored in the context as "uploadScanID";
+// handlers must reject submissions for any other scan.
+func RequireWorkerAuth(db *gorm.DB, uploadTokens workerauth.UploadTokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Upload-Token")
+		if auth := c.GetHeader("Authorization"); token == "" && strings.HasPrefix(auth, "Bearer "+workerauth.UploadTokenPrefix) {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if token != "" {
+			scanID, err := uploadTokens.Verify(token, time.Now())
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set("uploadScanID", scanID.String())
+			c.Next()
+			return
+		}
+
+		key := apiKeyFromRequest(c)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Upload token or API key required"})
+			return
+		}
+		if !authenticateAPIKey(c, db, key) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAuthOrAPIKey accepts either a user's JWT (as RequireAuth) or an
+// API key (as RequireAPIKey). Requests made with an API key act on behalf
+// of the key's creator; RequireScopes decides which routes they may use.
+func RequireAuthOrAPIKey(db *gorm.DB, jwtSecret string, claimsKey sealedclaims.Key) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			if !authenticateAPIKey(c, db, key) {
+				return
+			}
+			c.Set("userID", c.GetString("apiKeyOwner"))
+			logging.SetUserID(c.Request.Context(), c.GetString("apiKeyOwner"))
+			c.Next()
+			return
+		}
+		if !authenticateJWT(c, db, jwtSecret, claimsKey) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScopes restricts requests made with an API key to the routes
+// listed in scopes, keyed by "<METHOD> <route pattern>", for keys that
+// have the route's scope. Routes missing from the map can't be used with
+// API keys at all. Requests authenticated otherwise are not affected.
+func RequireScopes(scopes map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("apiKeyID") == "" {
+			c.Next()
+			return
+		}
+
+		scope, ok := scopes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API key"})
+			return
+		}
+		if !apikeys.HasScope(c.GetStringSlice("apiKeyScopes"), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope restricts requests made with an API key to keys that have
+// the scope. Requests authenticated otherwise are not affected.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("apiKeyID") != "" && !apikeys.HasScope(c.GetStringSlice("apiKeyScopes"), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer "+apikeys.KeyPrefix) {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// authenticateAPIKey looks up an API key and stores its ID ("apiKeyID"),
+// owner ("apiKeyOwner"), scopes ("apiKeyScopes") and rate limit
+// ("apiKeyRateLimit") in the context. On failure the request is aborted
+// and false is returned.
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, key string) bool {
+	var apiKey models.APIKey
+	result := db.Where("key_hash = ?", apikeys.Hash(key)).First(&apiKey)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return false
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	if apiKey.RevokedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+		return false
+	}
+	var disabledOwners int64
+	if err := db.Model(&models.User{}).Where("id = ? AND disabled_at IS NOT NULL", apiKey.CreatedBy).Count(&disabledOwners).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if disabledOwners > 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The account of the API key is disabled"})
+		return false
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		db.Model(&models.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", now)
+	}
+
+	scopes := []string(apiKey.Scopes)
+	if len(scopes) == 0 {
+		scopes = apikeys.LegacyScopes
+	}
+
+	c.Set("apiKeyID", apiKey.ID.String())
+	c.Set("apiKeyOwner", apiKey.CreatedBy.String())
+	c.Set("apiKeyScopes", scopes)
+	c.Set("apiKeyRateLimit", apiKey.RateLimitPerMinute)
+	return true
+}
+
+// TrackAPIUsage records every request authenticated by RequireAPIKey and
+// enforces the key's per-minute rate limit, answering 429 with Retry-After
+// once it is exceeded. It must run after RequireAPIKey.
+func TrackAPIUsage(tracker *usage.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKeyID, err := uuid.Parse(c.GetString("apiKeyID"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			tracker.Record(apiKeyID, c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+		}()
+
+		if ok, retryAfter := tracker.Allow(apiKeyID, c.GetInt("apiKeyRateLimit")); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "API key rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
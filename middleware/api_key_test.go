@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+)
+
+func TestRequireWorkerAuthUploadToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := workerauth.UploadTokens{Secret: testWorkerSecret, TTL: time.Hour}
+	scanID := uuid.MustParse("0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	token := tokens.Issue(scanID)
+	expired := workerauth.UploadTokens{Secret: testWorkerSecret, TTL: -time.Minute}.Issue(scanID)
+	forged := workerauth.UploadTokens{Secret: "other-secret", TTL: time.Hour}.Issue(scanID)
+
+	// Upload tokens never reach the database; API keys would.
+	r := gin.New()
+	r.POST("/api/results", RequireWorkerAuth(nil, tokens), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("uploadScanID"))
+	})
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"header", "X-Upload-Token", token, http.StatusOK},
+		{"bearer", "Authorization", "Bearer " + token, http.StatusOK},
+		{"expired", "X-Upload-Token", expired, http.StatusUnauthorized},
+		{"forged", "X-Upload-Token", forged, http.StatusUnauthorized},
+		{"malformed", "X-Upload-Token", "agu_" + scanID.String(), http.StatusUnauthorized},
+		{"missing", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/results", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != scanID.String() {
+				t.Errorf("uploadScanID = %q, want %s", w.Body, scanID)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bulkheadRetryAfter is the delay, in seconds, suggested to clients
+// refused by a full bulkhead.
+const bulkheadRetryAfter = "1"
+
+// Bulkhead isolates a class of routes: at most maxConcurrent of its
+// requests are served at once, and each runs with a context deadline of
+// timeout. Requests beyond the cap are refused right away with 503 and
+// Retry-After instead of queueing, so a flood of one class can't tie up
+// the server for the others. The timeout only interrupts handlers that
+// pass the request context on; one that runs past it without writing a
+// response gets 504.
+func Bulkhead(name string, maxConcurrent int, timeout time.Duration) gin.HandlerFunc {
+	slots := make(chan struct{}, maxConcurrent)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			slog.WarnContext(c.Request.Context(), "Bulkhead full, refusing request", "bulkhead", name, "max_concurrent", maxConcurrent)
+			c.Header("Retry-After", bulkheadRetryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is busy, try again later"})
+			return
+		}
+		defer func() { <-slots }()
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			slog.WarnContext(ctx, "Request timed out", "bulkhead", name, "timeout", timeout)
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
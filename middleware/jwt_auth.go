@@ -3,63 +3,130 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/prawo-i-piesc/backend/internal/logging"
 	"github.com/prawo-i-piesc/backend/internal/models"
+	"github.com/prawo-i-piesc/backend/internal/sealedclaims"
 	"gorm.io/gorm"
 )
 
-func RequireAuth() gin.HandlerFunc {
+// RequireAuth authenticates requests with a session token signed with
+// secret. claimsKey opens the token's sealed claims, if it has any.
+func RequireAuth(db *gorm.DB, secret string, claimsKey sealedclaims.Key) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Access not authorized",
-			})
-			return
-		}
-
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format (Bearer required)"})
+		if !authenticateJWT(c, db, secret, claimsKey) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+// authenticateJWT validates the bearer token and stores its subject
+// ("userID"), role ("userRole") and session ("sessionID") in the context.
+// The token's session must not have been revoked. Sealed claims are
+// opened with claimsKey; tokens issued before the key was configured
+// still carry their claims in the clear and are accepted until they
+// expire, as are tokens issued before sessions were tracked. On failure
+// the request is aborted and false is returned.
+func authenticateJWT(c *gin.Context, db *gorm.DB, secret string, claimsKey sealedclaims.Key) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Access not authorized",
+		})
+		return false
+	}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format (Bearer required)"})
+		return false
+	}
 
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			return
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if sub, ok := claims["sub"].(string); ok {
-				c.Set("userID", sub)
-			} else {
+		return []byte(secret), nil
+	})
+
+	if err != nil || !token.Valid {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return false
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		sub, ok := claims["sub"].(string)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			return false
+		}
+		if sealed, ok := claims[sealedclaims.Claim].(string); ok {
+			if claimsKey == nil {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-				return
+				return false
 			}
-
-			if role, ok := claims["role"].(string); ok {
-				c.Set("userRole", strings.ToLower(strings.TrimSpace(role)))
+			opened, err := claimsKey.Open(sub, sealed)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				return false
+			}
+			for name, v := range opened {
+				claims[name] = v
+			}
+		}
+		if sid, ok := claims["sid"].(string); ok {
+			if !checkSession(c, db, sid, sub) {
+				return false
 			}
+			c.Set("sessionID", sid)
 		}
+		c.Set("userID", sub)
+		logging.SetUserID(c.Request.Context(), sub)
 
-		c.Next()
+		if role, ok := claims["role"].(string); ok {
+			c.Set("userRole", strings.ToLower(strings.TrimSpace(role)))
+		}
 	}
+
+	return true
 }
 
-func RequireAdmin(db *gorm.DB) gin.HandlerFunc {
+// checkSession verifies that the session of a token is still active and
+// records that it was seen, at most once per lastUsedResolution.
+func checkSession(c *gin.Context, db *gorm.DB, sessionID, userID string) bool {
+	var session models.Session
+	result := db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			return false
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if session.RevokedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return false
+	}
+
+	now := time.Now()
+	if ip := c.ClientIP(); now.Sub(session.LastSeenAt) >= lastUsedResolution || ip != session.IP {
+		db.Model(&session).Updates(map[string]interface{}{"last_seen_at": now, "ip": ip})
+	}
+	return true
+}
+
+// LoadRole replaces the role from the token claims with the user's current
+// role from the database, so role changes take effect before the token
+// expires. It must run after RequireAuth.
+func LoadRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
 		if !exists {
@@ -84,12 +151,28 @@ func RequireAdmin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if strings.ToLower(strings.TrimSpace(user.Role)) != models.UserRoleAdmin {
+		c.Set("userRole", strings.ToLower(strings.TrimSpace(user.Role)))
+		c.Next()
+	}
+}
+
+// RequireRole allows the request only if the user has one of the given
+// roles. It checks the "userRole" context value set by RequireAuth (from
+// the token) or LoadRole (from the database).
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("userRole")
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+
+		if len(roles) == 1 && roles[0] == models.UserRoleAdmin {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			return
 		}
-
-		c.Set("userRole", models.UserRoleAdmin)
-		c.Next()
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
 	}
 }
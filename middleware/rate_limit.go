@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/ratelimit"
+)
+
+// RateLimitByIP limits requests per client IP, answering 429 with
+// Retry-After once the client's bucket is empty.
+func RateLimitByIP(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit(limiter, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+// RateLimitByUser limits requests per authenticated user and must run
+// after RequireAuth. Requests without a user are limited by client IP.
+func RateLimitByUser(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit(limiter, func(c *gin.Context) string {
+		if userID := c.GetString("userID"); userID != "" {
+			return "user:" + userID
+		}
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func rateLimit(limiter *ratelimit.Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, retryAfter := limiter.Allow(key(c)); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/logging"
+)
+
+// RequestIDHeader carries the request ID. A client-supplied ID is kept so
+// that a request can be traced across services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 64
+
+// RequestLogger assigns every request an ID, stores it in the request
+// context for logging (see package logging) and logs one line per request
+// with its method, route, status code and latency. For routes with a scan
+// ID parameter the scan ID is attached as well.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		ctx := logging.NewContext(c.Request.Context(), requestID)
+		if strings.Contains(c.FullPath(), "scans/:id") {
+			logging.SetScanID(ctx, c.Param("id"))
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		slog.Log(ctx, level, "Request",
+			"method", c.Request.Method,
+			"route", route,
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		)
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so a client
+// can't inject anything into log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxSignedBodyBytes bounds the body of a signed request. Handlers
+	// apply their own, usually lower, limits afterwards.
+	MaxSignedBodyBytes = 64 << 20
+	// signedBodyMemory is how much of a signed body is kept in memory;
+	// larger bodies are spooled to a temporary file while the signature is
+	// checked.
+	signedBodyMemory = 1 << 20
+)
+
+// RequireSignature rejects worker requests that are not signed with the
+// worker secret or that replay an earlier request (see package
+// workerauth). It must run after RequireWorkerAuth. The body is read in full
+// and verified before the handler sees it.
+func RequireSignature(db *gorm.DB, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ts, err := workerauth.CheckTimestamp(c.GetHeader(workerauth.TimestampHeader), time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		nonce := c.GetHeader(workerauth.NonceHeader)
+		if err := workerauth.CheckNonce(nonce); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		signature, err := hex.DecodeString(c.GetHeader(workerauth.SignatureHeader))
+		if err != nil || len(signature) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Request signature required"})
+			return
+		}
+
+		mac := workerauth.NewMAC(secret, ts, nonce, c.Request.Method, c.Request.URL.Path)
+		body, cleanup, err := spoolBody(io.TeeReader(http.MaxBytesReader(c.Writer, c.Request.Body, MaxSignedBodyBytes), mac))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+				return
+			}
+			slog.Error("Failed to read signed request body", "error", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		defer cleanup()
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+			return
+		}
+
+		apiKeyID, _ := uuid.Parse(c.GetString("apiKeyID"))
+		if err := workerauth.ClaimNonce(db, nonce, apiKeyID); err != nil {
+			if errors.Is(err, workerauth.ErrReplayed) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Request has already been processed"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.Request.Body = body
+		c.Next()
+	}
+}
+
+// spoolBody reads r to the end, keeping small bodies in memory and
+// spilling larger ones to a temporary file. cleanup releases the file.
+func spoolBody(r io.Reader) (body io.ReadCloser, cleanup func(), err error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, signedBodyMemory); err != nil {
+		if err == io.EOF {
+			return io.NopCloser(&buf), func() {}, nil
+		}
+		return nil, nil, err
+	}
+
+	f, err := os.CreateTemp("", "antiginx-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return io.NopCloser(f), cleanup, nil
+}
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prawo-i-piesc/backend/internal/dbtest"
+	"github.com/prawo-i-piesc/backend/internal/workerauth"
+)
+
+const testWorkerSecret = "worker-secret"
+
+// nonceTable answers the inserts of workerauth.ClaimNonce like the
+// request_nonces table.
+type nonceTable struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (n *nonceTable) handle(query string, args []driver.NamedValue) (dbtest.Result, error) {
+	if !strings.HasPrefix(query, `INSERT INTO "request_nonces"`) {
+		return dbtest.Result{}, errors.New("unexpected statement: " + query)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	nonce := args[0].Value.(string)
+	if n.seen[nonce] {
+		return dbtest.Result{}, nil
+	}
+	n.seen[nonce] = true
+	return dbtest.Result{RowsAffected: 1}, nil
+}
+
+// signedRequest is a request to sign with the worker secret; the zero
+// values of the overrides sign exactly what is sent.
+type signedRequest struct {
+	method, path string
+	body         []byte
+	timestamp    time.Time
+	nonce        string
+
+	// signedPath and signedBody, when set, are signed instead of what is
+	// sent, as a tampering proxy would leave them.
+	signedPath string
+	signedBody []byte
+	signature  *string
+}
+
+func (r signedRequest) build() *http.Request {
+	ts := r.timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	signedPath, signedBody := r.path, r.body
+	if r.signedPath != "" {
+		signedPath = r.signedPath
+	}
+	if r.signedBody != nil {
+		signedBody = r.signedBody
+	}
+	signature := workerauth.Sign(testWorkerSecret, ts.Unix(), r.nonce, r.method, signedPath, signedBody)
+	if r.signature != nil {
+		signature = *r.signature
+	}
+
+	req := httptest.NewRequest(r.method, r.path, bytes.NewReader(r.body))
+	req.Header.Set(workerauth.TimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set(workerauth.NonceHeader, r.nonce)
+	req.Header.Set(workerauth.SignatureHeader, signature)
+	return req
+}
+
+// signatureRouter serves POST /api/results and /api/results/stream behind
+// RequireSignature, echoing the body the handler receives.
+func signatureRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	db := dbtest.Open(t, (&nonceTable{seen: map[string]bool{}}).handle)
+
+	r := gin.New()
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			t.Errorf("read verified body: %v", err)
+		}
+		c.Data(http.StatusOK, "application/octet-stream", body)
+	}
+	signed := r.Group("/api", func(c *gin.Context) {
+		c.Set("apiKeyID", "0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b")
+	}, RequireSignature(db, testWorkerSecret))
+	signed.POST("/results", echo)
+	signed.POST("/results/stream", echo)
+	return r
+}
+
+func TestRequireSignature(t *testing.T) {
+	body := []byte(`{"scan_id":"0190a3b2-7c4d-7e8f-9a0b-1c2d3e4f5a6b","status":"COMPLETED"}`)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 3*signedBodyMemory/16)
+	notHex := "not-a-signature"
+	empty := ""
+
+	tests := []struct {
+		name       string
+		req        signedRequest
+		wantStatus int
+	}{
+		{"valid", signedRequest{method: "POST", path: "/api/results", body: body}, http.StatusOK},
+		{"empty body", signedRequest{method: "POST", path: "/api/results", body: []byte{}}, http.StatusOK},
+		{"spooled body", signedRequest{method: "POST", path: "/api/results", body: large}, http.StatusOK},
+		{"tampered body", signedRequest{method: "POST", path: "/api/results", body: body, signedBody: bytes.Replace(body, []byte("COMPLETED"), []byte("FAILED"), 1)}, http.StatusUnauthorized},
+		{"tampered spooled body", signedRequest{method: "POST", path: "/api/results", body: large, signedBody: append(large[:len(large)-1:len(large)-1], 'x')}, http.StatusUnauthorized},
+		{"tampered path", signedRequest{method: "POST", path: "/api/results/stream", body: body, signedPath: "/api/results"}, http.StatusUnauthorized},
+		{"expired", signedRequest{method: "POST", path: "/api/results", body: body, timestamp: time.Now().Add(-workerauth.ReplayWindow - time.Minute)}, http.StatusUnauthorized},
+		{"future", signedRequest{method: "POST", path: "/api/results", body: body, timestamp: time.Now().Add(workerauth.ReplayWindow + time.Minute)}, http.StatusUnauthorized},
+		{"invalid nonce", signedRequest{method: "POST", path: "/api/results", body: body, nonce: "short"}, http.StatusUnauthorized},
+		{"signature not hex", signedRequest{method: "POST", path: "/api/results", body: body, signature: &notHex}, http.StatusUnauthorized},
+		{"no signature", signedRequest{method: "POST", path: "/api/results", body: body, signature: &empty}, http.StatusUnauthorized},
+	}
+	r := signatureRouter(t)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.req.nonce == "" {
+				tt.req.nonce = "nonce-" + strconv.Itoa(1000000000+i) + "abcdef"
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tt.req.build())
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusOK && !bytes.Equal(w.Body.Bytes(), tt.req.body) {
+				t.Errorf("handler received %d bytes, want the %d signed ones", w.Body.Len(), len(tt.req.body))
+			}
+		})
+	}
+}
+
+func TestRequireSignatureRejectsReusedNonce(t *testing.T) {
+	r := signatureRouter(t)
+	req := signedRequest{method: "POST", path: "/api/results", body: []byte(`{}`), nonce: "nonce-0123456789abcdef"}
+
+	steps := []struct {
+		name       string
+		req        signedRequest
+		wantStatus int
+	}{
+		{"first use", req, http.StatusOK},
+		{"replay", req, http.StatusConflict},
+		// A fresh signature doesn't make a used nonce acceptable again.
+		{"re-signed", signedRequest{method: "POST", path: "/api/results/stream", body: []byte(`{"a":1}`), nonce: req.nonce}, http.StatusConflict},
+		{"new nonce", signedRequest{method: "POST", path: "/api/results", body: []byte(`{}`), nonce: "nonce-fedcba9876543210"}, http.StatusOK},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, step.req.build())
+		if w.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+		}
+	}
+}
+
+func TestRequireSignatureRejectsOversizedBody(t *testing.T) {
+	r := signatureRouter(t)
+	req := signedRequest{method: "POST", path: "/api/results", nonce: "nonce-0123456789abcdef"}.build()
+	req.Body = io.NopCloser(io.LimitReader(zeroReader{}, MaxSignedBodyBytes+1))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestSpoolBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		wantFiles int
+	}{
+		{"empty", 0, 0},
+		{"small", 1024, 0},
+		{"just below the memory limit", signedBodyMemory - 1, 0},
+		{"at the memory limit", signedBodyMemory, 1},
+		{"large", 3*signedBodyMemory + 7, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			spooled := func() int {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatalf("read temporary directory: %v", err)
+				}
+				return len(entries)
+			}
+
+			want := bytes.Repeat([]byte{'a'}, tt.size)
+			body, cleanup, err := spoolBody(bytes.NewReader(want))
+			if err != nil {
+				t.Fatalf("spoolBody() error = %v", err)
+			}
+			if n := spooled(); n != tt.wantFiles {
+				t.Errorf("%d temporary files while the body is held, want %d", n, tt.wantFiles)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read spooled body: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("spooled body has %d bytes, want %d", len(got), len(want))
+			}
+
+			cleanup()
+			if n := spooled(); n != 0 {
+				t.Errorf("%d temporary files left after cleanup", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Package client is a Go client of the AntiGinx API, for integrators
+// submitting scans and reading their results, and for workers submitting
+// the results of the scans they ran:
+//
+//	c := client.New(client.Config{BaseURL: "https://api.example.com", APIKey: "agx_..."})
+//	created, err := c.CreateScan(ctx, client.ScanRequest{TargetURL: "https://example.com", Profile: client.ProfileQuick})
+//	if err != nil {
+//		return err
+//	}
+//	scan, err := c.WaitForCompletion(ctx, created.ID, 5*time.Second, nil)
+//
+// Error responses of the API are returned as *APIError, which matches
+// ErrNotFound and the other sentinel errors with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent is sent unless Config sets another one.
+const DefaultUserAgent = "antiginx-go"
+
+// maxResponseBody bounds the response bodies read from the API.
+const maxResponseBody = 32 << 20
+
+// Config configures a Client. Integrators authenticate with an API key;
+// workers with an API key with the results:write scope, or with the upload
+// token of their task (see WithUploadToken).
+type Config struct {
+	// BaseURL is the URL of the API, without the /api prefix.
+	BaseURL string
+	// APIKey authenticates as the key's creator, with the key's scopes.
+	APIKey string
+	// SigningSecret signs worker submissions with the server's
+	// WORKER_SIGNING_SECRET, which the server requires when it is set.
+	SigningSecret string
+	// HTTPClient sends the requests; by default a client with a one
+	// minute timeout.
+	HTTPClient *http.Client
+	// UserAgent defaults to DefaultUserAgent.
+	UserAgent string
+}
+
+// Client calls the AntiGinx API. It is safe for concurrent use.
+type Client struct {
+	baseURL       string
+	apiKey        string
+	uploadToken   string
+	signingSecret string
+	http          *http.Client
+	userAgent     string
+}
+
+// New returns a client of the API configured by cfg.
+func New(cfg Config) *Client {
+	c := &Client{
+		baseURL:       strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:        cfg.APIKey,
+		signingSecret: cfg.SigningSecret,
+		http:          cfg.HTTPClient,
+		userAgent:     cfg.UserAgent,
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: time.Minute}
+	}
+	if c.userAgent == "" {
+		c.userAgent = DefaultUserAgent
+	}
+	return c
+}
+
+// WithUploadToken returns a copy of the client that submits results with
+// the upload token of a scan task instead of the API key. Such a client can
+// only submit the results of that task's scan.
+func (c *Client) WithUploadToken(token string) *Client {
+	copied := *c
+	copied.uploadToken = token
+	return &copied
+}
+
+// do sends a request with a JSON body, if body isn't nil, and decodes the
+// JSON response into out, if out isn't nil. Worker requests are signed
+// when the client has a signing secret.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}, signed bool) error {
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.uploadToken != "" && signed {
+		req.Header.Set("X-Upload-Token", c.uploadToken)
+	} else if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if signed && c.signingSecret != "" {
+		if err := c.sign(req, raw); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &errBody) == nil {
+			apiErr.Message = errBody.Error
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// sign adds the headers of a signed worker request: a timestamp, a random
+// nonce and the hex HMAC-SHA256, keyed with the signing secret, of
+// "<timestamp>.<nonce>.<METHOD>.<path>.<body>".
+func (c *Client) sign(req *http.Request, body []byte) error {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(raw)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(c.signingSecret))
+	mac.Write([]byte(timestamp + "." + nonce + "." + req.Method + "." + req.URL.Path + "."))
+	mac.Write(body)
+	req.Header.Set("X-AntiGinx-Timestamp", timestamp)
+	req.Header.Set("X-AntiGinx-Nonce", nonce)
+	req.Header.Set("X-AntiGinx-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
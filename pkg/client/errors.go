@@ -0,0 +1,57 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Errors an APIError matches with errors.Is, by its status code.
+var (
+	ErrUnauthorized = errors.New("antiginx: missing or invalid credentials")
+	ErrForbidden    = errors.New("antiginx: not allowed")
+	ErrNotFound     = errors.New("antiginx: not found")
+	ErrConflict     = errors.New("antiginx: conflict")
+	ErrRateLimited  = errors.New("antiginx: rate limit or quota exceeded")
+)
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	// Message is the "error" field of the response, if any.
+	Message string
+	// RetryAfter is the delay asked for by a 429 or 503 response.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("the AntiGinx API responded with %d", e.StatusCode)
+	}
+	return fmt.Sprintf("the AntiGinx API responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Is matches the sentinel error of the status code, so that callers can
+// write errors.Is(err, client.ErrNotFound).
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed when retried, after
+// RetryAfter if it is set.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
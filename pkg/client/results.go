@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ResultSubmission is the body of POST /api/results: the results of a
+// scan a worker ran.
+type ResultSubmission struct {
+	ScanID string `json:"scan_id"`
+	// Status is StatusCompleted or StatusFailed.
+	Status      string       `json:"status"`
+	StartedAt   time.Time    `json:"started_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+	Results     []TestResult `json:"results"`
+}
+
+// TestResult is the result of one test in a ResultSubmission.
+type TestResult struct {
+	TestID      string `json:"test_id"`
+	TestName    string `json:"test_name"`
+	Category    string `json:"category"`
+	Severity    string `json:"severity"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+	// ArtifactID references evidence, such as a screenshot, uploaded for
+	// the scan.
+	ArtifactID string `json:"artifact_id,omitempty"`
+}
+
+// SubmissionReceipt is the response to SubmitResults.
+type SubmissionReceipt struct {
+	// Saved is how many results were stored.
+	Saved  int    `json:"saved"`
+	Status string `json:"status"`
+}
+
+// SubmitResults submits the results of a scan. It needs the upload token
+// of the scan's task (see WithUploadToken) or an API key with the
+// results:write scope, and is signed when the client has a signing
+// secret.
+func (c *Client) SubmitResults(ctx context.Context, submission ResultSubmission) (*SubmissionReceipt, error) {
+	var receipt SubmissionReceipt
+	if err := c.do(ctx, http.MethodPost, "/api/results", nil, submission, &receipt, true); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Profiles of the tests a scan runs.
+const (
+	ProfileQuick  = "quick"
+	ProfileFull   = "full"
+	ProfileCustom = "custom"
+)
+
+// Statuses of a scan.
+const (
+	StatusPendingApproval = "PENDING_APPROVAL"
+	StatusPending         = "PENDING"
+	StatusRunning         = "RUNNING"
+	StatusCompleted       = "COMPLETED"
+	StatusFailed          = "FAILED"
+	StatusCancelled       = "CANCELLED"
+	StatusRejected        = "REJECTED"
+)
+
+// Finished reports whether a scan with the status is done, successfully
+// or not.
+func Finished(status string) bool {
+	switch status {
+	case StatusCompleted, StatusFailed, StatusCancelled, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// ScanRequest is the body of POST /api/scans. Either Profile or Tests is
+// required.
+type ScanRequest struct {
+	TargetURL string `json:"target_url"`
+	// Profile is ProfileQuick or ProfileFull; Tests, a list of test IDs
+	// and category names, runs a custom selection instead.
+	Profile          string   `json:"profile,omitempty"`
+	Tests            []string `json:"tests,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Priority         string   `json:"priority,omitempty"`
+	Screenshot       bool     `json:"screenshot,omitempty"`
+	AuthorizedTester bool     `json:"authorized_tester,omitempty"`
+	AntiBotDetection bool     `json:"anti_bot_detection,omitempty"`
+	// ReuseRecent returns a recent scan of the target with the same tests
+	// instead of starting a new one.
+	ReuseRecent bool `json:"reuse_recent,omitempty"`
+	// OrganizationID shares the scan with an organization.
+	OrganizationID string `json:"organization_id,omitempty"`
+}
+
+// CreatedScan is the scan started by CreateScan.
+type CreatedScan struct {
+	ID     string `json:"scanId"`
+	Status string `json:"status"`
+}
+
+// Scan is a premium scan.
+type Scan struct {
+	ID             string       `json:"id"`
+	UserID         string       `json:"user_id"`
+	TargetURL      string       `json:"target_url"`
+	Status         string       `json:"status"`
+	Profile        string       `json:"profile"`
+	Tests          []string     `json:"tests,omitempty"`
+	Priority       string       `json:"priority"`
+	Screenshot     bool         `json:"screenshot"`
+	Tags           []string     `json:"tags,omitempty"`
+	OrganizationID string       `json:"organization_id,omitempty"`
+	BatchID        string       `json:"batch_id,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	StartedAt      *time.Time   `json:"started_at"`
+	CompletedAt    *time.Time   `json:"completed_at"`
+	Score          *float64     `json:"score"`
+	Grade          string       `json:"grade"`
+	Results        []ScanResult `json:"results"`
+}
+
+// ScanResult is the result of one test of a scan; failed results are
+// findings.
+type ScanResult struct {
+	ID           uint            `json:"id"`
+	ScanID       string          `json:"scan_id"`
+	TestName     string          `json:"test_name"`
+	Severity     string          `json:"severity"`
+	Passed       bool            `json:"passed"`
+	Message      string          `json:"message"`
+	ArtifactID   string          `json:"artifact_id,omitempty"`
+	TriageStatus string          `json:"triage_status"`
+	AssigneeID   *string         `json:"assignee_id"`
+	TriageNote   string          `json:"triage_note,omitempty"`
+	TriagedAt    *time.Time      `json:"triaged_at,omitempty"`
+	FirstSeenAt  *time.Time      `json:"first_seen_at,omitempty"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
+}
+
+// CreateScan submits a premium scan. It needs the scans:write scope.
+func (c *Client) CreateScan(ctx context.Context, req ScanRequest) (*CreatedScan, error) {
+	var created CreatedScan
+	if err := c.do(ctx, http.MethodPost, "/api/scans", nil, req, &created, false); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetScan returns a scan with its results, most severe first. It needs the
+// scans:read scope.
+func (c *Client) GetScan(ctx context.Context, id string) (*Scan, error) {
+	var scan Scan
+	query := url.Values{"sort": {"severity"}, "include": {"results"}}
+	if err := c.do(ctx, http.MethodGet, "/api/scans/"+url.PathEscape(id), query, nil, &scan, false); err != nil {
+		return nil, err
+	}
+	return &scan, nil
+}
+
+// WaitForCompletion polls a scan every interval until it is finished (see
+// Finished) and returns it, calling progress, if not nil, whenever its
+// status changes. Temporary errors of the API are retried until ctx is
+// done; bound the wait with a deadline on ctx.
+func (c *Client) WaitForCompletion(ctx context.Context, id string, interval time.Duration, progress func(status string)) (*Scan, error) {
+	last := ""
+	for {
+		scan, err := c.GetScan(ctx, id)
+		delay := interval
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			if scan.Status != last {
+				last = scan.Status
+				if progress != nil {
+					progress(scan.Status)
+				}
+			}
+			if Finished(scan.Status) {
+				return scan, nil
+			}
+		case errors.As(err, &apiErr) && apiErr.Temporary():
+			delay = max(delay, apiErr.RetryAfter)
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		default:
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}